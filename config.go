@@ -0,0 +1,933 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"webcrawler/crawler"
+)
+
+// Config holds every crawl setting. It is read from a YAML file with
+// -config; command-line flags override values from the file.
+type Config struct {
+	URL            string        `yaml:"url"`
+	Depth          int           `yaml:"depth"`
+	MaxPathDepth   int           `yaml:"max_path_depth,omitempty"`
+	MaxAddedParams int           `yaml:"max_added_params"`
+	RPS            float64       `yaml:"rps"`
+	Contact        string        `yaml:"contact,omitempty"`
+	AcceptLanguage string        `yaml:"accept_language,omitempty"`
+	Timeout        time.Duration `yaml:"timeout"`
+	MaxPages       int           `yaml:"max_pages"`
+	MaxDuration    time.Duration `yaml:"max_duration"`
+	MaxBytes       int64         `yaml:"max_bytes"`
+	MaxVisited     int           `yaml:"max_visited,omitempty"`
+	MaxBodySize    int64         `yaml:"max_body_size"`
+	HTMLMaxTags    int           `yaml:"html_max_tags"`
+	HTMLMaxNesting int           `yaml:"html_max_nesting"`
+
+	// Include and Exclude are regular expressions matched against
+	// normalized URLs of discovered links. When Include is not empty, a
+	// link must match one of its patterns; a link matching any Exclude
+	// pattern is not crawled.
+	Include []string `yaml:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty"`
+
+	// Languages crawls the site once per Accept-Language value.
+	Languages []string `yaml:"languages,omitempty"`
+
+	// Sitemap seeds the crawl with the URLs it lists. ModifiedSince is a
+	// date, YYYY-MM-DD or RFC 3339, sent as If-Modified-Since.
+	Sitemap       string `yaml:"sitemap,omitempty"`
+	ModifiedSince string `yaml:"modified_since,omitempty"`
+
+	// Feeds are RSS or Atom feeds whose items seed the crawl.
+	Feeds []string `yaml:"feeds,omitempty"`
+
+	// FollowMetaRefresh follows the meta refresh of pages like a redirect.
+	FollowMetaRefresh bool `yaml:"follow_meta_refresh,omitempty"`
+
+	// LowercasePaths lowercases URL paths, for sites that ignore their case.
+	LowercasePaths bool `yaml:"lowercase_paths,omitempty"`
+
+	// OnlyListed names a file of URLs, one per line, that are fetched
+	// instead of crawling from URL.
+	OnlyListed string `yaml:"only_listed,omitempty"`
+
+	// KnownHosts are other hosts of the site that canonical, hreflang and
+	// sitemap URLs may point at without being reported.
+	KnownHosts []string `yaml:"known_hosts,omitempty"`
+
+	// Hosts are further hosts crawled as part of the site, taking turns
+	// with the base host by weight.
+	Hosts []crawler.HostWeight `yaml:"hosts,omitempty"`
+
+	// SlowPatterns throttle matching URLs below RPS.
+	SlowPatterns []crawler.SlowPattern `yaml:"slow_patterns,omitempty"`
+
+	// TOC records the headings and fragment links of every page.
+	TOC bool `yaml:"toc,omitempty"`
+
+	// PerfSignals records the render-blocking resources of every page.
+	PerfSignals bool `yaml:"perf_signals,omitempty"`
+
+	// LegacyMarkup counts the obsolete elements, inline styles and
+	// presentational attributes of every page.
+	LegacyMarkup LegacyMarkupConfig `yaml:"legacy_markup"`
+
+	// SiteHygiene checks the syntax of robots.txt and of the sitemaps.
+	SiteHygiene bool `yaml:"site_hygiene,omitempty"`
+
+	// Robots obeys robots.txt and records the rule deciding every URL.
+	Robots bool `yaml:"robots,omitempty"`
+
+	// Shard is INDEX/COUNT, such as 2/8, for one of several processes
+	// splitting the crawl by URL hash. HandoffDir holds the handoff files
+	// through which the shards pass each other the URLs they discover.
+	Shard      string `yaml:"shard,omitempty"`
+	HandoffDir string `yaml:"handoff_dir,omitempty"`
+
+	// Deterministic crawls one URL at a time in a fixed order so repeated
+	// crawls give the same results. Seed seeds its random choices.
+	Deterministic bool   `yaml:"deterministic,omitempty"`
+	Seed          uint64 `yaml:"seed,omitempty"`
+
+	// Warmup is how long the crawl probes the site at a low rate before
+	// choosing its starting rate; NoWarmup starts at RPS right away.
+	Warmup   time.Duration `yaml:"warmup,omitempty"`
+	NoWarmup bool          `yaml:"no_warmup,omitempty"`
+
+	Format   string        `yaml:"format"`
+	Edges    string        `yaml:"edges,omitempty"`
+	Progress time.Duration `yaml:"progress"`
+	Debug    bool          `yaml:"debug"`
+
+	// Out is the results file, with {host}, {date}, {time} and {format}
+	// placeholders.
+	Out string `yaml:"out,omitempty"`
+	// SplitByHost saves one results file per host the pages ended up on;
+	// Out must then contain {host}.
+	SplitByHost bool `yaml:"split_by_host,omitempty"`
+
+	// ParquetRowGroup is the number of pages per row group of a Parquet
+	// export.
+	ParquetRowGroup int `yaml:"parquet_row_group,omitempty"`
+
+	// OTelEndpoint is the OTLP collector receiving traces: grpc://host:port
+	// or an http(s):// URL. OTelSample is the fraction of pages traced.
+	OTelEndpoint string           `yaml:"otel_endpoint,omitempty"`
+	OTelSample   float64          `yaml:"otel_sample"`
+	Resume       string           `yaml:"resume,omitempty"`
+	Force        bool             `yaml:"force,omitempty"`
+	Record       string           `yaml:"record,omitempty"`
+	Playback     string           `yaml:"playback,omitempty"`
+	FetchCmd     string           `yaml:"fetch_cmd,omitempty"`
+	JSLinks      JSLinksConfig    `yaml:"js_links"`
+	CheckAssets  AssetCheckConfig `yaml:"check_assets"`
+	UACompare    UACompareConfig  `yaml:"ua_compare"`
+	Throttle     ThrottleConfig   `yaml:"throttle"`
+	LinkScore    LinkScoreConfig  `yaml:"link_score"`
+	Retain       RetainConfig     `yaml:"retain"`
+	Dangerous    DangerousConfig  `yaml:"dangerous"`
+
+	// BodyProgress abandons page bodies that arrive slower than Bytes per
+	// Window.
+	BodyProgress BodyProgressConfig `yaml:"body_progress"`
+
+	// Quality holds the weights and thresholds of the quality score;
+	// weights left out keep their defaults.
+	Quality crawler.QualityWeights `yaml:"quality"`
+
+	// Pruning stops expanding URL patterns whose pages stopped yielding
+	// new links or content.
+	Pruning PruningConfig `yaml:"adaptive_pruning"`
+
+	// Circuit pauses the crawl when the site keeps failing, and stops it
+	// when the pauses do not help.
+	Circuit CircuitConfig `yaml:"circuit_breaker"`
+
+	// Classify are the rules giving every page a type; the first rule a
+	// page meets wins.
+	Classify []crawler.ClassifyRule `yaml:"classify,omitempty"`
+
+	// Validations are the assertions checked on every page, and
+	// FailOnValidations makes the crawl exit with status 2 when a page
+	// fails one.
+	Validations       []crawler.ValidationRule `yaml:"validations,omitempty"`
+	FailOnValidations bool                     `yaml:"fail_on_validations,omitempty"`
+
+	// FailOnNewThirdParty is a third-party baseline file: the crawl exits
+	// with status 2 when a page references an origin it does not list.
+	// SaveThirdPartyBaseline writes the origins of the crawl as one.
+	FailOnNewThirdParty    string `yaml:"fail_on_new_third_party,omitempty"`
+	SaveThirdPartyBaseline string `yaml:"save_third_party_baseline,omitempty"`
+
+	// CompareFingerprint is an earlier results file: the crawl exits with
+	// status 2 when its fingerprint differs, naming the changed sections.
+	CompareFingerprint string `yaml:"compare_fingerprint,omitempty"`
+
+	// Strict makes the crawl exit with status 2 when its results break an
+	// invariant of the crawler, listing the violations in the results.
+	Strict bool `yaml:"strict,omitempty"`
+
+	// NoFinalRetry skips fetching URLs that failed with retryable errors
+	// once more at the end of each pass.
+	NoFinalRetry bool `yaml:"no_final_retry,omitempty"`
+
+	// NoHints skips the findings printed after the crawl.
+	NoHints bool `yaml:"no_hints,omitempty"`
+
+	// Manifest is the path of the manifest describing the outputs, next to
+	// the results file when empty. NoManifest skips it, and PrintManifest
+	// prints its path as the last line of the output.
+	Manifest      string `yaml:"manifest,omitempty"`
+	NoManifest    bool   `yaml:"no_manifest,omitempty"`
+	PrintManifest bool   `yaml:"print_manifest,omitempty"`
+}
+
+type JSLinksConfig struct {
+	Enabled bool `yaml:"enabled"`
+	Follow  bool `yaml:"follow"`
+	Max     int  `yaml:"max"`
+}
+
+// LegacyMarkupConfig replaces the elements and attributes counted as
+// legacy markup when Elements or Attributes are set.
+type LegacyMarkupConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	Elements   []string `yaml:"elements,omitempty"`
+	Attributes []string `yaml:"attributes,omitempty"`
+}
+
+// ThrottleConfig adds phrases and CSS selectors identifying rate limiting
+// pages to the built-in ones.
+type ThrottleConfig struct {
+	Detect    bool     `yaml:"detect"`
+	Phrases   []string `yaml:"phrases,omitempty"`
+	Selectors []string `yaml:"selectors,omitempty"`
+	Retries   int      `yaml:"retries"`
+}
+
+// LinkScoreConfig controls the PageRank computed after the crawl.
+type LinkScoreConfig struct {
+	Iterations int `yaml:"iterations"`
+	MaxPages   int `yaml:"max_pages"`
+}
+
+// RetainConfig bounds the pages kept in memory before older ones are
+// spilled to a temporary file.
+type RetainConfig struct {
+	Pages int   `yaml:"pages"`
+	Bytes int64 `yaml:"bytes"`
+}
+
+// PruningConfig enables adaptive pruning: a pattern is pruned when fewer
+// than MinYield of the last Window pages matching it were productive.
+type PruningConfig struct {
+	Enabled  bool    `yaml:"enabled"`
+	Window   int     `yaml:"window"`
+	MinYield float64 `yaml:"min_yield"`
+}
+
+// CircuitConfig enables the circuit breaker, with its settings inline.
+type CircuitConfig struct {
+	Enabled                bool `yaml:"enabled"`
+	crawler.CircuitBreaker `yaml:",inline"`
+}
+
+// BodyProgressConfig is the slowest rate a page body may arrive at.
+type BodyProgressConfig struct {
+	Bytes  int64         `yaml:"bytes"`
+	Window time.Duration `yaml:"window"`
+}
+
+// DangerousConfig controls the URLs that look like actions, which are not
+// requested unless Allow is set. Patterns replaces the built-in ones.
+type DangerousConfig struct {
+	Allow    bool     `yaml:"allow"`
+	Patterns []string `yaml:"patterns,omitempty"`
+}
+
+type AssetCheckConfig struct {
+	Enabled bool    `yaml:"enabled"`
+	Max     int     `yaml:"max"`
+	RPS     float64 `yaml:"rps"`
+}
+
+// UACompareConfig samples pages fetched again with a mobile User-Agent
+// after the crawl. An empty UserAgent is crawler.DefaultMobileUserAgent.
+type UACompareConfig struct {
+	Enabled   bool    `yaml:"enabled"`
+	Fraction  float64 `yaml:"fraction"`
+	Max       int     `yaml:"max"`
+	UserAgent string  `yaml:"user_agent,omitempty"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Depth:          3,
+		MaxAddedParams: crawler.DefaultMaxAddedParams,
+		RPS:            2.0,
+		Timeout:        crawler.DefaultTimeout,
+		MaxBodySize:    crawler.DefaultMaxBodySize,
+		HTMLMaxTags:    crawler.DefaultMaxTags,
+		HTMLMaxNesting: crawler.DefaultMaxNesting,
+		Format:         crawler.FormatJSON,
+		JSLinks:        JSLinksConfig{Max: crawler.DefaultJSLinksPerPage},
+		CheckAssets:    AssetCheckConfig{Max: crawler.DefaultAssetCheckLimit, RPS: crawler.DefaultAssetRPS},
+		UACompare:      UACompareConfig{Fraction: crawler.DefaultUACompareFraction, Max: crawler.DefaultUACompareMax},
+		Throttle:       ThrottleConfig{Detect: true, Retries: crawler.DefaultThrottleRetries},
+		LinkScore:      LinkScoreConfig{Iterations: crawler.DefaultLinkScoreIterations, MaxPages: crawler.DefaultLinkScoreMaxPages},
+		BodyProgress:   BodyProgressConfig{Bytes: crawler.DefaultBodyProgressBytes, Window: crawler.DefaultBodyProgressWindow},
+		Pruning:        PruningConfig{Window: crawler.DefaultPruningWindow, MinYield: crawler.DefaultPruningMinYield},
+		Circuit:        CircuitConfig{Enabled: true, CircuitBreaker: crawler.DefaultCircuitBreaker},
+		Quality:        crawler.DefaultQualityWeights,
+		Retain:         RetainConfig{Pages: crawler.DefaultRetainPages, Bytes: crawler.DefaultRetainBytes},
+		OTelSample:     1,
+	}
+}
+
+// stringList is a repeatable string flag.
+type stringList struct {
+	values *[]string
+}
+
+func (l stringList) String() string {
+	if l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, ",")
+}
+
+func (l stringList) Set(value string) error {
+	*l.values = append(*l.values, value)
+	return nil
+}
+
+// slowPatternList is a repeatable PATTERN=RPS flag.
+type slowPatternList struct {
+	values *[]crawler.SlowPattern
+}
+
+func (l slowPatternList) String() string {
+	if l.values == nil {
+		return ""
+	}
+	parts := make([]string, 0, len(*l.values))
+	for _, p := range *l.values {
+		parts = append(parts, fmt.Sprintf("%s=%g", p.Pattern, p.RPS))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l slowPatternList) Set(value string) error {
+	i := strings.LastIndex(value, "=")
+	if i < 0 {
+		return fmt.Errorf("expected PATTERN=RPS, got %q", value)
+	}
+	rps, err := strconv.ParseFloat(value[i+1:], 64)
+	if err != nil {
+		return fmt.Errorf("invalid rps in %q: %v", value, err)
+	}
+	*l.values = append(*l.values, crawler.SlowPattern{Pattern: value[:i], RPS: rps})
+	return nil
+}
+
+// rpsFlag is a requests per second flag that also accepts "unlimited",
+// stored as crawler.UnlimitedRPS.
+type rpsFlag struct {
+	value *float64
+}
+
+func (f rpsFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f.value, 'g', -1, 64)
+}
+
+func (f rpsFlag) Set(value string) error {
+	if value == "unlimited" {
+		*f.value = crawler.UnlimitedRPS
+		return nil
+	}
+	rps, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("expected a number or unlimited, got %q", value)
+	}
+	*f.value = rps
+	return nil
+}
+
+// bindFlags registers the crawl flags on fs, storing values into cfg.
+func (cfg *Config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.URL, "url", cfg.URL, "base URL to crawl (prompted for when empty)")
+	fs.IntVar(&cfg.Depth, "depth", cfg.Depth, "maximum crawl depth, -1 for unlimited (requires a -max-* budget)")
+	fs.IntVar(&cfg.MaxPathDepth, "max-path-depth", cfg.MaxPathDepth, "skip URLs whose path has more segments than this, however they are linked (0 = unlimited)")
+	fs.IntVar(&cfg.MaxPages, "max-pages", cfg.MaxPages, "stop after this many requests (0 = unlimited)")
+	fs.DurationVar(&cfg.MaxDuration, "max-duration", cfg.MaxDuration, "stop sending requests after this long, e.g. 30m (0 = unlimited)")
+	fs.Int64Var(&cfg.MaxBytes, "max-bytes", cfg.MaxBytes, "stop after reading this many response body bytes (0 = unlimited)")
+	fs.IntVar(&cfg.MaxAddedParams, "max-added-params", cfg.MaxAddedParams, "skip links that add more than this many query parameters to a URL already seen on the same path (0 = unlimited)")
+	fs.IntVar(&cfg.MaxVisited, "max-visited", cfg.MaxVisited, "stop discovering URLs once the visited set holds this many, to bound memory (0 = unlimited)")
+	fs.Var(rpsFlag{&cfg.RPS}, "rps", "maximum requests per second (0 or unlimited = no rate limiting)")
+	fs.DurationVar(&cfg.Warmup, "warmup", cfg.Warmup, "probe the site one request at a time for up to this long before choosing the starting rate (0 = 30s)")
+	fs.BoolVar(&cfg.NoWarmup, "no-warmup", cfg.NoWarmup, "start at -rps right away instead of probing the site first")
+	fs.StringVar(&cfg.Contact, "contact", cfg.Contact, "operator contact sent in From and User-Agent, e.g. mailto:ops@example.com")
+	fs.StringVar(&cfg.AcceptLanguage, "accept-language", cfg.AcceptLanguage, "Accept-Language header sent with every request, e.g. \"de-DE,de;q=0.9\"")
+	fs.Var(stringList{&cfg.Languages}, "language", "crawl the site once per Accept-Language value, storing pages per language (repeatable)")
+	fs.StringVar(&cfg.Sitemap, "sitemap", cfg.Sitemap, "also crawl the URLs listed in this sitemap, a URL or a path such as /sitemap.xml")
+	fs.BoolVar(&cfg.TOC, "toc", cfg.TOC, "record the headings, fragment targets and fragment links of every page for the toc report")
+	fs.BoolVar(&cfg.Robots, "robots", cfg.Robots, "obey robots.txt, skipping disallowed URLs and recording the rule that decided every URL")
+	fs.BoolVar(&cfg.SiteHygiene, "site-hygiene", cfg.SiteHygiene, "check robots.txt and the sitemaps for unknown directives, invalid entries and size limits, without applying robots.txt")
+	fs.BoolVar(&cfg.PerfSignals, "perf-signals", cfg.PerfSignals, "record the blocking scripts, stylesheets and inline blocks of every page's head for the perf report")
+	fs.BoolVar(&cfg.LegacyMarkup.Enabled, "legacy-markup", cfg.LegacyMarkup.Enabled, "count the obsolete elements, inline styles and presentational attributes of every page for the legacy report")
+	fs.Var(stringList{&cfg.LegacyMarkup.Elements}, "legacy-element", "element counted by -legacy-markup, replacing the built-in list (repeatable)")
+	fs.Var(stringList{&cfg.LegacyMarkup.Attributes}, "legacy-attribute", "attribute counted by -legacy-markup on any element, replacing the built-in list (repeatable)")
+	fs.StringVar(&cfg.OnlyListed, "only-listed", cfg.OnlyListed, "fetch only the URLs in this file, one per line, recording their links without following them")
+	fs.Var(stringList{&cfg.Feeds}, "feed", "also crawl the items of this RSS or Atom feed, a URL or a path such as /feed.xml (repeatable)")
+	fs.BoolVar(&cfg.FollowMetaRefresh, "follow-meta-refresh", cfg.FollowMetaRefresh, "follow <meta http-equiv=\"refresh\"> to same-domain URLs like a redirect")
+	fs.BoolVar(&cfg.LowercasePaths, "lowercase-paths", cfg.LowercasePaths, "lowercase the path of every URL, for servers such as IIS that ignore its case")
+	fs.Var(stringList{&cfg.KnownHosts}, "known-host", "host that canonical, hreflang and sitemap URLs may point at, such as a CDN (repeatable)")
+	fs.StringVar(&cfg.ModifiedSince, "modified-since", cfg.ModifiedSince, "send If-Modified-Since with this date (YYYY-MM-DD) and record which pages changed")
+	fs.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "time limit for a single request (0 = unlimited)")
+	fs.Int64Var(&cfg.MaxBodySize, "max-body-size", cfg.MaxBodySize, "largest HTML body read in bytes; larger pages fail as too-large (0 = unlimited)")
+	fs.Int64Var(&cfg.BodyProgress.Bytes, "body-progress-bytes", cfg.BodyProgress.Bytes, "abandon page bodies that send fewer bytes than this per -body-progress-window (0 = never)")
+	fs.DurationVar(&cfg.BodyProgress.Window, "body-progress-window", cfg.BodyProgress.Window, "window of -body-progress-bytes")
+	fs.BoolVar(&cfg.Pruning.Enabled, "adaptive-pruning", cfg.Pruning.Enabled, "stop expanding URL patterns, such as endless pagination, whose pages stopped finding new links or content")
+	fs.IntVar(&cfg.Pruning.Window, "pruning-window", cfg.Pruning.Window, "pages of a URL pattern -adaptive-pruning judges its yield over")
+	fs.Float64Var(&cfg.Pruning.MinYield, "pruning-min-yield", cfg.Pruning.MinYield, "share of productive pages below which -adaptive-pruning prunes a URL pattern")
+	fs.IntVar(&cfg.HTMLMaxTags, "html-max-tags", cfg.HTMLMaxTags, "treat pages with more tags than this as malformed and only extract their links (0 = unlimited)")
+	fs.IntVar(&cfg.HTMLMaxNesting, "html-max-nesting", cfg.HTMLMaxNesting, "treat pages nested deeper than this as malformed and only extract their links (0 = unlimited)")
+	fs.Var(stringList{&cfg.Include}, "include", "only crawl links whose URL matches this regular expression (repeatable)")
+	fs.Var(stringList{&cfg.Exclude}, "exclude", "do not crawl links whose URL matches this regular expression (repeatable)")
+	fs.BoolVar(&cfg.Dangerous.Allow, "allow-dangerous", cfg.Dangerous.Allow, "crawl URLs that look like actions, such as logout and add-to-cart links")
+	fs.Var(stringList{&cfg.Dangerous.Patterns}, "dangerous-pattern", "skip URLs matching this regular expression as dangerous, replacing the built-in patterns (repeatable)")
+	fs.Var(slowPatternList{&cfg.SlowPatterns}, "slow", "throttle URLs matching a regular expression, as PATTERN=RPS (repeatable)")
+	fs.BoolVar(&cfg.Debug, "debug", cfg.Debug, "print debug log lines, such as slow pattern delays")
+	fs.StringVar(&cfg.OTelEndpoint, "otel-endpoint", cfg.OTelEndpoint, "export OpenTelemetry traces to this OTLP collector, grpc://host:port or http(s)://host:port")
+	fs.Float64Var(&cfg.OTelSample, "otel-sample", cfg.OTelSample, "fraction of pages traced, between 0 and 1")
+	fs.StringVar(&cfg.Resume, "resume", cfg.Resume, "continue the crawl saved in this JSON results file, skipping its pages")
+	fs.BoolVar(&cfg.Force, "force", cfg.Force, "resume even if depth, filters or other scope settings changed")
+	fs.StringVar(&cfg.Record, "record", cfg.Record, "save every request/response pair into this directory as test fixtures")
+	fs.StringVar(&cfg.Playback, "playback", cfg.Playback, "serve all requests from recordings in this directory, failing on misses")
+	fs.StringVar(&cfg.FetchCmd, "fetch-cmd", cfg.FetchCmd, "fetch every URL by running this command, such as 'curl --silent --include {url}', which prints the response")
+	fs.StringVar(&cfg.Shard, "shard", cfg.Shard, "only fetch the URLs of shard INDEX/COUNT, e.g. 2/8, by URL hash; combine the shards with the merge subcommand")
+	fs.StringVar(&cfg.HandoffDir, "handoff", cfg.HandoffDir, "directory where shards exchange the URLs they discover for each other")
+	fs.BoolVar(&cfg.Deterministic, "deterministic", cfg.Deterministic, "fetch one URL at a time, level by level in URL order, so repeated crawls give identical results")
+	fs.Uint64Var(&cfg.Seed, "seed", cfg.Seed, "seed for the random choices of a -deterministic crawl")
+	fs.StringVar(&cfg.Format, "format", cfg.Format, "output format: json, csv, xlsx or parquet")
+	fs.StringVar(&cfg.Out, "out", cfg.Out, "results file, e.g. reports/{host}/{date}.json; missing directories are created (default crawl_results.<format>)")
+	fs.BoolVar(&cfg.SplitByHost, "split-by-host", cfg.SplitByHost, "save one results file per host redirects led to, in JSON, CSV or Parquet; -out must contain {host} (default crawl_results_<host>.<format>)")
+	fs.IntVar(&cfg.ParquetRowGroup, "parquet-row-group", cfg.ParquetRowGroup, "pages per row group of -format parquet (0 = 10000)")
+	fs.DurationVar(&cfg.Progress, "progress", cfg.Progress, "print crawl counters at this interval, e.g. 10s (0 = off)")
+	fs.StringVar(&cfg.Edges, "edges", cfg.Edges, "stream every link edge to this file, CSV or JSON lines (.jsonl)")
+	fs.BoolVar(&cfg.CheckAssets.Enabled, "check-assets", cfg.CheckAssets.Enabled, "verify same-domain CSS, JS, images and media after the crawl; exit with status 2 if any are broken")
+	fs.BoolVar(&cfg.FailOnValidations, "fail-on-validations", cfg.FailOnValidations, "exit with status 2 if a page fails a rule of the validations config section")
+	fs.StringVar(&cfg.FailOnNewThirdParty, "fail-on-new-third-party", cfg.FailOnNewThirdParty, "exit with status 2 if a page loads from or links to a third-party origin not in this baseline file")
+	fs.StringVar(&cfg.CompareFingerprint, "compare-fingerprint", cfg.CompareFingerprint, "exit with status 2 if the fingerprint of the crawl differs from that of these earlier results")
+	fs.BoolVar(&cfg.Strict, "strict", cfg.Strict, "exit with status 2 if the results break an invariant of the crawler, such as a page stored twice")
+	fs.StringVar(&cfg.SaveThirdPartyBaseline, "save-third-party-baseline", cfg.SaveThirdPartyBaseline, "save the third-party origins of the crawl to this baseline file")
+	fs.IntVar(&cfg.CheckAssets.Max, "check-assets-max", cfg.CheckAssets.Max, "maximum number of assets checked; larger inventories are sampled")
+	fs.Float64Var(&cfg.CheckAssets.RPS, "assets-rps", cfg.CheckAssets.RPS, "requests per second for asset checks")
+	fs.BoolVar(&cfg.UACompare.Enabled, "ua-compare", cfg.UACompare.Enabled, "fetch a sample of the pages again with a mobile User-Agent after the crawl and report those answering differently")
+	fs.Float64Var(&cfg.UACompare.Fraction, "ua-compare-fraction", cfg.UACompare.Fraction, "share of the pages -ua-compare fetches again (0 = all)")
+	fs.IntVar(&cfg.UACompare.Max, "ua-compare-max", cfg.UACompare.Max, "maximum number of pages -ua-compare fetches again (0 = no limit)")
+	fs.StringVar(&cfg.UACompare.UserAgent, "ua-compare-agent", cfg.UACompare.UserAgent, "mobile User-Agent of -ua-compare, followed by the crawler's own")
+	fs.BoolVar(&cfg.Throttle.Detect, "throttle-detect", cfg.Throttle.Detect, "treat status 200 pages that look like rate limiting interstitials like a 429")
+	fs.Var(stringList{&cfg.Throttle.Phrases}, "throttle-phrase", "extra text identifying a rate limiting page (repeatable)")
+	fs.Var(stringList{&cfg.Throttle.Selectors}, "throttle-selector", "extra CSS selector identifying a rate limiting page (repeatable)")
+	fs.IntVar(&cfg.Throttle.Retries, "throttle-retries", cfg.Throttle.Retries, "times a throttled URL is retried after slowing down")
+	fs.BoolVar(&cfg.Circuit.Enabled, "circuit-breaker", cfg.Circuit.Enabled, "pause the requests to a host when most of its recent requests fail, and give up on it when the pauses do not help")
+	fs.IntVar(&cfg.Circuit.Window, "circuit-window", cfg.Circuit.Window, "recent requests whose failure rate the circuit breaker watches")
+	fs.Float64Var(&cfg.Circuit.Threshold, "circuit-threshold", cfg.Circuit.Threshold, "share of failed requests that opens the circuit")
+	fs.DurationVar(&cfg.Circuit.Backoff, "circuit-backoff", cfg.Circuit.Backoff, "first pause of an open circuit, doubled for every further pause in a row")
+	fs.IntVar(&cfg.Circuit.MaxOpens, "circuit-max-opens", cfg.Circuit.MaxOpens, "pauses in a row after which the circuit breaker gives up on the host")
+	fs.BoolVar(&cfg.NoHints, "no-hints", cfg.NoHints, "do not print the findings and suggested settings after the crawl")
+	fs.StringVar(&cfg.Manifest, "manifest", cfg.Manifest, "write the manifest listing the outputs with their sizes and checksums to this file (default manifest.json next to the results file)")
+	fs.BoolVar(&cfg.NoManifest, "no-manifest", cfg.NoManifest, "do not write the manifest")
+	fs.BoolVar(&cfg.PrintManifest, "print-manifest", cfg.PrintManifest, "print the path of the manifest as the last line of the output")
+	fs.BoolVar(&cfg.NoFinalRetry, "no-final-retry", cfg.NoFinalRetry, "do not fetch URLs that failed with timeouts, connection errors or 429/5xx statuses once more at the end of the crawl")
+	fs.IntVar(&cfg.LinkScore.Iterations, "link-score-iterations", cfg.LinkScore.Iterations, "PageRank iterations over internal links after the crawl (0 = no link scores)")
+	fs.IntVar(&cfg.LinkScore.MaxPages, "link-score-max-pages", cfg.LinkScore.MaxPages, "skip link scores on crawls with more pages than this (0 = no limit)")
+	fs.IntVar(&cfg.Retain.Pages, "retain-pages", cfg.Retain.Pages, "pages kept in memory before older ones are spilled to a temporary file (0 = no limit)")
+	fs.Int64Var(&cfg.Retain.Bytes, "retain-bytes", cfg.Retain.Bytes, "estimated bytes of pages kept in memory before older ones are spilled (0 = no limit)")
+	fs.BoolVar(&cfg.JSLinks.Enabled, "js-links", cfg.JSLinks.Enabled, "record same-domain paths found in onclick handlers and inline scripts")
+	fs.BoolVar(&cfg.JSLinks.Follow, "js-links-follow", cfg.JSLinks.Follow, "also crawl links found by -js-links")
+	fs.IntVar(&cfg.JSLinks.Max, "js-links-max", cfg.JSLinks.Max, "maximum JavaScript-discovered links recorded per page")
+}
+
+// parseConfig builds the configuration from args: defaults, then the file
+// named by -config, then the flags given explicitly. Subcommand-specific
+// flags may be registered on fs beforehand.
+func parseConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := defaultConfig()
+	configPath := fs.String("config", "", "read settings from this YAML file; flags override it")
+	cfg.bindFlags(fs)
+	fs.Parse(args)
+
+	if *configPath != "" {
+		if err := cfg.load(*configPath); err != nil {
+			return nil, err
+		}
+		// Parse again so explicitly given flags win over the file.
+		fs.Parse(args)
+	}
+	return &cfg, nil
+}
+
+// load reads a YAML configuration file over the current values. Unknown
+// keys are errors so typos are not silently ignored.
+func (cfg *Config) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening config: %v", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error parsing config %s: %v", path, err)
+	}
+	return nil
+}
+
+// crawlOptions checks cfg the way the validate subcommand does and converts
+// it into crawler options, so a crawl never starts with a setting that
+// check rejects.
+func (cfg *Config) crawlOptions() ([]crawler.Option, error) {
+	if issues := cfg.check(); len(issues.Errors) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %s", strings.Join(issues.Errors, "; "))
+	}
+	return cfg.options()
+}
+
+// options converts the configuration into crawler options. It reports the
+// settings it cannot parse; the other rules are those of check.
+func (cfg *Config) options() ([]crawler.Option, error) {
+	opts := []crawler.Option{
+		crawler.WithContact(cfg.Contact),
+		crawler.WithAcceptLanguage(cfg.AcceptLanguage),
+		crawler.WithLanguages(cfg.Languages),
+		crawler.WithOutputFormat(cfg.Format),
+		crawler.WithOutputPath(cfg.Out),
+		crawler.WithParquetRowGroup(cfg.ParquetRowGroup),
+		crawler.WithMaxPages(cfg.MaxPages),
+		crawler.WithMaxDuration(cfg.MaxDuration),
+		crawler.WithMaxBytes(cfg.MaxBytes),
+		crawler.WithMaxVisited(cfg.MaxVisited),
+		crawler.WithMaxBodySize(cfg.MaxBodySize),
+		crawler.WithBodyProgress(cfg.BodyProgress.Bytes, cfg.BodyProgress.Window),
+		crawler.WithHTMLLimits(cfg.HTMLMaxTags, cfg.HTMLMaxNesting),
+		crawler.WithTimeout(cfg.Timeout),
+		crawler.WithURLFilters(cfg.Include, cfg.Exclude),
+		crawler.WithDangerousPatterns(cfg.Dangerous.Patterns),
+		crawler.WithProgress(cfg.Progress),
+		crawler.WithSlowPatterns(cfg.SlowPatterns),
+		crawler.WithDebug(cfg.Debug),
+		crawler.WithThrottleDetection(cfg.Throttle.Detect, cfg.Throttle.Phrases, cfg.Throttle.Selectors),
+		crawler.WithThrottleRetries(cfg.Throttle.Retries),
+		crawler.WithCircuitBreaker(cfg.Circuit.Enabled, cfg.Circuit.CircuitBreaker),
+		crawler.WithFinalRetry(!cfg.NoFinalRetry),
+		crawler.WithLinkScores(cfg.LinkScore.Iterations, cfg.LinkScore.MaxPages),
+		crawler.WithQualityWeights(cfg.Quality),
+		crawler.WithResultLimit(cfg.Retain.Pages, cfg.Retain.Bytes),
+		crawler.WithKnownHosts(cfg.KnownHosts),
+		crawler.WithMetaRefresh(cfg.FollowMetaRefresh),
+		crawler.WithMaxPathDepth(cfg.MaxPathDepth),
+		crawler.WithMaxAddedParams(cfg.MaxAddedParams),
+		crawler.WithStrict(cfg.Strict),
+	}
+	if len(cfg.Classify) > 0 {
+		opts = append(opts, crawler.WithClassifyRules(cfg.Classify))
+	}
+	if len(cfg.Validations) > 0 {
+		opts = append(opts, crawler.WithValidations(cfg.Validations))
+	}
+	if len(cfg.Hosts) > 0 {
+		opts = append(opts, crawler.WithHosts(cfg.Hosts))
+	}
+	if cfg.Pruning.Enabled {
+		opts = append(opts, crawler.WithAdaptivePruning(cfg.Pruning.Window, cfg.Pruning.MinYield))
+	}
+	if cfg.Sitemap != "" {
+		opts = append(opts, crawler.WithSitemap(cfg.Sitemap))
+	}
+	if len(cfg.Feeds) > 0 {
+		opts = append(opts, crawler.WithFeeds(cfg.Feeds))
+	}
+	if cfg.ModifiedSince != "" {
+		since, err := crawler.ParseModifiedSince(cfg.ModifiedSince)
+		if err != nil {
+			return nil, fmt.Errorf("modified_since: %v", err)
+		}
+		opts = append(opts, crawler.WithModifiedSince(since))
+	}
+	if cfg.JSLinks.Enabled {
+		opts = append(opts, crawler.WithJSLinks(cfg.JSLinks.Follow, cfg.JSLinks.Max))
+	}
+	if cfg.Edges != "" {
+		opts = append(opts, crawler.WithEdgeOutput(cfg.Edges))
+	}
+	if cfg.Record != "" {
+		opts = append(opts, crawler.WithRecording(cfg.Record))
+	}
+	if cfg.Playback != "" {
+		opts = append(opts, crawler.WithPlayback(cfg.Playback))
+	}
+	if cfg.FetchCmd != "" {
+		args, err := crawler.ParseFetchCommand(cfg.FetchCmd)
+		if err != nil {
+			return nil, fmt.Errorf("fetch_cmd: %v", err)
+		}
+		opts = append(opts, crawler.WithFetchCommand(args))
+	}
+	if cfg.TOC {
+		opts = append(opts, crawler.WithTOC())
+	}
+	if cfg.PerfSignals {
+		opts = append(opts, crawler.WithPerfSignals())
+	}
+	if cfg.LegacyMarkup.Enabled {
+		opts = append(opts, crawler.WithLegacyMarkup(cfg.LegacyMarkup.Elements, cfg.LegacyMarkup.Attributes))
+	}
+	if cfg.SiteHygiene {
+		opts = append(opts, crawler.WithSiteHygiene())
+	}
+	if cfg.Robots {
+		opts = append(opts, crawler.WithRobots())
+	}
+	if cfg.LowercasePaths {
+		opts = append(opts, crawler.WithLowercasePaths())
+	}
+	if cfg.Deterministic {
+		opts = append(opts, crawler.WithDeterministic(cfg.Seed))
+	}
+	if !cfg.NoWarmup {
+		opts = append(opts, crawler.WithWarmup(cfg.Warmup, 0))
+	}
+	if cfg.Shard != "" {
+		index, count, err := crawler.ParseShard(cfg.Shard)
+		if err != nil {
+			return nil, fmt.Errorf("shard: %v", err)
+		}
+		opts = append(opts, crawler.WithShard(index, count, cfg.HandoffDir))
+	}
+	if cfg.SplitByHost {
+		opts = append(opts, crawler.WithSplitByHost())
+	}
+	if cfg.Dangerous.Allow {
+		opts = append(opts, crawler.WithAllowDangerous())
+	}
+	if cfg.UACompare.Enabled {
+		opts = append(opts, crawler.WithUACompare(cfg.UACompare.Fraction, cfg.UACompare.Max, cfg.UACompare.UserAgent))
+	}
+	if cfg.CheckAssets.Enabled {
+		opts = append(opts, crawler.WithAssetCheck(cfg.CheckAssets.Max, cfg.CheckAssets.RPS))
+	}
+	return opts, nil
+}
+
+// configIssues separates problems that prevent a crawl from ones that
+// merely look suspicious.
+type configIssues struct {
+	Errors   []string
+	Warnings []string
+}
+
+func (ci *configIssues) errorf(format string, args ...any) {
+	ci.Errors = append(ci.Errors, fmt.Sprintf(format, args...))
+}
+
+func (ci *configIssues) warnf(format string, args ...any) {
+	ci.Warnings = append(ci.Warnings, fmt.Sprintf(format, args...))
+}
+
+// check validates the configuration without any network access.
+func (cfg *Config) check() configIssues {
+	var issues configIssues
+
+	var seed string
+	if cfg.URL == "" {
+		issues.errorf("url: no base URL configured")
+	} else if u, schemeMissing, err := crawler.ParseBaseURL(cfg.URL); err != nil {
+		issues.errorf("url: %v", err)
+	} else {
+		seed = crawler.NormalizeURL(u)
+		if schemeMissing {
+			issues.warnf("url: no scheme given; https will be tried first, then http")
+		}
+	}
+
+	if err := crawler.ValidateLimits(cfg.Depth, cfg.MaxPages, cfg.MaxDuration, cfg.MaxBytes); err != nil {
+		issues.errorf("depth: %v", err)
+	}
+	if cfg.MaxPathDepth < 0 {
+		issues.errorf("max_path_depth: must not be negative")
+	}
+	if cfg.MaxAddedParams < 0 {
+		issues.errorf("max_added_params: must not be negative")
+	}
+	if cfg.MaxVisited < 0 {
+		issues.errorf("max_visited: must not be negative")
+	}
+	if err := crawler.ValidRPS(cfg.RPS); err != nil {
+		issues.errorf("rps: %v", err)
+	} else {
+		for _, warning := range crawler.BudgetWarnings(cfg.MaxPages, cfg.MaxDuration, cfg.RPS) {
+			issues.warnf("max_pages: %s", warning)
+		}
+	}
+	if cfg.Timeout < 0 || cfg.MaxBodySize < 0 {
+		issues.errorf("timeout and max_body_size must not be negative")
+	}
+	if cfg.BodyProgress.Bytes < 0 || cfg.BodyProgress.Window < 0 {
+		issues.errorf("body_progress.bytes and body_progress.window must not be negative")
+	}
+	if cfg.HTMLMaxTags < 0 || cfg.HTMLMaxNesting < 0 {
+		issues.errorf("html_max_tags and html_max_nesting must not be negative")
+	}
+	if cfg.Contact != "" {
+		if _, err := crawler.ContactFromHeader(cfg.Contact); err != nil {
+			issues.errorf("contact: %v", err)
+		}
+	} else if crawler.ContactRequired() {
+		issues.errorf("contact: required because %s is set", crawler.RequireContactEnv)
+	}
+	if !crawler.ValidOutputFormat(cfg.Format) {
+		issues.errorf("format: unsupported output format %q", cfg.Format)
+	}
+	if err := crawler.ValidateOutputPath(cfg.Out); err != nil {
+		issues.errorf("out: %v", err)
+	}
+	if cfg.SplitByHost {
+		if err := crawler.ValidateSplitByHost(cfg.Format, cfg.Out); err != nil {
+			issues.errorf("split_by_host: %v", err)
+		}
+		if cfg.Resume != "" || cfg.Shard != "" {
+			issues.errorf("split_by_host cannot be combined with resume or shard, which read and merge a single results file")
+		}
+	}
+	if cfg.ParquetRowGroup < 0 {
+		issues.errorf("parquet_row_group must not be negative")
+	} else if cfg.ParquetRowGroup > 0 && cfg.Format != crawler.FormatParquet {
+		issues.warnf("parquet_row_group has no effect without format parquet")
+	}
+	if cfg.NoManifest && (cfg.Manifest != "" || cfg.PrintManifest) {
+		issues.warnf("manifest and print_manifest have no effect with no_manifest")
+	}
+	if err := crawler.ValidateLegacyNames(slices.Concat(cfg.LegacyMarkup.Elements, cfg.LegacyMarkup.Attributes)); err != nil {
+		issues.errorf("legacy_markup: %v", err)
+	} else if !cfg.LegacyMarkup.Enabled && (len(cfg.LegacyMarkup.Elements) > 0 || len(cfg.LegacyMarkup.Attributes) > 0) {
+		issues.warnf("legacy_markup elements and attributes have no effect without legacy_markup enabled")
+	}
+	if cfg.UACompare.Fraction < 0 || cfg.UACompare.Fraction > 1 {
+		issues.errorf("ua_compare fraction must be between 0 and 1")
+	}
+	if cfg.UACompare.Max < 0 {
+		issues.errorf("ua_compare max must not be negative")
+	}
+	if cfg.Record != "" && cfg.Playback != "" {
+		issues.errorf("record and playback cannot be combined")
+	}
+	if cfg.FetchCmd != "" {
+		if _, err := crawler.ParseFetchCommand(cfg.FetchCmd); err != nil {
+			issues.errorf("fetch_cmd: %v", err)
+		} else if cfg.Playback != "" {
+			issues.errorf("fetch_cmd and playback cannot be combined")
+		}
+	}
+	if cfg.Shard != "" {
+		if _, _, err := crawler.ParseShard(cfg.Shard); err != nil {
+			issues.errorf("shard: %v", err)
+		}
+		if cfg.OnlyListed != "" || cfg.CheckAssets.Enabled {
+			issues.errorf("shard cannot be combined with only_listed or check_assets, whose results are not merged")
+		}
+		if cfg.Format != crawler.FormatJSON {
+			issues.warnf("shard: only JSON results can be merged, not %s", cfg.Format)
+		}
+		if cfg.HandoffDir == "" {
+			issues.warnf("shard: without handoff_dir, URLs found for other shards are not passed on and only pages linked within the shard are crawled")
+		}
+	} else if cfg.HandoffDir != "" {
+		issues.warnf("handoff_dir has no effect without shard")
+	}
+	if cfg.Deterministic {
+		if cfg.MaxDuration > 0 {
+			issues.errorf("deterministic cannot be combined with max_duration, which depends on how fast the site responds; use max_pages or max_bytes")
+		}
+	} else if cfg.Seed != 0 {
+		issues.warnf("seed has no effect without deterministic")
+	}
+	if cfg.Warmup < 0 {
+		issues.errorf("warmup must not be negative")
+	} else if cfg.Warmup > 0 && (cfg.NoWarmup || cfg.Deterministic || cfg.Playback != "") {
+		issues.warnf("warmup has no effect with no_warmup, deterministic or playback")
+	}
+	if cfg.AcceptLanguage != "" && len(cfg.Languages) > 0 {
+		issues.errorf("accept_language and languages cannot be combined; list every language under languages")
+	}
+	if cfg.ModifiedSince != "" {
+		if since, err := crawler.ParseModifiedSince(cfg.ModifiedSince); err != nil {
+			issues.errorf("modified_since: %v", err)
+		} else if since.After(time.Now()) {
+			issues.warnf("modified_since: %s is in the future; every page will be reported unchanged", cfg.ModifiedSince)
+		}
+		if cfg.Sitemap == "" {
+			issues.warnf("modified_since: unchanged pages are not parsed for links; add sitemap for coverage independent of links")
+		}
+	}
+	if cfg.OnlyListed != "" {
+		if _, err := os.Stat(cfg.OnlyListed); err != nil {
+			issues.errorf("only_listed: %v", err)
+		}
+		if cfg.Sitemap != "" || len(cfg.Feeds) > 0 || cfg.CheckAssets.Enabled {
+			issues.errorf("only_listed cannot be combined with sitemap, feeds or check_assets, which request other URLs")
+		}
+	}
+	if cfg.Resume != "" {
+		if _, err := os.Stat(cfg.Resume); err != nil {
+			issues.errorf("resume: %v", err)
+		}
+		if cfg.Format != crawler.FormatJSON {
+			issues.warnf("resume: results saved as %s cannot be resumed again", cfg.Format)
+		}
+	} else if cfg.Force {
+		issues.warnf("force has no effect without resume")
+	}
+	if cfg.JSLinks.Follow && !cfg.JSLinks.Enabled {
+		issues.warnf("js_links.follow has no effect unless js_links.enabled is set")
+	}
+
+	for _, p := range cfg.SlowPatterns {
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			issues.errorf("slow_patterns: invalid pattern %q: %v", p.Pattern, err)
+		} else if !(p.RPS > 0) {
+			issues.errorf("slow_patterns: pattern %q: rps must be greater than 0", p.Pattern)
+		}
+	}
+
+	if err := crawler.ValidThrottleSelectors(cfg.Throttle.Selectors); err != nil {
+		issues.errorf("throttle: %v", err)
+	}
+	if cfg.OTelSample < 0 || cfg.OTelSample > 1 {
+		issues.errorf("otel_sample must be between 0 and 1")
+	}
+	if cfg.OTelEndpoint != "" {
+		if u, err := url.Parse(cfg.OTelEndpoint); err != nil || (u.Scheme != "grpc" && u.Scheme != "http" && u.Scheme != "https") {
+			issues.errorf("otel_endpoint: expected grpc://host:port or an http(s) URL, got %q", cfg.OTelEndpoint)
+		}
+	}
+	if cfg.Throttle.Retries < 0 {
+		issues.errorf("throttle.retries must not be negative")
+	}
+	if cfg.LinkScore.Iterations < 0 || cfg.LinkScore.MaxPages < 0 {
+		issues.errorf("link_score.iterations and link_score.max_pages must not be negative")
+	}
+	if cfg.Retain.Pages < 0 || cfg.Retain.Bytes < 0 {
+		issues.errorf("retain.pages and retain.bytes must not be negative")
+	}
+	if q := cfg.Quality; min(q.MissingTitle, q.DuplicateTitle, q.MissingDescription, q.DuplicateContent, q.NearDuplicateContent,
+		q.ThinContent, q.Slow, q.Large, q.Noindex, q.DuplicatePages, q.NearDuplicateBits, q.ThinWords) < 0 || q.SlowMs < 0 || q.LargeBytes < 0 {
+		issues.errorf("quality weights and thresholds must not be negative")
+	}
+	if cfg.Quality.NearDuplicateBits > crawler.MaxNearDuplicateBits {
+		issues.errorf("quality.near_duplicate_bits must be at most %d", crawler.MaxNearDuplicateBits)
+	}
+	if p := cfg.Pruning; p.Enabled && (p.Window < 1 || p.MinYield < 0 || p.MinYield > 1) {
+		issues.errorf("adaptive_pruning: window must be at least 1 and min_yield between 0 and 1")
+	}
+	if cfg.Circuit.Enabled {
+		if err := crawler.ValidCircuitBreaker(cfg.Circuit.CircuitBreaker); err != nil {
+			issues.errorf("circuit_breaker: %v", err)
+		}
+	}
+	if err := crawler.ValidClassifyRules(cfg.Classify); err != nil {
+		issues.errorf("classify: %v", err)
+	}
+	if err := crawler.ValidHosts(cfg.Hosts); err != nil {
+		issues.errorf("hosts: %v", err)
+	}
+	if err := crawler.ValidValidationRules(cfg.Validations); err != nil {
+		issues.errorf("validations: %v", err)
+	}
+	if cfg.FailOnValidations && len(cfg.Validations) == 0 {
+		issues.warnf("fail_on_validations has no effect without validations")
+	}
+
+	include, err := crawler.CompilePatterns(cfg.Include)
+	if err != nil {
+		issues.errorf("include: %v", err)
+	}
+	exclude, err := crawler.CompilePatterns(cfg.Exclude)
+	if err != nil {
+		issues.errorf("exclude: %v", err)
+	}
+	if _, err := crawler.CompilePatterns(cfg.Dangerous.Patterns); err != nil {
+		issues.errorf("dangerous.patterns: %v", err)
+	}
+	if cfg.Dangerous.Allow && len(cfg.Dangerous.Patterns) > 0 {
+		issues.warnf("dangerous.patterns has no effect with dangerous.allow")
+	}
+	if seed != "" {
+		for _, re := range exclude {
+			if re.MatchString(seed) {
+				issues.warnf("exclude: pattern %q matches the seed URL %s", re, seed)
+			}
+		}
+		matched := len(include) == 0
+		for _, re := range include {
+			matched = matched || re.MatchString(seed)
+		}
+		if !matched {
+			issues.warnf("include: no pattern matches the seed URL %s", seed)
+		}
+	}
+	return issues
+}
+
+// secretKeyPattern matches configuration keys whose values are masked when
+// the effective configuration is printed.
+var secretKeyPattern = regexp.MustCompile(`(?i)(password|secret|token|authorization|api_key)`)
+
+// maskedYAML renders cfg as YAML with secret values replaced.
+func (cfg *Config) maskedYAML() (string, error) {
+	var node yaml.Node
+	if err := node.Encode(cfg); err != nil {
+		return "", err
+	}
+	maskSecrets(&node)
+	out, err := yaml.Marshal(&node)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func maskSecrets(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Kind == yaml.ScalarNode && value.Value != "" && secretKeyPattern.MatchString(key.Value) {
+				value.Value = "********"
+				value.Tag = "!!str"
+				value.Style = 0
+			}
+		}
+	}
+	for _, child := range node.Content {
+		maskSecrets(child)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+
+	"webcrawler/crawler"
+)
+
+// testConfig parses args like the crawl command does.
+func testConfig(t *testing.T, args ...string) *Config {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg, err := parseConfig(fs, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestCrawlOptions(t *testing.T) {
+	if _, err := testConfig(t, "-url", "https://example.com").crawlOptions(); err != nil {
+		t.Errorf("a valid configuration: %v", err)
+	}
+	if _, err := testConfig(t, "-url", "https://example.com", "-fetch-cmd", "curl --include {url}").crawlOptions(); err != nil {
+		t.Errorf("a valid fetch command: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		edit  func(cfg *Config)
+		error string
+	}{
+		{"unterminated fetch command", []string{"-fetch-cmd", "'unterminated"}, nil, "fetch_cmd: unterminated '"},
+		{"fetch command without url", []string{"-fetch-cmd", "curl"}, nil, "fetch_cmd: "},
+		{"fetch command and playback", []string{"-fetch-cmd", "curl {url}", "-playback", "recorded"}, nil, "fetch_cmd and playback cannot be combined"},
+		{"record and playback", []string{"-record", "a", "-playback", "b"}, nil, "record and playback cannot be combined"},
+		{"split by host and resume", []string{"-split-by-host", "-resume", "previous.json"}, nil, "split_by_host cannot be combined with resume or shard"},
+		{"ua compare fraction", nil, func(cfg *Config) { cfg.UACompare.Enabled, cfg.UACompare.Fraction = true, 2 }, "ua_compare fraction must be between 0 and 1"},
+		{"shard out of range", []string{"-shard", "9/8"}, nil, "shard: shard 9/8: the index must be between 1 and the count"},
+		{"shard without count", []string{"-shard", "2"}, nil, `shard: expected INDEX/COUNT such as 2/8, got "2"`},
+		{"modified since not a date", []string{"-modified-since", "last week"}, nil, `modified_since: invalid date "last week"`},
+		{"modified since in another layout", []string{"-modified-since", "14.10.2026"}, nil, "modified_since: invalid date"},
+		{"slow pattern without rps", nil, func(cfg *Config) { cfg.SlowPatterns = []crawler.SlowPattern{{Pattern: "/search"}} }, `slow_patterns: pattern "/search": rps must be greater than 0`},
+	}
+	for _, tt := range tests {
+		cfg := testConfig(t, append([]string{"-url", "https://example.com"}, tt.args...)...)
+		if tt.edit != nil {
+			tt.edit(cfg)
+		}
+		_, err := cfg.crawlOptions()
+		if err == nil || !strings.Contains(err.Error(), tt.error) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.error)
+		}
+	}
+}
+
+// TestOptionsParseErrors checks that options reports the settings it cannot
+// parse instead of leaving them out of the crawl.
+func TestOptionsParseErrors(t *testing.T) {
+	cfg := testConfig(t, "-url", "https://example.com", "-fetch-cmd", "'unterminated")
+	if opts, err := cfg.options(); err == nil || !strings.Contains(err.Error(), "fetch_cmd") || opts != nil {
+		t.Errorf("options with an invalid fetch command: %d options, %v", len(opts), err)
+	}
+	cfg = testConfig(t, "-url", "https://example.com", "-shard", "0/4")
+	if opts, err := cfg.options(); err == nil || !strings.Contains(err.Error(), "shard") || opts != nil {
+		t.Errorf("options with an invalid shard: %d options, %v", len(opts), err)
+	}
+	cfg = testConfig(t, "-url", "https://example.com", "-modified-since", "2026-13-01")
+	if opts, err := cfg.options(); err == nil || !strings.Contains(err.Error(), "modified_since") || opts != nil {
+		t.Errorf("options with an invalid date: %d options, %v", len(opts), err)
+	}
+}
+
+// TestRetainDefault checks that the command spills pages past the default
+// limits, which the library leaves off.
+func TestRetainDefault(t *testing.T) {
+	cfg := testConfig(t, "-url", "https://example.com")
+	if cfg.Retain.Pages != crawler.DefaultRetainPages || cfg.Retain.Bytes != crawler.DefaultRetainBytes {
+		t.Errorf("retain %+v, want the default limits", cfg.Retain)
+	}
+	if cfg = testConfig(t, "-url", "https://example.com", "-retain-pages", "0"); cfg.Retain.Pages != 0 {
+		t.Errorf("retain %+v, want no page limit", cfg.Retain)
+	}
+}
+
+func TestRPSFlag(t *testing.T) {
+	for value, want := range map[string]float64{"unlimited": crawler.UnlimitedRPS, "0": 0, "2.5": 2.5, "-1": -1} {
+		if cfg := testConfig(t, "-url", "https://example.com", "-rps", value); cfg.RPS != want {
+			t.Errorf("-rps %s gave %v, want %v", value, cfg.RPS, want)
+		}
+	}
+	var rps float64
+	if err := (rpsFlag{&rps}).Set("fast"); err == nil || !strings.Contains(err.Error(), `expected a number or unlimited, got "fast"`) {
+		t.Errorf("-rps fast: %v", err)
+	}
+	if rps = 3; (rpsFlag{&rps}).String() != "3" || (rpsFlag{}).String() != "" {
+		t.Errorf("rpsFlag prints %q", rpsFlag{&rps}.String())
+	}
+
+	// The crawl refuses the rates the flag parses but NewCrawler does not
+	// accept.
+	for value, want := range map[string]string{"-1": "rps: must not be negative", "NaN": "rps: must be a number, not NaN"} {
+		cfg := testConfig(t, "-url", "https://example.com", "-rps", value)
+		if _, err := cfg.crawlOptions(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("-rps %s: %v, want %q", value, err, want)
+		}
+	}
+	for _, value := range []string{"unlimited", "0"} {
+		if _, err := testConfig(t, "-url", "https://example.com", "-rps", value).crawlOptions(); err != nil {
+			t.Errorf("-rps %s: %v", value, err)
+		}
+	}
+}
+
+// TestContactPolicy checks that the command refuses to crawl without a
+// contact when the environment requires one.
+func TestContactPolicy(t *testing.T) {
+	t.Setenv(crawler.RequireContactEnv, "true")
+	if _, err := testConfig(t, "-url", "https://example.com").crawlOptions(); err == nil || !strings.Contains(err.Error(), "contact: required because "+crawler.RequireContactEnv+" is set") {
+		t.Errorf("no contact: %v", err)
+	}
+	if _, err := testConfig(t, "-url", "https://example.com", "-contact", "ops@example.com").crawlOptions(); err != nil {
+		t.Errorf("a contact: %v", err)
+	}
+	if _, err := testConfig(t, "-url", "https://example.com", "-contact", "mailto:ops").crawlOptions(); err == nil || !strings.Contains(err.Error(), `contact: "ops" is not a valid e-mail address`) {
+		t.Errorf("an invalid contact: %v", err)
+	}
+}
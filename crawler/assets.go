@@ -0,0 +1,238 @@
+package crawler
+
+import (
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	DefaultAssetCheckLimit = 1000
+	DefaultAssetRPS        = 5.0
+	assetCheckWorkers      = 4
+
+	// assetGetLimit bounds the body read when a server rejects HEAD and the
+	// asset has to be checked with GET.
+	assetGetLimit = 1024
+)
+
+// Asset types recorded in Asset.Type.
+const (
+	AssetStylesheet = "stylesheet"
+	AssetScript     = "script"
+	AssetImage      = "image"
+	AssetMedia      = "media"
+	AssetFrame      = "iframe"
+)
+
+// Asset is a resource referenced by a page, such as a stylesheet or script.
+type Asset struct {
+	URL  string `json:"url"`
+	Type string `json:"type"`
+}
+
+// AssetCheckResult summarizes the verification of same-domain assets.
+type AssetCheckResult struct {
+	UniqueAssets int           `json:"unique_assets"`
+	Checked      int           `json:"checked"`
+	Sampled      bool          `json:"sampled"`
+	Broken       []BrokenAsset `json:"broken,omitempty"`
+}
+
+// BrokenAsset is an asset that failed to load, with the pages using it.
+type BrokenAsset struct {
+	URL        string   `json:"url"`
+	Type       string   `json:"type"`
+	StatusCode int      `json:"status_code,omitempty"`
+	Error      string   `json:"error"`
+	Pages      []string `json:"pages"`
+}
+
+type assetCheckOptions struct {
+	enabled bool
+	limit   int
+	rps     float64
+}
+
+// WithAssetCheck verifies every unique same-domain asset after the crawl.
+// At most limit assets are requested, at rps requests per second and
+// independently of the page rate limit; larger inventories are sampled.
+func WithAssetCheck(limit int, rps float64) Option {
+	return func(c *Crawler) {
+		if limit <= 0 {
+			limit = DefaultAssetCheckLimit
+		}
+		if rps <= 0 {
+			rps = DefaultAssetRPS
+		}
+		c.assetCheck = assetCheckOptions{enabled: true, limit: limit, rps: rps}
+	}
+}
+
+// assetSelectors maps the elements that reference assets to the attribute
+// holding the URL and the asset type.
+var assetSelectors = []struct {
+	selector, attr, assetType string
+}{
+	{`link[rel~="stylesheet"]`, "href", AssetStylesheet},
+	{"script[src]", "src", AssetScript},
+	{"img[src]", "src", AssetImage},
+	{"video[src], audio[src], source[src]", "src", AssetMedia},
+	{"iframe[src]", "src", AssetFrame},
+}
+
+// extractAssets returns the unique assets referenced by doc, resolved
+// against pageURL. Inline data: and blob: URIs are skipped.
+func extractAssets(doc *goquery.Document, pageURL *url.URL) []Asset {
+	seen := make(map[string]bool)
+	assets := make([]Asset, 0)
+	for _, sel := range assetSelectors {
+		doc.Find(sel.selector).Each(func(_ int, s *goquery.Selection) {
+			ref := strings.TrimSpace(s.AttrOr(sel.attr, ""))
+			if ref == "" {
+				return
+			}
+			u, err := pageURL.Parse(ref)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return
+			}
+			assetURL := NormalizeURL(u)
+			if !seen[assetURL] {
+				seen[assetURL] = true
+				assets = append(assets, Asset{URL: assetURL, Type: sel.assetType})
+			}
+		})
+	}
+	return assets
+}
+
+// checkAssets requests every unique same-domain asset referenced by the
+// stored pages and records those that fail.
+func (c *Crawler) checkAssets() *AssetCheckResult {
+	types := make(map[string]string)
+	pagesByAsset := make(map[string][]string)
+	c.resultLock.Lock()
+	err := c.eachPage(false, func(page *PageData) {
+		for _, asset := range page.Assets {
+			u, err := url.Parse(asset.URL)
+			if err != nil || !c.isSameDomain(u) {
+				continue
+			}
+			types[asset.URL] = asset.Type
+			pagesByAsset[asset.URL] = append(pagesByAsset[asset.URL], page.URL)
+		}
+	})
+	c.resultLock.Unlock()
+	if err != nil {
+		c.logf("Warning: %v, checking the assets found so far\n", err)
+	}
+
+	assetURLs := make([]string, 0, len(types))
+	for assetURL := range types {
+		assetURLs = append(assetURLs, assetURL)
+	}
+	sort.Strings(assetURLs)
+
+	result := &AssetCheckResult{UniqueAssets: len(assetURLs)}
+	if len(assetURLs) > c.assetCheck.limit {
+		c.logf("Warning: %d unique assets exceed the check limit of %d, checking a sample\n",
+			len(assetURLs), c.assetCheck.limit)
+		assetURLs = sampleURLs(assetURLs, c.assetCheck.limit)
+		result.Sampled = true
+	}
+	result.Checked = len(assetURLs)
+	c.logf("Checking %d assets...\n", len(assetURLs))
+
+	limiter := time.NewTicker(time.Duration(float64(time.Second) / c.assetCheck.rps))
+	defer limiter.Stop()
+
+	jobs := make(chan string)
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < assetCheckWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for assetURL := range jobs {
+				status, err := c.checkAsset(assetURL)
+				if err == nil && status < 400 {
+					continue
+				}
+
+				broken := BrokenAsset{URL: assetURL, Type: types[assetURL], StatusCode: status, Pages: pagesByAsset[assetURL]}
+				if err != nil {
+					broken.Error = err.Error()
+				} else {
+					broken.Error = http.StatusText(status)
+				}
+				lock.Lock()
+				result.Broken = append(result.Broken, broken)
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, assetURL := range assetURLs {
+		<-limiter.C
+		jobs <- assetURL
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(result.Broken, func(i, j int) bool {
+		if len(result.Broken[i].Pages) != len(result.Broken[j].Pages) {
+			return len(result.Broken[i].Pages) > len(result.Broken[j].Pages)
+		}
+		return result.Broken[i].URL < result.Broken[j].URL
+	})
+	return result
+}
+
+// checkAsset returns the status of assetURL, using HEAD and falling back to
+// a bounded GET for servers that do not support HEAD.
+func (c *Crawler) checkAsset(assetURL string) (int, error) {
+	req, err := c.newRequest(assetURL)
+	if err != nil {
+		return 0, err
+	}
+	req.Method = http.MethodHead
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+		return resp.StatusCode, nil
+	}
+
+	req.Method = http.MethodGet
+	resp, err = c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, assetGetLimit))
+	return resp.StatusCode, nil
+}
+
+// sampleURLs deterministically picks n of urls by ordering them on a hash,
+// so repeated runs check the same sample.
+func sampleURLs(urls []string, n int) []string {
+	hashes := make(map[string]uint64, len(urls))
+	for _, u := range urls {
+		h := fnv.New64a()
+		h.Write([]byte(u))
+		hashes[u] = h.Sum64()
+	}
+	sampled := append([]string(nil), urls...)
+	sort.Slice(sampled, func(i, j int) bool { return hashes[sampled[i]] < hashes[sampled[j]] })
+	sampled = sampled[:n]
+	sort.Strings(sampled)
+	return sampled
+}
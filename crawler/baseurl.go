@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const schemeProbeTimeout = 10 * time.Second
+
+// ParseBaseURL validates a user-supplied base URL. Input without a scheme,
+// such as "example.com/docs", is accepted as a bare host and returned with
+// an https scheme and schemeMissing set so the caller can probe for the
+// scheme the site actually serves.
+func ParseBaseURL(raw string) (u *url.URL, schemeMissing bool, err error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, false, errors.New("URL is empty")
+	}
+
+	if !strings.Contains(raw, "://") {
+		if strings.HasPrefix(raw, "/") {
+			return nil, false, errors.New("URL has no host; enter a full URL such as https://example.com")
+		}
+		// A colon not followed by a port ends a scheme, as in mailto:, which
+		// would otherwise be read as the user name of a bare host.
+		if scheme, rest, found := strings.Cut(raw, ":"); found && !strings.HasPrefix(raw, "[") && !strings.Contains(scheme, "/") && !hasPort(rest) {
+			return nil, false, fmt.Errorf("unsupported scheme %q; only http and https can be crawled", scheme)
+		}
+		raw = "https://" + raw
+		schemeMissing = true
+	}
+
+	u, err = url.Parse(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, false, fmt.Errorf("unsupported scheme %q; only http and https can be crawled", u.Scheme)
+	}
+	u.Host = trimHostDot(u.Host)
+	if u.Hostname() == "" {
+		return nil, false, errors.New("URL has no host; enter a full URL such as https://example.com")
+	}
+	return u, schemeMissing, nil
+}
+
+// hasPort reports whether s, the rest of a bare host after a colon, starts
+// with a port: digits up to the end or the path.
+func hasPort(s string) bool {
+	port, _, _ := strings.Cut(s, "/")
+	if port == "" {
+		return false
+	}
+	for _, r := range port {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// chooseScheme probes a base URL that was given without a scheme, trying
+// https first and falling back to http, and returns the first that answers.
+func (c *Crawler) chooseScheme(u *url.URL) (*url.URL, error) {
+	var probeErrs []string
+	for _, scheme := range []string{"https", "http"} {
+		candidate := *u
+		candidate.Scheme = scheme
+
+		err := c.probe(candidate.String())
+		if err == nil {
+			c.logf("No scheme in base URL, using %s\n", candidate.String())
+			return &candidate, nil
+		}
+		probeErrs = append(probeErrs, fmt.Sprintf("%s: %v", scheme, err))
+	}
+	return nil, fmt.Errorf("no scheme given and %s is unreachable (%s)", u.Host, strings.Join(probeErrs, "; "))
+}
+
+func (c *Crawler) probe(pageURL string) error {
+	req, err := c.newRequest(pageURL)
+	if err != nil {
+		return err
+	}
+	req.Method = http.MethodHead
+
+	client := *c.client
+	client.Timeout = schemeProbeTimeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,110 @@
+package crawler
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseBaseURL(t *testing.T) {
+	tests := []struct {
+		in            string
+		want          string
+		schemeMissing bool
+	}{
+		{"https://example.com", "https://example.com", false},
+		{"http://example.com/docs?x=1", "http://example.com/docs?x=1", false},
+		{"  https://example.com/  ", "https://example.com/", false},
+		{"https://example.com.:8443/", "https://example.com:8443/", false},
+		// Bare hosts, with and without paths and ports.
+		{"example.com", "https://example.com", true},
+		{"example.com/docs/intro", "https://example.com/docs/intro", true},
+		{"example.com:8080/a", "https://example.com:8080/a", true},
+		{"www.example.com.", "https://www.example.com", true},
+		{"127.0.0.1:3000", "https://127.0.0.1:3000", true},
+		{"localhost", "https://localhost", true},
+		{"[::1]:8080/a", "https://[::1]:8080/a", true},
+	}
+	for _, tt := range tests {
+		u, schemeMissing, err := ParseBaseURL(tt.in)
+		if err != nil {
+			t.Errorf("ParseBaseURL(%q): %v", tt.in, err)
+			continue
+		}
+		if u.String() != tt.want || schemeMissing != tt.schemeMissing {
+			t.Errorf("ParseBaseURL(%q) = %s, %t, want %s, %t", tt.in, u, schemeMissing, tt.want, tt.schemeMissing)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"   ",
+		"/docs",
+		"ftp://example.com/",
+		"mailto:someone@example.com",
+		"tel:+1-555-0100",
+		"javascript:alert(1)",
+		"https://",
+		"https:///path",
+		"http://:8080/",
+		"example.com:port",
+		"exa mple.com",
+		"https://exa mple.com/",
+	} {
+		if u, _, err := ParseBaseURL(in); err == nil {
+			t.Errorf("ParseBaseURL(%q) = %s, want an error", in, u)
+		}
+	}
+}
+
+// TestNewCrawlerBareHost checks that a bare host serving only http falls
+// back to it and is the base of the crawl.
+func TestNewCrawlerBareHost(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/docs": htmlPage(`<a href="/docs/a">a</a>`),
+	})
+	bare := strings.TrimPrefix(site.URL, "http://")
+	var log strings.Builder
+	c, err := NewCrawler(bare+"/docs", 1, 1000, WithLogOutput(&log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.baseURL.String() != site.URL+"/docs" || c.result.BaseURL != site.URL+"/docs" {
+		t.Errorf("base URL is %s (result %s), want %s/docs", c.baseURL, c.result.BaseURL, site.URL)
+	}
+	if !strings.Contains(log.String(), "using "+site.URL+"/docs") {
+		t.Errorf("the scheme used is not logged: %q", log.String())
+	}
+	if u, _ := url.Parse(site.URL + "/docs/a"); !c.isSameDomain(u) {
+		t.Error("pages of the bare host are not in scope")
+	}
+}
+
+func TestNewCrawlerUnreachableBareHost(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	_, err = NewCrawler(addr, 1, 1000, WithLogOutput(io.Discard))
+	if err == nil {
+		t.Fatal("a bare host nothing listens on gave no error")
+	}
+	for _, want := range []string{addr, "https:", "http:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestNewCrawlerInvalidBaseURL(t *testing.T) {
+	for _, in := range []string{"", "ftp://example.com/", "/relative"} {
+		if _, err := NewCrawler(in, 1, 1000, WithLogOutput(io.Discard)); err == nil || !strings.Contains(err.Error(), "invalid base URL") {
+			t.Errorf("NewCrawler(%q) = %v, want an invalid base URL", in, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// statusPage answers with status and no body, setting the Vary and
+// Last-Modified headers.
+func statusPage(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.WriteHeader(status)
+	}
+}
+
+// partialPage answers the first partial requests with 206 and the first
+// ten bytes of body, and the rest with the whole body.
+func partialPage(body string, partial int) http.HandlerFunc {
+	var requests atomic.Int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if int(requests.Add(1)) > partial {
+			io.WriteString(w, body)
+			return
+		}
+		w.Header().Set("Content-Range", "bytes 0-9/"+strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, body[:10])
+	}
+}
+
+func TestBodylessResponses(t *testing.T) {
+	for _, status := range []int{http.StatusNoContent, http.StatusResetContent, http.StatusNotModified, http.StatusOK} {
+		site := newTestSite(t, map[string]http.HandlerFunc{
+			"/":      htmlPage(`<a href="/empty">empty</a>`),
+			"/empty": statusPage(status),
+		})
+		result := crawlTestSite(t, site.URL, 1)
+		if len(result.Errors) != 0 {
+			t.Errorf("%d: errors %+v", status, result.Errors)
+		}
+		page := findPage(result, site.URL, "/empty")
+		if page == nil {
+			t.Errorf("%d: the page is not stored", status)
+			continue
+		}
+		if !page.Bodyless || page.StatusCode != status || page.Vary != "Accept-Language" || page.LastModified != "Mon, 02 Jan 2006 15:04:05 GMT" {
+			t.Errorf("%d: page %+v, want bodyless with its status and headers", status, page)
+		}
+		if page.Title != "" || len(page.Links) != 0 || page.MalformedHTML || page.ContentHash != "" || page.Change != "" {
+			t.Errorf("%d: page %+v has parsed content", status, page)
+		}
+		if home := findPage(result, site.URL, "/"); home == nil || home.Bodyless {
+			t.Errorf("%d: the home page is not parsed: %+v", status, home)
+		}
+	}
+}
+
+func TestPartialContent(t *testing.T) {
+	body := "<html><head><title>Whole</title></head><body><a href=\"/\">home</a></body></html>"
+	var noCache atomic.Bool
+	refetched := partialPage(body, 1)
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/": htmlPage(`<a href="/once">once</a> <a href="/always">always</a> <a href="/whole">whole</a>`),
+		"/once": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Cache-Control") == "no-cache" {
+				noCache.Store(true)
+			}
+			refetched(w, r)
+		},
+		"/always": partialPage(body, 1000),
+		"/whole": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Range", "bytes 0-"+strconv.Itoa(len(body)-1)+"/"+strconv.Itoa(len(body)))
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, body)
+		},
+	})
+	result := crawlTestSite(t, site.URL, 1)
+
+	// A stray 206 is fetched once more without a cache.
+	if n := site.requested("/once"); n != 2 || !noCache.Load() {
+		t.Errorf("/once was requested %d times (no-cache %t), want twice, the second uncached", n, noCache.Load())
+	}
+	if page := findPage(result, site.URL, "/once"); page == nil || page.Title != "Whole" || page.StatusCode != http.StatusOK {
+		t.Errorf("/once is not stored from the second answer: %+v", page)
+	}
+
+	// One still partial fails.
+	if n := site.requested("/always"); n != 2 {
+		t.Errorf("/always was requested %d times, want twice", n)
+	}
+	if findPage(result, site.URL, "/always") != nil {
+		t.Error("the partial /always is stored")
+	}
+	var failed *CrawlError
+	for i := range result.Errors {
+		if result.Errors[i].URL == site.URL+"/always" {
+			failed = &result.Errors[i]
+		}
+	}
+	if failed == nil || failed.Category != CategoryHTTPStatus || failed.StatusCode != http.StatusPartialContent {
+		t.Errorf("/always error %+v, want http-status 206", failed)
+	}
+
+	// A 206 of the whole page is parsed like a 200, without fetching again.
+	if n := site.requested("/whole"); n != 1 {
+		t.Errorf("/whole was requested %d times, want once", n)
+	}
+	if page := findPage(result, site.URL, "/whole"); page == nil || page.Title != "Whole" || page.Bodyless {
+		t.Errorf("/whole is not parsed: %+v", page)
+	}
+}
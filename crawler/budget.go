@@ -0,0 +1,202 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// UnlimitedDepth disables the depth limit. It is only accepted together
+// with at least one budget so every crawl has a stopping condition.
+const UnlimitedDepth = -1
+
+// StopCancelled is the stop reason of a crawl whose context was cancelled.
+const StopCancelled = "cancelled"
+
+// budget bounds the total work of a crawl. Zero values mean unlimited.
+type budget struct {
+	maxPages    int
+	maxDuration time.Duration
+	maxBytes    int64
+}
+
+func (b budget) limited() bool {
+	return b.maxPages > 0 || b.maxDuration > 0 || b.maxBytes > 0
+}
+
+// WithMaxPages stops the crawl after n requests have been sent.
+func WithMaxPages(n int) Option {
+	return func(c *Crawler) {
+		c.budget.maxPages = n
+	}
+}
+
+// WithMaxDuration stops sending new requests once the crawl has run for d.
+// Requests already in flight are completed.
+func WithMaxDuration(d time.Duration) Option {
+	return func(c *Crawler) {
+		c.budget.maxDuration = d
+	}
+}
+
+// WithMaxBytes stops sending new requests once n bytes of response bodies
+// have been read.
+func WithMaxBytes(n int64) Option {
+	return func(c *Crawler) {
+		c.budget.maxBytes = n
+	}
+}
+
+// BudgetStatus is what is left of the budgets of a crawl. A nil field
+// means the budget is not set and unlimited. PagesRemaining counts the
+// requests that may still be sent under WithMaxPages, TimeRemaining the
+// time until WithMaxDuration stops new requests and BytesRemaining the
+// body bytes that may still be read under WithMaxBytes. None goes below
+// zero.
+type BudgetStatus struct {
+	PagesRemaining *int
+	TimeRemaining  *time.Duration
+	BytesRemaining *int64
+
+	// fraction is the smallest share of a set budget left.
+	fraction float64
+}
+
+// Fraction returns the smallest share of a set budget that is left, from
+// 1 before the crawl starts to 0 once a budget is exhausted, or +Inf when
+// no budget is set. A handler skipping expensive work in the last tenth
+// of the budget checks Fraction() < 0.1.
+func (s BudgetStatus) Fraction() float64 {
+	return s.fraction
+}
+
+// Budget returns what is left of the budgets of the crawl. It only reads
+// atomic counters and is safe to call at any time, concurrently with
+// Start. A resumed crawl counts the pages and bytes of the crawl it
+// resumed, as the budgets do.
+func (c *Crawler) Budget() BudgetStatus {
+	status := BudgetStatus{fraction: math.Inf(1)}
+	note := func(left, limit float64) {
+		status.fraction = math.Min(status.fraction, math.Max(0, left/limit))
+	}
+	if limit := c.budget.maxPages; limit > 0 {
+		left := max(0, limit-int(c.counters.fetched.Load()))
+		status.PagesRemaining = &left
+		note(float64(left), float64(limit))
+	}
+	if limit := c.budget.maxDuration; limit > 0 {
+		left := limit
+		if started := c.counters.started.Load(); started != 0 {
+			left = max(0, limit-time.Since(time.Unix(0, started)))
+		}
+		status.TimeRemaining = &left
+		note(float64(left), float64(limit))
+	}
+	if limit := c.budget.maxBytes; limit > 0 {
+		left := max(0, limit-c.counters.bytes.Load())
+		status.BytesRemaining = &left
+		note(float64(left), float64(limit))
+	}
+	return status
+}
+
+type budgetContextKey struct{}
+
+// BudgetFromContext returns what is left of the budgets of the crawl ctx
+// belongs to: the context of a page handler, or of a request seen by a
+// fetcher middleware. It reports false for other contexts.
+func BudgetFromContext(ctx context.Context) (BudgetStatus, bool) {
+	c, ok := ctx.Value(budgetContextKey{}).(*Crawler)
+	if !ok {
+		return BudgetStatus{}, false
+	}
+	return c.Budget(), true
+}
+
+// ValidateLimits checks a depth limit and the page, duration and byte
+// budgets the way NewCrawler does, so a configuration can be rejected
+// before a crawler is built.
+func ValidateLimits(maxDepth, maxPages int, maxDuration time.Duration, maxBytes int64) error {
+	return validateLimits(maxDepth, budget{maxPages, maxDuration, maxBytes})
+}
+
+func validateLimits(maxDepth int, b budget) error {
+	if b.maxPages < 0 || b.maxDuration < 0 || b.maxBytes < 0 {
+		return fmt.Errorf("budgets must not be negative")
+	}
+	if maxDepth < UnlimitedDepth {
+		return fmt.Errorf("invalid max depth %d: use a value >= 0, or -1 for unlimited", maxDepth)
+	}
+	if maxDepth == UnlimitedDepth && !b.limited() {
+		return fmt.Errorf("unlimited depth requires at least one budget: max pages, max duration or max bytes")
+	}
+	return nil
+}
+
+// withinDepth reports whether depth may be crawled.
+func (c *Crawler) withinDepth(depth int) bool {
+	return c.maxDepth == UnlimitedDepth || depth <= c.maxDepth
+}
+
+// reserveFetch counts a request about to be sent, or returns false and
+// records the stop reason when a budget is exhausted. Only stopping takes
+// resultLock; the common path is lock-free.
+func (c *Crawler) reserveFetch() bool {
+	if c.ctx.Err() != nil {
+		c.stop(StopCancelled)
+		return false
+	}
+
+	maxPagesReason := fmt.Sprintf("max pages (%d) reached", c.budget.maxPages)
+	switch {
+	case c.budget.maxPages > 0 && c.counters.fetched.Load() >= int64(c.budget.maxPages):
+		c.stop(maxPagesReason)
+	case c.budget.maxDuration > 0 && time.Since(time.Unix(0, c.counters.started.Load())) >= c.budget.maxDuration:
+		c.stop(fmt.Sprintf("max duration (%s) reached", c.budget.maxDuration))
+	case c.budget.maxBytes > 0 && c.counters.bytes.Load() >= c.budget.maxBytes:
+		c.stop(fmt.Sprintf("max bytes (%d) reached", c.budget.maxBytes))
+	case !c.counters.reserveFetch(c.budget.maxPages):
+		// Another worker took the last page in the meantime.
+		c.stop(maxPagesReason)
+	default:
+		return true
+	}
+	return false
+}
+
+// stop records the reason the crawl stops fetching, unless one is already
+// set.
+func (c *Crawler) stop(reason string) {
+	c.resultLock.Lock()
+	defer c.resultLock.Unlock()
+	if c.result.StopReason != "" {
+		return
+	}
+	c.result.StopReason = reason
+	switch {
+	case reason == StopCancelled || strings.HasPrefix(reason, StopCircuitOpen):
+	case strings.HasPrefix(reason, StopVisitedCap):
+		c.logf("Visited set full: %s, not discovering further URLs\n", reason)
+	default:
+		c.logf("Budget exhausted: %s, not fetching further URLs\n", reason)
+	}
+}
+
+func (c *Crawler) addBytesFetched(n int64) {
+	c.counters.bytes.Add(n)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
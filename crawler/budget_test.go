@@ -0,0 +1,180 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestBudgetUnlimited(t *testing.T) {
+	c, err := NewCrawler("http://example.com", 1, 1000, WithLogOutput(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	budget := c.Budget()
+	if budget.PagesRemaining != nil || budget.TimeRemaining != nil || budget.BytesRemaining != nil || !math.IsInf(budget.Fraction(), 1) {
+		t.Errorf("budget %+v, fraction %v; want every budget nil and +Inf", budget, budget.Fraction())
+	}
+	if _, ok := BudgetFromContext(context.Background()); ok {
+		t.Error("a context of no crawl has a budget")
+	}
+}
+
+func TestBudgetBeforeStart(t *testing.T) {
+	c, err := NewCrawler("http://example.com", 1, 1000, WithLogOutput(io.Discard),
+		WithMaxPages(10), WithMaxDuration(time.Minute), WithMaxBytes(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	budget := c.Budget()
+	if budget.PagesRemaining == nil || *budget.PagesRemaining != 10 || budget.TimeRemaining == nil || *budget.TimeRemaining != time.Minute ||
+		budget.BytesRemaining == nil || *budget.BytesRemaining != 1000 || budget.Fraction() != 1 {
+		t.Errorf("budget %+v, fraction %v; want every budget whole", budget, budget.Fraction())
+	}
+}
+
+// budgetSite serves a home page linking to n small pages.
+func budgetSite(t *testing.T, n int) *testSite {
+	routes := make(map[string]http.HandlerFunc)
+	var links strings.Builder
+	for i := range n {
+		fmt.Fprintf(&links, `<a href="/p%d">%d</a> `, i, i)
+		routes[fmt.Sprintf("/p%d", i)] = htmlPage(strings.Repeat("x", 100))
+	}
+	routes["/"] = htmlPage(links.String())
+	return newTestSite(t, routes)
+}
+
+// TestBudgetNearExhaustion runs a page handler through the end of a page
+// budget, skipping the work of the last half like a handler taking
+// screenshots would.
+func TestBudgetNearExhaustion(t *testing.T) {
+	site := budgetSite(t, 30)
+	var lock sync.Mutex
+	var seen []BudgetStatus
+	var skipped, done atomic.Int32
+	var requests atomic.Int32
+	handler := func(ctx context.Context, page *PageData, doc *goquery.Document) {
+		budget, ok := BudgetFromContext(ctx)
+		if !ok {
+			t.Errorf("%s: the handler's context has no budget", page.URL)
+			return
+		}
+		lock.Lock()
+		seen = append(seen, budget)
+		lock.Unlock()
+		if budget.Fraction() < 0.5 {
+			skipped.Add(1)
+			return
+		}
+		done.Add(1)
+		page.Title = "handled"
+	}
+	middleware := func(next Fetcher) Fetcher {
+		return fetcherFunc(func(req *http.Request) (*http.Response, error) {
+			if _, ok := BudgetFromContext(req.Context()); ok {
+				requests.Add(1)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+	c, err := NewCrawler(site.URL, 1, 1000, WithLogOutput(io.Discard), WithMaxPages(10), WithMaxDuration(time.Minute), WithMaxBytes(1<<20),
+		WithPageHandler(handler), WithFetcherMiddleware(middleware))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pages) != 10 || len(seen) != 10 {
+		t.Fatalf("stored %d pages, the handler saw %d; want 10", len(result.Pages), len(seen))
+	}
+	// Pages count when requested, so the handler of the last page sees the
+	// page budget exhausted.
+	least := 10
+	for _, budget := range seen {
+		if budget.PagesRemaining == nil || budget.TimeRemaining == nil || budget.BytesRemaining == nil {
+			t.Fatalf("budget %+v, want every budget set", budget)
+		}
+		pages := *budget.PagesRemaining
+		least = min(least, pages)
+		if pages < 0 || pages >= 10 || *budget.TimeRemaining > time.Minute || *budget.TimeRemaining <= 0 || *budget.BytesRemaining >= 1<<20 {
+			t.Errorf("budget %+v, want some of every budget used and none below zero", budget)
+		}
+		// The page budget is the smallest share left.
+		if want := float64(pages) / 10; budget.Fraction() != want {
+			t.Errorf("fraction %v with %d pages left, want %v", budget.Fraction(), pages, want)
+		}
+	}
+	if least != 0 {
+		t.Errorf("the handler saw at least %d pages left, want the budget exhausted at the end", least)
+	}
+	if skipped.Load() == 0 || done.Load() == 0 {
+		t.Errorf("the handler did the work for %d pages and skipped %d, want some of both", done.Load(), skipped.Load())
+	}
+	handled := 0
+	for _, page := range result.Pages {
+		if page.Title == "handled" {
+			handled++
+		}
+	}
+	if handled != int(done.Load()) {
+		t.Errorf("%d pages stored as handled, the handler handled %d", handled, done.Load())
+	}
+	if n := requests.Load(); n < 10 {
+		t.Errorf("the middleware found the budget in %d requests, want every one", n)
+	}
+
+	budget := c.Budget()
+	if budget.PagesRemaining == nil || *budget.PagesRemaining != 0 || budget.Fraction() != 0 {
+		t.Errorf("budget after the crawl %+v, fraction %v; want the pages used up", budget, budget.Fraction())
+	}
+}
+
+// TestBudgetBytes checks the byte budget as the smallest share left.
+func TestBudgetBytes(t *testing.T) {
+	site := budgetSite(t, 30)
+	var least atomic.Int64
+	least.Store(math.MaxInt64)
+	handler := func(ctx context.Context, page *PageData, doc *goquery.Document) {
+		budget, _ := BudgetFromContext(ctx)
+		if budget.PagesRemaining != nil || budget.TimeRemaining != nil || budget.BytesRemaining == nil {
+			t.Errorf("budget %+v, want only the byte budget set", budget)
+			return
+		}
+		left := *budget.BytesRemaining
+		if want := float64(left) / 1000; budget.Fraction() != want {
+			t.Errorf("fraction %v with %d bytes left, want %v", budget.Fraction(), left, want)
+		}
+		for {
+			m := least.Load()
+			if left >= m || least.CompareAndSwap(m, left) {
+				break
+			}
+		}
+	}
+	c, err := NewCrawler(site.URL, 1, 1000, WithLogOutput(io.Discard), WithMaxBytes(1000), WithPageHandler(handler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pages) >= 31 {
+		t.Errorf("stored all %d pages under the byte budget", len(result.Pages))
+	}
+	if least.Load() != 0 {
+		t.Errorf("the handler saw at least %d bytes left, want none at the end", least.Load())
+	}
+}
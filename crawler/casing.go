@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Verdicts of a CaseCollision.
+const (
+	// CaseSame: the URLs serve the same page, or redirect to one.
+	CaseSame = "same"
+	// CaseDifferent: the URLs serve different content.
+	CaseDifferent = "different"
+	// CaseBroken: some of the URLs fail while another serves a page.
+	CaseBroken = "broken"
+)
+
+// CaseCollision is a set of crawled URLs that only differ in the case of
+// their path, such as /About and /about, and how the site treats them.
+type CaseCollision struct {
+	URLs    []CaseVariant `json:"urls"`
+	Verdict string        `json:"verdict"`
+	Detail  string        `json:"detail"`
+}
+
+// CaseVariant is one of the URLs of a CaseCollision. FinalURL is set when
+// it redirected.
+type CaseVariant struct {
+	URL         string `json:"url"`
+	FinalURL    string `json:"final_url,omitempty"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	ContentHash string `json:"content_hash,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// served reports whether the variant answered with a page.
+func (v CaseVariant) served() bool {
+	return v.Error == "" && v.StatusCode < 400
+}
+
+// FindCaseCollisions groups pages and errors by their URL with the path
+// lowercased and returns the groups of more than one URL, by URL. A group
+// is CaseSame when every URL serves the same content or ends up at the same
+// page, CaseDifferent when they all serve a page but not the same, and
+// CaseBroken when only some fail. Groups of URLs that all fail are left
+// out, since the case is not what breaks them.
+func FindCaseCollisions(pages []PageData, errors []CrawlError) []CaseCollision {
+	groups := make(map[string][]CaseVariant)
+	seen := make(map[string]bool)
+	add := func(v CaseVariant) {
+		if seen[v.URL] {
+			return
+		}
+		seen[v.URL] = true
+		key := lowercasePath(v.URL)
+		groups[key] = append(groups[key], v)
+	}
+	// The passes of a multi-language crawl store the same URLs again; the
+	// first record of each counts.
+	for _, page := range pages {
+		add(CaseVariant{URL: page.URL, FinalURL: page.FinalURL, StatusCode: page.StatusCode, ContentHash: page.ContentHash})
+	}
+	for _, e := range errors {
+		add(CaseVariant{URL: e.URL, StatusCode: e.StatusCode, Error: e.Error})
+	}
+
+	var collisions []CaseCollision
+	for _, variants := range groups {
+		if len(variants) < 2 {
+			continue
+		}
+		sort.Slice(variants, func(i, j int) bool { return variants[i].URL < variants[j].URL })
+		if collision, ok := judgeCaseVariants(variants); ok {
+			collisions = append(collisions, collision)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i].URLs[0].URL < collisions[j].URLs[0].URL })
+	return collisions
+}
+
+// judgeCaseVariants returns the verdict on variants, which only differ in
+// case, or false when they all fail.
+func judgeCaseVariants(variants []CaseVariant) (CaseCollision, bool) {
+	collision := CaseCollision{URLs: variants}
+	var failed []string
+	targets := make(map[string]bool)
+	hashes := make(map[string]bool)
+	for _, v := range variants {
+		if !v.served() {
+			failed = append(failed, v.URL)
+			continue
+		}
+		target := v.URL
+		if v.FinalURL != "" {
+			target = v.FinalURL
+		}
+		targets[target] = true
+		if v.ContentHash != "" {
+			hashes[v.ContentHash] = true
+		}
+	}
+	switch {
+	case len(failed) == len(variants):
+		return CaseCollision{}, false
+	case len(failed) > 0:
+		collision.Verdict = CaseBroken
+		collision.Detail = fmt.Sprintf("%s failed while another spelling serves a page", strings.Join(failed, ", "))
+	case len(targets) == 1 && redirected(variants):
+		collision.Verdict = CaseSame
+		collision.Detail = "the site redirects to one spelling; links should use it"
+	case len(targets) == 1 || (len(hashes) == 1 && !hasUnhashed(variants)):
+		collision.Verdict = CaseSame
+		collision.Detail = "the site ignores the case of the path; links should use one spelling"
+	default:
+		collision.Verdict = CaseDifferent
+		collision.Detail = "the URLs serve different content"
+	}
+	return collision, true
+}
+
+// redirected reports whether a variant redirected.
+func redirected(variants []CaseVariant) bool {
+	for _, v := range variants {
+		if v.FinalURL != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasUnhashed reports whether a variant served a page without a content
+// hash, such as a redirect stored as an alias, whose content is unknown.
+func hasUnhashed(variants []CaseVariant) bool {
+	for _, v := range variants {
+		if v.ContentHash == "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+// decodeBody converts an HTML body to UTF-8. The encoding is found like a
+// browser does: a byte order mark, the charset of contentType, a <meta>
+// declaration in the first 1024 bytes, then valid UTF-8 or windows-1252.
+// It returns the name of the encoding, "" for UTF-8, and the encoding link
+// queries are encoded in, nil when that is UTF-8.
+func decodeBody(content []byte, contentType string) ([]byte, string, encoding.Encoding) {
+	enc, name, _ := charset.DetermineEncoding(content, contentType)
+	switch {
+	case name == "utf-8" || enc == encoding.Nop:
+		return content, "", nil
+	case strings.HasPrefix(name, "utf-16"):
+		// Browsers encode the queries of UTF-16 pages in UTF-8. The byte
+		// order mark is not part of the document.
+		if decoded, err := enc.NewDecoder().Bytes(content); err == nil {
+			return bytes.TrimPrefix(decoded, []byte("\ufeff")), name, nil
+		}
+		return content, name, nil
+	}
+	if isASCII(content) {
+		return content, name, enc
+	}
+	decoded, err := enc.NewDecoder().Bytes(content)
+	if err != nil {
+		return content, name, nil
+	}
+	return decoded, name, enc
+}
+
+func isASCII(content []byte) bool {
+	for _, b := range content {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeQuery percent-encodes the non-ASCII characters of the query of
+// href in enc, the encoding of the page it was found on, as browsers do for
+// pages in legacy encodings; characters enc cannot represent become HTML
+// character references first. The path is left alone: browsers, like
+// url.URL, encode it in UTF-8 whatever the page encoding.
+func encodeQuery(href string, enc encoding.Encoding) string {
+	if enc == nil {
+		return href
+	}
+	start := strings.IndexByte(href, '?')
+	if start < 0 {
+		return href
+	}
+	end := len(href)
+	if i := strings.IndexByte(href[start:], '#'); i >= 0 {
+		end = start + i
+	}
+	query := href[start+1 : end]
+	if isASCII([]byte(query)) {
+		return href
+	}
+
+	var b strings.Builder
+	b.WriteString(href[:start+1])
+	encoder := encoding.HTMLEscapeUnsupported(enc.NewEncoder())
+	for len(query) > 0 {
+		i := strings.IndexFunc(query, func(r rune) bool { return r >= utf8.RuneSelf })
+		if i < 0 {
+			b.WriteString(query)
+			break
+		}
+		b.WriteString(query[:i])
+		query = query[i:]
+		n := strings.IndexFunc(query, func(r rune) bool { return r < utf8.RuneSelf })
+		if n < 0 {
+			n = len(query)
+		}
+		raw, err := encoder.String(query[:n])
+		if err != nil {
+			raw = query[:n]
+		}
+		for j := 0; j < len(raw); j++ {
+			// ASCII bytes are trail bytes, kept like browsers do, or
+			// those of character references, whose delimiters are
+			// escaped.
+			if raw[j] < utf8.RuneSelf && !strings.ContainsRune("&#;", rune(raw[j])) {
+				b.WriteByte(raw[j])
+				continue
+			}
+			b.WriteByte('%')
+			b.WriteByte(upperHex[raw[j]>>4])
+			b.WriteByte(upperHex[raw[j]&15])
+		}
+		query = query[n:]
+	}
+	b.WriteString(href[end:])
+	return b.String()
+}
@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// shiftJIS encodes s in Shift_JIS.
+func shiftJIS(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeBody(t *testing.T) {
+	utf16, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().Bytes([]byte("<p>日本語</p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		content     []byte
+		contentType string
+		want        string
+		charset     string
+		query       encoding.Encoding
+	}{
+		{"utf-8", []byte("<p>日本語</p>"), "text/html; charset=utf-8", "<p>日本語</p>", "", nil},
+		{"undeclared utf-8", []byte("<p>日本語</p>"), "text/html", "<p>日本語</p>", "", nil},
+		{"header", shiftJIS(t, "<p>日本語</p>"), "text/html; charset=Shift_JIS", "<p>日本語</p>", "shift_jis", japanese.ShiftJIS},
+		{"meta", shiftJIS(t, `<meta charset="shift_jis"><p>日本語</p>`), "text/html", `<meta charset="shift_jis"><p>日本語</p>`, "shift_jis", japanese.ShiftJIS},
+		{"http-equiv", shiftJIS(t, `<meta http-equiv="Content-Type" content="text/html; charset=x-sjis"><p>日本語</p>`), "",
+			`<meta http-equiv="Content-Type" content="text/html; charset=x-sjis"><p>日本語</p>`, "shift_jis", japanese.ShiftJIS},
+		// The header wins over the document.
+		{"header over meta", []byte(`<meta charset="shift_jis"><p>caf` + "\xe9</p>"), "text/html; charset=windows-1252",
+			`<meta charset="shift_jis"><p>café</p>`, "windows-1252", charmap.Windows1252},
+		{"invalid utf-8", []byte("<p>caf\xe9</p>"), "text/html", "<p>café</p>", "windows-1252", charmap.Windows1252},
+		{"iso-8859-1 label", []byte("<p>caf\xe9</p>"), "text/html; charset=iso-8859-1", "<p>café</p>", "windows-1252", charmap.Windows1252},
+		// ASCII needs no decoding, but its queries still use the encoding.
+		{"ascii", []byte("<p>plain</p>"), "text/html; charset=shift_jis", "<p>plain</p>", "shift_jis", japanese.ShiftJIS},
+		// UTF-16 pages encode their queries in UTF-8.
+		{"utf-16", utf16, "text/html", "<p>日本語</p>", "utf-16le", nil},
+	}
+	for _, tt := range tests {
+		got, charset, query := decodeBody(tt.content, tt.contentType)
+		if string(got) != tt.want || charset != tt.charset || encodingName(query) != encodingName(tt.query) {
+			t.Errorf("%s: decoded %q, %q, %v; want %q, %q, %v", tt.name, got, charset, query, tt.want, tt.charset, tt.query)
+		}
+	}
+}
+
+// encodingName identifies enc by how it encodes a sample, as encodings
+// that are the same can be different values; "" for nil.
+func encodingName(enc encoding.Encoding) string {
+	if enc == nil {
+		return ""
+	}
+	sample, _ := encoding.HTMLEscapeUnsupported(enc.NewEncoder()).String("日本語 café")
+	return sample
+}
+
+func TestEncodeQuery(t *testing.T) {
+	tests := []struct {
+		href string
+		enc  encoding.Encoding
+		want string
+	}{
+		{"/search?q=日本語", nil, "/search?q=日本語"},
+		// An ASCII trail byte is left as it is, like browsers do; here
+		// "{", which NormalizeURL escapes.
+		{"/search?q=日本語", japanese.ShiftJIS, "/search?q=%93%FA%96{%8C%EA"},
+		{"/search?q=日本語", japanese.EUCJP, "/search?q=%C6%FC%CB%DC%B8%EC"},
+		// The path and the fragment are left to url.URL, which uses UTF-8.
+		{"/files/日本語.html", japanese.ShiftJIS, "/files/日本語.html"},
+		{"/日本?q=語#日本", japanese.ShiftJIS, "/日本?q=%8C%EA#日本"},
+		{"/search?q=plain&page=2", japanese.ShiftJIS, "/search?q=plain&page=2"},
+		{"?a=日&b=x&c=本", japanese.ShiftJIS, "?a=%93%FA&b=x&c=%96{"},
+		{"/s?q=café", charmap.Windows1252, "/s?q=caf%E9"},
+		// Characters the encoding lacks are sent as character references.
+		{"/s?q=日", charmap.Windows1252, "/s?q=%26%2326085%3B"},
+		{"/s?q=é日", charmap.Windows1252, "/s?q=%E9%26%2326085%3B"},
+	}
+	for _, tt := range tests {
+		if got := encodeQuery(tt.href, tt.enc); got != tt.want {
+			t.Errorf("encodeQuery(%q, %v) = %q, want %q", tt.href, tt.enc, got, tt.want)
+		}
+	}
+}
+
+// TestCrawlShiftJISPage crawls a Shift_JIS page linking to Japanese file
+// names and queries, and checks the request URIs against those a browser
+// sends for the same page.
+func TestCrawlShiftJISPage(t *testing.T) {
+	var lock sync.Mutex
+	requested := make(map[string]bool)
+	record := func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requested[r.RequestURI] = true
+		lock.Unlock()
+		htmlPage("target")(w, r)
+	}
+	body := shiftJIS(t, `<html><head><title>日本語のページ</title></head><body>`+
+		`<a href="/files/日本語.html">file</a> <a href="/search?q=日本語&amp;page=1">search</a> `+
+		`<a href="資料/一覧.html?表示=全部">relative</a></body></html>`)
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=Shift_JIS")
+			w.Write(body)
+		},
+		"/files/日本語.html": record,
+		"/search":         record,
+		"/資料/一覧.html":     record,
+	})
+	result := crawlTestSite(t, site.URL, 1)
+
+	for _, uri := range []string{
+		"/files/%E6%97%A5%E6%9C%AC%E8%AA%9E.html",
+		"/search?q=%93%FA%96%7B%8C%EA&page=1",
+		"/%E8%B3%87%E6%96%99/%E4%B8%80%E8%A6%A7.html?%95%5C%8E%A6=%91S%95%94",
+	} {
+		if !requested[uri] {
+			t.Errorf("%s was not requested; requested %v", uri, requested)
+		}
+	}
+	home := findPage(result, site.URL, "/")
+	if home == nil {
+		t.Fatal("the home page is not stored")
+	}
+	if home.Title != "日本語のページ" || home.Charset != "shift_jis" {
+		t.Errorf("title %q, charset %q; want the decoded title and shift_jis", home.Title, home.Charset)
+	}
+	if len(result.Errors) != 0 {
+		t.Errorf("errors: %+v", result.Errors)
+	}
+}
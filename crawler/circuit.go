@@ -0,0 +1,413 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StopCircuitOpen starts the stop reason of a crawl the circuit breaker
+// gave up on, for every host it fetched from.
+const StopCircuitOpen = "circuit open"
+
+// ErrCircuitOpen reports a URL that was not requested because the circuit
+// breaker gave up on its host.
+var ErrCircuitOpen = errors.New("circuit breaker gave up on the host")
+
+// maxCircuitPause bounds the doubling of CircuitBreaker.Backoff.
+const maxCircuitPause = 24 * time.Hour
+
+// CircuitBreaker are the settings of WithCircuitBreaker. Start from
+// DefaultCircuitBreaker and change the fields that matter.
+type CircuitBreaker struct {
+	// The circuit of a host opens when at least Threshold of the last
+	// Window requests to it failed, pausing its requests for Backoff,
+	// doubled for every further pause in a row up to a day. After MaxOpens
+	// pauses in a row the crawl gives up on the host.
+	Window    int           `yaml:"window" json:"window"`
+	Threshold float64       `yaml:"threshold" json:"threshold"`
+	Backoff   time.Duration `yaml:"backoff" json:"backoff"`
+	MaxOpens  int           `yaml:"max_opens" json:"max_opens"`
+}
+
+// DefaultCircuitBreaker are the settings used unless WithCircuitBreaker
+// sets others.
+var DefaultCircuitBreaker = CircuitBreaker{
+	Window:    50,
+	Threshold: 0.5,
+	Backoff:   30 * time.Second,
+	MaxOpens:  3,
+}
+
+// WithCircuitBreaker controls the circuit breaker, which is enabled with
+// DefaultCircuitBreaker unless enabled is false. Every host has a circuit
+// of its own. When a host starts failing, with connection errors,
+// timeouts, 5xx, 403 or 429 responses, its requests pause instead of
+// collecting one error per remaining URL. After each pause a single
+// canary request is sent: if it succeeds the host is crawled again, if it
+// fails the pause starts again. Once the pauses have not helped MaxOpens
+// times the crawl gives up on the host and records its remaining URLs as
+// errors of ErrCircuitOpen, which a later run resuming the crawl fetches.
+// When it gave up on every host, the crawl stops with StopReason starting
+// with StopCircuitOpen.
+func WithCircuitBreaker(enabled bool, settings CircuitBreaker) Option {
+	return func(c *Crawler) {
+		c.circuit.enabled = enabled
+		c.circuit.settings = settings
+	}
+}
+
+// ValidCircuitBreaker reports the first problem of settings.
+func ValidCircuitBreaker(settings CircuitBreaker) error {
+	switch {
+	case settings.Window < 1:
+		return fmt.Errorf("window must be at least 1")
+	case settings.Threshold <= 0 || settings.Threshold > 1:
+		return fmt.Errorf("threshold must be above 0 and at most 1")
+	case settings.Backoff <= 0:
+		return fmt.Errorf("backoff must be positive")
+	case settings.MaxOpens < 1:
+		return fmt.Errorf("max_opens must be at least 1")
+	}
+	return nil
+}
+
+// CircuitStats counts the state changes of the circuits of all hosts.
+// GaveUpHosts lists the hosts the crawl gave up on, sorted, and Skipped
+// counts the URLs of those hosts not requested after that.
+type CircuitStats struct {
+	Opened         int      `json:"opened"`
+	Closed         int      `json:"closed"`
+	CanaryFailures int      `json:"canary_failures,omitempty"`
+	GaveUp         bool     `json:"gave_up,omitempty"`
+	GaveUpHosts    []string `json:"gave_up_hosts,omitempty"`
+	Skipped        int      `json:"skipped,omitempty"`
+}
+
+// States of circuitBreaker.
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+	circuitGaveUp
+)
+
+// circuitBreakers holds the circuit of every host requested, keyed by
+// urlHost. restored are the counts of an earlier crawl.
+type circuitBreakers struct {
+	enabled  bool
+	settings CircuitBreaker
+
+	lock     sync.Mutex
+	hosts    map[string]*circuitBreaker
+	restored CircuitStats
+}
+
+func defaultCircuitBreaker() circuitBreakers {
+	return circuitBreakers{enabled: true, settings: DefaultCircuitBreaker}
+}
+
+// host returns the circuit of the host of pageURL.
+func (r *circuitBreakers) host(pageURL string) *circuitBreaker {
+	host := urlHost(pageURL)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	b, ok := r.hosts[host]
+	if !ok {
+		if r.hosts == nil {
+			r.hosts = make(map[string]*circuitBreaker)
+		}
+		b = &circuitBreaker{enabled: r.enabled, settings: r.settings, host: host}
+		r.hosts[host] = b
+	}
+	return b
+}
+
+// gaveUpOnAll reports whether the crawl gave up on every host it sent
+// requests to.
+func (r *circuitBreakers) gaveUpOnAll() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, b := range r.hosts {
+		b.lock.Lock()
+		state := b.state
+		b.lock.Unlock()
+		if state != circuitGaveUp {
+			return false
+		}
+	}
+	return len(r.hosts) > 0
+}
+
+// circuitBreaker tracks the outcomes of the last requests to host in a
+// ring buffer. changed is closed and replaced on every state change,
+// waking the requests waiting for it.
+type circuitBreaker struct {
+	enabled  bool
+	settings CircuitBreaker
+	host     string
+
+	lock      sync.Mutex
+	state     int
+	outcomes  []bool
+	next      int
+	failures  int
+	opens     int
+	openUntil time.Time
+	changed   chan struct{}
+	stats     CircuitStats
+}
+
+// isSiteFailure reports whether err means the site is failing, as opposed
+// to a page that is merely missing or not HTML.
+func isSiteFailure(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		code := statusErr.StatusCode
+		return code >= 500 || code == http.StatusForbidden || code == http.StatusTooManyRequests
+	}
+	switch ErrorCategory(err) {
+	case CategoryThrottled, CategoryTimeout, CategoryConnection, CategoryDNS, CategoryTLS, CategorySlowBody:
+		return true
+	}
+	return false
+}
+
+// notify wakes the requests waiting for a state change. It must be called
+// with b.lock held.
+func (b *circuitBreaker) notify() {
+	if b.changed != nil {
+		close(b.changed)
+	}
+	b.changed = make(chan struct{})
+}
+
+// wait blocks while the circuit is open or a canary is in flight. It
+// reports whether the request may be sent, and whether it is the canary.
+func (b *circuitBreaker) wait(ctx context.Context) (ok, canary bool) {
+	if !b.enabled {
+		return true, false
+	}
+	for {
+		b.lock.Lock()
+		if b.changed == nil {
+			b.changed = make(chan struct{})
+		}
+		changed := b.changed
+		var timer *time.Timer
+		switch b.state {
+		case circuitClosed:
+			b.lock.Unlock()
+			return true, false
+		case circuitGaveUp:
+			b.stats.Skipped++
+			b.lock.Unlock()
+			return false, false
+		case circuitOpen:
+			delay := time.Until(b.openUntil)
+			if delay <= 0 {
+				b.state = circuitHalfOpen
+				b.lock.Unlock()
+				return true, true
+			}
+			timer = time.NewTimer(delay)
+		}
+		b.lock.Unlock()
+		var expired <-chan time.Time
+		if timer != nil {
+			expired = timer.C
+		}
+		select {
+		case <-changed:
+		case <-expired:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return false, false
+		}
+	}
+}
+
+// isClosed reports whether requests may be sent without waiting.
+func (b *circuitBreaker) isClosed() bool {
+	if !b.enabled {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state == circuitClosed
+}
+
+// release gives up the canary turn of a request that was not sent, so the
+// next request becomes the canary.
+func (b *circuitBreaker) release() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+		b.openUntil = time.Now()
+		b.notify()
+	}
+}
+
+// circuitChange describes a state change for the log.
+type circuitChange struct {
+	state    int
+	failures int
+	pause    time.Duration
+}
+
+// record adds the outcome of a request and returns the state change it
+// caused, if any.
+func (b *circuitBreaker) record(canary, failed bool) *circuitChange {
+	if !b.enabled {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if canary {
+		if !failed {
+			b.state, b.opens = circuitClosed, 0
+			b.outcomes, b.next, b.failures = b.outcomes[:0], 0, 0
+			b.stats.Closed++
+			b.notify()
+			return &circuitChange{state: circuitClosed}
+		}
+		b.stats.CanaryFailures++
+		if b.opens >= b.settings.MaxOpens {
+			b.state = circuitGaveUp
+			b.stats.GaveUp = true
+			b.notify()
+			return &circuitChange{state: circuitGaveUp}
+		}
+		return b.open(0)
+	}
+	if b.state != circuitClosed {
+		// Requests sent before the circuit opened.
+		return nil
+	}
+	if len(b.outcomes) < b.settings.Window {
+		b.outcomes = append(b.outcomes, failed)
+	} else {
+		if b.outcomes[b.next] {
+			b.failures--
+		}
+		b.outcomes[b.next] = failed
+		b.next = (b.next + 1) % b.settings.Window
+	}
+	if failed {
+		b.failures++
+	}
+	if len(b.outcomes) < b.settings.Window || float64(b.failures) < b.settings.Threshold*float64(b.settings.Window) {
+		return nil
+	}
+	b.stats.Opened++
+	return b.open(b.failures)
+}
+
+// open pauses requests for the backoff of the next pause in a row. It must
+// be called with b.lock held.
+func (b *circuitBreaker) open(failures int) *circuitChange {
+	b.opens++
+	b.state = circuitOpen
+	pause := circuitPause(b.settings.Backoff, b.opens)
+	b.openUntil = time.Now().Add(pause)
+	b.notify()
+	return &circuitChange{state: circuitOpen, failures: failures, pause: pause}
+}
+
+// circuitPause is the pause of the opens-th pause in a row: backoff,
+// doubled for every pause before it up to maxCircuitPause, and never less
+// than backoff.
+func circuitPause(backoff time.Duration, opens int) time.Duration {
+	pause := backoff
+	for i := 1; i < opens && pause < maxCircuitPause; i++ {
+		pause *= 2
+	}
+	return max(min(pause, maxCircuitPause), backoff)
+}
+
+// circuitStats returns the counts of the circuits of all hosts, those of
+// an earlier crawl included, or nil when none ever opened.
+func (r *circuitBreakers) circuitStats() *CircuitStats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	stats := r.restored
+	for _, b := range r.hosts {
+		b.lock.Lock()
+		stats.Opened += b.stats.Opened
+		stats.Closed += b.stats.Closed
+		stats.CanaryFailures += b.stats.CanaryFailures
+		stats.Skipped += b.stats.Skipped
+		if b.stats.GaveUp {
+			stats.GaveUp = true
+			stats.GaveUpHosts = append(stats.GaveUpHosts, b.host)
+		}
+		b.lock.Unlock()
+	}
+	if stats.Opened == 0 && stats.Closed == 0 && stats.CanaryFailures == 0 && !stats.GaveUp {
+		return nil
+	}
+	sort.Strings(stats.GaveUpHosts)
+	return &stats
+}
+
+// restore adds the state changes of an earlier crawl. The URLs it skipped
+// are crawled by this one.
+func (r *circuitBreakers) restore(prev *CircuitStats) {
+	if prev == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.restored.Opened += prev.Opened
+	r.restored.Closed += prev.Closed
+	r.restored.CanaryFailures += prev.CanaryFailures
+}
+
+// waitCircuit blocks while the circuit breaker pauses requests to the host
+// of pageURL. It reports whether pageURL may be fetched and whether it is
+// the canary. A URL of a host the crawl gave up on is recorded as an error
+// of ErrCircuitOpen.
+func (c *Crawler) waitCircuit(b *circuitBreaker, pageURL string, depth int) (ok, canary bool) {
+	ok, canary = b.wait(c.ctx)
+	if canary {
+		c.logf("Circuit half-open: sending %s as a canary\n", pageURL)
+	}
+	if !ok && c.ctx.Err() == nil {
+		c.addError(newCrawlError(pageURL, depth, &FetchError{URL: pageURL, Err: ErrCircuitOpen}, c.keyLanguage))
+	}
+	return ok, canary
+}
+
+// recordCircuit feeds the outcome of fetching pageURL to the circuit
+// breaker of its host and logs the state change it causes.
+func (c *Crawler) recordCircuit(b *circuitBreaker, pageURL string, canary bool, err error) {
+	change := b.record(canary, err != nil && isSiteFailure(err))
+	if change == nil {
+		return
+	}
+	switch change.state {
+	case circuitClosed:
+		c.logf("Circuit closed: canary %s succeeded, resuming %s\n", pageURL, b.host)
+	case circuitOpen:
+		if canary {
+			c.logf("Circuit open again: canary %s failed (%v), pausing requests to %s for %s\n", pageURL, errors.Unwrap(err), b.host, change.pause)
+		} else {
+			c.logf("Circuit open: %d of the last %d requests to %s failed, pausing them for %s\n",
+				change.failures, c.circuit.settings.Window, b.host, change.pause)
+		}
+	case circuitGaveUp:
+		c.logf("Circuit open: canary %s failed after %d pauses, giving up on %s\n", pageURL, c.circuit.settings.MaxOpens, b.host)
+		if c.circuit.gaveUpOnAll() {
+			c.stop(fmt.Sprintf("%s after %d pauses", StopCircuitOpen, c.circuit.settings.MaxOpens))
+		}
+	}
+}
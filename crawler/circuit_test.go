@@ -0,0 +1,301 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCircuit opens after two failures in the last four requests and
+// gives up after two pauses.
+var testCircuit = CircuitBreaker{Window: 4, Threshold: 0.5, Backoff: time.Millisecond, MaxOpens: 2}
+
+// canary waits for the pause of b to end and checks that the request is
+// the canary.
+func canary(t *testing.T, b *circuitBreaker) {
+	t.Helper()
+	if ok, canary := b.wait(context.Background()); !ok || !canary {
+		t.Fatalf("wait after the pause = %t, %t; want the canary", ok, canary)
+	}
+}
+
+// openCircuit records requests on b until it opens.
+func openCircuit(t *testing.T, b *circuitBreaker) {
+	t.Helper()
+	for i, failed := range []bool{false, true, false} {
+		if change := b.record(false, failed); change != nil {
+			t.Fatalf("request %d changed the circuit to %+v before the window filled", i, change)
+		}
+	}
+	change := b.record(false, true)
+	if change == nil || change.state != circuitOpen || change.failures != 2 || change.pause != testCircuit.Backoff {
+		t.Fatalf("the second failure of four gave %+v, want the circuit open for the backoff", change)
+	}
+	if b.isClosed() {
+		t.Fatal("the open circuit lets requests through")
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("opening", func(t *testing.T) {
+		b := &circuitBreaker{enabled: true, settings: testCircuit}
+		openCircuit(t, b)
+		// Requests sent before it opened do not count.
+		if change := b.record(false, true); change != nil {
+			t.Errorf("a late failure changed the open circuit: %+v", change)
+		}
+		if b.stats.Opened != 1 {
+			t.Errorf("stats %+v, want it opened once", b.stats)
+		}
+	})
+
+	t.Run("failed canary", func(t *testing.T) {
+		b := &circuitBreaker{enabled: true, settings: testCircuit}
+		openCircuit(t, b)
+		canary(t, b)
+		change := b.record(true, true)
+		if change == nil || change.state != circuitOpen || change.pause != 2*testCircuit.Backoff {
+			t.Fatalf("the failed canary gave %+v, want a pause twice as long", change)
+		}
+		if b.stats.CanaryFailures != 1 || b.stats.GaveUp {
+			t.Errorf("stats %+v, want one canary failure", b.stats)
+		}
+	})
+
+	t.Run("successful canary", func(t *testing.T) {
+		b := &circuitBreaker{enabled: true, settings: testCircuit}
+		openCircuit(t, b)
+		canary(t, b)
+		if change := b.record(true, false); change == nil || change.state != circuitClosed {
+			t.Fatalf("the successful canary gave %+v, want the circuit closed", change)
+		}
+		if !b.isClosed() || b.opens != 0 || b.stats.Closed != 1 {
+			t.Errorf("closed: %t, %d pauses in a row, stats %+v", b.isClosed(), b.opens, b.stats)
+		}
+		// The window starts over, and so do the pauses.
+		for _, failed := range []bool{true, false, false} {
+			if change := b.record(false, failed); change != nil {
+				t.Fatalf("%d requests after closing changed the circuit to %+v", len(b.outcomes), change)
+			}
+		}
+		if change := b.record(false, true); change == nil || change.pause != testCircuit.Backoff {
+			t.Errorf("reopening gave %+v, want a pause of the backoff", change)
+		}
+	})
+
+	t.Run("giving up", func(t *testing.T) {
+		b := &circuitBreaker{enabled: true, settings: testCircuit}
+		openCircuit(t, b)
+		canary(t, b)
+		b.record(true, true)
+		canary(t, b)
+		if change := b.record(true, true); change == nil || change.state != circuitGaveUp {
+			t.Fatalf("the canary failing after %d pauses gave %+v, want the circuit to give up", testCircuit.MaxOpens, change)
+		}
+		for range 3 {
+			if ok, _ := b.wait(context.Background()); ok {
+				t.Fatal("a request went through after giving up")
+			}
+		}
+		if !b.stats.GaveUp || b.stats.Skipped != 3 || b.stats.CanaryFailures != 2 {
+			t.Errorf("stats %+v, want it given up with 3 skipped and 2 canary failures", b.stats)
+		}
+	})
+
+	t.Run("released canary", func(t *testing.T) {
+		b := &circuitBreaker{enabled: true, settings: testCircuit}
+		openCircuit(t, b)
+		canary(t, b)
+		b.release()
+		canary(t, b)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		b := &circuitBreaker{settings: testCircuit}
+		for range 10 {
+			if change := b.record(false, true); change != nil {
+				t.Fatalf("a disabled circuit changed to %+v", change)
+			}
+		}
+		if ok, canary := b.wait(context.Background()); !ok || canary || !b.isClosed() {
+			t.Errorf("a disabled circuit holds up requests")
+		}
+	})
+}
+
+func TestCircuitPause(t *testing.T) {
+	tests := []struct {
+		backoff time.Duration
+		opens   int
+		want    time.Duration
+	}{
+		{time.Second, 1, time.Second},
+		{time.Second, 3, 4 * time.Second},
+		{30 * time.Second, 12, 30 * time.Second << 11},
+		{30 * time.Second, 13, maxCircuitPause},
+		// Shifting would overflow.
+		{time.Second, 70, maxCircuitPause},
+		{1, 1000, maxCircuitPause},
+		{48 * time.Hour, 5, 48 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := circuitPause(tt.backoff, tt.opens); got != tt.want {
+			t.Errorf("circuitPause(%s, %d) = %s, want %s", tt.backoff, tt.opens, got, tt.want)
+		}
+	}
+}
+
+// TestCircuitBreakersHosts checks that every host has a circuit of its
+// own, keyed by its normalized form, and that the stats add up.
+func TestCircuitBreakersHosts(t *testing.T) {
+	r := &circuitBreakers{enabled: true, settings: testCircuit}
+	a := r.host("http://Example.com:80/a")
+	for _, same := range []string{"http://example.com./b?c", "https://EXAMPLE.com:443/"} {
+		if r.host(same) != a {
+			t.Errorf("%s has a circuit of its own", same)
+		}
+	}
+	for _, other := range []string{"http://example.com:8080/a", "http://blog.example.com/a"} {
+		if r.host(other) == a {
+			t.Errorf("%s shares the circuit of http://example.com", other)
+		}
+	}
+	if r.circuitStats() != nil {
+		t.Errorf("stats %+v before any circuit opened", r.circuitStats())
+	}
+
+	openCircuit(t, a)
+	if !r.host("http://blog.example.com/").isClosed() {
+		t.Error("opening the circuit of one host opened another")
+	}
+	canary(t, a)
+	a.record(true, true)
+	canary(t, a)
+	a.record(true, true)
+	if r.gaveUpOnAll() {
+		t.Error("all hosts given up with one of three")
+	}
+	r.restore(&CircuitStats{Opened: 2, Closed: 1, GaveUp: true, GaveUpHosts: []string{"old.example"}, Skipped: 9})
+	stats := r.circuitStats()
+	if stats == nil || stats.Opened != 3 || stats.Closed != 1 || stats.CanaryFailures != 2 || !stats.GaveUp ||
+		!slices.Equal(stats.GaveUpHosts, []string{"example.com"}) || stats.Skipped != 0 {
+		t.Errorf("stats %+v, want those of example.com and the restored counts", stats)
+	}
+
+	single := &circuitBreakers{enabled: true, settings: testCircuit}
+	b := single.host("http://example.com/")
+	openCircuit(t, b)
+	canary(t, b)
+	b.record(true, true)
+	canary(t, b)
+	b.record(true, true)
+	if !single.gaveUpOnAll() {
+		t.Error("the only host was given up on, but not all hosts")
+	}
+}
+
+// failingSite serves home at / and answers /f0 to /f<n-1> with 503 Service
+// Unavailable while down is set.
+func failingSite(t *testing.T, n int, home string, down *atomic.Bool) *testSite {
+	routes := map[string]http.HandlerFunc{"/": htmlPage(home)}
+	for i := range n {
+		routes[fmt.Sprintf("/f%d", i)] = func(w http.ResponseWriter, r *http.Request) {
+			if down.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			htmlPage("recovered")(w, r)
+		}
+	}
+	return newTestSite(t, routes)
+}
+
+// circuitOpenErrors returns the URLs of the errors of result the circuit
+// breaker skipped.
+func circuitOpenErrors(result *CrawlResult) []string {
+	var urls []string
+	for _, crawlErr := range result.Errors {
+		if crawlErr.Category == CategoryCircuitOpen {
+			urls = append(urls, crawlErr.URL)
+		}
+	}
+	return urls
+}
+
+// TestCrawlCircuitHost crawls a healthy host and a failing one, and checks
+// that giving up on the failing host leaves the other crawled.
+func TestCrawlCircuitHost(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	failing := failingSite(t, 30, "", &down)
+	var links []string
+	for i := range 30 {
+		links = append(links, fmt.Sprintf("%s/f%d", failing.URL, i))
+	}
+	base := hostSite(t, 10, links...)
+	host := func(site *testSite) string { return strings.TrimPrefix(site.URL, "http://") }
+
+	result := crawlTestSite(t, base.URL, 1, WithCircuitBreaker(true, testCircuit),
+		WithHosts([]HostWeight{{Host: host(base)}, {Host: host(failing)}}))
+	if result.StopReason != "" {
+		t.Errorf("stop reason %q, want the healthy host crawled to the end", result.StopReason)
+	}
+	for i := range 10 {
+		if page := findPage(result, base.URL, fmt.Sprintf("/p%d", i)); page == nil {
+			t.Errorf("/p%d of the healthy host was not crawled", i)
+		}
+	}
+	stats := result.Circuit
+	if stats == nil || !stats.GaveUp || !slices.Equal(stats.GaveUpHosts, []string{host(failing)}) {
+		t.Fatalf("circuit stats %+v, want it given up on %s only", stats, host(failing))
+	}
+	skipped := circuitOpenErrors(result)
+	if len(skipped) == 0 || len(skipped) != stats.Skipped {
+		t.Errorf("%d URLs recorded as circuit-open, %d counted as skipped", len(skipped), stats.Skipped)
+	}
+	for _, pageURL := range skipped {
+		if !strings.HasPrefix(pageURL, failing.URL+"/f") {
+			t.Errorf("%s was skipped, want only the failing pages", pageURL)
+		}
+	}
+	if requested := failing.requested("/") + len(failing.requests) - 1; requested > 15 {
+		t.Errorf("%d URLs of the failing host requested, want most of its 30 failing pages skipped", requested)
+	}
+}
+
+// TestCrawlCircuitGiveUp checks that giving up on the only host stops the
+// crawl, and that resuming crawls the skipped URLs.
+func TestCrawlCircuitGiveUp(t *testing.T) {
+	var links strings.Builder
+	for i := range 20 {
+		fmt.Fprintf(&links, `<a href="/f%d">%d</a> `, i, i)
+	}
+	var down atomic.Bool
+	down.Store(true)
+	site := failingSite(t, 20, links.String(), &down)
+
+	result := crawlTestSite(t, site.URL, 1, WithCircuitBreaker(true, testCircuit))
+	if !strings.HasPrefix(result.StopReason, StopCircuitOpen) {
+		t.Errorf("stop reason %q, want it to start with %q", result.StopReason, StopCircuitOpen)
+	}
+	skipped := circuitOpenErrors(result)
+	if len(skipped) == 0 || result.Circuit == nil || len(skipped) != result.Circuit.Skipped {
+		t.Fatalf("%d URLs recorded as circuit-open, circuit stats %+v", len(skipped), result.Circuit)
+	}
+
+	down.Store(false)
+	resumed := crawlTestSite(t, site.URL, 1, WithCircuitBreaker(true, testCircuit), WithResume(result, false))
+	for _, pageURL := range skipped {
+		if page := findPage(resumed, "", pageURL); page == nil || page.StatusCode != http.StatusOK {
+			t.Errorf("skipped %s resumed as %+v, want it crawled", pageURL, page)
+		}
+	}
+	if left := circuitOpenErrors(resumed); len(left) != 0 {
+		t.Errorf("the resumed crawl still lists %q as circuit-open", left)
+	}
+}
@@ -0,0 +1,257 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// PageTypeOther is the PageType of parsed pages that no classifier and no
+// rule matches.
+const PageTypeOther = "other"
+
+// ClassifyRule assigns Type to the pages meeting all of its conditions: a
+// URL matching URLRegex, an element matching CSSSelectorExists and a
+// JSON-LD block whose @type is JSONLDType. Empty conditions are not
+// checked, but a rule needs at least one.
+type ClassifyRule struct {
+	Type              string `yaml:"type" json:"type"`
+	URLRegex          string `yaml:"url_regex,omitempty" json:"url_regex,omitempty"`
+	CSSSelectorExists string `yaml:"css_selector_exists,omitempty" json:"css_selector_exists,omitempty"`
+	JSONLDType        string `yaml:"jsonld_type,omitempty" json:"jsonld_type,omitempty"`
+}
+
+// ClassifyInput is the page a Classifier looks at.
+type ClassifyInput struct {
+	// URL is the normalized URL the page is stored under.
+	URL string
+	Doc *goquery.Document
+
+	jsonLDTypes []string
+	jsonLDRead  bool
+}
+
+// JSONLDTypes returns the @type values of the JSON-LD blocks of the page,
+// including those of @graph entries. They are read on the first call.
+func (in *ClassifyInput) JSONLDTypes() []string {
+	if !in.jsonLDRead {
+		in.jsonLDTypes = extractJSONLDTypes(in.Doc)
+		in.jsonLDRead = true
+	}
+	return in.jsonLDTypes
+}
+
+// Classifier returns the type of a page, or "" to leave the page to the
+// next classifier.
+type Classifier func(page *ClassifyInput) string
+
+// WithClassifier adds a classifier setting PageType on every parsed page.
+// Classifiers are consulted in the order they were added, before the rules
+// of WithClassifyRules, and never concurrently.
+func WithClassifier(fn Classifier) Option {
+	return func(c *Crawler) {
+		c.classify.classifiers = append(c.classify.classifiers, fn)
+	}
+}
+
+// WithClassifyRules sets the rules setting PageType on every parsed page.
+// The first rule a page meets decides its type; a page meeting none is
+// PageTypeOther. The rules are checked when the crawl starts.
+func WithClassifyRules(rules []ClassifyRule) Option {
+	return func(c *Crawler) {
+		c.classify.rules = rules
+	}
+}
+
+// ValidClassifyRules reports the first problem of rules.
+func ValidClassifyRules(rules []ClassifyRule) error {
+	_, err := compileClassifyRules(rules)
+	return err
+}
+
+type classifyOptions struct {
+	classifiers []Classifier
+	rules       []ClassifyRule
+	compiled    []classifyRule
+	lock        sync.Mutex
+}
+
+// enabled reports whether pages are classified at all.
+func (o *classifyOptions) enabled() bool {
+	return len(o.classifiers) > 0 || len(o.rules) > 0
+}
+
+// classifyRule is a ClassifyRule ready to be evaluated.
+type classifyRule struct {
+	pageType string
+	url      *regexp.Regexp
+	selector cascadia.Selector
+	jsonLD   string
+}
+
+func compileClassifyRules(rules []ClassifyRule) ([]classifyRule, error) {
+	compiled := make([]classifyRule, 0, len(rules))
+	for i, rule := range rules {
+		name := fmt.Sprintf("rule %d (%s)", i+1, rule.Type)
+		if strings.TrimSpace(rule.Type) == "" {
+			return nil, fmt.Errorf("rule %d has no type", i+1)
+		}
+		if rule.URLRegex == "" && rule.CSSSelectorExists == "" && rule.JSONLDType == "" {
+			return nil, fmt.Errorf("%s has no condition", name)
+		}
+		r := classifyRule{pageType: rule.Type, jsonLD: rule.JSONLDType}
+		if rule.URLRegex != "" {
+			re, err := regexp.Compile(rule.URLRegex)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid url_regex %q: %v", name, rule.URLRegex, err)
+			}
+			r.url = re
+		}
+		if rule.CSSSelectorExists != "" {
+			sel, err := cascadia.Compile(rule.CSSSelectorExists)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid css_selector_exists %q: %v", name, rule.CSSSelectorExists, err)
+			}
+			r.selector = sel
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}
+
+// matches checks the cheapest conditions first: the URL, then the
+// document, then the JSON-LD blocks, which are parsed only if needed.
+func (r *classifyRule) matches(page *ClassifyInput) bool {
+	if r.url != nil && !r.url.MatchString(page.URL) {
+		return false
+	}
+	if r.selector != nil && page.Doc.FindMatcher(r.selector).Length() == 0 {
+		return false
+	}
+	if r.jsonLD != "" {
+		for _, t := range page.JSONLDTypes() {
+			if t == r.jsonLD {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// classifyPage returns the PageType of the parsed page at pageURL, or ""
+// when pages are not classified.
+func (c *Crawler) classifyPage(pageURL string, doc *goquery.Document) string {
+	if !c.classify.enabled() {
+		return ""
+	}
+	page := &ClassifyInput{URL: pageURL, Doc: doc}
+	if t := c.classify.runClassifiers(page); t != "" {
+		return t
+	}
+	for i := range c.classify.compiled {
+		if c.classify.compiled[i].matches(page) {
+			return c.classify.compiled[i].pageType
+		}
+	}
+	return PageTypeOther
+}
+
+// runClassifiers returns the type the first classifier gives page.
+func (o *classifyOptions) runClassifiers(page *ClassifyInput) string {
+	if len(o.classifiers) == 0 {
+		return ""
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for _, fn := range o.classifiers {
+		if t := fn(page); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// extractJSONLDTypes collects the @type values of the JSON-LD scripts of
+// doc, in document order and without repeats. Blocks that are not valid
+// JSON are skipped.
+func extractJSONLDTypes(doc *goquery.Document) []string {
+	var types []string
+	seen := make(map[string]bool)
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]any:
+			var names []string
+			switch t := v["@type"].(type) {
+			case string:
+				names = []string{t}
+			case []any:
+				for _, item := range t {
+					if s, ok := item.(string); ok {
+						names = append(names, s)
+					}
+				}
+			}
+			for _, name := range names {
+				if !seen[name] {
+					seen[name] = true
+					types = append(types, name)
+				}
+			}
+			walk(v["@graph"])
+		}
+	}
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		var v any
+		if json.Unmarshal([]byte(s.Text()), &v) == nil {
+			walk(v)
+		}
+	})
+	return types
+}
+
+// PageTypeCounts counts pages per PageType, leaving out the pages without
+// one.
+func PageTypeCounts(pages []PageData) map[string]int {
+	var counts map[string]int
+	for _, page := range pages {
+		if page.PageType == "" {
+			continue
+		}
+		if counts == nil {
+			counts = make(map[string]int)
+		}
+		counts[page.PageType]++
+	}
+	return counts
+}
+
+// formatPageTypes lists counts as "article 12, product 5", largest first.
+func formatPageTypes(counts map[string]int) string {
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if counts[types[i]] != counts[types[j]] {
+			return counts[types[i]] > counts[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = fmt.Sprintf("%s %d", t, counts[t])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,49 @@
+package crawler
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+)
+
+// RequireContactEnv names the environment variable that, when set to a
+// true value, makes a contact mandatory for every crawl: NewCrawler refuses
+// to create a crawler without WithContact.
+const RequireContactEnv = "WEBCRAWLER_REQUIRE_CONTACT"
+
+// WithContact identifies the operator of the crawl to site owners. A
+// mailto: URI or bare e-mail address is sent in the From header; any
+// contact value is appended to the User-Agent string.
+func WithContact(contact string) Option {
+	return func(c *Crawler) {
+		c.contact = strings.TrimSpace(contact)
+	}
+}
+
+// ContactRequired reports whether RequireContactEnv mandates a contact.
+func ContactRequired() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(RequireContactEnv))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// ContactFromHeader returns the From header value for a contact string. Only
+// e-mail contacts can be expressed in From; other URIs (e.g. a web page about
+// the bot) yield an empty header and are carried in the User-Agent only.
+func ContactFromHeader(contact string) (string, error) {
+	address := contact
+	if strings.HasPrefix(strings.ToLower(contact), "mailto:") {
+		address = contact[len("mailto:"):]
+	} else if strings.Contains(contact, "://") || !strings.Contains(contact, "@") {
+		return "", nil
+	}
+
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a valid e-mail address: %v", address, err)
+	}
+	return parsed.Address, nil
+}
@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestContactFromHeader(t *testing.T) {
+	tests := []struct {
+		contact, from, error string
+	}{
+		{"mailto:ops@example.com", "ops@example.com", ""},
+		{"MAILTO:ops@example.com", "ops@example.com", ""},
+		{"ops@example.com", "ops@example.com", ""},
+		{"Crawl Ops <ops@example.com>", "ops@example.com", ""},
+		// Other contacts only go in the User-Agent.
+		{"https://example.com/bot", "", ""},
+		{"https://example.com/@ops", "", ""},
+		{"the ops team", "", ""},
+		{"mailto:the ops team", "", `"the ops team" is not a valid e-mail address`},
+		{"mailto:", "", `"" is not a valid e-mail address`},
+		{"ops@", "", `"ops@" is not a valid e-mail address`},
+		{"ops@example.com, dev@example.com", "", "is not a valid e-mail address"},
+	}
+	for _, tt := range tests {
+		from, err := ContactFromHeader(tt.contact)
+		if from != tt.from || tt.error == "" && err != nil || tt.error != "" && (err == nil || !strings.Contains(err.Error(), tt.error)) {
+			t.Errorf("ContactFromHeader(%q) = %q, %v; want %q, %q", tt.contact, from, err, tt.from, tt.error)
+		}
+	}
+}
+
+func TestContactRequired(t *testing.T) {
+	for value, want := range map[string]bool{"": false, "0": false, "false": false, "no": false, "1": true, "true": true, " Yes ": true, "ON": true} {
+		t.Setenv(RequireContactEnv, value)
+		if got := ContactRequired(); got != want {
+			t.Errorf("ContactRequired() with %s=%q = %t, want %t", RequireContactEnv, value, got, want)
+		}
+	}
+}
+
+func TestNewCrawlerContact(t *testing.T) {
+	if _, err := NewCrawler("http://example.com", 1, 1, WithContact("mailto:not an address")); err == nil || !strings.Contains(err.Error(), "invalid contact") {
+		t.Errorf("an invalid contact: %v", err)
+	}
+
+	t.Setenv(RequireContactEnv, "1")
+	if _, err := NewCrawler("http://example.com", 1, 1); err == nil || !strings.Contains(err.Error(), "a contact is required because "+RequireContactEnv+" is set") {
+		t.Errorf("no contact with %s set: %v", RequireContactEnv, err)
+	}
+	if _, err := NewCrawler("http://example.com", 1, 1, WithContact("  ")); err == nil {
+		t.Errorf("a blank contact with %s set was accepted", RequireContactEnv)
+	}
+	for _, contact := range []string{"ops@example.com", "https://example.com/bot"} {
+		if _, err := NewCrawler("http://example.com", 1, 1, WithContact(contact)); err != nil {
+			t.Errorf("contact %q with %s set: %v", contact, RequireContactEnv, err)
+		}
+	}
+}
+
+// TestCrawlContact checks the headers every request carries for the
+// contact, and that the result records it.
+func TestCrawlContact(t *testing.T) {
+	var lock sync.Mutex
+	headers := make(map[string]http.Header)
+	page := func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		headers[r.URL.Path] = r.Header.Clone()
+		lock.Unlock()
+		htmlPage(`<a href="/a">a</a>`)(w, r)
+	}
+	site := newTestSite(t, map[string]http.HandlerFunc{"/": page, "/a": page})
+
+	tests := []struct {
+		contact, from, userAgent string
+	}{
+		{"mailto:ops@example.com", "ops@example.com", "WebCrawler/1.0 (+mailto:ops@example.com)"},
+		{" https://example.com/bot ", "", "WebCrawler/1.0 (+https://example.com/bot)"},
+		{"", "", "WebCrawler/1.0"},
+	}
+	for _, tt := range tests {
+		clear(headers)
+		result := crawlTestSite(t, site.URL, 1, WithContact(tt.contact))
+		if len(headers) != 2 {
+			t.Fatalf("contact %q: requests %v, want / and /a", tt.contact, headers)
+		}
+		for path, header := range headers {
+			if header.Get("From") != tt.from || header.Get("User-Agent") != tt.userAgent {
+				t.Errorf("contact %q: %s sent From %q and User-Agent %q, want %q and %q", tt.contact, path, header.Get("From"), header.Get("User-Agent"), tt.from, tt.userAgent)
+			}
+			if _, ok := header["From"]; !ok && tt.from != "" || ok && tt.from == "" {
+				t.Errorf("contact %q: %s sent From headers %q", tt.contact, path, header.Values("From"))
+			}
+		}
+		if result.Contact != strings.TrimSpace(tt.contact) || result.UserAgent != tt.userAgent {
+			t.Errorf("contact %q: the result records contact %q and User-Agent %q", tt.contact, result.Contact, result.UserAgent)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package crawler
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// PageCookie is a cookie a response set, without its value. SetBy is the
+// redirect response that set it, empty for the response of the page.
+// ThirdParty marks a Domain attribute outside the crawled host, which
+// browsers refuse.
+type PageCookie struct {
+	Name       string `json:"name"`
+	Domain     string `json:"domain,omitempty"`
+	Secure     bool   `json:"secure,omitempty"`
+	HTTPOnly   bool   `json:"httponly,omitempty"`
+	SameSite   string `json:"samesite,omitempty"`
+	ThirdParty bool   `json:"third_party,omitempty"`
+	SetBy      string `json:"set_by,omitempty"`
+}
+
+// responseCookies returns the cookies set by resp and the redirect
+// responses before it, in the order they were received. Values are never
+// kept.
+func responseCookies(resp *http.Response, host string) []PageCookie {
+	var cookies []PageCookie
+	final := resp
+	for r := resp; r != nil; r = r.Request.Response {
+		var hop []PageCookie
+		for _, cookie := range r.Cookies() {
+			pc := PageCookie{
+				Name:     cookie.Name,
+				Domain:   strings.TrimPrefix(strings.ToLower(cookie.Domain), "."),
+				Secure:   cookie.Secure,
+				HTTPOnly: cookie.HttpOnly,
+				SameSite: sameSiteName(cookie.SameSite),
+			}
+			pc.ThirdParty = pc.Domain != "" && !domainMatches(host, pc.Domain)
+			if r != final {
+				pc.SetBy = NormalizeURL(r.Request.URL)
+			}
+			hop = append(hop, pc)
+		}
+		cookies = append(hop, cookies...)
+	}
+	return cookies
+}
+
+func sameSiteName(mode http.SameSite) string {
+	switch mode {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	case http.SameSiteDefaultMode:
+		return "unrecognized"
+	}
+	return ""
+}
+
+// domainMatches reports whether host lies within the cookie domain, as
+// in RFC 6265 section 5.1.3.
+func domainMatches(host, domain string) bool {
+	host = strings.ToLower(host)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// CookieUsage is a cookie, by name and domain, and how the crawled pages
+// set it. Secure and HTTPOnly hold when every page set the attribute.
+type CookieUsage struct {
+	Name       string
+	Domain     string
+	Pages      int
+	Secure     bool
+	HTTPOnly   bool
+	SameSite   []string
+	ThirdParty bool
+}
+
+// CookieReport rolls up the cookies of pages by name and domain, most
+// widely set first. ThirdPartyDomains lists the Domain attributes outside
+// the crawled host.
+type CookieReport struct {
+	PagesWithCookies  int
+	Cookies           []CookieUsage
+	ThirdPartyDomains []string
+}
+
+// SummarizeCookies builds the cookie rollup of pages. A cookie set several
+// times while fetching one page counts once for it.
+func SummarizeCookies(pages []PageData) CookieReport {
+	var report CookieReport
+	usages := make(map[[2]string]*CookieUsage)
+	thirdParty := make(map[string]bool)
+	for _, page := range pages {
+		if len(page.Cookies) == 0 {
+			continue
+		}
+		report.PagesWithCookies++
+		counted := make(map[[2]string]bool)
+		for _, cookie := range page.Cookies {
+			key := [2]string{cookie.Name, cookie.Domain}
+			usage, ok := usages[key]
+			if !ok {
+				usage = &CookieUsage{Name: cookie.Name, Domain: cookie.Domain, Secure: true, HTTPOnly: true}
+				usages[key] = usage
+			}
+			if !counted[key] {
+				counted[key] = true
+				usage.Pages++
+			}
+			usage.Secure = usage.Secure && cookie.Secure
+			usage.HTTPOnly = usage.HTTPOnly && cookie.HTTPOnly
+			usage.ThirdParty = usage.ThirdParty || cookie.ThirdParty
+			if cookie.ThirdParty {
+				thirdParty[cookie.Domain] = true
+			}
+			if cookie.SameSite != "" && !slices.Contains(usage.SameSite, cookie.SameSite) {
+				usage.SameSite = append(usage.SameSite, cookie.SameSite)
+			}
+		}
+	}
+	for _, usage := range usages {
+		sort.Strings(usage.SameSite)
+		report.Cookies = append(report.Cookies, *usage)
+	}
+	sort.Slice(report.Cookies, func(i, j int) bool {
+		a, b := report.Cookies[i], report.Cookies[j]
+		if a.Pages != b.Pages {
+			return a.Pages > b.Pages
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Domain < b.Domain
+	})
+	for domain := range thirdParty {
+		report.ThirdPartyDomains = append(report.ThirdPartyDomains, domain)
+	}
+	sort.Strings(report.ThirdPartyDomains)
+	return report
+}
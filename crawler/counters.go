@@ -0,0 +1,63 @@
+package crawler
+
+import (
+	"sync/atomic"
+)
+
+// crawlStats are the counters updated on the fetch path. They are atomic so
+// concurrent workers do not serialize on resultLock for every request; the
+// result fields they back are filled in by syncResult.
+type crawlStats struct {
+	discovered     atomic.Int64
+	fetched        atomic.Int64
+	bytes          atomic.Int64
+	pages          atomic.Int64
+	errors         atomic.Int64
+	throttleEvents atomic.Int64
+	hostDots       atomic.Int64
+	pathDepthSkips atomic.Int64
+	paramSkips     atomic.Int64
+
+	// visitedEntries and visitedBytes are the size of the visited set,
+	// for VisitedStats.
+	visitedEntries atomic.Int64
+	visitedBytes   atomic.Int64
+
+	// started is when the crawl started, in Unix nanoseconds, for readers
+	// that do not take resultLock.
+	started atomic.Int64
+}
+
+// reserveFetch counts a request unless maxPages requests were already
+// counted. Zero maxPages is unlimited.
+func (s *crawlStats) reserveFetch(maxPages int) bool {
+	for {
+		n := s.fetched.Load()
+		if maxPages > 0 && n >= int64(maxPages) {
+			return false
+		}
+		if s.fetched.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// restore starts the counters from those of an earlier crawl.
+func (s *crawlStats) restore(result *CrawlResult) {
+	s.fetched.Store(int64(result.FetchedURLs))
+	s.bytes.Store(result.BytesFetched)
+	s.throttleEvents.Store(int64(result.ThrottleEvents))
+	s.hostDots.Store(int64(result.TrailingDotLinks))
+	s.pathDepthSkips.Store(int64(result.PathDepthSkips))
+	s.paramSkips.Store(int64(result.ParamAccumulationSkips))
+}
+
+// syncResult copies the counters into result.
+func (s *crawlStats) syncResult(result *CrawlResult) {
+	result.FetchedURLs = int(s.fetched.Load())
+	result.BytesFetched = s.bytes.Load()
+	result.ThrottleEvents = int(s.throttleEvents.Load())
+	result.TrailingDotLinks = int(s.hostDots.Load())
+	result.PathDepthSkips = int(s.pathDepthSkips.Load())
+	result.ParamAccumulationSkips = int(s.paramSkips.Load())
+}
@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReserveFetch(t *testing.T) {
+	var stats crawlStats
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	reserved := 0
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if stats.reserveFetch(500) {
+					lock.Lock()
+					reserved++
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != 500 || stats.fetched.Load() != 500 {
+		t.Errorf("reserved %d fetches, counted %d, want 500", reserved, stats.fetched.Load())
+	}
+	if !stats.reserveFetch(0) {
+		t.Error("a fetch without a limit is refused")
+	}
+}
+
+func TestCrawlStatsRestore(t *testing.T) {
+	earlier := &CrawlResult{FetchedURLs: 10, BytesFetched: 2048, ThrottleEvents: 2, TrailingDotLinks: 3, PathDepthSkips: 4, ParamAccumulationSkips: 5}
+	var stats crawlStats
+	stats.restore(earlier)
+	stats.fetched.Add(1)
+	stats.bytes.Add(100)
+	var result CrawlResult
+	stats.syncResult(&result)
+	want := *earlier
+	want.FetchedURLs, want.BytesFetched = 11, 2148
+	if result.FetchedURLs != want.FetchedURLs || result.BytesFetched != want.BytesFetched || result.ThrottleEvents != want.ThrottleEvents ||
+		result.TrailingDotLinks != want.TrailingDotLinks || result.PathDepthSkips != want.PathDepthSkips || result.ParamAccumulationSkips != want.ParamAccumulationSkips {
+		t.Errorf("synced %+v, want the counters of %+v", result, want)
+	}
+}
+
+// TestStatsDuringCrawl reads Stats while a crawl updates the counters,
+// which must only grow and end at the numbers of the result.
+func TestStatsDuringCrawl(t *testing.T) {
+	routes := map[string]http.HandlerFunc{}
+	var links strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&links, `<a href="/p%d">%d</a> `, i, i)
+		routes[fmt.Sprintf("/p%d", i)] = htmlPage(`<a href="/">home</a> <a href="/missing">missing</a>`)
+	}
+	routes["/"] = htmlPage(links.String())
+	site := newTestSite(t, routes)
+	c, err := NewCrawler(site.URL, 2, 1000, WithLogOutput(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		var last CrawlStats
+		for {
+			stats := c.Stats()
+			if stats.FetchedURLs < last.FetchedURLs || stats.PagesStored < last.PagesStored || stats.BytesFetched < last.BytesFetched {
+				t.Errorf("counters went back from %+v to %+v", last, stats)
+			}
+			last = stats
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+	result, err := c.Start(context.Background())
+	close(stop)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := c.Stats()
+	if stats.FetchedURLs != result.FetchedURLs || stats.PagesStored != result.TotalPages || stats.Errors != len(result.Errors) || stats.BytesFetched != result.BytesFetched {
+		t.Errorf("stats %+v do not match the result: %d fetched, %d pages, %d errors, %d bytes",
+			stats, result.FetchedURLs, result.TotalPages, len(result.Errors), result.BytesFetched)
+	}
+	if result.TotalPages != 51 || len(result.Errors) != 1 {
+		t.Errorf("stored %d pages and %d errors, want 51 and 1", result.TotalPages, len(result.Errors))
+	}
+}
+
+// lockedStats is the mutex-based baseline crawlStats replaced.
+type lockedStats struct {
+	lock                              sync.Mutex
+	discovered, fetched, bytes, pages int64
+}
+
+// BenchmarkCrawlStats updates the counters of a fetch from 200 concurrent
+// workers, with the atomic counters and with a mutex.
+func BenchmarkCrawlStats(b *testing.B) {
+	parallelism := (200 + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0)
+	b.Run("atomic", func(b *testing.B) {
+		var stats crawlStats
+		b.SetParallelism(parallelism)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				stats.discovered.Add(1)
+				if stats.reserveFetch(0) {
+					stats.bytes.Add(4096)
+					stats.pages.Add(1)
+				}
+			}
+		})
+	})
+	b.Run("mutex", func(b *testing.B) {
+		var stats lockedStats
+		b.SetParallelism(parallelism)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				stats.lock.Lock()
+				stats.discovered++
+				stats.lock.Unlock()
+				stats.lock.Lock()
+				stats.fetched++
+				stats.bytes += 4096
+				stats.pages++
+				stats.lock.Unlock()
+			}
+		})
+	})
+}
@@ -0,0 +1,1935 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/text/encoding"
+)
+
+const (
+	defaultUserAgent = "WebCrawler/1.0"
+
+	// DefaultTimeout bounds a single request, including reading the body.
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultMaxBodySize bounds the HTML read from a single response.
+	DefaultMaxBodySize = 10 << 20
+)
+
+type PageData struct {
+	URL           string         `json:"url"`
+	FinalURL      string         `json:"final_url,omitempty"`
+	RedirectChain []RedirectHop  `json:"redirect_chain,omitempty"`
+	Title         string         `json:"title"`
+	Links         []string       `json:"links"`
+	LinkDetails   []LinkDetail   `json:"link_details,omitempty"`
+	Assets        []Asset        `json:"assets,omitempty"`
+	ExternalLinks []string       `json:"external_links,omitempty"`
+	Mobile        *MobileSignals `json:"mobile,omitempty"`
+	Anchors       *AnchorCounts  `json:"anchors,omitempty"`
+	Perf          *PerfSignals   `json:"perf,omitempty"`
+	LegacyMarkup  *LegacyMarkup  `json:"legacy_markup,omitempty"`
+	Depth         int            `json:"depth"`
+	CrawledAt     time.Time      `json:"crawled_at"`
+	ResponseTime  int64          `json:"response_time_ms"`
+	StatusCode    int            `json:"status_code"`
+
+	// Size is the length of the body read, in bytes. Charset is the
+	// encoding of a page that is not UTF-8, such as shift_jis.
+	Size    int64  `json:"size,omitempty"`
+	Charset string `json:"charset,omitempty"`
+
+	// Description is the meta description and WordCount the number of
+	// words of the body text. Noindex is set by a robots meta tag or an
+	// X-Robots-Tag header with noindex or none.
+	Description string `json:"description,omitempty"`
+	WordCount   int    `json:"word_count,omitempty"`
+	Noindex     bool   `json:"noindex,omitempty"`
+
+	// PageType is the type classifiers and rules gave the page, such as
+	// "article", set on parsed pages when the crawl classifies pages.
+	PageType string `json:"page_type,omitempty"`
+
+	// Robots is the robots.txt decision that allowed the page, set when
+	// the crawl obeys robots.txt.
+	Robots *RobotsDecision `json:"robots,omitempty"`
+
+	// ValidationFailures lists the rules of WithValidations the page
+	// failed.
+	ValidationFailures []ValidationFailure `json:"validation_failures,omitempty"`
+
+	// QualityScore rates the page from 0 to 100 by the problems it has,
+	// weighted with WithQualityWeights. Pages without content have none.
+	QualityScore *int `json:"quality_score,omitempty"`
+
+	// FoundOn is the page with the shallowest link to URL, which decides
+	// Depth. It is empty for the seed.
+	FoundOn string `json:"found_on,omitempty"`
+
+	// Language is the Accept-Language pass that fetched the page, set when
+	// crawling with several languages. Vary is the Vary response header,
+	// which tells whether the server varies content by language at all.
+	Language string `json:"language,omitempty"`
+	Vary     string `json:"vary,omitempty"`
+
+	// ContentHash identifies the text of the page, so URLs serving the
+	// same content can be found. ContentSimHash is a SimHash of the text,
+	// which differs in a few bits for pages whose text differs a little.
+	ContentHash    string `json:"content_hash,omitempty"`
+	ContentSimHash string `json:"content_simhash,omitempty"`
+
+	// TOC is the in-page anchor structure, recorded with WithTOC.
+	TOC *PageTOC `json:"toc,omitempty"`
+
+	// Cookies are the cookies the page and its redirects set, without
+	// their values.
+	Cookies []PageCookie `json:"cookies,omitempty"`
+
+	// Canonical and Hreflang are the rel="canonical" and hreflang
+	// alternate links of the page, as written.
+	Canonical string         `json:"canonical,omitempty"`
+	Hreflang  []HreflangLink `json:"hreflang,omitempty"`
+
+	// Change is ChangeModified or ChangeUnchanged in a crawl with
+	// WithModifiedSince; unchanged pages are stored without content.
+	// LastModified is the Last-Modified response header.
+	Change       string `json:"change,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// PublishedAt and ModifiedAt are the dates the page states it was
+	// published and last changed, in RFC 3339. PublishedSource and
+	// ModifiedSource name the markup each came from: DateSourceJSONLD,
+	// DateSourceMeta or DateSourceTime.
+	PublishedAt     string `json:"published_at,omitempty"`
+	PublishedSource string `json:"published_source,omitempty"`
+	ModifiedAt      string `json:"modified_at,omitempty"`
+	ModifiedSource  string `json:"modified_source,omitempty"`
+
+	// LinkScore is the PageRank of the page in the internal link graph,
+	// scaled so the average page scores 1.
+	LinkScore float64 `json:"link_score,omitempty"`
+
+	// MalformedHTML marks a page that exceeded the HTML limits. Only its
+	// title and anchor links were extracted.
+	MalformedHTML bool `json:"malformed_html,omitempty"`
+
+	// SlowBodyAborted marks a page whose body arrived too slowly: reading
+	// it was abandoned and only the part read was parsed.
+	SlowBodyAborted bool `json:"slow_body_aborted,omitempty"`
+
+	// RecoveredOnRetry marks a page that failed with a retryable error and
+	// was fetched successfully by the final retry phase.
+	RecoveredOnRetry bool `json:"recovered_on_retry,omitempty"`
+
+	// Bodyless marks a page answered with a status that carries no
+	// content, such as 204 No Content or 304 Not Modified, or with an
+	// empty body. It is stored with its status and headers only.
+	Bodyless bool `json:"bodyless,omitempty"`
+
+	// UnfollowedRedirect is the target of a redirect that was not followed
+	// because the crawl would not crawl it as a link: it is not listed in a
+	// crawl with WithOnlyListed, robots.txt disallows it, or a filter or
+	// the scope function excludes it, as UnfollowedReason says. StatusCode
+	// is then the redirect status of FinalURL, the last URL of the chain
+	// followed, or of URL when no hop was.
+	UnfollowedRedirect string `json:"unfollowed_redirect,omitempty"`
+	UnfollowedReason   string `json:"unfollowed_reason,omitempty"`
+
+	// Alias marks a redirect record: the URL redirected to FinalURL, whose
+	// content is stored once, under the page whose URL or FinalURL equals it.
+	Alias bool `json:"alias,omitempty"`
+}
+
+// CrawlError records a URL that could not be crawled.
+type CrawlError struct {
+	URL        string    `json:"url"`
+	Depth      int       `json:"depth"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Category   string    `json:"category"`
+	Error      string    `json:"error"`
+	Time       time.Time `json:"time"`
+	Language   string    `json:"language,omitempty"`
+
+	// Robots is the robots.txt decision of a URL WithRobots skipped.
+	Robots *RobotsDecision `json:"robots,omitempty"`
+}
+
+// Link sources recorded in LinkDetail.Source.
+const (
+	LinkSourceAnchor = "anchor"
+	LinkSourceJS     = "js"
+)
+
+// LinkDetail describes one same-domain link found on a page.
+type LinkDetail struct {
+	URL      string `json:"url"`
+	Text     string `json:"text,omitempty"`
+	Source   string `json:"source"`
+	Nofollow bool   `json:"nofollow,omitempty"`
+}
+
+// RedirectHop is one redirect followed while fetching a page: a redirect
+// response, or a page whose meta refresh was followed with WithMetaRefresh.
+// Type is "http-" and the status code, as in "http-301", or
+// HopMetaRefresh.
+type RedirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Type       string `json:"type,omitempty"`
+}
+
+type CrawlResult struct {
+	BaseURL    string    `json:"base_url"`
+	MaxDepth   int       `json:"max_depth"`
+	UserAgent  string    `json:"user_agent"`
+	Contact    string    `json:"contact,omitempty"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	TotalPages int       `json:"total_pages"`
+
+	// DiscoveredURLs counts unique same-domain URLs the crawler found and
+	// was allowed to crawl (the seed, sitemap URLs, feed items, anchor links and
+	// followed JavaScript links), whether or not they were fetched. FetchedURLs counts URLs for
+	// which a request was sent. TotalPages counts pages stored in Pages.
+	// Coverage is FetchedURLs / DiscoveredURLs.
+	DiscoveredURLs int     `json:"discovered_urls"`
+	FetchedURLs    int     `json:"fetched_urls"`
+	Coverage       float64 `json:"coverage"`
+	BytesFetched   int64   `json:"bytes_fetched"`
+
+	// ThrottleEvents counts responses that asked the crawler to slow down:
+	// status 429 or a detected rate limiting page.
+	ThrottleEvents int `json:"throttle_events,omitempty"`
+
+	// TrailingDotLinks counts the links and redirects to a host written
+	// with the trailing dot of a fully qualified name, such as
+	// example.com., which were treated as links to the plain host.
+	TrailingDotLinks int `json:"trailing_dot_links,omitempty"`
+
+	// PathDepthSkips counts the links, sitemap URLs and feed items skipped
+	// for having more path segments than WithMaxPathDepth allows.
+	PathDepthSkips int `json:"path_depth_skips,omitempty"`
+
+	// ParamAccumulationSkips counts the links, sitemap URLs and feed items
+	// skipped for adding more query parameters than WithMaxAddedParams
+	// allows to a URL already seen.
+	ParamAccumulationSkips int `json:"param_accumulation_skips,omitempty"`
+
+	// PageTypes counts the stored pages per PageType.
+	PageTypes map[string]int `json:"page_types,omitempty"`
+
+	// HostPages counts the stored pages per host of a crawl of several
+	// hosts with WithHosts.
+	HostPages map[string]int `json:"host_pages,omitempty"`
+
+	// Robots lists the robots.txt files the crawl applied, with their
+	// content, when it obeys robots.txt.
+	Robots []RobotsFile `json:"robots,omitempty"`
+
+	// Validations counts the pages checked and failed per rule of
+	// WithValidations.
+	Validations []ValidationSummary `json:"validations,omitempty"`
+
+	// Warmup is what the warmup of WithWarmup measured and the settings it
+	// chose.
+	Warmup *WarmupReport `json:"warmup,omitempty"`
+
+	// UAComparison lists the sampled pages that answered a mobile
+	// User-Agent differently, in a crawl with WithUACompare.
+	UAComparison *UAComparison `json:"ua_comparison,omitempty"`
+
+	// ThirdParties are the domains outside the site that the stored pages
+	// load assets from or link to, by origin.
+	ThirdParties []ThirdParty `json:"third_parties,omitempty"`
+
+	// Visited is the size of the visited set at the end of the crawl.
+	Visited *VisitedStats `json:"visited,omitempty"`
+
+	// StopReason is set when a budget ended the crawl early.
+	StopReason string     `json:"stop_reason,omitempty"`
+	Pages      []PageData `json:"pages"`
+
+	Errors          []CrawlError          `json:"errors,omitempty"`
+	RedirectedLinks []RedirectedLinkGroup `json:"redirected_links,omitempty"`
+	Fingerprint     *Fingerprint          `json:"fingerprint,omitempty"`
+	// InvariantViolations are the breaks of the invariants of the results
+	// found with WithStrict.
+	InvariantViolations []InvariantViolation `json:"invariant_violations,omitempty"`
+	AssetCheck          *AssetCheckResult    `json:"asset_check,omitempty"`
+
+	// FinalRetry is set when the final retry phase fetched URLs again.
+	FinalRetry *FinalRetryStats `json:"final_retry,omitempty"`
+
+	// Circuit is set when the circuit breaker paused the crawl.
+	Circuit *CircuitStats `json:"circuit_breaker,omitempty"`
+
+	// DNS lists by host the IP addresses requests were sent to.
+	// DNSChanges records lookups that returned other addresses than the
+	// previous lookup of the host, which often explains a sudden change
+	// in the responses of a long crawl.
+	DNS        map[string][]ResolvedIP `json:"dns,omitempty"`
+	DNSChanges []DNSChange             `json:"dns_changes,omitempty"`
+
+	// PrunedPatterns lists the URL patterns WithAdaptivePruning stopped
+	// expanding.
+	PrunedPatterns []PrunedPattern `json:"pruned_patterns,omitempty"`
+
+	// DangerousURLs lists the URLs that were not requested because they
+	// look like actions, such as logout links. Sites usually should not
+	// link them with plain anchors at all.
+	DangerousURLs []DangerousURL `json:"dangerous_urls,omitempty"`
+
+	// ListAudit is set for a crawl with WithOnlyListed.
+	ListAudit *ListAudit `json:"list_audit,omitempty"`
+
+	// Shard is set for one shard of a crawl with WithShard.
+	Shard *ShardInfo `json:"shard,omitempty"`
+
+	// Misconfigurations lists canonical, hreflang and sitemap URLs that
+	// are relative, off-domain or insecure.
+	Misconfigurations []URLMisconfiguration `json:"misconfigurations,omitempty"`
+
+	// SiteHygiene lists the syntax problems of robots.txt and the sitemaps,
+	// in a crawl with WithSiteHygiene.
+	SiteHygiene *SiteHygiene `json:"site_hygiene,omitempty"`
+
+	// AcceptLanguage is the Accept-Language header sent with every
+	// request. Languages lists the passes of a multi-language crawl.
+	AcceptLanguage string   `json:"accept_language,omitempty"`
+	Languages      []string `json:"languages,omitempty"`
+
+	// SitemapURLs counts the URLs seeded from the sitemap. ModifiedSince
+	// summarizes the changes found by a crawl with WithModifiedSince.
+	SitemapURLs   int                   `json:"sitemap_urls,omitempty"`
+	ModifiedSince *ModifiedSinceSummary `json:"modified_since,omitempty"`
+
+	// Feeds lists the feeds read with WithFeeds and FeedItems their items,
+	// with the outcome of crawling them.
+	Feeds     []Feed     `json:"feeds,omitempty"`
+	FeedItems []FeedItem `json:"feed_items,omitempty"`
+
+	// Config is the effective configuration of the crawl. Resume is set
+	// when the crawl continued an earlier one.
+	Config *RunConfig  `json:"config,omitempty"`
+	Resume *ResumeInfo `json:"resume,omitempty"`
+
+	// Host and CrossHost are set in the files of a crawl split with
+	// WithSplitByHost: the host the file covers, and the pages whose
+	// redirects crossed into or out of it.
+	Host      string          `json:"host,omitempty"`
+	CrossHost []CrossHostPage `json:"cross_host,omitempty"`
+}
+
+type Crawler struct {
+	visited     map[string]bool
+	discovered  map[string]discovery
+	visitedLock sync.RWMutex
+	// followed holds the links followed from the crawled pages, by visit
+	// key, and relinks the pages that turned out to be shallower than they
+	// were crawled at, whose links are followed again; see markDiscovered.
+	followed          map[string]followedLinks
+	relinks           []relink
+	baseURL           *url.URL
+	maxDepth          int
+	maxPathDepth      int
+	pruning           pruner
+	params            paramIndex
+	strict            bool
+	budget            budget
+	rateLimiter       *rateLimiter
+	warmup            warmupOptions
+	sharedLimits      *LimitRegistry
+	hostLimit         *hostLimit
+	requestsPerSecond float64
+	playback          bool
+	client            *http.Client
+	userAgent         string
+	contact           string
+	fromHeader        string
+	jsLinks           jsLinkOptions
+	assetCheck        assetCheckOptions
+	maxBodySize       int64
+	maxVisited        int
+	bodyProgress      bodyProgressOptions
+	htmlLimits        htmlLimits
+	metaRefresh       bool
+	recordDir         string
+	artifacts         artifactRegistry
+	lowercasePaths    bool
+	throttle          throttleOptions
+	circuit           circuitBreakers
+	linkScores        linkScoreOptions
+	qualityWeights    QualityWeights
+	classify          classifyOptions
+	validations       validationOptions
+	robots            robotsOptions
+	hosts             hostScheduler
+
+	errorHandler func(pageURL string, err error)
+	pageHandler  PageHandler
+	fetcher      Fetcher
+	middleware   []FetcherMiddleware
+
+	tracer           trace.Tracer
+	traceCtx         context.Context
+	traceSampleRatio float64
+	progressInterval time.Duration
+	debug            bool
+	logOutput        io.Writer
+	ctx              context.Context
+	slowPatterns     []SlowPattern
+	slowLimiters     []slowLimiter
+
+	acceptLanguage string
+	languages      []string
+	language       string
+	keyLanguage    string
+
+	modifiedSince   time.Time
+	sitemapURL      string
+	sitemapFindings []URLMisconfiguration
+	hygiene         hygiene
+	feedURLs        []string
+	feeds           []Feed
+	feedItems       []FeedItem
+	knownHosts      []string
+	onlyListed      []string
+	list            *urlList
+	toc             bool
+	perfSignals     bool
+	legacyMarkup    legacyMarkupOptions
+	uaCompare       uaCompareOptions
+	scope           *scopeHook
+
+	dangerousPatterns []string
+	allowDangerous    bool
+	dangerous         []*regexp.Regexp
+	dangerousURLs     dangerousTracker
+
+	shard      shardOptions
+	finalRetry finalRetryOptions
+	dns        dnsTracker
+
+	deterministic bool
+	seed          uint64
+	// rng is the source of randomized behaviour, seeded by
+	// WithDeterministic.
+	rng       *rand.Rand
+	nextLevel []frontierLink
+
+	retain        retainLimits
+	retainedBytes int64
+	spill         *pageSpill
+
+	resume      *CrawlResult
+	forceResume bool
+	frontier    []frontierLink
+
+	includePatterns []string
+	excludePatterns []string
+	include         []*regexp.Regexp
+	exclude         []*regexp.Regexp
+	outputFormat    string
+	outputPath      string
+	splitByHost     bool
+	save            bool
+	outputTime      time.Time
+	parquetRowGroup int
+	edgesPath       string
+	edges           *edgeWriter
+	result          CrawlResult
+	resultLock      sync.Mutex
+	counters        crawlStats
+}
+
+// Option configures optional Crawler behaviour in NewCrawler.
+type Option func(*Crawler)
+
+// WithTimeout sets the time limit for a single request. Requests that run
+// out of time fail with the timeout category. Zero disables the limit.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Crawler) {
+		c.client.Timeout = d
+	}
+}
+
+// WithMaxBodySize limits the size of HTML bodies read, failing larger pages
+// with ErrTooLarge. Zero disables the limit.
+func WithMaxBodySize(n int64) Option {
+	return func(c *Crawler) {
+		c.maxBodySize = n
+	}
+}
+
+// WithDebug enables debug log lines, such as the delays applied by slow
+// patterns.
+func WithDebug(debug bool) Option {
+	return func(c *Crawler) {
+		c.debug = debug
+	}
+}
+
+// WithLogOutput sends the crawl log, one line per page fetched and every
+// warning, to w instead of standard output. Use io.Discard to silence it.
+func WithLogOutput(w io.Writer) Option {
+	return func(c *Crawler) {
+		c.logOutput = w
+	}
+}
+
+// PageHandler is called with every page before it is stored, from the
+// goroutine that fetched it, so several calls may run at once. doc is the
+// parsed document, nil for redirect aliases, bodyless and malformed pages.
+// The handler may fill in fields of page but must not keep it. ctx is done
+// when the crawl is cancelled, and BudgetFromContext tells how much of the
+// budgets is left, so expensive work can be skipped near the end:
+//
+//	func(ctx context.Context, page *crawler.PageData, doc *goquery.Document) {
+//		if budget, _ := crawler.BudgetFromContext(ctx); budget.Fraction() < 0.1 {
+//			return
+//		}
+//		takeScreenshot(ctx, page.URL)
+//	}
+//
+// The crawl waits for the handler, which counts towards WithMaxDuration.
+type PageHandler func(ctx context.Context, page *PageData, doc *goquery.Document)
+
+// WithPageHandler registers fn to be called with every page.
+func WithPageHandler(fn PageHandler) Option {
+	return func(c *Crawler) {
+		c.pageHandler = fn
+	}
+}
+
+func (c *Crawler) logf(format string, args ...any) {
+	fmt.Fprintf(c.logOutput, format, args...)
+}
+
+func (c *Crawler) debugf(format string, args ...any) {
+	if c.debug {
+		c.logf("Debug: "+format+"\n", args...)
+	}
+}
+
+func NewCrawler(baseURL string, maxDepth int, requestsPerSecond float64, opts ...Option) (*Crawler, error) {
+	parsedURL, schemeMissing, err := ParseBaseURL(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL %q: %v", baseURL, err)
+	}
+	if err := ValidRPS(requestsPerSecond); err != nil {
+		return nil, fmt.Errorf("invalid requests per second %v: %v", requestsPerSecond, err)
+	}
+	if isUnlimitedRate(requestsPerSecond) {
+		requestsPerSecond = UnlimitedRPS
+	}
+
+	c := &Crawler{
+		visited:           make(map[string]bool),
+		discovered:        make(map[string]discovery),
+		baseURL:           parsedURL,
+		maxDepth:          maxDepth,
+		rateLimiter:       newRateLimiter(requestsPerSecond),
+		requestsPerSecond: requestsPerSecond,
+		client:            &http.Client{Timeout: DefaultTimeout},
+		userAgent:         defaultUserAgent,
+		outputFormat:      FormatJSON,
+		parquetRowGroup:   DefaultParquetRowGroup,
+		finalRetry:        finalRetryOptions{enabled: true},
+		maxBodySize:       DefaultMaxBodySize,
+		bodyProgress:      bodyProgressOptions{minBytes: DefaultBodyProgressBytes, window: DefaultBodyProgressWindow},
+		htmlLimits:        htmlLimits{maxTags: DefaultMaxTags, maxNesting: DefaultMaxNesting},
+		throttle:          defaultThrottleOptions(),
+		circuit:           defaultCircuitBreaker(),
+		linkScores:        linkScoreOptions{iterations: DefaultLinkScoreIterations, maxPages: DefaultLinkScoreMaxPages},
+		logOutput:         os.Stdout,
+		ctx:               context.Background(),
+		traceCtx:          context.Background(),
+		traceSampleRatio:  1,
+		qualityWeights:    DefaultQualityWeights,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.playback {
+		// Rate limiting recordings read from disk only slows tests down.
+		c.requestsPerSecond = UnlimitedRPS
+		c.rateLimiter = newRateLimiter(UnlimitedRPS)
+	}
+	c.language = c.acceptLanguage
+	if c.tracer != nil {
+		c.middleware = append([]FetcherMiddleware{c.tracingMiddleware}, c.middleware...)
+	}
+	if err := c.buildURLList(); err != nil {
+		return nil, err
+	}
+	c.client.Transport = c.buildFetcher()
+	c.client.CheckRedirect = c.checkRedirect
+
+	if err := validateLimits(maxDepth, c.budget); err != nil {
+		return nil, err
+	}
+	if c.deterministic && c.budget.maxDuration > 0 {
+		return nil, fmt.Errorf("a deterministic crawl cannot have a duration budget, which depends on how fast the site responds")
+	}
+	c.rng = c.newRand()
+	if c.include, err = CompilePatterns(c.includePatterns); err != nil {
+		return nil, fmt.Errorf("invalid include filter: %v", err)
+	}
+	if c.exclude, err = CompilePatterns(c.excludePatterns); err != nil {
+		return nil, fmt.Errorf("invalid exclude filter: %v", err)
+	}
+	if err := c.compileDangerous(); err != nil {
+		return nil, fmt.Errorf("invalid dangerous pattern: %v", err)
+	}
+	if c.slowLimiters, err = compileSlowPatterns(c.slowPatterns); err != nil {
+		return nil, fmt.Errorf("invalid slow pattern: %v", err)
+	}
+	if err := c.throttle.compile(); err != nil {
+		return nil, fmt.Errorf("invalid throttle detection: %v", err)
+	}
+	if c.circuit.enabled {
+		if err := ValidCircuitBreaker(c.circuit.settings); err != nil {
+			return nil, fmt.Errorf("invalid circuit breaker: %v", err)
+		}
+	}
+	if c.classify.compiled, err = compileClassifyRules(c.classify.rules); err != nil {
+		return nil, fmt.Errorf("invalid classify rule: %v", err)
+	}
+	if c.validations.compiled, err = compileValidationRules(c.validations.rules); err != nil {
+		return nil, fmt.Errorf("invalid validation rule: %v", err)
+	}
+	if err := c.hosts.compile(c.baseURL); err != nil {
+		return nil, fmt.Errorf("invalid hosts: %v", err)
+	}
+	if c.acceptLanguage != "" && len(c.languages) > 0 {
+		return nil, fmt.Errorf("an Accept-Language header cannot be combined with language passes")
+	}
+	if !ValidOutputFormat(c.outputFormat) {
+		return nil, fmt.Errorf("unsupported output format %q", c.outputFormat)
+	}
+	if err := ValidateOutputPath(c.outputPath); err != nil {
+		return nil, fmt.Errorf("invalid output path: %v", err)
+	}
+	if err := c.validateSplitByHost(); err != nil {
+		return nil, err
+	}
+
+	if c.contact != "" {
+		from, err := ContactFromHeader(c.contact)
+		if err != nil {
+			return nil, fmt.Errorf("invalid contact: %v", err)
+		}
+		c.fromHeader = from
+		c.userAgent = fmt.Sprintf("%s (+%s)", defaultUserAgent, c.contact)
+	} else if ContactRequired() {
+		return nil, fmt.Errorf("a contact is required because %s is set", RequireContactEnv)
+	}
+
+	if schemeMissing {
+		c.baseURL, err = c.chooseScheme(parsedURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base URL %q: %v", baseURL, err)
+		}
+	}
+
+	c.result = CrawlResult{
+		BaseURL:   NormalizeURL(c.baseURL),
+		MaxDepth:  maxDepth,
+		UserAgent: c.userAgent,
+		Contact:   c.contact,
+		StartTime: time.Now(),
+		Pages:     make([]PageData, 0),
+
+		AcceptLanguage: c.acceptLanguage,
+		Languages:      c.languages,
+	}
+	c.result.Config = c.runConfig()
+	if c.resume != nil {
+		if err := c.restore(); err != nil {
+			return nil, fmt.Errorf("cannot resume: %v", err)
+		}
+	}
+	if err := c.checkShard(); err != nil {
+		return nil, err
+	}
+	if err := c.loadHandoffs(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Crawler) newRequest(pageURL string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.fromHeader != "" {
+		req.Header.Set("From", c.fromHeader)
+	}
+	if c.language != "" {
+		req.Header.Set("Accept-Language", c.language)
+	}
+	return req, nil
+}
+
+// BaseURL returns the seed URL, with the scheme chosen by NewCrawler when
+// the given URL had none.
+func (c *Crawler) BaseURL() *url.URL {
+	u := *c.baseURL
+	return &u
+}
+
+// Head sends a HEAD request for target with the crawler's headers and
+// client, without rate limiting, and returns the response status.
+func (c *Crawler) Head(target string) (int, error) {
+	req, err := c.newRequest(target)
+	if err != nil {
+		return 0, err
+	}
+	req.Method = http.MethodHead
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func (c *Crawler) isVisited(url string) bool {
+	c.visitedLock.RLock()
+	defer c.visitedLock.RUnlock()
+	return c.visited[c.visitKey(url)]
+}
+
+// markVisited records url as visited and reports whether it was new.
+func (c *Crawler) markVisited(url string) bool {
+	c.visitedLock.Lock()
+	defer c.visitedLock.Unlock()
+	key := c.visitKey(url)
+	if c.visited[key] {
+		return false
+	}
+	c.visited[key] = true
+	_, known := c.discovered[key]
+	c.addVisitedKey(key, known)
+	return true
+}
+
+// discovery is the shallowest link found so far to a URL.
+type discovery struct {
+	depth   int
+	foundOn string
+}
+
+// followedLinks are the links followed from a crawled page, followed at
+// depth+1.
+type followedLinks struct {
+	depth int
+	links []string
+}
+
+// relink is a crawled page whose links are followed again at depth+1.
+type relink struct {
+	url   string
+	depth int
+	links []string
+}
+
+// markDiscovered records that url was linked from foundOn at depth. Across
+// calls the shallowest link is kept, since a URL crawled deep in the tree
+// can later turn out to be linked from a shallower page, or to be the
+// target of a shallower redirect. The links of such a page are then
+// followed again from its new depth by runRelinks, so that its subtree
+// gets the depths of its shortest chains of links, within the depth limit
+// too.
+func (c *Crawler) markDiscovered(url string, depth int, foundOn string) bool {
+	c.visitedLock.Lock()
+	defer c.visitedLock.Unlock()
+	key := c.visitKey(url)
+	d, ok := c.discovered[key]
+	if ok && d.depth <= depth {
+		return false
+	}
+	if !ok {
+		c.counters.discovered.Add(1)
+		c.addVisitedKey(key, c.visited[key])
+	}
+	c.discovered[key] = discovery{depth: depth, foundOn: foundOn}
+	if f, crawled := c.followed[key]; crawled && f.depth > depth {
+		c.followed[key] = followedLinks{depth: depth, links: f.links}
+		c.relinks = append(c.relinks, relink{url: url, depth: depth, links: f.links})
+	}
+	return !ok
+}
+
+// recordFollowed records the links followed from url, crawled at depth,
+// queueing them for runRelinks if url turned out to be shallower
+// meanwhile. Pages of depth 0 cannot get shallower and are not recorded.
+func (c *Crawler) recordFollowed(url string, depth int, links []string) {
+	if depth == 0 || len(links) == 0 {
+		return
+	}
+	c.visitedLock.Lock()
+	defer c.visitedLock.Unlock()
+	key := c.visitKey(url)
+	if c.followed == nil {
+		c.followed = make(map[string]followedLinks)
+	}
+	if d, ok := c.discovered[key]; ok && d.depth < depth {
+		depth = d.depth
+		c.relinks = append(c.relinks, relink{url: url, depth: depth, links: links})
+	}
+	c.followed[key] = followedLinks{depth: depth, links: links}
+}
+
+// runRelinks follows the links of the pages queued by markDiscovered and
+// recordFollowed again, from their new depth.
+func (c *Crawler) runRelinks(wg *sync.WaitGroup) {
+	for {
+		c.visitedLock.Lock()
+		relinks := c.relinks
+		c.relinks = nil
+		c.visitedLock.Unlock()
+		if len(relinks) == 0 {
+			return
+		}
+		for _, r := range relinks {
+			for _, link := range r.links {
+				// Links that were beyond the depth limit have not been
+				// through the scope hook yet.
+				if c.withinDepth(r.depth + 1) {
+					if ok, _ := c.inScope(link, r.depth+1, r.url); !ok {
+						continue
+					}
+				}
+				c.follow(link, r.depth+1, r.url, wg)
+			}
+		}
+	}
+}
+
+// reconcileDepths sets the depth and FoundOn of stored pages and errors to
+// the shallowest link seen by the end of the crawl.
+func (c *Crawler) reconcileDepths() error {
+	c.visitedLock.RLock()
+	defer c.visitedLock.RUnlock()
+	err := c.eachPage(true, func(page *PageData) {
+		if d, ok := c.discovered[languageKey(page.Language, page.URL)]; ok && d.depth < page.Depth {
+			page.Depth = d.depth
+			page.FoundOn = d.foundOn
+		}
+	})
+	for i := range c.result.Errors {
+		crawlErr := &c.result.Errors[i]
+		if d, ok := c.discovered[languageKey(crawlErr.Language, crawlErr.URL)]; ok && d.depth < crawlErr.Depth {
+			crawlErr.Depth = d.depth
+		}
+	}
+	return err
+}
+
+// storedDepth returns the depth and FoundOn to record for url crawled at
+// depth: those of the shallowest link seen so far.
+func (c *Crawler) storedDepth(url string, depth int) (int, string) {
+	c.visitedLock.RLock()
+	defer c.visitedLock.RUnlock()
+	d, ok := c.discovered[c.visitKey(url)]
+	if !ok {
+		return depth, ""
+	}
+	return min(depth, d.depth), d.foundOn
+}
+
+func (c *Crawler) isSameDomain(pageURL *url.URL) bool {
+	host := normalizeHost(pageURL.Scheme, pageURL.Host)
+	return host == normalizeHost(c.baseURL.Scheme, c.baseURL.Host) || c.hosts.enabled() && c.hosts.includes(host)
+}
+
+// noteHostDot counts a link or redirect from source to u if the host of u
+// has a trailing dot, warning about the first one, and reports whether it
+// has.
+func (c *Crawler) noteHostDot(u *url.URL, source string) bool {
+	if !hasHostDot(u.Host) {
+		return false
+	}
+	if c.counters.hostDots.Add(1) == 1 {
+		c.logf("Warning: %s links to %s, a host name with a trailing dot; treating it as %s\n",
+			source, u.Host, trimHostDot(u.Host))
+	}
+	return true
+}
+
+// hasToken reports whether the space-separated attribute value contains token.
+func hasToken(value, token string) bool {
+	for _, field := range strings.Fields(value) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// addPageData stores data, after the page handler has seen it with doc, the
+// parsed document of the page or nil.
+func (c *Crawler) addPageData(data PageData, doc *goquery.Document) {
+	if c.pageHandler != nil {
+		c.pageHandler(c.ctx, &data, doc)
+	}
+	c.resultLock.Lock()
+	defer c.resultLock.Unlock()
+	c.result.Pages = append(c.result.Pages, data)
+	c.retainPage(&c.result.Pages[len(c.result.Pages)-1])
+	c.counters.pages.Add(1)
+}
+
+func (c *Crawler) addError(crawlErr CrawlError) {
+	if crawlErr.Time.IsZero() {
+		crawlErr.Time = time.Now()
+	}
+	c.resultLock.Lock()
+	defer c.resultLock.Unlock()
+	c.result.Errors = append(c.result.Errors, crawlErr)
+	c.counters.errors.Add(1)
+}
+
+// waitTurn blocks on the slow pattern and crawl rate limiters, or until
+// the crawl is cancelled. With WithHosts, the hosts take turns waiting on
+// the crawl rate limiter.
+func (c *Crawler) waitTurn(pageURL string, span *pageSpan) {
+	start := time.Now()
+	c.waitSlowPattern(pageURL)
+	release := c.hosts.acquire(c.ctx, urlHost(pageURL))
+	c.waitRate()
+	release()
+	span.rateLimitWait(time.Since(start))
+}
+
+// waitRate blocks on the crawl rate limiter and the shared limiter of the
+// host, if any, or until the crawl is cancelled.
+func (c *Crawler) waitRate() {
+	c.rateLimiter.wait(c.ctx)
+	if c.hostLimit != nil {
+		c.hostLimit.limiter.wait(c.ctx)
+	}
+}
+
+func (c *Crawler) crawl(pageURL string, depth int, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if !c.withinDepth(depth) || !c.isListed(pageURL) || !c.inShard(pageURL) || c.pruning.isPruned(pageURL) {
+		return
+	}
+
+	// Claim the URL before waiting on the rate limiter so concurrent
+	// discoveries of the same link fetch it only once.
+	if !c.markVisited(pageURL) {
+		return
+	}
+	if decision := c.robotsDecision(pageURL); decision != nil && !decision.Allowed {
+		c.robotsDisallowed(pageURL, depth, decision)
+		return
+	}
+	c.fetchAndStore(pageURL, depth, wg, false)
+}
+
+// fetchAndStore fetches the claimed pageURL, stores the page or its error
+// and follows its links. retry is set in the final retry phase, when the
+// URL failed before.
+func (c *Crawler) fetchAndStore(pageURL string, depth int, wg *sync.WaitGroup, retry bool) {
+	span := c.startPageSpan(pageURL, depth)
+	// The circuit may open while the request waits for its turn. The
+	// canary goes out when the pause ends, which is longer than a turn.
+	breaker := c.circuit.host(pageURL)
+	var canary bool
+	for {
+		var ok bool
+		if ok, canary = c.waitCircuit(breaker, pageURL, depth); !ok {
+			span.end(nil, nil)
+			return
+		}
+		if canary {
+			break
+		}
+		c.waitTurn(pageURL, span)
+		if breaker.isClosed() {
+			break
+		}
+	}
+
+	reserve := c.reserveFetch
+	if retry {
+		reserve = c.retryAllowed
+	}
+	if !reserve() {
+		if canary {
+			breaker.release()
+		}
+		span.end(nil, nil)
+		return
+	}
+	if retry {
+		c.logf("Crawling: %s (depth: %d, final retry)\n", pageURL, depth)
+	} else {
+		c.logf("Crawling: %s (depth: %d)\n", pageURL, depth)
+	}
+
+	page, err := c.fetch(span.context(c.ctx), pageURL, depth)
+	// Throttled requests are retried after the crawl has slowed down; they
+	// count once towards the fetched URLs and the page budget.
+	for attempt := 0; err != nil && isThrottled(err) && attempt < c.throttle.retries; attempt++ {
+		c.onThrottled(pageURL, err)
+		span.retry(attempt+1, err)
+		c.waitTurn(pageURL, span)
+		if c.ctx.Err() != nil {
+			break
+		}
+		c.logf("Crawling: %s (depth: %d, retry %d)\n", pageURL, depth, attempt+1)
+		page, err = c.fetch(span.context(c.ctx), pageURL, depth)
+	}
+	span.end(page, err)
+	if c.ctx.Err() == nil {
+		c.recordCircuit(breaker, pageURL, canary, err)
+	}
+	if err != nil {
+		// Requests interrupted by cancellation are not failures of the site.
+		if c.ctx.Err() != nil {
+			return
+		}
+		if retry {
+			c.recordRetry(pageURL, depth, err)
+		} else {
+			c.handleError(pageURL, depth, err)
+		}
+		return
+	}
+	if retry {
+		c.recordRetry(pageURL, depth, nil)
+	}
+	storedDepth, foundOn := c.storedDepth(pageURL, depth)
+	if page.aliasOf != "" {
+		c.logf("Redirect to already visited %s, storing %s as an alias\n", page.aliasOf, pageURL)
+		c.addPageData(PageData{
+			URL:              pageURL,
+			FinalURL:         page.aliasOf,
+			RedirectChain:    page.redirectChain,
+			Alias:            true,
+			Links:            []string{},
+			Depth:            storedDepth,
+			FoundOn:          foundOn,
+			CrawledAt:        time.Now(),
+			ResponseTime:     page.responseTime,
+			StatusCode:       page.statusCode,
+			Language:         c.keyLanguage,
+			Vary:             page.vary,
+			Cookies:          page.cookies,
+			Robots:           c.robotsDecision(page.aliasOf),
+			RecoveredOnRetry: retry,
+		}, nil)
+		return
+	}
+	doc := page.doc
+
+	// Relative links resolve against the page that was actually served.
+	parsedURL := page.url
+	finalURL := ""
+	fetchedURL := pageURL
+	if len(page.redirectChain) > 0 {
+		finalURL = NormalizeURL(parsedURL)
+		fetchedURL = finalURL
+	}
+
+	if page.unfollowedRedirect != "" {
+		c.logf("Redirect to %s (%s), not following it from %s\n", page.unfollowedRedirect, page.unfollowedReason, pageURL)
+		c.addPageData(PageData{
+			URL:                pageURL,
+			FinalURL:           finalURL,
+			RedirectChain:      page.redirectChain,
+			Links:              []string{},
+			Depth:              storedDepth,
+			FoundOn:            foundOn,
+			CrawledAt:          time.Now(),
+			ResponseTime:       page.responseTime,
+			StatusCode:         page.statusCode,
+			Language:           c.keyLanguage,
+			Cookies:            page.cookies,
+			Robots:             c.robotsDecision(fetchedURL),
+			UnfollowedRedirect: page.unfollowedRedirect,
+			UnfollowedReason:   page.unfollowedReason,
+			RecoveredOnRetry:   retry,
+		}, nil)
+		return
+	}
+	if page.notModified || page.bodyless {
+		data := PageData{
+			URL:              pageURL,
+			FinalURL:         finalURL,
+			RedirectChain:    page.redirectChain,
+			Links:            []string{},
+			Depth:            storedDepth,
+			FoundOn:          foundOn,
+			CrawledAt:        time.Now(),
+			ResponseTime:     page.responseTime,
+			StatusCode:       page.statusCode,
+			Language:         c.keyLanguage,
+			Vary:             page.vary,
+			LastModified:     page.lastModified,
+			Cookies:          page.cookies,
+			Bodyless:         page.bodyless,
+			RecoveredOnRetry: retry,
+		}
+		if page.notModified {
+			data.Change = ChangeUnchanged
+		}
+		c.addPageData(data, nil)
+		return
+	}
+
+	// Collect links
+	links := make([]string, 0)
+	linkDetails := make([]LinkDetail, 0)
+	var externalLinks []string
+	var edges []Edge
+	var discovered, followed []string
+	for _, link := range page.anchors {
+		href := encodeQuery(strings.TrimSpace(link.href), page.queryEncoding)
+		if href == "" || strings.HasPrefix(href, "#") {
+			continue
+		}
+
+		absoluteURL, err := parsedURL.Parse(href)
+		if err != nil {
+			continue
+		}
+
+		nextURL, status, reason := c.linkStatus(absoluteURL, depth, pageURL)
+		edge := Edge{
+			Source:   pageURL,
+			Target:   nextURL,
+			Text:     strings.Join(strings.Fields(link.text), " "),
+			LinkType: LinkSourceAnchor,
+			Nofollow: hasToken(link.rel, "nofollow"),
+			Depth:    depth + 1,
+			Status:   status,
+			Reason:   reason,
+		}
+		edges = append(edges, edge)
+
+		if edge.Status == EdgeOffDomain && !slices.Contains(externalLinks, nextURL) {
+			externalLinks = append(externalLinks, nextURL)
+		}
+		if isForeignEdge(edge.Status) {
+			continue
+		}
+		links = append(links, nextURL)
+		linkDetails = append(linkDetails, LinkDetail{
+			URL:      nextURL,
+			Text:     edge.Text,
+			Source:   LinkSourceAnchor,
+			Nofollow: edge.Nofollow,
+		})
+
+		// Listed URLs are all crawled from the list.
+		if isSkippedEdge(edge.Status) || c.list != nil {
+			continue
+		}
+		followed = append(followed, nextURL)
+		if c.follow(nextURL, depth+1, pageURL, wg) {
+			discovered = append(discovered, nextURL)
+		}
+	}
+
+	if c.jsLinks.enabled && doc != nil {
+		for _, jsURL := range c.extractJSLinks(doc, parsedURL, page.queryEncoding) {
+			linkDetails = append(linkDetails, LinkDetail{URL: jsURL, Source: LinkSourceJS})
+			edge := Edge{Source: pageURL, Target: jsURL, LinkType: LinkSourceJS, Depth: depth + 1, Status: EdgeNotFollowed}
+			if c.jsLinks.follow {
+				edge.Status, edge.Reason = c.edgeStatus(jsURL, depth, pageURL)
+			}
+			edges = append(edges, edge)
+			if !c.jsLinks.follow || isSkippedEdge(edge.Status) || c.list != nil {
+				continue
+			}
+			followed = append(followed, jsURL)
+			if c.follow(jsURL, depth+1, pageURL, wg) {
+				discovered = append(discovered, jsURL)
+			}
+		}
+	}
+
+	c.recordEdges(edges)
+	c.recordFollowed(pageURL, depth, followed)
+	c.runRelinks(wg)
+	if decision := c.pruning.observe(pageURL, discovered, doc, page.contentHash); decision != nil {
+		c.logf("Pruning %s: %d of the last %d pages found new links or content, skipping further URLs like %s\n",
+			decision.Pattern, decision.Productive, decision.Window, decision.Example)
+	}
+
+	// Create and store page data
+	pageData := PageData{
+		URL:              pageURL,
+		FinalURL:         finalURL,
+		RedirectChain:    page.redirectChain,
+		Title:            page.title,
+		Links:            links,
+		LinkDetails:      linkDetails,
+		ExternalLinks:    externalLinks,
+		Depth:            storedDepth,
+		FoundOn:          foundOn,
+		CrawledAt:        time.Now(),
+		ResponseTime:     page.responseTime,
+		StatusCode:       page.statusCode,
+		Size:             page.bytes,
+		Charset:          page.charset,
+		Noindex:          page.noindex,
+		MalformedHTML:    page.malformed,
+		SlowBodyAborted:  page.slowBodyAborted,
+		ContentHash:      page.contentHash,
+		ContentSimHash:   page.contentSimHash,
+		Language:         c.keyLanguage,
+		Vary:             page.vary,
+		Cookies:          page.cookies,
+		Change:           c.pageChange(),
+		LastModified:     page.lastModified,
+		Robots:           c.robotsDecision(fetchedURL),
+		RecoveredOnRetry: retry,
+	}
+	if doc != nil {
+		pageData.Assets = extractAssets(doc, parsedURL)
+		pageData.Mobile = extractMobileSignals(doc, parsedURL)
+		pageData.Anchors = countAnchors(doc, page.anchors)
+		pageData.Canonical, pageData.Hreflang = extractDeclaredURLs(doc)
+		var noindex bool
+		pageData.Description, noindex, pageData.WordCount = extractQualitySignals(doc)
+		pageData.Noindex = pageData.Noindex || noindex
+		pageData.PageType = c.classifyPage(pageURL, doc)
+		pageData.ValidationFailures = c.validatePage(pageURL, doc)
+		published, modified := extractContentDates(doc)
+		pageData.PublishedAt, pageData.PublishedSource = published.at, published.source
+		pageData.ModifiedAt, pageData.ModifiedSource = modified.at, modified.source
+		if c.toc {
+			pageData.TOC = extractTOC(doc, parsedURL, page.anchors)
+		}
+		if c.perfSignals {
+			pageData.Perf = extractPerfSignals(doc)
+		}
+		if c.legacyMarkup.enabled {
+			pageData.LegacyMarkup = c.legacyMarkup.extract(doc)
+		}
+	}
+
+	c.addPageData(pageData, doc)
+}
+
+// follow records a link from foundOn to nextURL at depth and crawls it
+// unless it is visited already or belongs to another shard: in a goroutine
+// or, in a deterministic crawl, in the next round. It reports whether the
+// link discovered nextURL.
+func (c *Crawler) follow(nextURL string, depth int, foundOn string, wg *sync.WaitGroup) bool {
+	if c.visitedFull() && !c.isDiscovered(nextURL) {
+		c.stopVisitedCap()
+		return false
+	}
+	discovered := c.markDiscovered(nextURL, depth, foundOn)
+	c.runRelinks(wg)
+	if c.isVisited(nextURL) || !c.inShard(nextURL) {
+		return discovered
+	}
+	if c.deterministic {
+		c.nextLevel = append(c.nextLevel, frontierLink{url: nextURL, depth: depth, language: c.keyLanguage})
+		return discovered
+	}
+	wg.Add(1)
+	go c.crawl(nextURL, depth, wg)
+	return discovered
+}
+
+// isSkippedEdge reports whether a same-domain link with status is not
+// followed.
+func isSkippedEdge(status string) bool {
+	switch status {
+	case EdgeFiltered, EdgePathDepthLimit, EdgeDangerous, EdgeOutOfScope, EdgePruned, EdgeParamAccumulation:
+		return true
+	}
+	return false
+}
+
+// fetchedPage is a successfully fetched and parsed HTML page.
+type fetchedPage struct {
+	url            *url.URL
+	statusCode     int
+	responseTime   int64
+	redirectChain  []RedirectHop
+	vary           string
+	lastModified   string
+	cookies        []PageCookie
+	contentHash    string
+	contentSimHash string
+	bytes          int64
+	title          string
+	anchors        []anchor
+	noindex        bool
+
+	// charset is the encoding of a body that is not UTF-8; it is parsed
+	// converted to UTF-8. Link queries are encoded in queryEncoding, nil
+	// for UTF-8.
+	charset       string
+	queryEncoding encoding.Encoding
+
+	// doc is nil for malformed pages, which are only tokenized.
+	doc       *goquery.Document
+	malformed bool
+
+	// aliasOf is set instead of doc when a redirect led to a URL that is
+	// already visited.
+	aliasOf string
+
+	// unfollowedRedirect is set instead of doc when the response redirects
+	// to a URL the crawl does not crawl, for unfollowedReason.
+	unfollowedRedirect string
+	unfollowedReason   string
+
+	// notModified is set instead of doc when the server answered the
+	// If-Modified-Since request with 304.
+	notModified bool
+
+	// bodyless is set instead of doc when the response has no content to
+	// parse.
+	bodyless bool
+
+	// slowBodyAborted is set when the body arrived too slowly and only the
+	// part read was parsed.
+	slowBodyAborted bool
+}
+
+// fetch requests pageURL, crawled at depth, and parses the response.
+// Failures are returned as a *FetchError.
+func (c *Crawler) fetch(ctx context.Context, pageURL string, depth int) (*fetchedPage, error) {
+	return c.fetchHop(ctx, pageURL, depth, pageURL, nil, nil)
+}
+
+// fetchHop requests target, which is pageURL or the target of a meta
+// refresh reached from it through the hops of prior, claiming the URLs of
+// claimed in the visited set.
+func (c *Crawler) fetchHop(ctx context.Context, pageURL string, depth int, target string, prior []RedirectHop, claimed []string) (*fetchedPage, error) {
+	req, err := c.newRequest(target)
+	if err != nil {
+		return nil, &FetchError{URL: pageURL, Err: err}
+	}
+	// Cancelling ctx abandons a body that arrives too slowly.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req = req.WithContext(ctx)
+	if since := c.conditionalHeader(); since != "" {
+		req.Header.Set("If-Modified-Since", since)
+	}
+
+	req, dedup := withRedirectDedup(req, pageURL, depth, prior, claimed)
+
+	startTime := time.Now()
+	resp, err := c.client.Do(req)
+	if err == nil && resp.StatusCode == http.StatusPartialContent && !completeContentRange(resp) {
+		// The request asked for no range; a cache or server mishandled it.
+		resp.Body.Close()
+		c.logf("Warning: %s answered 206 Partial Content without a Range request, fetching it again uncached\n", pageURL)
+		c.releaseRedirectTargets(target, redirectChainOf(resp), NormalizeURL(resp.Request.URL))
+		req = req.Clone(ctx)
+		req.Header.Set("Cache-Control", "no-cache")
+		req, dedup = withRedirectDedup(req, pageURL, depth, prior, claimed)
+		resp, err = c.client.Do(req)
+	}
+	if err != nil {
+		c.releaseClaims(dedup.claimed, err)
+		return nil, &FetchError{URL: pageURL, Err: err}
+	}
+	defer resp.Body.Close()
+
+	page := &fetchedPage{
+		url:           resp.Request.URL,
+		statusCode:    resp.StatusCode,
+		responseTime:  time.Since(startTime).Milliseconds(),
+		redirectChain: append(prior[:len(prior):len(prior)], redirectChainOf(resp)...),
+		vary:          strings.Join(resp.Header.Values("Vary"), ", "),
+		cookies:       responseCookies(resp, c.baseURL.Hostname()),
+		noindex:       hasNoindex(strings.Join(resp.Header.Values("X-Robots-Tag"), ",")),
+		lastModified:  resp.Header.Get("Last-Modified"),
+	}
+	if dedup.unfollowed != "" {
+		page.unfollowedRedirect, page.unfollowedReason = dedup.unfollowed, dedup.refusal
+		return page, nil
+	}
+	if dedup.stoppedAt != "" {
+		page.redirectChain = append(page.redirectChain, httpHop(resp.Request.URL, resp.StatusCode))
+		page.aliasOf = dedup.stoppedAt
+		return page, nil
+	}
+	fail := func(err error) (*fetchedPage, error) {
+		return nil, &FetchError{URL: pageURL, StatusCode: resp.StatusCode, Err: err}
+	}
+
+	if resp.StatusCode == http.StatusNotModified && !c.modifiedSince.IsZero() && c.isSameDomain(page.url) {
+		page.notModified = true
+		return page, nil
+	}
+
+	if isBodylessStatus(resp.StatusCode) && c.isSameDomain(page.url) {
+		page.bodyless = true
+		return page, nil
+	}
+	// A 206 left after fetching again is accepted if it holds everything.
+	partial := resp.StatusCode == http.StatusPartialContent && completeContentRange(resp)
+	if resp.StatusCode != http.StatusOK && !partial {
+		statusErr := &StatusError{StatusCode: resp.StatusCode}
+		c.releaseClaims(dedup.claimed, statusErr)
+		return fail(statusErr)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !isHTMLContentType(contentType) {
+		return fail(fmt.Errorf("%w: %s", ErrNonHTML, contentType))
+	}
+	if c.maxBodySize > 0 && resp.ContentLength > c.maxBodySize {
+		return fail(fmt.Errorf("%w: %d bytes", ErrTooLarge, resp.ContentLength))
+	}
+
+	body := &countingReader{r: resp.Body}
+	var reader io.Reader = body
+	var progress *progressReader
+	if c.bodyProgress.enabled() {
+		progress = newProgressReader(body, c.bodyProgress, cancel)
+		reader = progress
+	}
+	if c.maxBodySize > 0 {
+		reader = io.LimitReader(reader, c.maxBodySize+1)
+	}
+	content, err := io.ReadAll(reader)
+	c.addBytesFetched(body.n)
+	page.bytes = body.n
+	if c.maxBodySize > 0 && body.n > c.maxBodySize {
+		return fail(fmt.Errorf("%w: more than %d bytes", ErrTooLarge, c.maxBodySize))
+	}
+	if progress != nil && progress.stop() && err != nil {
+		if len(content) == 0 {
+			return fail(fmt.Errorf("%w: less than %d bytes in %s", ErrSlowBody, c.bodyProgress.minBytes, c.bodyProgress.window))
+		}
+		c.logf("Warning: %s sent less than %d bytes in %s, parsing the %d bytes read\n",
+			pageURL, c.bodyProgress.minBytes, c.bodyProgress.window, len(content))
+		page.slowBodyAborted = true
+		err = nil
+	}
+	if err != nil {
+		return nil, &FetchError{URL: pageURL, StatusCode: resp.StatusCode, Err: err}
+	}
+	if len(content) == 0 {
+		page.bodyless = true
+		return page, nil
+	}
+	content, page.charset, page.queryEncoding = decodeBody(content, resp.Header.Get("Content-Type"))
+
+	// Pathological documents are never built into a tree; one bad template
+	// must not dominate the crawl's CPU and memory.
+	if c.htmlLimits.isMalformed(content) {
+		c.logf("Warning: %s exceeds the HTML limits, extracting links only\n", pageURL)
+		page.malformed = true
+		page.title, page.anchors = tokenizeAnchors(bytes.NewReader(content))
+		page.contentHash = contentHash(nil, content)
+		if match := c.detectThrottle(page, len(content)); match != "" {
+			c.releaseRedirectTargets(pageURL, page.redirectChain, NormalizeURL(page.url))
+			return fail(fmt.Errorf("%w: matched %q", ErrThrottled, match))
+		}
+		return page, nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+	if err != nil {
+		return fail(fmt.Errorf("%w: %v", ErrParse, err))
+	}
+	page.doc = doc
+	page.title = doc.Find("title").Text()
+	if match := c.detectThrottle(page, len(content)); match != "" {
+		c.releaseRedirectTargets(pageURL, page.redirectChain, NormalizeURL(page.url))
+		return fail(fmt.Errorf("%w: matched %q", ErrThrottled, match))
+	}
+	if c.metaRefresh {
+		if next := metaRefreshTarget(doc, page.url); next != nil && c.followsMetaRefresh(next, pageURL, depth) {
+			return c.followMetaRefresh(ctx, pageURL, depth, page, c.normalizeLink(next), dedup.claimed)
+		}
+	}
+	page.anchors = documentAnchors(doc)
+	page.contentHash = contentHash(doc, content)
+	page.contentSimHash = contentSimHash(doc)
+	return page, nil
+}
+
+// followMetaRefresh fetches next, the target of the meta refresh of page,
+// continuing the redirect chain of the request for pageURL at depth.
+func (c *Crawler) followMetaRefresh(ctx context.Context, pageURL string, depth int, page *fetchedPage, next string, claimed []string) (*fetchedPage, error) {
+	chain := append(page.redirectChain, RedirectHop{URL: NormalizeURL(page.url), StatusCode: page.statusCode, Type: HopMetaRefresh})
+	fail := func(err error) (*fetchedPage, error) {
+		c.releaseClaims(claimed, err)
+		return nil, &FetchError{URL: pageURL, StatusCode: page.statusCode, Err: err}
+	}
+	if len(chain) >= maxRedirects {
+		return fail(fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, maxRedirects))
+	}
+	for _, hop := range chain {
+		if hop.URL == next {
+			return fail(fmt.Errorf("%w back to %s", ErrRedirectLoop, next))
+		}
+	}
+	c.markDiscovered(next, depth, pageURL)
+	if !c.markVisited(next) {
+		return &fetchedPage{
+			url:           page.url,
+			statusCode:    page.statusCode,
+			responseTime:  page.responseTime,
+			redirectChain: chain,
+			vary:          page.vary,
+			cookies:       page.cookies,
+			aliasOf:       next,
+		}, nil
+	}
+
+	c.waitRate()
+	target, err := c.fetchHop(ctx, pageURL, depth, next, chain, append(claimed, next))
+	if err != nil {
+		return nil, err
+	}
+	target.responseTime += page.responseTime
+	return target, nil
+}
+
+// isBodylessStatus reports whether status is a success or 304 Not
+// Modified response that carries no content.
+func isBodylessStatus(status int) bool {
+	return status == http.StatusNoContent || status == http.StatusResetContent || status == http.StatusNotModified
+}
+
+// completeContentRange reports whether a 206 response holds the whole
+// document, as in "Content-Range: bytes 0-999/1000".
+func completeContentRange(resp *http.Response) bool {
+	var first, last, size int64
+	_, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &first, &last, &size)
+	return err == nil && first == 0 && last == size-1
+}
+
+// isHTMLContentType reports whether a Content-Type header denotes HTML. A
+// missing header is treated as HTML.
+func isHTMLContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// handleError logs a failed URL, records it in the results and passes it
+// to the error handler.
+func (c *Crawler) handleError(pageURL string, depth int, err error) {
+	crawlErr := newCrawlError(pageURL, depth, err, c.keyLanguage)
+	c.logf("Error [%s] %s: %s\n", crawlErr.Category, pageURL, crawlErr.Error)
+	c.addError(crawlErr)
+	c.queueRetry(pageURL, depth, err)
+	if c.errorHandler != nil {
+		c.errorHandler(pageURL, err)
+	}
+}
+
+func newCrawlError(pageURL string, depth int, err error, language string) CrawlError {
+	crawlErr := CrawlError{URL: pageURL, Depth: depth, Category: ErrorCategory(err), Error: err.Error(), Language: language}
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		crawlErr.StatusCode = fetchErr.StatusCode
+		crawlErr.Error = fetchErr.Err.Error()
+	}
+	return crawlErr
+}
+
+// redirectChainOf walks back from the final request of resp to the
+// original one and returns the redirect responses in the order followed.
+func redirectChainOf(resp *http.Response) []RedirectHop {
+	var hops []RedirectHop
+	for req := resp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		hops = append(hops, httpHop(req.Response.Request.URL, req.Response.StatusCode))
+	}
+	for i, j := 0, len(hops)-1; i < j; i, j = i+1, j-1 {
+		hops[i], hops[j] = hops[j], hops[i]
+	}
+	return hops
+}
+
+// finalizeResults fills in the summary fields of the result once crawling
+// has finished.
+func (c *Crawler) finalizeResults() error {
+	c.resultLock.Lock()
+	defer c.resultLock.Unlock()
+	c.result.EndTime = time.Now()
+	c.counters.syncResult(&c.result)
+	c.result.FinalRetry = c.finalRetryStats()
+	c.result.Circuit = c.circuit.circuitStats()
+	c.result.DNS, c.result.DNSChanges = c.dnsRollup()
+	c.result.DangerousURLs = c.dangerousList()
+	c.result.Robots = c.robotsFiles()
+	visited := c.visitedStats()
+	c.result.Visited = &visited
+	c.result.TotalPages = c.storedPages()
+	if err := c.reconcileDepths(); err != nil {
+		return err
+	}
+	c.visitedLock.RLock()
+	c.result.DiscoveredURLs = len(c.discovered)
+	c.visitedLock.RUnlock()
+	if c.result.DiscoveredURLs > 0 {
+		fetched := c.result.FetchedURLs
+		if c.result.UAComparison != nil {
+			// The second fetches of the same URLs cover nothing new.
+			fetched -= c.result.UAComparison.Compared
+		}
+		c.result.Coverage = float64(fetched) / float64(c.result.DiscoveredURLs)
+	}
+	summaries, err := c.pageSummaries()
+	if err != nil {
+		return err
+	}
+	c.result.RedirectedLinks = FindRedirectedLinks(summaries, c.baseURL.Host)
+	c.result.Fingerprint = ComputeFingerprint(summaries, c.result.Errors)
+	if !c.modifiedSince.IsZero() {
+		c.result.ModifiedSince = SummarizeChanges(summaries, c.modifiedSince)
+	}
+	if c.list != nil {
+		c.result.ListAudit = c.listAudit()
+	}
+	c.result.Misconfigurations = append(FindURLMisconfigurations(PageDeclaredURLs(summaries), c.baseURL, c.knownHosts), c.sitemapFindings...)
+	sortMisconfigurations(c.result.Misconfigurations)
+	c.result.Feeds = c.feeds
+	c.result.FeedItems = c.feedStatuses(summaries)
+	c.result.PageTypes = PageTypeCounts(summaries)
+	if c.hosts.enabled() {
+		c.result.HostPages = HostPageCounts(summaries)
+	}
+	c.result.Validations = c.validations.summarize(summaries)
+	if c.result.ThirdParties, err = c.thirdParties(); err != nil {
+		return err
+	}
+	c.result.PrunedPatterns = c.pruning.decisions()
+	c.result.SiteHygiene = c.siteHygiene(summaries)
+	if c.deterministic {
+		if err := c.clearTimes(); err != nil {
+			return err
+		}
+	}
+	if err := c.scoreLinks(summaries); err != nil {
+		return err
+	}
+	if err := c.scoreQuality(summaries); err != nil {
+		return err
+	}
+	return c.checkInvariants()
+}
+
+func (c *Crawler) saveResults(filename string) error {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := writeResultJSON(file, &c.result, c.pageSource()); err != nil {
+		return fmt.Errorf("error encoding JSON: %v", err)
+	}
+
+	return file.Close()
+}
+
+// Start crawls the site, logs a summary and returns the results. It writes
+// no files unless WithOutputPath asks for the results to be saved, which
+// happens before Start returns. Cancelling ctx stops the crawl; the results
+// collected so far are returned, with StopReason set.
+//
+// With WithResultLimit, pages moved to disk during the crawl are read back
+// into the returned result, unless the results were saved: the returned
+// Pages then only hold the pages kept in memory, and the file holds all.
+func (c *Crawler) Start(ctx context.Context) (*CrawlResult, error) {
+	defer c.closeSpill()
+	if err := c.run(ctx); err != nil {
+		return nil, err
+	}
+	c.logf("\nCrawling completed. URLs discovered: %d, fetched: %d, pages stored: %d (coverage %.1f%%)\n",
+		c.result.DiscoveredURLs, c.result.FetchedURLs, c.result.TotalPages, c.result.Coverage*100)
+	if audit := c.result.ListAudit; audit != nil {
+		c.logf("Listed URLs: %d, %s\n", audit.Listed, audit)
+	}
+	if retry := c.result.FinalRetry; retry != nil {
+		c.logf("Final retry: %d of %d URLs recovered\n", retry.Recovered, retry.Retried)
+	}
+	if circuit := c.result.Circuit; circuit != nil {
+		c.logf("Circuit breaker: opened %d times, closed %d times, %d canaries failed", circuit.Opened, circuit.Closed, circuit.CanaryFailures)
+		if circuit.GaveUp {
+			c.logf(", gave up on %s with %d URLs skipped", strings.Join(circuit.GaveUpHosts, ", "), circuit.Skipped)
+		}
+		c.logf("\n")
+	}
+	c.logf("Visited set: %s\n", c.result.Visited)
+	if types := c.result.PageTypes; len(types) > 0 {
+		c.logf("Page types: %s\n", formatPageTypes(types))
+	}
+	if hosts := c.result.HostPages; len(hosts) > 0 {
+		c.logf("Pages per host: %s\n", formatPageTypes(hosts))
+	}
+	if validations := c.result.Validations; len(validations) > 0 {
+		c.logf("Validations: %d failures of %d rules\n", failedValidations(validations), len(validations))
+		for _, v := range validations {
+			c.logf("  %s: %d of %d pages failed\n", v.Name, v.Failed, v.Checked)
+		}
+	}
+	if parties := c.result.ThirdParties; len(parties) > 0 {
+		origins := 0
+		for _, party := range parties {
+			origins += len(party.Origins)
+		}
+		c.logf("Third-party origins: %d of %d domains\n", origins, len(parties))
+	}
+	if n := c.result.PathDepthSkips; n > 0 {
+		c.logf("Links to URLs deeper than %d path segments: %d, skipped\n", c.maxPathDepth, n)
+	}
+	if n := c.result.ParamAccumulationSkips; n > 0 {
+		c.logf("Links adding more than %d query parameters to a URL already seen: %d, skipped\n", c.params.max, n)
+	}
+	if n := c.result.TrailingDotLinks; n > 0 {
+		c.logf("Links to host names with a trailing dot: %d, crawled as the plain host\n", n)
+	}
+	if pruned := c.result.PrunedPatterns; len(pruned) > 0 {
+		c.logf("Pruned URL patterns: %d\n", len(pruned))
+		for _, p := range pruned {
+			c.logf("  %s: %d pages crawled, %d URLs skipped\n", p.Pattern, p.Pages, p.Skipped)
+		}
+	}
+	if h := c.result.SiteHygiene; h != nil {
+		c.logf("Site hygiene: %d problems in %d robots.txt and sitemap files\n", len(h.Findings), len(h.Files))
+		if n := len(h.CaseCollisions); n > 0 {
+			c.logf("URLs differing only in case: %d\n", n)
+		}
+	}
+	if files := c.result.Robots; len(files) > 0 {
+		disallowed := 0
+		for _, count := range CountRobotsRules(c.result.Errors) {
+			disallowed += count.URLs
+		}
+		c.logf("Robots.txt: %d files applied, %d URLs disallowed\n", len(files), disallowed)
+	}
+	if dangerous := c.result.DangerousURLs; len(dangerous) > 0 {
+		c.logf("Warning: %d URLs that look like actions are linked with plain links and were skipped; "+
+			"pass -allow-dangerous to crawl them\n", len(dangerous))
+		for i, u := range dangerous {
+			if i == 10 {
+				c.logf("  ... and %d more\n", len(dangerous)-i)
+				break
+			}
+			c.logf("  %s, links: %d\n", u.URL, u.Links)
+		}
+	}
+	if changes := c.result.ModifiedSince; changes != nil {
+		c.logf("Changed since %s: %d modified, %d unchanged\n",
+			changes.Since.Format(time.DateOnly), changes.Modified, changes.Unchanged)
+		if changes.IgnoredConditional > 0 {
+			c.logf("Warning: %d pages were sent in full although their Last-Modified is not after %s; "+
+				"the server ignores If-Modified-Since and the modified count overstates changes\n",
+				changes.IgnoredConditional, changes.Since.Format(time.DateOnly))
+		}
+	}
+
+	if c.save {
+		filename, err := c.saveOutput()
+		if err != nil {
+			return nil, fmt.Errorf("error saving results: %v", err)
+		}
+		c.logf("Results saved to %s\n", filename)
+	}
+
+	c.resultLock.Lock()
+	defer c.resultLock.Unlock()
+	result := c.result
+	if !c.save {
+		pages, err := c.allPages()
+		if err != nil {
+			return nil, err
+		}
+		result.Pages = pages
+	}
+	return &result, nil
+}
+
+// crawlFrom crawls links and every page reachable from them within the
+// limits, concurrently or, in a deterministic crawl, in rounds.
+func (c *Crawler) crawlFrom(links []frontierLink) {
+	if c.deterministic {
+		c.crawlLevels(links)
+		return
+	}
+	var wg sync.WaitGroup
+	for _, link := range links {
+		wg.Add(1)
+		go c.crawl(link.url, link.depth, &wg)
+	}
+	wg.Wait()
+	// Redirects can make a page shallower after its last link was followed.
+	for c.hasRelinks() {
+		c.runRelinks(&wg)
+		wg.Wait()
+	}
+}
+
+// hasRelinks reports whether pages are queued for runRelinks.
+func (c *Crawler) hasRelinks() bool {
+	c.visitedLock.RLock()
+	defer c.visitedLock.RUnlock()
+	return len(c.relinks) > 0
+}
+
+// run crawls from the seed URL until every reachable page within the
+// limits is fetched or ctx is cancelled, then checks assets and finalizes
+// the results. It writes no output besides the log and the edges file.
+func (c *Crawler) run(ctx context.Context) error {
+	ctx = context.WithValue(ctx, budgetContextKey{}, c)
+	c.ctx = ctx
+	c.traceCtx = ctx
+	c.resultLock.Lock()
+	c.result.StartTime = time.Now()
+	c.outputTime = c.result.StartTime
+	c.counters.started.Store(c.result.StartTime.UnixNano())
+	c.resultLock.Unlock()
+	span := c.startCrawlSpan()
+
+	if c.sharedLimits != nil {
+		c.hostLimit = c.sharedLimits.acquire(normalizeHost(c.baseURL.Scheme, c.baseURL.Host))
+		defer c.sharedLimits.release(c.hostLimit)
+	}
+
+	if c.edgesPath != "" {
+		edges, err := newEdgeWriter(c.edgesPath)
+		if err != nil {
+			return err
+		}
+		c.edges = edges
+	}
+
+	if c.progressInterval > 0 {
+		done := make(chan struct{})
+		go c.reportProgress(c.progressInterval, done)
+		defer close(done)
+	}
+	c.logRateLimit()
+	c.logEstimate()
+	stopWarmup := c.startWarmup()
+	if c.budget.maxDuration > 0 {
+		done := make(chan struct{})
+		go c.watchProjection(done)
+		defer close(done)
+	}
+	seed := c.normalizeLink(c.baseURL)
+	if c.hygiene.enabled {
+		c.checkRobots()
+	}
+	var sitemapSeeds []sitemapSeed
+	if c.sitemapURL != "" {
+		sitemapSeeds = c.loadSitemap()
+		c.resultLock.Lock()
+		c.result.SitemapURLs = len(sitemapSeeds)
+		c.resultLock.Unlock()
+	}
+	var feedSeeds []sitemapSeed
+	if len(c.feedURLs) > 0 {
+		feedSeeds = c.loadFeeds()
+	}
+	for _, language := range c.passes() {
+		if len(c.languages) > 0 {
+			c.logf("Crawling pass with Accept-Language: %s\n", language)
+		}
+		c.startPass(language)
+
+		var start []frontierLink
+		if c.list != nil {
+			for _, pageURL := range c.list.urls {
+				c.markDiscovered(pageURL, 0, "")
+				start = append(start, frontierLink{url: pageURL})
+			}
+		} else {
+			c.markDiscovered(seed, 0, "")
+			start = append(start, frontierLink{url: seed})
+			for _, u := range c.hosts.seeds(c.baseURL) {
+				hostSeed := c.normalizeLink(u)
+				c.markDiscovered(hostSeed, 0, "")
+				start = append(start, frontierLink{url: hostSeed})
+			}
+		}
+		for _, s := range append(sitemapSeeds, feedSeeds...) {
+			c.markDiscovered(s.url, 0, s.sitemap)
+			start = append(start, frontierLink{url: s.url})
+		}
+		for _, link := range c.frontier {
+			if link.language == c.keyLanguage {
+				start = append(start, link)
+			}
+		}
+		c.crawlFrom(start)
+		c.retryFailures()
+	}
+	stopWarmup()
+
+	if c.shard.count > 0 {
+		if err := c.writeHandoff(); err != nil {
+			return err
+		}
+	}
+
+	if c.edges != nil {
+		if err := c.edges.close(); err != nil {
+			return err
+		}
+		c.logf("Edges saved to %s (%d edges)\n", c.edgesPath, c.edges.count)
+		if err := c.artifacts.addFile(ArtifactEdges, c.edgesPath, edgeFormat(c.edgesPath)); err != nil {
+			return err
+		}
+	}
+
+	if c.uaCompare.enabled && ctx.Err() == nil {
+		comparison := c.compareUserAgents()
+		c.resultLock.Lock()
+		c.result.UAComparison = comparison
+		c.resultLock.Unlock()
+		c.logf("Mobile User-Agent: %d of %d pages compared diverge\n", len(comparison.Divergent), comparison.Compared)
+	}
+	if c.assetCheck.enabled && ctx.Err() == nil {
+		check := c.checkAssets()
+		c.resultLock.Lock()
+		c.result.AssetCheck = check
+		c.resultLock.Unlock()
+		c.logf("Assets checked: %d of %d, broken: %d\n", check.Checked, check.UniqueAssets, len(check.Broken))
+	}
+	if c.recordDir != "" {
+		if err := c.artifacts.addDir(ArtifactRecordings, c.recordDir); err != nil {
+			return err
+		}
+	}
+
+	err := c.finalizeResults()
+	c.endCrawlSpan(span)
+	return err
+}
@@ -0,0 +1,83 @@
+package crawler_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"webcrawler/crawler"
+	"webcrawler/crawler/crawltest"
+)
+
+// TestCrawlSyntheticSites crawls synthetic sites at several depths and
+// settings and checks the invariants of crawltest: every page within the
+// depth limit is fetched once, nothing beyond it is, and every page is
+// stored at the depth of its shortest chain of links.
+func TestCrawlSyntheticSites(t *testing.T) {
+	sites := []crawltest.SiteConfig{
+		{Pages: 40, Seed: 1},
+		{Pages: 150, Branching: 4, CrossLinks: 2, Aliases: 10, Broken: 5, Duplicates: 5, Traps: 2, Offsite: 5, Seed: 2},
+		{Pages: 120, CrossLinks: 3, Aliases: 20, Duplicates: 10, ParamTraps: 2, Sitemap: 20, SitemapOffsite: 3, SitemapMalformed: 2, Seed: 3},
+	}
+	limits, err := crawler.NewLimitRegistry(crawltest.CrawlRPS, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := []struct {
+		name string
+		opts []crawler.Option
+	}{
+		{"default", nil},
+		{"deterministic", []crawler.Option{crawler.WithDeterministic(7)}},
+		{"one in flight", []crawler.Option{crawler.WithSharedLimits(limits)}},
+		{"spilled", []crawler.Option{crawler.WithResultLimit(10, 0)}},
+		{"param guard", []crawler.Option{crawler.WithMaxAddedParams(crawler.DefaultMaxAddedParams)}},
+		{"sitemap", []crawler.Option{crawler.WithSitemap("/sitemap.xml")}},
+		{"no final retry", []crawler.Option{crawler.WithFinalRetry(false), crawler.WithLinkScores(0, 0)}},
+	}
+	for i, config := range sites {
+		for _, depth := range []int{0, 1, 3, 6} {
+			for _, setting := range settings {
+				t.Run(fmt.Sprintf("site%d/depth%d/%s", i, depth, setting.name), func(t *testing.T) {
+					t.Parallel()
+					site := crawltest.NewSite(config)
+					defer site.Close()
+					result, err := crawltest.Crawl(context.Background(), site, depth, setting.opts...)
+					if err != nil {
+						t.Fatal(err)
+					}
+					crawltest.Verify(t, site, result)
+				})
+			}
+		}
+	}
+}
+
+// TestCrawlSyntheticSiteUnlimited crawls a site without traps to the end.
+func TestCrawlSyntheticSiteUnlimited(t *testing.T) {
+	site := crawltest.NewSite(crawltest.SiteConfig{Pages: 200, CrossLinks: 2, Aliases: 10, Broken: 5, Duplicates: 5, Seed: 4})
+	defer site.Close()
+	result, err := crawltest.Crawl(context.Background(), site, crawler.UnlimitedDepth, crawler.WithMaxPages(10000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawltest.Verify(t, site, result)
+	if result.TotalPages < 200 {
+		t.Errorf("stored %d pages, want at least the 200 content pages", result.TotalPages)
+	}
+}
+
+// TestCrawlSyntheticSiteStrict checks that a crawl of a site with every
+// kind of page keeps the invariants of the results.
+func TestCrawlSyntheticSiteStrict(t *testing.T) {
+	site := crawltest.NewSite(crawltest.SiteConfig{Pages: 150, Branching: 4, CrossLinks: 3, Aliases: 10, Broken: 5, Duplicates: 5, Traps: 2, ParamTraps: 2, Offsite: 5, Seed: 5})
+	defer site.Close()
+	result, err := crawltest.Crawl(context.Background(), site, 4, crawler.WithStrict(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawltest.Verify(t, site, result)
+	for _, v := range result.InvariantViolations {
+		t.Errorf("invariant violation: %s %s: %s", v.Invariant, v.URL, v.Detail)
+	}
+}
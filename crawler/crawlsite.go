@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Defaults applied by CrawlSite to zero Options fields.
+const (
+	DefaultSiteDepth   = 3
+	DefaultSiteRPS     = 2.0
+	DefaultSiteTimeout = 10 * time.Second
+)
+
+// Options configures CrawlSite. Zero values select the defaults.
+type Options struct {
+	// MaxDepth is the link depth crawled from the seed, DefaultSiteDepth
+	// when zero. UnlimitedDepth requires a budget like MaxPages.
+	MaxDepth int
+	// MaxPages stops the crawl after this many requests; zero is
+	// unlimited.
+	MaxPages int
+	// MaxDuration stops sending requests after this long; zero is
+	// unlimited.
+	MaxDuration time.Duration
+	// RequestsPerSecond is DefaultSiteRPS when zero.
+	RequestsPerSecond float64
+	// Timeout bounds a single request, DefaultSiteTimeout when zero.
+	Timeout time.Duration
+	// Contact identifies the operator, as with WithContact.
+	Contact string
+	// Include and Exclude filter links, as with WithURLFilters.
+	Include []string
+	Exclude []string
+}
+
+// CrawlSite crawls the same-domain pages reachable from siteURL and
+// returns them. It writes no files and logs nothing; pages that fail are
+// left out of the result. Each call has its own crawler, so concurrent
+// calls for different sites are independent.
+//
+// When ctx is cancelled the pages fetched so far are returned together
+// with ctx.Err().
+//
+//	pages, err := crawler.CrawlSite(ctx, "https://example.com", crawler.Options{MaxDepth: 2, MaxPages: 100})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	for _, page := range pages {
+//		fmt.Println(page.URL, page.Title)
+//	}
+func CrawlSite(ctx context.Context, siteURL string, opts Options) ([]PageData, error) {
+	depth := opts.MaxDepth
+	if depth == 0 {
+		depth = DefaultSiteDepth
+	}
+	rps := opts.RequestsPerSecond
+	if rps == 0 {
+		rps = DefaultSiteRPS
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultSiteTimeout
+	}
+
+	c, err := NewCrawler(siteURL, depth, rps,
+		WithLogOutput(io.Discard),
+		WithTimeout(timeout),
+		WithMaxPages(opts.MaxPages),
+		WithMaxDuration(opts.MaxDuration),
+		WithContact(opts.Contact),
+		WithURLFilters(opts.Include, opts.Exclude),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer c.closeSpill()
+	if err := c.run(ctx); err != nil {
+		return nil, err
+	}
+	pages, err := c.allPages()
+	if err != nil {
+		return nil, err
+	}
+	return pages, ctx.Err()
+}
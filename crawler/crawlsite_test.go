@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCrawlSiteConcurrent(t *testing.T) {
+	var sites []*testSite
+	for i := 0; i < 4; i++ {
+		sites = append(sites, newTestSite(t, map[string]http.HandlerFunc{
+			"/":     htmlPage(fmt.Sprintf(`<a href="/p">site %d</a> <a href="http://other.example/">off</a> <a href="/gone">gone</a>`, i)),
+			"/p":    htmlPage(`<a href="/deep">deep</a>`),
+			"/deep": htmlPage("deep"),
+		}))
+	}
+	var wg sync.WaitGroup
+	for _, site := range sites {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pages, err := CrawlSite(context.Background(), site.URL, Options{MaxDepth: 1, RequestsPerSecond: 1000})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			// Failed pages are left out, and so is everything off the site
+			// or beyond the depth.
+			if len(pages) != 2 {
+				t.Errorf("%s: got %d pages, want / and /p", site.URL, len(pages))
+			}
+			for _, page := range pages {
+				if page.URL != site.URL+"/" && page.URL != site.URL+"/p" {
+					t.Errorf("%s: unexpected page %s", site.URL, page.URL)
+				}
+			}
+			if site.requested("/deep") != 0 {
+				t.Errorf("%s: /deep beyond the depth was fetched", site.URL)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCrawlSiteMaxPages(t *testing.T) {
+	routes := map[string]http.HandlerFunc{}
+	links := ""
+	for i := 0; i < 20; i++ {
+		links += fmt.Sprintf(`<a href="/p%d">%d</a> `, i, i)
+		routes[fmt.Sprintf("/p%d", i)] = htmlPage("page")
+	}
+	routes["/"] = htmlPage(links)
+	site := newTestSite(t, routes)
+	pages, err := CrawlSite(context.Background(), site.URL, Options{MaxPages: 5, RequestsPerSecond: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 5 {
+		t.Errorf("got %d pages, want 5", len(pages))
+	}
+}
+
+// TestCrawlSiteCancel checks that a cancelled crawl returns the pages
+// fetched so far with the error of the context.
+func TestCrawlSiteCancel(t *testing.T) {
+	release := make(chan struct{})
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/": htmlPage(`<a href="/slow">slow</a>`),
+		"/slow": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		},
+	})
+	defer close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	pages, err := CrawlSite(ctx, site.URL, Options{RequestsPerSecond: 1000})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, want the deadline", err)
+	}
+	if len(pages) != 1 || pages[0].URL != site.URL+"/" {
+		t.Errorf("got %+v, want the seed page", pages)
+	}
+}
@@ -0,0 +1,167 @@
+package crawltest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+
+	"webcrawler/crawler"
+)
+
+// CrawlRPS is the request rate of Crawl, high enough not to slow a test
+// down.
+const CrawlRPS = 1000
+
+// Invariants a Violation can break.
+const (
+	// InvariantFetchedOnce: the site answered more than one request for
+	// the path.
+	InvariantFetchedOnce = "fetched-once"
+	// InvariantNotFetched: the path is within the depth limit but was not
+	// requested.
+	InvariantNotFetched = "not-fetched"
+	// InvariantUnexpected: the path was requested although no chain of
+	// links within the depth limit leads to it.
+	InvariantUnexpected = "unexpected"
+	// InvariantNotStored: the path was requested but no page or error of
+	// the result records it.
+	InvariantNotStored = "not-stored"
+	// InvariantDepth: a page or error is stored with another depth than
+	// its shortest chain of links.
+	InvariantDepth = "depth"
+	// InvariantOffScope: the crawl requested a page of the other host.
+	InvariantOffScope = "off-scope"
+)
+
+// Violation is a broken invariant of a crawl.
+type Violation struct {
+	Invariant string
+	Path      string
+	Detail    string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s %s: %s", v.Invariant, v.Path, v.Detail)
+}
+
+// untracked are the paths crawls may request besides the links, when the
+// site hygiene check or a sitemap is enabled.
+var untracked = map[string]bool{
+	"/robots.txt":  true,
+	"/sitemap.xml": true,
+}
+
+// Crawl crawls site to maxDepth with opts, which follow the defaults of
+// the harness: no log and CrawlRPS requests per second.
+func Crawl(ctx context.Context, site *Site, maxDepth int, opts ...crawler.Option) (*crawler.CrawlResult, error) {
+	c, err := crawler.NewCrawler(site.URL, maxDepth, CrawlRPS,
+		append([]crawler.Option{crawler.WithLogOutput(io.Discard)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return c.Start(ctx)
+}
+
+// resultPath returns the path of a URL of the result with its query, "/"
+// for the home page.
+func resultPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+	return requestPath(u)
+}
+
+// Check compares the requests site answered with result, the crawl that
+// sent them, and returns the invariants it broke, by path. It assumes the
+// site served only that crawl, and an unfiltered one: include and exclude
+// patterns, a path depth limit or a listed crawl leave out pages that are
+// then reported as not fetched. A crawl a budget stopped early is not
+// checked for the pages it did not fetch. With WithMaxAddedParams, the
+// pages of the query parameter traps are expected up to the first that
+// adds more parameters than the limit to the first page of their trap.
+func Check(site *Site, result *crawler.CrawlResult) []Violation {
+	var violations []Violation
+	add := func(invariant, path, format string, args ...any) {
+		violations = append(violations, Violation{Invariant: invariant, Path: path, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	expected := site.Expected(result.MaxDepth, result.Config != nil && result.Config.Sitemap != "")
+	if result.Config != nil && result.Config.MaxAddedParams > 0 {
+		for path := range expected {
+			if _, k := site.paramTrap(path); k-1 > result.Config.MaxAddedParams {
+				delete(expected, path)
+			}
+		}
+	}
+	requests := site.Requests()
+	for path, n := range requests {
+		if untracked[path] {
+			continue
+		}
+		if n > 1 {
+			add(InvariantFetchedOnce, path, "requested %d times", n)
+		}
+		if _, ok := expected[path]; !ok {
+			add(InvariantUnexpected, path, "not linked within depth %d", result.MaxDepth)
+		}
+	}
+	if result.StopReason == "" {
+		for path, depth := range expected {
+			if requests[path] == 0 {
+				add(InvariantNotFetched, path, "linked at depth %d", depth)
+			}
+		}
+	}
+
+	stored := make(map[string]bool)
+	checkDepth := func(rawURL string, depth int) {
+		path := resultPath(rawURL)
+		stored[path] = true
+		if want, ok := expected[path]; ok && depth != want {
+			add(InvariantDepth, path, "stored at depth %d, linked at depth %d", depth, want)
+		}
+	}
+	for _, page := range result.Pages {
+		checkDepth(page.URL, page.Depth)
+		if page.FinalURL != "" {
+			stored[resultPath(page.FinalURL)] = true
+		}
+	}
+	for _, e := range result.Errors {
+		checkDepth(e.URL, e.Depth)
+	}
+	for path := range requests {
+		if !untracked[path] && !stored[path] {
+			add(InvariantNotStored, path, "no page or error records it")
+		}
+	}
+
+	for _, path := range site.OffsiteRequests() {
+		add(InvariantOffScope, site.OffsiteURL+path[1:], "requested from another host")
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		if violations[i].Path != violations[j].Path {
+			return violations[i].Path < violations[j].Path
+		}
+		return violations[i].Invariant < violations[j].Invariant
+	})
+	return violations
+}
+
+// TB is the part of testing.TB Verify uses.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Verify reports every invariant result broke as an error of t.
+func Verify(t TB, site *Site, result *crawler.CrawlResult) {
+	t.Helper()
+	for _, v := range Check(site, result) {
+		t.Errorf("crawltest: %s", v)
+	}
+}
@@ -0,0 +1,394 @@
+// Package crawltest serves deterministic synthetic sites and checks the
+// invariants of a crawl of them, for the tests of the crawler and of the
+// programs that embed it:
+//
+//	site := crawltest.NewSite(crawltest.SiteConfig{Pages: 200, Aliases: 10, Broken: 5, Traps: 2})
+//	defer site.Close()
+//	result, err := crawltest.Crawl(ctx, site, 3)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	crawltest.Verify(t, site, result)
+//
+// A site is a tree of pages with extra links to redirect aliases, broken
+// links, pages duplicating others, endless calendar traps and another
+// host, and optionally a sitemap. The same SiteConfig always builds the
+// same site, and the site records every request it answers, so a check
+// knows exactly which URLs a crawl to a given depth must fetch.
+package crawltest
+
+import (
+	"fmt"
+	"html"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Defaults applied by NewSite to zero SiteConfig fields.
+const (
+	DefaultPages     = 50
+	DefaultBranching = 3
+)
+
+// SiteConfig describes a synthetic site. Zero values select the defaults
+// or leave the feature out.
+type SiteConfig struct {
+	// Pages is the number of content pages: the home page at / and
+	// /page/1 to /page/Pages-1. DefaultPages when zero.
+	Pages int
+	// Branching is the number of child pages every page links to, which
+	// makes the pages a tree of that degree. DefaultBranching when zero.
+	Branching int
+	// CrossLinks adds links from every page to as many random pages.
+	CrossLinks int
+	// Aliases adds /alias/N URLs answering a 301 redirect to a random
+	// page, each linked from a random page.
+	Aliases int
+	// Broken adds links to /missing/N URLs answering 404.
+	Broken int
+	// Duplicates adds /copy/N URLs serving the same HTML as a random
+	// page, each linked from a random page.
+	Duplicates int
+	// Traps adds calendar traps, each linked from a random page: every
+	// page /trap/N/K links to /trap/N/K+1, endlessly.
+	Traps int
+	// ParamTraps adds query parameter traps, each linked from a random
+	// page: every page /filter/N?f=1&...&f=K links to its own URL with
+	// &f=K+1 appended, endlessly.
+	ParamTraps int
+	// Offsite adds links to pages of another host, which a crawl must not
+	// request.
+	Offsite int
+	// Sitemap lists as many random pages in /sitemap.xml, read by crawls
+	// with WithSitemap, together with SitemapOffsite entries on the other
+	// host and SitemapMalformed entries that are not http URLs.
+	Sitemap          int
+	SitemapOffsite   int
+	SitemapMalformed int
+	// Seed selects the random choices; the same seed builds the same site.
+	Seed uint64
+}
+
+// sitePage is a generated URL of a site.
+type sitePage struct {
+	title    string
+	links    []string
+	redirect string
+	// copyOf is the path whose HTML a duplicate serves.
+	copyOf string
+}
+
+// Site is a synthetic site served by an httptest.Server. It is safe for
+// concurrent use.
+type Site struct {
+	// URL is the home page of the site, and OffsiteURL that of the other
+	// host its offsite links lead to.
+	URL        string
+	OffsiteURL string
+
+	config  SiteConfig
+	pages   map[string]*sitePage
+	sitemap []string
+	server  *httptest.Server
+	offsite *httptest.Server
+
+	lock     sync.Mutex
+	requests map[string]int
+	offsites []string
+}
+
+// NewSite builds the site described by config and starts serving it. Call
+// Close when done.
+func NewSite(config SiteConfig) *Site {
+	if config.Pages <= 0 {
+		config.Pages = DefaultPages
+	}
+	if config.Branching <= 0 {
+		config.Branching = DefaultBranching
+	}
+	s := &Site{config: config, requests: make(map[string]int)}
+	s.offsite = httptest.NewServer(http.HandlerFunc(s.serveOffsite))
+	s.OffsiteURL = s.offsite.URL + "/"
+	s.generate()
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = s.server.URL + "/"
+	return s
+}
+
+// pagePath returns the path of content page i.
+func pagePath(i int) string {
+	if i == 0 {
+		return "/"
+	}
+	return "/page/" + strconv.Itoa(i)
+}
+
+// trapPath returns the path of page k of calendar trap n.
+func trapPath(n, k int) string {
+	return fmt.Sprintf("/trap/%d/%d", n, k)
+}
+
+// paramTrapPath returns the path and query of page k of query parameter
+// trap n, which has k parameters.
+func paramTrapPath(n, k int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "/filter/%d?f=1", n)
+	for i := 2; i <= k; i++ {
+		fmt.Fprintf(&b, "&f=%d", i)
+	}
+	return b.String()
+}
+
+// requestPath returns the path of a request, with its query if it has
+// one, as the pages of a site are keyed.
+func requestPath(u *url.URL) string {
+	if u.RawQuery != "" {
+		return u.Path + "?" + u.RawQuery
+	}
+	return u.Path
+}
+
+// generate builds the pages of the site from its config.
+func (s *Site) generate() {
+	cfg := s.config
+	rng := rand.New(rand.NewPCG(cfg.Seed, cfg.Seed))
+	s.pages = make(map[string]*sitePage)
+	content := make([]*sitePage, cfg.Pages)
+	for i := range content {
+		page := &sitePage{title: fmt.Sprintf("Page %d", i)}
+		for child := i*cfg.Branching + 1; child <= i*cfg.Branching+cfg.Branching && child < cfg.Pages; child++ {
+			page.links = append(page.links, pagePath(child))
+		}
+		for range cfg.CrossLinks {
+			page.links = append(page.links, pagePath(rng.IntN(cfg.Pages)))
+		}
+		content[i] = page
+		s.pages[pagePath(i)] = page
+	}
+	linkFrom := func(target string) {
+		page := content[rng.IntN(cfg.Pages)]
+		page.links = append(page.links, target)
+	}
+	for n := range cfg.Aliases {
+		path := "/alias/" + strconv.Itoa(n)
+		s.pages[path] = &sitePage{redirect: pagePath(rng.IntN(cfg.Pages))}
+		linkFrom(path)
+	}
+	for n := range cfg.Broken {
+		linkFrom("/missing/" + strconv.Itoa(n))
+	}
+	for n := range cfg.Duplicates {
+		path := "/copy/" + strconv.Itoa(n)
+		s.pages[path] = &sitePage{copyOf: pagePath(rng.IntN(cfg.Pages))}
+		linkFrom(path)
+	}
+	for n := range cfg.Traps {
+		linkFrom(trapPath(n, 1))
+	}
+	for n := range cfg.ParamTraps {
+		linkFrom(paramTrapPath(n, 1))
+	}
+	for n := range cfg.Offsite {
+		linkFrom(s.OffsiteURL + "page/" + strconv.Itoa(n))
+	}
+	for range cfg.Sitemap {
+		s.sitemap = append(s.sitemap, pagePath(rng.IntN(cfg.Pages)))
+	}
+	for n := range cfg.SitemapOffsite {
+		s.sitemap = append(s.sitemap, s.OffsiteURL+"listed/"+strconv.Itoa(n))
+	}
+	for n := range cfg.SitemapMalformed {
+		malformed := []string{"mailto:listed%d@example.com", "ftp://files.example.com/%d", "http://[bad host %d/"}
+		s.sitemap = append(s.sitemap, fmt.Sprintf(malformed[n%len(malformed)], n))
+	}
+}
+
+// page returns the generated page at path, with its query, or nil for a
+// missing one. Trap pages are generated on demand.
+func (s *Site) page(path string) *sitePage {
+	if page := s.pages[path]; page != nil {
+		return page
+	}
+	var n, k int
+	if _, err := fmt.Sscanf(path, "/trap/%d/%d", &n, &k); err == nil && n >= 0 && n < s.config.Traps && k >= 1 && path == trapPath(n, k) {
+		return &sitePage{title: fmt.Sprintf("Calendar %d, day %d", n, k), links: []string{trapPath(n, k+1)}}
+	}
+	if n, k := s.paramTrap(path); k > 0 {
+		return &sitePage{title: fmt.Sprintf("Filter %d, %d parameters", n, k), links: []string{paramTrapPath(n, k+1)}}
+	}
+	return nil
+}
+
+// paramTrap returns the trap and the number of parameters of a page of a
+// query parameter trap, and 0 parameters for other paths.
+func (s *Site) paramTrap(path string) (n, k int) {
+	if _, err := fmt.Sscanf(path, "/filter/%d?", &n); err != nil || n < 0 || n >= s.config.ParamTraps {
+		return 0, 0
+	}
+	k = strings.Count(path, "&") + 1
+	if path != paramTrapPath(n, k) {
+		return 0, 0
+	}
+	return n, k
+}
+
+// links returns the links of the page at path, following a duplicate to
+// the page it copies; a redirect alias has none.
+func (s *Site) links(path string) []string {
+	page := s.page(path)
+	if page == nil {
+		return nil
+	}
+	if page.copyOf != "" {
+		return s.pages[page.copyOf].links
+	}
+	return page.links
+}
+
+func (s *Site) serve(w http.ResponseWriter, r *http.Request) {
+	path := requestPath(r.URL)
+	s.lock.Lock()
+	s.requests[path]++
+	s.lock.Unlock()
+
+	if path == "/sitemap.xml" && len(s.sitemap) > 0 {
+		s.serveSitemap(w)
+		return
+	}
+	page := s.page(path)
+	switch {
+	case page == nil:
+		http.NotFound(w, r)
+		return
+	case page.redirect != "":
+		http.Redirect(w, r, page.redirect, http.StatusMovedPermanently)
+		return
+	case page.copyOf != "":
+		page = s.pages[page.copyOf]
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	var b strings.Builder
+	title := html.EscapeString(page.title)
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html><head><title>%s</title></head><body>\n<h1>%s</h1>\n", title, title)
+	fmt.Fprintf(&b, "<p>This is %s of a synthetic site.</p>\n<ul>\n", title)
+	for _, link := range page.links {
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(link), html.EscapeString(link))
+	}
+	b.WriteString("</ul>\n</body></html>\n")
+	fmt.Fprint(w, b.String())
+}
+
+// serveSitemap lists the sitemap entries, site paths as absolute URLs.
+func (s *Site) serveSitemap(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/xml")
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n")
+	for _, entry := range s.sitemap {
+		if strings.HasPrefix(entry, "/") {
+			entry = strings.TrimSuffix(s.URL, "/") + entry
+		}
+		fmt.Fprintf(&b, "<url><loc>%s</loc></url>\n", html.EscapeString(entry))
+	}
+	b.WriteString("</urlset>\n")
+	fmt.Fprint(w, b.String())
+}
+
+func (s *Site) serveOffsite(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	s.offsites = append(s.offsites, r.URL.Path)
+	s.lock.Unlock()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, "<!DOCTYPE html>\n<html><head><title>Offsite</title></head><body></body></html>\n")
+}
+
+// Close stops serving the site.
+func (s *Site) Close() {
+	s.server.Close()
+	s.offsite.Close()
+}
+
+// Requests returns the number of requests the site answered per path,
+// with the query of those having one, including those for missing paths.
+func (s *Site) Requests() map[string]int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	requests := make(map[string]int, len(s.requests))
+	for path, n := range s.requests {
+		requests[path] = n
+	}
+	return requests
+}
+
+// OffsiteRequests returns the paths requested from the other host, in
+// order.
+func (s *Site) OffsiteRequests() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.offsites...)
+}
+
+// Reset forgets the requests answered so far, so the site can serve
+// another crawl.
+func (s *Site) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = make(map[string]int)
+	s.offsites = nil
+}
+
+// Expected returns the depth of every path a crawl to maxDepth from the
+// home page requests: the length of the shortest chain of links to it,
+// from the pages of the sitemap too when the crawl reads it. A redirect
+// does not add to the depth, so the target of an alias is at most as deep
+// as the alias. maxDepth must not be unlimited when the site has traps.
+func (s *Site) Expected(maxDepth int, sitemap bool) map[string]int {
+	if maxDepth < 0 && s.config.Traps+s.config.ParamTraps > 0 {
+		panic("crawltest: a site with traps has no expected paths at unlimited depth")
+	}
+	depths := map[string]int{"/": 0}
+	level := []string{"/"}
+	if sitemap {
+		for _, entry := range s.sitemap {
+			if _, ok := depths[entry]; !ok && strings.HasPrefix(entry, "/") {
+				depths[entry] = 0
+				level = append(level, entry)
+			}
+		}
+		sort.Strings(level)
+	}
+	for depth := 0; len(level) > 0; depth++ {
+		// Redirects add their targets to the same level.
+		for i := 0; i < len(level); i++ {
+			if page := s.page(level[i]); page != nil && page.redirect != "" {
+				if _, ok := depths[page.redirect]; !ok {
+					depths[page.redirect] = depth
+					level = append(level, page.redirect)
+				}
+			}
+		}
+		if depth == maxDepth {
+			break
+		}
+		var next []string
+		for _, path := range level {
+			for _, link := range s.links(path) {
+				if !strings.HasPrefix(link, "/") {
+					continue
+				}
+				if _, ok := depths[link]; !ok {
+					depths[link] = depth + 1
+					next = append(next, link)
+				}
+			}
+		}
+		sort.Strings(next)
+		level = next
+	}
+	return depths
+}
@@ -0,0 +1,148 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// EdgeDangerous marks links to URLs that look like actions, such as a
+// logout or an add-to-cart link, which are never requested.
+const EdgeDangerous = "dangerous-url"
+
+// maxDangerousSources bounds the pages listed in DangerousURL.LinkedFrom.
+const maxDangerousSources = 10
+
+// DefaultDangerousPatterns are the patterns of URLs the crawler refuses to
+// request unless WithAllowDangerous is given: URLs that look like actions
+// with side effects, which a badly built site may perform on a plain GET.
+// They are matched against normalized URLs.
+var DefaultDangerousPatterns = []string{
+	`(?i)/(log-?out|log-?off|sign-?out)(/|\?|$)`,
+	`(?i)/(delete|remove|destroy)(/|\?|$)`,
+	`(?i)/(add-?to-?cart|cart/add)(/|\?|$)`,
+	`(?i)/unsubscribe(/|\?|$)`,
+	`(?i)[?&](action|add-to-cart)=`,
+}
+
+// WithDangerousPatterns replaces DefaultDangerousPatterns with patterns,
+// regular expressions matched against normalized URLs. An empty list
+// keeps the defaults.
+func WithDangerousPatterns(patterns []string) Option {
+	return func(c *Crawler) {
+		c.dangerousPatterns = patterns
+	}
+}
+
+// WithAllowDangerous requests URLs matching the dangerous patterns like
+// any other URL.
+func WithAllowDangerous() Option {
+	return func(c *Crawler) {
+		c.allowDangerous = true
+	}
+}
+
+// DangerousURL is a URL that was not requested because it matched a
+// dangerous pattern. Links counts the links to it and LinkedFrom lists up
+// to ten of the pages or sitemaps they were found on.
+type DangerousURL struct {
+	URL        string   `json:"url"`
+	Pattern    string   `json:"pattern"`
+	Links      int      `json:"links"`
+	LinkedFrom []string `json:"linked_from,omitempty"`
+}
+
+type dangerousTracker struct {
+	lock sync.Mutex
+	urls map[string]*DangerousURL
+}
+
+// compileDangerous compiles the dangerous patterns of the crawl, none when
+// dangerous URLs are allowed.
+func (c *Crawler) compileDangerous() error {
+	if c.allowDangerous {
+		return nil
+	}
+	patterns := c.dangerousPatterns
+	if len(patterns) == 0 {
+		patterns = DefaultDangerousPatterns
+	}
+	var err error
+	c.dangerous, err = CompilePatterns(patterns)
+	return err
+}
+
+// dangerousPattern returns the dangerous pattern pageURL matches, or ""
+// if it matches none.
+func (c *Crawler) dangerousPattern(pageURL string) string {
+	for _, re := range c.dangerous {
+		if re.MatchString(pageURL) {
+			return re.String()
+		}
+	}
+	return ""
+}
+
+// noteDangerous records a link from source to target, a URL matching
+// pattern.
+func (c *Crawler) noteDangerous(target, pattern, source string) {
+	c.dangerousURLs.lock.Lock()
+	defer c.dangerousURLs.lock.Unlock()
+	if _, ok := c.dangerousURLs.urls[target]; !ok {
+		c.logf("Skipping dangerous URL %s (matches %s), linked from %s\n", target, pattern, source)
+	}
+	c.dangerousURLs.add(DangerousURL{URL: target, Pattern: pattern, Links: 1, LinkedFrom: []string{source}})
+}
+
+// add merges found into the dangerous URLs. lock must be held.
+func (t *dangerousTracker) add(found DangerousURL) {
+	if t.urls == nil {
+		t.urls = make(map[string]*DangerousURL)
+	}
+	known, ok := t.urls[found.URL]
+	if !ok {
+		known = &DangerousURL{URL: found.URL, Pattern: found.Pattern}
+		t.urls[found.URL] = known
+	}
+	known.Links += found.Links
+	for _, source := range found.LinkedFrom {
+		if len(known.LinkedFrom) < maxDangerousSources && !slices.Contains(known.LinkedFrom, source) {
+			known.LinkedFrom = append(known.LinkedFrom, source)
+		}
+	}
+}
+
+// restoreDangerous adds the dangerous URLs of an earlier crawl.
+func (c *Crawler) restoreDangerous(urls []DangerousURL) {
+	c.dangerousURLs.lock.Lock()
+	defer c.dangerousURLs.lock.Unlock()
+	for _, u := range urls {
+		c.dangerousURLs.add(u)
+	}
+}
+
+// dangerousList returns the dangerous URLs found, by URL.
+func (c *Crawler) dangerousList() []DangerousURL {
+	c.dangerousURLs.lock.Lock()
+	defer c.dangerousURLs.lock.Unlock()
+	var list []DangerousURL
+	for _, u := range c.dangerousURLs.urls {
+		list = append(list, *u)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].URL < list[j].URL })
+	return list
+}
+
+// dangerGuard refuses every request to a URL matching a dangerous pattern,
+// whatever sent it: a page fetch, a redirect hop, a HEAD probe or an asset
+// check.
+func (c *Crawler) dangerGuard(next Fetcher) Fetcher {
+	return fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		if pattern := c.dangerousPattern(NormalizeURL(req.URL)); pattern != "" {
+			return nil, fmt.Errorf("%w: %s matches %s", ErrDangerousURL, req.URL, pattern)
+		}
+		return next.RoundTrip(req)
+	})
+}
@@ -0,0 +1,259 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Sources of the PublishedAt and ModifiedAt dates of a page, in the order
+// they are preferred when they disagree.
+const (
+	// DateSourceJSONLD: datePublished or dateModified of a JSON-LD object.
+	DateSourceJSONLD = "json-ld"
+	// DateSourceMeta: an article:published_time, article:modified_time or
+	// og:updated_time meta tag.
+	DateSourceMeta = "meta"
+	// DateSourceTime: the datetime attribute of a <time> element.
+	DateSourceTime = "time"
+)
+
+// DefaultDateThreshold is how far the date a page states may be from its
+// Last-Modified header before FindDateMismatches reports it.
+const DefaultDateThreshold = 30 * 24 * time.Hour
+
+// contentDateLayouts are the formats tried, in order, on a date found in
+// a page. Fractional seconds are accepted after the seconds of any of them
+// and dates without a zone are taken as UTC.
+var contentDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 Z0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.DateOnly,
+	"2006-1-2",
+	"2006/01/02",
+	"2006/01/02 15:04:05",
+	"20060102",
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	time.RFC850,
+	time.ANSIC,
+	time.UnixDate,
+	"January 2, 2006 15:04",
+	"January 2, 2006",
+	"January 2 2006",
+	"Jan 2, 2006",
+	"Jan 2 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+	"02.01.2006",
+}
+
+// parseContentDate parses a date found in a page with the first of
+// contentDateLayouts that fits, or as Unix seconds or milliseconds, which
+// og:updated_time often holds. Years before 1900 or after 2200 are
+// placeholders, such as 0001-01-01, and rejected.
+func parseContentDate(value string) (time.Time, bool) {
+	value = strings.Join(strings.Fields(value), " ")
+	if value == "" {
+		return time.Time{}, false
+	}
+	plausible := func(t time.Time) (time.Time, bool) {
+		if t.Year() < 1900 || t.Year() > 2200 {
+			return time.Time{}, false
+		}
+		return t, true
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil && (len(value) == 10 || len(value) == 13) {
+		if len(value) == 13 {
+			return plausible(time.UnixMilli(n).UTC())
+		}
+		return plausible(time.Unix(n, 0).UTC())
+	}
+	for _, layout := range contentDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return plausible(t)
+		}
+	}
+	return time.Time{}, false
+}
+
+// contentDate is a date a page states, normalized to RFC 3339, and the
+// source it came from.
+type contentDate struct {
+	at     string
+	source string
+}
+
+// prefer keeps d unless it is empty and value parses, so the first source
+// to supply a date wins.
+func (d *contentDate) prefer(value, source string) {
+	if d.at != "" {
+		return
+	}
+	if t, ok := parseContentDate(value); ok {
+		d.at, d.source = t.Format(time.RFC3339), source
+	}
+}
+
+// extractContentDates returns the publication and modification dates doc
+// states, from JSON-LD, then meta tags, then <time> elements.
+func extractContentDates(doc *goquery.Document) (published, modified contentDate) {
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]any:
+			if s, ok := v["datePublished"].(string); ok {
+				published.prefer(s, DateSourceJSONLD)
+			}
+			if s, ok := v["dateModified"].(string); ok {
+				modified.prefer(s, DateSourceJSONLD)
+			}
+			walk(v["@graph"])
+		}
+	}
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		var v any
+		if json.Unmarshal([]byte(s.Text()), &v) == nil {
+			walk(v)
+		}
+	})
+
+	doc.Find("meta[property], meta[name]").Each(func(_ int, s *goquery.Selection) {
+		name, ok := s.Attr("property")
+		if !ok {
+			name = s.AttrOr("name", "")
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "article:published_time":
+			published.prefer(s.AttrOr("content", ""), DateSourceMeta)
+		case "article:modified_time", "og:updated_time":
+			modified.prefer(s.AttrOr("content", ""), DateSourceMeta)
+		}
+	})
+
+	// A <time> element is a modification date when marked as one, and a
+	// publication date otherwise.
+	doc.Find("time").Each(func(_ int, s *goquery.Selection) {
+		value, ok := s.Attr("datetime")
+		if !ok {
+			value = s.Text()
+		}
+		itemprop := s.AttrOr("itemprop", "")
+		class := strings.ToLower(s.AttrOr("class", ""))
+		switch {
+		case itemprop == "dateModified" || strings.Contains(class, "updated") || strings.Contains(class, "modified"):
+			modified.prefer(value, DateSourceTime)
+		case itemprop == "datePublished" || ok:
+			published.prefer(value, DateSourceTime)
+		}
+	})
+	return published, modified
+}
+
+// contentDateOf returns the date page states about its content: the
+// modification date, or the publication date without one.
+func contentDateOf(page *PageData) (time.Time, string, bool) {
+	value, source := page.ModifiedAt, page.ModifiedSource
+	if value == "" {
+		value, source = page.PublishedAt, page.PublishedSource
+	}
+	if value == "" {
+		return time.Time{}, "", false
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, source, err == nil
+}
+
+// OldestContent returns up to n pages that state a date, the oldest by
+// modification date, or publication date without one, first.
+func OldestContent(pages []PageData, n int) []PageData {
+	type dated struct {
+		page PageData
+		at   time.Time
+	}
+	var found []dated
+	for _, page := range pages {
+		if page.Alias {
+			continue
+		}
+		if at, _, ok := contentDateOf(&page); ok {
+			found = append(found, dated{page, at})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].at.Before(found[j].at) })
+	if len(found) > n {
+		found = found[:n]
+	}
+	oldest := make([]PageData, len(found))
+	for i, d := range found {
+		oldest[i] = d.page
+	}
+	return oldest
+}
+
+// DateMismatch is a page whose stated date is further than a threshold
+// from its Last-Modified header. Difference is positive when the header
+// is the later one.
+type DateMismatch struct {
+	URL          string        `json:"url"`
+	OnPage       string        `json:"on_page"`
+	Source       string        `json:"source"`
+	LastModified string        `json:"last_modified"`
+	Difference   time.Duration `json:"difference"`
+}
+
+// FindDateMismatches returns the pages whose modification date, or
+// publication date without one, differs from their Last-Modified header by
+// more than threshold, the largest differences first. Pages rendered on
+// every request send the time of the request as Last-Modified, so a site
+// where every page disagrees tells more about its server than its content.
+func FindDateMismatches(pages []PageData, threshold time.Duration) []DateMismatch {
+	var mismatches []DateMismatch
+	for _, page := range pages {
+		if page.Alias || page.LastModified == "" {
+			continue
+		}
+		at, source, ok := contentDateOf(&page)
+		if !ok {
+			continue
+		}
+		lastModified, err := http.ParseTime(page.LastModified)
+		if err != nil {
+			continue
+		}
+		difference := lastModified.Sub(at)
+		if difference.Abs() <= threshold {
+			continue
+		}
+		mismatches = append(mismatches, DateMismatch{
+			URL:          page.URL,
+			OnPage:       at.Format(time.RFC3339),
+			Source:       source,
+			LastModified: page.LastModified,
+			Difference:   difference,
+		})
+	}
+	sort.SliceStable(mismatches, func(i, j int) bool {
+		return mismatches[i].Difference.Abs() > mismatches[j].Difference.Abs()
+	})
+	return mismatches
+}
@@ -0,0 +1,152 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestParseContentDate(t *testing.T) {
+	tests := map[string]string{
+		"2026-03-04T05:06:07+02:00":         "2026-03-04T05:06:07+02:00",
+		"2026-03-04T05:06:07.123Z":          "2026-03-04T05:06:07Z",
+		"2026-03-04T05:06:07+0200":          "2026-03-04T05:06:07+02:00",
+		"2026-03-04T05:06+02:00":            "2026-03-04T05:06:00+02:00",
+		"2026-03-04T05:06:07":               "2026-03-04T05:06:07Z",
+		"2026-03-04T05:06:07.5":             "2026-03-04T05:06:07Z",
+		"2026-03-04T05:06":                  "2026-03-04T05:06:00Z",
+		"2026-03-04 05:06:07-05:00":         "2026-03-04T05:06:07-05:00",
+		"2026-03-04 05:06:07 +0200":         "2026-03-04T05:06:07+02:00",
+		"2026-03-04 05:06:07 UTC":           "2026-03-04T05:06:07Z",
+		"2026-03-04 05:06:07":               "2026-03-04T05:06:07Z",
+		"2026-03-04 05:06":                  "2026-03-04T05:06:00Z",
+		"2026-03-04":                        "2026-03-04T00:00:00Z",
+		"2026-3-4":                          "2026-03-04T00:00:00Z",
+		"2026/03/04":                        "2026-03-04T00:00:00Z",
+		"2026/03/04 05:06:07":               "2026-03-04T05:06:07Z",
+		"20260304":                          "2026-03-04T00:00:00Z",
+		"Wed, 04 Mar 2026 05:06:07 +0200":   "2026-03-04T05:06:07+02:00",
+		"Wed, 04 Mar 2026 05:06:07 UTC":     "2026-03-04T05:06:07Z",
+		"Wed, 4 Mar 2026 05:06:07 -0700":    "2026-03-04T05:06:07-07:00",
+		"Wed, 4 Mar 2026 05:06:07 UTC":      "2026-03-04T05:06:07Z",
+		"Wednesday, 04-Mar-26 05:06:07 UTC": "2026-03-04T05:06:07Z",
+		"Wed Mar  4 05:06:07 2026":          "2026-03-04T05:06:07Z",
+		"Wed Mar 4 05:06:07 UTC 2026":       "2026-03-04T05:06:07Z",
+		"March 4, 2026 05:06":               "2026-03-04T05:06:00Z",
+		"March 4, 2026":                     "2026-03-04T00:00:00Z",
+		"March 4 2026":                      "2026-03-04T00:00:00Z",
+		"Mar 4, 2026":                       "2026-03-04T00:00:00Z",
+		"Mar 4 2026":                        "2026-03-04T00:00:00Z",
+		"4 March 2026":                      "2026-03-04T00:00:00Z",
+		"4 Mar 2026":                        "2026-03-04T00:00:00Z",
+		"04.03.2026":                        "2026-03-04T00:00:00Z",
+		"  March\n 4,   2026 ":              "2026-03-04T00:00:00Z",
+		// Unix seconds and milliseconds.
+		"1772600767":    "2026-03-04T05:06:07Z",
+		"1772600767123": "2026-03-04T05:06:07Z",
+		// Placeholders and what is no date.
+		"":                     "",
+		"0001-01-01T00:00:00Z": "",
+		"1899-12-31":           "",
+		"2201-01-01":           "",
+		"9999999999999":        "",
+		"177260076":            "",
+		"04/03/2026":           "",
+		"yesterday":            "",
+		"2026-13-01":           "",
+	}
+	for value, want := range tests {
+		got := ""
+		if at, ok := parseContentDate(value); ok {
+			got = at.Format(time.RFC3339)
+		}
+		if got != want {
+			t.Errorf("parseContentDate(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestExtractContentDates(t *testing.T) {
+	const (
+		jsonLD = `<script type="application/ld+json">{"@type":"Article","datePublished":"2024-01-01","dateModified":"2024-02-01"}</script>`
+		meta   = `<meta property="article:published_time" content="2025-01-01"><meta property="article:modified_time" content="2025-02-01">`
+		times  = `<time datetime="2026-01-01">Jan 1</time> <time class="Updated" datetime="2026-02-01">Feb 1</time>`
+	)
+	tests := []struct {
+		name, html                                           string
+		published, publishedSource, modified, modifiedSource string
+	}{
+		{"JSON-LD first", times + meta + jsonLD, "2024-01-01T00:00:00Z", DateSourceJSONLD, "2024-02-01T00:00:00Z", DateSourceJSONLD},
+		{"meta before time", times + meta, "2025-01-01T00:00:00Z", DateSourceMeta, "2025-02-01T00:00:00Z", DateSourceMeta},
+		{"time", times, "2026-01-01T00:00:00Z", DateSourceTime, "2026-02-01T00:00:00Z", DateSourceTime},
+		// Each date comes from the best source that has it.
+		{
+			"mixed sources", `<script type="application/ld+json">{"datePublished":"2024-01-01"}</script>` + times,
+			"2024-01-01T00:00:00Z", DateSourceJSONLD, "2026-02-01T00:00:00Z", DateSourceTime,
+		},
+		// A date that does not parse leaves the next source to supply one.
+		{
+			"unparsable JSON-LD", `<script type="application/ld+json">{"datePublished":"soon","dateModified":"0001-01-01"}</script>` + meta,
+			"2025-01-01T00:00:00Z", DateSourceMeta, "2025-02-01T00:00:00Z", DateSourceMeta,
+		},
+		{"invalid JSON", `<script type="application/ld+json">{"datePublished":</script>` + meta, "2025-01-01T00:00:00Z", DateSourceMeta, "2025-02-01T00:00:00Z", DateSourceMeta},
+		{
+			"JSON-LD graph", `<script type="application/ld+json">[{"@graph":[{"@type":"WebPage"},{"@type":"Article","datePublished":"2024-03-01T10:00:00+01:00"}]}]</script>`,
+			"2024-03-01T10:00:00+01:00", DateSourceJSONLD, "", "",
+		},
+		{
+			"first JSON-LD object", `<script type="application/ld+json">{"dateModified":"2024-05-01"}</script><script type="application/ld+json">{"dateModified":"2024-06-01"}</script>`,
+			"", "", "2024-05-01T00:00:00Z", DateSourceJSONLD,
+		},
+		{"og:updated_time", `<meta property="og:updated_time" content="1772600767">`, "", "", "2026-03-04T05:06:07Z", DateSourceMeta},
+		{"meta name", `<meta name="Article:Published_Time" content="2025-01-01">`, "2025-01-01T00:00:00Z", DateSourceMeta, "", ""},
+		{
+			"time itemprops", `<time itemprop="dateModified" datetime="2026-02-01"></time><time itemprop="datePublished">March 4, 2026</time>`,
+			"2026-03-04T00:00:00Z", DateSourceTime, "2026-02-01T00:00:00Z", DateSourceTime,
+		},
+		// A <time> without datetime or itemprop may be any time.
+		{"plain time", `<time>March 4, 2026</time>`, "", "", "", ""},
+		{"modified class", `<time class="post-modified">2026-02-01</time>`, "", "", "2026-02-01T00:00:00Z", DateSourceTime},
+	}
+	for _, tt := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><head></head><body>" + tt.html + "</body></html>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		published, modified := extractContentDates(doc)
+		if published != (contentDate{tt.published, tt.publishedSource}) || modified != (contentDate{tt.modified, tt.modifiedSource}) {
+			t.Errorf("%s: published %+v and modified %+v, want %s from %q and %s from %q",
+				tt.name, published, modified, tt.published, tt.publishedSource, tt.modified, tt.modifiedSource)
+		}
+	}
+}
+
+func TestDatedPages(t *testing.T) {
+	pages := []PageData{
+		{URL: "http://example.com/new", PublishedAt: "2026-01-01T00:00:00Z", PublishedSource: DateSourceMeta, LastModified: "Thu, 01 Jan 2026 12:00:00 GMT"},
+		{URL: "http://example.com/edited", PublishedAt: "2020-01-01T00:00:00Z", ModifiedAt: "2025-06-01T00:00:00Z", ModifiedSource: DateSourceJSONLD, LastModified: "Wed, 01 Oct 2025 00:00:00 GMT"},
+		{URL: "http://example.com/old", PublishedAt: "2021-01-01T00:00:00Z", PublishedSource: DateSourceTime, LastModified: "Thu, 01 Jan 2026 00:00:00 GMT"},
+		{URL: "http://example.com/alias", PublishedAt: "2000-01-01T00:00:00Z", LastModified: "Thu, 01 Jan 2026 00:00:00 GMT", Alias: true},
+		{URL: "http://example.com/undated", LastModified: "Thu, 01 Jan 2026 00:00:00 GMT"},
+	}
+	var urls []string
+	for _, page := range OldestContent(pages, 2) {
+		urls = append(urls, page.URL)
+	}
+	if strings.Join(urls, " ") != "http://example.com/old http://example.com/edited" {
+		t.Errorf("oldest %q, want old, then edited by its modification date", urls)
+	}
+
+	mismatches := FindDateMismatches(pages, DefaultDateThreshold)
+	if len(mismatches) != 2 {
+		t.Fatalf("mismatches %+v, want old and edited", mismatches)
+	}
+	if m := mismatches[0]; m.URL != "http://example.com/old" || m.Source != DateSourceTime || m.OnPage != "2021-01-01T00:00:00Z" || m.Difference != 1826*24*time.Hour {
+		t.Errorf("first mismatch %+v, want old, 5 years off", m)
+	}
+	if m := mismatches[1]; m.URL != "http://example.com/edited" || m.Source != DateSourceJSONLD || m.Difference != 122*24*time.Hour {
+		t.Errorf("second mismatch %+v, want edited, 122 days off", m)
+	}
+}
@@ -0,0 +1,157 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Kinds of DeclaredURL.
+const (
+	DeclaredCanonical = "canonical"
+	DeclaredHreflang  = "hreflang"
+	DeclaredSitemap   = "sitemap"
+)
+
+// Problems reported in URLMisconfiguration.Problems.
+const (
+	ProblemInvalid   = "invalid"
+	ProblemRelative  = "relative"
+	ProblemOffDomain = "off-domain"
+	ProblemInsecure  = "insecure"
+)
+
+// HreflangLink is a rel="alternate" hreflang declaration of a page. URL is
+// the href as written, so relative declarations can be detected.
+type HreflangLink struct {
+	Language string `json:"lang"`
+	URL      string `json:"url"`
+}
+
+// DeclaredURL is a URL a site declares about its own pages: a canonical,
+// an hreflang alternate or a sitemap entry.
+type DeclaredURL struct {
+	Kind       string
+	URL        string
+	DeclaredOn string
+	Language   string
+}
+
+// URLMisconfiguration is a declared URL that search engines will
+// misinterpret or ignore.
+type URLMisconfiguration struct {
+	Kind       string   `json:"kind"`
+	URL        string   `json:"url"`
+	DeclaredOn string   `json:"declared_on"`
+	Language   string   `json:"lang,omitempty"`
+	Problems   []string `json:"problems"`
+}
+
+// WithKnownHosts lists other hosts of the same site, such as a CDN or a
+// renamed domain, that canonical, hreflang and sitemap URLs may point at
+// without being reported as off-domain. It does not widen the crawl.
+func WithKnownHosts(hosts []string) Option {
+	return func(c *Crawler) {
+		c.knownHosts = hosts
+	}
+}
+
+// extractDeclaredURLs reads the canonical and hreflang links of doc.
+func extractDeclaredURLs(doc *goquery.Document) (canonical string, hreflang []HreflangLink) {
+	canonical = strings.TrimSpace(doc.Find(`link[rel~="canonical"]`).First().AttrOr("href", ""))
+	doc.Find(`link[rel~="alternate"][hreflang]`).Each(func(_ int, s *goquery.Selection) {
+		hreflang = append(hreflang, HreflangLink{
+			Language: strings.TrimSpace(s.AttrOr("hreflang", "")),
+			URL:      strings.TrimSpace(s.AttrOr("href", "")),
+		})
+	})
+	return canonical, hreflang
+}
+
+// PageDeclaredURLs lists the canonical and hreflang URLs declared by pages.
+func PageDeclaredURLs(pages []PageData) []DeclaredURL {
+	var declared []DeclaredURL
+	for _, page := range pages {
+		if page.Canonical != "" {
+			declared = append(declared, DeclaredURL{Kind: DeclaredCanonical, URL: page.Canonical, DeclaredOn: page.URL})
+		}
+		for _, link := range page.Hreflang {
+			declared = append(declared, DeclaredURL{Kind: DeclaredHreflang, URL: link.URL, DeclaredOn: page.URL, Language: link.Language})
+		}
+	}
+	return declared
+}
+
+// CheckDeclaredURL returns the problems of a URL declared by the site at
+// base: not an absolute http(s) URL, a host other than the base host and
+// knownHosts, or http on an https site.
+func CheckDeclaredURL(raw string, base *url.URL, knownHosts []string) []string {
+	u, err := url.Parse(raw)
+	if err != nil || raw == "" {
+		return []string{ProblemInvalid}
+	}
+	// Canonicals, hreflang alternates and sitemap entries must be absolute;
+	// a scheme-relative URL depends on how the page was fetched.
+	if !u.IsAbs() || u.Host == "" {
+		return []string{ProblemRelative}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return []string{ProblemInvalid}
+	}
+
+	var problems []string
+	host := normalizeHost(u.Scheme, u.Host)
+	if host != normalizeHost(base.Scheme, base.Host) && !isKnownHost(host, knownHosts) {
+		problems = append(problems, ProblemOffDomain)
+	}
+	if base.Scheme == "https" && u.Scheme == "http" {
+		problems = append(problems, ProblemInsecure)
+	}
+	return problems
+}
+
+func isKnownHost(host string, knownHosts []string) bool {
+	for _, known := range knownHosts {
+		if strings.EqualFold(strings.TrimSpace(known), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindURLMisconfigurations checks every declared URL against the site at
+// base and returns the problematic ones, ordered by kind, URL and
+// declaring page.
+func FindURLMisconfigurations(declared []DeclaredURL, base *url.URL, knownHosts []string) []URLMisconfiguration {
+	var found []URLMisconfiguration
+	for _, d := range declared {
+		problems := CheckDeclaredURL(d.URL, base, knownHosts)
+		if len(problems) == 0 {
+			continue
+		}
+		found = append(found, URLMisconfiguration{
+			Kind:       d.Kind,
+			URL:        d.URL,
+			DeclaredOn: d.DeclaredOn,
+			Language:   d.Language,
+			Problems:   problems,
+		})
+	}
+	sortMisconfigurations(found)
+	return found
+}
+
+func sortMisconfigurations(found []URLMisconfiguration) {
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.URL != b.URL {
+			return a.URL < b.URL
+		}
+		return a.DeclaredOn < b.DeclaredOn
+	})
+}
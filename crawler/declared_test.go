@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestCheckDeclaredURL(t *testing.T) {
+	secure, _ := url.Parse("https://example.com/")
+	plain, _ := url.Parse("http://example.com/")
+	known := []string{" CDN.example.net "}
+	tests := []struct {
+		raw      string
+		base     *url.URL
+		problems []string
+	}{
+		{"https://example.com/a", secure, nil},
+		{"https://EXAMPLE.com:443/a", secure, nil},
+		{"https://example.com./a", secure, nil},
+		{"https://cdn.example.net/app.css", secure, nil},
+		{"/a", secure, []string{ProblemRelative}},
+		{"a.html", secure, []string{ProblemRelative}},
+		// A scheme-relative URL depends on how the page was fetched.
+		{"//example.com/a", secure, []string{ProblemRelative}},
+		// So does one without a host.
+		{"https:/a", secure, []string{ProblemRelative}},
+		{"", secure, []string{ProblemInvalid}},
+		{"https://[::1", secure, []string{ProblemInvalid}},
+		{"ftp://example.com/a", secure, []string{ProblemInvalid}},
+		{"https://other.example/a", secure, []string{ProblemOffDomain}},
+		{"https://example.com:8443/a", secure, []string{ProblemOffDomain}},
+		{"https://www.example.com/a", secure, []string{ProblemOffDomain}},
+		{"http://example.com/a", secure, []string{ProblemInsecure}},
+		{"http://other.example/a", secure, []string{ProblemOffDomain, ProblemInsecure}},
+		{"http://example.com/a", plain, nil},
+		{"https://example.com/a", plain, nil},
+	}
+	for _, tt := range tests {
+		if problems := CheckDeclaredURL(tt.raw, tt.base, known); !slices.Equal(problems, tt.problems) {
+			t.Errorf("CheckDeclaredURL(%q) on %s = %q, want %q", tt.raw, tt.base, problems, tt.problems)
+		}
+	}
+}
+
+func TestFindURLMisconfigurations(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	declared := []DeclaredURL{
+		{Kind: DeclaredSitemap, URL: "http://example.com/b", DeclaredOn: "https://example.com/sitemap.xml"},
+		{Kind: DeclaredHreflang, URL: "/de/", DeclaredOn: "https://example.com/b", Language: "de"},
+		{Kind: DeclaredCanonical, URL: "https://example.com/a", DeclaredOn: "https://example.com/a"},
+		{Kind: DeclaredHreflang, URL: "/de/", DeclaredOn: "https://example.com/a", Language: "de"},
+		{Kind: DeclaredCanonical, URL: "https://other.example/a", DeclaredOn: "https://example.com/c"},
+	}
+	want := []URLMisconfiguration{
+		{Kind: DeclaredCanonical, URL: "https://other.example/a", DeclaredOn: "https://example.com/c", Problems: []string{ProblemOffDomain}},
+		{Kind: DeclaredHreflang, URL: "/de/", DeclaredOn: "https://example.com/a", Language: "de", Problems: []string{ProblemRelative}},
+		{Kind: DeclaredHreflang, URL: "/de/", DeclaredOn: "https://example.com/b", Language: "de", Problems: []string{ProblemRelative}},
+		{Kind: DeclaredSitemap, URL: "http://example.com/b", DeclaredOn: "https://example.com/sitemap.xml", Problems: []string{ProblemInsecure}},
+	}
+	if found := FindURLMisconfigurations(declared, base, nil); !reflect.DeepEqual(found, want) {
+		t.Errorf("misconfigurations %+v, want %+v", found, want)
+	}
+	if found := FindURLMisconfigurations(declared[2:3], base, nil); found != nil {
+		t.Errorf("misconfigurations %+v of a correct canonical", found)
+	}
+}
+
+// TestCrawlDeclaredURLs checks the canonical, hreflang and sitemap URLs a
+// crawl reports, with the ones pointing at a known host left out.
+func TestCrawlDeclaredURLs(t *testing.T) {
+	var site *testSite
+	site = newTestSite(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			htmlPage(`<link rel="canonical" href=" /home "> <link rel="canonical" href="https://other.example/second">
+				<link rel="alternate" hreflang="de" href="https://other.example/de">
+				<link rel="alternate" hreflang=" en " href="`+site.URL+`/en">
+				<link rel="alternate" hreflang="fr" href="https://cdn.example.net/fr">
+				<link rel="alternate" href="`+site.URL+`/feed">`)(w, r)
+		},
+		"/a": func(w http.ResponseWriter, r *http.Request) {
+			htmlPage(`<link rel="canonical" href="`+site.URL+`/a">`)(w, r)
+		},
+		"/sitemap.xml": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+				<url><loc>` + site.URL + `/a</loc></url>
+				<url><loc> /relative </loc></url>
+				<url><loc>https://other.example/x</loc></url>
+				<url><loc>https://cdn.example.net/y</loc></url>
+				<url><loc>ftp://example.com/</loc></url>
+				</urlset>`))
+		},
+	})
+	result := crawlTestSite(t, site.URL, 0, WithSitemap("/sitemap.xml"), WithKnownHosts([]string{"cdn.example.net"}))
+
+	home := findPage(result, site.URL, "/")
+	if home == nil {
+		t.Fatal("the home page was not crawled")
+	}
+	hreflang := []HreflangLink{{"de", "https://other.example/de"}, {"en", site.URL + "/en"}, {"fr", "https://cdn.example.net/fr"}}
+	if home.Canonical != "/home" || !slices.Equal(home.Hreflang, hreflang) {
+		t.Errorf("the home page declares canonical %q and hreflang %+v, want the first canonical and %+v", home.Canonical, home.Hreflang, hreflang)
+	}
+
+	sitemap := site.URL + "/sitemap.xml"
+	want := []URLMisconfiguration{
+		{Kind: DeclaredCanonical, URL: "/home", DeclaredOn: site.URL + "/", Problems: []string{ProblemRelative}},
+		{Kind: DeclaredHreflang, URL: "https://other.example/de", DeclaredOn: site.URL + "/", Language: "de", Problems: []string{ProblemOffDomain}},
+		{Kind: DeclaredSitemap, URL: "/relative", DeclaredOn: sitemap, Problems: []string{ProblemRelative}},
+		{Kind: DeclaredSitemap, URL: "ftp://example.com/", DeclaredOn: sitemap, Problems: []string{ProblemInvalid}},
+		{Kind: DeclaredSitemap, URL: "https://other.example/x", DeclaredOn: sitemap, Problems: []string{ProblemOffDomain}},
+	}
+	if !reflect.DeepEqual(result.Misconfigurations, want) {
+		t.Errorf("misconfigurations %+v, want %+v", result.Misconfigurations, want)
+	}
+}
@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WithDeterministic makes repeated crawls of an unchanged site produce the
+// same results. URLs are fetched one at a time, a depth level at a time,
+// in URL order, so the order of pages, errors and edges and the pages a
+// budget cuts off do not depend on goroutine scheduling. Randomized
+// behaviour draws from a generator seeded with seed. Timestamps and
+// response times depend on the clock and are stored as zero.
+//
+// A duration budget cannot be met deterministically and is rejected.
+// Throttling still slows the crawl down, which changes its pace but not
+// its results.
+func WithDeterministic(seed uint64) Option {
+	return func(c *Crawler) {
+		c.deterministic = true
+		c.seed = seed
+	}
+}
+
+// newRand returns the random source of the crawl: seeded in a
+// deterministic crawl, random otherwise.
+func (c *Crawler) newRand() *rand.Rand {
+	if c.deterministic {
+		return rand.New(rand.NewPCG(c.seed, c.seed))
+	}
+	return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// crawlLevels crawls links and everything reachable from them one URL at a
+// time. Each round fetches the pending links in depth and URL order and
+// collects the links they find for the next round.
+func (c *Crawler) crawlLevels(links []frontierLink) {
+	for len(links) > 0 {
+		sort.SliceStable(links, func(i, j int) bool {
+			if links[i].depth != links[j].depth {
+				return links[i].depth < links[j].depth
+			}
+			return links[i].url < links[j].url
+		})
+		c.nextLevel = nil
+		var wg sync.WaitGroup
+		for _, link := range links {
+			wg.Add(1)
+			c.crawl(link.url, link.depth, &wg)
+		}
+		c.runRelinks(&wg)
+		links = c.nextLevel
+	}
+}
+
+// clearTimes zeroes the clock-dependent fields of the result of a
+// deterministic crawl. resultLock must be held.
+func (c *Crawler) clearTimes() error {
+	c.result.StartTime, c.result.EndTime = time.Time{}, time.Time{}
+	for i := range c.result.Errors {
+		c.result.Errors[i].Time = time.Time{}
+	}
+	for _, ips := range c.result.DNS {
+		for i := range ips {
+			ips[i].FirstSeen, ips[i].LastSeen = time.Time{}, time.Time{}
+		}
+	}
+	for i := range c.result.DNSChanges {
+		c.result.DNSChanges[i].Time = time.Time{}
+	}
+	for i := range c.result.Robots {
+		c.result.Robots[i].FetchedAt = time.Time{}
+	}
+	return c.eachPage(true, func(page *PageData) {
+		page.CrawledAt = time.Time{}
+		page.ResponseTime = 0
+	})
+}
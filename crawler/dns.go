@@ -0,0 +1,154 @@
+package crawler
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResolvedIP is an IP address the crawler sent requests to, with the first
+// and last time it did.
+type ResolvedIP struct {
+	IP        string    `json:"ip"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// DNSChange is a resolution of Host whose addresses differ from those of
+// its previous resolution in the crawl, as happens with DNS failover.
+type DNSChange struct {
+	Host     string    `json:"host"`
+	Time     time.Time `json:"time"`
+	Previous []string  `json:"previous"`
+	Current  []string  `json:"current"`
+}
+
+// dnsTracker collects the addresses requests were sent to and the results
+// of the DNS lookups made for new connections.
+type dnsTracker struct {
+	lock     sync.Mutex
+	hosts    map[string]map[string]*ResolvedIP
+	resolved map[string][]string
+	changes  []DNSChange
+}
+
+// dnsTrace is the fetcher recording, for every request, the address of the
+// connection it was sent on and the DNS lookup that connection made, if
+// any. Connections are reused, so a lookup happens only for new ones.
+func (c *Crawler) dnsTrace(next Fetcher) Fetcher {
+	return fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		host := strings.ToLower(req.URL.Hostname())
+		trace := &httptrace.ClientTrace{
+			DNSDone: func(info httptrace.DNSDoneInfo) {
+				if info.Err == nil {
+					c.recordResolution(host, info.Addrs)
+				}
+			},
+			GotConn: func(info httptrace.GotConnInfo) {
+				if addr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok {
+					c.recordConnection(host, addr.IP.String())
+				}
+			},
+		}
+		return next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	})
+}
+
+func (c *Crawler) recordConnection(host, ip string) {
+	now := time.Now()
+	c.dns.lock.Lock()
+	defer c.dns.lock.Unlock()
+	c.dns.add(host, ResolvedIP{IP: ip, FirstSeen: now, LastSeen: now})
+}
+
+// add merges seen into the addresses of host. dns.lock must be held.
+func (t *dnsTracker) add(host string, seen ResolvedIP) {
+	if t.hosts == nil {
+		t.hosts = make(map[string]map[string]*ResolvedIP)
+	}
+	ips := t.hosts[host]
+	if ips == nil {
+		ips = make(map[string]*ResolvedIP)
+		t.hosts[host] = ips
+	}
+	known, ok := ips[seen.IP]
+	if !ok {
+		ips[seen.IP] = &seen
+		return
+	}
+	if seen.FirstSeen.Before(known.FirstSeen) {
+		known.FirstSeen = seen.FirstSeen
+	}
+	if seen.LastSeen.After(known.LastSeen) {
+		known.LastSeen = seen.LastSeen
+	}
+}
+
+// recordResolution compares the addresses host resolved to with those of
+// its previous lookup and records a DNSChange when they differ.
+func (c *Crawler) recordResolution(host string, addrs []net.IPAddr) {
+	current := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		current = append(current, addr.IP.String())
+	}
+	sort.Strings(current)
+	current = slices.Compact(current)
+
+	c.dns.lock.Lock()
+	defer c.dns.lock.Unlock()
+	if c.dns.resolved == nil {
+		c.dns.resolved = make(map[string][]string)
+	}
+	previous, ok := c.dns.resolved[host]
+	c.dns.resolved[host] = current
+	if !ok || slices.Equal(previous, current) {
+		return
+	}
+	c.dns.changes = append(c.dns.changes, DNSChange{Host: host, Time: time.Now(), Previous: previous, Current: current})
+	c.logf("DNS change: %s resolves to %s, was %s\n", host, strings.Join(current, ", "), strings.Join(previous, ", "))
+}
+
+// restoreDNS starts the rollup from that of an earlier crawl. An address
+// listed more than once keeps its earliest and latest times.
+func (c *Crawler) restoreDNS(hosts map[string][]ResolvedIP, changes []DNSChange) {
+	c.dns.lock.Lock()
+	defer c.dns.lock.Unlock()
+	for host, ips := range hosts {
+		for _, ip := range ips {
+			c.dns.add(host, ip)
+		}
+	}
+	c.dns.changes = append(c.dns.changes, changes...)
+}
+
+// dnsRollup returns the addresses requests were sent to by host, each
+// host's in the order they were first used, and the DNS changes by time.
+func (c *Crawler) dnsRollup() (map[string][]ResolvedIP, []DNSChange) {
+	c.dns.lock.Lock()
+	defer c.dns.lock.Unlock()
+	if len(c.dns.hosts) == 0 {
+		return nil, c.dns.changes
+	}
+	hosts := make(map[string][]ResolvedIP, len(c.dns.hosts))
+	for host, ips := range c.dns.hosts {
+		list := make([]ResolvedIP, 0, len(ips))
+		for _, ip := range ips {
+			list = append(list, *ip)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if !list[i].FirstSeen.Equal(list[j].FirstSeen) {
+				return list[i].FirstSeen.Before(list[j].FirstSeen)
+			}
+			return list[i].IP < list[j].IP
+		})
+		hosts[host] = list
+	}
+	changes := slices.Clone(c.dns.changes)
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Time.Before(changes[j].Time) })
+	return hosts, changes
+}
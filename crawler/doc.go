@@ -0,0 +1,29 @@
+// Package crawler crawls the same-domain pages of a site and collects their
+// titles, links, assets and the problems found on the way.
+//
+// CrawlSite runs a one-shot crawl with few settings. For everything else,
+// build a Crawler with NewCrawler and options, then call Start, which
+// returns the results and writes no files:
+//
+//	c, err := crawler.NewCrawler("https://example.com", 2, 5,
+//		crawler.WithLogOutput(io.Discard),
+//		crawler.WithMaxPages(500),
+//	)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	result, err := c.Start(ctx)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	fmt.Println(result.TotalPages, "pages,", len(result.Errors), "errors")
+//
+// Saving is explicit: SaveResults writes a result as JSON, and
+// WithOutputPath makes Start save the results itself, in the format of
+// WithOutputFormat, which is what the command does:
+//
+//	c, err := crawler.NewCrawler("https://example.com", 2, 5,
+//		crawler.WithOutputFormat(crawler.FormatCSV),
+//		crawler.WithOutputPath("out/{host}-{date}.csv"),
+//	)
+package crawler
@@ -0,0 +1,256 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DefaultDuplicateMinCases is the number of URL pairs a pattern needs
+// before it is reported as a source of duplicate content.
+const DefaultDuplicateMinCases = 3
+
+// contentHash identifies the content of a page by its whitespace-normalized
+// text, so markup and formatting differences do not hide duplicates.
+// Malformed pages without a document are hashed on their raw body.
+func contentHash(doc *goquery.Document, content []byte) string {
+	var sum [sha256.Size]byte
+	if doc != nil {
+		sum = sha256.Sum256([]byte(strings.Join(strings.Fields(doc.Find("body").Text()), " ")))
+	} else {
+		sum = sha256.Sum256(content)
+	}
+	return hex.EncodeToString(sum[:8])
+}
+
+// simHashShingle is the number of consecutive words a SimHash feature
+// spans.
+const simHashShingle = 3
+
+// contentSimHash returns the SimHash of the text of doc, over its
+// lowercased three-word shingles, in hex: pages whose text differs a
+// little have hashes that differ in a few bits. A page without a document
+// or without words has none.
+func contentSimHash(doc *goquery.Document) string {
+	if doc == nil {
+		return ""
+	}
+	words := strings.Fields(strings.ToLower(doc.Find("body").Text()))
+	if len(words) == 0 {
+		return ""
+	}
+	var votes [64]int
+	// A text shorter than a shingle is one feature.
+	for i := range max(len(words)-simHashShingle+1, 1) {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:min(i+simHashShingle, len(words))], " ")))
+		sum := h.Sum64()
+		for bit := range votes {
+			if sum&(1<<bit) != 0 {
+				votes[bit]++
+			} else {
+				votes[bit]--
+			}
+		}
+	}
+	var hash uint64
+	for bit, vote := range votes {
+		if vote > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+// Kinds of DuplicatePattern.
+const (
+	PatternQueryParam  = "query-param"
+	PatternPathSegment = "path-segment"
+)
+
+// DuplicatePattern is a hypothesis about why pages have identical content:
+// URLs that only differ by the query parameter or path segment Name.
+type DuplicatePattern struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Cases counts groups of crawled URLs that only differ by Name;
+	// DuplicateCases counts the groups whose pages all have the same
+	// content. Ratio is DuplicateCases / Cases.
+	Cases          int      `json:"cases"`
+	DuplicateCases int      `json:"duplicate_cases"`
+	Ratio          float64  `json:"ratio"`
+	Examples       []string `json:"examples,omitempty"`
+}
+
+// Suggestion is the configuration change the pattern hints at.
+func (p DuplicatePattern) Suggestion() string {
+	if p.Kind == PatternQueryParam {
+		return fmt.Sprintf("consider stripping the %s parameter, or -exclude '[?&]%s='", p.Name, p.Name)
+	}
+	return fmt.Sprintf("consider -exclude '/%s(/|$)'", p.Name)
+}
+
+// patternCase collects the pages whose URL has the same key once a
+// parameter or segment is removed.
+type patternCase struct {
+	urls   []string
+	hashes map[string]bool
+}
+
+// FindDuplicatePatterns groups the crawled URLs that only differ by one
+// query parameter, or by one extra path segment, and reports the
+// parameters and segments for which those groups mostly have identical
+// content. Patterns need at least minCases groups; they are ranked by
+// ratio, then by the number of duplicate groups. Pages of different
+// language passes are never compared.
+func FindDuplicatePatterns(pages []PageData, minCases int) []DuplicatePattern {
+	// Pages are keyed by language and URL with a sorted query, so URLs
+	// built by removing a parameter compare equal to crawled ones.
+	hashes := make(map[string]string)
+	original := make(map[string]string)
+	for _, page := range pages {
+		if page.Alias || page.ContentHash == "" {
+			continue
+		}
+		u, err := url.Parse(page.URL)
+		if err != nil {
+			continue
+		}
+		key := languageKey(page.Language, sortedQueryURL(u))
+		hashes[key] = page.ContentHash
+		original[key] = page.URL
+	}
+
+	cases := make(map[[2]string]map[string]*patternCase)
+	add := func(kind, name, key, pageKey string) {
+		id := [2]string{kind, name}
+		if cases[id] == nil {
+			cases[id] = make(map[string]*patternCase)
+		}
+		pc := cases[id][key]
+		if pc == nil {
+			pc = &patternCase{hashes: make(map[string]bool)}
+			cases[id][key] = pc
+		}
+		pc.urls = append(pc.urls, pageKey)
+		pc.hashes[hashes[pageKey]] = true
+	}
+
+	keys := make([]string, 0, len(hashes))
+	for key := range hashes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, pageKey := range keys {
+		language, sortedURL := splitLanguageKey(pageKey)
+		u, err := url.Parse(sortedURL)
+		if err != nil {
+			continue
+		}
+
+		// A page takes part in a case for every parameter it has, keyed by
+		// its URL without the parameter.
+		for name := range u.Query() {
+			stripped := *u
+			q := u.Query()
+			q.Del(name)
+			stripped.RawQuery = q.Encode()
+			add(PatternQueryParam, name, languageKey(language, stripped.String()), pageKey)
+		}
+
+		// A page whose URL equals another page's with one segment removed
+		// is a case for that segment.
+		segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if segments[0] == "" {
+			continue
+		}
+		for i, segment := range segments {
+			rest := append(append([]string(nil), segments[:i]...), segments[i+1:]...)
+			stripped := *u
+			stripped.Path = "/" + strings.Join(rest, "/")
+			stripped.RawPath = ""
+			key := languageKey(language, stripped.String())
+			if _, ok := hashes[key]; ok {
+				add(PatternPathSegment, segment, key, pageKey)
+			}
+		}
+	}
+
+	// The page without the parameter, or without the segment, belongs to
+	// its case too.
+	for _, byKey := range cases {
+		for key, pc := range byKey {
+			if hash, ok := hashes[key]; ok {
+				pc.urls = append(pc.urls, key)
+				pc.hashes[hash] = true
+			}
+		}
+	}
+
+	var patterns []DuplicatePattern
+	for id, byKey := range cases {
+		p := DuplicatePattern{Kind: id[0], Name: id[1]}
+		caseKeys := make([]string, 0, len(byKey))
+		for key := range byKey {
+			caseKeys = append(caseKeys, key)
+		}
+		sort.Strings(caseKeys)
+		for _, key := range caseKeys {
+			pc := byKey[key]
+			if len(pc.urls) < 2 {
+				continue
+			}
+			p.Cases++
+			if len(pc.hashes) == 1 {
+				p.DuplicateCases++
+				if len(p.Examples) < 3 {
+					sort.Strings(pc.urls)
+					p.Examples = append(p.Examples, original[pc.urls[0]]+" = "+original[pc.urls[1]])
+				}
+			}
+		}
+		if p.Cases < minCases || p.DuplicateCases == 0 {
+			continue
+		}
+		p.Ratio = float64(p.DuplicateCases) / float64(p.Cases)
+		patterns = append(patterns, p)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		a, b := patterns[i], patterns[j]
+		if a.Ratio != b.Ratio {
+			return a.Ratio > b.Ratio
+		}
+		if a.DuplicateCases != b.DuplicateCases {
+			return a.DuplicateCases > b.DuplicateCases
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	return patterns
+}
+
+// splitLanguageKey is the inverse of languageKey. Normalized URLs never
+// contain a space, so the last space ends the language.
+func splitLanguageKey(key string) (language, url string) {
+	if i := strings.LastIndex(key, " "); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// sortedQueryURL returns u with its query parameters in a canonical order.
+func sortedQueryURL(u *url.URL) string {
+	sorted := *u
+	if u.RawQuery != "" {
+		sorted.RawQuery = u.Query().Encode()
+	}
+	return sorted.String()
+}
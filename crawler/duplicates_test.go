@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestContentHash(t *testing.T) {
+	parse := func(html string) *goquery.Document {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	hash := contentHash(parse("<title>A</title><body><p>Hello\n  world</p></body>"), nil)
+	if len(hash) != 16 {
+		t.Fatalf("content hash %q, want 16 hex digits", hash)
+	}
+	// The hash is of the body text, with its whitespace normalized.
+	if other := contentHash(parse("<title>B</title><body><div>Hello</div> <div>world</div></body>"), nil); other != hash {
+		t.Errorf("content hash %q of the same text, want %q", other, hash)
+	}
+	if other := contentHash(parse("<body><p>Hello World</p></body>"), nil); other == hash {
+		t.Error("texts differing in case have the same content hash")
+	}
+	// Bodies without a document are hashed as they are.
+	if raw := contentHash(nil, []byte("Hello  world")); raw == hash || raw != contentHash(nil, []byte("Hello  world")) {
+		t.Errorf("content hash %q of the raw body", raw)
+	}
+}
+
+func TestFindDuplicatePatterns(t *testing.T) {
+	page := func(path, hash string) PageData {
+		return PageData{URL: "http://example.com" + path, ContentHash: hash}
+	}
+	pages := []PageData{
+		// Printable versions of 4 documents, all identical.
+		page("/doc/1", "d1"), page("/doc/1/print", "d1"),
+		page("/doc/2", "d2"), page("/doc/2/print", "d2"),
+		page("/doc/3", "d3"), page("/doc/3/print", "d3"),
+		page("/doc/4", "d4"), page("/doc/4/print", "d4"),
+		// A session parameter, ignored by 2 pages of 3.
+		page("/shop?sessionid=1", "s"), page("/shop", "s"),
+		page("/cart?sessionid=2", "c"), page("/cart", "c"),
+		page("/faq?sessionid=3", "f1"), page("/faq", "f2"),
+		// Two URLs differing by a parameter, without the URL lacking it.
+		page("/news?ref=a", "n"), page("/news?ref=b", "n"),
+		// Parameters compare in any order.
+		page("/list?b=2&c=3&a=1", "l"), page("/list?c=3&a=1", "l"),
+		// A parameter that changes the content.
+		page("/p?color=red", "p1"), page("/p?color=blue", "p2"),
+		// Pages of different languages are not compared.
+		{URL: "http://example.com/home?lang=de", Language: "de", ContentHash: "h"}, page("/home", "h"),
+		// Aliases and pages without content take no part.
+		{URL: "http://example.com/shop?utm_source=x", Alias: true, ContentHash: "s"},
+		page("/cart?tab=1", ""),
+	}
+
+	printPattern := DuplicatePattern{
+		Kind: PatternPathSegment, Name: "print", Cases: 4, DuplicateCases: 4, Ratio: 1,
+		Examples: []string{
+			"http://example.com/doc/1 = http://example.com/doc/1/print",
+			"http://example.com/doc/2 = http://example.com/doc/2/print",
+			"http://example.com/doc/3 = http://example.com/doc/3/print",
+		},
+	}
+	sessionPattern := DuplicatePattern{
+		Kind: PatternQueryParam, Name: "sessionid", Cases: 3, DuplicateCases: 2, Ratio: 2.0 / 3,
+		Examples: []string{
+			"http://example.com/cart = http://example.com/cart?sessionid=2",
+			"http://example.com/shop = http://example.com/shop?sessionid=1",
+		},
+	}
+	tests := []struct {
+		minCases int
+		want     []DuplicatePattern
+	}{
+		{
+			1, []DuplicatePattern{
+				printPattern,
+				{Kind: PatternQueryParam, Name: "b", Cases: 1, DuplicateCases: 1, Ratio: 1, Examples: []string{"http://example.com/list?b=2&c=3&a=1 = http://example.com/list?c=3&a=1"}},
+				{Kind: PatternQueryParam, Name: "ref", Cases: 1, DuplicateCases: 1, Ratio: 1, Examples: []string{"http://example.com/news?ref=a = http://example.com/news?ref=b"}},
+				sessionPattern,
+			},
+		},
+		{3, []DuplicatePattern{printPattern, sessionPattern}},
+		{4, []DuplicatePattern{printPattern}},
+		{5, nil},
+	}
+	for _, tt := range tests {
+		if patterns := FindDuplicatePatterns(pages, tt.minCases); !reflect.DeepEqual(patterns, tt.want) {
+			t.Errorf("at least %d cases: patterns %+v, want %+v", tt.minCases, patterns, tt.want)
+		}
+	}
+}
+
+func TestDuplicatePatternSuggestion(t *testing.T) {
+	tests := []struct {
+		pattern DuplicatePattern
+		want    string
+	}{
+		{DuplicatePattern{Kind: PatternQueryParam, Name: "sessionid"}, "consider stripping the sessionid parameter, or -exclude '[?&]sessionid='"},
+		{DuplicatePattern{Kind: PatternPathSegment, Name: "print"}, "consider -exclude '/print(/|$)'"},
+	}
+	for _, tt := range tests {
+		if got := tt.pattern.Suggestion(); got != tt.want {
+			t.Errorf("%s %s: suggestion %q, want %q", tt.pattern.Kind, tt.pattern.Name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Edge statuses recorded in Edge.Status.
+const (
+	// EdgeCrawled means the target was handed to the crawler, either by
+	// this edge or earlier through another one. Whether the fetch
+	// succeeded is recorded in the results file.
+	EdgeCrawled           = "crawled"
+	EdgeDepthLimit        = "depth-limit"
+	EdgePathDepthLimit    = "path-depth-limit"
+	EdgeFiltered          = "filtered"
+	EdgeOffDomain         = "off-domain"
+	EdgeUnsupportedScheme = "unsupported-scheme"
+	// EdgeNotFollowed marks JavaScript links found without -js-links-follow.
+	EdgeNotFollowed = "not-followed"
+)
+
+// Edge is one link from a crawled page to a target URL.
+type Edge struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Text     string `json:"text"`
+	LinkType string `json:"link_type"`
+	Nofollow bool   `json:"nofollow"`
+	Depth    int    `json:"depth"`
+	Status   string `json:"status"`
+
+	// Reason explains an EdgeOutOfScope status.
+	Reason string `json:"reason,omitempty"`
+}
+
+var edgeCSVHeader = []string{"source", "target", "text", "link_type", "nofollow", "depth", "status", "reason"}
+
+// edgeWriter streams edges to a file as pages are processed, so the edge
+// list never has to fit in memory.
+type edgeWriter struct {
+	lock  sync.Mutex
+	file  *os.File
+	buf   *bufio.Writer
+	csv   *csv.Writer
+	json  *json.Encoder
+	count int
+	err   error
+}
+
+// WithEdgeOutput streams every link found on a crawled page to path, as
+// JSON lines when the extension is .jsonl or .ndjson and as CSV otherwise.
+func WithEdgeOutput(path string) Option {
+	return func(c *Crawler) {
+		c.edgesPath = path
+	}
+}
+
+// edgeFormat returns the format of the edge file at path, jsonl or csv.
+func edgeFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	}
+	return "csv"
+}
+
+func newEdgeWriter(path string) (*edgeWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating edge file: %v", err)
+	}
+	w := &edgeWriter{file: file, buf: bufio.NewWriter(file)}
+	switch edgeFormat(path) {
+	case "jsonl":
+		w.json = json.NewEncoder(w.buf)
+	default:
+		w.csv = csv.NewWriter(w.buf)
+		w.err = w.csv.Write(edgeCSVHeader)
+	}
+	return w, nil
+}
+
+// write appends edges; the first error is kept and reported by close.
+func (w *edgeWriter) write(edges []Edge) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, edge := range edges {
+		if w.err != nil {
+			return
+		}
+		if w.json != nil {
+			w.err = w.json.Encode(edge)
+		} else {
+			w.err = w.csv.Write([]string{
+				edge.Source,
+				edge.Target,
+				edge.Text,
+				edge.LinkType,
+				strconv.FormatBool(edge.Nofollow),
+				strconv.Itoa(edge.Depth),
+				edge.Status,
+				edge.Reason,
+			})
+		}
+		w.count++
+	}
+}
+
+func (w *edgeWriter) close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.csv != nil {
+		w.csv.Flush()
+		if w.err == nil {
+			w.err = w.csv.Error()
+		}
+	}
+	if err := w.buf.Flush(); w.err == nil {
+		w.err = err
+	}
+	if err := w.file.Close(); w.err == nil {
+		w.err = err
+	}
+	if w.err != nil {
+		return fmt.Errorf("error writing edge file: %v", w.err)
+	}
+	return nil
+}
+
+// recordEdges writes the edges found on one page, if an edge file is open.
+func (c *Crawler) recordEdges(edges []Edge) {
+	if c.edges != nil && len(edges) > 0 {
+		c.edges.write(edges)
+	}
+}
+
+// linkStatus runs u, a URL found on source at depth, through the checks
+// every discovered URL passes, whether it comes from a link, a sitemap or
+// a feed: the scheme, the domain, then those of edgeStatus. Sitemap and
+// feed entries are checked at depth -1, as they seed the crawl. It returns
+// the normalized URL with its status and reason.
+func (c *Crawler) linkStatus(u *url.URL, depth int, source string) (string, string, string) {
+	target := c.normalizeLink(u)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return target, EdgeUnsupportedScheme, ""
+	}
+	c.noteHostDot(u, source)
+	if !c.isSameDomain(u) {
+		return target, EdgeOffDomain, ""
+	}
+	status, reason := c.edgeStatus(target, depth, source)
+	return target, status, reason
+}
+
+// isForeignEdge reports whether a link with status leaves the site, so it
+// is neither crawled nor recorded among the links of its page.
+func isForeignEdge(status string) bool {
+	return status == EdgeOffDomain || status == EdgeUnsupportedScheme
+}
+
+// edgeStatus reports what the crawler does with a same-domain link found on
+// source at depth, and the reason for an EdgeOutOfScope status or the
+// pattern of an EdgeDangerous one.
+func (c *Crawler) edgeStatus(target string, depth int, source string) (string, string) {
+	if !c.passesFilters(target) {
+		return EdgeFiltered, ""
+	}
+	if !c.withinPathDepth(target) {
+		return EdgePathDepthLimit, ""
+	}
+	if pattern := c.dangerousPattern(target); pattern != "" {
+		c.noteDangerous(target, pattern, source)
+		return EdgeDangerous, pattern
+	}
+	if !c.isListed(target) {
+		return EdgeNotListed, ""
+	}
+	if !c.inShard(target) {
+		return EdgeOtherShard, ""
+	}
+	if c.isVisited(target) {
+		return EdgeCrawled, ""
+	}
+	if c.params.accumulates(target) {
+		c.counters.paramSkips.Add(1)
+		return EdgeParamAccumulation, ""
+	}
+	if c.pruning.isPruned(target) {
+		return EdgePruned, ""
+	}
+	if !c.withinDepth(depth + 1) {
+		return EdgeDepthLimit, ""
+	}
+	if ok, reason := c.inScope(target, depth+1, source); !ok {
+		return EdgeOutOfScope, reason
+	}
+	return EdgeCrawled, ""
+}
@@ -0,0 +1,161 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// Sentinel errors returned, wrapped in a *FetchError, for URLs that were not
+// crawled. Use errors.Is to test for them.
+var (
+	// ErrRobotsDisallowed reports a URL forbidden by robots.txt rules.
+	ErrRobotsDisallowed = errors.New("disallowed by robots.txt")
+	// ErrOffDomain reports a fetch that ended outside the crawled domain,
+	// typically through a redirect.
+	ErrOffDomain = errors.New("outside the crawled domain")
+	// ErrTooLarge reports a response body above the configured size limit.
+	ErrTooLarge = errors.New("response body too large")
+	// ErrNonHTML reports a response whose content type is not HTML.
+	ErrNonHTML = errors.New("response is not HTML")
+	// ErrParse reports a response body that could not be parsed as HTML.
+	ErrParse = errors.New("cannot parse HTML")
+	// ErrNotListed reports a request outside the list of a crawl with
+	// WithOnlyListed. Such requests are never sent.
+	ErrNotListed = errors.New("URL is not listed")
+	// ErrDangerousURL reports a request to a URL matching a dangerous
+	// pattern, such as a logout link. Such requests are never sent.
+	ErrDangerousURL = errors.New("URL looks like an action")
+)
+
+// Error categories, as returned by ErrorCategory and recorded in
+// CrawlError.Category. The values are stable and safe to match on.
+const (
+	CategoryRobotsDisallowed = "robots-disallowed"
+	CategoryOffDomain        = "off-domain"
+	CategoryTooLarge         = "too-large"
+	CategoryNonHTML          = "non-html"
+	CategoryParse            = "parse"
+	CategoryNotRecorded      = "not-recorded"
+	CategoryNotListed        = "not-listed"
+	CategoryDangerous        = "dangerous-url"
+	CategoryThrottled        = "throttled"
+	CategorySlowBody         = "slow-body"
+	CategoryRedirectLoop     = "redirect-loop"
+	CategoryRedirectLimit    = "redirect-limit"
+	CategoryFetchCommand     = "fetch-command"
+	CategoryCircuitOpen      = "circuit-open"
+	CategoryHTTPStatus       = "http-status"
+	CategoryDNS              = "dns"
+	CategoryTimeout          = "timeout"
+	CategoryTLS              = "tls"
+	CategoryConnection       = "connection"
+	CategoryOther            = "other"
+)
+
+// FetchError is returned for a URL that could not be crawled. Err is one
+// of the sentinel errors above, a *StatusError, or the transport error
+// returned by the HTTP client.
+type FetchError struct {
+	URL        string
+	StatusCode int
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("%s: %v", e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Category returns the stable category of the underlying error.
+func (e *FetchError) Category() string {
+	return ErrorCategory(e.Err)
+}
+
+// StatusError reports a response with a status code other than 200.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// ErrorCategory classifies err into one of the Category constants.
+func ErrorCategory(err error) string {
+	var statusErr *StatusError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var urlErr *url.Error
+
+	switch {
+	case errors.Is(err, ErrRobotsDisallowed):
+		return CategoryRobotsDisallowed
+	case errors.Is(err, ErrOffDomain):
+		return CategoryOffDomain
+	case errors.Is(err, ErrTooLarge):
+		return CategoryTooLarge
+	case errors.Is(err, ErrNonHTML):
+		return CategoryNonHTML
+	case errors.Is(err, ErrParse):
+		return CategoryParse
+	case errors.Is(err, ErrNotRecorded):
+		return CategoryNotRecorded
+	case errors.Is(err, ErrNotListed):
+		return CategoryNotListed
+	case errors.Is(err, ErrDangerousURL):
+		return CategoryDangerous
+	case errors.Is(err, ErrThrottled):
+		return CategoryThrottled
+	case errors.Is(err, ErrSlowBody):
+		return CategorySlowBody
+	case errors.Is(err, ErrRedirectLoop):
+		return CategoryRedirectLoop
+	case errors.Is(err, ErrTooManyRedirects):
+		return CategoryRedirectLimit
+	case errors.Is(err, ErrFetchCommand):
+		return CategoryFetchCommand
+	case errors.Is(err, ErrCircuitOpen):
+		return CategoryCircuitOpen
+	case errors.As(err, &statusErr):
+		return CategoryHTTPStatus
+	case errors.As(err, &dnsErr):
+		return CategoryDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return CategoryTimeout
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr):
+		return CategoryTLS
+	case errors.As(err, &urlErr):
+		return CategoryConnection
+	}
+	return CategoryOther
+}
+
+// isBrokenCategory reports whether errors of category mean the link target
+// is broken, as opposed to skipped by policy.
+func isBrokenCategory(category string) bool {
+	switch category {
+	case CategoryHTTPStatus, CategoryDNS, CategoryTimeout, CategoryTLS, CategoryConnection:
+		return true
+	}
+	return false
+}
+
+// WithErrorHandler registers fn to be called, possibly concurrently, for
+// every URL that fails. err is a *FetchError.
+func WithErrorHandler(fn func(pageURL string, err error)) Option {
+	return func(c *Crawler) {
+		c.errorHandler = fn
+	}
+}
@@ -0,0 +1,138 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// transportError wraps err the way the HTTP client returns it.
+func transportError(err error) error {
+	return &url.Error{Op: "Get", URL: "https://example.com/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: err}}
+}
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		category string
+		// broken and siteFailure are the verdicts of isBrokenCategory and
+		// of the circuit breaker.
+		broken, siteFailure bool
+	}{
+		{"robots", ErrRobotsDisallowed, CategoryRobotsDisallowed, false, false},
+		{"off domain", ErrOffDomain, CategoryOffDomain, false, false},
+		{"too large", ErrTooLarge, CategoryTooLarge, false, false},
+		{"not HTML", ErrNonHTML, CategoryNonHTML, false, false},
+		{"parse", ErrParse, CategoryParse, false, false},
+		{"not recorded", ErrNotRecorded, CategoryNotRecorded, false, false},
+		{"not listed", ErrNotListed, CategoryNotListed, false, false},
+		{"dangerous", ErrDangerousURL, CategoryDangerous, false, false},
+		{"throttled", ErrThrottled, CategoryThrottled, false, true},
+		{"slow body", ErrSlowBody, CategorySlowBody, false, true},
+		{"redirect loop", ErrRedirectLoop, CategoryRedirectLoop, false, false},
+		{"redirect limit", ErrTooManyRedirects, CategoryRedirectLimit, false, false},
+		{"fetch command", fmt.Errorf("%w: exit status 7", ErrFetchCommand), CategoryFetchCommand, false, false},
+		// A URL skipped for an open circuit is no new failure of the site.
+		{"circuit open", ErrCircuitOpen, CategoryCircuitOpen, false, false},
+		{"not found", &StatusError{StatusCode: http.StatusNotFound}, CategoryHTTPStatus, true, false},
+		{"gone", &StatusError{StatusCode: http.StatusGone}, CategoryHTTPStatus, true, false},
+		{"forbidden", &StatusError{StatusCode: http.StatusForbidden}, CategoryHTTPStatus, true, true},
+		{"too many requests", &StatusError{StatusCode: http.StatusTooManyRequests}, CategoryHTTPStatus, true, true},
+		{"server error", &StatusError{StatusCode: http.StatusInternalServerError}, CategoryHTTPStatus, true, true},
+		{"unavailable", &StatusError{StatusCode: http.StatusServiceUnavailable}, CategoryHTTPStatus, true, true},
+		{"no such host", transportError(&net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}), CategoryDNS, true, true},
+		// A DNS timeout is a DNS error.
+		{"DNS timeout", transportError(&net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}), CategoryDNS, true, true},
+		{"deadline", context.DeadlineExceeded, CategoryTimeout, true, true},
+		{"read timeout", transportError(os.ErrDeadlineExceeded), CategoryTimeout, true, true},
+		{"unknown authority", transportError(&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}), CategoryTLS, true, true},
+		{"expired", transportError(&tls.CertificateVerificationError{Err: x509.CertificateInvalidError{Reason: x509.Expired}}), CategoryTLS, true, true},
+		{"bare unknown authority", x509.UnknownAuthorityError{}, CategoryTLS, true, true},
+		{"wrong host", transportError(x509.HostnameError{Host: "example.com", Certificate: &x509.Certificate{}}), CategoryTLS, true, true},
+		{"connection refused", transportError(errors.New("connect: connection refused")), CategoryConnection, true, true},
+		{"other", errors.New("something else"), CategoryOther, false, false},
+	}
+	for _, tt := range tests {
+		for _, err := range []error{tt.err, fmt.Errorf("fetching: %w", tt.err), &FetchError{URL: "https://example.com/", Err: tt.err}} {
+			if category := ErrorCategory(err); category != tt.category {
+				t.Errorf("%s: ErrorCategory(%v) = %s, want %s", tt.name, err, category, tt.category)
+			}
+			if failure := isSiteFailure(err); failure != tt.siteFailure {
+				t.Errorf("%s: isSiteFailure(%v) = %t, want %t", tt.name, err, failure, tt.siteFailure)
+			}
+		}
+		if broken := isBrokenCategory(tt.category); broken != tt.broken {
+			t.Errorf("%s: isBrokenCategory(%s) = %t, want %t", tt.name, tt.category, broken, tt.broken)
+		}
+		fetchErr := &FetchError{URL: "https://example.com/", Err: tt.err}
+		if fetchErr.Category() != tt.category || !errors.Is(fetchErr, tt.err) {
+			t.Errorf("%s: FetchError category %s, want %s and the wrapped error", tt.name, fetchErr.Category(), tt.category)
+		}
+	}
+}
+
+// TestCrawlErrorCategories checks the categories a crawl records and
+// passes to WithErrorHandler.
+func TestCrawlErrorCategories(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + closed.Addr().String() + "/"
+	closed.Close()
+
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/": htmlPage(fmt.Sprintf(`<a href="/missing">missing</a> <a href="/file.pdf">pdf</a> <a href="/broken">broken</a> <a href="%s">refused</a>`, refused)),
+		"/file.pdf": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF-1.7"))
+		},
+		"/broken": func(w http.ResponseWriter, r *http.Request) { http.Error(w, "down", http.StatusBadGateway) },
+	})
+	handled := make(chan *FetchError, 10)
+	result := crawlTestSite(t, site.URL, 1, WithHosts([]HostWeight{{Host: strings.TrimPrefix(site.URL, "http://")}, {Host: closed.Addr().String()}}),
+		WithErrorHandler(func(_ string, err error) {
+			fetchErr, _ := err.(*FetchError)
+			handled <- fetchErr
+		}))
+	close(handled)
+
+	want := map[string]string{
+		site.URL + "/missing":  CategoryHTTPStatus,
+		site.URL + "/file.pdf": CategoryNonHTML,
+		site.URL + "/broken":   CategoryHTTPStatus,
+		refused:                CategoryConnection,
+	}
+	got := make(map[string]string)
+	for _, e := range result.Errors {
+		got[e.URL] = e.Category
+	}
+	for u, category := range want {
+		if got[u] != category {
+			t.Errorf("%s: category %q, want %s (errors %+v)", u, got[u], category, result.Errors)
+		}
+	}
+	n := 0
+	for fetchErr := range handled {
+		if fetchErr == nil {
+			t.Error("the error handler got an error that is not a *FetchError")
+			continue
+		}
+		if category, ok := want[fetchErr.URL]; ok && fetchErr.Category() != category {
+			t.Errorf("%s: handled with category %s, want %s", fetchErr.URL, fetchErr.Category(), category)
+		}
+		n++
+	}
+	if n != len(result.Errors) {
+		t.Errorf("the error handler got %d errors, the crawl recorded %d", n, len(result.Errors))
+	}
+}
@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"fmt"
+	"time"
+)
+
+// longCrawl is the minimum duration above which a page budget is worth a
+// warning even without a duration budget.
+const longCrawl = 24 * time.Hour
+
+// EstimateMinDuration is the shortest time requests take at
+// requestsPerSecond. The crawl rate limiter allows no bursts: the first
+// request is sent at once and every further one waits a full interval,
+// however many links are fetched concurrently. The hosts of WithHosts
+// share that one rate, so their number changes nothing. The estimate
+// leaves out what can only make the crawl slower, as it depends on the
+// URLs found: the limits of WithSlowPatterns and WithSharedLimits, the
+// warmup, throttling and the response times.
+func EstimateMinDuration(requests int, requestsPerSecond float64) time.Duration {
+	if requests <= 1 || !(requestsPerSecond > 0) {
+		return 0
+	}
+	return time.Duration(float64(requests-1) / requestsPerSecond * float64(time.Second))
+}
+
+// BudgetWarnings describes page budgets the crawl rate cannot meet: ones
+// that need longer than maxDuration, or longer than a day.
+func BudgetWarnings(maxPages int, maxDuration time.Duration, requestsPerSecond float64) []string {
+	if maxPages <= 0 {
+		return nil
+	}
+	minimum := EstimateMinDuration(maxPages, requestsPerSecond)
+	switch {
+	case maxDuration > 0 && minimum > maxDuration:
+		reachable := int(maxDuration.Seconds()*requestsPerSecond) + 1
+		return []string{fmt.Sprintf("max pages (%d) at %g requests per second needs at least %s, more than max duration (%s); "+
+			"the crawl will stop at the duration limit after at most %d pages",
+			maxPages, requestsPerSecond, formatEstimate(minimum), maxDuration, reachable)}
+	case maxDuration == 0 && minimum > longCrawl:
+		return []string{fmt.Sprintf("max pages (%d) at %g requests per second needs at least %s",
+			maxPages, requestsPerSecond, formatEstimate(minimum))}
+	}
+	return nil
+}
+
+// formatEstimate rounds d for display, to the second or, beyond an hour,
+// to the minute.
+func formatEstimate(d time.Duration) string {
+	if d >= time.Hour {
+		return d.Round(time.Minute).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// logEstimate logs how long the page budget takes at least, and warns
+// about budgets the crawl rate cannot meet.
+func (c *Crawler) logEstimate() {
+	if c.budget.maxPages <= 0 || c.requestsPerSecond == UnlimitedRPS {
+		return
+	}
+	c.logf("Estimate: %d pages at %g requests per second take at least %s\n", c.budget.maxPages,
+		c.requestsPerSecond, formatEstimate(EstimateMinDuration(c.budget.maxPages, c.requestsPerSecond)))
+	for _, warning := range BudgetWarnings(c.budget.maxPages, c.budget.maxDuration, c.requestsPerSecond) {
+		c.logf("Warning: %s\n", warning)
+	}
+}
+
+// Projections wait for a few fetched pages so the observed rate means
+// something.
+const projectionMinFetched = 10
+
+// watchProjection checks at intervals whether the URLs left to fetch can
+// be fetched within the duration budget at the rate observed so far, and
+// logs a projection the first time they cannot. It returns when done is
+// closed.
+func (c *Crawler) watchProjection(done <-chan struct{}) {
+	interval := min(max(c.budget.maxDuration/20, time.Second), time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if message := c.projection(); message != "" {
+				c.logf("Projection: %s\n", message)
+				return
+			}
+		}
+	}
+}
+
+// projection returns a description of the expected shortfall when the URLs
+// discovered but not yet fetched need longer than the duration budget
+// leaves, or "" when they do not.
+func (c *Crawler) projection() string {
+	stats := c.Stats()
+	if stats.FetchedURLs < projectionMinFetched || stats.Elapsed <= 0 || stats.StopReason != "" {
+		return ""
+	}
+	left := c.budget.maxDuration - stats.Elapsed
+	remaining := stats.DiscoveredURLs - stats.FetchedURLs
+	if c.budget.maxPages > 0 {
+		remaining = min(remaining, c.budget.maxPages-stats.FetchedURLs)
+	}
+	if remaining <= 0 || left <= 0 {
+		return ""
+	}
+	rate := float64(stats.FetchedURLs) / stats.Elapsed.Seconds()
+	needed := time.Duration(float64(remaining) / rate * float64(time.Second))
+	if needed <= left {
+		return ""
+	}
+	return fmt.Sprintf("%d URLs left at the observed %.2f pages per second need about %s, but max duration (%s) leaves %s; "+
+		"the crawl is expected to stop with about %d of them unfetched",
+		remaining, rate, formatEstimate(needed), c.budget.maxDuration, formatEstimate(left),
+		remaining-int(rate*left.Seconds()))
+}
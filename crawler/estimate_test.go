@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateMinDuration(t *testing.T) {
+	tests := []struct {
+		requests int
+		rps      float64
+		want     time.Duration
+	}{
+		{0, 1, 0},
+		{1, 1, 0},
+		{2, 1, time.Second},
+		{11, 10, time.Second},
+		{100001, 0.5, 200000 * time.Second},
+		{10, 0, 0},
+		{10, -1, 0},
+		{10, math.NaN(), 0},
+	}
+	for _, tt := range tests {
+		if got := EstimateMinDuration(tt.requests, tt.rps); got != tt.want {
+			t.Errorf("EstimateMinDuration(%d, %g) = %s, want %s", tt.requests, tt.rps, got, tt.want)
+		}
+	}
+}
+
+func TestBudgetWarnings(t *testing.T) {
+	tests := []struct {
+		maxPages    int
+		maxDuration time.Duration
+		rps         float64
+		want        string
+	}{
+		{0, time.Minute, 0.1, ""},
+		{61, time.Minute, 1, ""},
+		{62, time.Minute, 1, "max pages (62) at 1 requests per second needs at least 1m1s, more than max duration (1m0s); the crawl will stop at the duration limit after at most 61 pages"},
+		{100000, 0, 0.5, "max pages (100000) at 0.5 requests per second needs at least 55h33m"},
+		{86401, 0, 1, ""},
+		{86402, 0, 1, "needs at least 24h0m"},
+		// A duration budget the pages fit in leaves long crawls alone.
+		{100000, 100 * time.Hour, 0.5, ""},
+	}
+	for _, tt := range tests {
+		warnings := BudgetWarnings(tt.maxPages, tt.maxDuration, tt.rps)
+		if tt.want == "" && warnings != nil || tt.want != "" && (len(warnings) != 1 || !strings.Contains(warnings[0], tt.want)) {
+			t.Errorf("BudgetWarnings(%d, %s, %g) = %q, want %q", tt.maxPages, tt.maxDuration, tt.rps, warnings, tt.want)
+		}
+	}
+}
+
+func TestFormatEstimate(t *testing.T) {
+	tests := map[time.Duration]string{
+		1400 * time.Millisecond:                 "1s",
+		59*time.Minute + 59600*time.Millisecond: "1h0m0s",
+		90*time.Minute + 29*time.Second:         "1h30m0s",
+		90*time.Minute + 31*time.Second:         "1h31m0s",
+	}
+	for d, want := range tests {
+		if got := formatEstimate(d); got != want {
+			t.Errorf("formatEstimate(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestProjection(t *testing.T) {
+	c, err := NewCrawler("http://example.com", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	c.budget.maxDuration = time.Minute
+	c.result.StartTime, c.result.EndTime = start, start.Add(10*time.Second)
+	tests := []struct {
+		name                string
+		fetched, discovered int
+		maxPages            int
+		want                string
+	}{
+		// 2 pages per second leave 100 seconds for 200 URLs, with 50 left.
+		{"behind", 20, 220, 0, "200 URLs left at the observed 2.00 pages per second need about 1m40s, but max duration (1m0s) leaves 50s; the crawl is expected to stop with about 100 of them unfetched"},
+		{"on time", 20, 120, 0, ""},
+		// The page budget caps the URLs left.
+		{"page budget", 20, 220, 100, ""},
+		{"too few fetched", projectionMinFetched - 1, 220, 0, ""},
+	}
+	for _, tt := range tests {
+		c.counters.fetched.Store(int64(tt.fetched))
+		c.counters.discovered.Store(int64(tt.discovered))
+		c.budget.maxPages = tt.maxPages
+		if got := c.projection(); got != tt.want {
+			t.Errorf("%s: projection %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	c.counters.fetched.Store(20)
+	c.counters.discovered.Store(220)
+	c.result.StopReason = "max pages (20) reached"
+	if got := c.projection(); got != "" {
+		t.Errorf("projection %q of a stopped crawl", got)
+	}
+}
+
+// TestEstimateHosts checks that a crawl of two hosts takes at least the
+// estimate for its requests: the hosts share the crawl rate.
+func TestEstimateHosts(t *testing.T) {
+	page := htmlPage(`<a href="/a">a</a> <a href="/b">b</a>`)
+	routes := map[string]http.HandlerFunc{"/": page, "/a": page, "/b": page}
+	first, second := newTestSite(t, routes), newTestSite(t, routes)
+	hosts := []HostWeight{{Host: strings.TrimPrefix(first.URL, "http://")}, {Host: strings.TrimPrefix(second.URL, "http://")}}
+
+	const rps = 20
+	c, err := NewCrawler(first.URL, 1, rps, WithHosts(hosts), WithLogOutput(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	result, err := c.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if result.FetchedURLs != 6 {
+		t.Fatalf("%d URLs fetched, want the 3 pages of both hosts (errors %+v)", result.FetchedURLs, result.Errors)
+	}
+	if minimum := EstimateMinDuration(result.FetchedURLs, rps); elapsed < minimum {
+		t.Errorf("%d requests to two hosts took %s, less than the estimate of %s", result.FetchedURLs, elapsed, minimum)
+	}
+}
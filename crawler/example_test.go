@@ -0,0 +1,79 @@
+package crawler_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+
+	"webcrawler/crawler"
+)
+
+// exampleSite serves a home page linking to an about page and a page that
+// does not exist.
+func exampleSite() *httptest.Server {
+	pages := map[string]string{
+		"/":      `<title>Home</title><a href="/about">About</a> <a href="/missing">Missing</a>`,
+		"/about": `<title>About us</title><a href="/">Home</a>`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<html><head>"+page+"</html>")
+	}))
+}
+
+func ExampleNewCrawler() {
+	site := exampleSite()
+	defer site.Close()
+
+	c, err := crawler.NewCrawler(site.URL, 2, 100,
+		crawler.WithLogOutput(io.Discard),
+		crawler.WithMaxPages(500),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	result, err := c.Start(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(result.TotalPages, "pages,", len(result.Errors), "errors")
+	sort.Slice(result.Pages, func(i, j int) bool { return result.Pages[i].URL < result.Pages[j].URL })
+	for _, page := range result.Pages {
+		fmt.Printf("%s %q at depth %d\n", strings.TrimPrefix(page.URL, site.URL), page.Title, page.Depth)
+	}
+	for _, e := range result.Errors {
+		fmt.Println(strings.TrimPrefix(e.URL, site.URL), e.Category, e.StatusCode)
+	}
+	// Output:
+	// 2 pages, 1 errors
+	// / "Home" at depth 0
+	// /about "About us" at depth 1
+	// /missing http-status 404
+}
+
+func ExampleCrawlSite() {
+	site := exampleSite()
+	defer site.Close()
+
+	pages, err := crawler.CrawlSite(context.Background(), site.URL, crawler.Options{MaxDepth: 2, MaxPages: 100, RequestsPerSecond: 100})
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].URL < pages[j].URL })
+	for _, page := range pages {
+		fmt.Println(strings.TrimPrefix(page.URL, site.URL), page.Title)
+	}
+	// Output:
+	// / Home
+	// /about About us
+}
@@ -0,0 +1,298 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrFetchCommand reports a fetch command of WithFetchCommand that failed
+// or printed something other than an HTTP response.
+var ErrFetchCommand = errors.New("fetch command failed")
+
+// execWaitDelay is how long a fetch command may keep its output open after
+// it exits or is killed, such as through a child left behind.
+const execWaitDelay = 2 * time.Second
+
+// maxExecStderr is the length of the standard error of a failed fetch
+// command kept in its error.
+const maxExecStderr = 200
+
+// ParseFetchCommand splits a fetch command, such as
+// "special-curl --silent --include {url}", into its program and arguments
+// the way a shell splits words: single quotes keep everything up to the
+// next one, double quotes keep everything but backslash escapes of \ and ",
+// and a backslash outside quotes escapes the next character. Nothing else
+// is interpreted, so the command is not run through a shell. It must
+// contain {url}.
+func ParseFetchCommand(command string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(command); i++ {
+		ch := command[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case ch == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated ' in fetch command")
+			}
+			word.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case ch == '"':
+			i++
+			for ; i < len(command) && command[i] != '"'; i++ {
+				if command[i] == '\\' && i+1 < len(command) && (command[i+1] == '"' || command[i+1] == '\\') {
+					i++
+				}
+				word.WriteByte(command[i])
+			}
+			if i == len(command) {
+				return nil, fmt.Errorf("unterminated \" in fetch command")
+			}
+			inWord = true
+		case ch == '\\':
+			if i+1 == len(command) {
+				return nil, fmt.Errorf("fetch command ends with a backslash")
+			}
+			i++
+			word.WriteByte(command[i])
+			inWord = true
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("fetch command is empty")
+	}
+	if !slices.ContainsFunc(args[1:], func(arg string) bool { return strings.Contains(arg, "{url}") }) {
+		return nil, fmt.Errorf("fetch command must pass {url} to %s", args[0])
+	}
+	return args, nil
+}
+
+// WithFetchCommand replaces the network transport with a command run per
+// request, for environments that can only reach the site through a
+// special client or a jump host. args, as returned by ParseFetchCommand,
+// are given to the program with {url} and {method} replaced by those of the
+// request in every argument, and {header:Name} by the value of its header
+// Name, empty when it has none. The command must print the response - a
+// status line, headers and a blank line, as curl --include does - followed
+// by the body to its standard output, without following redirects: the
+// crawler follows them. Interim responses, such as 100 Continue or the
+// answer of a proxy to CONNECT, are skipped.
+//
+// The request headers, such as the user agent and Accept-Language, are in
+// the environment of the command as WEBCRAWLER_HEADER_ variables, named
+// after the header in upper case with - and other characters not allowed
+// in names as _, such as WEBCRAWLER_HEADER_USER_AGENT. The values of a
+// header sent more than once are joined with ", ".
+//
+// A command exiting with another status than 0 fails the request with
+// ErrFetchCommand. The request timeout kills the command with its process
+// group. Commands run concurrently up to the limits of the crawl.
+func WithFetchCommand(args []string) Option {
+	return func(c *Crawler) {
+		WithFetcher(&execFetcher{args: args})(c)
+	}
+}
+
+// execFetcher is the Fetcher of WithFetchCommand.
+type execFetcher struct {
+	args []string
+}
+
+func (f *execFetcher) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		// Like http.Transport, a RoundTrip closes the request body.
+		req.Body.Close()
+	}
+	args := make([]string, len(f.args))
+	for i, arg := range f.args {
+		args[i] = expandFetchArg(arg, req)
+	}
+
+	cmd := exec.CommandContext(req.Context(), args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), headerEnv(req.Header)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = execWaitDelay
+	killProcessGroup(cmd)
+	if err := cmd.Run(); err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if msg := lastLine(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s: %v: %s", ErrFetchCommand, args[0], err, msg)
+		}
+		return nil, fmt.Errorf("%w: %s: %v", ErrFetchCommand, args[0], err)
+	}
+
+	resp, err := readCommandResponse(&stdout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s printed no HTTP response: %v", ErrFetchCommand, args[0], err)
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+// expandFetchArg replaces the placeholders of WithFetchCommand in arg by
+// the values of req. Braces around anything else are kept, and the values
+// put in are not expanded again.
+func expandFetchArg(arg string, req *http.Request) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(arg, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(arg[start:], '}')
+		if end < 0 {
+			break
+		}
+		var value string
+		switch name := arg[start+1 : start+end]; {
+		case name == "url":
+			value = req.URL.String()
+		case name == "method":
+			value = req.Method
+		case strings.HasPrefix(name, "header:"):
+			value = req.Header.Get(strings.TrimPrefix(name, "header:"))
+		default:
+			b.WriteString(arg[:start+1])
+			arg = arg[start+1:]
+			continue
+		}
+		b.WriteString(arg[:start])
+		b.WriteString(value)
+		arg = arg[start+end+1:]
+	}
+	b.WriteString(arg)
+	return b.String()
+}
+
+// headerEnv returns header as the WEBCRAWLER_HEADER_ variables of a fetch
+// command, sorted by name.
+func headerEnv(header http.Header) []string {
+	var env []string
+	for _, name := range slices.Sorted(maps.Keys(header)) {
+		key := strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z':
+				return r - 'a' + 'A'
+			case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+				return r
+			}
+			return '_'
+		}, name)
+		env = append(env, "WEBCRAWLER_HEADER_"+key+"="+strings.Join(header[name], ", "))
+	}
+	return env
+}
+
+// readCommandResponse parses the response a fetch command printed to out,
+// skipping interim responses. The body is the rest of out.
+func readCommandResponse(out *bytes.Buffer) (*http.Response, error) {
+	r := bufio.NewReader(out)
+	tp := textproto.NewReader(r)
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		proto, status, _ := strings.Cut(line, " ")
+		major, minor, ok := parseProto(proto)
+		if !ok {
+			return nil, fmt.Errorf("malformed status line %q", line)
+		}
+		codeText, reason, _ := strings.Cut(status, " ")
+		code, err := strconv.Atoi(codeText)
+		if err != nil || code < 100 || code > 999 {
+			return nil, fmt.Errorf("malformed status line %q", line)
+		}
+		header, err := tp.ReadMIMEHeader()
+		// A response without body may end right after its headers.
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		// A proxy tunnel is answered with a 2xx without content before the
+		// response through it.
+		next, _ := r.Peek(5)
+		if code/100 == 1 || code/100 == 2 && len(header) == 0 && string(next) == "HTTP/" {
+			continue
+		}
+		body, _ := io.ReadAll(r)
+		h := http.Header(header)
+		// The body is complete and decoded of any chunking.
+		h.Del("Transfer-Encoding")
+		if reason == "" {
+			reason = http.StatusText(code)
+		}
+		return &http.Response{
+			Status:        strings.TrimSpace(codeText + " " + reason),
+			StatusCode:    code,
+			Proto:         proto,
+			ProtoMajor:    major,
+			ProtoMinor:    minor,
+			Header:        h,
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+		}, nil
+	}
+}
+
+// parseProto parses the version of a status line, such as HTTP/1.1 or
+// HTTP/2 as curl prints it.
+func parseProto(proto string) (major, minor int, ok bool) {
+	version, found := strings.CutPrefix(proto, "HTTP/")
+	if !found {
+		return 0, 0, false
+	}
+	majorText, minorText, hasMinor := strings.Cut(version, ".")
+	major, err := strconv.Atoi(majorText)
+	if err != nil {
+		return 0, 0, false
+	}
+	if hasMinor {
+		if minor, err = strconv.Atoi(minorText); err != nil {
+			return 0, 0, false
+		}
+	}
+	return major, minor, true
+}
+
+// lastLine returns the last non-empty line of s, shortened to
+// maxExecStderr bytes.
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = strings.TrimSpace(s[i+1:])
+	}
+	if len(s) > maxExecStderr {
+		s = s[:maxExecStderr] + "..."
+	}
+	return s
+}
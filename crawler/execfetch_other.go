@@ -0,0 +1,9 @@
+//go:build !unix
+
+package crawler
+
+import "os/exec"
+
+// killProcessGroup leaves cmd as it is: without process groups, cancelling
+// it kills the command alone.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,168 @@
+package crawler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseFetchCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"curl --silent --include {url}", []string{"curl", "--silent", "--include", "{url}"}},
+		{"  curl\t-i\n{url}  ", []string{"curl", "-i", "{url}"}},
+		{`curl -A 'My Bot/1.0 (+http://example.com)' {url}`, []string{"curl", "-A", "My Bot/1.0 (+http://example.com)", "{url}"}},
+		{`curl -H "X-Quote: \"a\" \\ \$b" {url}`, []string{"curl", "-H", `X-Quote: "a" \ \$b`, "{url}"}},
+		{`curl -d 'it'"'"'s' {url}`, []string{"curl", "-d", "it's", "{url}"}},
+		{`curl a\ b\'c {url}`, []string{"curl", "a b'c", "{url}"}},
+		{`curl '' "" {url}`, []string{"curl", "", "", "{url}"}},
+		{`curl --url=prefix{url}suffix`, []string{"curl", "--url=prefix{url}suffix"}},
+		// Shell syntax is passed on as it is.
+		{`curl {url} | tee $HOME/out; rm *`, []string{"curl", "{url}", "|", "tee", "$HOME/out;", "rm", "*"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseFetchCommand(tt.command)
+		if err != nil {
+			t.Errorf("ParseFetchCommand(%q): %v", tt.command, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParseFetchCommand(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+
+	for _, command := range []string{
+		"",
+		"   ",
+		"curl --include",
+		"{url}",
+		"curl 'unterminated {url}",
+		`curl "unterminated {url}`,
+		`curl {url} \`,
+	} {
+		if args, err := ParseFetchCommand(command); err == nil {
+			t.Errorf("ParseFetchCommand(%q) = %q, want an error", command, args)
+		}
+	}
+}
+
+func TestExpandFetchArg(t *testing.T) {
+	// The placeholder in the URL is not expanded again.
+	req, _ := http.NewRequest(http.MethodHead, "http://example.com/a?b=c&d={method}", nil)
+	req.Header.Set("User-Agent", "bot/1.0 (+http://example.com)")
+	req.Header.Set("Accept-Language", "de")
+	tests := []struct {
+		arg, want string
+	}{
+		{"{url}", "http://example.com/a?b=c&d={method}"},
+		{"-X{method}", "-XHEAD"},
+		{"--url={url}#{method}", "--url=http://example.com/a?b=c&d={method}#HEAD"},
+		{"-A{header:User-Agent}", "-Abot/1.0 (+http://example.com)"},
+		{"Accept-Language: {header:accept-language}", "Accept-Language: de"},
+		{"Cookie: {header:Cookie}", "Cookie: "},
+		{"{other} {url", "{other} {url"},
+		{"{{method}}", "{HEAD}"},
+		{"plain", "plain"},
+	}
+	for _, tt := range tests {
+		if got := expandFetchArg(tt.arg, req); got != tt.want {
+			t.Errorf("expandFetchArg(%q) = %q, want %q", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestHeaderEnv(t *testing.T) {
+	header := http.Header{
+		"User-Agent":      {"bot/1.0"},
+		"Accept-Language": {"de"},
+		"X-Two":           {"a", "b"},
+		"X.Odd~Name":      {"v"},
+	}
+	want := []string{
+		"WEBCRAWLER_HEADER_ACCEPT_LANGUAGE=de",
+		"WEBCRAWLER_HEADER_USER_AGENT=bot/1.0",
+		"WEBCRAWLER_HEADER_X_TWO=a, b",
+		"WEBCRAWLER_HEADER_X_ODD_NAME=v",
+	}
+	if got := headerEnv(header); !slices.Equal(got, want) {
+		t.Errorf("headerEnv = %q, want %q", got, want)
+	}
+}
+
+func TestReadCommandResponse(t *testing.T) {
+	tests := []struct {
+		name, out  string
+		status     int
+		proto      string
+		header     string
+		body       string
+		wantStatus string
+	}{
+		{"plain", "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<p>hi</p>", 200, "HTTP/1.1", "text/html", "<p>hi</p>", "200 OK"},
+		{"bare newlines", "HTTP/1.1 404 Not Found\nContent-Type: text/plain\n\nmissing\n", 404, "HTTP/1.1", "text/plain", "missing\n", "404 Not Found"},
+		{"http2 without reason", "HTTP/2 301\r\nLocation: /b\r\nContent-Type: text/plain\r\n\r\n", 301, "HTTP/2", "text/plain", "", "301 Moved Permanently"},
+		{"continue", "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nbody", 200, "HTTP/1.1", "text/plain", "body", "200 OK"},
+		{"early hints", "HTTP/1.1 103 Early Hints\r\nLink: </s.css>; rel=preload\r\n\r\nHTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nbody", 200, "HTTP/1.1", "text/plain", "body", "200 OK"},
+		{"proxy tunnel", "HTTP/1.1 200 Connection established\r\n\r\nHTTP/2 200\r\nContent-Type: text/plain\r\n\r\nthrough", 200, "HTTP/2", "text/plain", "through", "200 OK"},
+		{"tunnel and continue", "HTTP/1.0 200 Connection established\r\n\r\nHTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 500 Internal Server Error\r\nContent-Type: text/plain\r\n\r\nfail", 500, "HTTP/1.1", "text/plain", "fail", "500 Internal Server Error"},
+		{"headers only", "HTTP/1.1 204 No Content\r\nContent-Type: text/plain\r\n\r\n", 204, "HTTP/1.1", "text/plain", "", "204 No Content"},
+		{"no header block end", "HTTP/1.1 204 No Content\r\nContent-Type: text/plain", 204, "HTTP/1.1", "text/plain", "", "204 No Content"},
+		// An empty 200 without a response after it is the response.
+		{"empty 200", "HTTP/1.1 200 OK\r\n\r\n", 200, "HTTP/1.1", "", "", "200 OK"},
+		{"body with status line", "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nHTTP/1.1 500 inside", 200, "HTTP/1.1", "text/plain", "HTTP/1.1 500 inside", "200 OK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := readCommandResponse(bytes.NewBufferString(tt.out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status || resp.Status != tt.wantStatus || resp.Proto != tt.proto {
+				t.Errorf("got %d %q %s, want %d %q %s", resp.StatusCode, resp.Status, resp.Proto, tt.status, tt.wantStatus, tt.proto)
+			}
+			if got := resp.Header.Get("Content-Type"); got != tt.header {
+				t.Errorf("Content-Type = %q, want %q", got, tt.header)
+			}
+			if string(body) != tt.body || resp.ContentLength != int64(len(tt.body)) {
+				t.Errorf("body = %q (length %d), want %q", body, resp.ContentLength, tt.body)
+			}
+		})
+	}
+
+	chunked := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\ndecoded"
+	resp, err := readCommandResponse(bytes.NewBufferString(chunked))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("Transfer-Encoding") != "" {
+		t.Error("Transfer-Encoding is kept on a decoded body")
+	}
+
+	for _, out := range []string{
+		"",
+		"<html>not a response</html>",
+		"HTTP/1.1 abc OK\r\n\r\n",
+		"HTTP/x 200 OK\r\n\r\n",
+		"HTTP/1.1 42 Low\r\n\r\n",
+		"HTTP/1.1 100 Continue\r\n\r\n",
+	} {
+		if _, err := readCommandResponse(bytes.NewBufferString(out)); err == nil {
+			t.Errorf("readCommandResponse(%q) gave no error", out)
+		}
+	}
+}
+
+func TestLastLine(t *testing.T) {
+	if got := lastLine("warning\nsecond\ncurl: (6) Could not resolve host\n\n"); got != "curl: (6) Could not resolve host" {
+		t.Errorf("lastLine = %q", got)
+	}
+	if got := lastLine(strings.Repeat("x", maxExecStderr+10)); got != strings.Repeat("x", maxExecStderr)+"..." {
+		t.Errorf("lastLine does not shorten: %q", got)
+	}
+}
@@ -0,0 +1,144 @@
+//go:build unix
+
+package crawler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCommand writes script as an executable shell script and returns its
+// path.
+func fakeCommand(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fake-curl")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// roundTrip fetches rawURL through the fetch command.
+func roundTrip(t *testing.T, ctx context.Context, command, rawURL string, header http.Header) (*http.Response, error) {
+	t.Helper()
+	args, err := ParseFetchCommand(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return (&execFetcher{args: args}).RoundTrip(req)
+}
+
+func TestExecFetcherArguments(t *testing.T) {
+	// The script prints its arguments and variables one per line as the
+	// body of the response.
+	script := fakeCommand(t, `printf 'HTTP/1.1 100 Continue\r\n\r\n'
+printf 'HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\n'
+for arg in "$@"; do printf '%s\n' "$arg"; done
+printf 'env:%s\n' "$WEBCRAWLER_HEADER_USER_AGENT" "$WEBCRAWLER_HEADER_X_TWO"
+`)
+	header := http.Header{"User-Agent": {"bot/1.0 (+http://example.com)"}, "X-Two": {"a", "b"}}
+	resp, err := roundTrip(t, context.Background(), script+` -X {method} --url '{url}' -A {header:User-Agent} "a b" '$HOME;|*'`,
+		"http://example.com/a b?q=$(id)&r='x'", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	want := strings.Join([]string{
+		"-X", "GET",
+		"--url", "http://example.com/a%20b?q=$(id)&r='x'",
+		"-A", "bot/1.0 (+http://example.com)",
+		"a b",
+		"$HOME;|*",
+		"env:bot/1.0 (+http://example.com)",
+		"env:a, b",
+	}, "\n") + "\n"
+	if string(body) != want {
+		t.Errorf("the command got\n%s\nwant\n%s", body, want)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Request == nil {
+		t.Errorf("status %d, request %v", resp.StatusCode, resp.Request)
+	}
+}
+
+func TestExecFetcherFailure(t *testing.T) {
+	script := fakeCommand(t, `echo 'first line' >&2
+echo 'curl: (6) Could not resolve host: example.com' >&2
+exit 6`)
+	_, err := roundTrip(t, context.Background(), script+" {url}", "http://example.com/", nil)
+	if !errors.Is(err, ErrFetchCommand) {
+		t.Fatalf("error %v is not ErrFetchCommand", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "exit status 6") || !strings.Contains(msg, "Could not resolve host") || strings.Contains(msg, "first line") {
+		t.Errorf("error %q lacks the exit status or the last line of stderr", msg)
+	}
+	if ErrorCategory(err) != CategoryFetchCommand {
+		t.Errorf("category %s, want %s", ErrorCategory(err), CategoryFetchCommand)
+	}
+
+	script = fakeCommand(t, `echo '<html>no headers</html>'`)
+	if _, err := roundTrip(t, context.Background(), script+" {url}", "http://example.com/", nil); !errors.Is(err, ErrFetchCommand) {
+		t.Errorf("output without a status line gave %v, want ErrFetchCommand", err)
+	}
+
+	if _, err := roundTrip(t, context.Background(), filepath.Join(t.TempDir(), "missing")+" {url}", "http://example.com/", nil); !errors.Is(err, ErrFetchCommand) {
+		t.Errorf("a missing command gave %v, want ErrFetchCommand", err)
+	}
+}
+
+// TestExecFetcherTimeout checks that the timeout of a request kills the
+// command and the children it started.
+func TestExecFetcherTimeout(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "survived")
+	script := fakeCommand(t, `(sleep 1; touch '`+marker+`') &
+sleep 30
+printf 'HTTP/1.1 200 OK\r\n\r\n'`)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := roundTrip(t, ctx, script+" {url}", "http://example.com/", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error %v, want the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > execWaitDelay {
+		t.Errorf("the command was stopped after %s", elapsed)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("a child of the command outlived the timeout")
+	}
+}
+
+// TestCrawlWithFetchCommand crawls a site served by a fetch command.
+func TestCrawlWithFetchCommand(t *testing.T) {
+	script := fakeCommand(t, `case "$1" in
+*/about) printf 'HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<title>About</title>' ;;
+*/old) printf 'HTTP/1.1 301 Moved Permanently\r\nLocation: /about\r\n\r\n' ;;
+*/) printf 'HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<a href="/old">old</a> <a href="/gone">gone</a>' ;;
+*) printf 'HTTP/1.1 404 Not Found\r\nContent-Type: text/plain\r\n\r\nnot found' ;;
+esac`)
+	args, err := ParseFetchCommand(script + " {url}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := crawlTestSite(t, "http://intranet.example", 2, WithFetchCommand(args))
+	if page := findPage(result, "http://intranet.example", "/old"); page == nil || page.FinalURL != "http://intranet.example/about" {
+		t.Errorf("the redirect of /old is not followed: %+v", page)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].StatusCode != http.StatusNotFound {
+		t.Errorf("errors %+v, want the 404 of /gone", result.Errors)
+	}
+}
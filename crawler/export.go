@@ -0,0 +1,210 @@
+package crawler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Output formats accepted by WithOutputFormat.
+const (
+	FormatJSON    = "json"
+	FormatCSV     = "csv"
+	FormatXLSX    = "xlsx"
+	FormatParquet = "parquet"
+)
+
+// maxXLSXRows is the largest sheet written as xlsx. Bigger crawls fall back
+// to CSV because spreadsheet applications cope poorly beyond this size.
+const maxXLSXRows = 500000
+
+const resultsBaseName = "crawl_results"
+
+// WithOutputFormat selects the file format Start saves results in when
+// WithOutputPath is given.
+func WithOutputFormat(format string) Option {
+	return func(c *Crawler) {
+		c.outputFormat = strings.ToLower(strings.TrimSpace(format))
+	}
+}
+
+func ValidOutputFormat(format string) bool {
+	switch format {
+	case FormatJSON, FormatCSV, FormatXLSX, FormatParquet:
+		return true
+	}
+	return false
+}
+
+// csvPageHeader and pageRow define the per-page columns shared by the CSV
+// export and the Pages sheet of the xlsx export.
+var csvPageHeader = []string{
+	"url", "final_url", "status_code", "title", "depth", "links", "response_time_ms", "crawled_at",
+}
+
+func pageRow(page PageData) []xlsxCell {
+	return []xlsxCell{
+		linkCell(page.URL),
+		linkCell(page.FinalURL),
+		intCell(int64(page.StatusCode)),
+		textCell(page.Title),
+		intCell(int64(page.Depth)),
+		intCell(int64(len(page.Links))),
+		intCell(page.ResponseTime),
+		textCell(page.CrawledAt.Format(time.RFC3339)),
+	}
+}
+
+// saveOutput writes the result in the configured format and returns the
+// name of the file written. Spilled pages are read back from disk.
+func (c *Crawler) saveOutput() (string, error) {
+	c.resultLock.Lock()
+	defer c.resultLock.Unlock()
+
+	format := c.outputFormat
+	if format == FormatXLSX && c.storedPages() > maxXLSXRows {
+		c.logf("Warning: %d pages exceed the xlsx limit of %d rows, saving as CSV instead\n",
+			c.storedPages(), maxXLSXRows)
+		format = FormatCSV
+	}
+
+	if c.splitByHost {
+		return c.saveSplitResults(format)
+	}
+	filename := c.outputFilename(format)
+	var err error
+	switch format {
+	case FormatCSV:
+		err = writePagesCSV(filename, c.pageSource())
+	case FormatXLSX:
+		// The report sheets only need the page summaries.
+		summaries, serr := c.pageSummaries()
+		if serr != nil {
+			return filename, serr
+		}
+		result := c.result
+		result.Pages = summaries
+		err = writeXLSXReport(filename, &result, c.pageSource())
+	case FormatParquet:
+		err = writePagesParquet(filename, c.pageSource(), c.parquetRowGroup)
+	default:
+		err = c.saveResults(filename)
+	}
+	if err == nil {
+		err = c.artifacts.addFile(ArtifactResults, filename, format)
+	}
+	return filename, err
+}
+
+func writePagesCSV(filename string, pages pageSource) error {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write(csvPageHeader)
+	err = pages(func(batch []PageData) error {
+		for _, page := range batch {
+			cells := pageRow(page)
+			record := make([]string, len(cells))
+			for i, cell := range cells {
+				record[i] = cell.value
+			}
+			w.Write(record)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing CSV: %v", err)
+	}
+	return nil
+}
+
+// writeXLSXReport writes a workbook with one sheet per report section:
+// Pages, Broken Links, Redirects and Duplicate Titles. The Pages sheet is
+// read from pages; the others are computed from result.Pages.
+func writeXLSXReport(filename string, result *CrawlResult, pages pageSource) (err error) {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("error writing xlsx: %v", cerr)
+		}
+	}()
+
+	x := newXLSXWriter(file)
+	if err := writeXLSXSheets(x, result, pages); err != nil {
+		return fmt.Errorf("error writing xlsx: %v", err)
+	}
+	if err := x.Close(); err != nil {
+		return fmt.Errorf("error writing xlsx: %v", err)
+	}
+	return nil
+}
+
+// writeXLSXSheets adds the sheets of writeXLSXReport to x, stopping at the
+// first error.
+func writeXLSXSheets(x *xlsxWriter, result *CrawlResult, pages pageSource) error {
+	if err := x.addSheet("Pages", csvPageHeader); err != nil {
+		return err
+	}
+	err := pages(func(batch []PageData) error {
+		for _, page := range batch {
+			if err := x.addRow(pageRow(page)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := x.addSheet("Broken Links", []string{"source_page", "url", "status_code", "error"}); err != nil {
+		return err
+	}
+	for _, link := range FindBrokenLinks(result) {
+		if err := x.addRow(linkCell(link.SourcePage), linkCell(link.URL), intCell(int64(link.StatusCode)), textCell(link.Error)); err != nil {
+			return err
+		}
+	}
+
+	if err := x.addSheet("Redirects", []string{"url", "final_url", "status_code", "hops"}); err != nil {
+		return err
+	}
+	for _, page := range result.Pages {
+		if len(page.RedirectChain) == 0 {
+			continue
+		}
+		err := x.addRow(
+			linkCell(page.URL),
+			linkCell(page.FinalURL),
+			intCell(int64(page.RedirectChain[0].StatusCode)),
+			intCell(int64(len(page.RedirectChain))),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := x.addSheet("Duplicate Titles", []string{"title", "page_count", "url"}); err != nil {
+		return err
+	}
+	for _, duplicate := range FindDuplicateTitles(result.Pages) {
+		for _, pageURL := range duplicate.URLs {
+			if err := x.addRow(textCell(duplicate.Title), intCell(int64(len(duplicate.URLs))), linkCell(pageURL)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
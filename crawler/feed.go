@@ -0,0 +1,313 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// maxFeedSize bounds the size of a feed, after decompression.
+const maxFeedSize = 10 << 20
+
+// Statuses of a FeedItem besides the edge statuses of the URLs that were
+// not requested, such as EdgeOffDomain or EdgeFiltered.
+const (
+	FeedItemFailed     = "failed"
+	FeedItemNotCrawled = "not-crawled"
+)
+
+// WithFeeds seeds the crawl with the item URLs of the RSS 2.0, RSS 1.0 or
+// Atom feeds at feedURLs, which may be paths relative to the base URL.
+// Gzipped feeds and feeds behind redirects are read. Same-domain items are
+// crawled at depth 0 like the seed; the others are recorded in FeedItems
+// and not requested. A feed that cannot be read is logged and recorded in
+// Feeds; as the seed URL is always crawled, it does not stop the crawl.
+func WithFeeds(feedURLs []string) Option {
+	return func(c *Crawler) {
+		c.feedURLs = feedURLs
+	}
+}
+
+// Feed is a feed read at the start of the crawl.
+type Feed struct {
+	URL string `json:"url"`
+	// FinalURL is set when the feed was redirected to another URL, which
+	// relative item links are resolved against.
+	FinalURL string `json:"final_url,omitempty"`
+	Items    int    `json:"items"`
+	Error    string `json:"error,omitempty"`
+}
+
+// FeedItem is an item URL listed in a feed. Status is EdgeCrawled,
+// FeedItemFailed or FeedItemNotCrawled for the URLs the crawl was to
+// request, or the edge status of a URL it would not request, such as
+// EdgeOffDomain. StatusCode and Category come from the page or the error
+// recorded for the URL.
+type FeedItem struct {
+	URL        string     `json:"url"`
+	Feed       string     `json:"feed"`
+	Published  *time.Time `json:"published,omitempty"`
+	Status     string     `json:"status"`
+	StatusCode int        `json:"status_code,omitempty"`
+	Category   string     `json:"category,omitempty"`
+}
+
+// queued reports whether the crawl was to request the item, so its status
+// depends on the pages and errors of the crawl. Items of another shard are
+// settled when the shards are merged.
+func (item *FeedItem) queued() bool {
+	switch item.Status {
+	case "", EdgeCrawled, FeedItemFailed, FeedItemNotCrawled, EdgeOtherShard:
+		return true
+	}
+	return false
+}
+
+// feedDocument is an RSS 2.0 (<rss><channel><item>), RSS 1.0 (<rdf:RDF>
+// <item>) or Atom (<feed><entry>) document.
+type feedDocument struct {
+	XMLName xml.Name
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Links   []string `xml:"link"`
+	GUID    rssGUID  `xml:"guid"`
+	PubDate string   `xml:"pubDate"`
+	Date    string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr"`
+}
+
+type atomEntry struct {
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+}
+
+// feedEntry is an item link of a feed with its publication date.
+type feedEntry struct {
+	link      string
+	published string
+}
+
+// entries returns the item links of doc, in document order.
+func (doc *feedDocument) entries() []feedEntry {
+	var entries []feedEntry
+	for _, item := range append(doc.Channel.Items, doc.Items...) {
+		link := ""
+		for _, l := range item.Links {
+			if link = strings.TrimSpace(l); link != "" {
+				break
+			}
+		}
+		if guid := strings.TrimSpace(item.GUID.Value); link == "" && item.GUID.IsPermaLink != "false" && strings.HasPrefix(guid, "http") {
+			link = guid
+		}
+		published := item.PubDate
+		if published == "" {
+			published = item.Date
+		}
+		entries = append(entries, feedEntry{link: link, published: published})
+	}
+	for _, entry := range doc.Entries {
+		link := ""
+		for _, l := range entry.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				link = strings.TrimSpace(l.Href)
+				break
+			}
+		}
+		published := entry.Published
+		if published == "" {
+			published = entry.Updated
+		}
+		entries = append(entries, feedEntry{link: link, published: published})
+	}
+	return entries
+}
+
+// feedDateLayouts are the date formats found in the wild in RSS pubDate,
+// dc:date and Atom published elements.
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	time.DateOnly,
+}
+
+// parseFeedDate parses a feed date, returning nil if no layout fits.
+func parseFeedDate(value string) *time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			t = t.UTC()
+			return &t
+		}
+	}
+	return nil
+}
+
+// loadFeeds reads the configured feeds and returns the item URLs to crawl.
+// Every item is recorded in c.feedItems and every feed in c.feeds.
+func (c *Crawler) loadFeeds() []sitemapSeed {
+	var seeds []sitemapSeed
+	seen := make(map[string]bool)
+	for _, raw := range c.feedURLs {
+		feed := Feed{URL: raw}
+		start, err := c.baseURL.Parse(raw)
+		if err != nil {
+			feed.Error = fmt.Sprintf("invalid feed URL: %v", err)
+			c.logf("Warning: invalid feed URL %q: %v\n", raw, err)
+			c.feeds = append(c.feeds, feed)
+			continue
+		}
+		feed.URL = start.String()
+		doc, final, err := c.fetchFeed(feed.URL)
+		if err != nil {
+			feed.Error = err.Error()
+			c.logf("Warning: cannot read feed %s: %v\n", feed.URL, err)
+			c.feeds = append(c.feeds, feed)
+			continue
+		}
+		if final.String() != feed.URL {
+			feed.FinalURL = final.String()
+		}
+
+		queued := 0
+		for _, entry := range doc.entries() {
+			if entry.link == "" {
+				continue
+			}
+			feed.Items++
+			item := FeedItem{URL: entry.link, Feed: feed.URL, Published: parseFeedDate(entry.published)}
+			if u, err := final.Parse(entry.link); err != nil {
+				item.Status = EdgeUnsupportedScheme
+			} else if target, status, _ := c.linkStatus(u, -1, feed.URL); status == EdgeUnsupportedScheme {
+				item.Status = status
+			} else {
+				item.URL, item.Status = target, status
+			}
+			if seen[item.URL] {
+				continue
+			}
+			seen[item.URL] = true
+			c.feedItems = append(c.feedItems, item)
+			if item.Status == EdgeCrawled {
+				seeds = append(seeds, sitemapSeed{url: item.URL, sitemap: feed.URL})
+				queued++
+			}
+		}
+		c.feeds = append(c.feeds, feed)
+		c.logf("Feed %s: %d items, %d URLs to crawl\n", feed.URL, feed.Items, queued)
+	}
+	return seeds
+}
+
+// fetchFeed downloads and parses one feed, gzipped or not, waiting on the
+// crawl rate limiter first. It returns the URL the feed was served from.
+func (c *Crawler) fetchFeed(feedURL string) (*feedDocument, *url.URL, error) {
+	c.waitRate()
+	req, err := c.newRequest(feedURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.client.Do(req.WithContext(c.ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	body := &countingReader{r: resp.Body}
+	defer func() { c.addBytesFetched(body.n) }()
+	buffered := bufio.NewReader(io.LimitReader(body, maxFeedSize))
+	var reader io.Reader = buffered
+	// A gzipped file, as opposed to a gzip Content-Encoding the client
+	// already decoded, is recognized by its magic number.
+	if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		reader = io.LimitReader(gz, maxFeedSize)
+	}
+
+	var doc feedDocument
+	decoder := xml.NewDecoder(reader)
+	decoder.CharsetReader = charset.NewReaderLabel
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("cannot parse feed: %v", err)
+	}
+	switch doc.XMLName.Local {
+	case "rss", "RDF", "feed":
+	default:
+		return nil, nil, fmt.Errorf("not an RSS or Atom feed: the root element is <%s>", doc.XMLName.Local)
+	}
+	return &doc, resp.Request.URL, nil
+}
+
+// feedStatuses settles the status of the queued feed items from the pages
+// and errors of the crawl. pages are the page summaries. It must be called
+// with resultLock held.
+func (c *Crawler) feedStatuses(pages []PageData) []FeedItem {
+	if len(c.feedItems) == 0 {
+		return nil
+	}
+	codes := make(map[string]int)
+	for _, page := range pages {
+		if _, ok := codes[page.URL]; !ok {
+			codes[page.URL] = page.StatusCode
+		}
+	}
+	failures := make(map[string]CrawlError)
+	for _, crawlErr := range c.result.Errors {
+		if _, ok := failures[crawlErr.URL]; !ok {
+			failures[crawlErr.URL] = crawlErr
+		}
+	}
+	items := make([]FeedItem, len(c.feedItems))
+	for i, item := range c.feedItems {
+		if item.queued() {
+			item.StatusCode, item.Category = 0, ""
+			if code, ok := codes[item.URL]; ok {
+				item.Status, item.StatusCode = EdgeCrawled, code
+			} else if crawlErr, ok := failures[item.URL]; ok {
+				item.Status, item.StatusCode, item.Category = FeedItemFailed, crawlErr.StatusCode, crawlErr.Category
+			} else if item.Status != EdgeOtherShard || c.shard.count == 0 {
+				item.Status = FeedItemNotCrawled
+			}
+		}
+		items[i] = item
+	}
+	return items
+}
@@ -0,0 +1,58 @@
+package crawler
+
+import "net/http"
+
+// Fetcher performs a single HTTP exchange. It has the contract of
+// http.RoundTripper: redirects, cookies and timeouts are handled by the
+// crawler's client around it, so a Fetcher sees every redirect hop as a
+// separate request.
+type Fetcher interface {
+	RoundTrip(req *http.Request) (*http.Response, error)
+}
+
+// FetcherMiddleware wraps a Fetcher to observe or alter exchanges.
+type FetcherMiddleware func(next Fetcher) Fetcher
+
+// WithFetcher replaces the network transport with f.
+func WithFetcher(f Fetcher) Option {
+	return func(c *Crawler) {
+		c.fetcher = f
+	}
+}
+
+// WithFetcherMiddleware wraps the fetcher with m. Middleware registered
+// first is outermost.
+func WithFetcherMiddleware(m FetcherMiddleware) Option {
+	return func(c *Crawler) {
+		c.middleware = append(c.middleware, m)
+	}
+}
+
+// buildFetcher composes the configured fetcher and middleware into the
+// transport used by the crawler's client.
+func (c *Crawler) buildFetcher() Fetcher {
+	f := c.fetcher
+	if f == nil {
+		f = http.DefaultTransport
+	}
+	f = c.dnsTrace(f)
+	if c.requestsPerSecond == UnlimitedRPS {
+		f = c.inFlightSlots(f)
+	}
+	if c.warmup.enabled {
+		f = c.warmupSlots(f)
+	}
+	if c.sharedLimits != nil {
+		f = c.sharedSlots(f)
+	}
+	if c.list != nil {
+		f = c.listGuard(f)
+	}
+	if !c.allowDangerous {
+		f = c.dangerGuard(f)
+	}
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		f = c.middleware[i](f)
+	}
+	return f
+}
@@ -0,0 +1,88 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// WithURLFilters restricts the links that are crawled. include and exclude
+// are regular expressions matched against normalized URLs: when include is
+// not empty a link must match one of its patterns, and links matching any
+// exclude pattern are skipped. The seed URL is always crawled.
+func WithURLFilters(include, exclude []string) Option {
+	return func(c *Crawler) {
+		c.includePatterns = include
+		c.excludePatterns = exclude
+	}
+}
+
+// CompilePatterns compiles include or exclude patterns, naming the pattern
+// that fails.
+func CompilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithMaxPathDepth skips the URLs whose path has more than n segments, so
+// /a/b/c is crawled at n = 3 and /a/b/c/d is not, however few links away it
+// is. It is independent of the link depth limit. Zero n is unlimited. The
+// seed URL is always crawled.
+func WithMaxPathDepth(n int) Option {
+	return func(c *Crawler) {
+		c.maxPathDepth = n
+	}
+}
+
+// PathDepth returns the number of segments of the path of a normalized
+// URL. Empty segments, from a trailing slash or a double slash, are not
+// counted, so / is 0 and /a//b/ is 2.
+func PathDepth(pageURL string) int {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, segment := range strings.Split(u.EscapedPath(), "/") {
+		if segment != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// withinPathDepth reports whether a normalized URL is within the path
+// depth limit, counting the URLs that are not.
+func (c *Crawler) withinPathDepth(target string) bool {
+	if c.maxPathDepth <= 0 || PathDepth(target) <= c.maxPathDepth {
+		return true
+	}
+	c.counters.pathDepthSkips.Add(1)
+	return false
+}
+
+// passesFilters reports whether a normalized link URL may be crawled under
+// the include and exclude patterns.
+func (c *Crawler) passesFilters(linkURL string) bool {
+	if len(c.include) > 0 && !matchesAny(c.include, linkURL) {
+		return false
+	}
+	return !matchesAny(c.exclude, linkURL)
+}
@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Changes of a section between two fingerprints, in SectionChange.Change.
+const (
+	FingerprintAdded   = "added"
+	FingerprintRemoved = "removed"
+	FingerprintChanged = "changed"
+)
+
+// Fingerprint summarizes a crawl in a hash that changes when any URL of it
+// answers differently, to tell cheaply whether a site changed between two
+// runs. Every stored page, redirect and crawl error is a tuple of its URL,
+// language included, its status and its content: the content hash of a
+// page, the target of a redirect, the category of an error. Hash is
+// computed over the hashes of Sections, which cover the tuples of every
+// top-level path section, sorted by URL. Times, response times and error
+// messages are left out, so crawls of an unchanged site give the same
+// fingerprint.
+type Fingerprint struct {
+	Hash     string               `json:"hash"`
+	URLs     int                  `json:"urls"`
+	Sections []SectionFingerprint `json:"sections"`
+}
+
+// SectionFingerprint is the fingerprint of the URLs of one top-level path
+// section, such as /blog.
+type SectionFingerprint struct {
+	Section string `json:"section"`
+	Hash    string `json:"hash"`
+	URLs    int    `json:"urls"`
+}
+
+// SectionChange is a section whose fingerprint differs between two crawls,
+// with the URLs it had in each.
+type SectionChange struct {
+	Section      string `json:"section"`
+	Change       string `json:"change"`
+	PreviousURLs int    `json:"previous_urls"`
+	URLs         int    `json:"urls"`
+}
+
+// fingerprintTuple is a URL of a crawl as its fingerprint covers it.
+type fingerprintTuple struct {
+	key     string
+	line    string
+	section string
+}
+
+// ComputeFingerprint returns the fingerprint of the pages and errors of a
+// crawl.
+func ComputeFingerprint(pages []PageData, errs []CrawlError) *Fingerprint {
+	tuples := make([]fingerprintTuple, 0, len(pages)+len(errs))
+	add := func(language, url string, status int, content string) {
+		key := languageKey(language, url)
+		tuples = append(tuples, fingerprintTuple{
+			key:     key,
+			line:    key + "\t" + strconv.Itoa(status) + "\t" + content,
+			section: PathSectionOf(url, 1),
+		})
+	}
+	for _, page := range pages {
+		if page.UnfollowedRedirect != "" {
+			add(page.Language, page.URL, page.StatusCode, "redirect "+page.UnfollowedRedirect)
+			continue
+		}
+		target := page.URL
+		if page.FinalURL != "" && page.FinalURL != page.URL {
+			// Whether a redirect is stored as an alias or as the page it
+			// leads to depends on the order of the fetches, so both give
+			// the redirect and, once, the target.
+			status := page.StatusCode
+			if len(page.RedirectChain) > 0 {
+				status = page.RedirectChain[0].StatusCode
+			}
+			add(page.Language, page.URL, status, "redirect "+page.FinalURL)
+			target = page.FinalURL
+		}
+		if page.Alias {
+			continue
+		}
+		content := page.ContentHash
+		if page.Change == ChangeUnchanged {
+			content = ChangeUnchanged
+		}
+		add(page.Language, target, page.StatusCode, content)
+	}
+	for _, e := range errs {
+		add(e.Language, e.URL, e.StatusCode, "error "+e.Category)
+	}
+	sort.Slice(tuples, func(i, j int) bool {
+		if tuples[i].key != tuples[j].key {
+			return tuples[i].key < tuples[j].key
+		}
+		return tuples[i].line < tuples[j].line
+	})
+
+	sections := make(map[string][]string)
+	for _, t := range tuples {
+		sections[t.section] = append(sections[t.section], t.line)
+	}
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fp := &Fingerprint{URLs: len(tuples), Sections: make([]SectionFingerprint, 0, len(names))}
+	root := sha256.New()
+	for _, name := range names {
+		section := sha256.New()
+		for _, line := range sections[name] {
+			leaf := sha256.Sum256([]byte(line))
+			section.Write(leaf[:])
+		}
+		hash := hex.EncodeToString(section.Sum(nil)[:16])
+		fp.Sections = append(fp.Sections, SectionFingerprint{Section: name, Hash: hash, URLs: len(sections[name])})
+		fmt.Fprintf(root, "%s\t%s\n", name, hash)
+	}
+	fp.Hash = hex.EncodeToString(root.Sum(nil)[:16])
+	return fp
+}
+
+// LoadFingerprint returns the fingerprint of the crawl results saved in
+// filename, computing it for results saved without one.
+func LoadFingerprint(filename string) (*Fingerprint, error) {
+	result, err := LoadResults(filename)
+	if err != nil {
+		return nil, err
+	}
+	if result.Fingerprint != nil {
+		return result.Fingerprint, nil
+	}
+	return ComputeFingerprint(result.Pages, result.Errors), nil
+}
+
+// CompareFingerprints returns the sections whose fingerprint differs
+// between the previous and the current crawl, by section. It is empty when
+// the fingerprints are equal.
+func CompareFingerprints(previous, current *Fingerprint) []SectionChange {
+	if previous.Hash == current.Hash {
+		return nil
+	}
+	before := make(map[string]SectionFingerprint, len(previous.Sections))
+	for _, s := range previous.Sections {
+		before[s.Section] = s
+	}
+	var changes []SectionChange
+	for _, s := range current.Sections {
+		old, ok := before[s.Section]
+		delete(before, s.Section)
+		switch {
+		case !ok:
+			changes = append(changes, SectionChange{Section: s.Section, Change: FingerprintAdded, URLs: s.URLs})
+		case old.Hash != s.Hash:
+			changes = append(changes, SectionChange{Section: s.Section, Change: FingerprintChanged, PreviousURLs: old.URLs, URLs: s.URLs})
+		}
+	}
+	for _, old := range before {
+		changes = append(changes, SectionChange{Section: old.Section, Change: FingerprintRemoved, PreviousURLs: old.URLs})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Section < changes[j].Section })
+	return changes
+}
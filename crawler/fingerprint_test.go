@@ -0,0 +1,208 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fingerprintPages are the pages of a small crawl over the sections /,
+// /blog and /docs.
+func fingerprintPages() []PageData {
+	return []PageData{
+		{URL: "http://example.com/", StatusCode: 200, ContentHash: "home"},
+		{URL: "http://example.com/blog/1", StatusCode: 200, ContentHash: "post 1"},
+		{URL: "http://example.com/blog/2", StatusCode: 200, ContentHash: "post 2"},
+		{URL: "http://example.com/docs/a", StatusCode: 200, ContentHash: "doc a"},
+	}
+}
+
+func TestComputeFingerprint(t *testing.T) {
+	errs := []CrawlError{{URL: "http://example.com/docs/gone", StatusCode: 404, Category: CategoryHTTPStatus, Error: "404 Not Found"}}
+	fp := ComputeFingerprint(fingerprintPages(), errs)
+	if fp.URLs != 5 || len(fp.Sections) != 3 {
+		t.Fatalf("fingerprint %+v, want 5 URLs in 3 sections", fp)
+	}
+	for i, want := range []SectionFingerprint{{Section: "/", URLs: 1}, {Section: "/blog", URLs: 2}, {Section: "/docs", URLs: 2}} {
+		if s := fp.Sections[i]; s.Section != want.Section || s.URLs != want.URLs || len(s.Hash) != 32 {
+			t.Errorf("section %d: %+v, want %s with %d URLs", i, s, want.Section, want.URLs)
+		}
+	}
+
+	// The order of the pages, times and error messages do not count.
+	pages := fingerprintPages()
+	slices.Reverse(pages)
+	for i := range pages {
+		pages[i].CrawledAt = time.Now()
+		pages[i].ResponseTime = int64(i)
+	}
+	moved := []CrawlError{{URL: "http://example.com/docs/gone", StatusCode: 404, Category: CategoryHTTPStatus, Error: "gone", Time: time.Now()}}
+	if again := ComputeFingerprint(pages, moved); again.Hash != fp.Hash {
+		t.Errorf("fingerprint %s of the same crawl in another order, want %s", again.Hash, fp.Hash)
+	}
+
+	// A content change changes its section only.
+	pages = fingerprintPages()
+	pages[2].ContentHash = "post 2, edited"
+	changed := ComputeFingerprint(pages, errs)
+	if changed.Hash == fp.Hash {
+		t.Fatal("a changed page leaves the fingerprint as it was")
+	}
+	for i, s := range changed.Sections {
+		if (s.Hash != fp.Sections[i].Hash) != (s.Section == "/blog") {
+			t.Errorf("section %s: %s, was %s", s.Section, s.Hash, fp.Sections[i].Hash)
+		}
+	}
+	// So do a status and the category of an error.
+	pages = fingerprintPages()
+	pages[3].StatusCode = 203
+	if ComputeFingerprint(pages, errs).Hash == fp.Hash {
+		t.Error("a changed status leaves the fingerprint as it was")
+	}
+	if ComputeFingerprint(fingerprintPages(), []CrawlError{{URL: errs[0].URL, Category: CategoryTimeout}}).Hash == fp.Hash {
+		t.Error("a changed error leaves the fingerprint as it was")
+	}
+
+	// Language passes crawl the same URL once per language.
+	pages = fingerprintPages()
+	pages[0].Language = "de"
+	if ComputeFingerprint(pages, errs).Hash == fp.Hash {
+		t.Error("the language of a page does not count")
+	}
+
+	if empty := ComputeFingerprint(nil, nil); empty.URLs != 0 || len(empty.Sections) != 0 || empty.Hash != ComputeFingerprint(nil, nil).Hash {
+		t.Errorf("fingerprint of an empty crawl %+v", empty)
+	}
+}
+
+// TestFingerprintRedirects checks that a redirect stored as the page it
+// leads to, or as an alias of that page fetched first, gives the same
+// fingerprint.
+func TestFingerprintRedirects(t *testing.T) {
+	chain := []RedirectHop{{URL: "http://example.com/new", StatusCode: 301}}
+	followed := []PageData{{URL: "http://example.com/old", FinalURL: "http://example.com/new", RedirectChain: chain, StatusCode: 200, ContentHash: "new"}}
+	aliased := []PageData{
+		{URL: "http://example.com/new", StatusCode: 200, ContentHash: "new"},
+		{URL: "http://example.com/old", FinalURL: "http://example.com/new", RedirectChain: chain, StatusCode: 200, Alias: true},
+	}
+	a, b := ComputeFingerprint(followed, nil), ComputeFingerprint(aliased, nil)
+	if a.Hash != b.Hash || a.URLs != 2 {
+		t.Errorf("fingerprints %+v and %+v of the same redirect, want them equal with 2 URLs", a, b)
+	}
+	unfollowed := []PageData{{URL: "http://example.com/old", StatusCode: 301, UnfollowedRedirect: "http://other.example/"}}
+	if fp := ComputeFingerprint(unfollowed, nil); fp.URLs != 1 || fp.Hash == a.Hash {
+		t.Errorf("fingerprint %+v of an unfollowed redirect", fp)
+	}
+}
+
+func TestCompareFingerprints(t *testing.T) {
+	previous := &Fingerprint{Hash: "a", Sections: []SectionFingerprint{
+		{Section: "/", Hash: "1", URLs: 1},
+		{Section: "/blog", Hash: "2", URLs: 4},
+		{Section: "/old", Hash: "3", URLs: 2},
+	}}
+	if changes := CompareFingerprints(previous, previous); changes != nil {
+		t.Errorf("changes %+v between equal fingerprints", changes)
+	}
+	current := &Fingerprint{Hash: "b", Sections: []SectionFingerprint{
+		{Section: "/", Hash: "1", URLs: 1},
+		{Section: "/blog", Hash: "4", URLs: 5},
+		{Section: "/new", Hash: "5", URLs: 3},
+	}}
+	want := []SectionChange{
+		{Section: "/blog", Change: FingerprintChanged, PreviousURLs: 4, URLs: 5},
+		{Section: "/new", Change: FingerprintAdded, URLs: 3},
+		{Section: "/old", Change: FingerprintRemoved, PreviousURLs: 2},
+	}
+	if changes := CompareFingerprints(previous, current); !slices.Equal(changes, want) {
+		t.Errorf("changes %+v, want %+v", changes, want)
+	}
+}
+
+func TestLoadFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	save := func(name string, result *CrawlResult) string {
+		data, err := json.Marshal(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	want := ComputeFingerprint(fingerprintPages(), nil)
+
+	// Results saved before fingerprints existed get one computed.
+	fp, err := LoadFingerprint(save("old.json", &CrawlResult{Pages: fingerprintPages()}))
+	if err != nil || fp.Hash != want.Hash {
+		t.Errorf("fingerprint %+v, %v; want %s", fp, err, want.Hash)
+	}
+	stored := &Fingerprint{Hash: "stored"}
+	if fp, err := LoadFingerprint(save("new.json", &CrawlResult{Pages: fingerprintPages(), Fingerprint: stored})); err != nil || fp.Hash != "stored" {
+		t.Errorf("fingerprint %+v, %v; want the stored one", fp, err)
+	}
+	if _, err := LoadFingerprint(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("loading a missing file gave no error")
+	}
+}
+
+// TestCrawlFingerprint crawls a site several times in different orders,
+// then after a change, and compares the fingerprints.
+func TestCrawlFingerprint(t *testing.T) {
+	var lock sync.Mutex
+	post := "first version"
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/": htmlPage(`<a href="/blog/1">1</a> <a href="/blog/2">2</a> <a href="/docs/a">a</a> <a href="/old">old</a> ` +
+			`<a href="/docs/a#top">spelled otherwise</a> <a href="/missing">missing</a>`),
+		"/blog/1": htmlPage(`<a href="/docs/a">a</a>`),
+		"/blog/2": func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			body := post
+			lock.Unlock()
+			htmlPage(body)(w, r)
+		},
+		"/docs/a": htmlPage(`<a href="/blog/1">1</a> <a href="/old">old</a>`),
+		"/old":    redirect("/docs/a"),
+	})
+
+	crawl := func(opts ...Option) *Fingerprint {
+		t.Helper()
+		result := crawlTestSite(t, site.URL, 2, opts...)
+		if result.Fingerprint == nil {
+			t.Fatal("the result has no fingerprint")
+		}
+		if fp := ComputeFingerprint(result.Pages, result.Errors); fp.Hash != result.Fingerprint.Hash {
+			t.Errorf("the fingerprint of the result is %s, its pages give %s", result.Fingerprint.Hash, fp.Hash)
+		}
+		return result.Fingerprint
+	}
+	first := crawl()
+	for i, opts := range [][]Option{nil, {WithDeterministic(1)}, {WithDeterministic(2)}} {
+		if fp := crawl(opts...); fp.Hash != first.Hash {
+			t.Errorf("crawl %d of the unchanged site: %+v, want %+v", i, fp, first)
+		}
+	}
+
+	lock.Lock()
+	post = "second version"
+	lock.Unlock()
+	changes := CompareFingerprints(first, crawl())
+	if want := []SectionChange{{Section: "/blog", Change: FingerprintChanged, PreviousURLs: 2, URLs: 2}}; !slices.Equal(changes, want) {
+		t.Errorf("changes %+v, want %+v", changes, want)
+	}
+
+	// The fingerprint is saved with the results.
+	filename := filepath.Join(t.TempDir(), "results.json")
+	result := crawlTestSite(t, site.URL, 2, WithOutputPath(filename))
+	fp, err := LoadFingerprint(filename)
+	if err != nil || fp.Hash != result.Fingerprint.Hash {
+		t.Errorf("loaded fingerprint %+v, %v; want %s", fp, err, result.Fingerprint.Hash)
+	}
+}
@@ -0,0 +1,90 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// testSite serves routes, a map of paths to handlers, counting the
+// requests of every path. Paths without a route answer 404.
+type testSite struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests map[string]int
+}
+
+func newTestSite(t *testing.T, routes map[string]http.HandlerFunc) *testSite {
+	t.Helper()
+	site := &testSite{requests: make(map[string]int)}
+	site.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site.lock.Lock()
+		site.requests[r.URL.Path]++
+		site.lock.Unlock()
+		if handler, ok := routes[r.URL.Path]; ok {
+			handler(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(site.Close)
+	return site
+}
+
+// requested returns how often path was requested.
+func (s *testSite) requested(path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests[path]
+}
+
+// htmlPage answers with body as an HTML page.
+func htmlPage(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<html><head><title>"+r.URL.Path+"</title></head><body>"+body+"</body></html>")
+	}
+}
+
+// textPage answers with body as plain text.
+func textPage(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, body)
+	}
+}
+
+// redirect answers with a 302 to target.
+func redirect(target string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target, http.StatusFound)
+	}
+}
+
+// crawlTestSite crawls base to maxDepth at 1000 requests per second
+// without logging, failing the test on an error.
+func crawlTestSite(t *testing.T, base string, maxDepth int, opts ...Option) *CrawlResult {
+	t.Helper()
+	c, err := NewCrawler(base, maxDepth, 1000, append([]Option{WithLogOutput(io.Discard)}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewCrawler: %v", err)
+	}
+	result, err := c.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return result
+}
+
+// findPage returns the stored page of path on the site at base, or nil.
+func findPage(result *CrawlResult, base, path string) *PageData {
+	for i := range result.Pages {
+		if result.Pages[i].URL == base+path {
+			return &result.Pages[i]
+		}
+	}
+	return nil
+}
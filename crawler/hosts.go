@@ -0,0 +1,205 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// HostWeight is a host crawled as part of the site, such as a blog or docs
+// subdomain, and its share of the requests relative to the other hosts.
+// Weight 0 counts as 1.
+type HostWeight struct {
+	Host   string  `yaml:"host" json:"host"`
+	Weight float64 `yaml:"weight,omitempty" json:"weight,omitempty"`
+}
+
+// WithHosts crawls the links to hosts as same-site links and starts a crawl
+// of each at its home page, next to the base URL. The base host may be
+// listed to give it a weight.
+//
+// Requests are shared out across the hosts with URLs waiting, in rounds
+// weighted by Weight, so a budgeted crawl reaches every host instead of
+// exhausting the base host first: with weights 2 and 1, the first gets
+// two requests for every one of the second while both have URLs left.
+// The crawl rate and the limits of WithSharedLimits, which are those of
+// the base host, still pace the requests themselves.
+func WithHosts(hosts []HostWeight) Option {
+	return func(c *Crawler) {
+		c.hosts.weights = hosts
+	}
+}
+
+// ValidHosts reports the first problem of hosts.
+func ValidHosts(hosts []HostWeight) error {
+	seen := make(map[string]bool, len(hosts))
+	for i, h := range hosts {
+		host := strings.ToLower(strings.TrimSpace(h.Host))
+		switch {
+		case host == "":
+			return fmt.Errorf("host %d has no name", i+1)
+		case strings.Contains(host, "/"):
+			return fmt.Errorf("host %q must be a host name with an optional port, not a URL", h.Host)
+		case h.Weight < 0:
+			return fmt.Errorf("host %q: weight must not be negative", h.Host)
+		case seen[host]:
+			return fmt.Errorf("host %q is listed twice", h.Host)
+		}
+		seen[host] = true
+	}
+	return nil
+}
+
+// hostScheduler hands out turns to wait on the rate limiter, one at a time,
+// across the hosts with URLs waiting: smooth weighted round robin, which
+// spreads the turns of a heavier host evenly instead of in bursts.
+type hostScheduler struct {
+	weights []HostWeight
+	// names maps the normalized hosts of weights to their weight.
+	names map[string]float64
+
+	lock   sync.Mutex
+	busy   bool
+	queues map[string]*hostQueue
+	order  []string
+}
+
+// hostQueue holds the requests of one host waiting for their turn.
+type hostQueue struct {
+	weight  float64
+	current float64
+	waiting []chan struct{}
+}
+
+// enabled reports whether several hosts are crawled.
+func (s *hostScheduler) enabled() bool {
+	return len(s.weights) > 0
+}
+
+// compile checks the hosts and normalizes their names for scheme, the
+// scheme of the base URL, adding the base host with weight 1 unless it is
+// listed.
+func (s *hostScheduler) compile(base *url.URL) error {
+	if !s.enabled() {
+		return nil
+	}
+	if err := ValidHosts(s.weights); err != nil {
+		return err
+	}
+	s.names = make(map[string]float64, len(s.weights)+1)
+	s.names[normalizeHost(base.Scheme, base.Host)] = 1
+	for _, h := range s.weights {
+		weight := h.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		s.names[normalizeHost(base.Scheme, strings.TrimSpace(h.Host))] = weight
+	}
+	s.queues = make(map[string]*hostQueue, len(s.names))
+	for name, weight := range s.names {
+		s.queues[name] = &hostQueue{weight: weight}
+		s.order = append(s.order, name)
+	}
+	sort.Strings(s.order)
+	return nil
+}
+
+// includes reports whether host, normalized, is one of the crawled hosts.
+func (s *hostScheduler) includes(host string) bool {
+	_, ok := s.names[host]
+	return ok
+}
+
+// seeds returns the home pages of the listed hosts other than base.
+func (s *hostScheduler) seeds(base *url.URL) []*url.URL {
+	baseHost := normalizeHost(base.Scheme, base.Host)
+	var seeds []*url.URL
+	for _, h := range s.weights {
+		host := strings.TrimSpace(h.Host)
+		if normalizeHost(base.Scheme, host) != baseHost {
+			seeds = append(seeds, &url.URL{Scheme: base.Scheme, Host: host, Path: "/"})
+		}
+	}
+	return seeds
+}
+
+// acquire blocks until the request for host gets its turn, or ctx is
+// done, and returns the function ending the turn.
+func (s *hostScheduler) acquire(ctx context.Context, host string) func() {
+	if !s.enabled() {
+		return func() {}
+	}
+	s.lock.Lock()
+	queue := s.queues[host]
+	if queue == nil {
+		// A host reached by a redirect that is not listed gets weight 1.
+		queue = &hostQueue{weight: 1}
+		s.queues[host] = queue
+		s.order = append(s.order, host)
+	}
+	if !s.busy {
+		s.busy = true
+		s.lock.Unlock()
+		return s.release
+	}
+	turn := make(chan struct{})
+	queue.waiting = append(queue.waiting, turn)
+	s.lock.Unlock()
+
+	select {
+	case <-turn:
+		return s.release
+	case <-ctx.Done():
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, ch := range queue.waiting {
+		if ch == turn {
+			queue.waiting = append(queue.waiting[:i], queue.waiting[i+1:]...)
+			return func() {}
+		}
+	}
+	// The turn was handed over while ctx was done; pass it on.
+	return s.release
+}
+
+// release ends the current turn and hands the next one to the host that
+// is owed the most, by weight, among those with requests waiting.
+func (s *hostScheduler) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var next *hostQueue
+	total := 0.0
+	for _, name := range s.order {
+		queue := s.queues[name]
+		if len(queue.waiting) == 0 {
+			continue
+		}
+		queue.current += queue.weight
+		total += queue.weight
+		if next == nil || queue.current > next.current {
+			next = queue
+		}
+	}
+	if next == nil {
+		s.busy = false
+		return
+	}
+	next.current -= total
+	turn := next.waiting[0]
+	next.waiting = next.waiting[1:]
+	close(turn)
+}
+
+// HostPageCounts counts pages per host of the URL they were requested
+// with.
+func HostPageCounts(pages []PageData) map[string]int {
+	counts := make(map[string]int)
+	for _, page := range pages {
+		counts[urlHost(page.URL)]++
+	}
+	return counts
+}
@@ -0,0 +1,160 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidHosts(t *testing.T) {
+	if err := ValidHosts([]HostWeight{{Host: "blog.example.com"}, {Host: "docs.example.com:8080", Weight: 2}}); err != nil {
+		t.Errorf("valid hosts: %v", err)
+	}
+	for want, hosts := range map[string][]HostWeight{
+		"has no name":        {{Host: " "}},
+		"not a URL":          {{Host: "https://blog.example.com"}},
+		"must not be":        {{Host: "blog.example.com", Weight: -1}},
+		"is listed twice":    {{Host: "blog.example.com"}, {Host: "Blog.example.com "}},
+		"host 2 has no name": {{Host: "blog.example.com"}, {}},
+	} {
+		if err := ValidHosts(hosts); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ValidHosts(%+v) = %v, want %q", hosts, err, want)
+		}
+	}
+}
+
+// TestHostScheduler queues requests of two hosts weighted 2 and 1 behind a
+// turn in progress and checks the order of their turns.
+func TestHostScheduler(t *testing.T) {
+	base, _ := url.Parse("http://example.com")
+	s := &hostScheduler{weights: []HostWeight{{Host: "example.com", Weight: 2}, {Host: "blog.example.com"}}}
+	if err := s.compile(base); err != nil {
+		t.Fatal(err)
+	}
+	release := s.acquire(context.Background(), "example.com")
+
+	var lock sync.Mutex
+	var order strings.Builder
+	var wg sync.WaitGroup
+	queue := func(host string, n int) {
+		for range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				done := s.acquire(context.Background(), host)
+				lock.Lock()
+				order.WriteString(host[:1])
+				lock.Unlock()
+				done()
+			}()
+		}
+	}
+	queue("example.com", 6)
+	queue("blog.example.com", 3)
+	for waiting := 0; waiting < 9; {
+		time.Sleep(time.Millisecond)
+		s.lock.Lock()
+		waiting = len(s.queues["example.com"].waiting) + len(s.queues["blog.example.com"].waiting)
+		s.lock.Unlock()
+	}
+	release()
+	wg.Wait()
+	if got := order.String(); got != "ebeebeebe" {
+		t.Errorf("turns went %q, want two for example.com for each of blog.example.com, spread out", got)
+	}
+
+	// A cancelled wait gives up its place.
+	release = s.acquire(context.Background(), "example.com")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.acquire(ctx, "blog.example.com")()
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	<-done
+	release()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.busy || len(s.queues["blog.example.com"].waiting) != 0 {
+		t.Error("a cancelled wait kept its turn or its place")
+	}
+}
+
+// hostSite serves a home page linking to n pages, and to the extra links.
+func hostSite(t *testing.T, n int, extra ...string) *testSite {
+	routes := make(map[string]http.HandlerFunc)
+	var links strings.Builder
+	for i := range n {
+		fmt.Fprintf(&links, `<a href="/p%d">%d</a> `, i, i)
+		routes[fmt.Sprintf("/p%d", i)] = htmlPage("page")
+	}
+	for _, link := range extra {
+		fmt.Fprintf(&links, `<a href="%s">extra</a> `, link)
+	}
+	routes["/"] = htmlPage(links.String())
+	return newTestSite(t, routes)
+}
+
+// TestCrawlHosts crawls three hosts weighted 2, 1 and 1 under a page
+// budget, and checks that the pages are shared out in about that ratio.
+func TestCrawlHosts(t *testing.T) {
+	blog := hostSite(t, 30)
+	docs := hostSite(t, 30)
+	unlisted := hostSite(t, 1)
+	base := hostSite(t, 30, blog.URL+"/p29", unlisted.URL+"/p0")
+	host := func(site *testSite) string { return strings.TrimPrefix(site.URL, "http://") }
+
+	c, err := NewCrawler(base.URL, 1, 200, WithLogOutput(io.Discard), WithMaxPages(40),
+		WithHosts([]HostWeight{{Host: host(base), Weight: 2}, {Host: host(blog), Weight: 1}, {Host: host(docs)}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := result.HostPages
+	if len(counts) != 3 {
+		t.Fatalf("pages per host %v, want the three listed hosts", counts)
+	}
+	b, l, d := counts[host(base)], counts[host(blog)], counts[host(docs)]
+	if b+l+d != len(result.Pages) || b < 15 || l < 7 || d < 7 || b <= l || b <= d {
+		t.Errorf("pages per host %v, want about 20, 10 and 10", counts)
+	}
+	for _, site := range []*testSite{blog, docs} {
+		if site.requested("/") != 1 {
+			t.Errorf("the home page of %s was requested %d times, want once", site.URL, site.requested("/"))
+		}
+	}
+	if unlisted.requested("/p0") != 0 {
+		t.Error("a link to a host that is not listed was followed")
+	}
+
+	// Links to a listed host are followed like links on the base host.
+	c, err = NewCrawler(base.URL, 1, 1000, WithLogOutput(io.Discard), WithHosts([]HostWeight{{Host: host(blog)}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err = c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if page := findPage(result, blog.URL, "/p29"); page == nil || page.Depth != 1 {
+		t.Errorf("the link to the blog: %+v, want it crawled at depth 1", page)
+	}
+	if n := result.HostPages[host(base)]; n != 31 {
+		t.Errorf("%d pages of the base host, want 31", n)
+	}
+
+	if _, err := NewCrawler(base.URL, 1, 1000, WithHosts([]HostWeight{{Host: "a"}, {Host: "A"}})); err == nil || !strings.Contains(err.Error(), "invalid hosts") {
+		t.Errorf("NewCrawler with a host listed twice: %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// WithSplitByHost makes Start save one results file per host instead of
+// one for the crawl, for sites whose redirects lead to hosts other teams
+// own. The output path must contain {host}; without a path the files are
+// crawl_results_<host>.<format>. A page is saved in the file of the host
+// it ended up on, so a redirect to another host moves it there. In JSON,
+// both files list it under CrossHost, and each file is a complete
+// CrawlResult with the stats of its host; the reports on the whole crawl,
+// such as redirected links, site hygiene or the asset check, are saved
+// with the base host. CSV and Parquet files hold the pages of their host
+// only, and a host without pages gets none, save the base host. The xlsx
+// report describes the whole crawl and cannot be split.
+func WithSplitByHost() Option {
+	return func(c *Crawler) {
+		c.splitByHost = true
+	}
+}
+
+// CrossHostPage is a page of a crawl split by host that redirected from
+// one host to another, saved in File, the results file of Host.
+type CrossHostPage struct {
+	URL      string `json:"url"`
+	FinalURL string `json:"final_url"`
+	Host     string `json:"host"`
+	File     string `json:"file"`
+}
+
+// validateSplitByHost reports split settings that would save every host to
+// the same file.
+func (c *Crawler) validateSplitByHost() error {
+	if !c.splitByHost {
+		return nil
+	}
+	return ValidateSplitByHost(c.outputFormat, c.outputPath)
+}
+
+// ValidateSplitByHost reports whether results in format can be split by
+// host and saved to path, the output path of WithOutputPath: JSON, CSV and
+// Parquet results are split, and path needs {host} unless it is a
+// directory.
+func ValidateSplitByHost(format, path string) error {
+	if format != FormatJSON && format != FormatCSV && format != FormatParquet {
+		return fmt.Errorf("results split by host are saved as JSON, CSV or Parquet, not %s", format)
+	}
+	if path == "" || strings.Contains(path, "{host}") || strings.HasSuffix(path, "/") || strings.HasSuffix(path, string(os.PathSeparator)) {
+		return nil
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	return fmt.Errorf("results split by host need {host} in the output path %q", path)
+}
+
+// pageHost returns the host a page is saved under: that of its final URL,
+// with the port unless it is the default one.
+func pageHost(page *PageData) string {
+	pageURL := page.URL
+	if page.FinalURL != "" {
+		pageURL = page.FinalURL
+	}
+	return urlHost(pageURL)
+}
+
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return normalizeHost(u.Scheme, u.Host)
+}
+
+// hostShare is what one host of a split crawl holds.
+type hostShare struct {
+	pages     int
+	bytes     int64
+	pageTypes map[string]int
+	errors    []CrawlError
+	crossHost []CrossHostPage
+}
+
+// saveSplitResults writes the results file in format of every host the
+// pages of the crawl ended up on, the base host first, and returns their
+// names. Pages are read from the spill file once per host, so memory does
+// not grow with the number of hosts. It must be called with resultLock
+// held.
+func (c *Crawler) saveSplitResults(format string) (string, error) {
+	baseHost := normalizeHost(c.baseURL.Scheme, c.baseURL.Host)
+	shares := map[string]*hostShare{baseHost: {}}
+	share := func(host string) *hostShare {
+		if shares[host] == nil {
+			shares[host] = &hostShare{}
+		}
+		return shares[host]
+	}
+	var crossHost []CrossHostPage
+	err := c.eachPage(false, func(page *PageData) {
+		host := pageHost(page)
+		s := share(host)
+		s.pages++
+		s.bytes += page.Size
+		if page.PageType != "" {
+			if s.pageTypes == nil {
+				s.pageTypes = make(map[string]int)
+			}
+			s.pageTypes[page.PageType]++
+		}
+		if from := urlHost(page.URL); from != host {
+			crossHost = append(crossHost, CrossHostPage{URL: page.URL, FinalURL: page.FinalURL, Host: host})
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, e := range c.result.Errors {
+		s := share(urlHost(e.URL))
+		s.errors = append(s.errors, e)
+	}
+
+	hosts := make([]string, 0, len(shares))
+	for host, s := range shares {
+		// Only JSON keeps errors, so a host with none of the pages has
+		// nothing to save in the other formats.
+		if host != baseHost && (format == FormatJSON || s.pages > 0) {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	hosts = append([]string{baseHost}, hosts...)
+	files := make(map[string]string, len(hosts))
+	for _, host := range hosts {
+		files[host] = c.hostOutputFilename(host, format)
+	}
+	for _, ref := range crossHost {
+		ref.File = files[ref.Host]
+		for _, host := range []string{urlHost(ref.URL), ref.Host} {
+			share(host).crossHost = append(share(host).crossHost, ref)
+		}
+	}
+
+	others := 0
+	for host, s := range shares {
+		if host != baseHost {
+			others += s.pages + len(s.errors)
+		}
+	}
+
+	names := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		filename := files[host]
+		var err error
+		switch format {
+		case FormatCSV:
+			err = writePagesCSV(filename, c.hostPages(host))
+		case FormatParquet:
+			err = writePagesParquet(filename, c.hostPages(host), c.parquetRowGroup)
+		default:
+			err = c.saveHostResults(filename, host, host == baseHost, shares[host], others)
+		}
+		if err != nil {
+			return filename, err
+		}
+		if err := c.artifacts.addFile(ArtifactResults, filename, format); err != nil {
+			return filename, err
+		}
+		c.artifacts.setHost(filename, host)
+		names = append(names, filename)
+	}
+	return strings.Join(names, ", "), nil
+}
+
+// saveHostResults writes the results of host to filename: the pages saved
+// under it, its errors and its stats. The file of the base host keeps the
+// reports on the whole crawl, and its counters leave out the others URLs
+// saved in the files of the other hosts.
+func (c *Crawler) saveHostResults(filename, host string, base bool, s *hostShare, others int) error {
+	var result CrawlResult
+	if base {
+		result = c.result
+	} else {
+		result = CrawlResult{
+			BaseURL:        c.result.BaseURL,
+			MaxDepth:       c.result.MaxDepth,
+			UserAgent:      c.result.UserAgent,
+			Contact:        c.result.Contact,
+			StartTime:      c.result.StartTime,
+			EndTime:        c.result.EndTime,
+			StopReason:     c.result.StopReason,
+			AcceptLanguage: c.result.AcceptLanguage,
+			Languages:      c.result.Languages,
+			Config:         c.result.Config,
+			DiscoveredURLs: s.pages + len(s.errors),
+		}
+	}
+	result.Host = host
+	result.TotalPages = s.pages
+	result.Errors = s.errors
+	result.FetchedURLs = s.pages + len(s.errors)
+	result.BytesFetched = s.bytes
+	result.PageTypes = s.pageTypes
+	result.CrossHost = s.crossHost
+	if base {
+		// The base host keeps the URLs that never produced a page, so the
+		// counters of the files add up to those of the crawl.
+		result.DiscoveredURLs = c.result.DiscoveredURLs - others
+		result.FetchedURLs = c.result.FetchedURLs - others
+	}
+	result.Coverage = 0
+	if result.DiscoveredURLs > 0 {
+		result.Coverage = float64(result.FetchedURLs) / float64(result.DiscoveredURLs)
+	}
+
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := writeResultJSON(file, &result, c.hostPages(host)); err != nil {
+		return fmt.Errorf("error encoding JSON: %v", err)
+	}
+	return file.Close()
+}
+
+// hostPages is the pageSource of the stored pages saved under host.
+func (c *Crawler) hostPages(host string) pageSource {
+	return func(fn func(pages []PageData) error) error {
+		return c.eachPageBatch(false, func(batch []PageData) error {
+			var own []PageData
+			for i := range batch {
+				if pageHost(&batch[i]) == host {
+					own = append(own, batch[i])
+				}
+			}
+			if len(own) == 0 {
+				return nil
+			}
+			return fn(own)
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package crawler
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateSplitByHost(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		format, path, error string
+	}{
+		{FormatJSON, "", ""},
+		{FormatJSON, "out/{host}.json", ""},
+		{FormatCSV, "out/{host}/pages.csv", ""},
+		{FormatParquet, "out/", ""},
+		{FormatJSON, dir, ""},
+		{FormatJSON, "out/results.json", `need {host} in the output path "out/results.json"`},
+		{FormatCSV, filepath.Join(dir, "pages.csv"), "need {host} in the output path"},
+		{FormatXLSX, "out/{host}.xlsx", "saved as JSON, CSV or Parquet, not xlsx"},
+	}
+	for _, tt := range tests {
+		err := ValidateSplitByHost(tt.format, tt.path)
+		if tt.error == "" && err != nil || tt.error != "" && (err == nil || !strings.Contains(err.Error(), tt.error)) {
+			t.Errorf("ValidateSplitByHost(%s, %q) = %v, want %q", tt.format, tt.path, err, tt.error)
+		}
+	}
+	if _, err := NewCrawler("http://example.com", 1, 1, WithSplitByHost(), WithOutputFormat(FormatXLSX)); err == nil {
+		t.Error("NewCrawler split an xlsx report by host")
+	}
+}
+
+// splitSites serves a base host linking to two pages of its own, to a
+// page redirecting to the shop host, to a page on that host, and to a
+// missing page on a third host.
+func splitSites(t *testing.T) (base, shop, gone *testSite) {
+	shop = newTestSite(t, map[string]http.HandlerFunc{
+		"/landing": htmlPage("landing"),
+		"/cart":    htmlPage("cart"),
+	})
+	gone = newTestSite(t, nil)
+	base = newTestSite(t, map[string]http.HandlerFunc{
+		"/": htmlPage(fmt.Sprintf(`<a href="/p0">0</a> <a href="/p1">1</a> <a href="/moved">moved</a>
+			<a href="%s/cart">cart</a> <a href="%s/missing">missing</a>`, shop.URL, gone.URL)),
+		"/p0":    htmlPage("p0"),
+		"/p1":    htmlPage("p1"),
+		"/moved": redirect(shop.URL + "/landing"),
+	})
+	return base, shop, gone
+}
+
+// crawlSplit crawls the sites of splitSites split by host into dir and
+// returns the crawl and its results files by host.
+func crawlSplit(t *testing.T, base, shop, gone *testSite, dir string, opts ...Option) (*CrawlResult, map[string]string) {
+	t.Helper()
+	host := func(site *testSite) string { return strings.TrimPrefix(site.URL, "http://") }
+	opts = append([]Option{
+		WithLogOutput(io.Discard), WithSplitByHost(), WithOutputPath(filepath.Join(dir, "{host}")),
+		WithHosts([]HostWeight{{Host: host(base)}, {Host: host(shop)}, {Host: host(gone)}}),
+	}, opts...)
+	c, err := NewCrawler(base.URL, 1, 1000, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, artifact := range c.Artifacts() {
+		if artifact.Kind == ArtifactResults {
+			files[artifact.Host] = artifact.Path
+		}
+	}
+	return result, files
+}
+
+// pageURLs returns the sorted URLs of pages.
+func pageURLs(pages []PageData) []string {
+	var urls []string
+	for _, page := range pages {
+		urls = append(urls, page.URL)
+	}
+	slices.Sort(urls)
+	return urls
+}
+
+// TestCrawlSplitByHost checks that every host gets a file of the pages
+// that ended up on it, with its own counters, and that the redirect to the
+// shop is listed in both files it touches.
+func TestCrawlSplitByHost(t *testing.T) {
+	base, shop, gone := splitSites(t)
+	host := func(site *testSite) string { return strings.TrimPrefix(site.URL, "http://") }
+	wantPages := map[string][]string{
+		host(base): {base.URL + "/", base.URL + "/p0", base.URL + "/p1"},
+		host(shop): {base.URL + "/moved", shop.URL + "/cart"},
+		host(gone): nil,
+	}
+	for _, urls := range wantPages {
+		slices.Sort(urls)
+	}
+
+	for _, spilled := range []bool{false, true} {
+		var opts []Option
+		if spilled {
+			opts = append(opts, WithResultLimit(1, 0))
+		}
+		crawl, files := crawlSplit(t, base, shop, gone, t.TempDir(), opts...)
+		if len(files) != 3 {
+			t.Fatalf("spilled %t: files %v, want one per host", spilled, files)
+		}
+		results := make(map[string]*CrawlResult)
+		total, discovered, fetched, errors := 0, 0, 0, 0
+		for host, want := range wantPages {
+			result, err := LoadResults(files[host])
+			if err != nil {
+				t.Fatal(err)
+			}
+			results[host] = result
+			if urls := pageURLs(result.Pages); !slices.Equal(urls, want) || result.Host != host || result.TotalPages != len(want) {
+				t.Errorf("spilled %t: %s holds %q (%d pages, host %q), want %q", spilled, files[host], urls, result.TotalPages, result.Host, want)
+			}
+			total += result.TotalPages
+			discovered += result.DiscoveredURLs
+			fetched += result.FetchedURLs
+			errors += len(result.Errors)
+		}
+		if total != crawl.TotalPages || discovered != crawl.DiscoveredURLs || fetched != crawl.FetchedURLs || errors != len(crawl.Errors) {
+			t.Errorf("spilled %t: the files add up to %d pages, %d discovered, %d fetched and %d errors; the crawl has %d, %d, %d and %d",
+				spilled, total, discovered, fetched, errors, crawl.TotalPages, crawl.DiscoveredURLs, crawl.FetchedURLs, len(crawl.Errors))
+		}
+
+		// The listed hosts' home pages are crawled too, and missing.
+		missing := results[host(gone)]
+		if errs := len(missing.Errors); errs != 2 || missing.TotalPages != 0 || missing.FetchedURLs != 2 || missing.DiscoveredURLs != 2 {
+			t.Errorf("spilled %t: the missing pages' host holds %d pages, %d errors, %d fetched and %d discovered; want its 2 errors only",
+				spilled, missing.TotalPages, errs, missing.FetchedURLs, missing.DiscoveredURLs)
+		}
+		if home := results[host(base)]; home.FetchedURLs != 3 || len(home.Errors) != 0 {
+			t.Errorf("spilled %t: the base host fetched %d URLs with errors %+v, want its 3 pages", spilled, home.FetchedURLs, home.Errors)
+		}
+		moved := CrossHostPage{URL: base.URL + "/moved", FinalURL: shop.URL + "/landing", Host: host(shop), File: files[host(shop)]}
+		for _, site := range []*testSite{base, shop} {
+			if cross := results[host(site)].CrossHost; !slices.Equal(cross, []CrossHostPage{moved}) {
+				t.Errorf("spilled %t: %s lists %+v as cross-host, want %+v", spilled, host(site), cross, moved)
+			}
+		}
+		if results[host(gone)].CrossHost != nil {
+			t.Errorf("spilled %t: the missing page's host lists %+v as cross-host", spilled, results[host(gone)].CrossHost)
+		}
+		// The reports on the whole crawl stay with the base host.
+		if results[host(base)].Fingerprint == nil || results[host(shop)].Fingerprint != nil {
+			t.Errorf("spilled %t: fingerprint %+v in the base file and %+v in the shop's, want it in the base file only",
+				spilled, results[host(base)].Fingerprint, results[host(shop)].Fingerprint)
+		}
+	}
+}
+
+// TestCrawlSplitByHostFormats checks that CSV and Parquet results are split
+// by host too, without files for hosts no page ended up on.
+func TestCrawlSplitByHostFormats(t *testing.T) {
+	base, shop, gone := splitSites(t)
+	host := func(site *testSite) string { return strings.TrimPrefix(site.URL, "http://") }
+	want := map[string][]string{
+		host(base): {base.URL + "/", base.URL + "/p0", base.URL + "/p1"},
+		host(shop): {base.URL + "/moved", shop.URL + "/cart"},
+	}
+	for _, urls := range want {
+		slices.Sort(urls)
+	}
+
+	_, files := crawlSplit(t, base, shop, gone, t.TempDir(), WithOutputFormat(FormatCSV), WithResultLimit(1, 0))
+	if len(files) != len(want) {
+		t.Fatalf("CSV files %v, want those of %d hosts", files, len(want))
+	}
+	for host, urls := range want {
+		file, err := os.Open(files[host])
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := csv.NewReader(file).ReadAll()
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, row := range rows[1:] {
+			got = append(got, row[0])
+		}
+		slices.Sort(got)
+		if !slices.Equal(rows[0], csvPageHeader) || !slices.Equal(got, urls) {
+			t.Errorf("%s holds %q, want the header and %q", files[host], rows, urls)
+		}
+	}
+
+	_, files = crawlSplit(t, base, shop, gone, t.TempDir(), WithOutputFormat(FormatParquet))
+	if len(files) != len(want) {
+		t.Fatalf("Parquet files %v, want those of %d hosts", files, len(want))
+	}
+	for host, urls := range want {
+		table := readParquet(t, files[host])
+		var got []string
+		for _, value := range table.values["url"] {
+			got = append(got, fmt.Sprint(value))
+		}
+		slices.Sort(got)
+		if table.rows != len(urls) || !slices.Equal(got, urls) {
+			t.Errorf("%s holds %d rows %q, want %q", files[host], table.rows, got, urls)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxRobotsSize is the part of a robots.txt file Google reads; rules
+	// beyond it are ignored.
+	maxRobotsSize = 500 << 10
+
+	// maxSitemapURLs is the number of entries a sitemap may list.
+	maxSitemapURLs = 50000
+)
+
+// Kinds of HygieneFile.
+const (
+	HygieneRobots  = "robots.txt"
+	HygieneSitemap = "sitemap"
+)
+
+// Problems of a HygieneFinding.
+const (
+	HygieneInvalidLine      = "invalid-line"
+	HygieneUnknownDirective = "unknown-directive"
+	HygieneNoUserAgent      = "no-user-agent"
+	HygieneInvalidValue     = "invalid-value"
+	HygieneInvalidURL       = "invalid-url"
+	HygieneInvalidLastmod   = "invalid-lastmod"
+	HygieneTooManyURLs      = "too-many-urls"
+	HygieneTooLarge         = "too-large"
+	HygieneNotFound         = "not-found"
+	HygieneUnreadable       = "unreadable"
+	HygieneOutOfScope       = "out-of-scope"
+)
+
+// errSitemapTooLarge reports a sitemap cut short at maxSitemapSize.
+var errSitemapTooLarge = fmt.Errorf("sitemap larger than the %d MB limit of the sitemap protocol", maxSitemapSize>>20)
+
+// WithSiteHygiene checks the syntax of the site's robots.txt and of the
+// sitemaps read for WithSitemap, recording the problems in SiteHygiene.
+// robots.txt is fetched once for the check; the crawl applies its rules
+// only with WithRobots, and malformed sitemap entries are crawled as before. The crawled
+// URLs that only differ in the case of their path are compared too, see
+// FindCaseCollisions.
+func WithSiteHygiene() Option {
+	return func(c *Crawler) {
+		c.hygiene.enabled = true
+	}
+}
+
+// SiteHygiene lists the robots.txt and sitemap files a crawl checked and
+// the problems found in them, and the crawled URLs that only differ in
+// the case of their path.
+type SiteHygiene struct {
+	Files          []HygieneFile    `json:"files"`
+	Findings       []HygieneFinding `json:"findings,omitempty"`
+	CaseCollisions []CaseCollision  `json:"case_collisions,omitempty"`
+}
+
+// HygieneFile is a robots.txt or sitemap file that was checked. Entries
+// counts the lines of a robots.txt file, or the entries of a sitemap. Of
+// the page entries of a sitemap, InScope were crawled and OutOfScope were
+// not, being on another host, filtered or malformed.
+type HygieneFile struct {
+	URL        string `json:"url"`
+	Kind       string `json:"kind"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Entries    int    `json:"entries,omitempty"`
+	InScope    int    `json:"in_scope,omitempty"`
+	OutOfScope int    `json:"out_of_scope,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// HygieneFinding is a problem of a robots.txt or sitemap file. Line is the
+// line of the directive or of the sitemap entry, Entry the position of the
+// entry in its sitemap, URL the entry's URL.
+type HygieneFinding struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Entry   int    `json:"entry,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Problem string `json:"problem"`
+	Detail  string `json:"detail"`
+}
+
+// hygiene is the state of WithSiteHygiene. listed maps the URLs seeded
+// from sitemaps to their entries, so the ones that turn out missing can
+// be reported.
+type hygiene struct {
+	enabled  bool
+	files    []HygieneFile
+	findings []HygieneFinding
+	listed   map[string]HygieneFinding
+}
+
+// robotsDirectives are the robots.txt fields search engines understand.
+var robotsDirectives = map[string]bool{
+	"user-agent":  true,
+	"allow":       true,
+	"disallow":    true,
+	"sitemap":     true,
+	"crawl-delay": true,
+	"host":        true,
+	"clean-param": true,
+}
+
+// ValidateRobotsTxt checks the syntax of the robots.txt file served at
+// robotsURL: every line is a known directive with a valid value, and every
+// rule follows a User-agent line.
+func ValidateRobotsTxt(robotsURL string, content []byte) []HygieneFinding {
+	var findings []HygieneFinding
+	report := func(line int, problem, format string, args ...any) {
+		findings = append(findings, HygieneFinding{File: robotsURL, Line: line, Problem: problem, Detail: fmt.Sprintf(format, args...)})
+	}
+	if len(content) > maxRobotsSize {
+		report(0, HygieneTooLarge, "%d bytes, rules past the first %d KB are ignored", len(content), maxRobotsSize>>10)
+	}
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	inGroup := false
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		field, value, ok := strings.Cut(text, ":")
+		if !ok {
+			report(line, HygieneInvalidLine, "%q is not a field: value directive", text)
+			continue
+		}
+		name := strings.TrimSpace(field)
+		field, value = strings.ToLower(name), strings.TrimSpace(value)
+		if !robotsDirectives[field] {
+			report(line, HygieneUnknownDirective, "unknown directive %q", name)
+			continue
+		}
+		switch field {
+		case "user-agent":
+			if value == "" {
+				report(line, HygieneInvalidValue, "%s without a value", name)
+			}
+			inGroup = true
+		case "allow", "disallow", "crawl-delay", "clean-param":
+			if !inGroup {
+				report(line, HygieneNoUserAgent, "%s before any User-agent line applies to no crawler", name)
+			}
+			switch {
+			case (field == "allow" || field == "disallow") && value != "" && !strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "*"):
+				report(line, HygieneInvalidValue, "%s path %q does not start with / or *", name, value)
+			case field == "crawl-delay":
+				if delay, err := strconv.ParseFloat(value, 64); err != nil || delay < 0 {
+					report(line, HygieneInvalidValue, "%s %q is not a number of seconds", name, value)
+				}
+			}
+		case "sitemap":
+			if u, err := url.Parse(value); err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") {
+				report(line, HygieneInvalidURL, "%s %q is not an absolute http or https URL", name, value)
+			}
+		}
+	}
+	return findings
+}
+
+// sitemapDateLayouts are the W3C datetime formats of sitemap lastmod
+// values.
+var sitemapDateLayouts = []string{
+	"2006",
+	"2006-01",
+	time.DateOnly,
+	"2006-01-02T15:04Z07:00",
+	time.RFC3339Nano,
+}
+
+// validLastmod reports whether value is a W3C datetime.
+func validLastmod(value string) bool {
+	for _, layout := range sitemapDateLayouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSitemap checks the entries of a sitemap read from sitemapURL:
+// their number, their URLs and their lastmod dates.
+func validateSitemap(sitemapURL string, doc *sitemapDocument) []HygieneFinding {
+	var findings []HygieneFinding
+	if n := len(doc.URLs) + len(doc.Sitemaps); n > maxSitemapURLs {
+		findings = append(findings, HygieneFinding{
+			File:    sitemapURL,
+			Problem: HygieneTooManyURLs,
+			Detail:  fmt.Sprintf("%d entries, more than the %d of the sitemap protocol", n, maxSitemapURLs),
+		})
+	}
+	check := func(entry int, e sitemapEntry) {
+		loc := strings.TrimSpace(e.Loc)
+		finding := HygieneFinding{File: sitemapURL, Line: e.line, Entry: entry, URL: loc}
+		if u, err := url.Parse(loc); err != nil || !u.IsAbs() || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			finding.Problem, finding.Detail = HygieneInvalidURL, fmt.Sprintf("loc %q is not an absolute http or https URL", loc)
+			findings = append(findings, finding)
+		}
+		if lastmod := strings.TrimSpace(e.Lastmod); lastmod != "" && !validLastmod(lastmod) {
+			finding.Problem, finding.Detail = HygieneInvalidLastmod, fmt.Sprintf("lastmod %q is not a W3C datetime", lastmod)
+			findings = append(findings, finding)
+		}
+	}
+	for i, e := range doc.Sitemaps {
+		check(i+1, e)
+	}
+	for i, e := range doc.URLs {
+		check(len(doc.Sitemaps)+i+1, e)
+	}
+	return findings
+}
+
+// checkRobots fetches and checks the robots.txt file of the base URL.
+func (c *Crawler) checkRobots() {
+	robotsURL := (&url.URL{Scheme: c.baseURL.Scheme, Host: c.baseURL.Host, Path: "/robots.txt"}).String()
+	file := HygieneFile{URL: robotsURL, Kind: HygieneRobots}
+	content, status, err := c.fetchRobots(robotsURL)
+	file.StatusCode = status
+	switch {
+	case err != nil:
+		file.Error = err.Error()
+		c.hygiene.findings = append(c.hygiene.findings, HygieneFinding{File: robotsURL, Problem: HygieneUnreadable, Detail: err.Error()})
+	case status == http.StatusNotFound || status == http.StatusGone:
+		// A site without robots.txt allows everything.
+	case status != http.StatusOK:
+		file.Error = (&StatusError{StatusCode: status}).Error()
+		c.hygiene.findings = append(c.hygiene.findings, HygieneFinding{
+			File:    robotsURL,
+			Problem: HygieneUnreadable,
+			Detail:  fmt.Sprintf("HTTP %d; crawlers may treat an unreadable robots.txt as disallowing everything", status),
+		})
+	default:
+		file.Entries = bytes.Count(content, []byte("\n"))
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			file.Entries++
+		}
+		c.hygiene.findings = append(c.hygiene.findings, ValidateRobotsTxt(robotsURL, content)...)
+	}
+	c.hygiene.files = append(c.hygiene.files, file)
+}
+
+// fetchRobots downloads robotsURL, waiting on the crawl rate limiter
+// first. It returns the body of a 200 response, up to one byte past
+// maxRobotsSize so an oversized file is noticed.
+func (c *Crawler) fetchRobots(robotsURL string) ([]byte, int, error) {
+	c.waitRate()
+	req, err := c.newRequest(robotsURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := c.client.Do(req.WithContext(c.ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, nil
+	}
+	body := &countingReader{r: resp.Body}
+	defer func() { c.addBytesFetched(body.n) }()
+	content, err := io.ReadAll(io.LimitReader(body, maxRobotsSize+1))
+	return content, resp.StatusCode, err
+}
+
+// noteSitemap records a sitemap read by loadSitemap, or the error reading
+// it, with the problems of its entries.
+func (c *Crawler) noteSitemap(sitemapURL string, doc *sitemapDocument, err error) {
+	if !c.hygiene.enabled {
+		return
+	}
+	file := HygieneFile{URL: sitemapURL, Kind: HygieneSitemap, StatusCode: http.StatusOK}
+	if err != nil {
+		file.StatusCode = 0
+		file.Error = err.Error()
+		finding := HygieneFinding{File: sitemapURL, Problem: HygieneUnreadable, Detail: err.Error()}
+		var statusErr *StatusError
+		switch {
+		case errors.As(err, &statusErr):
+			file.StatusCode = statusErr.StatusCode
+			if statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone {
+				finding.Problem = HygieneNotFound
+			}
+		case errors.Is(err, errSitemapTooLarge):
+			finding.Problem = HygieneTooLarge
+		}
+		c.hygiene.files = append(c.hygiene.files, file)
+		c.hygiene.findings = append(c.hygiene.findings, finding)
+		return
+	}
+	file.Entries = len(doc.URLs) + len(doc.Sitemaps)
+	c.hygiene.files = append(c.hygiene.files, file)
+	c.hygiene.findings = append(c.hygiene.findings, validateSitemap(sitemapURL, doc)...)
+}
+
+// outOfScopeDetails explain the statuses of out-of-scope sitemap entries.
+var outOfScopeDetails = map[string]string{
+	EdgeOffDomain:         "the URL is on another host",
+	EdgeFiltered:          "the URL does not pass the include and exclude patterns",
+	EdgePathDepthLimit:    "the URL has more path segments than the path depth limit",
+	EdgeDangerous:         "the URL looks like an action",
+	EdgeParamAccumulation: "the URL adds many query parameters to one already seen",
+	EdgeOutOfScope:        "the scope hook rejected the URL",
+}
+
+// noteOutOfScope records a sitemap entry that is not crawled for status,
+// with the reason or pattern of the status.
+func (c *Crawler) noteOutOfScope(sitemapURL string, entry int, e sitemapEntry, status, reason string) {
+	if !c.hygiene.enabled {
+		return
+	}
+	detail := outOfScopeDetails[status]
+	if detail == "" {
+		detail = "the URL is not crawled"
+	}
+	detail += " (" + status
+	if reason != "" {
+		detail += ": " + reason
+	}
+	detail += ")"
+	c.hygiene.findings = append(c.hygiene.findings, HygieneFinding{
+		File:    sitemapURL,
+		Line:    e.line,
+		Entry:   entry,
+		URL:     strings.TrimSpace(e.Loc),
+		Problem: HygieneOutOfScope,
+		Detail:  detail,
+	})
+}
+
+// noteSitemapScope records how many page entries of the sitemap noted last
+// are crawled and how many are out of scope.
+func (c *Crawler) noteSitemapScope(inScope, outOfScope int) {
+	if !c.hygiene.enabled || len(c.hygiene.files) == 0 {
+		return
+	}
+	file := &c.hygiene.files[len(c.hygiene.files)-1]
+	file.InScope, file.OutOfScope = inScope, outOfScope
+}
+
+// noteListed remembers that the sitemap entry of pageURL seeded the crawl.
+func (c *Crawler) noteListed(pageURL, sitemapURL string, entry int, e sitemapEntry) {
+	if !c.hygiene.enabled {
+		return
+	}
+	if c.hygiene.listed == nil {
+		c.hygiene.listed = make(map[string]HygieneFinding)
+	}
+	c.hygiene.listed[pageURL] = HygieneFinding{File: sitemapURL, Line: e.line, Entry: entry, URL: strings.TrimSpace(e.Loc)}
+}
+
+// siteHygiene returns the SiteHygiene of the crawl, adding the sitemap
+// entries whose URL answered 404 or 410 and the case collisions. pages are
+// the page summaries. It must be called with resultLock held.
+func (c *Crawler) siteHygiene(pages []PageData) *SiteHygiene {
+	if !c.hygiene.enabled {
+		return nil
+	}
+	findings := append([]HygieneFinding(nil), c.hygiene.findings...)
+	missing := make(map[string]int)
+	for _, page := range pages {
+		if page.StatusCode == http.StatusNotFound || page.StatusCode == http.StatusGone {
+			missing[page.URL] = page.StatusCode
+		}
+	}
+	for _, crawlErr := range c.result.Errors {
+		if crawlErr.StatusCode == http.StatusNotFound || crawlErr.StatusCode == http.StatusGone {
+			missing[crawlErr.URL] = crawlErr.StatusCode
+		}
+	}
+	for pageURL, code := range missing {
+		if finding, ok := c.hygiene.listed[pageURL]; ok {
+			finding.Problem, finding.Detail = HygieneNotFound, fmt.Sprintf("the listed URL answered HTTP %d", code)
+			findings = append(findings, finding)
+		}
+	}
+	sortHygieneFindings(findings)
+	return &SiteHygiene{Files: c.hygiene.files, Findings: findings, CaseCollisions: FindCaseCollisions(pages, c.result.Errors)}
+}
+
+// sortHygieneFindings orders findings by file, then by position.
+func sortHygieneFindings(findings []HygieneFinding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Entry != b.Entry {
+			return a.Entry < b.Entry
+		}
+		return a.Problem < b.Problem
+	})
+}
+
+// mergeSiteHygiene combines the SiteHygiene of shards, which all check
+// the same files but each report the missing URLs it fetched itself. The
+// case collisions span shards and are found again in the merged pages.
+func mergeSiteHygiene(shards []*SiteHygiene) *SiteHygiene {
+	var merged *SiteHygiene
+	seen := make(map[HygieneFinding]bool)
+	for _, h := range shards {
+		if h == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &SiteHygiene{Files: h.Files}
+		}
+		for _, finding := range h.Findings {
+			if !seen[finding] {
+				seen[finding] = true
+				merged.Findings = append(merged.Findings, finding)
+			}
+		}
+	}
+	if merged != nil {
+		sortHygieneFindings(merged.Findings)
+	}
+	return merged
+}
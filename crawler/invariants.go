@@ -0,0 +1,265 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// Invariants of the results of a crawl, in InvariantViolation.Invariant.
+const (
+	// InvariantMaxDepth: a page or error is deeper than the depth limit.
+	InvariantMaxDepth = "depth-over-max"
+	// InvariantShortestDepth: a page links to a stored URL more than one
+	// level deeper than itself, so the depth of that URL is not its
+	// shortest chain of links, as when concurrent workers race.
+	InvariantShortestDepth = "depth-not-shortest"
+	// InvariantDuplicatePage: a URL is stored as a page more than once.
+	InvariantDuplicatePage = "duplicate-page"
+	// InvariantDuplicateError: a URL is recorded as an error more than
+	// once.
+	InvariantDuplicateError = "duplicate-error"
+	// InvariantPageAndError: a URL is stored both as a page and as an
+	// error, so it was fetched twice.
+	InvariantPageAndError = "page-and-error"
+	// InvariantCredentials: a stored page or link has a URL with a user
+	// name or password.
+	InvariantCredentials = "credentials-url"
+	// InvariantStatus: a page has no valid HTTP status.
+	InvariantStatus = "invalid-status"
+	// InvariantTimes: the crawl ends before it starts.
+	InvariantTimes = "end-before-start"
+	// InvariantPageCount: TotalPages is not the number of stored pages.
+	InvariantPageCount = "page-count"
+)
+
+// maxInvariantViolations bounds the violations kept in InvariantViolations,
+// and maxLoggedViolations those logged.
+const (
+	maxInvariantViolations = 1000
+	maxLoggedViolations    = 20
+)
+
+// WithStrict stores the violations of the invariants of the results in
+// InvariantViolations. They are checked and logged before the results are
+// saved whether or not strict is set.
+func WithStrict(strict bool) Option {
+	return func(c *Crawler) {
+		c.strict = strict
+	}
+}
+
+// InvariantViolation is a break of an invariant of the results, which
+// points at a bug of the crawler. URL is the page or error concerned, empty
+// for the result as a whole.
+type InvariantViolation struct {
+	Invariant string `json:"invariant"`
+	URL       string `json:"url,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+// invariantIndex is what the invariants know of a crawl: the shallowest
+// depths of the stored pages and errors by language key, how often each
+// is stored, and the number of stored pages.
+type invariantIndex struct {
+	maxDepth int
+	depths   map[string]int
+	pages    map[string]int
+	errors   map[string]int
+	stored   int
+}
+
+// invariant is a check of the results. page is called with every stored
+// page and result once with the rest; either may be nil.
+type invariant struct {
+	page   func(ix *invariantIndex, page *PageData, report func(url, format string, args ...any))
+	result func(ix *invariantIndex, result *CrawlResult, report func(url, format string, args ...any))
+}
+
+// invariants are the checks of checkInvariants, by name. A new invariant
+// is one more entry.
+var invariants = []struct {
+	name string
+	invariant
+}{
+	{InvariantMaxDepth, invariant{
+		page: func(ix *invariantIndex, page *PageData, report func(string, string, ...any)) {
+			if ix.maxDepth != UnlimitedDepth && page.Depth > ix.maxDepth {
+				report(page.URL, "stored at depth %d, the limit is %d", page.Depth, ix.maxDepth)
+			}
+		},
+		result: func(ix *invariantIndex, result *CrawlResult, report func(string, string, ...any)) {
+			for _, e := range result.Errors {
+				if ix.maxDepth != UnlimitedDepth && e.Depth > ix.maxDepth {
+					report(e.URL, "error at depth %d, the limit is %d", e.Depth, ix.maxDepth)
+				}
+			}
+		},
+	}},
+	{InvariantShortestDepth, invariant{
+		page: func(ix *invariantIndex, page *PageData, report func(string, string, ...any)) {
+			for _, link := range page.Links {
+				if depth, ok := ix.depths[languageKey(page.Language, link)]; ok && depth > page.Depth+1 {
+					report(link, "stored at depth %d, linked from %s at depth %d", depth, page.URL, page.Depth)
+				}
+			}
+		},
+	}},
+	{InvariantDuplicatePage, invariant{
+		result: func(ix *invariantIndex, _ *CrawlResult, report func(string, string, ...any)) {
+			for key, n := range ix.pages {
+				if n > 1 {
+					report(key, "stored as a page %d times", n)
+				}
+			}
+		},
+	}},
+	{InvariantDuplicateError, invariant{
+		result: func(ix *invariantIndex, _ *CrawlResult, report func(string, string, ...any)) {
+			for key, n := range ix.errors {
+				if n > 1 {
+					report(key, "recorded as an error %d times", n)
+				}
+			}
+		},
+	}},
+	{InvariantPageAndError, invariant{
+		result: func(ix *invariantIndex, result *CrawlResult, report func(string, string, ...any)) {
+			for _, e := range result.Errors {
+				if ix.pages[languageKey(e.Language, e.URL)] > 0 {
+					report(e.URL, "stored as a page and recorded as a %s error", e.Category)
+				}
+			}
+		},
+	}},
+	{InvariantCredentials, invariant{
+		page: func(ix *invariantIndex, page *PageData, report func(string, string, ...any)) {
+			if hasCredentials(page.URL) {
+				report(page.URL, "the page URL has credentials")
+			}
+			for _, link := range page.Links {
+				if hasCredentials(link) {
+					report(page.URL, "links to a URL with credentials")
+					return
+				}
+			}
+		},
+	}},
+	{InvariantStatus, invariant{
+		page: func(ix *invariantIndex, page *PageData, report func(string, string, ...any)) {
+			if page.StatusCode < 100 || page.StatusCode > 599 {
+				report(page.URL, "status %d", page.StatusCode)
+			}
+		},
+	}},
+	{InvariantTimes, invariant{
+		result: func(ix *invariantIndex, result *CrawlResult, report func(string, string, ...any)) {
+			if result.EndTime.Before(result.StartTime) {
+				report("", "ends at %s, starts at %s", result.EndTime, result.StartTime)
+			}
+		},
+	}},
+	{InvariantPageCount, invariant{
+		result: func(ix *invariantIndex, result *CrawlResult, report func(string, string, ...any)) {
+			if result.TotalPages != ix.stored {
+				report("", "total_pages is %d, %d pages are stored", result.TotalPages, ix.stored)
+			}
+		},
+	}},
+}
+
+// hasCredentials reports whether rawURL has a user name or password.
+func hasCredentials(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.User != nil
+}
+
+// checkInvariants checks the results against invariants, logging the
+// violations and, with WithStrict, storing them in InvariantViolations.
+// resultLock must be held.
+func (c *Crawler) checkInvariants() error {
+	violations, err := findViolations(&c.result, c.maxDepth, func(fn func(page *PageData)) error {
+		return c.eachPage(false, fn)
+	})
+	if err != nil || len(violations) == 0 {
+		return err
+	}
+	total := len(violations)
+	violations = violations[:min(total, maxInvariantViolations)]
+	c.logf("Warning: %d invariant violations in the results, which points at a bug of the crawler:\n", total)
+	for i, v := range violations {
+		if i == maxLoggedViolations {
+			c.logf("  ... and %d more\n", total-i)
+			break
+		}
+		c.logf("  %s %s: %s\n", v.Invariant, v.URL, v.Detail)
+	}
+	if c.strict {
+		c.result.InvariantViolations = violations
+	}
+	return nil
+}
+
+// findViolations returns every violation of the invariants by result, a
+// crawl to maxDepth whose stored pages eachPage calls fn with, sorted by
+// invariant and URL.
+func findViolations(result *CrawlResult, maxDepth int, eachPage func(fn func(page *PageData)) error) ([]InvariantViolation, error) {
+	ix := &invariantIndex{
+		maxDepth: maxDepth,
+		depths:   make(map[string]int),
+		pages:    make(map[string]int),
+		errors:   make(map[string]int),
+	}
+	if err := eachPage(func(page *PageData) {
+		key := languageKey(page.Language, page.URL)
+		ix.stored++
+		ix.pages[key]++
+		if depth, ok := ix.depths[key]; !ok || page.Depth < depth {
+			ix.depths[key] = page.Depth
+		}
+	}); err != nil {
+		return nil, err
+	}
+	for _, e := range result.Errors {
+		key := languageKey(e.Language, e.URL)
+		ix.errors[key]++
+		if depth, ok := ix.depths[key]; !ok || e.Depth < depth {
+			ix.depths[key] = e.Depth
+		}
+	}
+
+	var violations []InvariantViolation
+	reports := make([]func(url, format string, args ...any), len(invariants))
+	for i, inv := range invariants {
+		reports[i] = func(url, format string, args ...any) {
+			violations = append(violations, InvariantViolation{Invariant: inv.name, URL: url, Detail: fmt.Sprintf(format, args...)})
+		}
+	}
+	if err := eachPage(func(page *PageData) {
+		for i, inv := range invariants {
+			if inv.page != nil {
+				inv.page(ix, page, reports[i])
+			}
+		}
+	}); err != nil {
+		return nil, err
+	}
+	for i, inv := range invariants {
+		if inv.result != nil {
+			inv.result(ix, result, reports[i])
+		}
+	}
+	// The checks over maps report in random order, so the violations are
+	// sorted before they are cut to the ones kept.
+	sort.Slice(violations, func(i, j int) bool {
+		a, b := violations[i], violations[j]
+		if a.Invariant != b.Invariant {
+			return a.Invariant < b.Invariant
+		}
+		if a.URL != b.URL {
+			return a.URL < b.URL
+		}
+		return a.Detail < b.Detail
+	})
+	return violations, nil
+}
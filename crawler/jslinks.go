@@ -0,0 +1,88 @@
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/encoding"
+)
+
+const DefaultJSLinksPerPage = 20
+
+// jsLinkPatterns match navigation written as inline JavaScript, e.g.
+// location.href='/foo' or window.open("/bar"). Only quoted literals are
+// recognised; nothing is ever executed.
+var jsLinkPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`location(?:\.href)?\s*=\s*['"]([^'"\s]+)['"]`),
+	regexp.MustCompile(`window\.open\(\s*['"]([^'"\s]+)['"]`),
+}
+
+type jsLinkOptions struct {
+	enabled    bool
+	follow     bool
+	maxPerPage int
+}
+
+// WithJSLinks enables the heuristic extractor for links found in onclick and
+// onmousedown handlers and inline script blocks. Found links are recorded in
+// LinkDetails with Source "js"; they are crawled only when follow is set.
+// At most maxPerPage links are taken from one page.
+func WithJSLinks(follow bool, maxPerPage int) Option {
+	return func(c *Crawler) {
+		if maxPerPage <= 0 {
+			maxPerPage = DefaultJSLinksPerPage
+		}
+		c.jsLinks = jsLinkOptions{enabled: true, follow: follow, maxPerPage: maxPerPage}
+	}
+}
+
+// extractJSLinks returns the unique same-domain URLs referenced by inline
+// JavaScript in doc, resolved against pageURL. enc is the encoding of the
+// page, as for anchors.
+func (c *Crawler) extractJSLinks(doc *goquery.Document, pageURL *url.URL, enc encoding.Encoding) []string {
+	var sources []string
+	doc.Find("[onclick], [onmousedown]").Each(func(_ int, s *goquery.Selection) {
+		for _, attr := range []string{"onclick", "onmousedown"} {
+			if code, ok := s.Attr(attr); ok {
+				sources = append(sources, code)
+			}
+		}
+	})
+	doc.Find("script:not([src])").Each(func(_ int, s *goquery.Selection) {
+		sources = append(sources, s.Text())
+	})
+
+	seen := make(map[string]bool)
+	links := make([]string, 0)
+	for _, code := range sources {
+		for _, pattern := range jsLinkPatterns {
+			for _, match := range pattern.FindAllStringSubmatch(code, -1) {
+				if len(links) >= c.jsLinks.maxPerPage {
+					return links
+				}
+
+				ref := match[1]
+				if strings.HasPrefix(ref, "#") || strings.HasPrefix(strings.ToLower(ref), "javascript:") {
+					continue
+				}
+				absoluteURL, err := pageURL.Parse(encodeQuery(ref, enc))
+				if err != nil || !c.isSameDomain(absoluteURL) {
+					continue
+				}
+				c.noteHostDot(absoluteURL, pageURL.String())
+				if absoluteURL.Scheme != "http" && absoluteURL.Scheme != "https" {
+					continue
+				}
+
+				link := c.normalizeLink(absoluteURL)
+				if !seen[link] {
+					seen[link] = true
+					links = append(links, link)
+				}
+			}
+		}
+	}
+	return links
+}
@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"runtime"
+)
+
+const (
+	// jsonChunkPages is the number of pages encoded together by one worker.
+	jsonChunkPages = 256
+
+	jsonBufferSize = 1 << 20
+)
+
+// pagesPlaceholder is how the top-level pages field of a CrawlResult with
+// nil Pages is encoded by json.MarshalIndent with a two-space indent.
+// Nested fields are indented further, so the match is unambiguous.
+var pagesPlaceholder = []byte("\n  \"pages\": null")
+
+// pageSource yields stored pages in order, in batches. A batch is only
+// valid during the call to fn.
+type pageSource func(fn func(pages []PageData) error) error
+
+// slicePages is the pageSource of pages held in memory.
+func slicePages(pages []PageData) pageSource {
+	return func(fn func(pages []PageData) error) error {
+		if len(pages) == 0 {
+			return nil
+		}
+		return fn(pages)
+	}
+}
+
+// writeResultJSON writes result as indented JSON, byte for byte what
+// json.Encoder with SetIndent("", "  ") produces, with the pages taken
+// from pages instead of result.Pages. Pages are encoded in chunks by
+// parallel workers and written in order, so memory use depends on the
+// chunk size rather than on the number of pages.
+func writeResultJSON(w io.Writer, result *CrawlResult, pages pageSource) error {
+	header := *result
+	header.Pages = nil
+	encoded, err := json.MarshalIndent(header, "", "  ")
+	if err != nil {
+		return err
+	}
+	i := bytes.Index(encoded, pagesPlaceholder)
+	if i < 0 {
+		return errors.New("pages field not found in encoded result")
+	}
+
+	out := bufio.NewWriterSize(w, jsonBufferSize)
+	out.Write(encoded[:i+len(pagesPlaceholder)-len("null")])
+	if pages == nil {
+		out.WriteString("null")
+	} else {
+		first := true
+		err := pages(func(batch []PageData) error {
+			return writePagesJSON(out, batch, &first)
+		})
+		if err != nil {
+			return err
+		}
+		if first {
+			out.WriteString("[]")
+		} else {
+			out.WriteString("\n  ]")
+		}
+	}
+	out.Write(encoded[i+len(pagesPlaceholder):])
+	out.WriteByte('\n')
+	return out.Flush()
+}
+
+// writePagesJSON writes pages as elements of a JSON array nested one level
+// deep in an indented document. first is set while no element has been
+// written; the opening bracket is written with the first element.
+func writePagesJSON(out *bufio.Writer, pages []PageData, first *bool) error {
+	type chunk struct {
+		data []byte
+		err  error
+	}
+	workers := runtime.GOMAXPROCS(0)
+	// Each chunk has its own result channel; the channel of channels keeps
+	// them in order while at most workers chunks are in flight.
+	pending := make(chan chan chunk, workers)
+	go func() {
+		defer close(pending)
+		for start := 0; start < len(pages); start += jsonChunkPages {
+			end := min(start+jsonChunkPages, len(pages))
+			done := make(chan chunk, 1)
+			pending <- done
+			go func(pages []PageData) {
+				var buf bytes.Buffer
+				for _, page := range pages {
+					encoded, err := json.MarshalIndent(page, "    ", "  ")
+					if err != nil {
+						done <- chunk{err: err}
+						return
+					}
+					buf.WriteString(",\n    ")
+					buf.Write(encoded)
+				}
+				done <- chunk{data: buf.Bytes()}
+			}(pages[start:end])
+		}
+	}()
+
+	var failed error
+	for done := range pending {
+		c := <-done
+		if failed != nil {
+			continue
+		}
+		if c.err != nil {
+			failed = c.err
+			continue
+		}
+		if *first {
+			// Replace the separator in front of the first element.
+			out.WriteString("[")
+			c.data = c.data[1:]
+			*first = false
+		}
+		out.Write(c.data)
+	}
+	return failed
+}
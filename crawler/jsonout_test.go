@@ -0,0 +1,172 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// generatedResult returns a result of n pages with nested fields, escapes
+// and non-ASCII text.
+func generatedResult(n int) *CrawlResult {
+	start := time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC)
+	result := &CrawlResult{
+		BaseURL:    "http://example.com/",
+		MaxDepth:   3,
+		StartTime:  start,
+		EndTime:    start.Add(time.Hour),
+		TotalPages: n,
+		Errors:     []CrawlError{{URL: "http://example.com/gone", StatusCode: 404, Category: CategoryHTTPStatus, Error: "not found"}},
+	}
+	for i := 0; i < n; i++ {
+		page := PageData{
+			URL:          fmt.Sprintf("http://example.com/p/%d?q=<&>", i),
+			Title:        fmt.Sprintf("Page %d — «quoted» \"title\" <b> ", i),
+			Links:        []string{"http://example.com/", fmt.Sprintf("http://example.com/p/%d", i+1)},
+			Depth:        i % 4,
+			CrawledAt:    start.Add(time.Duration(i) * time.Second),
+			ResponseTime: int64(i),
+			StatusCode:   200,
+			LinkScore:    float64(i) / 7,
+		}
+		if i%3 == 0 {
+			page.LinkDetails = []LinkDetail{{URL: "http://example.com/", Text: "home", Source: LinkSourceAnchor}}
+			page.LegacyMarkup = &LegacyMarkup{Elements: map[string]int{"font": i, "center": 1}, Total: i + 1}
+		}
+		if i%5 == 0 {
+			page.Links = []string{}
+		}
+		result.Pages = append(result.Pages, page)
+	}
+	return result
+}
+
+// encoderJSON is the output of json.Encoder, which writeResultJSON must
+// match.
+func encoderJSON(t *testing.T, result *CrawlResult) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// batchPages yields pages in batches of size.
+func batchPages(pages []PageData, size int) pageSource {
+	return func(fn func([]PageData) error) error {
+		for start := 0; start < len(pages); start += size {
+			if err := fn(pages[start:min(start+size, len(pages))]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestWriteResultJSON(t *testing.T) {
+	for _, n := range []int{0, 1, jsonChunkPages - 1, jsonChunkPages, jsonChunkPages + 1, 5000} {
+		result := generatedResult(n)
+		if n == 0 {
+			result.Pages = []PageData{}
+		}
+		want := encoderJSON(t, result)
+		for _, source := range []struct {
+			name  string
+			pages pageSource
+		}{
+			{"slice", slicePages(result.Pages)},
+			{"batches of 100", batchPages(result.Pages, 100)},
+			{"batches of 1", batchPages(result.Pages, 1)},
+		} {
+			if n == 5000 && source.name == "batches of 1" {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := writeResultJSON(&buf, result, source.pages); err != nil {
+				t.Fatalf("%d pages, %s: %v", n, source.name, err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("%d pages, %s: the output differs from json.Encoder at byte %d", n, source.name, firstDifference(buf.Bytes(), want))
+			}
+			var decoded CrawlResult
+			if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+				t.Fatalf("%d pages, %s: %v", n, source.name, err)
+			}
+			if len(decoded.Pages) != n || !reflect.DeepEqual(decoded.Errors, result.Errors) {
+				t.Errorf("%d pages, %s: decoded %d pages and errors %+v", n, source.name, len(decoded.Pages), decoded.Errors)
+			}
+		}
+	}
+}
+
+// firstDifference returns the offset of the first byte where a and b
+// differ.
+func firstDifference(a, b []byte) int {
+	for i := range min(len(a), len(b)) {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return min(len(a), len(b))
+}
+
+func TestWriteResultJSONNilPages(t *testing.T) {
+	result := generatedResult(0)
+	var buf bytes.Buffer
+	if err := writeResultJSON(&buf, result, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := encoderJSON(t, result); !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got\n%s\nwant\n%s", buf.Bytes(), want)
+	}
+	if !strings.Contains(buf.String(), `"pages": null`) {
+		t.Error("nil pages are not written as null")
+	}
+}
+
+func TestWriteResultJSONErrors(t *testing.T) {
+	result := generatedResult(jsonChunkPages * 3)
+	// NaN has no JSON encoding.
+	result.Pages[jsonChunkPages+7].LinkScore = math.NaN()
+	if err := writeResultJSON(&bytes.Buffer{}, result, slicePages(result.Pages)); err == nil {
+		t.Error("a page that does not encode gave no error")
+	}
+
+	failing := fmt.Errorf("spill file is gone")
+	source := func(fn func([]PageData) error) error { return failing }
+	if err := writeResultJSON(&bytes.Buffer{}, generatedResult(1), source); err != failing {
+		t.Errorf("error %v, want the error of the pages", err)
+	}
+}
+
+// TestSavedSpilledResults checks that the results file of a crawl whose
+// pages were moved to disk holds every page.
+func TestSavedSpilledResults(t *testing.T) {
+	routes := map[string]http.HandlerFunc{}
+	var links strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&links, `<a href="/p%d">%d</a> `, i, i)
+		routes[fmt.Sprintf("/p%d", i)] = htmlPage("page")
+	}
+	routes["/"] = htmlPage(links.String())
+	site := newTestSite(t, routes)
+	filename := filepath.Join(t.TempDir(), "results.json")
+	crawlTestSite(t, site.URL, 1, WithResultLimit(5, 0), WithOutputPath(filename))
+	saved, err := LoadResults(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Pages) != 31 || saved.TotalPages != 31 {
+		t.Errorf("saved %d pages (total %d), want 31", len(saved.Pages), saved.TotalPages)
+	}
+}
@@ -0,0 +1,60 @@
+package crawler
+
+import "strings"
+
+// WithAcceptLanguage sends value, such as "de-DE,de;q=0.9", as the
+// Accept-Language header of every request.
+func WithAcceptLanguage(value string) Option {
+	return func(c *Crawler) {
+		c.acceptLanguage = strings.TrimSpace(value)
+	}
+}
+
+// WithLanguages crawls the site once per language, sending each value as
+// Accept-Language. Pages and errors are stored per language, with the
+// language in PageData.Language, so a URL is fetched once in every pass.
+func WithLanguages(languages []string) Option {
+	return func(c *Crawler) {
+		c.languages = nil
+		for _, language := range languages {
+			if language = strings.TrimSpace(language); language != "" {
+				c.languages = append(c.languages, language)
+			}
+		}
+	}
+}
+
+// passes returns the Accept-Language value of each crawl pass; "" sends
+// no header.
+func (c *Crawler) passes() []string {
+	if len(c.languages) > 0 {
+		return c.languages
+	}
+	return []string{c.acceptLanguage}
+}
+
+// startPass makes the following requests use language. In multi-pass mode
+// the language also becomes part of the visited keys.
+func (c *Crawler) startPass(language string) {
+	c.language = language
+	if len(c.languages) > 0 {
+		c.keyLanguage = language
+	}
+}
+
+// languageKey is the visited and discovered key of url crawled in
+// language, which is "" outside multi-pass mode.
+func languageKey(language, url string) string {
+	if language == "" {
+		return url
+	}
+	return language + " " + url
+}
+
+// visitKey is the key of url in the current pass.
+func (c *Crawler) visitKey(url string) string {
+	if c.lowercasePaths {
+		url = lowercasePath(url)
+	}
+	return languageKey(c.keyLanguage, url)
+}
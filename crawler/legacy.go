@@ -0,0 +1,208 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// DefaultLegacyElements are the elements WithLegacyMarkup counts by
+// default: those HTML5 made obsolete.
+var DefaultLegacyElements = []string{
+	"acronym", "applet", "basefont", "big", "blink", "center", "dir", "font",
+	"frame", "frameset", "isindex", "marquee", "strike", "tt",
+}
+
+// DefaultLegacyAttributes are the attributes WithLegacyMarkup counts by
+// default, on any element: the presentational ones CSS replaced.
+var DefaultLegacyAttributes = []string{
+	"align", "background", "bgcolor", "border", "cellpadding", "cellspacing",
+	"hspace", "nowrap", "valign", "vspace",
+}
+
+// legacyMarkupOptions configures WithLegacyMarkup. The names are
+// lowercase.
+type legacyMarkupOptions struct {
+	enabled    bool
+	elements   map[string]bool
+	attributes map[string]bool
+}
+
+// WithLegacyMarkup records in LegacyMarkup how much markup of every page
+// predates CSS: the elements of elements, the elements with an inline
+// style attribute and the attributes of attributes. Nil lists use
+// DefaultLegacyElements and DefaultLegacyAttributes; an empty, non-nil list
+// counts none.
+func WithLegacyMarkup(elements, attributes []string) Option {
+	return func(c *Crawler) {
+		if elements == nil {
+			elements = DefaultLegacyElements
+		}
+		if attributes == nil {
+			attributes = DefaultLegacyAttributes
+		}
+		c.legacyMarkup = legacyMarkupOptions{enabled: true, elements: lowerSet(elements), attributes: lowerSet(attributes)}
+	}
+}
+
+// lowerSet returns the set of names, lowercased.
+func lowerSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	return set
+}
+
+// ValidateLegacyNames checks element or attribute names given to
+// WithLegacyMarkup, which are plain names such as font, not selectors.
+func ValidateLegacyNames(names []string) error {
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, " \t\n<>=\"'[]()/.#:,*") {
+			return fmt.Errorf("%q is not an element or attribute name", name)
+		}
+	}
+	return nil
+}
+
+// LegacyMarkup counts the legacy markup of a page. Elements and Attributes
+// count the occurrences of each configured element and attribute found,
+// InlineStyles the elements with a style attribute, and Total all of them.
+type LegacyMarkup struct {
+	Elements     map[string]int `json:"elements,omitempty"`
+	Attributes   map[string]int `json:"attributes,omitempty"`
+	InlineStyles int            `json:"inline_styles,omitempty"`
+	Total        int            `json:"total"`
+}
+
+// extract counts the legacy markup of doc.
+func (o legacyMarkupOptions) extract(doc *goquery.Document) *LegacyMarkup {
+	legacy := &LegacyMarkup{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if o.elements[n.Data] {
+				if legacy.Elements == nil {
+					legacy.Elements = make(map[string]int)
+				}
+				legacy.Elements[n.Data]++
+				legacy.Total++
+			}
+			for _, attr := range n.Attr {
+				switch {
+				case attr.Namespace != "":
+				case attr.Key == "style":
+					if strings.TrimSpace(attr.Val) != "" {
+						legacy.InlineStyles++
+						legacy.Total++
+					}
+				case o.attributes[attr.Key]:
+					if legacy.Attributes == nil {
+						legacy.Attributes = make(map[string]int)
+					}
+					legacy.Attributes[attr.Key]++
+					legacy.Total++
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	for _, n := range doc.Nodes {
+		walk(n)
+	}
+	return legacy
+}
+
+// LegacyCount is the number of occurrences of an element or attribute
+// across a crawl, and of the pages having it.
+type LegacyCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Pages int    `json:"pages"`
+}
+
+// LegacyMarkupSummary aggregates the LegacyMarkup of the pages of a crawl.
+// Audited counts the pages it was recorded for and Affected those with any.
+// Elements and Attributes are sorted by occurrences, most first, and Worst
+// lists the pages with the most legacy markup.
+type LegacyMarkupSummary struct {
+	Audited      int           `json:"audited"`
+	Affected     int           `json:"affected"`
+	Total        int           `json:"total"`
+	InlineStyles LegacyCount   `json:"inline_styles"`
+	Elements     []LegacyCount `json:"elements,omitempty"`
+	Attributes   []LegacyCount `json:"attributes,omitempty"`
+	Worst        []PageData    `json:"worst,omitempty"`
+}
+
+// SummarizeLegacyMarkup aggregates the LegacyMarkup of pages, keeping the
+// n pages with the highest totals as Worst.
+func SummarizeLegacyMarkup(pages []PageData, n int) LegacyMarkupSummary {
+	summary := LegacyMarkupSummary{InlineStyles: LegacyCount{Name: "style"}}
+	elements := make(map[string]*LegacyCount)
+	attributes := make(map[string]*LegacyCount)
+	add := func(counts map[string]*LegacyCount, name string, count int) {
+		c := counts[name]
+		if c == nil {
+			c = &LegacyCount{Name: name}
+			counts[name] = c
+		}
+		c.Count += count
+		c.Pages++
+	}
+	var affected []PageData
+	for _, page := range pages {
+		legacy := page.LegacyMarkup
+		if legacy == nil {
+			continue
+		}
+		summary.Audited++
+		if legacy.Total == 0 {
+			continue
+		}
+		summary.Affected++
+		summary.Total += legacy.Total
+		if legacy.InlineStyles > 0 {
+			summary.InlineStyles.Count += legacy.InlineStyles
+			summary.InlineStyles.Pages++
+		}
+		for name, count := range legacy.Elements {
+			add(elements, name, count)
+		}
+		for name, count := range legacy.Attributes {
+			add(attributes, name, count)
+		}
+		affected = append(affected, page)
+	}
+	summary.Elements = sortedLegacyCounts(elements)
+	summary.Attributes = sortedLegacyCounts(attributes)
+	sort.SliceStable(affected, func(i, j int) bool {
+		if ti, tj := affected[i].LegacyMarkup.Total, affected[j].LegacyMarkup.Total; ti != tj {
+			return ti > tj
+		}
+		return affected[i].URL < affected[j].URL
+	})
+	summary.Worst = affected[:min(n, len(affected))]
+	return summary
+}
+
+// sortedLegacyCounts returns counts by occurrences, most first.
+func sortedLegacyCounts(counts map[string]*LegacyCount) []LegacyCount {
+	sorted := make([]LegacyCount, 0, len(counts))
+	for _, c := range counts {
+		sorted = append(sorted, *c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
@@ -0,0 +1,102 @@
+package crawler
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// legacyBody has obsolete elements, presentational attributes and inline
+// styles, some of them in forms that do not count.
+const legacyBody = `<center><FONT color="red">a</FONT> <font>b</font></center>
+	<table border="1" CellPadding="2" align="center"><tr><td valign="top" style="color: red">c</td></tr></table>
+	<p style=" ">a blank style</p> <p data-align="left">a data attribute</p>
+	<svg><use xlink:href="#icon"></use></svg> <a href="/modern">modern</a>`
+
+func TestCrawlLegacyMarkup(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/":       htmlPage(legacyBody),
+		"/modern": htmlPage(`<main><p class="intro">clean</p></main>`),
+	})
+	tests := []struct {
+		name                 string
+		elements, attributes []string
+		want                 LegacyMarkup
+	}{
+		{
+			"default lists", nil, nil,
+			LegacyMarkup{
+				Elements:     map[string]int{"center": 1, "font": 2},
+				Attributes:   map[string]int{"align": 1, "border": 1, "cellpadding": 1, "valign": 1},
+				InlineStyles: 1, Total: 8,
+			},
+		},
+		{
+			// The xlink:href of the SVG is another attribute than href.
+			"custom lists", []string{" FONT ", "marquee"}, []string{"Valign", "color", "href"},
+			LegacyMarkup{
+				Elements:     map[string]int{"font": 2},
+				Attributes:   map[string]int{"valign": 1, "color": 1, "href": 1},
+				InlineStyles: 1, Total: 6,
+			},
+		},
+		// Inline styles are counted with no list to count.
+		{"empty lists", []string{}, []string{}, LegacyMarkup{InlineStyles: 1, Total: 1}},
+	}
+	for _, tt := range tests {
+		result := crawlTestSite(t, site.URL, 1, WithLegacyMarkup(tt.elements, tt.attributes))
+		page := findPage(result, site.URL, "/")
+		if page == nil || page.LegacyMarkup == nil || !reflect.DeepEqual(*page.LegacyMarkup, tt.want) {
+			t.Errorf("%s: legacy markup %+v, want %+v", tt.name, page, tt.want)
+		}
+		if modern := findPage(result, site.URL, "/modern"); modern == nil || !reflect.DeepEqual(modern.LegacyMarkup, &LegacyMarkup{}) {
+			t.Errorf("%s: legacy markup %+v of a modern page, want an empty count", tt.name, modern)
+		}
+	}
+
+	result := crawlTestSite(t, site.URL, 1)
+	if page := findPage(result, site.URL, "/"); page == nil || page.LegacyMarkup != nil {
+		t.Errorf("legacy markup %+v without WithLegacyMarkup", page)
+	}
+}
+
+func TestValidateLegacyNames(t *testing.T) {
+	if err := ValidateLegacyNames([]string{"font", " bgcolor ", "x-custom", "data_old"}); err != nil {
+		t.Errorf("plain names: %v", err)
+	}
+	for _, name := range []string{"", " ", "font center", "div.old", "[align]", "td:first-child", "<font>", "a,b", "*"} {
+		if err := ValidateLegacyNames([]string{"font", name}); err == nil || !strings.Contains(err.Error(), "is not an element or attribute name") {
+			t.Errorf("ValidateLegacyNames(%q) = %v", name, err)
+		}
+	}
+}
+
+func TestSummarizeLegacyMarkup(t *testing.T) {
+	pages := []PageData{
+		{URL: "http://example.com/a", LegacyMarkup: &LegacyMarkup{Elements: map[string]int{"font": 3}, Attributes: map[string]int{"align": 1}, InlineStyles: 2, Total: 6}},
+		{URL: "http://example.com/b", LegacyMarkup: &LegacyMarkup{Elements: map[string]int{"font": 1, "center": 1}, Total: 2}},
+		{URL: "http://example.com/c", LegacyMarkup: &LegacyMarkup{Attributes: map[string]int{"bgcolor": 2}, Total: 2}},
+		{URL: "http://example.com/clean", LegacyMarkup: &LegacyMarkup{}},
+		{URL: "http://example.com/unaudited"},
+	}
+	summary := SummarizeLegacyMarkup(pages, 2)
+	want := LegacyMarkupSummary{
+		Audited:      4,
+		Affected:     3,
+		Total:        10,
+		InlineStyles: LegacyCount{Name: "style", Count: 2, Pages: 1},
+		Elements:     []LegacyCount{{Name: "font", Count: 4, Pages: 2}, {Name: "center", Count: 1, Pages: 1}},
+		Attributes:   []LegacyCount{{Name: "bgcolor", Count: 2, Pages: 1}, {Name: "align", Count: 1, Pages: 1}},
+		// Ties go by URL.
+		Worst: []PageData{pages[0], pages[1]},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("summary %+v, want %+v", summary, want)
+	}
+
+	empty := SummarizeLegacyMarkup(pages[3:], 10)
+	if empty.Audited != 1 || empty.Affected != 0 || len(empty.Worst) != 0 || len(empty.Elements) != 0 {
+		t.Errorf("summary %+v of a clean crawl", empty)
+	}
+}
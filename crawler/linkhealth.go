@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Defaults of FindBadLinkPages: a page is listed when at least half of at
+// least 5 resolved internal links are broken or redirected.
+const (
+	DefaultBadLinkShare    = 0.5
+	DefaultBadLinkMinLinks = 5
+)
+
+// linkOutcome is what a link target turned out to be in a crawl.
+type linkOutcome int
+
+const (
+	// linkUnknown targets were not fetched, such as those out of budget or
+	// filtered, or failed without telling whether they exist, such as
+	// timeouts.
+	linkUnknown linkOutcome = iota
+	linkOK
+	linkBroken
+	linkRedirected
+)
+
+// BadLinkPage is a page a large share of whose internal links are broken,
+// answered with a 4xx or 5xx status, or redirected. Links counts its
+// distinct internal links; Unknown those whose target was not fetched or
+// whose outcome is unknown, which are left out of BadShare, the share of
+// the resolved links that are broken or redirected.
+type BadLinkPage struct {
+	URL        string  `json:"url"`
+	Links      int     `json:"links"`
+	Broken     int     `json:"broken"`
+	Redirected int     `json:"redirected"`
+	Unknown    int     `json:"unknown"`
+	BadShare   float64 `json:"bad_share"`
+}
+
+// BadLinkSection groups the pages of FindBadLinkPages by path section,
+// which points at the template responsible. Pages lists them, worst first.
+type BadLinkSection struct {
+	Section    string        `json:"section"`
+	Broken     int           `json:"broken"`
+	Redirected int           `json:"redirected"`
+	Pages      []BadLinkPage `json:"pages"`
+}
+
+// linkOutcomes indexes every URL of result by what fetching it gave.
+func linkOutcomes(result *CrawlResult) map[string]linkOutcome {
+	outcomes := make(map[string]linkOutcome)
+	for _, page := range result.Pages {
+		for _, hop := range page.RedirectChain {
+			outcomes[hop.URL] = linkRedirected
+		}
+		switch {
+		case page.Alias || page.UnfollowedRedirect != "" || len(page.RedirectChain) > 0 && page.FinalURL != page.URL:
+			outcomes[page.URL] = linkRedirected
+		default:
+			outcomes[page.URL] = linkOK
+		}
+		if _, ok := outcomes[page.FinalURL]; !ok && page.FinalURL != "" && !page.Alias && page.UnfollowedRedirect == "" {
+			outcomes[page.FinalURL] = linkOK
+		}
+	}
+	for _, e := range result.Errors {
+		if _, ok := outcomes[e.URL]; ok {
+			continue
+		}
+		switch {
+		case e.StatusCode >= http.StatusBadRequest:
+			outcomes[e.URL] = linkBroken
+		case e.Category == CategoryRedirectLoop || e.Category == CategoryRedirectLimit:
+			outcomes[e.URL] = linkRedirected
+		case e.Category == CategoryNonHTML || e.Category == CategoryTooLarge ||
+			e.Category == CategoryParse || e.Category == CategorySlowBody:
+			// The target exists; it just is not a page the crawl keeps.
+			outcomes[e.URL] = linkOK
+		}
+	}
+	return outcomes
+}
+
+// FindBadLinkPages joins the internal links of every page of result
+// against what their targets answered and returns the pages with at least
+// minLinks resolved links of which at least share are broken or
+// redirected, grouped by PathSectionOf at depth. Sections with the most
+// pages come first. Redirect aliases have no links and are not counted.
+func FindBadLinkPages(result *CrawlResult, share float64, minLinks, depth int) []BadLinkSection {
+	outcomes := linkOutcomes(result)
+	sections := make(map[string]*BadLinkSection)
+	for _, page := range result.Pages {
+		if page.Alias {
+			continue
+		}
+		bad := BadLinkPage{URL: page.URL}
+		seen := make(map[string]bool, len(page.Links))
+		for _, link := range page.Links {
+			if seen[link] {
+				continue
+			}
+			seen[link] = true
+			bad.Links++
+			switch outcomes[link] {
+			case linkBroken:
+				bad.Broken++
+			case linkRedirected:
+				bad.Redirected++
+			case linkUnknown:
+				bad.Unknown++
+			}
+		}
+		resolved := bad.Links - bad.Unknown
+		if resolved == 0 || resolved < minLinks {
+			continue
+		}
+		bad.BadShare = float64(bad.Broken+bad.Redirected) / float64(resolved)
+		if bad.BadShare < share {
+			continue
+		}
+		name := PathSectionOf(page.URL, depth)
+		section := sections[name]
+		if section == nil {
+			section = &BadLinkSection{Section: name}
+			sections[name] = section
+		}
+		section.Broken += bad.Broken
+		section.Redirected += bad.Redirected
+		section.Pages = append(section.Pages, bad)
+	}
+
+	found := make([]BadLinkSection, 0, len(sections))
+	for _, section := range sections {
+		sort.Slice(section.Pages, func(i, j int) bool {
+			if section.Pages[i].BadShare != section.Pages[j].BadShare {
+				return section.Pages[i].BadShare > section.Pages[j].BadShare
+			}
+			return section.Pages[i].URL < section.Pages[j].URL
+		})
+		found = append(found, *section)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if len(found[i].Pages) != len(found[j].Pages) {
+			return len(found[i].Pages) > len(found[j].Pages)
+		}
+		return found[i].Section < found[j].Section
+	})
+	return found
+}
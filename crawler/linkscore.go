@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// DefaultLinkScoreIterations is the number of PageRank iterations run
+	// after a crawl.
+	DefaultLinkScoreIterations = 20
+
+	// DefaultLinkScoreMaxPages skips link scores on crawls larger than
+	// this, where the computation would noticeably delay the results.
+	DefaultLinkScoreMaxPages = 200000
+
+	linkScoreDamping = 0.85
+)
+
+type linkScoreOptions struct {
+	iterations int
+	maxPages   int
+}
+
+// WithLinkScores sets the PageRank iterations run over the internal link
+// graph after the crawl, and the page count above which they are skipped.
+// Zero iterations disable link scores; zero maxPages removes the cap.
+func WithLinkScores(iterations, maxPages int) Option {
+	return func(c *Crawler) {
+		c.linkScores = linkScoreOptions{iterations: iterations, maxPages: maxPages}
+	}
+}
+
+// scoreLinks sets LinkScore on the stored pages, or logs why it did not.
+// pages are the page summaries, in stored order. It must be called with
+// resultLock held.
+func (c *Crawler) scoreLinks(pages []PageData) error {
+	opts := c.linkScores
+	if opts.iterations <= 0 || len(pages) == 0 {
+		return nil
+	}
+	if opts.maxPages > 0 && len(pages) > opts.maxPages {
+		c.logf("Warning: %d pages exceed the link score limit of %d, skipping link scores\n", len(pages), opts.maxPages)
+		return nil
+	}
+	scores := make([]float64, len(pages))
+	// Each language pass is its own link graph.
+	groups := make(map[string][]int)
+	for i, page := range pages {
+		groups[page.Language] = append(groups[page.Language], i)
+	}
+	for _, indices := range groups {
+		group := make([]PageData, len(indices))
+		for j, i := range indices {
+			group[j] = pages[i]
+		}
+		groupScores := linkScores(group, opts.iterations)
+		for j, i := range indices {
+			scores[i] = groupScores[j]
+		}
+	}
+
+	i := 0
+	return c.eachPage(true, func(page *PageData) {
+		page.LinkScore = scores[i]
+		i++
+	})
+}
+
+// linkScores runs PageRank over the internal links between pages and
+// returns a score per page, scaled so the average page scores 1. Links to
+// a redirecting URL count for the page it redirects to; alias records
+// score 0. Nodes are visited in URL order and the rank of dangling pages
+// is spread evenly, so identical link graphs give identical scores
+// whatever order the pages were crawled in.
+func linkScores(pages []PageData, iterations int) []float64 {
+	// Order nodes by URL so the floating point sums do not depend on the
+	// crawl order.
+	order := make([]int, 0, len(pages))
+	for i, page := range pages {
+		if !page.Alias {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(a, b int) bool { return pages[order[a]].URL < pages[order[b]].URL })
+
+	node := make(map[string]int, len(pages))
+	for n, i := range order {
+		node[pages[i].URL] = n
+		for _, hop := range pages[i].RedirectChain {
+			node[hop.URL] = n
+		}
+		if pages[i].FinalURL != "" {
+			node[pages[i].FinalURL] = n
+		}
+	}
+	for _, page := range pages {
+		if page.Alias {
+			if n, ok := node[page.FinalURL]; ok {
+				node[page.URL] = n
+			}
+		}
+	}
+
+	// out[n] lists the distinct nodes page n links to, in ascending order.
+	out := make([][]int, len(order))
+	for n, i := range order {
+		seen := make(map[int]bool)
+		for _, link := range pages[i].Links {
+			if target, ok := node[link]; ok && target != n && !seen[target] {
+				seen[target] = true
+				out[n] = append(out[n], target)
+			}
+		}
+		sort.Ints(out[n])
+	}
+
+	count := float64(len(order))
+	rank := make([]float64, len(order))
+	for n := range rank {
+		rank[n] = 1 / count
+	}
+	next := make([]float64, len(order))
+	for iter := 0; iter < iterations; iter++ {
+		dangling := 0.0
+		for n, targets := range out {
+			if len(targets) == 0 {
+				dangling += rank[n]
+			}
+		}
+		base := (1-linkScoreDamping)/count + linkScoreDamping*dangling/count
+		for n := range next {
+			next[n] = base
+		}
+		for n, targets := range out {
+			if len(targets) == 0 {
+				continue
+			}
+			share := linkScoreDamping * rank[n] / float64(len(targets))
+			for _, target := range targets {
+				next[target] += share
+			}
+		}
+		rank, next = next, rank
+	}
+
+	scores := make([]float64, len(pages))
+	for n, i := range order {
+		// Rounding hides last-bit noise from readers diffing results.
+		scores[i] = math.Round(rank[n]*count*1e6) / 1e6
+	}
+	return scores
+}
+
+// TopLinkScores returns the n non-alias pages with the highest link score,
+// ties broken by URL.
+func TopLinkScores(pages []PageData, n int) []PageData {
+	top := make([]PageData, 0, len(pages))
+	for _, page := range pages {
+		if !page.Alias {
+			top = append(top, page)
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].LinkScore != top[j].LinkScore {
+			return top[i].LinkScore > top[j].LinkScore
+		}
+		return top[i].URL < top[j].URL
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
@@ -0,0 +1,185 @@
+package crawler
+
+import (
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// linkGraph returns pages linking as links lists, by path.
+func linkGraph(links map[string][]string) []PageData {
+	var pages []PageData
+	for path, targets := range links {
+		page := PageData{URL: "http://example.com" + path}
+		for _, target := range targets {
+			page.Links = append(page.Links, "http://example.com"+target)
+		}
+		pages = append(pages, page)
+	}
+	slices.SortFunc(pages, func(a, b PageData) int { return strings.Compare(a.URL, b.URL) })
+	return pages
+}
+
+// scoresByURL runs linkScores over pages and maps the scores to the URLs.
+func scoresByURL(pages []PageData, iterations int) map[string]float64 {
+	scores := linkScores(pages, iterations)
+	byURL := make(map[string]float64, len(pages))
+	for i, page := range pages {
+		byURL[page.URL] = scores[i]
+	}
+	return byURL
+}
+
+// TestLinkScoresDeterministic checks that the scores do not depend on the
+// order the pages were crawled in, down to the last bit.
+func TestLinkScoresDeterministic(t *testing.T) {
+	pages := linkGraph(map[string][]string{
+		"/":       {"/a", "/b", "/c", "/d", "/missing"},
+		"/a":      {"/", "/b", "/b"},
+		"/b":      {"/c", "/b"},
+		"/c":      {"/", "/a", "/d"},
+		"/d":      nil,
+		"/e":      {"/d"},
+		"/orphan": {"/"},
+	})
+	want := scoresByURL(pages, DefaultLinkScoreIterations)
+	for shift := range pages {
+		shuffled := append(slices.Clone(pages[shift:]), pages[:shift]...)
+		if shift%2 == 1 {
+			slices.Reverse(shuffled)
+		}
+		for url, score := range scoresByURL(shuffled, DefaultLinkScoreIterations) {
+			if math.Float64bits(score) != math.Float64bits(want[url]) {
+				t.Errorf("order %d: %s scores %v, want %v", shift, url, score, want[url])
+			}
+		}
+	}
+	// Pages nothing links to get the base rank only, the lowest score.
+	orphan := want["http://example.com/orphan"]
+	for url, score := range want {
+		if url == "http://example.com/e" && score != orphan {
+			t.Errorf("the unlinked /e scores %v and /orphan %v, want them equal", score, orphan)
+		} else if url != "http://example.com/e" && url != "http://example.com/orphan" && score <= orphan {
+			t.Errorf("the linked %s scores %v, not above the unlinked pages' %v", url, score, orphan)
+		}
+	}
+}
+
+// TestLinkScoresDangling checks that the rank of pages without links is
+// spread over all pages, so the scores average 1.
+func TestLinkScoresDangling(t *testing.T) {
+	// / links to /a, which links nowhere. In the limit rank(/) is
+	// 0.5/1.425 of the total.
+	scores := scoresByURL(linkGraph(map[string][]string{"/": {"/a"}, "/a": nil}), 200)
+	home := math.Round(2*0.5/1.425*1e6) / 1e6
+	if scores["http://example.com/"] != home || scores["http://example.com/a"] != math.Round((2-2*0.5/1.425)*1e6)/1e6 {
+		t.Errorf("scores %v, want / at %v and /a at %v", scores, home, 2-home)
+	}
+
+	graphs := []map[string][]string{
+		{"/": nil, "/a": nil, "/b": nil},
+		{"/": {"/a", "/b"}, "/a": nil, "/b": nil, "/c": {"/"}},
+		{"/": {"/a"}, "/a": {"/b"}, "/b": {"/c"}, "/c": nil, "/d": nil},
+	}
+	for i, graph := range graphs {
+		pages := linkGraph(graph)
+		sum := 0.0
+		for _, score := range linkScores(pages, DefaultLinkScoreIterations) {
+			sum += score
+		}
+		if math.Abs(sum-float64(len(pages))) > 1e-5 {
+			t.Errorf("graph %d: scores add up to %v over %d pages, want an average of 1", i, sum, len(pages))
+		}
+	}
+	for url, score := range scoresByURL(linkGraph(graphs[0]), DefaultLinkScoreIterations) {
+		if score != 1 {
+			t.Errorf("%s scores %v among pages without links, want 1", url, score)
+		}
+	}
+}
+
+// TestLinkScoresRounding checks that scores are rounded to six decimals.
+func TestLinkScoresRounding(t *testing.T) {
+	pages := linkGraph(map[string][]string{"/": {"/a", "/b"}, "/a": {"/b"}, "/b": {"/", "/c"}, "/c": nil})
+	for _, iterations := range []int{1, 3, DefaultLinkScoreIterations} {
+		for i, score := range linkScores(pages, iterations) {
+			if math.Round(score*1e6)/1e6 != score {
+				t.Errorf("%d iterations: %s scores %v, more than six decimals", iterations, pages[i].URL, score)
+			}
+		}
+	}
+	// A cycle scores exactly 1 everywhere, without last-bit noise.
+	cycle := linkGraph(map[string][]string{"/": {"/a"}, "/a": {"/b"}, "/b": {"/c"}, "/c": {"/d"}, "/d": {"/e"}, "/e": {"/f"}, "/f": {"/"}})
+	for url, score := range scoresByURL(cycle, DefaultLinkScoreIterations) {
+		if score != 1 {
+			t.Errorf("%s scores %v in a cycle, want 1", url, score)
+		}
+	}
+}
+
+// TestLinkScoresRedirects checks that links to a redirect count for its
+// target, and that aliases score 0.
+func TestLinkScoresRedirects(t *testing.T) {
+	pages := linkGraph(map[string][]string{"/": {"/old", "/other"}, "/new": nil, "/other": nil})
+	pages[1].RedirectChain = []RedirectHop{{URL: "http://example.com/old", StatusCode: 301}}
+	direct := linkGraph(map[string][]string{"/": {"/new", "/other"}, "/new": nil, "/other": nil})
+	redirected, want := scoresByURL(pages, DefaultLinkScoreIterations), scoresByURL(direct, DefaultLinkScoreIterations)
+	if !maps.Equal(redirected, want) {
+		t.Errorf("scores %v through the redirect, want %v", redirected, want)
+	}
+
+	alias := PageData{URL: "http://example.com/moved", FinalURL: "http://example.com/new", Alias: true}
+	pages = append(linkGraph(map[string][]string{"/": {"/moved", "/other"}, "/new": nil, "/other": nil}), alias)
+	scores := scoresByURL(pages, DefaultLinkScoreIterations)
+	if scores[alias.URL] != 0 || scores["http://example.com/new"] != want["http://example.com/new"] {
+		t.Errorf("scores %v with an alias, want it at 0 and /new at %v", scores, want["http://example.com/new"])
+	}
+}
+
+func TestTopLinkScores(t *testing.T) {
+	pages := []PageData{
+		{URL: "http://example.com/b", LinkScore: 2},
+		{URL: "http://example.com/alias", LinkScore: 9, Alias: true},
+		{URL: "http://example.com/a", LinkScore: 2},
+		{URL: "http://example.com/c", LinkScore: 3},
+		{URL: "http://example.com/d", LinkScore: 0.5},
+	}
+	var urls []string
+	for _, page := range TopLinkScores(pages, 3) {
+		urls = append(urls, page.URL)
+	}
+	if want := []string{"http://example.com/c", "http://example.com/a", "http://example.com/b"}; !slices.Equal(urls, want) {
+		t.Errorf("top pages %q, want %q", urls, want)
+	}
+	if top := TopLinkScores(pages, 10); len(top) != 4 {
+		t.Errorf("%d top pages of 4 that are not aliases", len(top))
+	}
+}
+
+// TestCrawlLinkScores checks the options: scores on every page by default,
+// none with zero iterations or above the page limit.
+func TestCrawlLinkScores(t *testing.T) {
+	site := budgetSite(t, 5)
+	scored := func(opts ...Option) int {
+		t.Helper()
+		n := 0
+		for _, page := range crawlTestSite(t, site.URL, 1, opts...).Pages {
+			if page.LinkScore > 0 {
+				n++
+			}
+		}
+		return n
+	}
+	if n := scored(); n != 6 {
+		t.Errorf("%d of 6 pages scored by default", n)
+	}
+	if n := scored(WithLinkScores(0, 0)); n != 0 {
+		t.Errorf("%d pages scored with zero iterations", n)
+	}
+	if n := scored(WithLinkScores(DefaultLinkScoreIterations, 5), WithLogOutput(io.Discard)); n != 0 {
+		t.Errorf("%d pages scored above the page limit", n)
+	}
+}
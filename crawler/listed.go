@@ -0,0 +1,136 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// EdgeNotListed marks links to URLs outside the list of a crawl with
+// WithOnlyListed.
+const EdgeNotListed = "not-listed"
+
+// WithOnlyListed fetches exactly urls and nothing else: every URL is
+// crawled at depth 0, links are recorded but never followed, and a
+// redirect to a URL that is not listed is stored with UnfollowedRedirect
+// instead of being followed. Every request is checked against the list
+// before it is sent, and the result holds a ListAudit of the requests
+// made. URLs on other sites are skipped with a warning.
+func WithOnlyListed(urls []string) Option {
+	return func(c *Crawler) {
+		c.onlyListed = urls
+	}
+}
+
+// ListAudit proves that a crawl with WithOnlyListed stayed within its list.
+// Requests counts the requests sent, redirect hops included. Refused counts
+// requests to unlisted URLs that were blocked before being sent;
+// AllWithinList is set when there were none.
+type ListAudit struct {
+	Listed        int  `json:"listed"`
+	Requests      int  `json:"requests"`
+	Refused       int  `json:"refused,omitempty"`
+	AllWithinList bool `json:"all_within_list"`
+}
+
+func (a *ListAudit) String() string {
+	return fmt.Sprintf("requests made: %d, all within list: %t", a.Requests, a.AllWithinList)
+}
+
+// urlList is the list of a crawl with WithOnlyListed.
+type urlList struct {
+	urls     []string
+	listed   map[string]bool
+	requests atomic.Int64
+	refused  atomic.Int64
+}
+
+// LoadURLList reads one URL per line from path. Blank lines and lines
+// starting with # are ignored.
+func LoadURLList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening URL list: %v", err)
+	}
+	defer file.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading URL list %s: %v", path, err)
+	}
+	return urls, nil
+}
+
+// buildURLList normalizes the URLs of WithOnlyListed, dropping those the
+// crawler cannot fetch.
+func (c *Crawler) buildURLList() error {
+	if c.onlyListed == nil {
+		return nil
+	}
+	if c.sitemapURL != "" || c.assetCheck.enabled {
+		return fmt.Errorf("only listed URLs cannot be combined with a sitemap or the asset check, which request other URLs")
+	}
+	list := &urlList{listed: make(map[string]bool)}
+	skipped := 0
+	for _, raw := range c.onlyListed {
+		u, err := c.baseURL.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !c.isSameDomain(u) {
+			skipped++
+			continue
+		}
+		pageURL := NormalizeURL(u)
+		if !list.listed[pageURL] {
+			list.listed[pageURL] = true
+			list.urls = append(list.urls, pageURL)
+		}
+	}
+	if skipped > 0 {
+		c.logf("Warning: skipping %d listed URLs that are invalid or not on %s\n", skipped, c.baseURL.Host)
+	}
+	if len(list.urls) == 0 {
+		return fmt.Errorf("no listed URL is on %s", c.baseURL.Host)
+	}
+	c.list = list
+	return nil
+}
+
+// isListed reports whether pageURL may be requested. Without a list every
+// URL may.
+func (c *Crawler) isListed(pageURL string) bool {
+	return c.list == nil || c.list.listed[pageURL]
+}
+
+// listGuard is the innermost fetcher of a crawl with WithOnlyListed: it
+// counts every request, redirect hops included, and refuses those outside
+// the list, whatever sent them.
+func (c *Crawler) listGuard(next Fetcher) Fetcher {
+	return fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		if !c.isListed(NormalizeURL(req.URL)) {
+			c.list.refused.Add(1)
+			return nil, fmt.Errorf("%w: %s", ErrNotListed, req.URL)
+		}
+		c.list.requests.Add(1)
+		return next.RoundTrip(req)
+	})
+}
+
+// listAudit summarizes the requests of a crawl with WithOnlyListed.
+func (c *Crawler) listAudit() *ListAudit {
+	audit := &ListAudit{
+		Listed:   len(c.list.urls),
+		Requests: int(c.list.requests.Load()),
+		Refused:  int(c.list.refused.Load()),
+	}
+	audit.AllWithinList = audit.Refused == 0
+	return audit
+}
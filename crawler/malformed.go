@@ -0,0 +1,171 @@
+package crawler
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+const (
+	// DefaultMaxTags and DefaultMaxNesting bound the documents handed to the
+	// full HTML parser. Pages beyond either limit are read with the
+	// tokenizer-based link extractor instead.
+	DefaultMaxTags    = 200000
+	DefaultMaxNesting = 1000
+)
+
+type htmlLimits struct {
+	maxTags    int
+	maxNesting int
+}
+
+// WithHTMLLimits sets when a page is treated as malformed: more than
+// maxTags "<" characters, or elements nested more than maxNesting deep.
+// Malformed pages are not parsed into a tree; only their title and anchor
+// links are extracted, and they are stored with MalformedHTML set. Zero
+// disables a limit.
+func WithHTMLLimits(maxTags, maxNesting int) Option {
+	return func(c *Crawler) {
+		c.htmlLimits = htmlLimits{maxTags: maxTags, maxNesting: maxNesting}
+	}
+}
+
+// optionalEndTags are elements commonly left unclosed in valid HTML, and
+// voidElements never have content. Neither counts towards nesting depth.
+var (
+	optionalEndTags = map[string]bool{
+		"p": true, "li": true, "dt": true, "dd": true, "option": true, "optgroup": true,
+		"tr": true, "td": true, "th": true, "thead": true, "tbody": true, "tfoot": true,
+		"colgroup": true, "rb": true, "rt": true, "rp": true, "rtc": true,
+	}
+	voidElements = map[string]bool{
+		"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true,
+		"img": true, "input": true, "link": true, "meta": true, "param": true,
+		"source": true, "track": true, "wbr": true,
+	}
+)
+
+// isMalformed applies cheap sanity checks to body before it is parsed. The
+// tag count is a byte count of "<"; nesting is estimated with the tokenizer,
+// which does not build a tree, and stops as soon as the limit is crossed.
+func (l htmlLimits) isMalformed(body []byte) bool {
+	if l.maxTags > 0 && bytes.Count(body, []byte("<")) > l.maxTags {
+		return true
+	}
+	if l.maxNesting <= 0 {
+		return false
+	}
+
+	depth := 0
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return false
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			if !voidElements[string(name)] && !optionalEndTags[string(name)] {
+				depth++
+				if depth > l.maxNesting {
+					return true
+				}
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if depth > 0 && !optionalEndTags[string(name)] {
+				depth--
+			}
+		}
+	}
+}
+
+// anchor is an <a> element found on a page.
+type anchor struct {
+	href string
+	text string
+	rel  string
+}
+
+// documentAnchors returns the anchors of a parsed document.
+func documentAnchors(doc *goquery.Document) []anchor {
+	anchors := make([]anchor, 0)
+	doc.Find("a").Each(func(_ int, link *goquery.Selection) {
+		href, exists := link.Attr("href")
+		if !exists {
+			return
+		}
+		rel, _ := link.Attr("rel")
+		anchors = append(anchors, anchor{href: href, text: link.Text(), rel: rel})
+	})
+	return anchors
+}
+
+// tokenizeAnchors extracts the title and anchors of body with the
+// tokenizer alone, in time and memory linear in the size of the body.
+func tokenizeAnchors(r io.Reader) (string, []anchor) {
+	var title strings.Builder
+	inTitle := false
+	anchors := make([]anchor, 0)
+	var current *anchor
+	var text strings.Builder
+
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if current != nil {
+				current.text = text.String()
+				anchors = append(anchors, *current)
+			}
+			return title.String(), anchors
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			switch token.Data {
+			case "title":
+				inTitle = title.Len() == 0
+			case "a":
+				// An <a> start tag implicitly closes an open one.
+				if current != nil {
+					current.text = text.String()
+					anchors = append(anchors, *current)
+					current = nil
+				}
+				var a anchor
+				hasHref := false
+				for _, attr := range token.Attr {
+					switch attr.Key {
+					case "href":
+						a.href, hasHref = attr.Val, true
+					case "rel":
+						a.rel = attr.Val
+					}
+				}
+				if hasHref {
+					current = &a
+					text.Reset()
+				}
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "a":
+				if current != nil {
+					current.text = text.String()
+					anchors = append(anchors, *current)
+					current = nil
+				}
+			}
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			} else if current != nil {
+				text.Write(z.Text())
+			}
+		}
+	}
+}
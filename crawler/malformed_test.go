@@ -0,0 +1,121 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// nestedPage returns a page with depth unclosed <div> elements around a
+// link, the pathological template of a deeply nested site.
+func nestedPage(depth int) string {
+	return `<html><head><title>Deep</title></head><body>` + strings.Repeat("<div>", depth) +
+		`<a href="/inside" rel="nofollow">inside</a>` + `</body></html>`
+}
+
+func TestHTMLLimitsIsMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits htmlLimits
+		body   string
+		want   bool
+	}{
+		{"plain", htmlLimits{100, 10}, `<p>a<p>b<ul><li>1<li>2</ul>`, false},
+		{"at the nesting limit", htmlLimits{0, 10}, strings.Repeat("<div>", 10), false},
+		{"over the nesting limit", htmlLimits{0, 10}, strings.Repeat("<div>", 11), true},
+		{"closed elements", htmlLimits{0, 10}, strings.Repeat("<div></div>", 100), false},
+		// Void elements and optional end tags do not nest.
+		{"void elements", htmlLimits{0, 10}, strings.Repeat("<br><img src=x><input>", 50), false},
+		{"optional end tags", htmlLimits{0, 10}, "<table>" + strings.Repeat("<tr><td>cell", 50) + "</table>", false},
+		{"at the tag limit", htmlLimits{10, 0}, strings.Repeat("<b>", 10), false},
+		{"over the tag limit", htmlLimits{10, 0}, strings.Repeat("<b>", 11), true},
+		// The tag count is of "<", stray ones included.
+		{"stray brackets", htmlLimits{10, 0}, strings.Repeat("1 < 2 ", 11), true},
+		{"no limits", htmlLimits{}, nestedPage(100000), false},
+		{"generated fixture", htmlLimits{DefaultMaxTags, DefaultMaxNesting}, nestedPage(40000), true},
+	}
+	for _, tt := range tests {
+		if got := tt.limits.isMalformed([]byte(tt.body)); got != tt.want {
+			t.Errorf("%s: isMalformed = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTokenizeAnchors(t *testing.T) {
+	title, anchors := tokenizeAnchors(strings.NewReader(`<title>First</title><title>Second</title>
+		<a href="/a">A <b>bold</b></a>
+		<a name="no-href">skipped</a>
+		<a href="/b" rel="nofollow">B
+		<a href="/c">C, closing B</a>
+		<a href="">empty</a>
+		<a href="/unclosed">tail`))
+	if title != "First" {
+		t.Errorf("title %q, want the first", title)
+	}
+	want := []anchor{
+		{href: "/a", text: "A bold"},
+		{href: "/b", text: "B\n\t\t", rel: "nofollow"},
+		{href: "/c", text: "C, closing B"},
+		{href: "", text: "empty"},
+		{href: "/unclosed", text: "tail"},
+	}
+	if fmt.Sprint(anchors) != fmt.Sprint(want) {
+		t.Errorf("anchors\n%q\nwant\n%q", anchors, want)
+	}
+}
+
+// rawPage answers with body as HTML as it is.
+func rawPage(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(body))
+	}
+}
+
+// TestCrawlMalformedPage crawls a generated pathological page: it is
+// flagged, its links are still followed, and the normal page next to it is
+// parsed in full.
+func TestCrawlMalformedPage(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/":       htmlPage(`<a href="/deep">deep</a> <a href="/normal">normal</a>`),
+		"/deep":   rawPage(nestedPage(40000)),
+		"/nested": rawPage(nestedPage(2000)),
+		"/normal": htmlPage(`<link rel="stylesheet" href="/s.css"><a href="/">home</a>`),
+		"/inside": htmlPage("inside"),
+	})
+	result := crawlTestSite(t, site.URL, 2)
+	deep := findPage(result, site.URL, "/deep")
+	if deep == nil {
+		t.Fatal("/deep is not stored")
+	}
+	if !deep.MalformedHTML || deep.Title != "Deep" {
+		t.Errorf("/deep: malformed %t, title %q, want flagged with its title", deep.MalformedHTML, deep.Title)
+	}
+	if len(deep.Links) != 1 || deep.Links[0] != site.URL+"/inside" {
+		t.Errorf("/deep links to %q, want /inside", deep.Links)
+	}
+	if findPage(result, site.URL, "/inside") == nil {
+		t.Error("the link of the malformed page is not crawled")
+	}
+	normal := findPage(result, site.URL, "/normal")
+	if normal == nil || normal.MalformedHTML || len(normal.Assets) == 0 {
+		t.Errorf("/normal is not parsed in full: %+v", normal)
+	}
+
+	// A higher nesting limit lets a page through that the default flags.
+	result = crawlTestSite(t, site.URL+"/nested", 0)
+	if nested := findPage(result, site.URL, "/nested"); nested == nil || !nested.MalformedHTML {
+		t.Errorf("/nested is not flagged by default: %+v", nested)
+	}
+	result = crawlTestSite(t, site.URL+"/nested", 0, WithHTMLLimits(0, 5000))
+	if nested := findPage(result, site.URL, "/nested"); nested == nil || nested.MalformedHTML {
+		t.Errorf("/nested is flagged below its limit: %+v", nested)
+	}
+
+	// A lower tag limit flags the normal page too.
+	result = crawlTestSite(t, site.URL+"/normal", 0, WithHTMLLimits(3, 0))
+	if normal := findPage(result, site.URL, "/normal"); normal == nil || !normal.MalformedHTML {
+		t.Errorf("/normal is not flagged over its tag limit: %+v", normal)
+	}
+}
@@ -0,0 +1,230 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ManifestSchemaVersion is the version of the Manifest format. It changes
+// when a field is renamed or removed, not when one is added.
+const ManifestSchemaVersion = 1
+
+// Kinds of Artifact.
+const (
+	ArtifactResults    = "results"
+	ArtifactEdges      = "edges"
+	ArtifactHandoff    = "handoff"
+	ArtifactRecordings = "recordings"
+)
+
+// Statuses of a Manifest.
+const (
+	// ManifestCompleted: the crawl covered every URL within its limits.
+	ManifestCompleted = "completed"
+	// ManifestStopped: a budget, the circuit breaker or cancellation ended
+	// the crawl early; StopReason says which.
+	ManifestStopped = "stopped"
+	// ManifestFailed: the crawl or saving its outputs failed.
+	ManifestFailed = "failed"
+)
+
+// Artifact is a file or directory a crawl wrote. SHA256 is the checksum of
+// a file; a directory has Files instead, and Bytes sums their sizes. Host
+// is the host a results file of a crawl split by host covers.
+type Artifact struct {
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Host   string `json:"host,omitempty"`
+	Format string `json:"format,omitempty"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256,omitempty"`
+	Files  int    `json:"files,omitempty"`
+}
+
+// artifactRegistry collects the artifacts of a crawl as each output is
+// closed.
+type artifactRegistry struct {
+	lock sync.Mutex
+	list []Artifact
+}
+
+// addFile records the file at path, which must be complete, with its size
+// and checksum.
+func (r *artifactRegistry) addFile(kind, path, format string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s file: %v", kind, err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	n, err := io.Copy(hash, file)
+	if err != nil {
+		return fmt.Errorf("error reading %s file: %v", kind, err)
+	}
+	r.add(Artifact{Kind: kind, Path: path, Format: format, Bytes: n, SHA256: hex.EncodeToString(hash.Sum(nil))})
+	return nil
+}
+
+// addDir records the directory at path with the number and total size of
+// its files.
+func (r *artifactRegistry) addDir(kind, path string) error {
+	artifact := Artifact{Kind: kind, Path: path}
+	err := filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		artifact.Files++
+		artifact.Bytes += info.Size()
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading %s directory: %v", kind, err)
+	}
+	r.add(artifact)
+	return nil
+}
+
+// setHost records the host the results file at path covers.
+func (r *artifactRegistry) setHost(path, host string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := range r.list {
+		if r.list[i].Path == path {
+			r.list[i].Host = host
+		}
+	}
+}
+
+func (r *artifactRegistry) add(artifact Artifact) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.list = append(r.list, artifact)
+}
+
+// Artifacts returns the files and directories the crawl wrote, in the
+// order they were completed. Call it once Start has returned.
+func (c *Crawler) Artifacts() []Artifact {
+	c.artifacts.lock.Lock()
+	defer c.artifacts.lock.Unlock()
+	return append([]Artifact(nil), c.artifacts.list...)
+}
+
+// Manifest describes a finished crawl for the jobs consuming its outputs:
+// where they are, whether the crawl succeeded and its key counters.
+type Manifest struct {
+	SchemaVersion int    `json:"schema_version"`
+	Status        string `json:"status"`
+	ExitCode      int    `json:"exit_code"`
+	Error         string `json:"error,omitempty"`
+	StopReason    string `json:"stop_reason,omitempty"`
+
+	BaseURL   string    `json:"base_url,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	// Duration is the time between StartTime and EndTime in seconds.
+	Duration float64 `json:"duration_seconds"`
+
+	Stats     ManifestStats `json:"stats"`
+	Artifacts []Artifact    `json:"artifacts"`
+}
+
+// ManifestStats are the counters of the crawl, as in CrawlResult.
+type ManifestStats struct {
+	TotalPages     int     `json:"total_pages"`
+	DiscoveredURLs int     `json:"discovered_urls"`
+	FetchedURLs    int     `json:"fetched_urls"`
+	Errors         int     `json:"errors"`
+	BytesFetched   int64   `json:"bytes_fetched"`
+	Coverage       float64 `json:"coverage"`
+	BrokenAssets   int     `json:"broken_assets,omitempty"`
+	Fingerprint    string  `json:"fingerprint,omitempty"`
+}
+
+// NewManifest describes a crawl that produced result and artifacts. result
+// is nil and crawlErr set when the crawl failed; exitCode is the exit
+// status of the process.
+func NewManifest(result *CrawlResult, artifacts []Artifact, crawlErr error, exitCode int) *Manifest {
+	m := &Manifest{
+		SchemaVersion: ManifestSchemaVersion,
+		Status:        ManifestCompleted,
+		ExitCode:      exitCode,
+		Artifacts:     artifacts,
+	}
+	if m.Artifacts == nil {
+		m.Artifacts = []Artifact{}
+	}
+	if crawlErr != nil {
+		m.Status, m.Error = ManifestFailed, crawlErr.Error()
+	}
+	if result == nil {
+		return m
+	}
+	if result.StopReason != "" && crawlErr == nil {
+		m.Status = ManifestStopped
+	}
+	m.StopReason = result.StopReason
+	m.BaseURL = result.BaseURL
+	m.StartTime, m.EndTime = result.StartTime, result.EndTime
+	if !m.EndTime.IsZero() {
+		m.Duration = m.EndTime.Sub(m.StartTime).Seconds()
+	}
+	m.Stats = ManifestStats{
+		TotalPages:     result.TotalPages,
+		DiscoveredURLs: result.DiscoveredURLs,
+		FetchedURLs:    result.FetchedURLs,
+		Errors:         len(result.Errors),
+		BytesFetched:   result.BytesFetched,
+		Coverage:       result.Coverage,
+	}
+	if result.Fingerprint != nil {
+		m.Stats.Fingerprint = result.Fingerprint.Hash
+	}
+	if result.AssetCheck != nil {
+		m.Stats.BrokenAssets = len(result.AssetCheck.Broken)
+	}
+	return m
+}
+
+// WriteManifest writes m to path as indented JSON. The file is written
+// under a temporary name and renamed, so a reader never sees a partial
+// manifest.
+func WriteManifest(path string, m *Manifest) error {
+	dir := filepath.Dir(path)
+	if err := makeParentDirs(dir); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("error creating manifest: %v", err)
+	}
+	defer os.Remove(file.Name())
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(m); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing manifest: %v", err)
+	}
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing manifest: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing manifest: %v", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("error writing manifest: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArtifactRegistry(t *testing.T) {
+	dir := t.TempDir()
+	results := filepath.Join(dir, "results.json")
+	if err := os.WriteFile(results, []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	recordings := filepath.Join(dir, "recordings")
+	for path, content := range map[string]string{"a": "12345", "sub/b": "123", "sub/deeper/c": ""} {
+		path = filepath.Join(recordings, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var r artifactRegistry
+	if err := r.addFile(ArtifactResults, results, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.addDir(ArtifactRecordings, recordings); err != nil {
+		t.Fatal(err)
+	}
+	// A directory the crawl never created, such as recordings of a crawl
+	// that fetched nothing, is empty.
+	if err := r.addDir(ArtifactRecordings, filepath.Join(dir, "never")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.addFile(ArtifactEdges, filepath.Join(dir, "missing.csv"), "csv"); err == nil || !strings.Contains(err.Error(), "error reading edges file") {
+		t.Errorf("adding a missing file: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte("hello\n"))
+	want := []Artifact{
+		{Kind: ArtifactResults, Path: results, Format: FormatJSON, Bytes: 6, SHA256: hex.EncodeToString(sum[:])},
+		{Kind: ArtifactRecordings, Path: recordings, Bytes: 8, Files: 3},
+		{Kind: ArtifactRecordings, Path: filepath.Join(dir, "never")},
+	}
+	if !slices.Equal(r.list, want) {
+		t.Errorf("artifacts %+v, want %+v", r.list, want)
+	}
+
+	r.setHost(results, "blog.example.com")
+	r.setHost(filepath.Join(dir, "other.json"), "docs.example.com")
+	if r.list[0].Host != "blog.example.com" || r.list[1].Host != "" || r.list[2].Host != "" {
+		t.Errorf("hosts after setHost: %+v", r.list)
+	}
+}
+
+func TestNewManifest(t *testing.T) {
+	start := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	result := &CrawlResult{
+		BaseURL: "https://example.com", StartTime: start, EndTime: start.Add(90 * time.Second),
+		TotalPages: 7, DiscoveredURLs: 12, FetchedURLs: 9, BytesFetched: 4096, Coverage: 0.75,
+		Errors:      []CrawlError{{URL: "https://example.com/a"}, {URL: "https://example.com/b"}},
+		Fingerprint: &Fingerprint{Hash: "abc"},
+		AssetCheck:  &AssetCheckResult{Broken: []BrokenAsset{{URL: "https://example.com/x.png"}}},
+	}
+	stopped := *result
+	stopped.StopReason = "max pages 9 reached"
+
+	tests := []struct {
+		name     string
+		result   *CrawlResult
+		crawlErr error
+		status   string
+	}{
+		{"completed", result, nil, ManifestCompleted},
+		{"stopped", &stopped, nil, ManifestStopped},
+		{"failed before crawling", nil, errors.New("invalid base URL"), ManifestFailed},
+		{"failed saving", &stopped, errors.New("disk full"), ManifestFailed},
+	}
+	for _, tt := range tests {
+		m := NewManifest(tt.result, nil, tt.crawlErr, 3)
+		if m.Status != tt.status || m.SchemaVersion != ManifestSchemaVersion || m.ExitCode != 3 {
+			t.Errorf("%s: status %q, schema %d, exit code %d; want %q", tt.name, m.Status, m.SchemaVersion, m.ExitCode, tt.status)
+		}
+		if m.Artifacts == nil {
+			t.Errorf("%s: nil artifacts, want an empty list", tt.name)
+		}
+		if (tt.crawlErr != nil) != (m.Error != "") {
+			t.Errorf("%s: error %q for %v", tt.name, m.Error, tt.crawlErr)
+		}
+		if tt.result == nil {
+			if m.BaseURL != "" || m.Stats != (ManifestStats{}) {
+				t.Errorf("%s: %+v without results", tt.name, m)
+			}
+			continue
+		}
+		wantStats := ManifestStats{TotalPages: 7, DiscoveredURLs: 12, FetchedURLs: 9, Errors: 2, BytesFetched: 4096, Coverage: 0.75, BrokenAssets: 1, Fingerprint: "abc"}
+		if m.Stats != wantStats || m.Duration != 90 || m.BaseURL != result.BaseURL || m.StopReason != tt.result.StopReason {
+			t.Errorf("%s: %+v, want stats %+v over 90 seconds", tt.name, m, wantStats)
+		}
+	}
+
+	artifacts := []Artifact{{Kind: ArtifactResults, Path: "results.json"}}
+	if m := NewManifest(result, artifacts, nil, 0); !slices.Equal(m.Artifacts, artifacts) {
+		t.Errorf("artifacts %+v, want %+v", m.Artifacts, artifacts)
+	}
+}
+
+// TestWriteManifest checks that the manifest is written in full under its
+// own name, replacing an older one, without leaving a temporary file.
+func TestWriteManifest(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out", "run")
+	path := filepath.Join(dir, "manifest.json")
+	for _, status := range []string{ManifestFailed, ManifestCompleted} {
+		m := NewManifest(&CrawlResult{BaseURL: "https://example.com", TotalPages: 3}, nil, nil, 0)
+		m.Status = status
+		if err := WriteManifest(path, m); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var read Manifest
+		if err := json.Unmarshal(data, &read); err != nil {
+			t.Fatalf("manifest %s: %v", data, err)
+		}
+		if read.Status != status || read.Stats.TotalPages != 3 || read.BaseURL != "https://example.com" {
+			t.Errorf("read back %+v, want the %s manifest", read, status)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != "manifest.json" {
+			t.Errorf("directory holds %v, want only manifest.json", entries)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o644 {
+			t.Errorf("manifest mode %v, %v; want 0644", info.Mode(), err)
+		}
+	}
+
+	// A failed write leaves neither a manifest nor a temporary file.
+	blocked := filepath.Join(t.TempDir(), "manifest.json")
+	if err := os.Mkdir(blocked, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteManifest(blocked, NewManifest(nil, nil, nil, 0)); err == nil {
+		t.Error("writing over a directory gave no error")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(blocked)); len(entries) != 1 {
+		t.Errorf("a failed write left %v", entries)
+	}
+}
+
+// TestCrawlArtifacts checks that a crawl registers the files it wrote, with
+// the checksum of what is on disk.
+func TestCrawlArtifacts(t *testing.T) {
+	site := budgetSite(t, 3)
+	dir := t.TempDir()
+	results, edges := filepath.Join(dir, "results.json"), filepath.Join(dir, "edges.csv")
+	c, err := NewCrawler(site.URL, 1, 1000, WithLogOutput(&strings.Builder{}), WithOutputPath(results), WithEdgeOutput(edges))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	artifacts := c.Artifacts()
+	var kinds []string
+	for _, artifact := range artifacts {
+		kinds = append(kinds, artifact.Kind)
+		data, err := os.ReadFile(artifact.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(data)
+		if artifact.SHA256 != hex.EncodeToString(sum[:]) || artifact.Bytes != int64(len(data)) {
+			t.Errorf("%s: %+v, the file has %d bytes", artifact.Kind, artifact, len(data))
+		}
+	}
+	slices.Sort(kinds)
+	if want := []string{ArtifactEdges, ArtifactResults}; !slices.Equal(kinds, want) {
+		t.Errorf("artifacts %+v, want %q", artifacts, want)
+	}
+}
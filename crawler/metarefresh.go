@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// HopMetaRefresh is the RedirectHop Type of a page whose meta refresh was
+// followed.
+const HopMetaRefresh = "meta-refresh"
+
+// WithMetaRefresh follows the meta refresh of pages, as in <meta
+// http-equiv="refresh" content="0; url=/new">, like a browser does: the
+// page is stored with the content of the refresh target, and the page with
+// the refresh is a hop of its RedirectChain. Refreshes are followed
+// whatever their delay, but only to same-domain URLs the filters and the
+// list of the crawl let through. HTTP redirects and meta refreshes share
+// one limit of 10 hops per page, and a chain coming back to one of its own
+// URLs fails with ErrRedirectLoop.
+func WithMetaRefresh(follow bool) Option {
+	return func(c *Crawler) {
+		c.metaRefresh = follow
+	}
+}
+
+// metaRefreshTarget returns the URL the first meta refresh of doc leads
+// to, resolved against pageURL, or nil if it has none or reloads the page
+// itself.
+func metaRefreshTarget(doc *goquery.Document, pageURL *url.URL) *url.URL {
+	var target *url.URL
+	doc.Find("meta[http-equiv]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if equiv, _ := s.Attr("http-equiv"); !strings.EqualFold(strings.TrimSpace(equiv), "refresh") {
+			return true
+		}
+		content, _ := s.Attr("content")
+		raw := refreshURL(content)
+		if raw == "" {
+			return false
+		}
+		if u, err := pageURL.Parse(raw); err == nil && NormalizeURL(u) != NormalizeURL(pageURL) {
+			target = u
+		}
+		return false
+	})
+	return target
+}
+
+// refreshURL extracts the URL of a refresh content value such as
+// "5; url='/next'", returning "" if there is none.
+func refreshURL(content string) string {
+	i := strings.IndexAny(content, ";,")
+	if i < 0 {
+		return ""
+	}
+	value := strings.TrimSpace(content[i+1:])
+	if len(value) >= 3 && strings.EqualFold(value[:3], "url") {
+		if rest := strings.TrimSpace(value[3:]); strings.HasPrefix(rest, "=") {
+			value = strings.TrimSpace(rest[1:])
+		}
+	}
+	if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			value = value[1 : end+1]
+		} else {
+			value = value[1:]
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+// followsMetaRefresh reports whether the crawl follows a meta refresh of
+// page, crawled at depth, to target.
+func (c *Crawler) followsMetaRefresh(target *url.URL, page string, depth int) bool {
+	if target.Scheme != "http" && target.Scheme != "https" || !c.isSameDomain(target) {
+		return false
+	}
+	return c.redirectRefusal(target, page, depth) == ""
+}
@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// MobileSignals are cheap indicators of whether a page is mobile-ready.
+type MobileSignals struct {
+	// Viewport is the content of the viewport meta tag; HasViewport is
+	// false when the page has none.
+	HasViewport bool   `json:"has_viewport"`
+	Viewport    string `json:"viewport,omitempty"`
+	// FixedWidth is set when the viewport declares a pixel width instead
+	// of device-width.
+	FixedWidth bool `json:"fixed_width,omitempty"`
+	// UserScalableNo is set when the viewport disables pinch zoom.
+	UserScalableNo bool `json:"user_scalable_no,omitempty"`
+	// AMPURL is the page's rel="amphtml" alternate, if any.
+	AMPURL string `json:"amp_url,omitempty"`
+}
+
+// extractMobileSignals reads the viewport meta tag and AMP alternate of doc.
+func extractMobileSignals(doc *goquery.Document, pageURL *url.URL) *MobileSignals {
+	signals := &MobileSignals{}
+	doc.Find("meta[name]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if !strings.EqualFold(strings.TrimSpace(s.AttrOr("name", "")), "viewport") {
+			return true
+		}
+		signals.HasViewport = true
+		signals.Viewport = strings.TrimSpace(s.AttrOr("content", ""))
+		return false
+	})
+
+	for key, value := range parseViewport(signals.Viewport) {
+		switch key {
+		case "width":
+			if _, err := strconv.Atoi(strings.TrimSuffix(value, "px")); err == nil {
+				signals.FixedWidth = true
+			}
+		case "user-scalable":
+			if value == "no" || value == "0" {
+				signals.UserScalableNo = true
+			}
+		}
+	}
+
+	if href, ok := doc.Find(`link[rel~="amphtml"]`).First().Attr("href"); ok {
+		if u, err := pageURL.Parse(strings.TrimSpace(href)); err == nil {
+			signals.AMPURL = NormalizeURL(u)
+		}
+	}
+	return signals
+}
+
+// parseViewport splits a viewport content value such as
+// "width=device-width, initial-scale=1" into lowercased keys and values.
+// Browsers accept both commas and semicolons as separators.
+func parseViewport(content string) map[string]string {
+	values := make(map[string]string)
+	for _, part := range strings.FieldsFunc(content, func(r rune) bool { return r == ',' || r == ';' }) {
+		key, value, _ := strings.Cut(part, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key != "" {
+			values[key] = strings.ToLower(strings.TrimSpace(value))
+		}
+	}
+	return values
+}
+
+// MobileIssues lists the stored pages failing each mobile-readiness check.
+// Pages saved without mobile signals are not counted.
+type MobileIssues struct {
+	Checked         int
+	MissingViewport []string
+	FixedWidth      []string
+	UserScalableNo  []string
+	AMP             int
+}
+
+func FindMobileIssues(pages []PageData) MobileIssues {
+	var issues MobileIssues
+	for _, page := range pages {
+		m := page.Mobile
+		if page.Alias || m == nil {
+			continue
+		}
+		issues.Checked++
+		if !m.HasViewport {
+			issues.MissingViewport = append(issues.MissingViewport, page.URL)
+		}
+		if m.FixedWidth {
+			issues.FixedWidth = append(issues.FixedWidth, page.URL)
+		}
+		if m.UserScalableNo {
+			issues.UserScalableNo = append(issues.UserScalableNo, page.URL)
+		}
+		if m.AMPURL != "" {
+			issues.AMP++
+		}
+	}
+	return issues
+}
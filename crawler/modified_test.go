@@ -0,0 +1,113 @@
+package crawler
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseModifiedSince(t *testing.T) {
+	for value, want := range map[string]time.Time{
+		"2026-10-01":                time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		"2026-10-01T12:30:00Z":      time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC),
+		"2026-10-01T12:30:00+02:00": time.Date(2026, 10, 1, 10, 30, 0, 0, time.UTC),
+	} {
+		if got, err := ParseModifiedSince(value); err != nil || !got.Equal(want) {
+			t.Errorf("ParseModifiedSince(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "yesterday", "2026-13-01", "01.10.2026", "2026-10-01 12:30"} {
+		if got, err := ParseModifiedSince(value); err == nil {
+			t.Errorf("ParseModifiedSince(%q) = %v, want an error", value, got)
+		}
+	}
+}
+
+func TestSummarizeChanges(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	before, after := since.Add(-time.Hour).Format(http.TimeFormat), since.Add(time.Hour).Format(http.TimeFormat)
+	pages := []PageData{
+		{URL: "http://example.com/", Change: ChangeModified, LastModified: after},
+		{URL: "http://example.com/a", Change: ChangeUnchanged},
+		{URL: "http://example.com/b", Change: ChangeUnchanged},
+		{URL: "http://example.com/c", Change: ChangeModified},
+		{URL: "http://example.com/d", Change: ChangeModified, LastModified: before},
+		{URL: "http://example.com/e", Change: ChangeModified, LastModified: since.Format(http.TimeFormat)},
+		{URL: "http://example.com/alias", Change: ChangeModified, Alias: true},
+	}
+	summary := SummarizeChanges(pages, since)
+	if summary.Modified != 4 || summary.Unchanged != 2 || summary.NoLastModified != 1 || summary.IgnoredConditional != 2 {
+		t.Errorf("summary %+v, want 4 modified, 2 unchanged, 1 without Last-Modified and 2 ignoring the condition", summary)
+	}
+	if want := []string{"http://example.com/d", "http://example.com/e"}; !slices.Equal(summary.IgnoredExamples, want) {
+		t.Errorf("ignored examples %q, want %q", summary.IgnoredExamples, want)
+	}
+}
+
+// TestCrawlModifiedSince crawls a site whose old pages answer conditional
+// requests with 304 Not Modified and whose /stubborn page ignores them.
+func TestCrawlModifiedSince(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	var lock sync.Mutex
+	var sent []string
+	conditional := func(modified time.Time, body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			sent = append(sent, r.Header.Get("If-Modified-Since"))
+			lock.Unlock()
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(ims) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			htmlPage(body)(w, r)
+		}
+	}
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/":         conditional(since.Add(time.Hour), `<a href="/old">old</a> <a href="/new">new</a> <a href="/stubborn">stubborn</a>`),
+		"/old":      conditional(since.Add(-time.Hour), `<a href="/behind-old">behind</a>`),
+		"/new":      conditional(since.Add(2*time.Hour), "new"),
+		"/stubborn": htmlPage("stubborn"),
+		"/behind-old": func(w http.ResponseWriter, r *http.Request) {
+			t.Error("a page only linked from an unchanged page was fetched")
+		},
+	})
+	result := crawlTestSite(t, site.URL, 2, WithModifiedSince(since.Add(30*time.Minute)))
+
+	want := since.Add(30 * time.Minute).Format(http.TimeFormat)
+	if len(sent) != 3 {
+		t.Errorf("%d conditional pages requested, want 3", len(sent))
+	}
+	for _, header := range sent {
+		if header != want {
+			t.Errorf("If-Modified-Since %q, want %q", header, want)
+		}
+	}
+	for path, change := range map[string]string{"/": ChangeModified, "/old": ChangeUnchanged, "/new": ChangeModified, "/stubborn": ChangeModified} {
+		page := findPage(result, site.URL, path)
+		if page == nil || page.Change != change {
+			t.Errorf("%s: %+v, want it stored as %s", path, page, change)
+			continue
+		}
+		if change == ChangeUnchanged && (page.StatusCode != http.StatusNotModified || len(page.Links) != 0) {
+			t.Errorf("%s: status %d and %d links, want a 304 record without links", path, page.StatusCode, len(page.Links))
+		}
+	}
+	summary := result.ModifiedSince
+	if summary == nil || summary.Modified != 3 || summary.Unchanged != 1 || summary.NoLastModified != 1 || summary.IgnoredConditional != 0 {
+		t.Errorf("summary %+v, want 3 modified, 1 unchanged and /stubborn without Last-Modified", summary)
+	}
+
+	// Without the option no page carries a change.
+	result = crawlTestSite(t, site.URL, 1)
+	if result.ModifiedSince != nil {
+		t.Errorf("summary %+v without WithModifiedSince", result.ModifiedSince)
+	}
+	for _, page := range result.Pages {
+		if page.Change != "" {
+			t.Errorf("%s: change %q without WithModifiedSince", page.URL, page.Change)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package crawler
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const upperHex = "0123456789ABCDEF"
+
+// NormalizeURL returns the form of u used for deduplication and output,
+// following the syntax-based normalization of RFC 3986 section 6.2.2:
+//
+//   - scheme and host are lowercased and the default port is dropped
+//   - an internationalized host name is written in its ASCII (punycode)
+//     form, so "bücher.example" is "xn--bcher-kva.example"
+//   - the trailing dot of a fully qualified host is dropped, so
+//     "example.com." is "example.com"
+//   - percent-encoded unreserved characters (ALPHA, DIGIT, "-", ".", "_",
+//     "~") are decoded, remaining escapes are uppercased
+//   - encoded reserved characters stay encoded, so "/a%2Fb" and "/a/b"
+//     remain distinct
+//   - characters that are not allowed unencoded, including non-ASCII
+//     bytes, are percent-encoded as UTF-8
+//   - dot segments are removed (section 5.2.4)
+//   - an empty path becomes "/" and the fragment is removed, as it is
+//     never sent to the server
+//
+// Path and query are treated the same way.
+func NormalizeURL(u *url.URL) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(u.Scheme))
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(u.User.String())
+		b.WriteByte('@')
+	}
+	b.WriteString(normalizeHost(u.Scheme, u.Host))
+
+	path := removeDotSegments(normalizeEscapes(u.EscapedPath(), false))
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(path)
+
+	if u.RawQuery != "" {
+		b.WriteByte('?')
+		b.WriteString(normalizeEscapes(u.RawQuery, true))
+	}
+	return b.String()
+}
+
+// normalizeHost lowercases host, writes an internationalized name in its
+// ASCII form, drops the trailing dot of the name and removes the port when
+// it is the default for scheme.
+func normalizeHost(scheme, host string) string {
+	host = asciiHost(trimHostDot(strings.ToLower(host)))
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		if strings.Contains(hostname, ":") {
+			return "[" + hostname + "]"
+		}
+		return hostname
+	}
+	return host
+}
+
+// asciiHost returns host, which may have a port, with a host name that is
+// not ASCII converted to punycode. A name that is not a valid IDN is kept.
+func asciiHost(host string) string {
+	ascii := true
+	for i := 0; i < len(host); i++ {
+		if host[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return host
+	}
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname, port = host, ""
+	}
+	converted, err := idna.Lookup.ToASCII(hostname)
+	if err != nil {
+		return host
+	}
+	if port != "" {
+		return net.JoinHostPort(converted, port)
+	}
+	return converted
+}
+
+// hasHostDot reports whether the host name of host, which may have a port,
+// ends with the dot of a fully qualified name.
+func hasHostDot(host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return strings.HasSuffix(host, ".")
+}
+
+// trimHostDot drops the trailing dot of the host name of host, keeping the
+// port. The dotted and plain names are the same host, but TLS certificates
+// and cookies are only issued for the plain one.
+func trimHostDot(host string) string {
+	if !hasHostDot(host) {
+		return host
+	}
+	if hostname, port, err := net.SplitHostPort(host); err == nil {
+		return net.JoinHostPort(strings.TrimSuffix(hostname, "."), port)
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// removeDotSegments resolves "." and ".." segments in an absolute path.
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+// normalizeEscapes rewrites the percent-encoding of an escaped path or
+// query component.
+func normalizeEscapes(s string, query bool) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				writeEscape(&b, decoded)
+			}
+			i += 2
+			continue
+		}
+		if isUnreserved(c) || isSubDelim(c) || c == ':' || c == '@' || c == '/' || (query && c == '?') {
+			b.WriteByte(c)
+			continue
+		}
+		writeEscape(&b, c)
+	}
+	return b.String()
+}
+
+func writeEscape(b *strings.Builder, c byte) {
+	b.WriteByte('%')
+	b.WriteByte(upperHex[c>>4])
+	b.WriteByte(upperHex[c&15])
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isSubDelim(c byte) bool {
+	return strings.IndexByte("!$&'()*+,;=", c) >= 0
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// WithLowercasePaths lowercases the path of every URL the crawl finds, for
+// origins known to serve paths case-insensitively, such as IIS, where
+// /About and /about are the same page. Percent-encoded bytes and the query
+// keep their case. Paths are case-sensitive everywhere else, so only use it
+// when the site is known to ignore case.
+func WithLowercasePaths() Option {
+	return func(c *Crawler) {
+		c.lowercasePaths = true
+	}
+}
+
+// normalizeLink returns the NormalizeURL form of u, with its path
+// lowercased under WithLowercasePaths.
+func (c *Crawler) normalizeLink(u *url.URL) string {
+	normalized := NormalizeURL(u)
+	if c.lowercasePaths {
+		return lowercasePath(normalized)
+	}
+	return normalized
+}
+
+// lowercasePath lowercases the ASCII letters of the path of normalized, a
+// URL in NormalizeURL form, leaving its escapes and query alone.
+func lowercasePath(normalized string) string {
+	start := strings.Index(normalized, "://")
+	if start < 0 {
+		return normalized
+	}
+	start += 3
+	slash := strings.IndexByte(normalized[start:], '/')
+	if slash < 0 {
+		return normalized
+	}
+	start += slash
+	end := len(normalized)
+	if q := strings.IndexByte(normalized[start:], '?'); q >= 0 {
+		end = start + q
+	}
+	b := []byte(normalized)
+	for i := start; i < end; i++ {
+		switch {
+		case b[i] == '%':
+			i += 2
+		case 'A' <= b[i] && b[i] <= 'Z':
+			b[i] += 'a' - 'A'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,187 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// outputPlaceholders are the placeholders of WithOutputPath.
+var outputPlaceholders = []string{"host", "date", "time", "format"}
+
+// WithOutputPath makes Start save the results, in the format chosen with
+// WithOutputFormat, to path, or to crawl_results.json (with the extension of
+// the format) when path is empty. Without it Start writes no results file.
+// path may contain placeholders, expanded when the results are saved:
+//
+//	{host}    the host of the base URL, with its port
+//	{date}    the date the crawl started, as 2006-01-02
+//	{time}    the time the crawl started, as 150405
+//	{format}  the output format
+//
+// Expanded values are made safe for a file name on the running OS, so a
+// port becomes example.com_8080 on Windows. A path that ends with a
+// separator or names a directory gets crawl_results.<format> appended.
+// Missing parent directories are created.
+func WithOutputPath(path string) Option {
+	return func(c *Crawler) {
+		c.outputPath = path
+		c.save = true
+	}
+}
+
+// ValidateOutputPath reports an unknown or unclosed placeholder in an
+// output path.
+func ValidateOutputPath(path string) error {
+	for rest := path; ; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			return nil
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return fmt.Errorf("unclosed placeholder in %q", path)
+		}
+		name := rest[open+1 : open+end]
+		if !slices.Contains(outputPlaceholders, name) {
+			return fmt.Errorf("unknown placeholder {%s} in %q, use one of {%s}", name, path, strings.Join(outputPlaceholders, "}, {"))
+		}
+		rest = rest[open+end+1:]
+	}
+}
+
+// expandOutputPath replaces the placeholders of path, sanitizing every
+// value for goos.
+func expandOutputPath(path, host string, start time.Time, format, goos string) string {
+	values := map[string]string{
+		"host":   host,
+		"date":   start.Format(time.DateOnly),
+		"time":   start.Format("150405"),
+		"format": format,
+	}
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(path, '{')
+		end := strings.IndexByte(path[max(open, 0):], '}')
+		if open < 0 || end < 0 {
+			b.WriteString(path)
+			return b.String()
+		}
+		b.WriteString(path[:open])
+		b.WriteString(sanitizePathComponent(values[path[open+1:open+end]], goos))
+		path = path[open+end+1:]
+	}
+}
+
+// windowsReserved are the device names Windows refuses as file names, with
+// or without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizePathComponent makes s usable as one component of a file path on
+// goos by replacing the characters it forbids with underscores. Path
+// separators are always replaced, so a value never adds directories.
+func sanitizePathComponent(s, goos string) string {
+	invalid := "/\x00"
+	if goos == "windows" {
+		invalid = `<>:"/\|?*` + "\x00"
+	}
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(invalid, r) || goos == "windows" && r < 0x20 {
+			return '_'
+		}
+		return r
+	}, s)
+	if goos == "windows" {
+		// Windows drops trailing dots and spaces from names.
+		s = strings.TrimRight(s, ". ")
+		if base, _, _ := strings.Cut(s, "."); windowsReserved[strings.ToUpper(base)] {
+			s = "_" + s
+		}
+	}
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
+
+// outputFilename returns the file results in format are saved to.
+func (c *Crawler) outputFilename(format string) string {
+	return c.hostOutputFilename(c.baseURL.Host, format)
+}
+
+// hostOutputFilename returns the file the results of host are saved to,
+// host being the base URL's except in a crawl split by host. There the
+// default name includes the host too.
+func (c *Crawler) hostOutputFilename(host, format string) string {
+	defaultName := resultsBaseName + "." + format
+	if c.splitByHost {
+		defaultName = resultsBaseName + "_" + sanitizePathComponent(host, runtime.GOOS) + "." + format
+	}
+	if c.outputPath == "" {
+		return defaultName
+	}
+	path := expandOutputPath(c.outputPath, host, c.outputTime, format, runtime.GOOS)
+	if strings.HasSuffix(path, "/") || strings.HasSuffix(path, string(os.PathSeparator)) {
+		return filepath.Join(path, defaultName)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, defaultName)
+	}
+	// An oversized crawl is saved as CSV instead of xlsx.
+	if format == FormatCSV && strings.EqualFold(filepath.Ext(path), "."+FormatXLSX) {
+		path = strings.TrimSuffix(path, filepath.Ext(path)) + "." + FormatCSV
+	}
+	return path
+}
+
+// createOutputFile creates filename, and its parent directories when they
+// are missing.
+func createOutputFile(filename string) (*os.File, error) {
+	if err := makeParentDirs(filepath.Dir(filename)); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating file: %v", err)
+	}
+	return file, nil
+}
+
+// makeParentDirs creates dir like os.MkdirAll, but the error names the
+// component that could not be created or is not a directory.
+func makeParentDirs(dir string) error {
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return nil
+	}
+	components := []string{dir}
+	for d := dir; filepath.Dir(d) != d; {
+		d = filepath.Dir(d)
+		components = append(components, d)
+	}
+	for i := len(components) - 1; i >= 0; i-- {
+		component := components[i]
+		info, err := os.Stat(component)
+		switch {
+		case err == nil && info.IsDir():
+			continue
+		case err == nil:
+			return fmt.Errorf("cannot create directory %s: %s is not a directory", dir, component)
+		case !errors.Is(err, fs.ErrNotExist):
+			return fmt.Errorf("cannot create directory %s: %v", dir, err)
+		}
+		if err := os.Mkdir(component, 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("cannot create directory %s: %v", component, err)
+		}
+	}
+	return nil
+}
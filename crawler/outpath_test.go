@@ -0,0 +1,180 @@
+package crawler
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSanitizePathComponent(t *testing.T) {
+	tests := []struct {
+		in, linux, windows string
+	}{
+		{"example.com", "example.com", "example.com"},
+		{"example.com:8443", "example.com:8443", "example.com_8443"},
+		{"[::1]:8080", "[::1]:8080", "[__1]_8080"},
+		{"a/b", "a_b", "a_b"},
+		{`a\b`, `a\b`, "a_b"},
+		{`<>"|?*`, `<>"|?*`, "______"},
+		{"tab\there", "tab\there", "tab_here"},
+		{"nul\x00", "nul_", "nul_"},
+		{"name. ", "name. ", "name"},
+		{"CON", "CON", "_CON"},
+		{"con.json", "con.json", "_con.json"},
+		{"lpt9", "lpt9", "_lpt9"},
+		{"CONSOLE", "CONSOLE", "CONSOLE"},
+		{"", "_", "_"},
+		{".", "_", "_"},
+		{"..", "_", "_"},
+		{"...", "...", "_"},
+		{"значение", "значение", "значение"},
+	}
+	for _, tt := range tests {
+		if got := sanitizePathComponent(tt.in, "linux"); got != tt.linux {
+			t.Errorf("sanitizePathComponent(%q, linux) = %q, want %q", tt.in, got, tt.linux)
+		}
+		if got := sanitizePathComponent(tt.in, "darwin"); got != tt.linux {
+			t.Errorf("sanitizePathComponent(%q, darwin) = %q, want %q", tt.in, got, tt.linux)
+		}
+		if got := sanitizePathComponent(tt.in, "windows"); got != tt.windows {
+			t.Errorf("sanitizePathComponent(%q, windows) = %q, want %q", tt.in, got, tt.windows)
+		}
+	}
+}
+
+func TestExpandOutputPath(t *testing.T) {
+	start := time.Date(2024, 5, 3, 9, 4, 5, 0, time.UTC)
+	tests := []struct {
+		path, host, goos, want string
+	}{
+		{"reports/{host}/{date}.{format}", "example.com:8443", "linux", "reports/example.com:8443/2024-05-03.json"},
+		{"reports/{host}/{date}.{format}", "example.com:8443", "windows", "reports/example.com_8443/2024-05-03.json"},
+		{"{host}-{date}-{time}.{format}", "example.com", "linux", "example.com-2024-05-03-090405.json"},
+		{"{host}{host}", "a", "linux", "aa"},
+		{"plain.json", "example.com", "linux", "plain.json"},
+		// A host never adds directories or climbs out of one.
+		{"out/{host}.json", "../etc", "linux", "out/.._etc.json"},
+		{"out/{host}.json", "..", "linux", "out/_.json"},
+		{"out/{host}.json", "con", "windows", "out/_con.json"},
+		// Text outside placeholders is kept as written.
+		{"a:b/{format}", "x", "windows", "a:b/json"},
+		{"unclosed{", "x", "linux", "unclosed{"},
+	}
+	for _, tt := range tests {
+		if got := expandOutputPath(tt.path, tt.host, start, "json", tt.goos); got != tt.want {
+			t.Errorf("expandOutputPath(%q, %q, %s) = %q, want %q", tt.path, tt.host, tt.goos, got, tt.want)
+		}
+	}
+}
+
+func TestValidateOutputPath(t *testing.T) {
+	for _, path := range []string{"", "results.json", "reports/{host}/{date}_{time}.{format}", "{format}"} {
+		if err := ValidateOutputPath(path); err != nil {
+			t.Errorf("ValidateOutputPath(%q): %v", path, err)
+		}
+	}
+	for path, want := range map[string]string{
+		"reports/{hostname}.json": "unknown placeholder {hostname}",
+		"{Host}.json":             "unknown placeholder {Host}",
+		"{}.json":                 "unknown placeholder {}",
+		"reports/{host.json":      "unclosed placeholder",
+		"{date}/{":                "unclosed placeholder",
+	} {
+		if err := ValidateOutputPath(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ValidateOutputPath(%q) = %v, want %q", path, err, want)
+		}
+	}
+}
+
+func TestHostOutputFilename(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 5, 3, 9, 4, 5, 0, time.UTC)
+	tests := []struct {
+		path        string
+		splitByHost bool
+		format      string
+		want        string
+	}{
+		{"", false, FormatJSON, "crawl_results.json"},
+		{"", true, FormatCSV, "crawl_results_example.com.csv"},
+		{"out/", false, FormatJSON, filepath.Join("out", "crawl_results.json")},
+		{dir, false, FormatParquet, filepath.Join(dir, "crawl_results.parquet")},
+		{dir, true, FormatJSON, filepath.Join(dir, "crawl_results_example.com.json")},
+		{"{host}/{date}.{format}", false, FormatXLSX, "example.com/2024-05-03.xlsx"},
+		// An xlsx crawl too large for a sheet falls back to CSV.
+		{"report.xlsx", false, FormatCSV, "report.csv"},
+		{"report.json", false, FormatCSV, "report.json"},
+	}
+	for _, tt := range tests {
+		c := &Crawler{outputPath: tt.path, outputTime: start, splitByHost: tt.splitByHost}
+		if got := c.hostOutputFilename("example.com", tt.format); got != tt.want {
+			t.Errorf("path %q (split %t, %s): %q, want %q", tt.path, tt.splitByHost, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestCreateOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "reports", "2024", "05", "example.json")
+	file, err := createOutputFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	if _, err := os.Stat(filename); err != nil {
+		t.Error(err)
+	}
+
+	// A file in the way is named in the error.
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = createOutputFile(filepath.Join(blocker, "sub", "results.json"))
+	if err == nil || !strings.Contains(err.Error(), blocker+" is not a directory") {
+		t.Errorf("error %v, want it to name %s", err, blocker)
+	}
+	_, err = createOutputFile(blocker + string(filepath.Separator))
+	if err == nil {
+		t.Error("creating a file named like a directory gave no error")
+	}
+}
+
+func TestCreateOutputFileReadOnly(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("permissions do not apply to root")
+	}
+	dir := filepath.Join(t.TempDir(), "read-only")
+	if err := os.Mkdir(dir, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	_, err := createOutputFile(filepath.Join(dir, "reports", "results.json"))
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "reports")) {
+		t.Errorf("error %v, want it to name %s", err, filepath.Join(dir, "reports"))
+	}
+}
+
+// TestCrawlOutputPath saves a crawl to a templated path in directories that
+// do not exist yet.
+func TestCrawlOutputPath(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{"/": htmlPage("home")})
+	dir := t.TempDir()
+	result := crawlTestSite(t, site.URL, 0, WithOutputFormat(FormatCSV),
+		WithOutputPath(filepath.Join(dir, "reports", "{host}", "{date}.{format}")))
+	host := sanitizePathComponent(strings.TrimPrefix(site.URL, "http://"), "linux")
+	filename := filepath.Join(dir, "reports", host, result.StartTime.Format(time.DateOnly)+".csv")
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), site.URL+"/") {
+		t.Errorf("%s does not list the page:\n%s", filename, data)
+	}
+
+	if _, err := NewCrawler(site.URL, 0, 1000, WithOutputPath("{site}.json")); err == nil || !strings.Contains(err.Error(), "invalid output path") {
+		t.Errorf("NewCrawler with an unknown placeholder: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxAddedParams is the limit of WithMaxAddedParams in the command.
+const DefaultMaxAddedParams = 5
+
+// EdgeParamAccumulation marks links to a URL that only adds query
+// parameters to one already seen on the same path.
+const EdgeParamAccumulation = "param-accumulation"
+
+// Bounds of the index of WithMaxAddedParams: the paths it remembers, the
+// oldest forgotten first, and the query strings it remembers per path.
+const (
+	paramIndexPaths    = 10000
+	paramIndexPerPath  = 16
+	paramIndexMaxPairs = 64
+)
+
+// WithMaxAddedParams skips links to a URL whose query parameters are those
+// of a URL already seen on the same path plus more than n others, as pages
+// of faceted navigation that append another &filter= to every link
+// generate at every depth, until their URLs are kilobytes long. Parameters
+// compare as name=value pairs, a repeated one counting as many times as it
+// appears; URLs without a query are not compared against. Skipped links are
+// recorded with EdgeParamAccumulation and counted in
+// ParamAccumulationSkips. The URLs seen are remembered per path, a few per
+// path for a bounded number of paths, so the check takes bounded memory.
+// Zero disables it.
+func WithMaxAddedParams(n int) Option {
+	return func(c *Crawler) {
+		c.params.max = n
+	}
+}
+
+// paramIndex remembers the query parameters of recent URLs per path for
+// WithMaxAddedParams.
+type paramIndex struct {
+	max int
+
+	lock sync.Mutex
+	// paths holds the sorted parameters of the URLs seen per path, and
+	// order the paths from the oldest.
+	paths map[string][][]string
+	order []string
+}
+
+// accumulates reports whether target only adds more than the limit of
+// query parameters to a URL seen before on its path. Otherwise it
+// remembers target.
+func (p *paramIndex) accumulates(target string) bool {
+	if p.max <= 0 {
+		return false
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.RawQuery == "" {
+		return false
+	}
+	params := strings.Split(u.RawQuery, "&")
+	slices.Sort(params)
+	u.RawQuery = ""
+	path := u.String()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	seen := p.paths[path]
+	for _, base := range seen {
+		if len(params)-len(base) > p.max && containsParams(params, base) {
+			return true
+		}
+	}
+	if len(params) > paramIndexMaxPairs || slices.ContainsFunc(seen, func(base []string) bool { return slices.Equal(base, params) }) {
+		return false
+	}
+	if p.paths == nil {
+		p.paths = make(map[string][][]string)
+	}
+	if seen == nil {
+		if len(p.order) >= paramIndexPaths {
+			delete(p.paths, p.order[0])
+			p.order = p.order[1:]
+		}
+		p.order = append(p.order, path)
+	}
+	if len(seen) < paramIndexPerPath {
+		p.paths[path] = append(seen, params)
+		return false
+	}
+	// Keeping the shortest query strings keeps the ones longer URLs
+	// accumulate parameters on.
+	longest := 0
+	for i, base := range seen {
+		if len(base) > len(seen[longest]) {
+			longest = i
+		}
+	}
+	if len(params) < len(seen[longest]) {
+		seen[longest] = params
+	}
+	return false
+}
+
+// containsParams reports whether params holds every pair of base as many
+// times, both sorted.
+func containsParams(params, base []string) bool {
+	i := 0
+	for _, param := range base {
+		for i < len(params) && params[i] < param {
+			i++
+		}
+		if i == len(params) || params[i] != param {
+			return false
+		}
+		i++
+	}
+	return true
+}
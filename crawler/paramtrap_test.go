@@ -0,0 +1,162 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParamIndexAccumulates(t *testing.T) {
+	p := &paramIndex{max: 2}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://example.com/list?a=1", false},
+		// Two added parameters are within the limit, three are not, in any
+		// order.
+		{"http://example.com/list?a=1&b=2&c=3", false},
+		{"http://example.com/list?a=1&b=2&c=3&d=4", true},
+		{"http://example.com/list?d=4&c=3&b=2&a=1", true},
+		// A repeated pair counts as many times as it appears.
+		{"http://example.com/list?a=1&a=1&a=1&a=1", true},
+		{"http://example.com/list?a=1&a=1&a=1", false},
+		// Values are compared too.
+		{"http://example.com/list?a=2&b=2&c=3&d=4", false},
+		// Other paths and hosts have URLs of their own.
+		{"http://example.com/other?a=1&b=2&c=3&d=4", false},
+		{"http://other.example.com/list?a=1&b=2&c=3&d=4", false},
+		// A URL without a query is not compared against.
+		{"http://example.com/plain", false},
+		{"http://example.com/plain?a=1&b=2&c=3&d=4", false},
+	}
+	for _, tt := range tests {
+		if got := p.accumulates(tt.url); got != tt.want {
+			t.Errorf("accumulates(%q) = %t, want %t", tt.url, got, tt.want)
+		}
+	}
+	// URLs that were not skipped are remembered in turn.
+	if !p.accumulates("http://example.com/list?a=2&b=2&c=3&d=4&e=5&f=6&g=7") {
+		t.Error("a URL adding three parameters to one remembered is not skipped")
+	}
+
+	disabled := &paramIndex{}
+	if disabled.accumulates("http://example.com/list?a=1") || disabled.accumulates("http://example.com/list?a=1&b=2&c=3&d=4") {
+		t.Error("a disabled index skips URLs")
+	}
+	if disabled.paths != nil {
+		t.Error("a disabled index remembers URLs")
+	}
+}
+
+func TestParamIndexBounds(t *testing.T) {
+	p := &paramIndex{max: 1}
+	for i := range paramIndexPerPath + 10 {
+		p.accumulates(fmt.Sprintf("http://example.com/list?a=%d&b=%d", i, i))
+	}
+	if n := len(p.paths["http://example.com/list"]); n != paramIndexPerPath {
+		t.Fatalf("remembered %d queries of a path, want %d", n, paramIndexPerPath)
+	}
+	// A shorter query takes the place of a longer one.
+	p.accumulates("http://example.com/list?z=1")
+	if !p.accumulates("http://example.com/list?x=1&y=2&z=1") {
+		t.Error("the shorter query was not kept")
+	}
+
+	// Queries with too many pairs are not remembered.
+	long := make([]string, paramIndexMaxPairs+1)
+	for i := range long {
+		long[i] = fmt.Sprintf("p%d=1", i)
+	}
+	p.accumulates("http://example.com/long?" + strings.Join(long, "&"))
+	if p.paths["http://example.com/long"] != nil {
+		t.Error("a query of too many pairs was remembered")
+	}
+
+	// The oldest paths are forgotten first.
+	p = &paramIndex{max: 1}
+	for i := range paramIndexPaths + 5 {
+		p.accumulates(fmt.Sprintf("http://example.com/p%d?a=1", i))
+	}
+	if len(p.paths) != paramIndexPaths || len(p.order) != paramIndexPaths {
+		t.Errorf("remembered %d paths in an order of %d, want %d", len(p.paths), len(p.order), paramIndexPaths)
+	}
+	if p.paths["http://example.com/p0"] != nil || p.paths[fmt.Sprintf("http://example.com/p%d", paramIndexPaths+4)] == nil {
+		t.Error("the oldest path was kept or the newest forgotten")
+	}
+}
+
+func TestContainsParams(t *testing.T) {
+	tests := []struct {
+		params, base []string
+		want         bool
+	}{
+		{[]string{"a=1", "b=2", "c=3"}, []string{"a=1", "c=3"}, true},
+		{[]string{"a=1", "b=2"}, nil, true},
+		{[]string{"a=1", "b=2"}, []string{"a=2"}, false},
+		{[]string{"a=1", "a=1", "b=2"}, []string{"a=1", "a=1"}, true},
+		{[]string{"a=1", "b=2"}, []string{"a=1", "a=1"}, false},
+		{[]string{"a=1"}, []string{"a=1", "b=2"}, false},
+	}
+	for _, tt := range tests {
+		if got := containsParams(tt.params, tt.base); got != tt.want {
+			t.Errorf("containsParams(%q, %q) = %t, want %t", tt.params, tt.base, got, tt.want)
+		}
+	}
+}
+
+// TestCrawlParamAccumulation crawls a filter page whose every link appends
+// another parameter to its own URL.
+func TestCrawlParamAccumulation(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/": htmlPage(`<a href="/filter?f=1">filter</a>`),
+		"/filter": func(w http.ResponseWriter, r *http.Request) {
+			next := fmt.Sprintf("/filter?%s&f=%d", r.URL.RawQuery, strings.Count(r.URL.RawQuery, "&")+2)
+			htmlPage(fmt.Sprintf(`<a href="%s">more</a>`, next))(w, r)
+		},
+	})
+	edges := filepath.Join(t.TempDir(), "edges.jsonl")
+	result := crawlTestSite(t, site.URL, UnlimitedDepth, WithMaxPages(100), WithMaxAddedParams(2), WithEdgeOutput(edges))
+
+	// /filter?f=1 and the two adding one and two parameters to it.
+	if n := site.requested("/filter"); n != 3 {
+		t.Errorf("/filter was requested %d times, want 3", n)
+	}
+	if result.ParamAccumulationSkips != 1 {
+		t.Errorf("%d links skipped, want 1", result.ParamAccumulationSkips)
+	}
+
+	data, err := os.ReadFile(edges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var edge Edge
+		if err := json.Unmarshal([]byte(line), &edge); err != nil {
+			t.Fatal(err)
+		}
+		if edge.Status == EdgeParamAccumulation {
+			skipped++
+			if n := strings.Count(edge.Target, "f="); n != 4 {
+				t.Errorf("skipped %s, want the link with four parameters", edge.Target)
+			}
+		}
+	}
+	if skipped != 1 {
+		t.Errorf("%d edges recorded as %s, want 1", skipped, EdgeParamAccumulation)
+	}
+
+	// Without the guard, the filters run into the page budget.
+	site.lock.Lock()
+	site.requests = make(map[string]int)
+	site.lock.Unlock()
+	result = crawlTestSite(t, site.URL, UnlimitedDepth, WithMaxPages(20))
+	if len(result.Pages) != 20 || result.ParamAccumulationSkips != 0 {
+		t.Errorf("stored %d pages and skipped %d links without the guard", len(result.Pages), result.ParamAccumulationSkips)
+	}
+}
@@ -0,0 +1,596 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// DefaultParquetRowGroup is the number of pages per Parquet row group.
+const DefaultParquetRowGroup = 10000
+
+// WithParquetRowGroup sets the number of pages written per row group of the
+// Parquet export. Rows are buffered a row group at a time, so it bounds the
+// memory the export needs.
+func WithParquetRowGroup(rows int) Option {
+	return func(c *Crawler) {
+		if rows > 0 {
+			c.parquetRowGroup = rows
+		}
+	}
+}
+
+// Parquet physical types, repetitions, converted types, encodings and codecs,
+// numbered as in parquet.thrift.
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+	parquetRepeated = 2
+
+	parquetUTF8            = 0
+	parquetList            = 3
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetGzip = 2
+)
+
+// parquetField is a column of the Parquet export. value returns a string,
+// int32, int64, float64, bool or []string, or nil for a null. A list field
+// holds strings.
+type parquetField struct {
+	name      string
+	kind      int32
+	optional  bool
+	list      bool
+	timestamp bool
+	value     func(page *PageData) any
+}
+
+// optionalString maps the empty string to null.
+func optionalString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// jsonColumn encodes a nested field as JSON text, null when empty.
+func jsonColumn(v any, empty bool) any {
+	if empty {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// parquetPageFields is the schema of the Parquet export: one row per page,
+// flat fields as columns, Links as a list of strings and the nested fields
+// as JSON text.
+var parquetPageFields = []parquetField{
+	{name: "url", kind: parquetByteArray, value: func(p *PageData) any { return p.URL }},
+	{name: "final_url", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.FinalURL) }},
+	{name: "status_code", kind: parquetInt32, value: func(p *PageData) any { return int32(p.StatusCode) }},
+	{name: "title", kind: parquetByteArray, value: func(p *PageData) any { return p.Title }},
+	{name: "depth", kind: parquetInt32, value: func(p *PageData) any { return int32(p.Depth) }},
+	{name: "found_on", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.FoundOn) }},
+	{name: "crawled_at", kind: parquetInt64, optional: true, timestamp: true, value: func(p *PageData) any {
+		if p.CrawledAt.IsZero() {
+			return nil
+		}
+		return p.CrawledAt.UnixMilli()
+	}},
+	{name: "response_time_ms", kind: parquetInt64, value: func(p *PageData) any { return p.ResponseTime }},
+	{name: "language", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.Language) }},
+	{name: "vary", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.Vary) }},
+	{name: "content_hash", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.ContentHash) }},
+	{name: "content_simhash", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.ContentSimHash) }},
+	{name: "canonical", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.Canonical) }},
+	{name: "change", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.Change) }},
+	{name: "last_modified", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.LastModified) }},
+	{name: "published_at", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.PublishedAt) }},
+	{name: "published_source", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.PublishedSource) }},
+	{name: "modified_at", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.ModifiedAt) }},
+	{name: "modified_source", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.ModifiedSource) }},
+	{name: "size", kind: parquetInt64, value: func(p *PageData) any { return p.Size }},
+	{name: "charset", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.Charset) }},
+	{name: "description", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.Description) }},
+	{name: "word_count", kind: parquetInt32, value: func(p *PageData) any { return int32(p.WordCount) }},
+	{name: "noindex", kind: parquetBoolean, value: func(p *PageData) any { return p.Noindex }},
+	{name: "page_type", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.PageType) }},
+	{name: "link_score", kind: parquetDouble, value: func(p *PageData) any { return p.LinkScore }},
+	{name: "quality_score", kind: parquetInt32, optional: true, value: func(p *PageData) any {
+		if p.QualityScore == nil {
+			return nil
+		}
+		return int32(*p.QualityScore)
+	}},
+	{name: "malformed_html", kind: parquetBoolean, value: func(p *PageData) any { return p.MalformedHTML }},
+	{name: "slow_body_aborted", kind: parquetBoolean, value: func(p *PageData) any { return p.SlowBodyAborted }},
+	{name: "bodyless", kind: parquetBoolean, value: func(p *PageData) any { return p.Bodyless }},
+	{name: "recovered_on_retry", kind: parquetBoolean, value: func(p *PageData) any { return p.RecoveredOnRetry }},
+	{name: "unfollowed_redirect", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.UnfollowedRedirect) }},
+	{name: "unfollowed_reason", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return optionalString(p.UnfollowedReason) }},
+	{name: "alias", kind: parquetBoolean, value: func(p *PageData) any { return p.Alias }},
+	{name: "links", kind: parquetByteArray, list: true, value: func(p *PageData) any { return p.Links }},
+	{name: "redirect_chain", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return jsonColumn(p.RedirectChain, len(p.RedirectChain) == 0) }},
+	{name: "link_details", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return jsonColumn(p.LinkDetails, len(p.LinkDetails) == 0) }},
+	{name: "assets", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return jsonColumn(p.Assets, len(p.Assets) == 0) }},
+	{name: "mobile", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return jsonColumn(p.Mobile, p.Mobile == nil) }},
+	{name: "anchors", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return jsonColumn(p.Anchors, p.Anchors == nil) }},
+	{name: "toc", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return jsonColumn(p.TOC, p.TOC == nil) }},
+	{name: "perf", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return jsonColumn(p.Perf, p.Perf == nil) }},
+	{name: "legacy_markup", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return jsonColumn(p.LegacyMarkup, p.LegacyMarkup == nil) }},
+	{name: "hreflang", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return jsonColumn(p.Hreflang, len(p.Hreflang) == 0) }},
+	{name: "cookies", kind: parquetByteArray, optional: true, value: func(p *PageData) any { return jsonColumn(p.Cookies, len(p.Cookies) == 0) }},
+}
+
+// writePagesParquet writes pages as a Parquet file, rowGroup pages per row
+// group.
+func writePagesParquet(filename string, pages pageSource, rowGroup int) error {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf := bufio.NewWriter(file)
+	pw := newParquetWriter(buf, parquetPageFields, rowGroup)
+	err = pages(func(batch []PageData) error {
+		for i := range batch {
+			if err := pw.writeRow(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := pw.close(); err != nil {
+		return fmt.Errorf("error writing Parquet: %v", err)
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("error writing Parquet: %v", err)
+	}
+	return nil
+}
+
+// parquetColumn buffers the levels and PLAIN-encoded values of one column
+// for the current row group.
+type parquetColumn struct {
+	field  parquetField
+	defs   []byte
+	reps   []byte
+	values bytes.Buffer
+	bools  []bool
+}
+
+// parquetChunk is the footer metadata of a written column chunk.
+type parquetChunk struct {
+	offset       int64
+	numValues    int64
+	uncompressed int64
+	compressed   int64
+}
+
+type parquetRowGroup struct {
+	chunks []parquetChunk
+	rows   int64
+}
+
+// parquetWriter streams a Parquet file with one GZIP-compressed data page
+// per column chunk. Only the current row group is kept in memory.
+type parquetWriter struct {
+	w        io.Writer
+	offset   int64
+	columns  []*parquetColumn
+	rowGroup int
+	rows     int
+	groups   []parquetRowGroup
+	err      error
+}
+
+func newParquetWriter(w io.Writer, fields []parquetField, rowGroup int) *parquetWriter {
+	if rowGroup <= 0 {
+		rowGroup = DefaultParquetRowGroup
+	}
+	pw := &parquetWriter{w: w, rowGroup: rowGroup}
+	for _, field := range fields {
+		pw.columns = append(pw.columns, &parquetColumn{field: field})
+	}
+	pw.write([]byte("PAR1"))
+	return pw
+}
+
+func (pw *parquetWriter) write(data []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(data)
+	pw.offset += int64(n)
+	pw.err = err
+}
+
+func (pw *parquetWriter) writeRow(page *PageData) error {
+	for _, col := range pw.columns {
+		value := col.field.value(page)
+		switch {
+		case col.field.list:
+			links, _ := value.([]string)
+			if len(links) == 0 {
+				col.reps = append(col.reps, 0)
+				col.defs = append(col.defs, 0)
+			}
+			for i, link := range links {
+				col.reps = append(col.reps, byte(min(i, 1)))
+				col.defs = append(col.defs, 1)
+				col.putValue(link)
+			}
+		case col.field.optional:
+			if value == nil {
+				col.defs = append(col.defs, 0)
+				continue
+			}
+			col.defs = append(col.defs, 1)
+			col.putValue(value)
+		default:
+			col.putValue(value)
+		}
+	}
+	pw.rows++
+	if pw.rows >= pw.rowGroup {
+		pw.flush()
+	}
+	return pw.err
+}
+
+// putValue appends value in PLAIN encoding.
+func (col *parquetColumn) putValue(value any) {
+	var scratch [8]byte
+	switch v := value.(type) {
+	case string:
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(len(v)))
+		col.values.Write(scratch[:4])
+		col.values.WriteString(v)
+	case int32:
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(v))
+		col.values.Write(scratch[:4])
+	case int64:
+		binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+		col.values.Write(scratch[:])
+	case float64:
+		binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+		col.values.Write(scratch[:])
+	case bool:
+		col.bools = append(col.bools, v)
+	}
+}
+
+// numValues is the number of entries of the page, nulls and empty lists
+// included.
+func (col *parquetColumn) numValues(rows int) int {
+	if col.field.list || col.field.optional {
+		return len(col.defs)
+	}
+	return rows
+}
+
+// flush writes the buffered rows as a row group.
+func (pw *parquetWriter) flush() {
+	if pw.rows == 0 {
+		return
+	}
+	group := parquetRowGroup{rows: int64(pw.rows)}
+	for _, col := range pw.columns {
+		var page bytes.Buffer
+		if col.field.list {
+			writeLevels(&page, col.reps)
+		}
+		if col.field.list || col.field.optional {
+			writeLevels(&page, col.defs)
+		}
+		if col.field.kind == parquetBoolean {
+			packed := make([]byte, (len(col.bools)+7)/8)
+			for i, b := range col.bools {
+				if b {
+					packed[i/8] |= 1 << (i % 8)
+				}
+			}
+			page.Write(packed)
+		} else {
+			page.Write(col.values.Bytes())
+		}
+
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		zw.Write(page.Bytes())
+		zw.Close()
+
+		numValues := col.numValues(pw.rows)
+		header := &thriftWriter{}
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(compressed.Len()))
+		header.beginStruct(5)
+		header.i32(1, int32(numValues))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.endStruct()
+		header.stop()
+
+		chunk := parquetChunk{
+			offset:       pw.offset,
+			numValues:    int64(numValues),
+			uncompressed: int64(len(header.buf) + page.Len()),
+			compressed:   int64(len(header.buf) + compressed.Len()),
+		}
+		pw.write(header.buf)
+		pw.write(compressed.Bytes())
+		group.chunks = append(group.chunks, chunk)
+
+		col.defs, col.reps, col.bools = col.defs[:0], col.reps[:0], col.bools[:0]
+		col.values.Reset()
+	}
+	pw.groups = append(pw.groups, group)
+	pw.rows = 0
+}
+
+// writeLevels writes levels of bit width 1 in the RLE hybrid encoding,
+// prefixed by their length, as runs of equal values.
+func writeLevels(page *bytes.Buffer, levels []byte) {
+	var runs []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		runs = binary.AppendUvarint(runs, uint64(j-i)<<1)
+		runs = append(runs, levels[i])
+		i = j
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(runs)))
+	page.Write(length[:])
+	page.Write(runs)
+}
+
+// close flushes the last row group and writes the footer.
+func (pw *parquetWriter) close() error {
+	pw.flush()
+
+	meta := &thriftWriter{}
+	meta.i32(1, 1)
+	schemaLen := 1
+	for _, col := range pw.columns {
+		schemaLen++
+		if col.field.list {
+			schemaLen += 2
+		}
+	}
+	meta.listHeader(2, thriftStruct, schemaLen)
+	meta.beginElement()
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(pw.columns)))
+	meta.endStruct()
+	for _, col := range pw.columns {
+		f := col.field
+		if f.list {
+			meta.beginElement()
+			meta.i32(3, parquetRequired)
+			meta.str(4, f.name)
+			meta.i32(5, 1)
+			meta.i32(6, parquetList)
+			meta.logicalType(3)
+			meta.endStruct()
+			meta.beginElement()
+			meta.i32(3, parquetRepeated)
+			meta.str(4, "list")
+			meta.i32(5, 1)
+			meta.endStruct()
+		}
+		meta.beginElement()
+		meta.i32(1, f.kind)
+		if f.optional {
+			meta.i32(3, parquetOptional)
+		} else {
+			meta.i32(3, parquetRequired)
+		}
+		if f.list {
+			meta.str(4, "element")
+		} else {
+			meta.str(4, f.name)
+		}
+		switch {
+		case f.kind == parquetByteArray:
+			meta.i32(6, parquetUTF8)
+			meta.logicalType(1)
+		case f.timestamp:
+			meta.i32(6, parquetTimestampMillis)
+			meta.beginStruct(10)
+			meta.beginStruct(8)
+			meta.boolean(1, true)
+			meta.beginStruct(2)
+			meta.beginStruct(1)
+			meta.endStruct()
+			meta.endStruct()
+			meta.endStruct()
+			meta.endStruct()
+		}
+		meta.endStruct()
+	}
+
+	var numRows int64
+	for _, group := range pw.groups {
+		numRows += group.rows
+	}
+	meta.i64(3, numRows)
+	meta.listHeader(4, thriftStruct, len(pw.groups))
+	for _, group := range pw.groups {
+		meta.beginElement()
+		meta.listHeader(1, thriftStruct, len(group.chunks))
+		var total int64
+		for i, chunk := range group.chunks {
+			f := pw.columns[i].field
+			total += chunk.uncompressed
+			meta.beginElement()
+			meta.i64(2, chunk.offset)
+			meta.beginStruct(3)
+			meta.i32(1, f.kind)
+			meta.listHeader(2, thriftI32, 2)
+			meta.varint(zigzag(parquetPlain))
+			meta.varint(zigzag(parquetRLE))
+			path := []string{f.name}
+			if f.list {
+				path = append(path, "list", "element")
+			}
+			meta.listHeader(3, thriftBinary, len(path))
+			for _, name := range path {
+				meta.binary(name)
+			}
+			meta.i32(4, parquetGzip)
+			meta.i64(5, chunk.numValues)
+			meta.i64(6, chunk.uncompressed)
+			meta.i64(7, chunk.compressed)
+			meta.i64(9, chunk.offset)
+			meta.endStruct()
+			meta.endStruct()
+		}
+		meta.i64(2, total)
+		meta.i64(3, group.rows)
+		meta.endStruct()
+	}
+	meta.str(6, "webcrawler")
+	meta.stop()
+
+	pw.write(meta.buf)
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(meta.buf)))
+	pw.write(length[:])
+	pw.write([]byte("PAR1"))
+	return pw.err
+}
+
+// Thrift compact protocol types.
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the Parquet metadata structs in the Thrift compact
+// protocol. Only the types the metadata uses are supported.
+type thriftWriter struct {
+	buf   []byte
+	last  int16
+	stack []int16
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	t.buf = binary.AppendUvarint(t.buf, v)
+}
+
+func (t *thriftWriter) field(id int16, kind byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|kind)
+	} else {
+		t.buf = append(t.buf, kind)
+		t.varint(zigzag(int64(id)))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) boolean(id int16, v bool) {
+	if v {
+		t.field(id, thriftTrue)
+	} else {
+		t.field(id, thriftFalse)
+	}
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) binary(s string) {
+	t.varint(uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+func (t *thriftWriter) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.binary(s)
+}
+
+func (t *thriftWriter) listHeader(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+		return
+	}
+	t.buf = append(t.buf, 0xf0|elem)
+	t.varint(uint64(n))
+}
+
+// beginStruct starts a struct field; beginElement starts a struct inside a
+// list. Both are ended by endStruct.
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.beginElement()
+}
+
+func (t *thriftWriter) beginElement() {
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+func (t *thriftWriter) endStruct() {
+	t.stop()
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// logicalType writes the LogicalType union of a schema element whose
+// member id has no fields, such as STRING or LIST. Timestamps, which do,
+// are written by the caller.
+func (t *thriftWriter) logicalType(member int16) {
+	t.beginStruct(10)
+	t.beginStruct(member)
+	t.endStruct()
+	t.endStruct()
+}
+
+func (t *thriftWriter) stop() {
+	t.buf = append(t.buf, 0)
+}
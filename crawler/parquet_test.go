@@ -0,0 +1,587 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The reader below decodes the Parquet files of the tests on its own, from
+// the format specification, so that a bug of the writer is not mirrored by
+// the check. It supports what any valid file of the export may use: PLAIN
+// values, RLE and bit-packed levels, GZIP or no compression and several
+// data pages per chunk.
+
+// thriftReader decodes the Thrift compact protocol into generic values:
+// structs are maps of field ids, lists slices, integers int64 and binaries
+// []byte.
+type thriftReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *thriftReader) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("thrift at %d: %s", r.pos, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.fail("unexpected end")
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail("bad varint")
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(kind byte) any {
+	switch kind {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.zigzag()
+	case 7:
+		if r.pos+8 > len(r.data) {
+			r.fail("unexpected end")
+			return 0.0
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.data[r.pos:]))
+		r.pos += 8
+		return v
+	case 8:
+		n := int(r.uvarint())
+		if r.pos+n > len(r.data) {
+			r.fail("binary of %d bytes past the end", n)
+			return []byte(nil)
+		}
+		v := r.data[r.pos : r.pos+n]
+		r.pos += n
+		return v
+	case 9, 10:
+		header := r.byte()
+		n, elem := int(header>>4), header&0x0f
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]any, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			if elem == 1 || elem == 2 {
+				list = append(list, r.byte() == 1)
+				continue
+			}
+			list = append(list, r.value(elem))
+		}
+		return list
+	case 12:
+		return r.structure()
+	}
+	r.fail("unsupported type %d", kind)
+	return nil
+}
+
+func (r *thriftReader) structure() map[int16]any {
+	fields := make(map[int16]any)
+	var last int16
+	for r.err == nil {
+		header := r.byte()
+		if header == 0 {
+			break
+		}
+		kind := header & 0x0f
+		if delta := int16(header >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(r.zigzag())
+		}
+		fields[last] = r.value(kind)
+	}
+	return fields
+}
+
+// parquetTable is a file read back: the leaf columns in schema order and
+// the values of every row by column. Nulls are nil and lists []string.
+type parquetTable struct {
+	columns []string
+	types   map[string]int64
+	rows    int
+	values  map[string][]any
+}
+
+type parquetLeaf struct {
+	name           string
+	kind           int64
+	maxDef, maxRep int
+}
+
+func readParquet(t *testing.T, filename string) *parquetTable {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatal("no PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{data: data[len(data)-8-footerLen : len(data)-8]}
+	meta := footer.structure()
+	if footer.err != nil {
+		t.Fatal(footer.err)
+	}
+	if footer.pos != footerLen {
+		t.Fatalf("footer is %d bytes, %d were decoded", footerLen, footer.pos)
+	}
+
+	// Walk the schema tree for the levels of the leaves.
+	schema, _ := meta[2].([]any)
+	var leaves []parquetLeaf
+	var walk func(i, def, rep int, top string) int
+	walk = func(i, def, rep int, top string) int {
+		element := schema[i].(map[int16]any)
+		name := string(element[4].([]byte))
+		switch repetition, _ := element[3].(int64); repetition {
+		case 1:
+			def++
+		case 2:
+			def++
+			rep++
+		}
+		if top == "" {
+			top = name
+		}
+		children, ok := element[5].(int64)
+		if !ok || children == 0 {
+			leaves = append(leaves, parquetLeaf{name: top, kind: element[1].(int64), maxDef: def, maxRep: rep})
+			return i + 1
+		}
+		next := i + 1
+		for c := int64(0); c < children; c++ {
+			next = walk(next, def, rep, top)
+		}
+		return next
+	}
+	root := schema[0].(map[int16]any)
+	next := 1
+	for c := int64(0); c < root[5].(int64); c++ {
+		next = walk(next, 0, 0, "")
+	}
+	if next != len(schema) {
+		t.Fatalf("schema has %d elements, the tree %d", len(schema), next)
+	}
+
+	table := &parquetTable{rows: int(meta[3].(int64)), types: make(map[string]int64), values: make(map[string][]any)}
+	for _, leaf := range leaves {
+		table.columns = append(table.columns, leaf.name)
+		table.types[leaf.name] = leaf.kind
+	}
+	groups, _ := meta[4].([]any)
+	for g, group := range groups {
+		group := group.(map[int16]any)
+		chunks := group[1].([]any)
+		if len(chunks) != len(leaves) {
+			t.Fatalf("row group %d has %d columns, the schema %d", g, len(chunks), len(leaves))
+		}
+		for i, chunk := range chunks {
+			column := chunk.(map[int16]any)[3].(map[int16]any)
+			rows, err := readChunk(data, column, leaves[i])
+			if err != nil {
+				t.Fatalf("row group %d, column %s: %v", g, leaves[i].name, err)
+			}
+			if int64(len(rows)) != group[3].(int64) {
+				t.Fatalf("row group %d, column %s has %d rows, want %d", g, leaves[i].name, len(rows), group[3].(int64))
+			}
+			table.values[leaves[i].name] = append(table.values[leaves[i].name], rows...)
+		}
+	}
+	for name, rows := range table.values {
+		if len(rows) != table.rows {
+			t.Fatalf("column %s has %d rows, the file %d", name, len(rows), table.rows)
+		}
+	}
+	return table
+}
+
+// readChunk decodes the data pages of a column chunk into one value per
+// row.
+func readChunk(data []byte, column map[int16]any, leaf parquetLeaf) ([]any, error) {
+	pos := int(column[9].(int64))
+	numValues := int(column[5].(int64))
+	codec := column[4].(int64)
+	var rows []any
+	for read := 0; read < numValues; {
+		r := &thriftReader{data: data, pos: pos}
+		header := r.structure()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if kind := header[1].(int64); kind != 0 {
+			return nil, fmt.Errorf("page type %d", kind)
+		}
+		size := int(header[3].(int64))
+		body := data[r.pos : r.pos+size]
+		pos = r.pos + size
+		switch codec {
+		case 0:
+		case 2:
+			zr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			if body, err = io.ReadAll(zr); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("codec %d", codec)
+		}
+		if len(body) != int(header[2].(int64)) {
+			return nil, fmt.Errorf("page is %d bytes, the header says %d", len(body), header[2].(int64))
+		}
+		page := header[5].(map[int16]any)
+		if encoding := page[2].(int64); encoding != 0 {
+			return nil, fmt.Errorf("encoding %d", encoding)
+		}
+		n := int(page[1].(int64))
+		reps := make([]int, n)
+		defs := make([]int, n)
+		var err error
+		if leaf.maxRep > 0 {
+			if reps, body, err = readLevels(body, n, leaf.maxRep); err != nil {
+				return nil, err
+			}
+		}
+		if leaf.maxDef > 0 {
+			if defs, body, err = readLevels(body, n, leaf.maxDef); err != nil {
+				return nil, err
+			}
+		}
+		present := 0
+		for _, def := range defs {
+			if def == leaf.maxDef {
+				present++
+			}
+		}
+		values, err := readPlain(body, leaf.kind, present)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			var value any
+			if defs[i] == leaf.maxDef {
+				value, values = values[0], values[1:]
+			}
+			if leaf.maxRep == 0 {
+				rows = append(rows, value)
+				continue
+			}
+			if reps[i] == 0 {
+				rows = append(rows, []string{})
+			}
+			if value != nil {
+				last := len(rows) - 1
+				rows[last] = append(rows[last].([]string), value.(string))
+			}
+		}
+		read += n
+	}
+	return rows, nil
+}
+
+// readLevels decodes n levels up to max in the RLE/bit-packed hybrid,
+// prefixed by their length, returning the rest of data.
+func readLevels(data []byte, n, max int) ([]int, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("levels past the end")
+	}
+	length := int(binary.LittleEndian.Uint32(data))
+	encoded, rest := data[4:4+length], data[4+length:]
+	width := 0
+	for 1<<width <= max {
+		width++
+	}
+	var levels []int
+	for len(encoded) > 0 && len(levels) < n {
+		header, m := binary.Uvarint(encoded)
+		if m <= 0 {
+			return nil, nil, fmt.Errorf("bad run header")
+		}
+		encoded = encoded[m:]
+		if header&1 == 0 {
+			size := (width + 7) / 8
+			value := 0
+			for i := 0; i < size; i++ {
+				value |= int(encoded[i]) << (8 * i)
+			}
+			encoded = encoded[size:]
+			for i := uint64(0); i < header>>1; i++ {
+				levels = append(levels, value)
+			}
+			continue
+		}
+		count := int(header>>1) * 8
+		for i := 0; i < count; i++ {
+			value := 0
+			for b := 0; b < width; b++ {
+				bit := i*width + b
+				value |= int(encoded[bit/8]>>(bit%8)&1) << b
+			}
+			levels = append(levels, value)
+		}
+		encoded = encoded[count*width/8:]
+	}
+	if len(levels) < n {
+		return nil, nil, fmt.Errorf("%d levels, want %d", len(levels), n)
+	}
+	return levels[:n], rest, nil
+}
+
+func readPlain(data []byte, kind int64, n int) ([]any, error) {
+	values := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		switch kind {
+		case 0:
+			if i/8 >= len(data) {
+				return nil, fmt.Errorf("booleans past the end")
+			}
+			values = append(values, data[i/8]>>(i%8)&1 == 1)
+		case 1:
+			values = append(values, int32(binary.LittleEndian.Uint32(data)))
+			data = data[4:]
+		case 2:
+			values = append(values, int64(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case 5:
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case 6:
+			length := int(binary.LittleEndian.Uint32(data))
+			values = append(values, string(data[4:4+length]))
+			data = data[4+length:]
+		default:
+			return nil, fmt.Errorf("type %d", kind)
+		}
+	}
+	return values, nil
+}
+
+// jsonFields returns the JSON of page by key.
+func jsonFields(t *testing.T, page *PageData) map[string]json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+// wantColumn is the value a column should hold for page, taken from fields,
+// the JSON of the page, whose keys the columns are named after. An absent
+// key is null in an optional column and the zero value in a required one.
+func wantColumn(t *testing.T, page *PageData, fields map[string]json.RawMessage, column string, kind int64) any {
+	t.Helper()
+	raw, ok := fields[column]
+	switch column {
+	case "crawled_at":
+		if page.CrawledAt.IsZero() {
+			return nil
+		}
+		return page.CrawledAt.UnixMilli()
+	case "links":
+		links := []string{}
+		json.Unmarshal(raw, &links)
+		if links == nil {
+			links = []string{}
+		}
+		return links
+	case "url", "title", "status_code", "depth", "response_time_ms":
+	default:
+		if !ok {
+			switch kind {
+			case 0:
+				return false
+			case 1:
+				if column == "quality_score" {
+					return nil
+				}
+				return int32(0)
+			case 2:
+				return int64(0)
+			case 5:
+				return 0.0
+			}
+			return nil
+		}
+	}
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		t.Fatal(err)
+	}
+	switch v := value.(type) {
+	case float64:
+		switch kind {
+		case 1:
+			return int32(v)
+		case 2:
+			return int64(v)
+		}
+		return v
+	case string, bool:
+		return v
+	}
+	// A nested value, exported as JSON text.
+	return value
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	score := 87
+	zero := 0
+	full := PageData{
+		URL:                "http://example.com/full",
+		FinalURL:           "http://example.com/full/",
+		RedirectChain:      []RedirectHop{{URL: "http://example.com/full", StatusCode: 301}},
+		Title:              "Full — ünïcode",
+		Links:              []string{"http://example.com/a", "http://example.com/b", "http://example.com/c"},
+		LinkDetails:        []LinkDetail{{URL: "http://example.com/a", Text: "a", Source: LinkSourceAnchor, Nofollow: true}},
+		Assets:             []Asset{{URL: "http://example.com/s.css", Type: "stylesheet"}},
+		Mobile:             &MobileSignals{HasViewport: true, Viewport: "width=device-width"},
+		Anchors:            &AnchorCounts{Empty: 1, Placeholder: 2},
+		Perf:               &PerfSignals{HeadBytes: 512, BlockingScripts: 1},
+		LegacyMarkup:       &LegacyMarkup{Elements: map[string]int{"font": 2}, Total: 2},
+		Depth:              2,
+		CrawledAt:          time.Date(2026, 3, 4, 5, 6, 7, 890_000_000, time.UTC),
+		ResponseTime:       123,
+		StatusCode:         200,
+		Size:               4096,
+		Charset:            "utf-8",
+		Description:        "A page",
+		WordCount:          321,
+		Noindex:            true,
+		PageType:           "article",
+		QualityScore:       &score,
+		FoundOn:            "http://example.com/",
+		Language:           "de",
+		Vary:               "Accept-Language",
+		ContentHash:        "abc123",
+		ContentSimHash:     "00ff00ff00ff00ff",
+		TOC:                &PageTOC{IDs: []string{"top"}},
+		Cookies:            []PageCookie{{Name: "session", Secure: true}},
+		Canonical:          "http://example.com/full/",
+		Hreflang:           []HreflangLink{{Language: "en", URL: "http://example.com/en/full"}},
+		Change:             "changed",
+		LastModified:       "Tue, 03 Mar 2026 10:00:00 GMT",
+		PublishedAt:        "2026-03-01",
+		PublishedSource:    "json-ld",
+		ModifiedAt:         "2026-03-02",
+		ModifiedSource:     "meta",
+		LinkScore:          0.25,
+		MalformedHTML:      true,
+		SlowBodyAborted:    true,
+		RecoveredOnRetry:   true,
+		Bodyless:           true,
+		UnfollowedRedirect: "http://other.example/",
+		UnfollowedReason:   EdgeNotListed,
+		Alias:              true,
+	}
+	pages := []PageData{
+		full,
+		// Nulls and zero values throughout: an empty title stays an
+		// empty string, the optional strings are null.
+		{URL: "http://example.com/empty", StatusCode: 204},
+		{URL: "http://example.com/one-link", Title: "", StatusCode: 404, Links: []string{""}, QualityScore: &zero, LinkScore: -1.5},
+	}
+	// Enough pages for runs of levels longer than one byte of run length
+	// and for several row groups.
+	for i := 0; i < 150; i++ {
+		page := PageData{URL: fmt.Sprintf("http://example.com/p/%d", i), StatusCode: 200, Depth: i % 4, Title: strings.Repeat("t", i%3)}
+		if i%7 == 0 {
+			page.Language = "fr"
+			page.Links = []string{"http://example.com/"}
+		}
+		pages = append(pages, page)
+	}
+
+	for _, rowGroup := range []int{3, 64, DefaultParquetRowGroup} {
+		t.Run(fmt.Sprintf("row group %d", rowGroup), func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "pages.parquet")
+			if err := writePagesParquet(filename, slicePages(pages), rowGroup); err != nil {
+				t.Fatal(err)
+			}
+			table := readParquet(t, filename)
+			if table.rows != len(pages) {
+				t.Fatalf("file has %d rows, want %d", table.rows, len(pages))
+			}
+			if len(table.columns) != len(parquetPageFields) {
+				t.Errorf("file has %d columns, the schema %d", len(table.columns), len(parquetPageFields))
+			}
+			for i := range pages {
+				fields := jsonFields(t, &pages[i])
+				for _, column := range table.columns {
+					got := table.values[column][i]
+					want := wantColumn(t, &pages[i], fields, column, table.types[column])
+					switch want.(type) {
+					case map[string]any, []any:
+						if s, ok := got.(string); ok {
+							var nested any
+							if err := json.Unmarshal([]byte(s), &nested); err != nil {
+								t.Errorf("row %d, column %s is not JSON: %v", i, column, err)
+							}
+							got = nested
+						}
+					}
+					if !reflect.DeepEqual(got, want) {
+						t.Errorf("row %d (%s), column %s = %#v, want %#v", i, pages[i].URL, column, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParquetEmpty(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "pages.parquet")
+	if err := writePagesParquet(filename, slicePages(nil), 0); err != nil {
+		t.Fatal(err)
+	}
+	table := readParquet(t, filename)
+	if table.rows != 0 {
+		t.Errorf("file has %d rows, want 0", table.rows)
+	}
+	if len(table.columns) != len(parquetPageFields) {
+		t.Errorf("file has %d columns, the schema %d", len(table.columns), len(parquetPageFields))
+	}
+}
@@ -0,0 +1,121 @@
+package crawler
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// OversizedInlineBytes is the size from which an inline <script> or
+// <style> block of the head counts as oversized.
+const OversizedInlineBytes = 16 << 10
+
+// WithPerfSignals records the render-blocking resources of every page in
+// PerfSignals, read from the HTML without running a browser.
+func WithPerfSignals() Option {
+	return func(c *Crawler) {
+		c.perfSignals = true
+	}
+}
+
+// PerfSignals are the render-blocking parts of the <head> of a page.
+type PerfSignals struct {
+	// HeadBytes is the size of the head as parsed and serialized again,
+	// which is close to its size in the response.
+	HeadBytes int `json:"head_bytes"`
+	// BlockingScripts counts the <script src> of the head without async,
+	// defer or type="module", which stop parsing until they ran.
+	BlockingScripts int `json:"blocking_scripts,omitempty"`
+	// Stylesheets counts the stylesheet links of the head, except disabled
+	// ones and those for print only, which do not block rendering.
+	Stylesheets int `json:"stylesheets,omitempty"`
+	// LargestInlineScript and LargestInlineStyle are the sizes of the
+	// largest inline blocks of the head, and OversizedInline counts the
+	// blocks of at least OversizedInlineBytes.
+	LargestInlineScript int `json:"largest_inline_script,omitempty"`
+	LargestInlineStyle  int `json:"largest_inline_style,omitempty"`
+	OversizedInline     int `json:"oversized_inline,omitempty"`
+}
+
+// extractPerfSignals reads the render-blocking resources of the head of
+// doc. It returns nil when the page has no head content.
+func extractPerfSignals(doc *goquery.Document) *PerfSignals {
+	head := doc.Find("head").First()
+	html, err := goquery.OuterHtml(head)
+	if err != nil || head.Children().Length() == 0 {
+		return nil
+	}
+	signals := &PerfSignals{HeadBytes: len(html)}
+	head.Find("script").Each(func(_ int, s *goquery.Selection) {
+		typ := s.AttrOr("type", "")
+		classic := isJavaScriptType(typ)
+		if !classic && !strings.EqualFold(strings.TrimSpace(typ), "module") {
+			return
+		}
+		if _, ok := s.Attr("src"); ok {
+			_, async := s.Attr("async")
+			_, deferred := s.Attr("defer")
+			if classic && !async && !deferred {
+				signals.BlockingScripts++
+			}
+			return
+		}
+		size := len(s.Text())
+		signals.LargestInlineScript = max(signals.LargestInlineScript, size)
+		if size >= OversizedInlineBytes {
+			signals.OversizedInline++
+		}
+	})
+	head.Find("style").Each(func(_ int, s *goquery.Selection) {
+		size := len(s.Text())
+		signals.LargestInlineStyle = max(signals.LargestInlineStyle, size)
+		if size >= OversizedInlineBytes {
+			signals.OversizedInline++
+		}
+	})
+	head.Find(`link[rel~="stylesheet"]`).Each(func(_ int, s *goquery.Selection) {
+		if _, disabled := s.Attr("disabled"); disabled || strings.EqualFold(strings.TrimSpace(s.AttrOr("media", "")), "print") {
+			return
+		}
+		signals.Stylesheets++
+	})
+	return signals
+}
+
+// isJavaScriptType reports whether a <script type> runs as a classic
+// script: no type, or a JavaScript MIME type.
+func isJavaScriptType(t string) bool {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if i := strings.IndexByte(t, ';'); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+	switch t {
+	case "", "text/javascript", "application/javascript", "application/x-javascript", "text/ecmascript", "application/ecmascript":
+		return true
+	}
+	return false
+}
+
+// HeaviestHeads returns the n pages with the largest heads, with their
+// PerfSignals, largest first; pages with as large a head come first when
+// they load more blocking scripts and stylesheets.
+func HeaviestHeads(pages []PageData, n int) []PageData {
+	var heavy []PageData
+	for _, page := range pages {
+		if page.Perf != nil {
+			heavy = append(heavy, page)
+		}
+	}
+	sort.SliceStable(heavy, func(i, j int) bool {
+		pi, pj := heavy[i].Perf, heavy[j].Perf
+		if pi.HeadBytes != pj.HeadBytes {
+			return pi.HeadBytes > pj.HeadBytes
+		}
+		if bi, bj := pi.BlockingScripts+pi.Stylesheets, pj.BlockingScripts+pj.Stylesheets; bi != bj {
+			return bi > bj
+		}
+		return heavy[i].URL < heavy[j].URL
+	})
+	return heavy[:min(n, len(heavy))]
+}
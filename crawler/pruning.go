@@ -0,0 +1,257 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Defaults of WithAdaptivePruning: a pattern is pruned when fewer than 2%
+// of the last 200 pages matching it were productive.
+const (
+	DefaultPruningWindow   = 200
+	DefaultPruningMinYield = 0.02
+)
+
+// EdgePruned marks links to a URL pattern that adaptive pruning stopped
+// expanding.
+const EdgePruned = "pruned"
+
+// WithAdaptivePruning stops expanding URL patterns, such as pagination or
+// calendar pages, that keep producing pages without anything new. URLs are
+// grouped by their address with every run of digits templated, so
+// /events/2024/05?page=3 matches /events/{n}/{n}?page={n}. A crawled page
+// is productive when it links to a URL not discovered before outside its
+// own pattern, or when its content is not that of another page of the
+// pattern; the body text is compared with its digits templated too, so
+// empty calendar days or pages past the last of a listing, which only
+// differ by a number, are duplicates. Once window pages of a pattern are crawled, and fewer than minYield of
+// the last window were productive, no further URL of the pattern is
+// crawled and the decision is recorded in PrunedPatterns. URLs without
+// digits are never pruned.
+func WithAdaptivePruning(window int, minYield float64) Option {
+	return func(c *Crawler) {
+		c.pruning.enabled = true
+		c.pruning.window = window
+		c.pruning.minYield = minYield
+	}
+}
+
+// PrunedPattern records a URL pattern adaptive pruning stopped expanding.
+type PrunedPattern struct {
+	Pattern string `json:"pattern"`
+	// Example is the last crawled URL of the pattern.
+	Example string `json:"example"`
+	// Pages counts the crawled pages of the pattern, and Productive those
+	// of the last Window that found new links or content.
+	Pages      int     `json:"pages"`
+	Window     int     `json:"window"`
+	Productive int     `json:"productive"`
+	MinYield   float64 `json:"min_yield"`
+	// Skipped counts the URLs of the pattern not crawled because of the
+	// decision.
+	Skipped int `json:"skipped"`
+}
+
+type pruner struct {
+	enabled  bool
+	window   int
+	minYield float64
+
+	lock     sync.Mutex
+	patterns map[string]*patternYield
+	pruned   map[string]*PrunedPattern
+	skipped  map[string]bool
+}
+
+// patternYield is the recent yield of the pages of one pattern.
+type patternYield struct {
+	pages      int
+	outcomes   []bool
+	next       int
+	productive int
+	hashes     map[string]bool
+}
+
+// urlPattern returns the pattern of a normalized URL: its path and query
+// with every run of digits replaced by {n}, the query parameters sorted.
+// It returns "" for URLs without digits, which are not patterns.
+func urlPattern(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil || !strings.ContainsAny(u.EscapedPath()+u.RawQuery, "0123456789") {
+		return ""
+	}
+	pattern := templateDigits(u.EscapedPath())
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		for i, param := range params {
+			params[i] = templateDigits(param)
+		}
+		sort.Strings(params)
+		pattern += "?" + strings.Join(params, "&")
+	}
+	return pattern
+}
+
+func templateDigits(s string) string {
+	var b strings.Builder
+	inDigits := false
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			if !inDigits {
+				b.WriteString("{n}")
+			}
+			inDigits = true
+			continue
+		}
+		inDigits = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isPruned reports whether target belongs to a pruned pattern, counting it
+// among the skipped URLs of the pattern.
+func (p *pruner) isPruned(target string) bool {
+	if !p.enabled {
+		return false
+	}
+	pattern := urlPattern(target)
+	if pattern == "" {
+		return false
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	decision := p.pruned[pattern]
+	if decision == nil {
+		return false
+	}
+	if !p.skipped[target] {
+		if p.skipped == nil {
+			p.skipped = make(map[string]bool)
+		}
+		p.skipped[target] = true
+		decision.Skipped++
+	}
+	return true
+}
+
+// pruningContent returns the key comparing the content of the pages of a
+// pattern: a hash of the body text of doc with its digits templated, or
+// hash for malformed pages, which have no document.
+func pruningContent(doc *goquery.Document, hash string) string {
+	if doc == nil {
+		return hash
+	}
+	sum := sha256.Sum256([]byte(templateDigits(strings.Join(strings.Fields(doc.Find("body").Text()), " "))))
+	return hex.EncodeToString(sum[:8])
+}
+
+// observe records the yield of a crawled page: the URLs it discovered and
+// its content, doc or hash for malformed pages. It returns the decision
+// when the page made the pattern fall below the minimum yield.
+func (p *pruner) observe(pageURL string, discovered []string, doc *goquery.Document, hash string) *PrunedPattern {
+	if !p.enabled || p.window <= 0 {
+		return nil
+	}
+	pattern := urlPattern(pageURL)
+	if pattern == "" {
+		return nil
+	}
+	newLinks := false
+	for _, link := range discovered {
+		if urlPattern(link) != pattern {
+			newLinks = true
+			break
+		}
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.pruned[pattern] != nil {
+		return nil
+	}
+	if p.patterns == nil {
+		p.patterns = make(map[string]*patternYield)
+	}
+	y := p.patterns[pattern]
+	if y == nil {
+		y = &patternYield{outcomes: make([]bool, 0, p.window), hashes: make(map[string]bool)}
+		p.patterns[pattern] = y
+	}
+	content := pruningContent(doc, hash)
+	newContent := content == "" || !y.hashes[content]
+	if content != "" {
+		y.hashes[content] = true
+	}
+	productive := newLinks || newContent
+
+	y.pages++
+	if len(y.outcomes) < p.window {
+		y.outcomes = append(y.outcomes, productive)
+	} else {
+		if y.outcomes[y.next] {
+			y.productive--
+		}
+		y.outcomes[y.next] = productive
+		y.next = (y.next + 1) % p.window
+	}
+	if productive {
+		y.productive++
+	}
+	if len(y.outcomes) < p.window || float64(y.productive) >= p.minYield*float64(p.window) {
+		return nil
+	}
+
+	decision := &PrunedPattern{
+		Pattern:    pattern,
+		Example:    pageURL,
+		Pages:      y.pages,
+		Window:     p.window,
+		Productive: y.productive,
+		MinYield:   p.minYield,
+	}
+	p.prune(decision)
+	delete(p.patterns, pattern)
+	return decision
+}
+
+// prune records decision, adding to an earlier decision on the same
+// pattern. It must be called with p.lock held.
+func (p *pruner) prune(decision *PrunedPattern) {
+	if p.pruned == nil {
+		p.pruned = make(map[string]*PrunedPattern)
+	}
+	if known := p.pruned[decision.Pattern]; known != nil {
+		known.Pages += decision.Pages
+		known.Skipped += decision.Skipped
+		return
+	}
+	p.pruned[decision.Pattern] = decision
+}
+
+// restore adds the decisions of an earlier crawl or of other shards.
+func (p *pruner) restore(decisions []PrunedPattern) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, decision := range decisions {
+		p.prune(&decision)
+	}
+}
+
+// decisions returns the pruned patterns, by pattern.
+func (p *pruner) decisions() []PrunedPattern {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var list []PrunedPattern
+	for _, decision := range p.pruned {
+		list = append(list, *decision)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Pattern < list[j].Pattern })
+	return list
+}
@@ -0,0 +1,184 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestURLPattern(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"http://example.com/events/2024/05?page=3", "/events/{n}/{n}?page={n}"},
+		{"http://example.com/events/2023/12?page=10", "/events/{n}/{n}?page={n}"},
+		{"http://example.com/list?sort=asc&page=2", "/list?page={n}&sort=asc"},
+		{"http://example.com/list?page=2&sort=asc", "/list?page={n}&sort=asc"},
+		{"http://example.com/item-12-b34", "/item-{n}-b{n}"},
+		{"http://example.com/a%20b/7", "/a%{n}b/{n}"},
+		{"http://example.com/", ""},
+		{"http://example.com/about?lang=en", ""},
+		// The host is not part of the pattern.
+		{"http://host2.example.com/", ""},
+	}
+	for _, tt := range tests {
+		if got := urlPattern(tt.url); got != tt.want {
+			t.Errorf("urlPattern(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+// observePages feeds n pages of the pattern /cal?page={n}, starting at
+// first, to p: productive ones with new content, the others all alike.
+func observePages(p *pruner, first, n int, productive bool) *PrunedPattern {
+	var decision *PrunedPattern
+	for i := first; i < first+n; i++ {
+		hash := "same"
+		if productive {
+			hash = "page " + strconv.Itoa(i)
+		}
+		if d := p.observe(fmt.Sprintf("http://example.com/cal?page=%d", i), nil, nil, hash); d != nil {
+			decision = d
+		}
+	}
+	return decision
+}
+
+func TestPrunerObserve(t *testing.T) {
+	p := &pruner{enabled: true, window: 10, minYield: 0.2}
+
+	// Nothing is decided before a whole window is crawled, however
+	// unproductive it is.
+	if d := observePages(p, 0, 9, false); d != nil {
+		t.Fatalf("pruned after 9 pages: %+v", d)
+	}
+	if p.isPruned("http://example.com/cal?page=100") {
+		t.Fatal("pruned before the decision")
+	}
+	d := observePages(p, 9, 1, false)
+	if d == nil {
+		t.Fatal("not pruned after a window of duplicates")
+	}
+	// Only the first page had content not seen before.
+	want := PrunedPattern{Pattern: "/cal?page={n}", Example: "http://example.com/cal?page=9", Pages: 10, Window: 10, Productive: 1, MinYield: 0.2}
+	if *d != want {
+		t.Errorf("decision %+v, want %+v", *d, want)
+	}
+	if !p.isPruned("http://example.com/cal?page=100") || !p.isPruned("http://example.com/cal?page=100") || !p.isPruned("http://example.com/cal?page=101") {
+		t.Error("URLs of the pattern are not pruned")
+	}
+	if p.isPruned("http://example.com/other?page=1") || p.isPruned("http://example.com/cal") {
+		t.Error("URLs of other patterns are pruned")
+	}
+	if got := p.decisions(); len(got) != 1 || got[0].Skipped != 2 {
+		t.Errorf("decisions %+v, want one with 2 URLs skipped", got)
+	}
+
+	// A pattern at the minimum yield is kept; the window slides.
+	p = &pruner{enabled: true, window: 10, minYield: 0.2}
+	for round := 0; round < 5; round++ {
+		if d := observePages(p, round*10, 2, true); d != nil {
+			t.Fatalf("round %d: pruned at the minimum yield: %+v", round, d)
+		}
+		if d := observePages(p, round*10+2, 8, false); d != nil {
+			t.Fatalf("round %d: pruned at the minimum yield: %+v", round, d)
+		}
+	}
+	// The next duplicate pushes a productive page out of the window.
+	if d := observePages(p, 100, 1, false); d == nil || d.Productive != 1 || d.Pages != 51 {
+		t.Errorf("decision %+v, want one once the window has a single productive page", d)
+	}
+
+	// New links outside the pattern make a page productive, links within
+	// it do not.
+	p = &pruner{enabled: true, window: 5, minYield: 0.5}
+	for i := 0; i < 20; i++ {
+		links := []string{fmt.Sprintf("http://example.com/cal?page=%d", i+1), fmt.Sprintf("http://example.com/event/x%d", i)}
+		if d := p.observe(fmt.Sprintf("http://example.com/cal?page=%d", i), links, nil, "same"); d != nil {
+			t.Fatalf("pruned a pattern finding new links: %+v", d)
+		}
+	}
+	for i := 20; i < 25; i++ {
+		p.observe(fmt.Sprintf("http://example.com/cal?page=%d", i), []string{fmt.Sprintf("http://example.com/cal?page=%d", i+1)}, nil, "same")
+	}
+	if !p.isPruned("http://example.com/cal?page=99") {
+		t.Error("not pruned after links only within the pattern")
+	}
+}
+
+func TestPrunerDisabled(t *testing.T) {
+	var p pruner
+	if d := observePages(&p, 0, 1000, false); d != nil {
+		t.Errorf("a disabled pruner decided %+v", d)
+	}
+	if p.isPruned("http://example.com/cal?page=1") {
+		t.Error("a disabled pruner prunes")
+	}
+	// Pages without digits are not a pattern.
+	p = pruner{enabled: true, window: 2, minYield: 1}
+	for i := 0; i < 10; i++ {
+		if d := p.observe("http://example.com/same", nil, nil, "same"); d != nil {
+			t.Fatalf("pruned a URL without digits: %+v", d)
+		}
+	}
+}
+
+func TestPrunerRestore(t *testing.T) {
+	var p pruner
+	p.enabled = true
+	p.restore([]PrunedPattern{{Pattern: "/cal?page={n}", Pages: 10, Skipped: 3}, {Pattern: "/b/{n}", Pages: 5}})
+	p.restore([]PrunedPattern{{Pattern: "/cal?page={n}", Pages: 20, Skipped: 4}})
+	got := p.decisions()
+	if len(got) != 2 || got[0].Pattern != "/b/{n}" || got[1].Pages != 30 || got[1].Skipped != 7 {
+		t.Errorf("decisions %+v, want the two patterns with /cal combined", got)
+	}
+	if !p.isPruned("http://example.com/cal?page=1") {
+		t.Error("a restored decision does not prune")
+	}
+}
+
+// calendarSite serves an endless calendar whose pages link to the next
+// month and differ only by the month, next to a page linked from all.
+func calendarSite(t *testing.T) *testSite {
+	return newTestSite(t, map[string]http.HandlerFunc{
+		"/": htmlPage(`<a href="/cal?month=1">calendar</a>`),
+		"/cal": func(w http.ResponseWriter, r *http.Request) {
+			month, _ := strconv.Atoi(r.URL.Query().Get("month"))
+			htmlPage(fmt.Sprintf(`<p>No events in month %d.</p><a href="/cal?month=%d">next</a> <a href="/about">about</a>`, month, month+1))(w, r)
+		},
+		"/about": htmlPage("about"),
+	})
+}
+
+func TestCrawlAdaptivePruning(t *testing.T) {
+	site := calendarSite(t)
+	result := crawlTestSite(t, site.URL, UnlimitedDepth, WithMaxPages(200), WithAdaptivePruning(20, 0.1))
+	if len(result.PrunedPatterns) != 1 {
+		t.Fatalf("pruned %+v, want the calendar", result.PrunedPatterns)
+	}
+	d := result.PrunedPatterns[0]
+	if d.Pattern != "/cal?month={n}" || d.Window != 20 || d.Skipped != 1 || !strings.HasPrefix(d.Example, site.URL+"/cal?month=") {
+		t.Errorf("decision %+v", d)
+	}
+	calendar := 0
+	for _, page := range result.Pages {
+		if strings.Contains(page.URL, "/cal?") {
+			calendar++
+		}
+	}
+	if calendar != d.Pages || calendar > 21 {
+		t.Errorf("crawled %d calendar pages, decision counts %d, want about a window", calendar, d.Pages)
+	}
+	if findPage(result, site.URL, "/about") == nil {
+		t.Error("/about is not stored")
+	}
+
+	// Without it, the calendar runs into the page budget.
+	site = calendarSite(t)
+	result = crawlTestSite(t, site.URL, UnlimitedDepth, WithMaxPages(60))
+	if len(result.Pages) != 60 || len(result.PrunedPatterns) != 0 {
+		t.Errorf("stored %d pages and pruned %+v without pruning", len(result.Pages), result.PrunedPatterns)
+	}
+}
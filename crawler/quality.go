@@ -0,0 +1,346 @@
+package crawler
+
+import (
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// QualityWeights are the points a page loses from a quality score of 100
+// for each problem, and the thresholds deciding when a page has it. Start
+// from DefaultQualityWeights and change the fields that matter.
+type QualityWeights struct {
+	MissingTitle         int `yaml:"missing_title" json:"missing_title"`
+	DuplicateTitle       int `yaml:"duplicate_title" json:"duplicate_title"`
+	MissingDescription   int `yaml:"missing_description" json:"missing_description"`
+	DuplicateContent     int `yaml:"duplicate_content" json:"duplicate_content"`
+	NearDuplicateContent int `yaml:"near_duplicate_content" json:"near_duplicate_content"`
+	ThinContent          int `yaml:"thin_content" json:"thin_content"`
+	Slow                 int `yaml:"slow" json:"slow"`
+	Large                int `yaml:"large" json:"large"`
+	Noindex              int `yaml:"noindex" json:"noindex"`
+
+	// A title or content is duplicate when at least DuplicatePages pages
+	// of the same language share it. Content is near-duplicate when its
+	// SimHash is at most NearDuplicateBits bits, up to
+	// MaxNearDuplicateBits, from that of a page of the same language with
+	// other content. A page is thin below ThinWords words, slow above
+	// SlowMs milliseconds and large above LargeBytes bytes.
+	DuplicatePages    int   `yaml:"duplicate_pages" json:"duplicate_pages"`
+	NearDuplicateBits int   `yaml:"near_duplicate_bits" json:"near_duplicate_bits"`
+	ThinWords         int   `yaml:"thin_words" json:"thin_words"`
+	SlowMs            int64 `yaml:"slow_ms" json:"slow_ms"`
+	LargeBytes        int64 `yaml:"large_bytes" json:"large_bytes"`
+}
+
+// DefaultQualityWeights are the weights used unless WithQualityWeights
+// sets others.
+var DefaultQualityWeights = QualityWeights{
+	MissingTitle:         20,
+	DuplicateTitle:       10,
+	MissingDescription:   10,
+	DuplicateContent:     15,
+	NearDuplicateContent: 10,
+	ThinContent:          15,
+	Slow:                 10,
+	Large:                5,
+	Noindex:              15,
+
+	DuplicatePages:    2,
+	NearDuplicateBits: 3,
+	ThinWords:         200,
+	SlowMs:            1000,
+	LargeBytes:        1 << 20,
+}
+
+// MaxNearDuplicateBits bounds QualityWeights.NearDuplicateBits. Only
+// hashes agreeing on one of bits+1 bands are compared, and narrower bands
+// make most pages of a site compared with each other.
+const MaxNearDuplicateBits = 4
+
+// WithQualityWeights sets the weights of the quality score computed for
+// every page after the crawl.
+func WithQualityWeights(w QualityWeights) Option {
+	return func(c *Crawler) {
+		c.qualityWeights = w
+	}
+}
+
+// QualitySignals are the facts about a page that depend on other pages.
+type QualitySignals struct {
+	DuplicateTitle       bool
+	DuplicateContent     bool
+	NearDuplicateContent bool
+}
+
+// QualityProblem is a problem lowering the quality score of a page.
+type QualityProblem struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// QualityProblems lists the problems of page, with their weights. The
+// description and word count of malformed pages, and of pages whose body
+// was abandoned, are unknown and not counted as problems.
+func QualityProblems(page PageData, signals QualitySignals, w QualityWeights) []QualityProblem {
+	var problems []QualityProblem
+	check := func(problem bool, name string, weight int) {
+		if problem && weight > 0 {
+			problems = append(problems, QualityProblem{Name: name, Weight: weight})
+		}
+	}
+	check(strings.TrimSpace(page.Title) == "", "missing title", w.MissingTitle)
+	check(signals.DuplicateTitle, "duplicate title", w.DuplicateTitle)
+	complete := !page.MalformedHTML && !page.SlowBodyAborted
+	check(complete && page.Description == "", "missing description", w.MissingDescription)
+	check(signals.DuplicateContent, "duplicate content", w.DuplicateContent)
+	// A duplicate is not penalized again for the pages close to it.
+	check(signals.NearDuplicateContent && !signals.DuplicateContent, "near-duplicate content", w.NearDuplicateContent)
+	check(complete && page.WordCount < w.ThinWords, "thin content", w.ThinContent)
+	check(w.SlowMs > 0 && page.ResponseTime > w.SlowMs, "slow", w.Slow)
+	check(w.LargeBytes > 0 && page.Size > w.LargeBytes, "large", w.Large)
+	check(page.Noindex, "noindex", w.Noindex)
+	return problems
+}
+
+// QualityScore rates page from 0 to 100: 100 less the weight of every
+// problem QualityProblems finds, never below 0.
+func QualityScore(page PageData, signals QualitySignals, w QualityWeights) int {
+	score := 100
+	for _, problem := range QualityProblems(page, signals, w) {
+		score -= problem.Weight
+	}
+	return max(score, 0)
+}
+
+// hasQualityScore reports whether page has content to score: redirect
+// aliases, bodyless and unchanged pages have none.
+func hasQualityScore(page *PageData) bool {
+	return !page.Alias && !page.Bodyless && page.Change != ChangeUnchanged && page.UnfollowedRedirect == ""
+}
+
+// qualityKey groups pages whose title or content hash is compared.
+func qualityKey(language, value string) [2]string {
+	return [2]string{language, value}
+}
+
+// duplicateCounts counts the scored pages per language and trimmed title,
+// and per language and content hash.
+func duplicateCounts(pages []PageData) (titles, contents map[[2]string]int) {
+	titles = make(map[[2]string]int)
+	contents = make(map[[2]string]int)
+	for i := range pages {
+		page := &pages[i]
+		if !hasQualityScore(page) {
+			continue
+		}
+		if title := strings.TrimSpace(page.Title); title != "" {
+			titles[qualityKey(page.Language, title)]++
+		}
+		if page.ContentHash != "" {
+			contents[qualityKey(page.Language, page.ContentHash)]++
+		}
+	}
+	return titles, contents
+}
+
+// simHashGroup is the scored pages of a language sharing a SimHash.
+type simHashGroup struct {
+	language string
+	hash     uint64
+	urls     []string
+	contents map[string]bool
+}
+
+// nearDuplicates returns the scored pages, by language and URL, whose
+// SimHash is at most maxBits bits from that of a page of the same language
+// with another content hash. Hashes that close agree on at least one of
+// maxBits+1 bands, so only hashes sharing a band are compared.
+func nearDuplicates(pages []PageData, maxBits int) map[[2]string]bool {
+	maxBits = min(max(maxBits, 0), MaxNearDuplicateBits)
+	groups := make(map[[2]string]*simHashGroup)
+	var order []*simHashGroup
+	for i := range pages {
+		page := &pages[i]
+		if !hasQualityScore(page) || page.ContentSimHash == "" {
+			continue
+		}
+		hash, err := strconv.ParseUint(page.ContentSimHash, 16, 64)
+		if err != nil {
+			continue
+		}
+		key := qualityKey(page.Language, page.ContentSimHash)
+		g := groups[key]
+		if g == nil {
+			g = &simHashGroup{language: page.Language, hash: hash, contents: make(map[string]bool)}
+			groups[key] = g
+			order = append(order, g)
+		}
+		g.urls = append(g.urls, page.URL)
+		g.contents[page.ContentHash] = true
+	}
+
+	near := make(map[[2]string]bool)
+	mark := func(g *simHashGroup) {
+		for _, pageURL := range g.urls {
+			near[qualityKey(g.language, pageURL)] = true
+		}
+	}
+	type bandKey struct {
+		language    string
+		band        int
+		value, mask uint64
+	}
+	bands := maxBits + 1
+	buckets := make(map[bandKey][]*simHashGroup)
+	for _, g := range order {
+		// Texts that only differ in case or spacing share the hash.
+		if len(g.contents) > 1 {
+			mark(g)
+		}
+		for band := range bands {
+			low, high := 64*band/bands, 64*(band+1)/bands
+			mask := ^uint64(0) >> (64 - (high - low)) << low
+			key := bandKey{language: g.language, band: band, value: g.hash & mask, mask: mask}
+			for _, other := range buckets[key] {
+				if bits.OnesCount64(g.hash^other.hash) <= maxBits {
+					mark(g)
+					mark(other)
+				}
+			}
+			buckets[key] = append(buckets[key], g)
+		}
+	}
+	return near
+}
+
+// qualitySignals computes the QualitySignals of pages that are compared
+// with each other.
+type qualitySignals struct {
+	titles, contents map[[2]string]int
+	near             map[[2]string]bool
+	minPages         int
+}
+
+func newQualitySignals(pages []PageData, w QualityWeights) *qualitySignals {
+	titles, contents := duplicateCounts(pages)
+	s := &qualitySignals{titles: titles, contents: contents, minPages: max(w.DuplicatePages, 2)}
+	if w.NearDuplicateContent > 0 {
+		s.near = nearDuplicates(pages, w.NearDuplicateBits)
+	}
+	return s
+}
+
+func (s *qualitySignals) of(page *PageData) QualitySignals {
+	title := strings.TrimSpace(page.Title)
+	return QualitySignals{
+		DuplicateTitle:       title != "" && s.titles[qualityKey(page.Language, title)] >= s.minPages,
+		DuplicateContent:     page.ContentHash != "" && s.contents[qualityKey(page.Language, page.ContentHash)] >= s.minPages,
+		NearDuplicateContent: s.near[qualityKey(page.Language, page.URL)],
+	}
+}
+
+// scoreQuality sets QualityScore on the stored pages. pages are the page
+// summaries, in stored order, which carry titles and content hashes. It
+// must be called with resultLock held.
+func (c *Crawler) scoreQuality(pages []PageData) error {
+	signals := newQualitySignals(pages, c.qualityWeights)
+	return c.eachPage(true, func(page *PageData) {
+		page.QualityScore = nil
+		if !hasQualityScore(page) {
+			return
+		}
+		score := QualityScore(*page, signals.of(page), c.qualityWeights)
+		page.QualityScore = &score
+	})
+}
+
+// QualityPage is a page of a QualitySummary with its problems.
+type QualityPage struct {
+	URL      string           `json:"url"`
+	Score    int              `json:"score"`
+	Problems []QualityProblem `json:"problems,omitempty"`
+}
+
+// QualitySummary is the distribution of the quality scores of a crawl.
+// Buckets[i] counts the scores from 10*i to 10*i+9, the last one 90 to
+// 100. Bottom lists the lowest scoring pages, lowest first.
+type QualitySummary struct {
+	Pages   int           `json:"pages"`
+	Average float64       `json:"average"`
+	Median  int           `json:"median"`
+	Buckets [10]int       `json:"buckets"`
+	Bottom  []QualityPage `json:"bottom,omitempty"`
+}
+
+// SummarizeQuality summarizes the quality scores of pages, listing the
+// bottom n with the problems found with weights w.
+func SummarizeQuality(pages []PageData, w QualityWeights, n int) QualitySummary {
+	var summary QualitySummary
+	var scored []*PageData
+	total := 0
+	for i := range pages {
+		page := &pages[i]
+		if page.QualityScore == nil {
+			continue
+		}
+		score := *page.QualityScore
+		scored = append(scored, page)
+		total += score
+		summary.Buckets[min(score/10, 9)]++
+	}
+	summary.Pages = len(scored)
+	if len(scored) == 0 {
+		return summary
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		if *scored[i].QualityScore != *scored[j].QualityScore {
+			return *scored[i].QualityScore < *scored[j].QualityScore
+		}
+		return scored[i].URL < scored[j].URL
+	})
+	summary.Average = float64(total) / float64(len(scored))
+	summary.Median = *scored[len(scored)/2].QualityScore
+
+	signals := newQualitySignals(pages, w)
+	for _, page := range scored[:min(n, len(scored))] {
+		summary.Bottom = append(summary.Bottom, QualityPage{
+			URL:      page.URL,
+			Score:    *page.QualityScore,
+			Problems: QualityProblems(*page, signals.of(page), w),
+		})
+	}
+	return summary
+}
+
+// extractQualitySignals reads the meta description, the robots noindex
+// directive and the word count of the body text of doc.
+func extractQualitySignals(doc *goquery.Document) (description string, noindex bool, words int) {
+	doc.Find("meta[name]").Each(func(_ int, s *goquery.Selection) {
+		content, _ := s.Attr("content")
+		switch name, _ := s.Attr("name"); strings.ToLower(strings.TrimSpace(name)) {
+		case "description":
+			if description == "" {
+				description = strings.TrimSpace(content)
+			}
+		case "robots":
+			noindex = noindex || hasNoindex(content)
+		}
+	})
+	words = len(strings.Fields(doc.Find("body").Text()))
+	return description, noindex, words
+}
+
+// hasNoindex reports whether a robots meta tag or X-Robots-Tag header value
+// contains the noindex or none directive.
+func hasNoindex(value string) bool {
+	for _, directive := range strings.FieldsFunc(strings.ToLower(value), func(r rune) bool { return r == ',' || r == ' ' || r == ':' }) {
+		if directive == "noindex" || directive == "none" {
+			return true
+		}
+	}
+	return false
+}
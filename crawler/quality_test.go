@@ -0,0 +1,272 @@
+package crawler
+
+import (
+	"fmt"
+	"math/bits"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// qualityPage is a page without any problem under DefaultQualityWeights.
+func qualityPage() PageData {
+	return PageData{URL: "http://example.com/", Title: "Home", Description: "The home page", WordCount: 300, ResponseTime: 200, Size: 10_000}
+}
+
+func TestQualityProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		edit     func(*PageData)
+		signals  QualitySignals
+		problems []string
+		score    int
+	}{
+		{"clean", func(*PageData) {}, QualitySignals{}, nil, 100},
+		{"missing title", func(p *PageData) { p.Title = " \n" }, QualitySignals{}, []string{"missing title"}, 80},
+		{"duplicate title", func(*PageData) {}, QualitySignals{DuplicateTitle: true}, []string{"duplicate title"}, 90},
+		{"missing description", func(p *PageData) { p.Description = "" }, QualitySignals{}, []string{"missing description"}, 90},
+		{"duplicate content", func(*PageData) {}, QualitySignals{DuplicateContent: true}, []string{"duplicate content"}, 85},
+		{"near-duplicate content", func(*PageData) {}, QualitySignals{NearDuplicateContent: true}, []string{"near-duplicate content"}, 90},
+		// A duplicate is close to its near-duplicates too.
+		{"duplicate and near-duplicate", func(*PageData) {}, QualitySignals{DuplicateContent: true, NearDuplicateContent: true}, []string{"duplicate content"}, 85},
+		{"thin content", func(p *PageData) { p.WordCount = 199 }, QualitySignals{}, []string{"thin content"}, 85},
+		{"thin threshold", func(p *PageData) { p.WordCount = 200 }, QualitySignals{}, nil, 100},
+		{"slow", func(p *PageData) { p.ResponseTime = 1001 }, QualitySignals{}, []string{"slow"}, 90},
+		{"slow threshold", func(p *PageData) { p.ResponseTime = 1000 }, QualitySignals{}, nil, 100},
+		{"large", func(p *PageData) { p.Size = 1<<20 + 1 }, QualitySignals{}, []string{"large"}, 95},
+		{"large threshold", func(p *PageData) { p.Size = 1 << 20 }, QualitySignals{}, nil, 100},
+		{"noindex", func(p *PageData) { p.Noindex = true }, QualitySignals{}, []string{"noindex"}, 85},
+		// The description and word count of these pages are unknown.
+		{"malformed", func(p *PageData) { p.MalformedHTML, p.Description, p.WordCount = true, "", 0 }, QualitySignals{}, nil, 100},
+		{"body aborted", func(p *PageData) { p.SlowBodyAborted, p.Description, p.WordCount = true, "", 0 }, QualitySignals{}, nil, 100},
+		{
+			"everything",
+			func(p *PageData) { *p = PageData{ResponseTime: 5000, Size: 2 << 20, Noindex: true} },
+			QualitySignals{DuplicateTitle: true, DuplicateContent: true},
+			[]string{"missing title", "duplicate title", "missing description", "duplicate content", "thin content", "slow", "large", "noindex"},
+			0,
+		},
+	}
+	for _, tt := range tests {
+		page := qualityPage()
+		tt.edit(&page)
+		var names []string
+		for _, problem := range QualityProblems(page, tt.signals, DefaultQualityWeights) {
+			names = append(names, problem.Name)
+		}
+		if !slices.Equal(names, tt.problems) {
+			t.Errorf("%s: problems %q, want %q", tt.name, names, tt.problems)
+		}
+		if score := QualityScore(page, tt.signals, DefaultQualityWeights); score != tt.score {
+			t.Errorf("%s: score %d, want %d", tt.name, score, tt.score)
+		}
+	}
+}
+
+func TestQualityWeights(t *testing.T) {
+	page := qualityPage()
+	page.Title, page.WordCount, page.ResponseTime, page.Size = "", 40, 600, 3000
+
+	w := DefaultQualityWeights
+	w.MissingTitle, w.ThinWords, w.SlowMs, w.LargeBytes, w.Large = 7, 50, 500, 2000, 33
+	want := []QualityProblem{{"missing title", 7}, {"thin content", 15}, {"slow", 10}, {"large", 33}}
+	if problems := QualityProblems(page, QualitySignals{}, w); !reflect.DeepEqual(problems, want) {
+		t.Errorf("problems %+v, want %+v", problems, want)
+	}
+	if score := QualityScore(page, QualitySignals{}, w); score != 35 {
+		t.Errorf("score %d, want 100-7-15-10-33", score)
+	}
+
+	// A weight of 0 turns a check off, and so do thresholds of 0.
+	w.MissingTitle, w.ThinContent, w.SlowMs, w.LargeBytes = 0, 0, 0, 0
+	if problems := QualityProblems(page, QualitySignals{}, w); problems != nil {
+		t.Errorf("problems %+v with the checks off", problems)
+	}
+
+	// Scores never go below 0.
+	w = DefaultQualityWeights
+	w.Noindex = 150
+	page = qualityPage()
+	page.Noindex = true
+	if score := QualityScore(page, QualitySignals{}, w); score != 0 {
+		t.Errorf("score %d with a weight above 100, want 0", score)
+	}
+}
+
+// simHashOf returns the SimHash of a body text.
+func simHashOf(t *testing.T, text string) string {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body><p>" + text + "</p></body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contentSimHash(doc)
+}
+
+// simHashBits returns the number of bits two SimHashes differ in.
+func simHashBits(t *testing.T, a, b string) int {
+	t.Helper()
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bits.OnesCount64(x ^ y)
+}
+
+// articleText returns a text of n words, about topic.
+func articleText(topic string, n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("%s%d", topic, i*7%n)
+	}
+	return strings.Join(words, " ")
+}
+
+func TestContentSimHash(t *testing.T) {
+	article := articleText("lorem", 300)
+	hash := simHashOf(t, article)
+	if len(hash) != 16 {
+		t.Fatalf("SimHash %q, want 16 hex digits", hash)
+	}
+	if other := simHashOf(t, "  "+strings.ToUpper(article)+"\n"); other != hash {
+		t.Errorf("SimHash %q of the text in capitals, want %q", other, hash)
+	}
+	edited := strings.Replace(article, "lorem7 ", "updated on 2026-10-14 ", 1)
+	if n := simHashBits(t, hash, simHashOf(t, edited)); n > DefaultQualityWeights.NearDuplicateBits {
+		t.Errorf("an edited text differs in %d bits, want at most %d", n, DefaultQualityWeights.NearDuplicateBits)
+	}
+	if n := simHashBits(t, hash, simHashOf(t, articleText("ipsum", 300))); n <= DefaultQualityWeights.NearDuplicateBits+8 {
+		t.Errorf("another text differs in only %d bits", n)
+	}
+	// A text shorter than a shingle still has a hash.
+	if short := simHashOf(t, "hello"); short == "" || short == simHashOf(t, "goodbye") {
+		t.Errorf("short texts hash to %q", short)
+	}
+	if empty := simHashOf(t, " "); empty != "" {
+		t.Errorf("SimHash %q of an empty page", empty)
+	}
+	if none := contentSimHash(nil); none != "" {
+		t.Errorf("SimHash %q without a document", none)
+	}
+}
+
+func TestNearDuplicates(t *testing.T) {
+	page := func(url, language, content, simHash string) PageData {
+		return PageData{URL: "http://example.com/" + url, Language: language, ContentHash: content, ContentSimHash: simHash}
+	}
+	pages := []PageData{
+		page("a", "", "1", "0000000000000000"),
+		// 3 bits from a, one in each of three of the four bands.
+		page("b", "", "2", "0000800080008000"),
+		// 4 bits from a.
+		page("c", "", "3", "000000000000000f"),
+		// The same text as a, in another language.
+		page("en-a", "en", "1", "0000000000000000"),
+		page("en-b", "en", "4", "0000000000000ff0"),
+		// Texts that only differ in case share their SimHash.
+		page("d", "", "5", "ffffffffffffffff"),
+		page("e", "", "6", "ffffffffffffffff"),
+		// Exact duplicates are not near-duplicates of each other.
+		page("f", "", "7", "1234123412341234"),
+		page("g", "", "7", "1234123412341234"),
+		page("bad", "", "8", "not hex"),
+		page("none", "", "9", ""),
+	}
+	alias := page("alias", "", "10", "0000000000000001")
+	alias.Alias = true
+	pages = append(pages, alias)
+
+	tests := []struct {
+		bits int
+		want []string
+	}{
+		{3, []string{"a", "b", "d", "e"}},
+		{4, []string{"a", "b", "c", "d", "e"}},
+		// Bits above the maximum count as the maximum.
+		{8, []string{"a", "b", "c", "d", "e"}},
+		{0, []string{"d", "e"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for key := range nearDuplicates(pages, tt.bits) {
+			got = append(got, strings.TrimPrefix(key[1], "http://example.com/"))
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("within %d bits: near-duplicates %q, want %q", tt.bits, got, tt.want)
+		}
+	}
+
+	w := DefaultQualityWeights
+	if s := newQualitySignals(pages, w).of(&pages[1]); !s.NearDuplicateContent || s.DuplicateContent {
+		t.Errorf("signals %+v of b", s)
+	}
+	if s := newQualitySignals(pages, w).of(&pages[7]); s.NearDuplicateContent || !s.DuplicateContent {
+		t.Errorf("signals %+v of f", s)
+	}
+	w.NearDuplicateContent = 0
+	if s := newQualitySignals(pages, w).of(&pages[1]); s.NearDuplicateContent {
+		t.Errorf("signals %+v of b with the check off", s)
+	}
+}
+
+func TestSummarizeQuality(t *testing.T) {
+	if summary := SummarizeQuality([]PageData{{URL: "http://example.com/"}}, DefaultQualityWeights, 10); !reflect.DeepEqual(summary, QualitySummary{}) {
+		t.Errorf("summary %+v without scores", summary)
+	}
+
+	score := func(n int) *int { return &n }
+	pages := []PageData{
+		{URL: "http://example.com/a", Title: "Same", Description: "a", WordCount: 300, QualityScore: score(90)},
+		{URL: "http://example.com/b", Title: "Same", Description: "b", WordCount: 300, QualityScore: score(90)},
+		{URL: "http://example.com/c", Title: "C", WordCount: 300, QualityScore: score(90)},
+		{URL: "http://example.com/d", Title: "D", Description: "d", WordCount: 10, QualityScore: score(85)},
+		{URL: "http://example.com/e", Title: "E", Description: "e", WordCount: 300, QualityScore: score(100)},
+		{URL: "http://example.com/alias", Alias: true},
+	}
+	summary := SummarizeQuality(pages, DefaultQualityWeights, 3)
+	want := QualitySummary{
+		Pages:   5,
+		Average: 91,
+		Median:  90,
+		Buckets: [10]int{8: 1, 9: 4},
+		Bottom: []QualityPage{
+			{URL: "http://example.com/d", Score: 85, Problems: []QualityProblem{{"thin content", 15}}},
+			{URL: "http://example.com/a", Score: 90, Problems: []QualityProblem{{"duplicate title", 10}}},
+			{URL: "http://example.com/b", Score: 90, Problems: []QualityProblem{{"duplicate title", 10}}},
+		},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("summary %+v, want %+v", summary, want)
+	}
+}
+
+// TestCrawlQuality checks the quality scores of a crawl, with a page
+// republished under another URL with a date added.
+func TestCrawlQuality(t *testing.T) {
+	article := articleText("lorem", 300)
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/": htmlPage(`<title>Home</title><meta name="description" content="home">
+			<a href="/post">post</a> <a href="/copy">copy</a> <a href="/thin">thin</a> ` + articleText("ipsum", 300)),
+		"/post": htmlPage(`<title>Post</title><meta name="description" content="post">` + article),
+		"/copy": htmlPage(`<title>Copy</title><meta name="description" content="copy">` + article + " updated on 2026-10-14"),
+		"/thin": htmlPage(`<title>Thin</title><meta name="description" content="thin"><meta name="robots" content="noindex">a few words`),
+	})
+	result := crawlTestSite(t, site.URL, 1)
+	want := map[string]int{"/": 100, "/post": 90, "/copy": 90, "/thin": 70}
+	for path, score := range want {
+		page := findPage(result, site.URL, path)
+		if page == nil || page.QualityScore == nil || *page.QualityScore != score || page.ContentSimHash == "" {
+			t.Errorf("%s: %+v, want score %d and a SimHash", path, page, score)
+		}
+	}
+}
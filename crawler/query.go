@@ -0,0 +1,418 @@
+package crawler
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResultRow is a URL of a crawl as QueryResults returns it: a stored page,
+// or a URL that failed, which has a Category and an Error but no Title.
+type ResultRow struct {
+	URL          string `json:"url"`
+	StatusCode   int    `json:"status_code,omitempty"`
+	Depth        int    `json:"depth"`
+	Title        string `json:"title,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	ResponseTime int64  `json:"response_time_ms,omitempty"`
+	Category     string `json:"category,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ResultFilter is a condition on the rows of QueryResults, as parsed by
+// ParseResultFilter.
+type ResultFilter struct {
+	Field string
+	Op    string
+	Value string
+
+	number int64
+}
+
+// resultFields maps the fields of filters and of the order of a ResultQuery
+// to whether they are numeric.
+var resultFields = map[string]bool{
+	"status":   true,
+	"depth":    true,
+	"size":     true,
+	"time":     true,
+	"url":      false,
+	"path":     false,
+	"title":    false,
+	"category": false,
+}
+
+// ParseResultFilter parses a filter of QueryResults such as status>=400,
+// depth<=2, path^=/blog or title~=sale. The numeric fields status, depth,
+// size and time (the response time in milliseconds) take =, !=, <, <=, >
+// and >=. The text fields url, path, title and category take = and !=, ^=
+// for a prefix and ~= for a substring, ignoring case.
+func ParseResultFilter(expr string) (ResultFilter, error) {
+	i := strings.IndexAny(expr, "=!<>^~")
+	if i <= 0 {
+		return ResultFilter{}, fmt.Errorf("filter %q is not a field, an operator and a value", expr)
+	}
+	field := strings.ToLower(strings.TrimSpace(expr[:i]))
+	rest := expr[i:]
+	var op string
+	for _, candidate := range []string{"!=", "<=", ">=", "^=", "~=", "=", "<", ">"} {
+		if strings.HasPrefix(rest, candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return ResultFilter{}, fmt.Errorf("filter %q has no valid operator", expr)
+	}
+	filter := ResultFilter{Field: field, Op: op, Value: strings.TrimSpace(rest[len(op):])}
+	numeric, ok := resultFields[field]
+	switch {
+	case !ok:
+		return ResultFilter{}, fmt.Errorf("filter %q: unknown field %q", expr, field)
+	case numeric:
+		if op == "^=" || op == "~=" {
+			return ResultFilter{}, fmt.Errorf("filter %q: %s does not apply to the number %s", expr, op, field)
+		}
+		n, err := strconv.ParseInt(filter.Value, 10, 64)
+		if err != nil {
+			return ResultFilter{}, fmt.Errorf("filter %q: %s takes an integer", expr, field)
+		}
+		filter.number = n
+	default:
+		if op == "<" || op == "<=" || op == ">" || op == ">=" {
+			return ResultFilter{}, fmt.Errorf("filter %q: %s does not apply to the text %s", expr, op, field)
+		}
+		if op == "~=" {
+			filter.Value = strings.ToLower(filter.Value)
+		}
+	}
+	return filter, nil
+}
+
+// match reports whether row passes the filter.
+func (f ResultFilter) match(row *ResultRow) bool {
+	switch f.Field {
+	case "status":
+		return compareInt(int64(row.StatusCode), f.Op, f.number)
+	case "depth":
+		return compareInt(int64(row.Depth), f.Op, f.number)
+	case "size":
+		return compareInt(row.Size, f.Op, f.number)
+	case "time":
+		return compareInt(row.ResponseTime, f.Op, f.number)
+	}
+	var text string
+	switch f.Field {
+	case "url":
+		text = row.URL
+	case "path":
+		text = urlPath(row.URL)
+	case "title":
+		text = row.Title
+	case "category":
+		text = row.Category
+	}
+	switch f.Op {
+	case "=":
+		return text == f.Value
+	case "!=":
+		return text != f.Value
+	case "^=":
+		return strings.HasPrefix(text, f.Value)
+	default:
+		return strings.Contains(strings.ToLower(text), f.Value)
+	}
+}
+
+// compareInt applies the comparison op of a numeric filter.
+func compareInt(a int64, op string, b int64) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	default:
+		return a >= b
+	}
+}
+
+// ResultQuery selects a page of the rows of a crawl: those passing every
+// filter, ordered by OrderBy, a field of ParseResultFilter and url when
+// empty, descending when Desc is set; ties are ordered by URL. Offset rows
+// are skipped and Limit rows at most returned, zero being no limit.
+type ResultQuery struct {
+	Filters []ResultFilter
+	OrderBy string
+	Desc    bool
+	Offset  int
+	Limit   int
+}
+
+// ResultSet is a page of the rows of QueryResults. Total counts the rows
+// passing the filters and NextOffset is the Offset of the next page, zero
+// after the last one.
+type ResultSet struct {
+	Total      int         `json:"total"`
+	Offset     int         `json:"offset"`
+	NextOffset int         `json:"next_offset,omitempty"`
+	Rows       []ResultRow `json:"rows"`
+}
+
+// ValidateResultOrder checks the field of ResultQuery.OrderBy.
+func ValidateResultOrder(field string) error {
+	if _, ok := resultFields[field]; !ok && field != "" {
+		return fmt.Errorf("unknown order field %q", field)
+	}
+	return nil
+}
+
+// QueryResults returns the rows of result, its pages then its errors,
+// selected by query.
+func QueryResults(result *CrawlResult, query ResultQuery) (ResultSet, error) {
+	sel, err := newResultSelection(query)
+	if err != nil {
+		return ResultSet{}, err
+	}
+	for i := range result.Pages {
+		sel.add(pageResultRow(&result.Pages[i]))
+	}
+	for i := range result.Errors {
+		sel.add(errorResultRow(&result.Errors[i]))
+	}
+	return sel.resultSet(), nil
+}
+
+// QueryResultsFile is QueryResults over the results saved as JSON in
+// filename. The pages and errors are decoded one at a time and only the
+// rows of the query are kept, so a large crawl is queried without loading
+// it: the memory needed grows with Offset+Limit, or with the rows passing
+// the filters when Limit is zero.
+func QueryResultsFile(filename string, query ResultQuery) (ResultSet, error) {
+	sel, err := newResultSelection(query)
+	if err != nil {
+		return ResultSet{}, err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return ResultSet{}, fmt.Errorf("error opening results: %v", err)
+	}
+	defer file.Close()
+	if err := sel.decode(json.NewDecoder(bufio.NewReader(file))); err != nil {
+		return ResultSet{}, fmt.Errorf("error decoding results: %v", err)
+	}
+	return sel.resultSet(), nil
+}
+
+// selectionSlack is how many rows past Offset+Limit a resultSelection
+// collects before it sorts them and drops those past the page.
+const selectionSlack = 1024
+
+// resultSelection collects the rows passing the filters of a query.
+type resultSelection struct {
+	query ResultQuery
+	order func(a, b *ResultRow) int
+	rows  []ResultRow
+	total int
+}
+
+func newResultSelection(query ResultQuery) (*resultSelection, error) {
+	if err := ValidateResultOrder(query.OrderBy); err != nil {
+		return nil, err
+	}
+	if query.Offset < 0 || query.Limit < 0 {
+		return nil, fmt.Errorf("offset and limit must not be negative")
+	}
+	return &resultSelection{query: query, order: resultOrder(query.OrderBy)}, nil
+}
+
+// add adds row if it passes the filters. Once enough rows are collected
+// past the requested page, only those up to its end are kept.
+func (s *resultSelection) add(row ResultRow) {
+	if !matchAll(s.query.Filters, &row) {
+		return
+	}
+	s.total++
+	s.rows = append(s.rows, row)
+	if keep := s.query.Offset + s.query.Limit; s.query.Limit > 0 && len(s.rows) >= 2*keep+selectionSlack {
+		s.sort()
+		s.rows = slices.Clip(s.rows[:keep])
+	}
+}
+
+// sort orders the rows by the field of the query, then by URL. The sort is
+// stable, so rows of the same URL keep the order they were added in.
+func (s *resultSelection) sort() {
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		a, b := &s.rows[i], &s.rows[j]
+		c := s.order(a, b)
+		if s.query.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+		return a.URL < b.URL
+	})
+}
+
+// resultSet returns the requested page of the rows.
+func (s *resultSelection) resultSet() ResultSet {
+	s.sort()
+	if s.rows == nil {
+		s.rows = []ResultRow{}
+	}
+	set := ResultSet{Total: s.total, Offset: s.query.Offset}
+	start := min(s.query.Offset, len(s.rows))
+	end := len(s.rows)
+	if s.query.Limit > 0 && start+s.query.Limit < s.total {
+		end = start + s.query.Limit
+		set.NextOffset = end
+	}
+	set.Rows = s.rows[start:end]
+	return set
+}
+
+// decode adds the pages and then the errors of the CrawlResult that dec
+// reads, skipping its other fields.
+func (s *resultSelection) decode(dec *json.Decoder) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	var errs []CrawlError
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case "pages":
+			err = decodeArray(dec, func() error {
+				var page PageData
+				if err := dec.Decode(&page); err != nil {
+					return err
+				}
+				s.add(pageResultRow(&page))
+				return nil
+			})
+		case "errors":
+			// Errors are few; they are added after the pages, as
+			// QueryResults does, wherever the field is.
+			err = dec.Decode(&errs)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+	for i := range errs {
+		s.add(errorResultRow(&errs[i]))
+	}
+	return nil
+}
+
+// decodeArray calls element for each element of the JSON array, or null,
+// that dec reads next.
+func decodeArray(dec *json.Decoder, element func() error) error {
+	token, err := dec.Token()
+	if err != nil || token == nil {
+		return err
+	}
+	if token != json.Delim('[') {
+		return fmt.Errorf("expected an array, got %v", token)
+	}
+	for dec.More() {
+		if err := element(); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// expectDelim reads the delimiter want from dec.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != want {
+		return fmt.Errorf("expected %v, got %v", want, token)
+	}
+	return nil
+}
+
+// pageResultRow is the row of a stored page.
+func pageResultRow(page *PageData) ResultRow {
+	return ResultRow{
+		URL:          page.URL,
+		StatusCode:   page.StatusCode,
+		Depth:        page.Depth,
+		Title:        page.Title,
+		Size:         page.Size,
+		ResponseTime: page.ResponseTime,
+	}
+}
+
+// errorResultRow is the row of a URL that failed.
+func errorResultRow(e *CrawlError) ResultRow {
+	return ResultRow{URL: e.URL, StatusCode: e.StatusCode, Depth: e.Depth, Category: e.Category, Error: e.Error}
+}
+
+// matchAll reports whether row passes every filter.
+func matchAll(filters []ResultFilter, row *ResultRow) bool {
+	for _, f := range filters {
+		if !f.match(row) {
+			return false
+		}
+	}
+	return true
+}
+
+// resultOrder returns the comparison of two rows by field, negative when a
+// comes first.
+func resultOrder(field string) func(a, b *ResultRow) int {
+	switch field {
+	case "status":
+		return func(a, b *ResultRow) int { return cmp.Compare(a.StatusCode, b.StatusCode) }
+	case "depth":
+		return func(a, b *ResultRow) int { return cmp.Compare(a.Depth, b.Depth) }
+	case "size":
+		return func(a, b *ResultRow) int { return cmp.Compare(a.Size, b.Size) }
+	case "time":
+		return func(a, b *ResultRow) int { return cmp.Compare(a.ResponseTime, b.ResponseTime) }
+	case "path":
+		return func(a, b *ResultRow) int { return strings.Compare(urlPath(a.URL), urlPath(b.URL)) }
+	case "title":
+		return func(a, b *ResultRow) int { return strings.Compare(a.Title, b.Title) }
+	case "category":
+		return func(a, b *ResultRow) int { return strings.Compare(a.Category, b.Category) }
+	default:
+		return func(a, b *ResultRow) int { return strings.Compare(a.URL, b.URL) }
+	}
+}
+
+// urlPath returns the path of raw, empty when it does not parse.
+func urlPath(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
@@ -0,0 +1,382 @@
+package crawler
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// queryResult has pages and errors with ties on every field.
+var queryResult = &CrawlResult{
+	Pages: []PageData{
+		{URL: "http://example.com/", StatusCode: 200, Depth: 0, Title: "Home", Size: 3000, ResponseTime: 40},
+		{URL: "http://example.com/blog/sale", StatusCode: 200, Depth: 1, Title: "Summer SALE", Size: 1200, ResponseTime: 90},
+		{URL: "http://example.com/blog/news", StatusCode: 200, Depth: 1, Title: "News", Size: 1200, ResponseTime: 40},
+		{URL: "http://example.com/old", StatusCode: 301, Depth: 1, Title: "", Size: 0, ResponseTime: 10},
+		{URL: "http://example.com/blog/archive/2020", StatusCode: 200, Depth: 2, Title: "Archive", Size: 800, ResponseTime: 250},
+	},
+	Errors: []CrawlError{
+		{URL: "http://example.com/gone", StatusCode: 404, Depth: 1, Category: CategoryHTTPStatus, Error: "not found"},
+		{URL: "http://example.com/broken", StatusCode: 500, Depth: 2, Category: CategoryHTTPStatus, Error: "server error"},
+		{URL: "http://example.com/slow", Depth: 2, Category: CategoryTimeout, Error: "timeout"},
+	},
+}
+
+// paths returns the paths of the rows of set.
+func paths(set ResultSet) []string {
+	var out []string
+	for _, row := range set.Rows {
+		out = append(out, urlPath(row.URL))
+	}
+	return out
+}
+
+func TestParseResultFilter(t *testing.T) {
+	tests := []struct {
+		expr  string
+		field string
+		op    string
+		value string
+	}{
+		{"status>=400", "status", ">=", "400"},
+		{"status=200", "status", "=", "200"},
+		{"status!=200", "status", "!=", "200"},
+		{"depth<2", "depth", "<", "2"},
+		{"depth<=2", "depth", "<=", "2"},
+		{"size>1000", "size", ">", "1000"},
+		{"time >= 100", "time", ">=", "100"},
+		{"Status>=-1", "status", ">=", "-1"},
+		{"url=http://example.com/", "url", "=", "http://example.com/"},
+		{"url!=http://example.com/a=b", "url", "!=", "http://example.com/a=b"},
+		{"path^=/blog", "path", "^=", "/blog"},
+		{"title~=Sale", "title", "~=", "sale"},
+		{"title=", "title", "=", ""},
+		{"category=timeout", "category", "=", "timeout"},
+	}
+	for _, tt := range tests {
+		f, err := ParseResultFilter(tt.expr)
+		if err != nil {
+			t.Errorf("ParseResultFilter(%q): %v", tt.expr, err)
+			continue
+		}
+		if f.Field != tt.field || f.Op != tt.op || f.Value != tt.value {
+			t.Errorf("ParseResultFilter(%q) = %s %s %q, want %s %s %q", tt.expr, f.Field, f.Op, f.Value, tt.field, tt.op, tt.value)
+		}
+	}
+
+	for _, expr := range []string{
+		"",
+		"status",
+		"=200",
+		">=4",
+		"status~=4",
+		"status^=4",
+		"depth>=abc",
+		"depth>=",
+		"depth=1.5",
+		"size=99999999999999999999",
+		"title<b",
+		"path>=/a",
+		"url<=x",
+		"colour=red",
+		"status=>4",
+		"status!4",
+	} {
+		if f, err := ParseResultFilter(expr); err == nil {
+			t.Errorf("ParseResultFilter(%q) = %+v, want an error", expr, f)
+		}
+	}
+}
+
+func TestQueryResultsFilters(t *testing.T) {
+	tests := []struct {
+		filters []string
+		want    []string
+	}{
+		{nil, []string{"/", "/blog/archive/2020", "/blog/news", "/blog/sale", "/broken", "/gone", "/old", "/slow"}},
+		{[]string{"status=200"}, []string{"/", "/blog/archive/2020", "/blog/news", "/blog/sale"}},
+		{[]string{"status!=200"}, []string{"/broken", "/gone", "/old", "/slow"}},
+		{[]string{"status>=400"}, []string{"/broken", "/gone"}},
+		{[]string{"status>404"}, []string{"/broken"}},
+		{[]string{"status<200"}, []string{"/slow"}},
+		{[]string{"status<=301", "status>0"}, []string{"/", "/blog/archive/2020", "/blog/news", "/blog/sale", "/old"}},
+		{[]string{"depth=0"}, []string{"/"}},
+		{[]string{"depth>=2"}, []string{"/blog/archive/2020", "/broken", "/slow"}},
+		{[]string{"size>1000"}, []string{"/", "/blog/news", "/blog/sale"}},
+		{[]string{"size=1200"}, []string{"/blog/news", "/blog/sale"}},
+		{[]string{"time<50"}, []string{"/", "/blog/news", "/broken", "/gone", "/old", "/slow"}},
+		{[]string{"time>=250"}, []string{"/blog/archive/2020"}},
+		{[]string{"url=http://example.com/old"}, []string{"/old"}},
+		{[]string{"url!=http://example.com/old", "status=301"}, nil},
+		{[]string{"url^=http://example.com/b"}, []string{"/blog/archive/2020", "/blog/news", "/blog/sale", "/broken"}},
+		{[]string{"url~=ARCHIVE"}, []string{"/blog/archive/2020"}},
+		{[]string{"path=/"}, []string{"/"}},
+		{[]string{"path!=/", "depth=1"}, []string{"/blog/news", "/blog/sale", "/gone", "/old"}},
+		{[]string{"path^=/blog/"}, []string{"/blog/archive/2020", "/blog/news", "/blog/sale"}},
+		// A prefix is matched with its case, a substring without.
+		{[]string{"path^=/Blog"}, nil},
+		{[]string{"path~=/Blog/A"}, []string{"/blog/archive/2020"}},
+		{[]string{"title~=sale"}, []string{"/blog/sale"}},
+		{[]string{"title=News"}, []string{"/blog/news"}},
+		{[]string{"title=news"}, nil},
+		{[]string{"title^=Sum"}, []string{"/blog/sale"}},
+		{[]string{"title="}, []string{"/broken", "/gone", "/old", "/slow"}},
+		{[]string{"category=timeout"}, []string{"/slow"}},
+		{[]string{"category!="}, []string{"/broken", "/gone", "/slow"}},
+		{[]string{"category~=HTTP", "status>=500"}, []string{"/broken"}},
+	}
+	for _, tt := range tests {
+		var query ResultQuery
+		for _, expr := range tt.filters {
+			f, err := ParseResultFilter(expr)
+			if err != nil {
+				t.Fatalf("ParseResultFilter(%q): %v", expr, err)
+			}
+			query.Filters = append(query.Filters, f)
+		}
+		set, err := QueryResults(queryResult, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := paths(set); !slices.Equal(got, tt.want) || set.Total != len(tt.want) {
+			t.Errorf("filters %q: got %q (total %d), want %q", tt.filters, got, set.Total, tt.want)
+		}
+	}
+}
+
+func TestQueryResultsOrder(t *testing.T) {
+	tests := []struct {
+		orderBy string
+		desc    bool
+		want    []string
+	}{
+		{"", false, []string{"/", "/blog/archive/2020", "/blog/news", "/blog/sale", "/broken", "/gone", "/old", "/slow"}},
+		{"url", true, []string{"/slow", "/old", "/gone", "/broken", "/blog/sale", "/blog/news", "/blog/archive/2020", "/"}},
+		// Ties are ordered by URL, ascending also in a descending order.
+		{"status", false, []string{"/slow", "/", "/blog/archive/2020", "/blog/news", "/blog/sale", "/old", "/gone", "/broken"}},
+		{"status", true, []string{"/broken", "/gone", "/old", "/", "/blog/archive/2020", "/blog/news", "/blog/sale", "/slow"}},
+		{"depth", false, []string{"/", "/blog/news", "/blog/sale", "/gone", "/old", "/blog/archive/2020", "/broken", "/slow"}},
+		{"size", true, []string{"/", "/blog/news", "/blog/sale", "/blog/archive/2020", "/broken", "/gone", "/old", "/slow"}},
+		{"time", false, []string{"/broken", "/gone", "/slow", "/old", "/", "/blog/news", "/blog/sale", "/blog/archive/2020"}},
+		{"path", false, []string{"/", "/blog/archive/2020", "/blog/news", "/blog/sale", "/broken", "/gone", "/old", "/slow"}},
+		{"title", false, []string{"/broken", "/gone", "/old", "/slow", "/blog/archive/2020", "/", "/blog/news", "/blog/sale"}},
+		{"category", true, []string{"/slow", "/broken", "/gone", "/", "/blog/archive/2020", "/blog/news", "/blog/sale", "/old"}},
+	}
+	for _, tt := range tests {
+		set, err := QueryResults(queryResult, ResultQuery{OrderBy: tt.orderBy, Desc: tt.desc})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := paths(set); !slices.Equal(got, tt.want) {
+			t.Errorf("order by %q (desc %t): got %q, want %q", tt.orderBy, tt.desc, got, tt.want)
+		}
+	}
+
+	if _, err := QueryResults(queryResult, ResultQuery{OrderBy: "colour"}); err == nil {
+		t.Error("an unknown order field gave no error")
+	}
+	if err := ValidateResultOrder(""); err != nil {
+		t.Errorf("the default order is rejected: %v", err)
+	}
+}
+
+func TestQueryResultsPaging(t *testing.T) {
+	all := []string{"/", "/blog/archive/2020", "/blog/news", "/blog/sale", "/broken", "/gone", "/old", "/slow"}
+	tests := []struct {
+		offset, limit int
+		want          []string
+		next          int
+	}{
+		{0, 0, all, 0},
+		{0, 3, all[:3], 3},
+		{3, 3, all[3:6], 6},
+		{6, 3, all[6:], 0},
+		{5, 3, all[5:], 0},
+		{0, 8, all, 0},
+		{0, 100, all, 0},
+		{2, 0, all[2:], 0},
+		{8, 3, nil, 0},
+		{100, 3, nil, 0},
+	}
+	for _, tt := range tests {
+		set, err := QueryResults(queryResult, ResultQuery{Offset: tt.offset, Limit: tt.limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := paths(set); !slices.Equal(got, tt.want) || set.NextOffset != tt.next || set.Total != len(all) || set.Offset != tt.offset {
+			t.Errorf("offset %d, limit %d: got %q, next %d, total %d, offset %d; want %q, next %d",
+				tt.offset, tt.limit, got, set.NextOffset, set.Total, set.Offset, tt.want, tt.next)
+		}
+		if set.Rows == nil {
+			t.Errorf("offset %d, limit %d: rows are nil, which encodes as null", tt.offset, tt.limit)
+		}
+	}
+
+	// Walking the pages gives every row once in the order of the query.
+	var walked []string
+	for offset := 0; ; {
+		set, err := QueryResults(queryResult, ResultQuery{OrderBy: "size", Offset: offset, Limit: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		walked = append(walked, paths(set)...)
+		if set.NextOffset == 0 {
+			break
+		}
+		offset = set.NextOffset
+	}
+	whole, _ := QueryResults(queryResult, ResultQuery{OrderBy: "size"})
+	if !slices.Equal(walked, paths(whole)) {
+		t.Errorf("paging gave %q, the whole query %q", walked, paths(whole))
+	}
+
+	for _, query := range []ResultQuery{{Offset: -1}, {Limit: -1}} {
+		if _, err := QueryResults(queryResult, query); err == nil {
+			t.Errorf("query %+v gave no error", query)
+		}
+	}
+}
+
+// TestQueryResultsKeepsResult checks that a query leaves the result as it
+// is, so that it can run again.
+func TestQueryResultsKeepsResult(t *testing.T) {
+	before := paths(mustQuery(t, ResultQuery{}))
+	mustQuery(t, ResultQuery{OrderBy: "time", Desc: true, Limit: 2})
+	if after := paths(mustQuery(t, ResultQuery{})); !slices.Equal(before, after) {
+		t.Errorf("rows changed from %q to %q", before, after)
+	}
+}
+
+func mustQuery(t *testing.T, query ResultQuery) ResultSet {
+	t.Helper()
+	set, err := QueryResults(queryResult, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+// TestQueryResultsFile saves results, the pages of a crawl and many
+// generated ones, and checks that querying the file gives the rows of
+// querying the results loaded in memory.
+func TestQueryResultsFile(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/":          htmlPage(`<a href="/blog/sale">sale</a> <a href="/blog/news">news</a> <a href="/old">old</a> <a href="/gone">gone</a>`),
+		"/blog/sale": htmlPage(`Summer sale <a href="/blog/archive">archive</a>`),
+		"/blog/news": htmlPage("news"),
+		"/old":       redirect("/blog/news"),
+	})
+	crawled := filepath.Join(t.TempDir(), "crawl_results.json")
+	crawlTestSite(t, site.URL, 2, WithOutputPath(crawled))
+	generated := filepath.Join(t.TempDir(), "generated.json")
+	result := generatedResult(5000)
+	result.Errors = append(result.Errors, CrawlError{URL: "http://example.com/p/1?q=<&>", Depth: 1, Category: CategoryTimeout, Error: "timeout"})
+	if err := SaveResults(generated, result); err != nil {
+		t.Fatal(err)
+	}
+
+	queries := []struct {
+		filters []string
+		query   ResultQuery
+	}{
+		{nil, ResultQuery{}},
+		{[]string{"status>=400"}, ResultQuery{}},
+		{[]string{"depth<=1", "path^=/blog"}, ResultQuery{OrderBy: "title"}},
+		{[]string{"title~=sale"}, ResultQuery{Limit: 1}},
+		{nil, ResultQuery{OrderBy: "status", Desc: true, Limit: 2, Offset: 1}},
+		// Pages of the generated results past the rows kept at first.
+		{nil, ResultQuery{OrderBy: "time", Desc: true, Limit: 10, Offset: 20}},
+		{nil, ResultQuery{OrderBy: "depth", Limit: 7, Offset: 4990}},
+		{[]string{"depth=2"}, ResultQuery{OrderBy: "title", Limit: 100, Offset: 100}},
+		{nil, ResultQuery{Offset: 6000, Limit: 10}},
+		{[]string{"category=timeout"}, ResultQuery{}},
+	}
+	for _, filename := range []string{crawled, generated} {
+		loaded, err := LoadResults(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range queries {
+			query := tt.query
+			query.Filters = mustFilters(t, tt.filters...).Filters
+			// The whole query, which keeps every row, cut to the page.
+			whole := query
+			whole.Offset, whole.Limit = 0, 0
+			want, err := QueryResults(loaded, whole)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want.Offset, want.Rows = query.Offset, want.Rows[min(query.Offset, len(want.Rows)):]
+			if query.Limit > 0 && query.Limit < len(want.Rows) {
+				want.Rows, want.NextOffset = want.Rows[:query.Limit], query.Offset+query.Limit
+			}
+			got, err := QueryResultsFile(filename, query)
+			if err != nil {
+				t.Fatalf("%s: %v", filepath.Base(filename), err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s, filters %q, query %+v: got %+v, want %+v", filepath.Base(filename), tt.filters, tt.query, got, want)
+			}
+		}
+	}
+
+	// The crawl gives the rows expected of the site.
+	set, err := QueryResultsFile(crawled, mustFilters(t, "status>=400"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(set); !slices.Equal(got, []string{"/blog/archive", "/gone"}) || set.Rows[0].Category != CategoryHTTPStatus {
+		t.Errorf("failed URLs %q, %+v; want /blog/archive and /gone", got, set.Rows)
+	}
+	if set, err = QueryResultsFile(crawled, mustFilters(t, "title~=SALE")); err != nil || len(set.Rows) != 1 || set.Rows[0].Title != "/blog/sale" {
+		t.Errorf("pages with sale in the title: %+v, %v", set.Rows, err)
+	}
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"array.json":     `[]`,
+		"truncated.json": `{"pages": [{"url": "http://example.com/"}`,
+		"pages.json":     `{"pages": {}}`,
+		"page.json":      `{"pages": [{"status_code": "200"}]}`,
+	} {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := QueryResultsFile(filename, ResultQuery{}); err == nil || !strings.Contains(err.Error(), "error decoding results") {
+			t.Errorf("%s: %v, want a decoding error", name, err)
+		}
+	}
+	if _, err := QueryResultsFile(filepath.Join(dir, "missing.json"), ResultQuery{}); err == nil {
+		t.Error("querying a missing file gave no error")
+	}
+	if _, err := QueryResultsFile(crawled, ResultQuery{Limit: -1}); err == nil {
+		t.Error("a negative limit gave no error")
+	}
+	// Results without pages have no rows.
+	empty := filepath.Join(dir, "empty.json")
+	if err := os.WriteFile(empty, []byte(`{"pages": null, "total_pages": 0}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if set, err := QueryResultsFile(empty, ResultQuery{}); err != nil || set.Total != 0 || set.Rows == nil {
+		t.Errorf("results without pages: %+v, %v", set, err)
+	}
+}
+
+// mustFilters is a query of the filters exprs.
+func mustFilters(t *testing.T, exprs ...string) ResultQuery {
+	t.Helper()
+	var query ResultQuery
+	for _, expr := range exprs {
+		f, err := ParseResultFilter(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query.Filters = append(query.Filters, f)
+	}
+	return query
+}
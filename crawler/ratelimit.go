@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+const (
+	// UnlimitedRPS as the requests per second of NewCrawler turns rate
+	// limiting off. At most UnlimitedMaxInFlight page, sitemap and asset
+	// requests are then in flight at once, which is what bounds the load.
+	UnlimitedRPS = 0
+	// UnlimitedMaxInFlight bounds the requests in flight of a crawl
+	// without rate limiting.
+	UnlimitedMaxInFlight = 16
+
+	// unlimitedThrottleInterval is the interval a crawl without rate
+	// limiting slows down to when the site throttles it, doubled from
+	// there like a rate limited one.
+	unlimitedThrottleInterval = 100 * time.Millisecond
+)
+
+// ValidRPS reports whether requestsPerSecond is a rate NewCrawler accepts:
+// positive, or UnlimitedRPS.
+func ValidRPS(requestsPerSecond float64) error {
+	switch {
+	case math.IsNaN(requestsPerSecond):
+		return fmt.Errorf("must be a number, not NaN")
+	case requestsPerSecond < 0:
+		return fmt.Errorf("must not be negative; use %d or unlimited to turn rate limiting off", UnlimitedRPS)
+	}
+	return nil
+}
+
+// isUnlimitedRate reports whether requestsPerSecond turns rate limiting
+// off: UnlimitedRPS, or a rate so high that requests would be spaced by
+// less than a nanosecond, infinity included.
+func isUnlimitedRate(requestsPerSecond float64) bool {
+	return requestsPerSecond == UnlimitedRPS || float64(time.Second)/requestsPerSecond < 1
+}
+
+// inFlightSlots bounds the requests of a crawl without rate limiting to
+// UnlimitedMaxInFlight at once. A request holds its slot until its
+// response body is closed.
+func (c *Crawler) inFlightSlots(next Fetcher) Fetcher {
+	slots := make(chan struct{}, UnlimitedMaxInFlight)
+	return fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		select {
+		case slots <- struct{}{}:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		done := func() { <-slots }
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			done()
+			return nil, err
+		}
+		resp.Body = &releasingBody{ReadCloser: resp.Body, done: done}
+		return resp, nil
+	})
+}
+
+// logRateLimit warns when the crawl is not rate limited, which is only
+// worth a note when it replays recordings.
+func (c *Crawler) logRateLimit() {
+	switch {
+	case c.playback:
+		c.logf("Playback: rate limiting is off\n")
+	case c.requestsPerSecond == UnlimitedRPS:
+		c.logf("Warning: rate limiting is off; up to %d requests are sent at once, as fast as %s answers\n",
+			UnlimitedMaxInFlight, c.baseURL.Host)
+	}
+}
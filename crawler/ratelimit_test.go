@@ -0,0 +1,49 @@
+package crawler
+
+import (
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValidRPS(t *testing.T) {
+	for _, rps := range []float64{UnlimitedRPS, 0.5, 2, 1e12, math.Inf(1)} {
+		if err := ValidRPS(rps); err != nil {
+			t.Errorf("ValidRPS(%v) = %v, want it accepted", rps, err)
+		}
+	}
+	tests := []struct {
+		rps  float64
+		want string
+	}{
+		{-1, "must not be negative"},
+		{-0.1, "must not be negative"},
+		{math.Inf(-1), "must not be negative"},
+		{math.NaN(), "not NaN"},
+	}
+	for _, tt := range tests {
+		if err := ValidRPS(tt.rps); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ValidRPS(%v) = %v, want %q", tt.rps, err, tt.want)
+		}
+	}
+}
+
+// TestNewCrawlerRPS checks the rates NewCrawler refuses, and that rates too
+// high to space requests turn rate limiting off.
+func TestNewCrawlerRPS(t *testing.T) {
+	for _, rps := range []float64{-1, math.NaN()} {
+		if _, err := NewCrawler("http://example.com", 1, rps, WithLogOutput(io.Discard)); err == nil || !strings.Contains(err.Error(), "invalid requests per second") {
+			t.Errorf("NewCrawler with %v requests per second: %v, want it refused", rps, err)
+		}
+	}
+	for rps, want := range map[float64]float64{UnlimitedRPS: UnlimitedRPS, 2: 2, 2e9: UnlimitedRPS, math.Inf(1): UnlimitedRPS} {
+		c, err := NewCrawler("http://example.com", 1, rps, WithLogOutput(io.Discard))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.requestsPerSecond != want {
+			t.Errorf("NewCrawler with %v requests per second crawls at %v, want %v", rps, c.requestsPerSecond, want)
+		}
+	}
+}
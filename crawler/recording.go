@@ -0,0 +1,166 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Recordings are stored one exchange per pair of files in a flat directory:
+//
+//	<key>.json  {"method", "url", "status_code", "header"}
+//	<key>.body  the response body, as received after transfer decoding
+//
+// where key is the first 16 hex digits of the SHA-256 of "METHOD URL".
+// Volatile and sensitive headers (see scrubbedHeaders) are not stored, so
+// recording the same site twice produces identical files.
+
+// ErrNotRecorded is returned in playback mode for a request that has no
+// recording.
+var ErrNotRecorded = errors.New("no recording for request")
+
+// scrubbedHeaders are dropped from recorded responses.
+var scrubbedHeaders = []string{
+	"Set-Cookie", "Authorization", "Proxy-Authenticate", "Www-Authenticate", "Date", "Age",
+}
+
+type recordedExchange struct {
+	Method     string              `json:"method"`
+	URL        string              `json:"url"`
+	StatusCode int                 `json:"status_code"`
+	Header     map[string][]string `json:"header"`
+}
+
+func recordingKey(method, rawURL string) string {
+	sum := sha256.Sum256([]byte(method + " " + rawURL))
+	return hex.EncodeToString(sum[:8])
+}
+
+// WithRecording saves every exchange made by the crawler into dir, for use
+// as test fixtures with WithPlayback.
+func WithRecording(dir string) Option {
+	return func(c *Crawler) {
+		c.recordDir = dir
+		WithFetcherMiddleware(func(next Fetcher) Fetcher {
+			return &recordingFetcher{dir: dir, next: next, logf: c.logf}
+		})(c)
+	}
+}
+
+// WithPlayback serves every request from recordings in dir instead of the
+// network. Requests without a recording fail with ErrNotRecorded. The
+// crawl is not rate limited, whatever rate NewCrawler is given.
+func WithPlayback(dir string) Option {
+	return func(c *Crawler) {
+		c.playback = true
+		WithFetcher(&playbackFetcher{dir: dir})(c)
+	}
+}
+
+// NewPlaybackCrawler returns a crawler that replays the recordings in dir
+// without rate limiting, for tests:
+//
+//	c, err := NewPlaybackCrawler("https://example.com/", 2, "testdata/example")
+func NewPlaybackCrawler(baseURL string, maxDepth int, dir string, opts ...Option) (*Crawler, error) {
+	opts = append([]Option{WithPlayback(dir)}, opts...)
+	return NewCrawler(baseURL, maxDepth, UnlimitedRPS, opts...)
+}
+
+type recordingFetcher struct {
+	dir  string
+	next Fetcher
+	logf func(format string, args ...any)
+}
+
+func (r *recordingFetcher) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := r.save(req, resp, body); err != nil {
+		r.logf("Error recording %s: %v\n", req.URL, err)
+	}
+	return resp, nil
+}
+
+func (r *recordingFetcher) save(req *http.Request, resp *http.Response, body []byte) error {
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+
+	header := resp.Header.Clone()
+	for _, name := range scrubbedHeaders {
+		header.Del(name)
+	}
+	for _, values := range header {
+		sort.Strings(values)
+	}
+	exchange := recordedExchange{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     header,
+	}
+	meta, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	key := recordingKey(req.Method, req.URL.String())
+	if err := os.WriteFile(filepath.Join(r.dir, key+".json"), append(meta, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.dir, key+".body"), body, 0o644)
+}
+
+type playbackFetcher struct {
+	dir string
+}
+
+func (p *playbackFetcher) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := recordingKey(req.Method, req.URL.String())
+	meta, err := os.ReadFile(filepath.Join(p.dir, key+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, req.Method, req.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var exchange recordedExchange
+	if err := json.Unmarshal(meta, &exchange); err != nil {
+		return nil, fmt.Errorf("invalid recording %s.json: %v", key, err)
+	}
+	body, err := os.ReadFile(filepath.Join(p.dir, key+".body"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.StatusCode, http.StatusText(exchange.StatusCode)),
+		StatusCode:    exchange.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(exchange.Header),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
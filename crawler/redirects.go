@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// maxRedirects matches the limit of the default http.Client policy. It
+// bounds the HTTP redirects and meta refreshes of a page together.
+const maxRedirects = 10
+
+var (
+	// ErrRedirectLoop reports a redirect chain coming back to one of its
+	// own URLs, through HTTP redirects, meta refreshes or both.
+	ErrRedirectLoop = errors.New("redirect loop")
+	// ErrTooManyRedirects reports a redirect chain longer than the limit.
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// httpHop is the hop of a redirect response.
+func httpHop(u *url.URL, statusCode int) RedirectHop {
+	return RedirectHop{URL: NormalizeURL(u), StatusCode: statusCode, Type: "http-" + strconv.Itoa(statusCode)}
+}
+
+// redirectDedup is attached to the context of page requests. When a
+// redirect leads to a URL that is already visited, the redirect is not
+// followed and stoppedAt records the target whose content is stored
+// elsewhere.
+type redirectDedup struct {
+	stoppedAt string
+
+	// page is the URL requested, crawled at depth.
+	page  string
+	depth int
+
+	// unfollowed is set when a redirect is not followed because the crawl
+	// would not crawl its target as a link, for the reason in refusal.
+	unfollowed string
+	refusal    string
+
+	// claimed lists the redirect targets claimed in the visited set.
+	claimed []string
+
+	// prior lists the hops followed before this request, when it is for
+	// the target of a meta refresh.
+	prior []RedirectHop
+}
+
+type redirectDedupKey struct{}
+
+func withRedirectDedup(req *http.Request, page string, depth int, prior []RedirectHop, claimed []string) (*http.Request, *redirectDedup) {
+	dedup := &redirectDedup{page: page, depth: depth, prior: prior, claimed: append([]string(nil), claimed...)}
+	return req.WithContext(context.WithValue(req.Context(), redirectDedupKey{}, dedup)), dedup
+}
+
+// inChain reports whether target is a URL of the chain followed so far:
+// the prior hops and the requests of via.
+func (d *redirectDedup) inChain(target string, via []*http.Request) bool {
+	for _, hop := range d.prior {
+		if hop.URL == target {
+			return true
+		}
+	}
+	for _, req := range via {
+		if NormalizeURL(req.URL) == target {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect is the client's redirect policy. For page requests a
+// redirect is only followed to a target the crawl would crawl as a link,
+// and every same-domain redirect target is claimed in the visited set, so
+// several URLs redirecting to one target fetch its content only once and
+// the target is not fetched again when linked directly.
+func (c *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	dedup, ok := req.Context().Value(redirectDedupKey{}).(*redirectDedup)
+	hops := len(via)
+	if ok {
+		hops += len(dedup.prior)
+	}
+	if hops >= maxRedirects {
+		return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, maxRedirects)
+	}
+
+	if len(via) > 0 && c.noteHostDot(req.URL, via[len(via)-1].URL.String()) {
+		// Connect to the plain host, which certificates and cookies are
+		// issued for.
+		req.URL.Host = trimHostDot(req.URL.Host)
+	}
+
+	target := NormalizeURL(req.URL)
+	if ok && dedup.inChain(target, via) {
+		return fmt.Errorf("%w back to %s", ErrRedirectLoop, target)
+	}
+	if ok {
+		if refusal := c.redirectRefusal(req.URL, dedup.page, dedup.depth); refusal != "" {
+			dedup.unfollowed, dedup.refusal = target, refusal
+			return http.ErrUseLastResponse
+		}
+	}
+	if !ok || !c.isSameDomain(req.URL) {
+		return nil
+	}
+
+	// The target is as deep as the page redirecting to it, which may be
+	// shallower than the link it was fetched through.
+	c.markDiscovered(target, dedup.depth, dedup.page)
+	if !c.markVisited(target) {
+		dedup.stoppedAt = target
+		return http.ErrUseLastResponse
+	}
+	dedup.claimed = append(dedup.claimed, target)
+	return nil
+}
+
+// redirectRefusal returns why the crawl does not follow a redirect or meta
+// refresh of page, crawled at depth, to u, or "" when it does. A target
+// passes the checks of a link found on page, bar those of depth and of
+// the visited set, and robots.txt, so that redirects cannot lead the crawl
+// where links cannot; dangerous targets fail the request in the fetcher.
+// The redirects of seeds, which are always crawled, only pass robots.txt.
+func (c *Crawler) redirectRefusal(u *url.URL, page string, depth int) string {
+	target := c.normalizeLink(u)
+	if !c.isListed(target) {
+		return EdgeNotListed
+	}
+	if !c.isSameDomain(u) {
+		return ""
+	}
+	if _, foundOn := c.storedDepth(page, depth); depth > 0 || foundOn != "" {
+		if !c.passesFilters(target) {
+			return EdgeFiltered
+		}
+		if !c.withinPathDepth(target) {
+			return EdgePathDepthLimit
+		}
+		if ok, reason := c.inScope(target, depth, page); !ok {
+			return EdgeOutOfScope + ": " + reason
+		}
+	}
+	if decision := c.robotsDecision(target); decision != nil && !decision.Allowed {
+		return CategoryRobotsDisallowed + ": " + decision.String()
+	}
+	return ""
+}
+
+// LongestRedirectChains returns the n pages with the longest redirect
+// chains, longest first.
+func LongestRedirectChains(pages []PageData, n int) []PageData {
+	var chained []PageData
+	for _, page := range pages {
+		if len(page.RedirectChain) > 0 {
+			chained = append(chained, page)
+		}
+	}
+	sort.SliceStable(chained, func(i, j int) bool {
+		if len(chained[i].RedirectChain) != len(chained[j].RedirectChain) {
+			return len(chained[i].RedirectChain) > len(chained[j].RedirectChain)
+		}
+		return chained[i].URL < chained[j].URL
+	})
+	return chained[:min(n, len(chained))]
+}
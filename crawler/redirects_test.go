@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestRedirectAliases crawls five URLs redirecting to one target, which is
+// also linked directly and through a chain of two redirects, and checks
+// that its content is fetched and stored once.
+func TestRedirectAliases(t *testing.T) {
+	var links strings.Builder
+	routes := map[string]http.HandlerFunc{
+		"/c":     htmlPage(`<a href="/after">after</a>`),
+		"/b1":    redirect("/b2"),
+		"/b2":    redirect("/c"),
+		"/after": htmlPage("after"),
+	}
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(&links, `<a href="/a%d">%d</a> `, i, i)
+		routes[fmt.Sprintf("/a%d", i)] = redirect("/c")
+	}
+	links.WriteString(`<a href="/c">direct</a> <a href="/b1">chain</a>`)
+	routes["/"] = htmlPage(links.String())
+
+	for _, opts := range [][]Option{nil, {WithDeterministic(1)}} {
+		for run := 0; run < 5; run++ {
+			site := newTestSite(t, routes)
+			result := crawlTestSite(t, site.URL, 3, opts...)
+			if n := site.requested("/c"); n != 1 {
+				t.Errorf("/c was requested %d times, want once", n)
+			}
+			if n := site.requested("/after"); n != 1 {
+				t.Errorf("/after was requested %d times, want once", n)
+			}
+
+			contents := 0
+			stored := make(map[string]bool)
+			for _, page := range result.Pages {
+				target := page.URL
+				if page.FinalURL != "" {
+					target = page.FinalURL
+				}
+				if target != site.URL+"/c" {
+					continue
+				}
+				stored[strings.TrimPrefix(page.URL, site.URL)] = true
+				if page.Alias {
+					if len(page.Links) != 0 || page.Title != "" || page.ContentHash != "" {
+						t.Errorf("alias %s carries content: %+v", page.URL, page)
+					}
+					if len(page.RedirectChain) == 0 {
+						t.Errorf("alias %s has no redirect chain", page.URL)
+					}
+					continue
+				}
+				contents++
+				if len(page.Links) != 1 {
+					t.Errorf("the content of /c, stored as %s, has links %q", page.URL, page.Links)
+				}
+			}
+			if contents != 1 {
+				t.Errorf("the content of /c is stored %d times, want once", contents)
+			}
+			// Whichever URL fetched the content first stores it; every
+			// redirecting URL is stored, /b2 within the chain of /b1.
+			for _, path := range []string{"/a1", "/a2", "/a3", "/a4", "/a5", "/b1"} {
+				if !stored[path] {
+					t.Errorf("%s is not stored", path)
+				}
+			}
+			if stored["/b2"] {
+				t.Error("/b2 within the chain of /b1 is stored")
+			}
+			if len(result.Errors) != 0 {
+				t.Errorf("errors: %+v", result.Errors)
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// RedirectedLinkGroup collects every internal link that points at a URL
+// which redirected when fetched. Such links should be updated to FinalURL.
+type RedirectedLinkGroup struct {
+	TargetURL   string   `json:"target_url"`
+	FinalURL    string   `json:"final_url"`
+	StatusCode  int      `json:"status_code"`
+	LinkCount   int      `json:"link_count"`
+	SourcePages []string `json:"source_pages"`
+}
+
+// FindRedirectedLinks joins the links of every page against the pages that
+// were fetched through a redirect. Groups are ordered by link count so the
+// templates responsible for the most stale links come first. Targets whose
+// redirect leaves the crawled host are left out.
+func FindRedirectedLinks(pages []PageData, host string) []RedirectedLinkGroup {
+	redirected := make(map[string]PageData)
+	for _, page := range pages {
+		if len(page.RedirectChain) == 0 || page.FinalURL == "" {
+			continue
+		}
+		final, err := url.Parse(page.FinalURL)
+		if err != nil || final.Host != host {
+			continue
+		}
+		redirected[page.URL] = page
+	}
+	if len(redirected) == 0 {
+		return nil
+	}
+
+	groups := make(map[string]*RedirectedLinkGroup)
+	seen := make(map[[2]string]bool)
+	for _, page := range pages {
+		for _, link := range page.Links {
+			target, ok := redirected[link]
+			if !ok || seen[[2]string{link, page.URL}] {
+				continue
+			}
+			seen[[2]string{link, page.URL}] = true
+
+			group, ok := groups[link]
+			if !ok {
+				group = &RedirectedLinkGroup{
+					TargetURL:  link,
+					FinalURL:   target.FinalURL,
+					StatusCode: target.RedirectChain[0].StatusCode,
+				}
+				groups[link] = group
+			}
+			group.LinkCount++
+			group.SourcePages = append(group.SourcePages, page.URL)
+		}
+	}
+
+	result := make([]RedirectedLinkGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.Strings(group.SourcePages)
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].LinkCount != result[j].LinkCount {
+			return result[i].LinkCount > result[j].LinkCount
+		}
+		return result[i].TargetURL < result[j].TargetURL
+	})
+	return result
+}
+
+func LoadResults(filename string) (*CrawlResult, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening results: %v", err)
+	}
+	defer file.Close()
+
+	var result CrawlResult
+	if err := json.NewDecoder(file).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding results: %v", err)
+	}
+	return &result, nil
+}
+
+// BrokenLink is a link from a crawled page to a URL that failed.
+type BrokenLink struct {
+	SourcePage string `json:"source_page"`
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error"`
+}
+
+// FindBrokenLinks joins the links of every page against the crawl errors.
+// Failed URLs that no stored page links to (such as the seed) are reported
+// with an empty SourcePage.
+func FindBrokenLinks(result *CrawlResult) []BrokenLink {
+	failed := make(map[string]CrawlError, len(result.Errors))
+	for _, crawlErr := range result.Errors {
+		// Results saved before errors were categorized have no category.
+		if crawlErr.Category != "" && !isBrokenCategory(crawlErr.Category) {
+			continue
+		}
+		failed[crawlErr.URL] = crawlErr
+	}
+
+	linked := make(map[string]bool)
+	seen := make(map[[2]string]bool)
+	var broken []BrokenLink
+	for _, page := range result.Pages {
+		for _, link := range page.Links {
+			crawlErr, ok := failed[link]
+			if !ok || seen[[2]string{page.URL, link}] {
+				continue
+			}
+			seen[[2]string{page.URL, link}] = true
+			linked[link] = true
+			broken = append(broken, BrokenLink{
+				SourcePage: page.URL,
+				URL:        link,
+				StatusCode: crawlErr.StatusCode,
+				Error:      crawlErr.Error,
+			})
+		}
+	}
+	for _, crawlErr := range result.Errors {
+		if _, ok := failed[crawlErr.URL]; ok && !linked[crawlErr.URL] {
+			broken = append(broken, BrokenLink{URL: crawlErr.URL, StatusCode: crawlErr.StatusCode, Error: crawlErr.Error})
+		}
+	}
+
+	sort.SliceStable(broken, func(i, j int) bool {
+		if broken[i].URL != broken[j].URL {
+			return broken[i].URL < broken[j].URL
+		}
+		return broken[i].SourcePage < broken[j].SourcePage
+	})
+	return broken
+}
+
+// DuplicateTitle lists the pages sharing one non-empty title.
+type DuplicateTitle struct {
+	Title string   `json:"title"`
+	URLs  []string `json:"urls"`
+}
+
+func FindDuplicateTitles(pages []PageData) []DuplicateTitle {
+	byTitle := make(map[string][]string)
+	for _, page := range pages {
+		title := strings.TrimSpace(page.Title)
+		if title == "" {
+			continue
+		}
+		byTitle[title] = append(byTitle[title], page.URL)
+	}
+
+	var duplicates []DuplicateTitle
+	for title, urls := range byTitle {
+		if len(urls) < 2 {
+			continue
+		}
+		sort.Strings(urls)
+		duplicates = append(duplicates, DuplicateTitle{Title: title, URLs: urls})
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if len(duplicates[i].URLs) != len(duplicates[j].URLs) {
+			return len(duplicates[i].URLs) > len(duplicates[j].URLs)
+		}
+		return duplicates[i].Title < duplicates[j].Title
+	})
+	return duplicates
+}
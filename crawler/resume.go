@@ -0,0 +1,377 @@
+package crawler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// normalizationVersion changes whenever NormalizeURL starts producing
+// different URLs, so results normalized differently are not combined.
+const normalizationVersion = 3
+
+// RunConfig is the effective configuration of a crawl, stored in the
+// results so a resumed crawl can be checked against it.
+type RunConfig struct {
+	// Scope settings decide which URLs belong to the crawl. Changing them
+	// on resume makes the combined results incoherent.
+	BaseURL        string   `json:"base_url"`
+	MaxDepth       int      `json:"max_depth"`
+	MaxPathDepth   int      `json:"max_path_depth,omitempty"`
+	Include        []string `json:"include,omitempty"`
+	Exclude        []string `json:"exclude,omitempty"`
+	JSLinksFollow  bool     `json:"js_links_follow,omitempty"`
+	MetaRefresh    bool     `json:"meta_refresh,omitempty"`
+	AcceptLanguage string   `json:"accept_language,omitempty"`
+	Languages      []string `json:"languages,omitempty"`
+	Sitemap        string   `json:"sitemap,omitempty"`
+	Feeds          []string `json:"feeds,omitempty"`
+	ModifiedSince  string   `json:"modified_since,omitempty"`
+	OnlyListed     int      `json:"only_listed,omitempty"`
+	Shard          string   `json:"shard,omitempty"`
+	Normalization  int      `json:"normalization"`
+	LowercasePaths bool     `json:"lowercase_paths,omitempty"`
+	Robots         bool     `json:"robots,omitempty"`
+
+	// Hosts are the hosts of WithHosts with their weights.
+	Hosts []HostWeight `json:"hosts,omitempty"`
+
+	// AllowDangerous and DangerousPatterns are the dangerous URL settings;
+	// DangerousPatterns is empty with the defaults.
+	AllowDangerous    bool     `json:"allow_dangerous,omitempty"`
+	DangerousPatterns []string `json:"dangerous_patterns,omitempty"`
+
+	// The remaining settings only affect how the crawl runs and may
+	// change between runs.
+	// RPS is UnlimitedRPS, with UnlimitedRate set, when the crawl was not
+	// rate limited.
+	RPS             float64       `json:"rps"`
+	UnlimitedRate   bool          `json:"unlimited_rate,omitempty"`
+	Timeout         time.Duration `json:"timeout"`
+	MaxPages        int           `json:"max_pages,omitempty"`
+	MaxDuration     time.Duration `json:"max_duration,omitempty"`
+	MaxBytes        int64         `json:"max_bytes,omitempty"`
+	MaxVisited      int           `json:"max_visited,omitempty"`
+	MaxAddedParams  int           `json:"max_added_params,omitempty"`
+	MaxBodySize     int64         `json:"max_body_size"`
+	Contact         string        `json:"contact,omitempty"`
+	SlowPatterns    []SlowPattern `json:"slow_patterns,omitempty"`
+	ThrottleRetries int           `json:"throttle_retries"`
+	Deterministic   bool          `json:"deterministic,omitempty"`
+	Warmup          time.Duration `json:"warmup,omitempty"`
+	Seed            uint64        `json:"seed,omitempty"`
+	Debug           bool          `json:"debug,omitempty"`
+
+	// BodyProgressBytes and BodyProgressWindow are the settings of
+	// WithBodyProgress.
+	BodyProgressBytes  int64         `json:"body_progress_bytes"`
+	BodyProgressWindow time.Duration `json:"body_progress_window"`
+
+	// QualityWeights are the weights of the quality scores.
+	QualityWeights QualityWeights `json:"quality_weights"`
+
+	// AdaptivePruning, PruningWindow and PruningMinYield are the settings
+	// of WithAdaptivePruning.
+	AdaptivePruning bool    `json:"adaptive_pruning,omitempty"`
+	PruningWindow   int     `json:"pruning_window,omitempty"`
+	PruningMinYield float64 `json:"pruning_min_yield,omitempty"`
+
+	// CircuitBreaker are the settings of WithCircuitBreaker, nil when it
+	// is disabled.
+	CircuitBreaker *CircuitBreaker `json:"circuit_breaker,omitempty"`
+
+	// ClassifyRules are the rules of WithClassifyRules. Classifiers added
+	// with WithClassifier are code and not recorded.
+	ClassifyRules []ClassifyRule `json:"classify_rules,omitempty"`
+
+	// ValidationRules are the rules of WithValidations.
+	ValidationRules []ValidationRule `json:"validation_rules,omitempty"`
+}
+
+// circuitBreakerSetting formats the circuit breaker settings, "off" when
+// it is disabled.
+func (rc *RunConfig) circuitBreakerSetting() string {
+	if rc.CircuitBreaker == nil {
+		return "off"
+	}
+	return fmt.Sprintf("%+v", *rc.CircuitBreaker)
+}
+
+// ConfigChange is a setting that differs between the stored and the
+// current configuration of a resumed crawl.
+type ConfigChange struct {
+	Setting  string `json:"setting"`
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+	Scope    bool   `json:"scope,omitempty"`
+}
+
+func (ch ConfigChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", ch.Setting, ch.Previous, ch.Current)
+}
+
+// ResumeInfo records the configuration a crawl was resumed from and what
+// changed.
+type ResumeInfo struct {
+	ResumedFrom    time.Time      `json:"resumed_from"`
+	PreviousConfig *RunConfig     `json:"previous_config,omitempty"`
+	Changes        []ConfigChange `json:"changes,omitempty"`
+	Forced         bool           `json:"forced,omitempty"`
+}
+
+type runSetting struct {
+	name  string
+	value string
+	scope bool
+}
+
+func (rc *RunConfig) settings() []runSetting {
+	return []runSetting{
+		{"base_url", rc.BaseURL, true},
+		{"max_depth", fmt.Sprint(rc.MaxDepth), true},
+		{"max_path_depth", fmt.Sprint(rc.MaxPathDepth), true},
+		{"include", strings.Join(rc.Include, " "), true},
+		{"exclude", strings.Join(rc.Exclude, " "), true},
+		{"js_links_follow", fmt.Sprint(rc.JSLinksFollow), true},
+		{"meta_refresh", fmt.Sprint(rc.MetaRefresh), true},
+		{"accept_language", rc.AcceptLanguage, true},
+		{"languages", strings.Join(rc.Languages, " | "), true},
+		{"sitemap", rc.Sitemap, true},
+		{"feeds", strings.Join(rc.Feeds, " "), true},
+		{"modified_since", rc.ModifiedSince, true},
+		{"only_listed", fmt.Sprint(rc.OnlyListed), true},
+		{"shard", rc.Shard, true},
+		{"normalization", fmt.Sprint(rc.Normalization), true},
+		{"lowercase_paths", fmt.Sprint(rc.LowercasePaths), true},
+		{"robots", fmt.Sprint(rc.Robots), true},
+		{"hosts", fmt.Sprintf("%+v", rc.Hosts), true},
+		{"allow_dangerous", fmt.Sprint(rc.AllowDangerous), true},
+		{"dangerous_patterns", strings.Join(rc.DangerousPatterns, " "), true},
+		{"rps", fmt.Sprint(rc.RPS), false},
+		{"timeout", rc.Timeout.String(), false},
+		{"max_pages", fmt.Sprint(rc.MaxPages), false},
+		{"max_duration", rc.MaxDuration.String(), false},
+		{"max_bytes", fmt.Sprint(rc.MaxBytes), false},
+		{"max_visited", fmt.Sprint(rc.MaxVisited), false},
+		{"max_added_params", fmt.Sprint(rc.MaxAddedParams), false},
+		{"max_body_size", fmt.Sprint(rc.MaxBodySize), false},
+		{"body_progress_bytes", fmt.Sprint(rc.BodyProgressBytes), false},
+		{"body_progress_window", rc.BodyProgressWindow.String(), false},
+		{"contact", rc.Contact, false},
+		{"slow_patterns", fmt.Sprint(rc.SlowPatterns), false},
+		{"throttle_retries", fmt.Sprint(rc.ThrottleRetries), false},
+		{"deterministic", fmt.Sprint(rc.Deterministic), false},
+		{"warmup", rc.Warmup.String(), false},
+		{"seed", fmt.Sprint(rc.Seed), false},
+		{"debug", fmt.Sprint(rc.Debug), false},
+		{"quality_weights", fmt.Sprintf("%+v", rc.QualityWeights), false},
+		{"classify_rules", fmt.Sprintf("%+v", rc.ClassifyRules), false},
+		{"validation_rules", fmt.Sprintf("%+v", rc.ValidationRules), false},
+		{"adaptive_pruning", fmt.Sprint(rc.AdaptivePruning), false},
+		{"pruning_window", fmt.Sprint(rc.PruningWindow), false},
+		{"pruning_min_yield", fmt.Sprint(rc.PruningMinYield), false},
+		{"circuit_breaker", rc.circuitBreakerSetting(), false},
+	}
+}
+
+// DiffRunConfig lists the settings that differ between previous and
+// current, scope settings first.
+func DiffRunConfig(previous, current *RunConfig) []ConfigChange {
+	var scope, other []ConfigChange
+	prev, cur := previous.settings(), current.settings()
+	for i := range cur {
+		if prev[i].value == cur[i].value {
+			continue
+		}
+		change := ConfigChange{Setting: cur[i].name, Previous: prev[i].value, Current: cur[i].value, Scope: cur[i].scope}
+		if change.Scope {
+			scope = append(scope, change)
+		} else {
+			other = append(other, change)
+		}
+	}
+	return append(scope, other...)
+}
+
+// runConfig returns the effective configuration of c.
+func (c *Crawler) runConfig() *RunConfig {
+	rc := &RunConfig{
+		BaseURL:            NormalizeURL(c.baseURL),
+		MaxDepth:           c.maxDepth,
+		MaxPathDepth:       c.maxPathDepth,
+		Include:            c.includePatterns,
+		Exclude:            c.excludePatterns,
+		JSLinksFollow:      c.jsLinks.enabled && c.jsLinks.follow,
+		MetaRefresh:        c.metaRefresh,
+		AcceptLanguage:     c.acceptLanguage,
+		Languages:          c.languages,
+		Sitemap:            c.sitemapURL,
+		Feeds:              c.feedURLs,
+		ModifiedSince:      c.modifiedSinceString(),
+		OnlyListed:         len(c.onlyListed),
+		Shard:              c.shardString(),
+		Normalization:      normalizationVersion,
+		LowercasePaths:     c.lowercasePaths,
+		Robots:             c.robots.enabled,
+		Hosts:              c.hosts.weights,
+		AllowDangerous:     c.allowDangerous,
+		DangerousPatterns:  c.dangerousPatterns,
+		RPS:                c.requestsPerSecond,
+		UnlimitedRate:      c.requestsPerSecond == UnlimitedRPS,
+		Timeout:            c.client.Timeout,
+		MaxPages:           c.budget.maxPages,
+		MaxDuration:        c.budget.maxDuration,
+		MaxBytes:           c.budget.maxBytes,
+		MaxVisited:         c.maxVisited,
+		MaxAddedParams:     c.params.max,
+		MaxBodySize:        c.maxBodySize,
+		BodyProgressBytes:  c.bodyProgress.minBytes,
+		BodyProgressWindow: c.bodyProgress.window,
+		Contact:            c.contact,
+		SlowPatterns:       c.slowPatterns,
+		ThrottleRetries:    c.throttle.retries,
+		Deterministic:      c.deterministic,
+		Warmup:             c.warmup.duration,
+		Seed:               c.seed,
+		Debug:              c.debug,
+		QualityWeights:     c.qualityWeights,
+		ClassifyRules:      c.classify.rules,
+		ValidationRules:    c.validations.rules,
+		AdaptivePruning:    c.pruning.enabled,
+		PruningWindow:      c.pruning.window,
+		PruningMinYield:    c.pruning.minYield,
+	}
+	if c.circuit.enabled {
+		settings := c.circuit.settings
+		rc.CircuitBreaker = &settings
+	}
+	return rc
+}
+
+// modifiedSinceString is the WithModifiedSince date as stored in the
+// configuration.
+func (c *Crawler) modifiedSinceString() string {
+	if c.modifiedSince.IsZero() {
+		return ""
+	}
+	return c.modifiedSince.Format(time.RFC3339)
+}
+
+// WithResume continues the crawl saved in previous: its pages and errors
+// are kept, their URLs are not fetched again, and the links they found
+// that were not fetched yet are crawled. Budgets count the whole crawl, so
+// a crawl stopped by -max-pages needs a higher limit to continue.
+//
+// NewCrawler fails when a scope setting, such as the depth or the URL
+// filters, differs from the stored configuration, unless force is set.
+func WithResume(previous *CrawlResult, force bool) Option {
+	return func(c *Crawler) {
+		c.resume = previous
+		c.forceResume = force
+	}
+}
+
+// frontierLink is a link found before a resume that still has to be
+// crawled.
+type frontierLink struct {
+	url      string
+	depth    int
+	language string
+}
+
+// restore checks the configuration of c.resume against the current one
+// and loads its pages, errors and unfetched links.
+func (c *Crawler) restore() error {
+	prev := c.resume
+	info := &ResumeInfo{ResumedFrom: prev.StartTime, PreviousConfig: prev.Config, Forced: c.forceResume}
+	if prev.Config == nil {
+		if !c.forceResume {
+			return fmt.Errorf("results have no stored configuration to compare with, pass -force to resume anyway")
+		}
+	} else {
+		info.Changes = DiffRunConfig(prev.Config, c.result.Config)
+	}
+
+	var scope []string
+	for _, change := range info.Changes {
+		if change.Scope {
+			scope = append(scope, change.String())
+		}
+	}
+	if len(scope) > 0 {
+		if !c.forceResume {
+			return fmt.Errorf("scope settings changed (%s), pass -force to resume anyway", strings.Join(scope, ", "))
+		}
+		c.logf("Warning: resuming despite scope changes: %s\n", strings.Join(scope, ", "))
+	}
+	for _, change := range info.Changes {
+		if !change.Scope {
+			c.logf("Resume: %s\n", change)
+		}
+	}
+
+	c.result.Resume = info
+	c.result.Pages = append(c.result.Pages, prev.Pages...)
+	// URLs skipped once the circuit breaker gave up on their host are
+	// crawled again.
+	prevErrors := slices.DeleteFunc(slices.Clone(prev.Errors), func(crawlErr CrawlError) bool {
+		return crawlErr.Category == CategoryCircuitOpen
+	})
+	c.result.Errors = append(c.result.Errors, prevErrors...)
+	c.counters.restore(prev)
+	c.pruning.restore(prev.PrunedPatterns)
+	if prev.FinalRetry != nil {
+		c.finalRetry.stats = *prev.FinalRetry
+	}
+	c.circuit.restore(prev.Circuit)
+	c.robots.previous = prev.Robots
+	c.validations.restore(prev.Validations)
+	c.restoreDNS(prev.DNS, prev.DNSChanges)
+	c.counters.pages.Store(int64(len(c.result.Pages)))
+	c.counters.errors.Store(int64(len(c.result.Errors)))
+
+	// Restored URLs are keyed by the language pass that fetched them.
+	defer func(language, keyLanguage string) {
+		c.language, c.keyLanguage = language, keyLanguage
+	}(c.language, c.keyLanguage)
+	for _, crawlErr := range prevErrors {
+		c.startPass(crawlErr.Language)
+		c.markVisited(crawlErr.URL)
+		c.markDiscovered(crawlErr.URL, crawlErr.Depth, "")
+	}
+	for _, page := range prev.Pages {
+		c.startPass(page.Language)
+		c.markVisited(page.URL)
+		c.markDiscovered(page.URL, page.Depth, page.FoundOn)
+		if page.FinalURL != "" {
+			c.markVisited(page.FinalURL)
+		}
+		for _, hop := range page.RedirectChain {
+			c.markVisited(hop.URL)
+		}
+	}
+	for _, page := range prev.Pages {
+		c.startPass(page.Language)
+		for _, link := range page.LinkDetails {
+			if link.Source == LinkSourceJS && !(c.jsLinks.enabled && c.jsLinks.follow) {
+				continue
+			}
+			if !c.passesFilters(link.URL) || c.maxPathDepth > 0 && PathDepth(link.URL) > c.maxPathDepth {
+				continue
+			}
+			if !c.withinDepth(page.Depth + 1) {
+				// Left for the crawl to record as beyond the depth limit.
+			} else if ok, _ := c.inScope(link.URL, page.Depth+1, page.URL); !ok {
+				continue
+			}
+			c.markDiscovered(link.URL, page.Depth+1, page.URL)
+			if !c.isVisited(link.URL) {
+				c.frontier = append(c.frontier, frontierLink{link.URL, page.Depth + 1, page.Language})
+			}
+		}
+	}
+	c.logf("Resuming with %d pages and %d errors, %d links left to crawl\n",
+		len(prev.Pages), len(prevErrors), len(c.frontier))
+	return nil
+}
@@ -0,0 +1,207 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffRunConfig(t *testing.T) {
+	base := func() *RunConfig {
+		return &RunConfig{
+			BaseURL:       "http://example.com/",
+			MaxDepth:      3,
+			Exclude:       []string{"/private"},
+			Normalization: normalizationVersion,
+			RPS:           2,
+			Timeout:       10 * time.Second,
+		}
+	}
+	tests := []struct {
+		setting string
+		scope   bool
+		change  func(rc *RunConfig)
+	}{
+		{"base_url", true, func(rc *RunConfig) { rc.BaseURL = "http://example.com/docs" }},
+		{"max_depth", true, func(rc *RunConfig) { rc.MaxDepth = 4 }},
+		{"max_path_depth", true, func(rc *RunConfig) { rc.MaxPathDepth = 2 }},
+		{"include", true, func(rc *RunConfig) { rc.Include = []string{"/blog"} }},
+		{"exclude", true, func(rc *RunConfig) { rc.Exclude = append(rc.Exclude, "/tmp") }},
+		{"js_links_follow", true, func(rc *RunConfig) { rc.JSLinksFollow = true }},
+		{"languages", true, func(rc *RunConfig) { rc.Languages = []string{"en", "de"} }},
+		{"normalization", true, func(rc *RunConfig) { rc.Normalization = normalizationVersion - 1 }},
+		{"lowercase_paths", true, func(rc *RunConfig) { rc.LowercasePaths = true }},
+		{"robots", true, func(rc *RunConfig) { rc.Robots = true }},
+		{"hosts", true, func(rc *RunConfig) { rc.Hosts = []HostWeight{{Host: "example.org", Weight: 1}} }},
+		{"dangerous_patterns", true, func(rc *RunConfig) { rc.DangerousPatterns = []string{"/delete"} }},
+		{"rps", false, func(rc *RunConfig) { rc.RPS = 5 }},
+		{"timeout", false, func(rc *RunConfig) { rc.Timeout = time.Minute }},
+		{"max_pages", false, func(rc *RunConfig) { rc.MaxPages = 100 }},
+		{"deterministic", false, func(rc *RunConfig) { rc.Deterministic = true }},
+		{"debug", false, func(rc *RunConfig) { rc.Debug = true }},
+		{"circuit_breaker", false, func(rc *RunConfig) { rc.CircuitBreaker = &CircuitBreaker{} }},
+	}
+	for _, tt := range tests {
+		current := base()
+		tt.change(current)
+		changes := DiffRunConfig(base(), current)
+		if len(changes) != 1 || changes[0].Setting != tt.setting || changes[0].Scope != tt.scope {
+			t.Errorf("changing %s: changes %+v, want it alone with scope %t", tt.setting, changes, tt.scope)
+		}
+	}
+
+	if changes := DiffRunConfig(base(), base()); len(changes) != 0 {
+		t.Errorf("equal configurations differ: %+v", changes)
+	}
+
+	// Scope changes come first, each group in the order of the settings.
+	current := base()
+	current.RPS = 5
+	current.Exclude = nil
+	current.Debug = true
+	current.MaxDepth = 1
+	var got []string
+	for _, change := range DiffRunConfig(base(), current) {
+		got = append(got, change.String())
+	}
+	want := []string{"max_depth: 3 -> 1", "exclude: /private -> ", "rps: 2 -> 5", "debug: false -> true"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("changes %q, want %q", got, want)
+	}
+}
+
+// resumeSite is a site of seven pages over two levels.
+func resumeSite(t *testing.T) *testSite {
+	return newTestSite(t, map[string]http.HandlerFunc{
+		"/":    htmlPage(`<a href="/a">a</a> <a href="/b">b</a> <a href="/c">c</a>`),
+		"/a":   htmlPage(`<a href="/a/1">1</a>`),
+		"/b":   htmlPage(`<a href="/b/1">1</a>`),
+		"/c":   htmlPage(`<a href="/c/1">1</a>`),
+		"/a/1": htmlPage("a1"),
+		"/b/1": htmlPage("b1"),
+		"/c/1": htmlPage("c1"),
+	})
+}
+
+// stoppedCrawl crawls site to depth 2 until two pages are stored and
+// returns the results as saved and loaded again.
+func stoppedCrawl(t *testing.T, site *testSite) *CrawlResult {
+	t.Helper()
+	result := crawlTestSite(t, site.URL, 2, WithMaxPages(2))
+	if len(result.Pages) != 2 {
+		t.Fatalf("the first run stored %d pages, want 2", len(result.Pages))
+	}
+	filename := filepath.Join(t.TempDir(), "results.json")
+	if err := SaveResults(filename, result); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := LoadResults(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return saved
+}
+
+// TestResume continues a stopped crawl from its saved results with a
+// higher page budget, a setting that may change.
+func TestResume(t *testing.T) {
+	site := resumeSite(t)
+	previous := stoppedCrawl(t, site)
+
+	var log strings.Builder
+	c, err := NewCrawler(site.URL, 2, 1000, WithLogOutput(&log), WithResume(previous, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(log.String(), "Resume: max_pages: 2 -> 0") {
+		t.Errorf("the changed page budget is not logged: %q", log.String())
+	}
+	c.logOutput = io.Discard
+	result, err := c.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/", "/a", "/b", "/c", "/a/1", "/b/1", "/c/1"} {
+		if findPage(result, site.URL, path) == nil {
+			t.Errorf("%s is not stored", path)
+		}
+		if n := site.requested(path); n != 1 {
+			t.Errorf("%s was requested %d times over both runs, want once", path, n)
+		}
+	}
+	if len(result.Pages) != 7 {
+		t.Errorf("stored %d pages, want 7", len(result.Pages))
+	}
+	info := result.Resume
+	if info == nil {
+		t.Fatal("the result does not record the resume")
+	}
+	if !info.ResumedFrom.Equal(previous.StartTime) || info.PreviousConfig == nil || info.PreviousConfig.MaxPages != 2 || info.Forced {
+		t.Errorf("resume info %+v does not describe the first run", info)
+	}
+	if len(info.Changes) != 1 || info.Changes[0].Setting != "max_pages" || info.Changes[0].Scope {
+		t.Errorf("changes %+v, want max_pages only", info.Changes)
+	}
+	if result.Config == nil || result.Config.MaxPages != 0 {
+		t.Errorf("the current configuration is not recorded: %+v", result.Config)
+	}
+}
+
+func TestResumeScopeChange(t *testing.T) {
+	site := resumeSite(t)
+	previous := stoppedCrawl(t, site)
+
+	tests := []struct {
+		name     string
+		maxDepth int
+		opts     []Option
+		want     string
+	}{
+		{"depth", 1, nil, "max_depth: 2 -> 1"},
+		{"exclude", 2, []Option{WithURLFilters(nil, []string{"/b"})}, "exclude:  -> /b"},
+		{"normalization", 2, []Option{WithLowercasePaths()}, "lowercase_paths: false -> true"},
+	}
+	for _, tt := range tests {
+		opts := append([]Option{WithLogOutput(io.Discard), WithResume(previous, false)}, tt.opts...)
+		_, err := NewCrawler(site.URL, tt.maxDepth, 1000, opts...)
+		if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.Contains(err.Error(), "-force") {
+			t.Errorf("%s: error %v, want the change %q", tt.name, err, tt.want)
+		}
+
+		var log strings.Builder
+		opts = append([]Option{WithLogOutput(&log), WithResume(previous, true)}, tt.opts...)
+		c, err := NewCrawler(site.URL, tt.maxDepth, 1000, opts...)
+		if err != nil {
+			t.Errorf("%s: forced resume: %v", tt.name, err)
+			continue
+		}
+		if !strings.Contains(log.String(), "Warning: resuming despite scope changes: "+tt.want) {
+			t.Errorf("%s: the forced change is not logged: %q", tt.name, log.String())
+		}
+		info := c.result.Resume
+		if info == nil || !info.Forced || len(info.Changes) == 0 || !info.Changes[0].Scope {
+			t.Errorf("%s: resume info %+v does not record the forced scope change", tt.name, info)
+		}
+	}
+}
+
+func TestResumeWithoutConfig(t *testing.T) {
+	site := resumeSite(t)
+	previous := stoppedCrawl(t, site)
+	previous.Config = nil
+	if _, err := NewCrawler(site.URL, 2, 1000, WithLogOutput(io.Discard), WithResume(previous, false)); err == nil {
+		t.Error("results without a configuration were resumed")
+	}
+	c, err := NewCrawler(site.URL, 2, 1000, WithLogOutput(io.Discard), WithResume(previous, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := c.result.Resume; info == nil || info.PreviousConfig != nil || len(info.Changes) != 0 {
+		t.Errorf("resume info %+v, want no previous configuration and no changes", info)
+	}
+}
@@ -0,0 +1,186 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxFinalRetries bounds the URLs fetched again by the final retry phase
+// of a pass. Failures beyond it keep their error.
+const maxFinalRetries = 1000
+
+// WithFinalRetry controls the final retry phase, which is enabled unless
+// enabled is false. URLs that failed with an error that is often transient
+// (a timeout, a connection failure, status 429, 500, 502, 503 or 504) are
+// fetched once more after the frontier of their pass has drained. A URL that
+// succeeds then is stored with RecoveredOnRetry and its error is removed.
+//
+// The phase respects the rate limit and the duration and byte budgets, and
+// fetches at most 1000 URLs per pass. Retries do not count towards the page
+// budget, since every URL retried was already counted once.
+func WithFinalRetry(enabled bool) Option {
+	return func(c *Crawler) {
+		c.finalRetry.enabled = enabled
+	}
+}
+
+// FinalRetryStats summarizes the final retry phase. Retried counts the URLs
+// fetched again and Recovered those that succeeded.
+type FinalRetryStats struct {
+	Retried   int `json:"retried"`
+	Recovered int `json:"recovered"`
+}
+
+type finalRetryOptions struct {
+	enabled bool
+	lock    sync.Mutex
+	queue   []frontierLink
+	stats   FinalRetryStats
+}
+
+// isRetryable reports whether err is a failure that often goes away when
+// the URL is fetched again later.
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	switch ErrorCategory(err) {
+	case CategoryThrottled, CategorySlowBody, CategoryTimeout, CategoryConnection:
+		return true
+	}
+	return false
+}
+
+// queueRetry schedules pageURL, which failed with err, for the final retry
+// phase of the pass if err is retryable.
+func (c *Crawler) queueRetry(pageURL string, depth int, err error) {
+	if !c.finalRetry.enabled || !isRetryable(err) {
+		return
+	}
+	c.finalRetry.lock.Lock()
+	defer c.finalRetry.lock.Unlock()
+	c.finalRetry.queue = append(c.finalRetry.queue, frontierLink{url: pageURL, depth: depth, language: c.keyLanguage})
+}
+
+// releaseClaims undoes the visited claims redirects made for a request that
+// failed with a retryable error, so the final retry or a direct link fetches
+// the targets instead of storing an alias of a page that was never stored.
+func (c *Crawler) releaseClaims(claimed []string, err error) {
+	if !c.finalRetry.enabled || len(claimed) == 0 || !isRetryable(err) {
+		return
+	}
+	c.visitedLock.Lock()
+	defer c.visitedLock.Unlock()
+	for _, target := range claimed {
+		c.unvisit(c.visitKey(target))
+	}
+}
+
+// retryFailures fetches the URLs queued during the pass once more, then
+// crawls the new links found on those that recovered.
+func (c *Crawler) retryFailures() {
+	c.finalRetry.lock.Lock()
+	queue := c.finalRetry.queue
+	c.finalRetry.queue = nil
+	c.finalRetry.lock.Unlock()
+	// A host whose circuit is not closed is not worth retrying.
+	queue = slices.DeleteFunc(queue, func(link frontierLink) bool { return !c.circuit.host(link.url).isClosed() })
+	if len(queue) == 0 || c.ctx.Err() != nil {
+		return
+	}
+	sort.Slice(queue, func(i, j int) bool { return queue[i].url < queue[j].url })
+	if len(queue) > maxFinalRetries {
+		c.logf("Warning: %d URLs failed with retryable errors, retrying the first %d\n", len(queue), maxFinalRetries)
+		queue = queue[:maxFinalRetries]
+	}
+	c.logf("Retrying %d URLs that failed with retryable errors\n", len(queue))
+
+	c.nextLevel = nil
+	var wg sync.WaitGroup
+	for _, link := range queue {
+		if c.deterministic {
+			c.fetchAndStore(link.url, link.depth, &wg, true)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.fetchAndStore(link.url, link.depth, &wg, true)
+		}()
+	}
+	wg.Wait()
+	if c.deterministic {
+		c.crawlLevels(c.nextLevel)
+	}
+}
+
+// retryAllowed is the budget check of a retry: like reserveFetch, except
+// that the page budget does not apply.
+func (c *Crawler) retryAllowed() bool {
+	switch {
+	case c.ctx.Err() != nil:
+		c.stop(StopCancelled)
+	case c.budget.maxDuration > 0 && time.Since(c.result.StartTime) >= c.budget.maxDuration:
+		c.stop(fmt.Sprintf("max duration (%s) reached", c.budget.maxDuration))
+	case c.budget.maxBytes > 0 && c.counters.bytes.Load() >= c.budget.maxBytes:
+		c.stop(fmt.Sprintf("max bytes (%d) reached", c.budget.maxBytes))
+	default:
+		c.finalRetry.lock.Lock()
+		c.finalRetry.stats.Retried++
+		c.finalRetry.lock.Unlock()
+		return true
+	}
+	return false
+}
+
+// recordRetry updates the error of pageURL in the current pass after its
+// final retry: it is removed when the retry succeeded, err being nil, and
+// replaced by the new error otherwise.
+func (c *Crawler) recordRetry(pageURL string, depth int, err error) {
+	if err == nil {
+		c.finalRetry.lock.Lock()
+		c.finalRetry.stats.Recovered++
+		c.finalRetry.lock.Unlock()
+		c.logf("Recovered on retry: %s\n", pageURL)
+	}
+	c.resultLock.Lock()
+	defer c.resultLock.Unlock()
+	for i, crawlErr := range c.result.Errors {
+		if crawlErr.URL != pageURL || crawlErr.Language != c.keyLanguage {
+			continue
+		}
+		if err == nil {
+			c.result.Errors = append(c.result.Errors[:i], c.result.Errors[i+1:]...)
+			c.counters.errors.Add(-1)
+			return
+		}
+		retried := newCrawlError(pageURL, depth, err, c.keyLanguage)
+		retried.Time = time.Now()
+		c.logf("Error [%s] %s: %s (final retry)\n", retried.Category, pageURL, retried.Error)
+		c.result.Errors[i] = retried
+		return
+	}
+}
+
+// finalRetryStats returns the summary of the final retry phase, nil when
+// nothing was retried.
+func (c *Crawler) finalRetryStats() *FinalRetryStats {
+	c.finalRetry.lock.Lock()
+	defer c.finalRetry.lock.Unlock()
+	if c.finalRetry.stats.Retried == 0 {
+		return nil
+	}
+	stats := c.finalRetry.stats
+	return &stats
+}
@@ -0,0 +1,351 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons of a RobotsDecision that no rule decided.
+const (
+	RobotsNoMatch     = "no-matching-rule"
+	RobotsNotFound    = "no-robots-txt"
+	RobotsUnreachable = "unreachable"
+)
+
+// WithRobots makes the crawl obey robots.txt: a URL disallowed for the
+// crawler's user agent is not requested and stored as an error of category
+// robots-disallowed. The robots.txt of every host is fetched once, when its
+// first URL is crawled, and stored in Robots of the result. Every page and
+// every disallowed URL records the decision that applied to it.
+//
+// Rules follow RFC 9309: the group naming the product token of the user
+// agent applies, or else the * group; the longest matching pattern wins
+// and Allow wins a tie. A missing robots.txt (status 4xx) allows every URL
+// and an unreachable one (status 5xx or a network error) disallows all.
+func WithRobots() Option {
+	return func(c *Crawler) {
+		c.robots.enabled = true
+	}
+}
+
+// RobotsFile is a robots.txt file a crawl applied, fetched at FetchedAt.
+// SHA256 identifies its Content, which is stored as it was read.
+type RobotsFile struct {
+	URL        string    `json:"url"`
+	StatusCode int       `json:"status_code,omitempty"`
+	FetchedAt  time.Time `json:"fetched_at"`
+	SHA256     string    `json:"sha256,omitempty"`
+	Content    string    `json:"content,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// RobotsDecision is why robots.txt allowed or disallowed a URL: the rule
+// that matched, with its Directive ("allow" or "disallow"), Pattern and
+// Line, or the Reason no rule decided. File is the robots.txt file in
+// effect and SHA256 the version of it.
+type RobotsDecision struct {
+	Allowed   bool   `json:"allowed"`
+	Directive string `json:"directive,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	File      string `json:"file"`
+	SHA256    string `json:"sha256,omitempty"`
+}
+
+// String describes d as "Disallow: /private/ (line 3)".
+func (d *RobotsDecision) String() string {
+	if d.Directive == "" {
+		return d.Reason
+	}
+	return fmt.Sprintf("%s%s: %s (line %d)", strings.ToUpper(d.Directive[:1]), d.Directive[1:], d.Pattern, d.Line)
+}
+
+type robotsOptions struct {
+	enabled bool
+	lock    sync.Mutex
+	hosts   map[string]*robotsHost
+	// previous are the files a resumed crawl applied before.
+	previous []RobotsFile
+}
+
+// robotsHost holds the rules of one host, read once.
+type robotsHost struct {
+	once  sync.Once
+	file  RobotsFile
+	rules *robotsRules
+	// allowAll and disallowAll are set when the file gave no rules.
+	allowAll, disallowAll bool
+}
+
+// robotsRule is an Allow or Disallow line of robots.txt.
+type robotsRule struct {
+	allow   bool
+	pattern string
+	line    int
+	re      *regexp.Regexp
+}
+
+// robotsRules are the rules of the groups that apply to one user agent.
+type robotsRules struct {
+	rules []robotsRule
+}
+
+// robotsProductToken returns the name robots.txt groups are matched
+// against: the user agent up to its version, lowercased.
+func robotsProductToken(userAgent string) string {
+	token, _, _ := strings.Cut(userAgent, "/")
+	token, _, _ = strings.Cut(token, " ")
+	return strings.ToLower(strings.TrimSpace(token))
+}
+
+// parseRobotsRules returns the rules of content that apply to the product
+// token agent: those of the groups naming it, or of the * groups when no
+// group does. Groups naming the same agent are merged.
+func parseRobotsRules(content []byte, agent string) *robotsRules {
+	if len(content) > maxRobotsSize {
+		content = content[:maxRobotsSize]
+	}
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	var named, wildcard []robotsRule
+	var agents []string
+	inRules, agentGroup := false, false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		field, value, ok := strings.Cut(strings.TrimSpace(text), ":")
+		if !ok {
+			continue
+		}
+		field, value = strings.ToLower(strings.TrimSpace(field)), strings.TrimSpace(value)
+		switch field {
+		case "user-agent":
+			// A User-agent line after rules starts a new group.
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agents = append(agents, strings.ToLower(value))
+			// A group naming agent replaces the * groups even without rules.
+			agentGroup = agentGroup || strings.ToLower(value) == agent
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				// An empty Disallow allows everything; it matches nothing.
+				continue
+			}
+			rule := robotsRule{allow: field == "allow", pattern: value, line: line, re: robotsPattern(value)}
+			for _, a := range agents {
+				switch a {
+				case agent:
+					named = append(named, rule)
+				case "*":
+					wildcard = append(wildcard, rule)
+				}
+			}
+		default:
+			// Other fields, such as Sitemap, do not end a group.
+		}
+	}
+	if agentGroup {
+		return &robotsRules{rules: named}
+	}
+	return &robotsRules{rules: wildcard}
+}
+
+// robotsPattern compiles a robots.txt path pattern, in which * matches any
+// characters and a final $ anchors the end of the URL.
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// match returns the rule deciding path, the escaped path and query of a
+// URL: the longest matching pattern, an Allow rule winning a tie. It is
+// nil when no rule matches.
+func (r *robotsRules) match(path string) *robotsRule {
+	var best *robotsRule
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if best == nil || len(rule.pattern) > len(best.pattern) ||
+			len(rule.pattern) == len(best.pattern) && rule.allow && !best.allow {
+			best = rule
+		}
+	}
+	return best
+}
+
+// robotsPath is the part of u robots.txt patterns are matched against.
+func robotsPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path
+}
+
+// robotsDecision returns the robots.txt decision for pageURL, fetching the
+// robots.txt of its host on first use, or nil when robots.txt is not
+// applied.
+func (c *Crawler) robotsDecision(pageURL string) *RobotsDecision {
+	if !c.robots.enabled {
+		return nil
+	}
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	host := c.robotsHost(u)
+	decision := &RobotsDecision{File: host.file.URL, SHA256: host.file.SHA256}
+	switch {
+	case u.Path == "/robots.txt" && u.RawQuery == "":
+		decision.Allowed, decision.Reason = true, RobotsNoMatch
+	case host.allowAll:
+		decision.Allowed, decision.Reason = true, RobotsNotFound
+	case host.disallowAll:
+		decision.Reason = RobotsUnreachable
+	default:
+		rule := host.rules.match(robotsPath(u))
+		if rule == nil {
+			decision.Allowed, decision.Reason = true, RobotsNoMatch
+			break
+		}
+		decision.Allowed, decision.Pattern, decision.Line = rule.allow, rule.pattern, rule.line
+		decision.Directive = "disallow"
+		if rule.allow {
+			decision.Directive = "allow"
+		}
+	}
+	return decision
+}
+
+// robotsHost returns the rules of the host of u, reading its robots.txt
+// the first time.
+func (c *Crawler) robotsHost(u *url.URL) *robotsHost {
+	key := u.Scheme + "://" + normalizeHost(u.Scheme, u.Host)
+	c.robots.lock.Lock()
+	if c.robots.hosts == nil {
+		c.robots.hosts = make(map[string]*robotsHost)
+	}
+	host := c.robots.hosts[key]
+	if host == nil {
+		host = &robotsHost{}
+		c.robots.hosts[key] = host
+	}
+	c.robots.lock.Unlock()
+
+	host.once.Do(func() {
+		robotsURL := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}).String()
+		host.file = RobotsFile{URL: robotsURL, FetchedAt: time.Now()}
+		content, status, err := c.fetchRobots(robotsURL)
+		host.file.StatusCode = status
+		switch {
+		case err != nil:
+			host.file.Error = err.Error()
+			host.disallowAll = true
+		case status >= 400 && status < 500:
+			host.allowAll = true
+		case status != http.StatusOK:
+			host.file.Error = (&StatusError{StatusCode: status}).Error()
+			host.disallowAll = true
+		default:
+			sum := sha256.Sum256(content)
+			host.file.SHA256 = hex.EncodeToString(sum[:])
+			host.file.Content = string(content)
+			host.rules = parseRobotsRules(content, robotsProductToken(c.userAgent))
+		}
+		if host.disallowAll {
+			c.logf("Warning: %s is unreachable (%s), not crawling %s\n", robotsURL, host.file.Error, key)
+		}
+	})
+	return host
+}
+
+// robotsFiles returns the robots.txt files read so far, and the versions a
+// resumed crawl read before that differ from them, sorted by URL.
+func (c *Crawler) robotsFiles() []RobotsFile {
+	c.robots.lock.Lock()
+	defer c.robots.lock.Unlock()
+	var files []RobotsFile
+	read := make(map[[2]string]bool)
+	for _, host := range c.robots.hosts {
+		if host.file.URL != "" {
+			files = append(files, host.file)
+			read[[2]string{host.file.URL, host.file.SHA256}] = true
+		}
+	}
+	for _, file := range c.robots.previous {
+		if !read[[2]string{file.URL, file.SHA256}] {
+			files = append(files, file)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].URL < files[j].URL })
+	return files
+}
+
+// robotsDisallowed stores pageURL, which robots.txt disallows, as an error
+// with the decision.
+func (c *Crawler) robotsDisallowed(pageURL string, depth int, decision *RobotsDecision) {
+	c.logf("Skipping %s: disallowed by %s, %s\n", pageURL, decision.File, decision)
+	crawlErr := newCrawlError(pageURL, depth, fmt.Errorf("%w: %s", ErrRobotsDisallowed, decision), c.keyLanguage)
+	crawlErr.Robots = decision
+	c.addError(crawlErr)
+}
+
+// RobotsRuleCount is a robots.txt rule and the number of URLs it
+// disallowed.
+type RobotsRuleCount struct {
+	File string `json:"file"`
+	Rule string `json:"rule"`
+	URLs int    `json:"urls"`
+}
+
+// CountRobotsRules counts the URLs of errs disallowed by each robots.txt
+// rule, most URLs first.
+func CountRobotsRules(errs []CrawlError) []RobotsRuleCount {
+	index := make(map[[2]string]int)
+	var counts []RobotsRuleCount
+	for _, e := range errs {
+		if e.Robots == nil {
+			continue
+		}
+		key := [2]string{e.Robots.File, e.Robots.String()}
+		i, ok := index[key]
+		if !ok {
+			i = len(counts)
+			index[key] = i
+			counts = append(counts, RobotsRuleCount{File: key[0], Rule: key[1]})
+		}
+		counts[i].URLs++
+	}
+	sort.SliceStable(counts, func(i, j int) bool { return counts[i].URLs > counts[j].URLs })
+	return counts
+}
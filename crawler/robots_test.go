@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRobotsRulesMatch(t *testing.T) {
+	const robots = `User-agent: *
+Disallow: /private/
+Allow: /private/open/
+Disallow: /shop
+Allow: /shop
+Disallow: /*.pdf$
+Disallow: /search*q=
+Allow: /tmp/$
+
+User-agent: webcrawler
+Disallow: /only-for-us/
+`
+	tests := []struct {
+		agent, path string
+		allowed     bool
+		pattern     string
+	}{
+		// The longest matching pattern wins.
+		{"other", "/private/page", false, "/private/"},
+		{"other", "/private/open/page", true, "/private/open/"},
+		// Allow wins a tie.
+		{"other", "/shop/cart", true, "/shop"},
+		// * matches anything and a final $ the end of the URL.
+		{"other", "/docs/manual.pdf", false, "/*.pdf$"},
+		{"other", "/docs/manual.pdf?download=1", true, ""},
+		{"other", "/search?lang=en&q=shoes", false, "/search*q="},
+		{"other", "/tmp/", true, "/tmp/$"},
+		{"other", "/public", true, ""},
+		// A group naming the product token replaces the * group.
+		{"webcrawler", "/private/page", true, ""},
+		{"webcrawler", "/only-for-us/page", false, "/only-for-us/"},
+	}
+	for _, tt := range tests {
+		rules := parseRobotsRules([]byte(robots), tt.agent)
+		rule := rules.match(tt.path)
+		allowed, pattern := true, ""
+		if rule != nil {
+			allowed, pattern = rule.allow, rule.pattern
+		}
+		if allowed != tt.allowed || pattern != tt.pattern {
+			t.Errorf("agent %s, %s: allowed %t by %q, want %t by %q", tt.agent, tt.path, allowed, pattern, tt.allowed, tt.pattern)
+		}
+	}
+}
+
+func TestRobotsProductToken(t *testing.T) {
+	for agent, want := range map[string]string{
+		"WebCrawler/1.0":                       "webcrawler",
+		"WebCrawler/1.0 (+mailto:a@b.example)": "webcrawler",
+		"Mozilla/5.0 (compatible)":             "mozilla",
+	} {
+		if got := robotsProductToken(agent); got != want {
+			t.Errorf("robotsProductToken(%q) = %q, want %q", agent, got, want)
+		}
+	}
+}
+
+func TestRobotsRedirectIntoDisallowedPath(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/robots.txt":     textPage("User-agent: *\nDisallow: /private/\nAllow: /docs/\n"),
+		"/":               htmlPage(`<a href="/private-go">go</a> <a href="/moved">moved</a>`),
+		"/private-go":     redirect("/private/secret"),
+		"/private/secret": htmlPage("secret"),
+		"/moved":          redirect("/docs/page"),
+		"/docs/page":      htmlPage("docs"),
+	})
+	result := crawlTestSite(t, site.URL, 2, WithRobots())
+
+	if n := site.requested("/private/secret"); n != 0 {
+		t.Errorf("/private/secret was requested %d times", n)
+	}
+	page := findPage(result, site.URL, "/private-go")
+	if page == nil {
+		t.Fatal("/private-go is not stored")
+	}
+	if page.UnfollowedRedirect != site.URL+"/private/secret" {
+		t.Errorf("UnfollowedRedirect = %q", page.UnfollowedRedirect)
+	}
+	if !strings.HasPrefix(page.UnfollowedReason, CategoryRobotsDisallowed+": Disallow: /private/") {
+		t.Errorf("UnfollowedReason = %q", page.UnfollowedReason)
+	}
+	if page.StatusCode != http.StatusFound {
+		t.Errorf("StatusCode = %d, want the redirect status", page.StatusCode)
+	}
+
+	// The decision recorded is that of the URL the content came from.
+	moved := findPage(result, site.URL, "/moved")
+	if moved == nil || moved.FinalURL != site.URL+"/docs/page" {
+		t.Fatalf("/moved is not stored with its final URL: %+v", moved)
+	}
+	if moved.Robots == nil || moved.Robots.Directive != "allow" || moved.Robots.Pattern != "/docs/" {
+		t.Errorf("Robots of /moved = %v, want the Allow: /docs/ decision of its final URL", moved.Robots)
+	}
+}
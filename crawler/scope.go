@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"net/url"
+	"sync"
+)
+
+// EdgeOutOfScope marks links vetoed by the WithScopeFunc hook.
+const EdgeOutOfScope = "out-of-scope"
+
+// ScopeFunc decides whether a link to u, found on foundOn and crawled at
+// depth, belongs to the crawl. It returns false and a reason, which is
+// recorded with the edge, to veto the link.
+type ScopeFunc func(u *url.URL, depth int, foundOn string) (ok bool, reason string)
+
+// WithScopeFunc consults fn for every link, sitemap URL and redirect
+// target that passes the built-in checks (domain, filters, depth and the
+// like) before it is crawled; a redirect to a URL fn vetoes is not
+// followed. fn can only narrow the crawl: a URL it accepts is still subject
+// to every other rule, and the seed is always crawled. fn is called at most
+// once per normalized URL, with the depth and page of its first discovery,
+// and never concurrently; later links to the URL reuse the decision.
+func WithScopeFunc(fn ScopeFunc) Option {
+	return func(c *Crawler) {
+		c.scope = &scopeHook{fn: fn, decisions: make(map[string]scopeDecision)}
+	}
+}
+
+type scopeHook struct {
+	fn        ScopeFunc
+	lock      sync.Mutex
+	decisions map[string]scopeDecision
+}
+
+type scopeDecision struct {
+	ok     bool
+	reason string
+}
+
+// inScope reports whether the scope hook accepts the normalized URL
+// target, and why not. Without a hook every URL is accepted.
+func (c *Crawler) inScope(target string, depth int, foundOn string) (bool, string) {
+	if c.scope == nil || c.scope.fn == nil {
+		return true, ""
+	}
+	c.scope.lock.Lock()
+	defer c.scope.lock.Unlock()
+	d, ok := c.scope.decisions[target]
+	if !ok {
+		u, err := url.Parse(target)
+		if err != nil {
+			return false, err.Error()
+		}
+		d.ok, d.reason = c.scope.fn(u, depth, foundOn)
+		if !d.ok && d.reason == "" {
+			d.reason = "vetoed by the scope function"
+		}
+		c.scope.decisions[target] = d
+	}
+	return d.ok, d.reason
+}
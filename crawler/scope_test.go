@@ -0,0 +1,289 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScopeFuncVetoesLinks(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/":         htmlPage(`<a href="/docs/a">a</a> <a href="/blog/b">b</a>`),
+		"/docs/a":   htmlPage(`<a href="/docs/a/c">c</a>`),
+		"/docs/a/c": htmlPage("c"),
+		"/blog/b":   htmlPage("b"),
+	})
+	var calls []string
+	result := crawlTestSite(t, site.URL, 3, WithScopeFunc(func(u *url.URL, depth int, foundOn string) (bool, string) {
+		calls = append(calls, u.Path)
+		if strings.HasPrefix(u.Path, "/blog/") {
+			return false, "no blog"
+		}
+		return true, ""
+	}))
+	if n := site.requested("/blog/b"); n != 0 {
+		t.Errorf("/blog/b was requested %d times", n)
+	}
+	if findPage(result, site.URL, "/docs/a/c") == nil {
+		t.Error("/docs/a/c is not stored")
+	}
+	if len(calls) != 3 {
+		t.Errorf("the scope function was called for %v, want once per link", calls)
+	}
+}
+
+func TestRedirectAdmission(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		reason string
+	}{
+		{"scope function", []Option{WithScopeFunc(func(u *url.URL, depth int, foundOn string) (bool, string) {
+			return !strings.HasPrefix(u.Path, "/blocked/"), "blocked section"
+		})}, EdgeOutOfScope + ": blocked section"},
+		{"exclude filter", []Option{WithURLFilters(nil, []string{"/blocked/"})}, EdgeFiltered},
+		{"path depth", []Option{WithMaxPathDepth(1)}, EdgePathDepthLimit},
+		{"robots.txt", []Option{WithRobots()}, CategoryRobotsDisallowed + ": Disallow: /blocked/ (line 2)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := newTestSite(t, map[string]http.HandlerFunc{
+				"/robots.txt":   textPage("User-agent: *\nDisallow: /blocked/\n"),
+				"/":             htmlPage(`<a href="/go">go</a>`),
+				"/go":           redirect("/blocked/page"),
+				"/blocked/page": htmlPage("blocked"),
+			})
+			result := crawlTestSite(t, site.URL, 2, tt.opts...)
+			if n := site.requested("/blocked/page"); n != 0 {
+				t.Errorf("/blocked/page was requested %d times", n)
+			}
+			page := findPage(result, site.URL, "/go")
+			if page == nil {
+				t.Fatal("/go is not stored")
+			}
+			if page.UnfollowedRedirect != site.URL+"/blocked/page" || page.UnfollowedReason != tt.reason {
+				t.Errorf("unfollowed %q for %q, want %q", page.UnfollowedRedirect, page.UnfollowedReason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestSeedRedirectSkipsLinkChecks(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/":      redirect("/home"),
+		"/home":  htmlPage(`<a href="/other">other</a>`),
+		"/other": htmlPage("other"),
+	})
+	result := crawlTestSite(t, site.URL, 2, WithURLFilters([]string{"/other"}, nil),
+		WithScopeFunc(func(u *url.URL, depth int, foundOn string) (bool, string) {
+			return u.Path != "/home", "not home"
+		}))
+	if n := site.requested("/home"); n != 1 {
+		t.Errorf("/home, where the seed redirects, was requested %d times", n)
+	}
+	if findPage(result, site.URL, "/other") == nil {
+		t.Error("/other is not stored")
+	}
+}
+
+// TestScopeFuncCalledOnce crawls pages that all link to each other and to
+// spellings of one URL, and checks that the hook is called once per
+// normalized URL and never concurrently.
+func TestScopeFuncCalledOnce(t *testing.T) {
+	routes := map[string]http.HandlerFunc{"/shared": htmlPage("shared")}
+	var links strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&links, `<a href="/p%d">%d</a> `, i, i)
+	}
+	links.WriteString(`<a href="/shared">a</a> <a href="/shared#top">b</a> <a href="/./shared">c</a>`)
+	for i := 0; i < 40; i++ {
+		routes[fmt.Sprintf("/p%d", i)] = htmlPage(links.String())
+	}
+	routes["/"] = htmlPage(links.String())
+
+	for run := 0; run < 3; run++ {
+		site := newTestSite(t, routes)
+		calls := make(map[string]int)
+		var inFlight, overlaps atomic.Int32
+		result := crawlTestSite(t, site.URL, 3, WithScopeFunc(func(u *url.URL, depth int, foundOn string) (bool, string) {
+			if inFlight.Add(1) > 1 {
+				overlaps.Add(1)
+			}
+			defer inFlight.Add(-1)
+			time.Sleep(100 * time.Microsecond)
+			calls[u.String()]++
+			if depth < 1 || !strings.HasPrefix(foundOn, site.URL) {
+				t.Errorf("%s: called with depth %d, found on %q", u, depth, foundOn)
+			}
+			return true, ""
+		}))
+		if n := overlaps.Load(); n != 0 {
+			t.Errorf("the scope function ran concurrently %d times", n)
+		}
+		for _, page := range result.Pages {
+			if calls[page.URL] == 0 && page.Depth > 0 {
+				t.Errorf("%s was crawled without the scope function", page.URL)
+			}
+		}
+		if len(calls) != 41 {
+			t.Errorf("the scope function was called for %d URLs, want 41", len(calls))
+		}
+		for u, n := range calls {
+			if n != 1 {
+				t.Errorf("the scope function was called %d times for %s", n, u)
+			}
+		}
+		if n := site.requested("/shared"); n != 1 {
+			t.Errorf("/shared was requested %d times", n)
+		}
+	}
+}
+
+// TestScopeFuncOnlyNarrows checks that a hook accepting every URL does not
+// let the crawl past the filters or robots.txt, and that the seed is crawled
+// when the hook refuses every URL.
+func TestScopeFuncOnlyNarrows(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/robots.txt":   textPage("User-agent: *\nDisallow: /private/\n"),
+		"/":             htmlPage(`<a href="/excluded">e</a> <a href="/private/page">p</a> <a href="/open">o</a>`),
+		"/excluded":     htmlPage("excluded"),
+		"/private/page": htmlPage("private"),
+		"/open":         htmlPage("open"),
+	})
+	var calls []string
+	result := crawlTestSite(t, site.URL, 2, WithRobots(), WithURLFilters(nil, []string{"/excluded"}),
+		WithScopeFunc(func(u *url.URL, depth int, foundOn string) (bool, string) {
+			calls = append(calls, u.Path)
+			return true, ""
+		}))
+	for _, path := range []string{"/excluded", "/private/page"} {
+		if n := site.requested(path); n != 0 {
+			t.Errorf("%s was requested %d times", path, n)
+		}
+	}
+	if findPage(result, site.URL, "/open") == nil {
+		t.Error("/open is not stored")
+	}
+	if slices.Contains(calls, "/excluded") {
+		t.Error("the scope function was asked about a filtered URL")
+	}
+
+	site = newTestSite(t, map[string]http.HandlerFunc{"/": htmlPage(`<a href="/open">o</a>`)})
+	result = crawlTestSite(t, site.URL, 2, WithScopeFunc(func(u *url.URL, depth int, foundOn string) (bool, string) {
+		return false, "nothing"
+	}))
+	if findPage(result, site.URL, "/") == nil || site.requested("/open") != 0 {
+		t.Errorf("with every URL vetoed, pages %+v, want the seed only", result.Pages)
+	}
+}
+
+// TestScopeFuncRelinks checks that the links of a page crawled at the
+// depth limit pass the hook when the page turns out to be shallower and
+// its links are followed again.
+func TestScopeFuncRelinks(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/":  htmlPage(`<a href="/a">a</a> <a href="/slow">slow</a>`),
+		"/a": htmlPage(`<a href="/b">b</a>`),
+		"/b": htmlPage(`<a href="/p">p</a>`),
+		"/slow": func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(300 * time.Millisecond)
+			htmlPage(`<a href="/p">p</a>`)(w, r)
+		},
+		"/p":      htmlPage(`<a href="/vetoed">vetoed</a>`),
+		"/vetoed": htmlPage("vetoed"),
+	})
+	result := crawlTestSite(t, site.URL, 3, WithScopeFunc(func(u *url.URL, depth int, foundOn string) (bool, string) {
+		return u.Path != "/vetoed", "vetoed"
+	}))
+	if page := findPage(result, site.URL, "/p"); page == nil || page.Depth != 2 {
+		t.Fatalf("/p is not stored at depth 2: %+v", page)
+	}
+	if n := site.requested("/vetoed"); n != 0 {
+		t.Errorf("/vetoed was requested %d times", n)
+	}
+}
+
+// TestScopeFuncSitemapAndEdges checks that sitemap URLs pass the hook and
+// that the reasons of vetoed links are recorded with their edges.
+func TestScopeFuncSitemapAndEdges(t *testing.T) {
+	var site *testSite
+	site = newTestSite(t, map[string]http.HandlerFunc{
+		"/sitemap.xml": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><url><loc>%[1]s/listed/yes</loc></url><url><loc>%[1]s/listed/no</loc></url></urlset>`, site.URL)
+		},
+		"/":           htmlPage(`<a href="/linked/no">no</a>`),
+		"/listed/yes": htmlPage("yes"),
+		"/listed/no":  htmlPage("no"),
+		"/linked/no":  htmlPage("no"),
+	})
+	edges := filepath.Join(t.TempDir(), "edges.jsonl")
+	sitemapDepth := -1
+	crawlTestSite(t, site.URL, 2, WithSitemap("/sitemap.xml"), WithEdgeOutput(edges),
+		WithScopeFunc(func(u *url.URL, depth int, foundOn string) (bool, string) {
+			if u.Path == "/listed/yes" {
+				sitemapDepth = depth
+				if foundOn != site.URL+"/sitemap.xml" {
+					t.Errorf("/listed/yes found on %q, want the sitemap", foundOn)
+				}
+			}
+			if strings.HasSuffix(u.Path, "/no") {
+				return false, "said no to " + u.Path
+			}
+			return true, ""
+		}))
+	if site.requested("/listed/yes") != 1 || site.requested("/listed/no") != 0 || site.requested("/linked/no") != 0 {
+		t.Errorf("requests: /listed/yes %d, /listed/no %d, /linked/no %d", site.requested("/listed/yes"), site.requested("/listed/no"), site.requested("/linked/no"))
+	}
+	if sitemapDepth != 0 {
+		t.Errorf("the sitemap URL was checked at depth %d, want 0", sitemapDepth)
+	}
+
+	data, err := os.ReadFile(edges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vetoed *Edge
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var edge Edge
+		if err := json.Unmarshal([]byte(line), &edge); err != nil {
+			t.Fatal(err)
+		}
+		if edge.Target == site.URL+"/linked/no" {
+			vetoed = &edge
+		}
+	}
+	if vetoed == nil || vetoed.Status != EdgeOutOfScope || vetoed.Reason != "said no to /linked/no" {
+		t.Errorf("edge %+v, want out-of-scope with the reason", vetoed)
+	}
+}
+
+// TestScopeFuncPathDepthExample runs the example of the documentation.
+func TestScopeFuncPathDepthExample(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/":          htmlPage(`<a href="/a/b/c/d">4</a>`),
+		"/a/b/c/d":   htmlPage(`<a href="/a/b/c/d/e">5</a> <a href="/a/b/c/d/">4 with a slash</a>`),
+		"/a/b/c/d/":  htmlPage("4"),
+		"/a/b/c/d/e": htmlPage("5"),
+	})
+	result := crawlTestSite(t, site.URL, UnlimitedDepth, WithMaxPages(100), WithScopeFunc(func(u *url.URL, depth int, foundOn string) (bool, string) {
+		if segments := strings.Count(strings.Trim(u.Path, "/"), "/") + 1; segments > 4 {
+			return false, fmt.Sprintf("path depth %d exceeds 4", segments)
+		}
+		return true, ""
+	}))
+	if findPage(result, site.URL, "/a/b/c/d") == nil || findPage(result, site.URL, "/a/b/c/d/") == nil {
+		t.Error("the pages four segments deep are not stored")
+	}
+	if n := site.requested("/a/b/c/d/e"); n != 0 {
+		t.Errorf("/a/b/c/d/e was requested %d times", n)
+	}
+}
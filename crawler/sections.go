@@ -0,0 +1,157 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Defaults of FindPathSections: sections are named by the first path
+// segment, and those with fewer pages are folded into SectionOther.
+const (
+	DefaultSectionDepth    = 1
+	DefaultSectionMinPages = 5
+)
+
+// SectionOther is the section the small sections are folded into.
+const SectionOther = "other"
+
+// PathSection summarizes the pages whose URL path starts with Section,
+// such as /blog. The home page is its own section, /.
+type PathSection struct {
+	Section string `json:"section"`
+	Pages   int    `json:"pages"`
+	Errors  int    `json:"errors"`
+	// ErrorRate is Errors / (Pages + Errors).
+	ErrorRate float64 `json:"error_rate"`
+	// AvgResponseTime and AvgSize are averaged over the pages of the
+	// section, AvgSize over those with a body.
+	AvgResponseTime float64 `json:"avg_response_time_ms"`
+	AvgSize         float64 `json:"avg_size"`
+	// DuplicateTitles counts the pages of the section whose title is
+	// shared by another crawled page of the same language.
+	DuplicateTitles int `json:"duplicate_titles"`
+}
+
+// sectionTotals accumulates the pages of one section.
+type sectionTotals struct {
+	pages, errors, withBody, duplicates int
+	responseTime, size                  int64
+}
+
+func (t *sectionTotals) merge(o *sectionTotals) {
+	t.pages += o.pages
+	t.errors += o.errors
+	t.withBody += o.withBody
+	t.duplicates += o.duplicates
+	t.responseTime += o.responseTime
+	t.size += o.size
+}
+
+func (t *sectionTotals) section(name string) PathSection {
+	s := PathSection{Section: name, Pages: t.pages, Errors: t.errors, DuplicateTitles: t.duplicates}
+	if total := t.pages + t.errors; total > 0 {
+		s.ErrorRate = float64(t.errors) / float64(total)
+	}
+	if t.pages > 0 {
+		s.AvgResponseTime = float64(t.responseTime) / float64(t.pages)
+	}
+	if t.withBody > 0 {
+		s.AvgSize = float64(t.size) / float64(t.withBody)
+	}
+	return s
+}
+
+// PathSectionOf returns the section of a normalized URL: its first depth
+// path segments, "/" for the home page. A URL with fewer segments is its
+// own section.
+func PathSectionOf(pageURL string, depth int) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return SectionOther
+	}
+	segments := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	if segments[0] == "" {
+		return "/"
+	}
+	if depth > 0 && len(segments) > depth {
+		segments = segments[:depth]
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// FindPathSections groups the crawled pages and the errors of a crawl by
+// PathSectionOf at depth, largest sections first. Sections with fewer than
+// minPages pages and errors are folded into one SectionOther, listed last.
+// Redirect aliases are not counted.
+func FindPathSections(pages []PageData, errs []CrawlError, depth, minPages int) []PathSection {
+	sectionOf := func(pageURL string) string { return PathSectionOf(pageURL, depth) }
+	return findSections(pages, errs, func(page *PageData) string { return sectionOf(page.URL) }, sectionOf, minPages)
+}
+
+// FindTypeSections groups the crawled pages by PageType instead, like
+// FindPathSections. Pages without a type are left out, and so are the
+// errors, as a page that could not be fetched has no type.
+func FindTypeSections(pages []PageData, minPages int) []PathSection {
+	return findSections(pages, nil, func(page *PageData) string { return page.PageType }, nil, minPages)
+}
+
+// findSections groups pages by pageSection and errs by errorSection,
+// leaving out the pages whose section is "". A section named SectionOther
+// joins the folded small sections.
+func findSections(pages []PageData, errs []CrawlError, pageSection func(*PageData) string, errorSection func(string) string, minPages int) []PathSection {
+	titles, _ := duplicateCounts(pages)
+
+	totals := make(map[string]*sectionTotals)
+	get := func(name string) *sectionTotals {
+		t, ok := totals[name]
+		if !ok {
+			t = &sectionTotals{}
+			totals[name] = t
+		}
+		return t
+	}
+	for i := range pages {
+		page := &pages[i]
+		name := pageSection(page)
+		if page.Alias || name == "" {
+			continue
+		}
+		t := get(name)
+		t.pages++
+		t.responseTime += page.ResponseTime
+		if !page.Bodyless {
+			t.withBody++
+			t.size += page.Size
+		}
+		if title := strings.TrimSpace(page.Title); title != "" && titles[qualityKey(page.Language, title)] > 1 {
+			t.duplicates++
+		}
+	}
+	for _, crawlErr := range errs {
+		get(errorSection(crawlErr.URL)).errors++
+	}
+
+	var sections []PathSection
+	var other *sectionTotals
+	for name, t := range totals {
+		if t.pages+t.errors < minPages || name == SectionOther {
+			if other == nil {
+				other = &sectionTotals{}
+			}
+			other.merge(t)
+			continue
+		}
+		sections = append(sections, t.section(name))
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		if sections[i].Pages != sections[j].Pages {
+			return sections[i].Pages > sections[j].Pages
+		}
+		return sections[i].Section < sections[j].Section
+	})
+	if other != nil {
+		sections = append(sections, other.section(SectionOther))
+	}
+	return sections
+}
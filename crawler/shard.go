@@ -0,0 +1,491 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EdgeOtherShard marks links to URLs that belong to another shard of a
+// crawl with WithShard.
+const EdgeOtherShard = "other-shard"
+
+// ShardHash names the hash that assigns URLs to shards. Shards crawled
+// with different hashes cannot be merged.
+const ShardHash = "fnv1a-64"
+
+// WithShard makes the crawler one of count processes splitting a crawl:
+// it only fetches the URLs that ShardOf assigns to index, numbered from 1.
+// Links to other shards are recorded without being fetched and, when
+// handoffDir is set, written to a handoff file there at the end of the
+// crawl. The handoff files of the other shards found in handoffDir when
+// the crawler is created seed the crawl with the URLs they hand over.
+// MergeShards combines the results of all shards.
+func WithShard(index, count int, handoffDir string) Option {
+	return func(c *Crawler) {
+		c.shard = shardOptions{index: index, count: count, handoffDir: handoffDir}
+	}
+}
+
+// ShardInfo describes the part a crawl with WithShard had. HandedOff
+// counts the URLs written to the handoff file for other shards, Seeded
+// the URLs taken from theirs.
+type ShardInfo struct {
+	Index     int    `json:"index"`
+	Count     int    `json:"count"`
+	Hash      string `json:"hash"`
+	HandedOff int    `json:"handed_off"`
+	Seeded    int    `json:"seeded,omitempty"`
+}
+
+type shardOptions struct {
+	index      int
+	count      int
+	handoffDir string
+}
+
+// Handoff is a URL discovered by one shard that another shard fetches.
+type Handoff struct {
+	URL      string `json:"url"`
+	Depth    int    `json:"depth"`
+	FoundOn  string `json:"found_on,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+// ParseShard parses a shard given as INDEX/COUNT, such as 2/8.
+func ParseShard(value string) (index, count int, err error) {
+	i, n, ok := strings.Cut(value, "/")
+	if ok {
+		index, err = strconv.Atoi(strings.TrimSpace(i))
+		if err == nil {
+			count, err = strconv.Atoi(strings.TrimSpace(n))
+		}
+	}
+	if !ok || err != nil {
+		return 0, 0, fmt.Errorf("expected INDEX/COUNT such as 2/8, got %q", value)
+	}
+	if count < 1 || index < 1 || index > count {
+		return 0, 0, fmt.Errorf("shard %d/%d: the index must be between 1 and the count", index, count)
+	}
+	return index, count, nil
+}
+
+// ShardOf returns the shard, from 1 to count, that fetches the normalized
+// URL pageURL. It is the same for every language and every process.
+func ShardOf(pageURL string, count int) int {
+	h := fnv.New64a()
+	h.Write([]byte(pageURL))
+	return int(h.Sum64()%uint64(count)) + 1
+}
+
+// inShard reports whether pageURL is fetched by this crawler. Without
+// sharding every URL is.
+func (c *Crawler) inShard(pageURL string) bool {
+	return c.shard.count == 0 || ShardOf(pageURL, c.shard.count) == c.shard.index
+}
+
+// shardString is the shard of c as stored in the configuration.
+func (c *Crawler) shardString() string {
+	if c.shard.count == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", c.shard.index, c.shard.count)
+}
+
+// checkShard validates the WithShard settings.
+func (c *Crawler) checkShard() error {
+	if c.shard.count == 0 {
+		return nil
+	}
+	if _, _, err := ParseShard(c.shardString()); err != nil {
+		return err
+	}
+	if c.list != nil || c.assetCheck.enabled {
+		return fmt.Errorf("a shard cannot fetch only listed URLs or check assets, whose results are not merged")
+	}
+	c.result.Shard = &ShardInfo{Index: c.shard.index, Count: c.shard.count, Hash: ShardHash}
+	return nil
+}
+
+// handoffPath is the handoff file written by shard index.
+func (c *Crawler) handoffPath(index int) string {
+	return filepath.Join(c.shard.handoffDir, fmt.Sprintf("shard-%d-of-%d.jsonl", index, c.shard.count))
+}
+
+// loadHandoffs adds the URLs the other shards handed to this one to the
+// frontier, unless they were fetched already. Missing files are skipped;
+// their shard has not finished yet.
+func (c *Crawler) loadHandoffs() error {
+	if c.shard.handoffDir == "" {
+		return nil
+	}
+	defer func(language, keyLanguage string) {
+		c.language, c.keyLanguage = language, keyLanguage
+	}(c.language, c.keyLanguage)
+	seeded := 0
+	for index := 1; index <= c.shard.count; index++ {
+		if index == c.shard.index {
+			continue
+		}
+		path := c.handoffPath(index)
+		file, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error opening handoff file: %v", err)
+		}
+		decoder := json.NewDecoder(bufio.NewReader(file))
+		for {
+			var link Handoff
+			err := decoder.Decode(&link)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				file.Close()
+				return fmt.Errorf("error reading handoff file %s: %v", path, err)
+			}
+			if !c.inShard(link.URL) || !c.withinDepth(link.Depth) {
+				continue
+			}
+			c.startPass(link.Language)
+			c.markDiscovered(link.URL, link.Depth, link.FoundOn)
+			if !c.isVisited(link.URL) {
+				c.frontier = append(c.frontier, frontierLink{link.URL, link.Depth, link.Language})
+				seeded++
+			}
+		}
+		file.Close()
+	}
+	c.result.Shard.Seeded = seeded
+	c.logf("Shard %s: %d URLs handed over by other shards\n", c.shardString(), seeded)
+	return nil
+}
+
+// writeHandoff writes the URLs discovered for other shards, within the
+// depth limit, to the handoff file of this shard, sorted so repeated
+// crawls write the same file.
+func (c *Crawler) writeHandoff() error {
+	var links []Handoff
+	c.visitedLock.RLock()
+	for key, d := range c.discovered {
+		link := Handoff{URL: key, Depth: d.depth, FoundOn: d.foundOn}
+		if len(c.languages) > 0 {
+			link.Language, link.URL, _ = strings.Cut(key, " ")
+		}
+		if !c.inShard(link.URL) && c.withinDepth(link.Depth) {
+			links = append(links, link)
+		}
+	}
+	c.visitedLock.RUnlock()
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].URL != links[j].URL {
+			return links[i].URL < links[j].URL
+		}
+		return links[i].Language < links[j].Language
+	})
+
+	c.resultLock.Lock()
+	c.result.Shard.HandedOff = len(links)
+	c.resultLock.Unlock()
+	if c.shard.handoffDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.shard.handoffDir, 0o755); err != nil {
+		return fmt.Errorf("error creating handoff directory: %v", err)
+	}
+	path := c.handoffPath(c.shard.index)
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating handoff file: %v", err)
+	}
+	defer file.Close()
+	out := bufio.NewWriter(file)
+	encoder := json.NewEncoder(out)
+	for _, link := range links {
+		if err := encoder.Encode(link); err != nil {
+			return fmt.Errorf("error writing handoff file: %v", err)
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("error writing handoff file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing handoff file: %v", err)
+	}
+	c.logf("Handoff saved to %s (%d URLs for other shards)\n", path, len(links))
+	return c.artifacts.addFile(ArtifactHandoff, path, "jsonl")
+}
+
+// MergeShards combines the results of every shard of a crawl into one
+// result, as if a single process had crawled the site. It fails unless
+// the results come from all shards of the same crawl: the same hash, shard
+// count and scope settings, normalization included, and pages that belong
+// to the shard that stored them. Pages and errors are deduplicated,
+// redirects to a page stored by another shard become alias records, and
+// the counts, depths, coverage, redirected links, changes and link scores
+// are computed again.
+func MergeShards(shards []*CrawlResult) (*CrawlResult, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("no shard results to merge")
+	}
+	first := shards[0]
+	if first.Shard == nil || first.Config == nil {
+		return nil, fmt.Errorf("results of %s are not a shard", first.BaseURL)
+	}
+	count := first.Shard.Count
+	byIndex := make([]*CrawlResult, count+1)
+	for _, shard := range shards {
+		info := shard.Shard
+		if info == nil || shard.Config == nil {
+			return nil, fmt.Errorf("results of %s are not a shard", shard.BaseURL)
+		}
+		if info.Count != count || info.Hash != first.Shard.Hash || info.Index < 1 || info.Index > count {
+			return nil, fmt.Errorf("shard %d/%d (%s) does not belong to a %d-shard crawl with hash %s",
+				info.Index, info.Count, info.Hash, count, first.Shard.Hash)
+		}
+		if byIndex[info.Index] != nil {
+			return nil, fmt.Errorf("shard %d/%d is given twice", info.Index, count)
+		}
+		byIndex[info.Index] = shard
+		for _, change := range DiffRunConfig(first.Config, shard.Config) {
+			if change.Scope && change.Setting != "shard" {
+				return nil, fmt.Errorf("shard %d/%d was crawled with a different %s", info.Index, count, change)
+			}
+		}
+		for _, page := range shard.Pages {
+			if ShardOf(page.URL, count) != info.Index {
+				return nil, fmt.Errorf("shard %d/%d stored %s, which belongs to shard %d; were the shards crawled with the same hash and normalization?",
+					info.Index, count, page.URL, ShardOf(page.URL, count))
+			}
+		}
+	}
+	var missing []string
+	for index := 1; index <= count; index++ {
+		if byIndex[index] == nil {
+			missing = append(missing, strconv.Itoa(index))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing shards %s of %d", strings.Join(missing, ", "), count)
+	}
+
+	merged := &CrawlResult{Config: first.Config, Feeds: first.Feeds}
+	pages := make(map[string]int)
+	errs := make(map[string]bool)
+	feedItems := make(map[string]bool)
+	var stopReasons []string
+	var hygiene []*SiteHygiene
+	var circuit *CircuitStats
+	for _, shard := range byIndex[1:] {
+		merged.FetchedURLs += shard.FetchedURLs
+		merged.BytesFetched += shard.BytesFetched
+		merged.ThrottleEvents += shard.ThrottleEvents
+		merged.TrailingDotLinks += shard.TrailingDotLinks
+		merged.PathDepthSkips += shard.PathDepthSkips
+		merged.ParamAccumulationSkips += shard.ParamAccumulationSkips
+		if shard.FinalRetry != nil {
+			if merged.FinalRetry == nil {
+				merged.FinalRetry = &FinalRetryStats{}
+			}
+			merged.FinalRetry.Retried += shard.FinalRetry.Retried
+			merged.FinalRetry.Recovered += shard.FinalRetry.Recovered
+		}
+		if shard.Circuit != nil {
+			if circuit == nil {
+				circuit = &CircuitStats{}
+			}
+			circuit.Opened += shard.Circuit.Opened
+			circuit.Closed += shard.Circuit.Closed
+			circuit.CanaryFailures += shard.Circuit.CanaryFailures
+			circuit.GaveUp = circuit.GaveUp || shard.Circuit.GaveUp
+			circuit.GaveUpHosts = append(circuit.GaveUpHosts, shard.Circuit.GaveUpHosts...)
+			circuit.Skipped += shard.Circuit.Skipped
+		}
+		merged.SitemapURLs = max(merged.SitemapURLs, shard.SitemapURLs)
+		if shard.StopReason != "" {
+			stopReasons = append(stopReasons, fmt.Sprintf("shard %d: %s", shard.Shard.Index, shard.StopReason))
+		}
+		for _, page := range shard.Pages {
+			key := languageKey(page.Language, page.URL)
+			if i, ok := pages[key]; ok {
+				if page.Depth < merged.Pages[i].Depth {
+					merged.Pages[i].Depth, merged.Pages[i].FoundOn = page.Depth, page.FoundOn
+				}
+				continue
+			}
+			pages[key] = len(merged.Pages)
+			merged.Pages = append(merged.Pages, page)
+		}
+		for _, crawlErr := range shard.Errors {
+			if key := languageKey(crawlErr.Language, crawlErr.URL); !errs[key] {
+				errs[key] = true
+				merged.Errors = append(merged.Errors, crawlErr)
+			}
+		}
+		merged.Misconfigurations = append(merged.Misconfigurations, shard.Misconfigurations...)
+		for host, ips := range shard.DNS {
+			if merged.DNS == nil {
+				merged.DNS = make(map[string][]ResolvedIP)
+			}
+			merged.DNS[host] = append(merged.DNS[host], ips...)
+		}
+		merged.DNSChanges = append(merged.DNSChanges, shard.DNSChanges...)
+		merged.DangerousURLs = append(merged.DangerousURLs, shard.DangerousURLs...)
+		merged.PrunedPatterns = append(merged.PrunedPatterns, shard.PrunedPatterns...)
+		hygiene = append(hygiene, shard.SiteHygiene)
+		// Every shard reads the feeds, so all list the same items.
+		for _, item := range shard.FeedItems {
+			if !feedItems[item.URL] {
+				feedItems[item.URL] = true
+				merged.FeedItems = append(merged.FeedItems, item)
+			}
+		}
+	}
+	mergeRedirects(merged.Pages, pages)
+	misconfigurations := dedupMisconfigurations(merged.Misconfigurations)
+
+	config := *first.Config
+	config.Shard = ""
+	opts := []Option{
+		WithLogOutput(io.Discard),
+		WithContact(config.Contact),
+		WithAcceptLanguage(config.AcceptLanguage),
+		WithLanguages(config.Languages),
+		WithURLFilters(config.Include, config.Exclude),
+		WithMaxPages(config.MaxPages),
+		WithMaxDuration(config.MaxDuration),
+		WithMaxBytes(config.MaxBytes),
+		WithResume(merged, true),
+	}
+	if config.JSLinksFollow {
+		opts = append(opts, WithJSLinks(true, 0))
+	}
+	if config.LowercasePaths {
+		opts = append(opts, WithLowercasePaths())
+	}
+	if config.QualityWeights != (QualityWeights{}) {
+		opts = append(opts, WithQualityWeights(config.QualityWeights))
+	}
+	if config.ModifiedSince != "" {
+		since, err := time.Parse(time.RFC3339, config.ModifiedSince)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modified_since in the shard configuration: %v", err)
+		}
+		opts = append(opts, WithModifiedSince(since))
+	}
+	c, err := NewCrawler(config.BaseURL, config.MaxDepth, config.RPS, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.feeds, c.feedItems = merged.Feeds, merged.FeedItems
+	if err := c.finalizeResults(); err != nil {
+		return nil, err
+	}
+
+	result := c.result
+	result.Config = &config
+	result.Resume = nil
+	result.StopReason = strings.Join(stopReasons, "; ")
+	result.SitemapURLs = merged.SitemapURLs
+	result.Misconfigurations = misconfigurations
+	result.SiteHygiene = mergeSiteHygiene(hygiene)
+	if result.SiteHygiene != nil {
+		summaries, err := c.pageSummaries()
+		if err != nil {
+			return nil, err
+		}
+		result.SiteHygiene.CaseCollisions = FindCaseCollisions(summaries, result.Errors)
+	}
+	if circuit != nil {
+		slices.Sort(circuit.GaveUpHosts)
+		circuit.GaveUpHosts = slices.Compact(circuit.GaveUpHosts)
+	}
+	result.Circuit = circuit
+	result.StartTime, result.EndTime = first.StartTime, first.EndTime
+	for _, shard := range byIndex[1:] {
+		if shard.StartTime.Before(result.StartTime) {
+			result.StartTime = shard.StartTime
+		}
+		if shard.EndTime.After(result.EndTime) {
+			result.EndTime = shard.EndTime
+		}
+	}
+	return &result, nil
+}
+
+// mergeRedirects turns pages whose redirect target was stored by another
+// shard, or by a page earlier in pages, into alias records, the way a
+// single crawl stores a redirect to a URL it already fetched. index maps
+// the language keys of page URLs to their positions.
+func mergeRedirects(pages []PageData, index map[string]int) {
+	stored := make(map[string]bool)
+	for i := range pages {
+		page := &pages[i]
+		if page.Alias || page.FinalURL == "" {
+			continue
+		}
+		key := languageKey(page.Language, page.FinalURL)
+		if j, ok := index[key]; (ok && j != i && !pages[j].Alias) || stored[key] {
+			*page = PageData{
+				URL:           page.URL,
+				FinalURL:      page.FinalURL,
+				RedirectChain: page.RedirectChain,
+				Alias:         true,
+				Links:         []string{},
+				Depth:         page.Depth,
+				FoundOn:       page.FoundOn,
+				CrawledAt:     page.CrawledAt,
+				ResponseTime:  page.ResponseTime,
+				StatusCode:    page.StatusCode,
+				Language:      page.Language,
+				Vary:          page.Vary,
+				Cookies:       page.Cookies,
+			}
+			continue
+		}
+		stored[key] = true
+	}
+}
+
+// dedupMisconfigurations drops the findings reported by several shards,
+// such as those of a sitemap every shard reads, and sorts the rest.
+func dedupMisconfigurations(found []URLMisconfiguration) []URLMisconfiguration {
+	seen := make(map[string]bool)
+	var unique []URLMisconfiguration
+	for _, m := range found {
+		key := strings.Join([]string{m.Kind, m.Language, m.URL, m.DeclaredOn}, "\x00")
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, m)
+		}
+	}
+	sortMisconfigurations(unique)
+	return unique
+}
+
+// SaveResults writes result as indented JSON to filename, in the format
+// LoadResults reads.
+func SaveResults(filename string, result *CrawlResult) error {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := writeResultJSON(file, result, slicePages(result.Pages)); err != nil {
+		return fmt.Errorf("error encoding JSON: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,211 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	for value, want := range map[string][2]int{"2/8": {2, 8}, "1/1": {1, 1}, " 3 / 4 ": {3, 4}} {
+		index, count, err := ParseShard(value)
+		if err != nil || index != want[0] || count != want[1] {
+			t.Errorf("ParseShard(%q) = %d, %d, %v; want %d/%d", value, index, count, err, want[0], want[1])
+		}
+	}
+	for _, value := range []string{"", "2", "2/", "/8", "a/8", "2/b", "2/8/1", "0/8", "9/8", "-1/8", "1/0", "2.5/8"} {
+		if index, count, err := ParseShard(value); err == nil {
+			t.Errorf("ParseShard(%q) = %d, %d; want an error", value, index, count)
+		}
+	}
+}
+
+// TestShardOf checks that every URL has one shard, the same every time,
+// and that the shards share the URLs out.
+func TestShardOf(t *testing.T) {
+	counts := make([]int, 5)
+	for i := range 1000 {
+		pageURL := fmt.Sprintf("http://example.com/page/%d", i)
+		shard := ShardOf(pageURL, 4)
+		if shard < 1 || shard > 4 {
+			t.Fatalf("ShardOf(%s, 4) = %d, want 1 to 4", pageURL, shard)
+		}
+		if again := ShardOf(pageURL, 4); again != shard {
+			t.Fatalf("ShardOf(%s, 4) gave %d, then %d", pageURL, shard, again)
+		}
+		counts[shard]++
+		if ShardOf(pageURL, 1) != 1 {
+			t.Fatalf("ShardOf(%s, 1) is not 1", pageURL)
+		}
+	}
+	for shard, n := range counts[1:] {
+		if n < 200 || n > 300 {
+			t.Errorf("shard %d has %d of 1000 URLs, want about 250", shard+1, n)
+		}
+	}
+}
+
+// shardSite serves a home page linking to ten sections of two pages, and
+// a redirect to one of them.
+func shardSite(t *testing.T) *testSite {
+	routes := map[string]http.HandlerFunc{"/moved": redirect("/s3/a")}
+	var links strings.Builder
+	links.WriteString(`<a href="/moved">moved</a> `)
+	for i := range 10 {
+		section := fmt.Sprintf("/s%d", i)
+		fmt.Fprintf(&links, `<a href="%s">%d</a> `, section, i)
+		routes[section] = htmlPage(fmt.Sprintf(`<a href="%s/a">a</a> <a href="%s/b">b</a>`, section, section))
+		routes[section+"/a"] = htmlPage(`<a href="/">home</a>`)
+		routes[section+"/b"] = htmlPage(`<a href="/s0">first</a>`)
+	}
+	routes["/"] = htmlPage(links.String())
+	return newTestSite(t, routes)
+}
+
+// crawlShards crawls site in count shards exchanging URLs through a
+// handoff directory, in rounds that resume the results of the last, until
+// no shard is handed new URLs. It returns the results of the last round.
+func crawlShards(t *testing.T, site *testSite, count int) []*CrawlResult {
+	t.Helper()
+	dir := t.TempDir()
+	handoff := filepath.Join(dir, "handoff")
+	shards := make([]*CrawlResult, count)
+	for round := 1; ; round++ {
+		if round > 10 {
+			t.Fatal("the shards still hand over URLs after 10 rounds")
+		}
+		seeded := 0
+		for i := range shards {
+			opts := []Option{WithShard(i+1, count, handoff)}
+			if shards[i] != nil {
+				opts = append(opts, WithResume(shards[i], false))
+			}
+			result := crawlTestSite(t, site.URL, 2, opts...)
+			if result.Shard == nil || result.Shard.Index != i+1 || result.Shard.Count != count || result.Shard.Hash != ShardHash {
+				t.Fatalf("shard %d/%d: shard info %+v", i+1, count, result.Shard)
+			}
+			seeded += result.Shard.Seeded
+
+			// Rounds resume the saved results, as the command does.
+			filename := filepath.Join(dir, fmt.Sprintf("shard%d.json", i+1))
+			if err := SaveResults(filename, result); err != nil {
+				t.Fatal(err)
+			}
+			saved, err := LoadResults(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			shards[i] = saved
+		}
+		if round > 1 && seeded == 0 {
+			return shards
+		}
+	}
+}
+
+// reachedURLs lists the URLs of the stored pages of result and those their
+// redirects lead to, sorted.
+func reachedURLs(result *CrawlResult) []string {
+	var urls []string
+	for _, page := range result.Pages {
+		urls = append(urls, page.URL)
+		if page.FinalURL != "" {
+			urls = append(urls, page.FinalURL)
+		}
+	}
+	slices.Sort(urls)
+	return slices.Compact(urls)
+}
+
+// TestCrawlShards crawls a site in three shards and checks that each only
+// fetches its own URLs, and that the merged results are those of a single
+// crawl.
+func TestCrawlShards(t *testing.T) {
+	site := shardSite(t)
+	shards := crawlShards(t, site, 3)
+
+	site.lock.Lock()
+	for path, n := range site.requests {
+		// The redirect target is fetched by its shard and through the
+		// redirect.
+		if n != 1 && path != "/s3/a" {
+			t.Errorf("%s was requested %d times by the shards, want once", path, n)
+		}
+	}
+	site.lock.Unlock()
+	for _, shard := range shards {
+		for _, page := range shard.Pages {
+			if ShardOf(page.URL, 3) != shard.Shard.Index {
+				t.Errorf("shard %d stored %s of shard %d", shard.Shard.Index, page.URL, ShardOf(page.URL, 3))
+			}
+		}
+	}
+
+	single := crawlTestSite(t, site.URL, 2)
+	merged, err := MergeShards([]*CrawlResult{shards[2], shards[0], shards[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reachedURLs(merged), reachedURLs(single); !slices.Equal(got, want) {
+		t.Errorf("merged pages reach %q, a single crawl %q", got, want)
+	}
+	for _, page := range single.Pages {
+		if found := findPage(merged, "", page.URL); found == nil || found.Depth != page.Depth {
+			t.Errorf("%s merged as %+v, want it at depth %d", page.URL, found, page.Depth)
+		}
+	}
+	// A redirect to a page of another shard becomes an alias of the page
+	// that shard stored.
+	moved, target := findPage(merged, site.URL, "/moved"), findPage(merged, site.URL, "/s3/a")
+	if moved == nil || moved.FinalURL != site.URL+"/s3/a" {
+		t.Errorf("merged redirect %+v, want it to lead to /s3/a", moved)
+	} else if ShardOf(moved.URL, 3) != ShardOf(moved.FinalURL, 3) && (!moved.Alias || target == nil || target.Alias) {
+		t.Errorf("merged redirect %+v to %+v, want an alias of the stored target", moved, target)
+	}
+	if merged.Shard != nil || merged.Config == nil || merged.Config.Shard != "" {
+		t.Errorf("the merged results are still those of a shard: %+v, %+v", merged.Shard, merged.Config)
+	}
+	if merged.DiscoveredURLs != single.DiscoveredURLs || merged.TotalPages != len(merged.Pages) {
+		t.Errorf("merged %d URLs discovered and %d pages; a single crawl discovered %d", merged.DiscoveredURLs, merged.TotalPages, single.DiscoveredURLs)
+	}
+	fetched := 0
+	for _, shard := range shards {
+		fetched += shard.FetchedURLs
+	}
+	if merged.FetchedURLs != fetched {
+		t.Errorf("merged %d fetched URLs, the shards fetched %d", merged.FetchedURLs, fetched)
+	}
+}
+
+func TestMergeShardsErrors(t *testing.T) {
+	site := shardSite(t)
+	shards := crawlShards(t, site, 2)
+	other := crawlTestSite(t, site.URL, 1, WithShard(2, 2, ""))
+	plain := crawlTestSite(t, site.URL, 2)
+	three := crawlTestSite(t, site.URL, 2, WithShard(3, 3, ""))
+
+	misplaced := *shards[1]
+	misplaced.Pages = append(slices.Clone(shards[1].Pages), shards[0].Pages[0])
+
+	tests := []struct {
+		name   string
+		shards []*CrawlResult
+		want   string
+	}{
+		{"none", nil, "no shard results to merge"},
+		{"not a shard", []*CrawlResult{shards[0], plain}, "are not a shard"},
+		{"missing shard", []*CrawlResult{shards[1]}, "missing shards 1 of 2"},
+		{"shard twice", []*CrawlResult{shards[0], shards[0], shards[1]}, "shard 1/2 is given twice"},
+		{"other count", []*CrawlResult{shards[0], three}, "does not belong to a 2-shard crawl"},
+		{"other scope", []*CrawlResult{shards[0], other}, "was crawled with a different max_depth"},
+		{"page of another shard", []*CrawlResult{shards[0], &misplaced}, "which belongs to shard 1"},
+	}
+	for _, tt := range tests {
+		if _, err := MergeShards(tt.shards); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
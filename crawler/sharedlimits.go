@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// limitIdleTimeout is how long a host entry of a LimitRegistry is kept
+// after its last use. By then its rate limiter has no delay left to carry
+// over, only the slow-down of throttling, which a new entry starts without.
+const limitIdleTimeout = 5 * time.Minute
+
+// LimitRegistry holds per-host request budgets shared by every Crawler it
+// is passed to with WithSharedLimits, so several crawls of one host
+// together stay within one budget. It is safe for concurrent use. Hosts
+// are added when first used and dropped once idle.
+type LimitRegistry struct {
+	requestsPerSecond float64
+	maxInFlight       int
+
+	lock  sync.Mutex
+	hosts map[string]*hostLimit
+}
+
+// hostLimit is the shared budget of one host. users counts the crawls
+// holding it and the requests in flight; it is never dropped while used.
+type hostLimit struct {
+	limiter  *rateLimiter
+	slots    chan struct{}
+	users    int
+	lastUsed time.Time
+}
+
+// NewLimitRegistry returns a registry allowing requestsPerSecond page
+// requests per host across its crawlers and, unless maxInFlight is zero,
+// at most maxInFlight requests in flight per host, redirect hops, sitemaps
+// and asset checks included.
+func NewLimitRegistry(requestsPerSecond float64, maxInFlight int) (*LimitRegistry, error) {
+	if !(requestsPerSecond > 0) {
+		return nil, fmt.Errorf("requests per second must be greater than 0")
+	}
+	if maxInFlight < 0 {
+		return nil, fmt.Errorf("max in flight must not be negative")
+	}
+	return &LimitRegistry{
+		requestsPerSecond: requestsPerSecond,
+		maxInFlight:       maxInFlight,
+		hosts:             make(map[string]*hostLimit),
+	}, nil
+}
+
+// WithSharedLimits makes the crawler respect the per-host budgets of
+// registry, shared with the other crawlers using it. The crawler's own
+// rate still applies, so each crawl goes no faster than either.
+func WithSharedLimits(registry *LimitRegistry) Option {
+	return func(c *Crawler) {
+		c.sharedLimits = registry
+	}
+}
+
+// acquire returns the entry of host, creating it if needed, and marks it
+// in use until release. Idle entries of other hosts are dropped.
+func (r *LimitRegistry) acquire(host string) *hostLimit {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	for name, limit := range r.hosts {
+		if limit.users == 0 && now.Sub(limit.lastUsed) > limitIdleTimeout {
+			delete(r.hosts, name)
+		}
+	}
+	limit, ok := r.hosts[host]
+	if !ok {
+		limit = &hostLimit{limiter: newRateLimiter(r.requestsPerSecond)}
+		if r.maxInFlight > 0 {
+			limit.slots = make(chan struct{}, r.maxInFlight)
+		}
+		r.hosts[host] = limit
+	}
+	limit.users++
+	return limit
+}
+
+func (r *LimitRegistry) release(limit *hostLimit) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	limit.users--
+	limit.lastUsed = time.Now()
+}
+
+// Hosts returns the number of hosts the registry currently tracks.
+func (r *LimitRegistry) Hosts() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.hosts)
+}
+
+// sharedSlots is the innermost fetcher of a crawl with WithSharedLimits:
+// every request waits for a slot of its host before it is sent and holds
+// it until its response body is closed.
+func (c *Crawler) sharedSlots(next Fetcher) Fetcher {
+	return fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		limit := c.sharedLimits.acquire(normalizeHost(req.URL.Scheme, req.URL.Host))
+		done := func() { c.sharedLimits.release(limit) }
+		if limit.slots != nil {
+			select {
+			case limit.slots <- struct{}{}:
+			case <-req.Context().Done():
+				done()
+				return nil, req.Context().Err()
+			}
+			done = func() {
+				<-limit.slots
+				c.sharedLimits.release(limit)
+			}
+		}
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			done()
+			return nil, err
+		}
+		resp.Body = &releasingBody{ReadCloser: resp.Body, done: done}
+		return resp, nil
+	})
+}
+
+// releasingBody calls done once, when the body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
@@ -0,0 +1,165 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sectionSite serves two sections of n linked pages each, /docs and
+// /blog, calling observe for every request.
+func sectionSite(t *testing.T, n int, observe func(r *http.Request)) *testSite {
+	routes := make(map[string]http.HandlerFunc)
+	for _, section := range []string{"/docs", "/blog"} {
+		var links strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&links, `<a href="%s/%d">%d</a> `, section, i, i)
+			routes[fmt.Sprintf("%s/%d", section, i)] = htmlPage("page")
+		}
+		routes[section] = htmlPage(links.String())
+	}
+	for path, handler := range routes {
+		routes[path] = func(w http.ResponseWriter, r *http.Request) {
+			observe(r)
+			handler(w, r)
+		}
+	}
+	return newTestSite(t, routes)
+}
+
+// crawlSections crawls both sections of site at once, each with its own
+// crawler at 1000 requests per second, and returns the pages stored.
+func crawlSections(t *testing.T, site *testSite, opts ...Option) int {
+	t.Helper()
+	var wg sync.WaitGroup
+	var pages atomic.Int32
+	for _, section := range []string{"/docs", "/blog"} {
+		c, err := NewCrawler(site.URL+section, 1, 1000, append([]Option{WithLogOutput(io.Discard)}, opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := c.Start(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			pages.Add(int32(len(result.Pages)))
+		}()
+	}
+	wg.Wait()
+	return int(pages.Load())
+}
+
+// TestSharedLimitsRate runs two crawlers against one host and checks that
+// together they keep to the rate of their registry.
+func TestSharedLimitsRate(t *testing.T) {
+	const rps = 50
+	var lock sync.Mutex
+	var times []time.Time
+	site := sectionSite(t, 15, func(r *http.Request) {
+		lock.Lock()
+		times = append(times, time.Now())
+		lock.Unlock()
+	})
+	limits, err := NewLimitRegistry(rps, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages := crawlSections(t, site, WithSharedLimits(limits)); pages != 32 {
+		t.Fatalf("stored %d pages, want 32", pages)
+	}
+
+	slices.SortFunc(times, func(a, b time.Time) int { return a.Compare(b) })
+	// The first request goes out at once, each later one an interval after
+	// the one before, give or take the scheduling of the timers.
+	span := times[len(times)-1].Sub(times[0])
+	want := time.Duration(len(times)-1) * time.Second / rps
+	if span < want*9/10 {
+		t.Errorf("%d requests took %s, want at least %s at %d per second", len(times), span, want, rps)
+	}
+}
+
+// TestSharedLimitsInFlight checks that two crawlers sharing a registry
+// keep to its limit of requests in flight per host.
+func TestSharedLimitsInFlight(t *testing.T) {
+	var inFlight, most atomic.Int32
+	site := sectionSite(t, 10, func(r *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			m := most.Load()
+			if n <= m || most.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		inFlight.Add(-1)
+	})
+	limits, err := NewLimitRegistry(1000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages := crawlSections(t, site, WithSharedLimits(limits)); pages != 22 {
+		t.Fatalf("stored %d pages, want 22", pages)
+	}
+	if n := most.Load(); n > 2 {
+		t.Errorf("%d requests were in flight at once, want at most 2", n)
+	}
+	if n := limits.Hosts(); n != 1 {
+		t.Errorf("the registry tracks %d hosts, want 1", n)
+	}
+}
+
+func TestLimitRegistryDropsIdleHosts(t *testing.T) {
+	limits, err := NewLimitRegistry(10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle := limits.acquire("http://idle.example")
+	limits.release(idle)
+	busy := limits.acquire("http://busy.example")
+	if n := limits.Hosts(); n != 2 {
+		t.Fatalf("the registry tracks %d hosts, want 2", n)
+	}
+
+	// An entry is kept for limitIdleTimeout after its last use, and while
+	// in use however long ago it was last released.
+	limits.release(limits.acquire("http://other.example"))
+	if n := limits.Hosts(); n != 3 {
+		t.Errorf("the registry tracks %d hosts before the timeout, want 3", n)
+	}
+	limits.lock.Lock()
+	for _, limit := range limits.hosts {
+		limit.lastUsed = time.Now().Add(-limitIdleTimeout - time.Second)
+	}
+	limits.lock.Unlock()
+	if again := limits.acquire("http://new.example"); again == idle {
+		t.Error("a new host got the entry of another")
+	}
+	if n := limits.Hosts(); n != 2 {
+		t.Errorf("the registry tracks %d hosts after the timeout, want the busy and the new one", n)
+	}
+	if limits.acquire("http://busy.example") != busy {
+		t.Error("the entry of a host in use was dropped")
+	}
+}
+
+func TestNewLimitRegistry(t *testing.T) {
+	for _, tt := range []struct {
+		rps         float64
+		maxInFlight int
+	}{{0, 1}, {-1, 1}, {1, -1}} {
+		if _, err := NewLimitRegistry(tt.rps, tt.maxInFlight); err == nil {
+			t.Errorf("NewLimitRegistry(%v, %d) gave no error", tt.rps, tt.maxInFlight)
+		}
+	}
+}
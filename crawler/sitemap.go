@@ -0,0 +1,203 @@
+package crawler
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// maxSitemapFiles bounds the sitemaps read through sitemap indexes.
+	maxSitemapFiles = 100
+
+	// maxSitemapSize is the size limit of the sitemap protocol.
+	maxSitemapSize = 50 << 20
+)
+
+// WithSitemap seeds the crawl with the URLs listed in the sitemap at
+// sitemapURL, which may be a path relative to the base URL. Sitemap indexes
+// are followed. Listed URLs are crawled at depth 0 like the seed, after the
+// same domain and filter checks as links, so pages are covered whether or
+// not anything links to them.
+func WithSitemap(sitemapURL string) Option {
+	return func(c *Crawler) {
+		c.sitemapURL = sitemapURL
+	}
+}
+
+// sitemapDocument is either a urlset or a sitemapindex.
+type sitemapDocument struct {
+	URLs     []sitemapEntry
+	Sitemaps []sitemapEntry
+}
+
+// sitemapEntry is a <url> or <sitemap> element, with the line it starts
+// on.
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	Lastmod string `xml:"lastmod"`
+	line    int
+}
+
+// sitemapSeed is a page URL listed in a sitemap.
+type sitemapSeed struct {
+	url     string
+	sitemap string
+}
+
+// loadSitemap reads the configured sitemap and the sitemaps it indexes and
+// returns the crawlable URLs they list. Sitemaps that cannot be read are
+// logged and skipped.
+func (c *Crawler) loadSitemap() []sitemapSeed {
+	start, err := c.baseURL.Parse(c.sitemapURL)
+	if err != nil {
+		c.logf("Warning: invalid sitemap URL %q: %v\n", c.sitemapURL, err)
+		return nil
+	}
+
+	var seeds []sitemapSeed
+	seen := make(map[string]bool)
+	queue := []string{start.String()}
+	queued := map[string]bool{queue[0]: true}
+	for files := 0; len(queue) > 0 && files < maxSitemapFiles; files++ {
+		sitemapURL := queue[0]
+		queue = queue[1:]
+		doc, err := c.fetchSitemap(sitemapURL)
+		c.noteSitemap(sitemapURL, doc, err)
+		if err != nil {
+			c.logf("Warning: cannot read sitemap %s: %v\n", sitemapURL, err)
+			continue
+		}
+		// Entries are checked as declared; only the problematic ones are
+		// kept, as sitemaps can list millions of URLs.
+		var declared []DeclaredURL
+		for _, entry := range doc.Sitemaps {
+			loc := strings.TrimSpace(entry.Loc)
+			declared = append(declared, DeclaredURL{Kind: DeclaredSitemap, URL: loc, DeclaredOn: sitemapURL})
+			if loc != "" && !queued[loc] {
+				queued[loc] = true
+				queue = append(queue, loc)
+			}
+		}
+		listed, outOfScope := 0, 0
+		for i, entry := range doc.URLs {
+			loc := strings.TrimSpace(entry.Loc)
+			declared = append(declared, DeclaredURL{Kind: DeclaredSitemap, URL: loc, DeclaredOn: sitemapURL})
+			u, err := c.baseURL.Parse(loc)
+			if err != nil {
+				// validateSitemap reports the entry as an invalid URL.
+				outOfScope++
+				continue
+			}
+			pageURL, status, reason := c.linkStatus(u, -1, sitemapURL)
+			if seen[pageURL] {
+				continue
+			}
+			seen[pageURL] = true
+			if isForeignEdge(status) || isSkippedEdge(status) {
+				if status != EdgePruned {
+					outOfScope++
+				}
+				// Other schemes are reported as invalid URLs.
+				if status != EdgePruned && status != EdgeUnsupportedScheme {
+					c.noteOutOfScope(sitemapURL, len(doc.Sitemaps)+i+1, entry, status, reason)
+				}
+				continue
+			}
+			seeds = append(seeds, sitemapSeed{url: pageURL, sitemap: sitemapURL})
+			c.noteListed(pageURL, sitemapURL, len(doc.Sitemaps)+i+1, entry)
+			listed++
+		}
+		c.noteSitemapScope(listed, outOfScope)
+		c.sitemapFindings = append(c.sitemapFindings, FindURLMisconfigurations(declared, c.baseURL, c.knownHosts)...)
+		if outOfScope > 0 {
+			c.logf("Sitemap %s: %d URLs to crawl, %d out of scope\n", sitemapURL, listed, outOfScope)
+		} else {
+			c.logf("Sitemap %s: %d URLs to crawl\n", sitemapURL, listed)
+		}
+	}
+	if len(queue) > 0 {
+		c.logf("Warning: more than %d sitemaps, skipping %d\n", maxSitemapFiles, len(queue))
+	}
+	return seeds
+}
+
+// fetchSitemap downloads and parses one sitemap, gzipped or not, waiting
+// on the crawl rate limiter first.
+func (c *Crawler) fetchSitemap(sitemapURL string) (*sitemapDocument, error) {
+	c.waitRate()
+	req, err := c.newRequest(sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req.WithContext(c.ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	body := &countingReader{r: resp.Body}
+	defer func() { c.addBytesFetched(body.n) }()
+	var source io.Reader = body
+	if strings.HasSuffix(resp.Request.URL.Path, ".gz") {
+		gz, err := gzip.NewReader(io.LimitReader(body, maxSitemapSize))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		source = gz
+	}
+	reader := &io.LimitedReader{R: source, N: maxSitemapSize}
+
+	doc, err := decodeSitemap(reader)
+	if err != nil {
+		// A sitemap cut short at the limit cannot be parsed.
+		if reader.N == 0 {
+			if n, _ := source.Read(make([]byte, 1)); n > 0 {
+				return nil, errSitemapTooLarge
+			}
+		}
+		return nil, fmt.Errorf("%w: %v", ErrParse, err)
+	}
+	return doc, nil
+}
+
+// decodeSitemap reads the <url> and <sitemap> entries of the root element
+// of a sitemap, noting the line of each.
+func decodeSitemap(r io.Reader) (*sitemapDocument, error) {
+	var doc sitemapDocument
+	decoder := xml.NewDecoder(r)
+	for depth := 0; ; {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if depth == 1 && (t.Name.Local == "url" || t.Name.Local == "sitemap") {
+				line, _ := decoder.InputPos()
+				entry := sitemapEntry{line: line}
+				if err := decoder.DecodeElement(&entry, &t); err != nil {
+					return nil, err
+				}
+				if t.Name.Local == "url" {
+					doc.URLs = append(doc.URLs, entry)
+				} else {
+					doc.Sitemaps = append(doc.Sitemaps, entry)
+				}
+				continue
+			}
+			depth++
+		case xml.EndElement:
+			if depth--; depth == 0 {
+				return &doc, nil
+			}
+		}
+	}
+}
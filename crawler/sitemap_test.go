@@ -0,0 +1,183 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// scopeSite serves a sitemap and a feed mixing URLs to crawl with URLs on
+// another host, filtered by /private, vetoed by the scope hook, dangerous
+// and malformed.
+func scopeSite(t *testing.T) *testSite {
+	var site *testSite
+	xmlFile := func(format string, locs []string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/xml")
+			var b strings.Builder
+			for _, loc := range locs {
+				fmt.Fprintf(&b, format, strings.ReplaceAll(loc, "{site}", site.URL))
+			}
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>%s`, wrapXML(r.URL.Path, b.String()))
+		}
+	}
+	site = newTestSite(t, map[string]http.HandlerFunc{
+		"/": htmlPage("home"),
+		"/sitemap.xml": xmlFile("<url><loc>%s</loc></url>\n", []string{
+			"{site}/a",
+			"{site}/b",
+			"{site}/a",
+			"http://other.example/listed",
+			"{site}/private/listed",
+			"{site}/vetoed",
+			"{site}/logout",
+			"mailto:listed@example.com",
+			"http://[bad host/",
+		}),
+		"/feed.xml": xmlFile("<item><title>item</title><link>%s</link></item>\n", []string{
+			"{site}/c",
+			"/b",
+			"http://other.example/item",
+			"{site}/private/item",
+			"{site}/vetoed",
+		}),
+		"/a":       htmlPage("a"),
+		"/b":       htmlPage("b"),
+		"/c":       htmlPage("c"),
+		"/private": htmlPage("private"),
+		"/vetoed":  htmlPage("vetoed"),
+		"/logout":  htmlPage("logout"),
+	})
+	return site
+}
+
+// wrapXML wraps entries in the root elements of a sitemap or of a feed.
+func wrapXML(path, entries string) string {
+	if path == "/sitemap.xml" {
+		return `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n" + entries + "</urlset>\n"
+	}
+	return `<rss version="2.0"><channel><title>feed</title>` + "\n" + entries + "</channel></rss>\n"
+}
+
+// vetoScope rejects /vetoed.
+func vetoScope(u *url.URL, depth int, foundOn string) (bool, string) {
+	if u.Path == "/vetoed" {
+		return false, "vetoed by the test"
+	}
+	return true, ""
+}
+
+// TestSitemapScope checks that sitemap entries pass the checks of links,
+// and that the hygiene report counts and explains the ones not crawled.
+func TestSitemapScope(t *testing.T) {
+	site := scopeSite(t)
+	var log strings.Builder
+	c, err := NewCrawler(site.URL, 0, 1000, WithLogOutput(&log), WithSitemap("/sitemap.xml"), WithSiteHygiene(),
+		WithURLFilters(nil, []string{"/private"}), WithScopeFunc(vetoScope))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/a", "/b"} {
+		if page := findPage(result, site.URL, path); page == nil || page.Depth != 0 {
+			t.Errorf("%s: %+v, want it crawled at depth 0", path, page)
+		}
+		if n := site.requested(path); n != 1 {
+			t.Errorf("%s was requested %d times, want once", path, n)
+		}
+	}
+	for _, path := range []string{"/private/listed", "/vetoed", "/logout"} {
+		if n := site.requested(path); n != 0 {
+			t.Errorf("%s was requested %d times, want never", path, n)
+		}
+	}
+	if len(result.Pages) != 3 {
+		t.Errorf("stored %d pages, want /, /a and /b", len(result.Pages))
+	}
+
+	h := result.SiteHygiene
+	if h == nil {
+		t.Fatal("no hygiene report")
+	}
+	var file *HygieneFile
+	for i := range h.Files {
+		if h.Files[i].Kind == HygieneSitemap {
+			file = &h.Files[i]
+		}
+	}
+	// The duplicate of /a is counted once; the mailto and the unparsable
+	// entry are out of scope too.
+	if file == nil || file.Entries != 9 || file.InScope != 2 || file.OutOfScope != 6 {
+		t.Errorf("sitemap file %+v, want 9 entries, 2 in scope and 6 out of scope", file)
+	}
+	if !strings.Contains(log.String(), "/sitemap.xml: 2 URLs to crawl, 6 out of scope") {
+		t.Errorf("the log does not give both counts:\n%s", log.String())
+	}
+
+	want := map[string]string{
+		"http://other.example/listed": "the URL is on another host (off-domain)",
+		site.URL + "/private/listed":  "the URL does not pass the include and exclude patterns (filtered",
+		site.URL + "/vetoed":          "the scope hook rejected the URL (out-of-scope: vetoed by the test)",
+		site.URL + "/logout":          "the URL looks like an action (dangerous-url: ",
+	}
+	for _, f := range h.Findings {
+		if f.Problem != HygieneOutOfScope {
+			continue
+		}
+		detail, ok := want[f.URL]
+		if !ok {
+			t.Errorf("unexpected out-of-scope finding %+v", f)
+			continue
+		}
+		if !strings.HasPrefix(f.Detail, detail) || f.Entry == 0 || f.File != site.URL+"/sitemap.xml" {
+			t.Errorf("finding %+v, want detail %q", f, detail)
+		}
+		delete(want, f.URL)
+	}
+	for url := range want {
+		t.Errorf("no out-of-scope finding for %s", url)
+	}
+}
+
+// TestFeedScope checks that feed items pass the checks of links.
+func TestFeedScope(t *testing.T) {
+	site := scopeSite(t)
+	c, err := NewCrawler(site.URL, 0, 1000, WithLogOutput(io.Discard), WithFeeds([]string{"/feed.xml"}),
+		WithURLFilters(nil, []string{"/private"}), WithScopeFunc(vetoScope))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		site.URL + "/c":             EdgeCrawled,
+		site.URL + "/b":             EdgeCrawled,
+		"http://other.example/item": EdgeOffDomain,
+		site.URL + "/private/item":  EdgeFiltered,
+		site.URL + "/vetoed":        EdgeOutOfScope,
+	}
+	if len(result.FeedItems) != len(want) {
+		t.Errorf("feed items %+v, want %d", result.FeedItems, len(want))
+	}
+	for _, item := range result.FeedItems {
+		if status, ok := want[item.URL]; !ok || item.Status != status {
+			t.Errorf("item %+v, want status %q", item, status)
+		}
+	}
+	for path, n := range map[string]int{"/c": 1, "/b": 1, "/private/item": 0, "/vetoed": 0} {
+		if got := site.requested(path); got != n {
+			t.Errorf("%s was requested %d times, want %d", path, got, n)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// SlowPattern rate-limits URLs matching Pattern, a regular expression
+// matched against normalized URLs like include and exclude, to RPS requests
+// per second. The limit applies in addition to the crawl-wide -rps.
+type SlowPattern struct {
+	Pattern string  `yaml:"pattern"`
+	RPS     float64 `yaml:"rps"`
+}
+
+type slowLimiter struct {
+	re       *regexp.Regexp
+	interval time.Duration
+	tick     <-chan time.Time
+}
+
+// WithSlowPatterns gates URLs matching any of patterns by an extra limiter
+// per pattern. A URL is gated by the first pattern it matches.
+func WithSlowPatterns(patterns []SlowPattern) Option {
+	return func(c *Crawler) {
+		c.slowPatterns = patterns
+	}
+}
+
+func compileSlowPatterns(patterns []SlowPattern) ([]slowLimiter, error) {
+	limiters := make([]slowLimiter, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", p.Pattern, err)
+		}
+		if !(p.RPS > 0) {
+			return nil, fmt.Errorf("pattern %q: rps must be greater than 0", p.Pattern)
+		}
+		interval := time.Duration(float64(time.Second) / p.RPS)
+		limiters = append(limiters, slowLimiter{re: re, interval: interval, tick: time.Tick(interval)})
+	}
+	return limiters, nil
+}
+
+// waitSlowPattern blocks on the limiter of the first slow pattern matching
+// pageURL. URLs matching no pattern return immediately.
+func (c *Crawler) waitSlowPattern(pageURL string) {
+	for _, limiter := range c.slowLimiters {
+		if !limiter.re.MatchString(pageURL) {
+			continue
+		}
+		start := time.Now()
+		select {
+		case <-limiter.tick:
+		case <-c.ctx.Done():
+			return
+		}
+		c.debugf("Slow pattern %q (one request per %s): waited %s for %s",
+			limiter.re, limiter.interval, time.Since(start).Round(time.Millisecond), pageURL)
+		return
+	}
+}
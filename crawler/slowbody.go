@@ -0,0 +1,97 @@
+package crawler
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Defaults of WithBodyProgress: a page body must arrive at 1 KB per 10
+// seconds or more.
+const (
+	DefaultBodyProgressBytes  = 1024
+	DefaultBodyProgressWindow = 10 * time.Second
+)
+
+// ErrSlowBody reports a response body that arrived too slowly and was
+// abandoned before any of it could be read.
+var ErrSlowBody = errors.New("response body too slow")
+
+type bodyProgressOptions struct {
+	minBytes int64
+	window   time.Duration
+}
+
+// WithBodyProgress abandons reading a page body when fewer than minBytes
+// bytes arrive within a window, so a server trickling its answer does not
+// hold a worker for the whole timeout. What arrived is parsed and the page
+// marked SlowBodyAborted; a body abandoned empty fails with ErrSlowBody.
+// A zero minBytes or window disables the check.
+func WithBodyProgress(minBytes int64, window time.Duration) Option {
+	return func(c *Crawler) {
+		c.bodyProgress = bodyProgressOptions{minBytes: minBytes, window: window}
+	}
+}
+
+func (o bodyProgressOptions) enabled() bool {
+	return o.minBytes > 0 && o.window > 0
+}
+
+// progressReader reads a response body and calls abort, which must make the
+// pending Read fail, when a window passes with fewer than minBytes read.
+type progressReader struct {
+	r        io.Reader
+	minBytes int64
+	window   time.Duration
+	abort    func()
+
+	lock    sync.Mutex
+	n       int64
+	timer   *time.Timer
+	aborted bool
+	done    bool
+}
+
+func newProgressReader(r io.Reader, o bodyProgressOptions, abort func()) *progressReader {
+	p := &progressReader{r: r, minBytes: o.minBytes, window: o.window, abort: abort}
+	p.timer = time.AfterFunc(o.window, p.check)
+	return p
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.lock.Lock()
+	p.n += int64(n)
+	p.lock.Unlock()
+	return n, err
+}
+
+// check ends a window, aborting the read if it was too slow.
+func (p *progressReader) check() {
+	p.lock.Lock()
+	if p.done {
+		p.lock.Unlock()
+		return
+	}
+	if p.n < p.minBytes {
+		p.aborted = true
+		p.done = true
+		p.lock.Unlock()
+		p.abort()
+		return
+	}
+	p.n = 0
+	p.timer.Reset(p.window)
+	p.lock.Unlock()
+}
+
+// stop ends the watch once reading is over and reports whether the read was
+// aborted.
+func (p *progressReader) stop() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.done = true
+	p.timer.Stop()
+	return p.aborted
+}
@@ -0,0 +1,154 @@
+package crawler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// drip answers with head at once, then with one byte of tail per interval.
+func drip(head, tail string, interval time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, head)
+		w.(http.Flusher).Flush()
+		for i := 0; i < len(tail); i++ {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(interval):
+			}
+			io.WriteString(w, tail[i:i+1])
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	opts := bodyProgressOptions{minBytes: 10, window: 50 * time.Millisecond}
+
+	// A body sending enough in every window is read in full.
+	r, w := io.Pipe()
+	var aborts atomic.Int32
+	p := newProgressReader(r, opts, func() { aborts.Add(1); r.CloseWithError(errors.New("aborted")) })
+	go func() {
+		for i := 0; i < 8; i++ {
+			w.Write([]byte(strings.Repeat("x", 10)))
+			time.Sleep(20 * time.Millisecond)
+		}
+		w.Close()
+	}()
+	content, err := io.ReadAll(p)
+	if err != nil || len(content) != 80 {
+		t.Errorf("read %d bytes, %v; want all 80", len(content), err)
+	}
+	if p.stop() || aborts.Load() != 0 {
+		t.Error("a body arriving fast enough was aborted")
+	}
+
+	// One too slow over a window is aborted, keeping what was read.
+	r, w = io.Pipe()
+	p = newProgressReader(r, opts, func() { aborts.Add(1); r.CloseWithError(errors.New("aborted")) })
+	go func() {
+		w.Write([]byte("abc"))
+		for i := 0; i < 100; i++ {
+			if _, err := w.Write([]byte("x")); err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	start := time.Now()
+	content, err = io.ReadAll(p)
+	if err == nil || !strings.HasPrefix(string(content), "abc") {
+		t.Errorf("read %q, %v; want the start and the abort error", content, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("aborting took %s", elapsed)
+	}
+	if !p.stop() || aborts.Load() != 1 {
+		t.Errorf("stop reports no abort, or abort was called %d times", aborts.Load())
+	}
+
+	// Stopping ends the watch.
+	p = newProgressReader(strings.NewReader(""), opts, func() { aborts.Add(1) })
+	p.stop()
+	time.Sleep(2 * opts.window)
+	if aborts.Load() != 1 {
+		t.Error("a stopped reader was aborted")
+	}
+}
+
+func TestCrawlSlowBody(t *testing.T) {
+	fast := "<html><head><title>Fast</title></head><body>" + strings.Repeat("<p>large and fast</p>", 50000) + "</body></html>"
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/": htmlPage(`<a href="/trickle">t</a> <a href="/silent">s</a> <a href="/fast">f</a>`),
+		"/trickle": drip(`<html><head><title>Trickle</title></head><body><a href="/next">next</a>`,
+			strings.Repeat(" ", 1000), 20*time.Millisecond),
+		"/silent": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+		},
+		"/fast": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, fast)
+		},
+		"/next": htmlPage("next"),
+	})
+	start := time.Now()
+	result := crawlTestSite(t, site.URL, 2, WithBodyProgress(100, 200*time.Millisecond))
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("the crawl took %s; slow bodies were not abandoned", elapsed)
+	}
+
+	trickle := findPage(result, site.URL, "/trickle")
+	if trickle == nil {
+		t.Fatal("/trickle is not stored")
+	}
+	if !trickle.SlowBodyAborted || trickle.Title != "Trickle" || len(trickle.Links) != 1 {
+		t.Errorf("/trickle: %+v, want the part read parsed and marked aborted", trickle)
+	}
+	if findPage(result, site.URL, "/next") == nil {
+		t.Error("the link of the aborted page is not crawled")
+	}
+
+	var silent *CrawlError
+	for i := range result.Errors {
+		if result.Errors[i].URL == site.URL+"/silent" {
+			silent = &result.Errors[i]
+		}
+	}
+	if silent == nil || silent.Category != CategorySlowBody {
+		t.Errorf("/silent error %+v, want slow-body", silent)
+	}
+
+	page := findPage(result, site.URL, "/fast")
+	if page == nil || page.SlowBodyAborted || page.MalformedHTML || page.Title != "Fast" || page.Size != int64(len(fast)) {
+		t.Errorf("the large fast page is not read in full: %+v", page)
+	}
+	if home := findPage(result, site.URL, "/"); home == nil || home.SlowBodyAborted {
+		t.Errorf("home: %+v", home)
+	}
+}
+
+// TestCrawlSlowBodyDisabled checks that a zero minimum lets a slow body
+// be read to the end.
+func TestCrawlSlowBodyDisabled(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/": drip(`<html><head><title>Trickle</title></head><body>`, "<p>end</p>", 30*time.Millisecond),
+	})
+	result := crawlTestSite(t, site.URL, 0, WithBodyProgress(0, 50*time.Millisecond))
+	page := findPage(result, site.URL, "/")
+	if page == nil || page.SlowBodyAborted || page.Size != int64(len(`<html><head><title>Trickle</title></head><body><p>end</p>`)) {
+		t.Errorf("page %+v, want it read in full", page)
+	}
+}
@@ -0,0 +1,110 @@
+package crawler
+
+import (
+	"time"
+)
+
+// CrawlStats are the progress counters of a crawl.
+type CrawlStats struct {
+	DiscoveredURLs int
+	FetchedURLs    int
+	PagesStored    int
+	Errors         int
+	BytesFetched   int64
+	Elapsed        time.Duration
+	StopReason     string
+	Visited        VisitedStats
+
+	// BrokenAssets is set once the asset check has run.
+	BrokenAssets int
+
+	// FailedValidations counts the failed page checks of WithValidations
+	// once the crawl has finished.
+	FailedValidations int
+}
+
+// Stats returns the current counters. It is cheap and safe to call while
+// Start is running. Each counter is read atomically but not all at the same
+// instant, so a page may be counted as fetched before it is stored.
+func (c *Crawler) Stats() CrawlStats {
+	stats := CrawlStats{
+		DiscoveredURLs: int(c.counters.discovered.Load()),
+		FetchedURLs:    int(c.counters.fetched.Load()),
+		PagesStored:    int(c.counters.pages.Load()),
+		Errors:         int(c.counters.errors.Load()),
+		BytesFetched:   c.counters.bytes.Load(),
+		Visited:        c.visitedStats(),
+	}
+
+	c.resultLock.Lock()
+	defer c.resultLock.Unlock()
+	stats.StopReason = c.result.StopReason
+	if c.result.AssetCheck != nil {
+		stats.BrokenAssets = len(c.result.AssetCheck.Broken)
+	}
+	stats.FailedValidations = failedValidations(c.result.Validations)
+	if !c.result.StartTime.IsZero() {
+		end := c.result.EndTime
+		if end.IsZero() {
+			end = time.Now()
+		}
+		stats.Elapsed = end.Sub(c.result.StartTime)
+	}
+	return stats
+}
+
+// Snapshot returns a copy of the results collected so far, with the
+// counters and coverage computed as of the call. It is safe to call while
+// Start is running. The Pages and Errors slices are copies, but the pages
+// share their link and asset slices with the crawler and must be treated
+// as immutable. Pages spilled to disk are read back, which is slow on
+// large crawls.
+func (c *Crawler) Snapshot() CrawlResult {
+	stats := c.Stats()
+
+	c.resultLock.Lock()
+	defer c.resultLock.Unlock()
+	snapshot := c.result
+	c.counters.syncResult(&snapshot)
+	pages, err := c.allPages()
+	if err != nil {
+		c.logf("Warning: %v, the snapshot only has the pages in memory\n", err)
+		pages = c.result.Pages
+	}
+	snapshot.Pages = append([]PageData(nil), pages...)
+	snapshot.Errors = append([]CrawlError(nil), c.result.Errors...)
+	snapshot.TotalPages = len(snapshot.Pages)
+	if snapshot.EndTime.IsZero() {
+		snapshot.DiscoveredURLs = stats.DiscoveredURLs
+		if snapshot.DiscoveredURLs > 0 {
+			snapshot.Coverage = float64(snapshot.FetchedURLs) / float64(snapshot.DiscoveredURLs)
+		}
+	}
+	return snapshot
+}
+
+// reportProgress prints the crawl counters every interval until done is
+// closed.
+func (c *Crawler) reportProgress(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			stats := c.Stats()
+			c.logf("Progress: %d discovered, %d fetched, %d pages, %d errors, %d bytes in %s, visited set %s\n",
+				stats.DiscoveredURLs, stats.FetchedURLs, stats.PagesStored, stats.Errors,
+				stats.BytesFetched, stats.Elapsed.Round(time.Second), stats.Visited)
+		}
+	}
+}
+
+// WithProgress prints the crawl counters every interval while Start runs.
+// Zero disables progress output.
+func WithProgress(interval time.Duration) Option {
+	return func(c *Crawler) {
+		c.progressInterval = interval
+	}
+}
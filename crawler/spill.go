@@ -0,0 +1,310 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// DefaultRetainPages and DefaultRetainBytes are the limits of
+	// WithResultLimit the command sets by default. Without the option a
+	// crawler keeps every page in memory and writes no temporary file.
+	DefaultRetainPages = 100000
+	DefaultRetainBytes = 1 << 30
+
+	// spillBatchPages is the number of spilled pages read back at a time.
+	spillBatchPages = 4096
+)
+
+// WithResultLimit bounds the pages kept in memory during a crawl by count
+// and by estimated size. Beyond either limit the older pages are moved to
+// a temporary JSON lines file and only the most recent half is retained;
+// post-processing and saving read the spilled pages back one batch at a
+// time. Zero disables a limit; without the option neither applies.
+func WithResultLimit(maxPages int, maxBytes int64) Option {
+	return func(c *Crawler) {
+		c.retain = retainLimits{maxPages: maxPages, maxBytes: maxBytes}
+	}
+}
+
+type retainLimits struct {
+	maxPages int
+	maxBytes int64
+}
+
+// pageSpill is the temporary file holding pages moved out of memory. count
+// is the number of pages written to it in full; once err is set, nothing
+// more is spilled and the pages stay in memory.
+type pageSpill struct {
+	file  *os.File
+	w     *bufio.Writer
+	count int
+	err   error
+}
+
+// estimatePageSize approximates the memory held by page.
+func estimatePageSize(page *PageData) int64 {
+	n := 512 + len(page.URL) + len(page.FinalURL) + len(page.Title) + len(page.FoundOn) + len(page.ContentHash) + len(page.ContentSimHash)
+	for _, link := range page.Links {
+		n += 16 + len(link)
+	}
+	for _, link := range page.LinkDetails {
+		n += 64 + len(link.URL) + len(link.Text)
+	}
+	for _, asset := range page.Assets {
+		n += 48 + len(asset.URL)
+	}
+	for _, link := range page.ExternalLinks {
+		n += 16 + len(link)
+	}
+	for _, hop := range page.RedirectChain {
+		n += 32 + len(hop.URL)
+	}
+	if legacy := page.LegacyMarkup; legacy != nil {
+		n += 48 + 32*(len(legacy.Elements)+len(legacy.Attributes))
+	}
+	return int64(n)
+}
+
+// retainPage accounts for a page just appended to the results and spills
+// the older pages once a limit is exceeded. It must be called with
+// resultLock held.
+func (c *Crawler) retainPage(page *PageData) {
+	c.retainedBytes += estimatePageSize(page)
+	pages := len(c.result.Pages)
+	over := (c.retain.maxPages > 0 && pages > c.retain.maxPages) ||
+		(c.retain.maxBytes > 0 && c.retainedBytes > c.retain.maxBytes)
+	if !over || (c.spill != nil && c.spill.err != nil) {
+		return
+	}
+
+	if c.spill == nil {
+		file, err := os.CreateTemp("", "webcrawler-pages-*.jsonl")
+		if err != nil {
+			c.logf("Warning: cannot spill pages to disk, keeping them in memory: %v\n", err)
+			c.spill = &pageSpill{err: err}
+			return
+		}
+		c.spill = &pageSpill{file: file, w: bufio.NewWriter(file)}
+		c.logf("Warning: more than %d pages or %d bytes of results in memory, spilling older pages to %s; "+
+			"they are merged back when saving. Narrow the crawl with -include/-exclude or raise -retain-pages to avoid this\n",
+			c.retain.maxPages, c.retain.maxBytes, file.Name())
+	}
+
+	// Keep the most recent half so the next spill is not immediate. The
+	// spilled pages leave memory once they are all on disk; a batch written
+	// in part is never read back, as only count pages are.
+	keep := pages / 2
+	spilled := c.result.Pages[:pages-keep]
+	enc := json.NewEncoder(c.spill.w)
+	for i := range spilled {
+		if err := enc.Encode(&spilled[i]); err != nil {
+			c.spillFailed(err)
+			return
+		}
+	}
+	if err := c.spill.w.Flush(); err != nil {
+		c.spillFailed(err)
+		return
+	}
+	c.spill.count += len(spilled)
+	tail := make([]PageData, keep, max(keep, c.retain.maxPages))
+	copy(tail, c.result.Pages[pages-keep:])
+	c.result.Pages = tail
+	c.retainedBytes = 0
+	for i := range tail {
+		c.retainedBytes += estimatePageSize(&tail[i])
+	}
+}
+
+// spillFailed stops spilling after err, keeping the pages of the failed
+// spill and those stored later in memory. The pages spilled before are
+// still read back from disk.
+func (c *Crawler) spillFailed(err error) {
+	c.spill.err = fmt.Errorf("error spilling pages: %v", err)
+	c.logf("Warning: %v, keeping the pages in memory from now on\n", c.spill.err)
+}
+
+// storedPages is the number of pages in the results, spilled or not.
+func (c *Crawler) storedPages() int {
+	n := len(c.result.Pages)
+	if c.spill != nil {
+		n += c.spill.count
+	}
+	return n
+}
+
+// eachPageBatch calls fn with the stored pages in order, spilled pages
+// first, in batches. Changes fn makes to the pages are kept when rewrite
+// is set. It must be called with resultLock held.
+func (c *Crawler) eachPageBatch(rewrite bool, fn func(pages []PageData) error) error {
+	if c.spill != nil && c.spill.count > 0 {
+		if err := c.spill.each(rewrite, fn); err != nil {
+			return err
+		}
+	}
+	if len(c.result.Pages) == 0 {
+		return nil
+	}
+	return fn(c.result.Pages)
+}
+
+// eachPage is eachPageBatch for a single page at a time.
+func (c *Crawler) eachPage(rewrite bool, fn func(page *PageData)) error {
+	return c.eachPageBatch(rewrite, func(pages []PageData) error {
+		for i := range pages {
+			fn(&pages[i])
+		}
+		return nil
+	})
+}
+
+// allPages returns every stored page in memory. This defeats spilling and
+// is only used where the caller asked for a slice.
+func (c *Crawler) allPages() ([]PageData, error) {
+	if c.spill == nil || c.spill.count == 0 {
+		return c.result.Pages, nil
+	}
+	pages := make([]PageData, 0, c.storedPages())
+	err := c.eachPageBatch(false, func(batch []PageData) error {
+		pages = append(pages, batch...)
+		return nil
+	})
+	return pages, err
+}
+
+// each reads the spilled pages back in batches. With rewrite, the batches
+// are written to a new file that replaces the old one.
+func (s *pageSpill) each(rewrite bool, fn func(pages []PageData) error) error {
+	// Pages are flushed as they are spilled, and a writer that failed
+	// keeps its error.
+	if s.err == nil {
+		if err := s.w.Flush(); err != nil {
+			return fmt.Errorf("error spilling pages: %v", err)
+		}
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error reading spilled pages: %v", err)
+	}
+
+	var out *os.File
+	var w *bufio.Writer
+	var enc *json.Encoder
+	if rewrite {
+		var err error
+		if out, err = os.CreateTemp("", "webcrawler-pages-*.jsonl"); err != nil {
+			return fmt.Errorf("error rewriting spilled pages: %v", err)
+		}
+		w = bufio.NewWriter(out)
+		enc = json.NewEncoder(w)
+	}
+	fail := func(err error) error {
+		if out != nil {
+			out.Close()
+			os.Remove(out.Name())
+		}
+		return err
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(s.file))
+	batch := make([]PageData, 0, spillBatchPages)
+	flush := func() error {
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if rewrite {
+			for i := range batch {
+				if err := enc.Encode(&batch[i]); err != nil {
+					return fmt.Errorf("error rewriting spilled pages: %v", err)
+				}
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for read := 0; read < s.count; read++ {
+		batch = append(batch, PageData{})
+		if err := dec.Decode(&batch[len(batch)-1]); err != nil {
+			return fail(fmt.Errorf("error reading spilled pages: %v", err))
+		}
+		if len(batch) == spillBatchPages {
+			if err := flush(); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return fail(err)
+		}
+	}
+
+	if rewrite {
+		if err := w.Flush(); err != nil {
+			return fail(fmt.Errorf("error rewriting spilled pages: %v", err))
+		}
+		s.file.Close()
+		os.Remove(s.file.Name())
+		s.file, s.w = out, bufio.NewWriter(out)
+	}
+	// Later spills append at the end.
+	if _, err := s.file.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("error spilling pages: %v", err)
+	}
+	return nil
+}
+
+// pageSummaries returns the stored pages with only the fields needed to
+// analyze the link graph and compare pages: URLs, redirects, links, titles,
+// content hashes and validation failures. Without a spill the pages themselves are returned.
+// It must be called with resultLock held.
+func (c *Crawler) pageSummaries() ([]PageData, error) {
+	if c.spill == nil || c.spill.count == 0 {
+		return c.result.Pages, nil
+	}
+	summaries := make([]PageData, 0, c.storedPages())
+	err := c.eachPage(false, func(page *PageData) {
+		summaries = append(summaries, PageData{
+			URL:                page.URL,
+			FinalURL:           page.FinalURL,
+			RedirectChain:      page.RedirectChain,
+			Title:              page.Title,
+			Links:              page.Links,
+			StatusCode:         page.StatusCode,
+			Language:           page.Language,
+			Alias:              page.Alias,
+			Canonical:          page.Canonical,
+			Hreflang:           page.Hreflang,
+			Change:             page.Change,
+			LastModified:       page.LastModified,
+			ContentHash:        page.ContentHash,
+			ContentSimHash:     page.ContentSimHash,
+			PageType:           page.PageType,
+			ValidationFailures: page.ValidationFailures,
+			Bodyless:           page.Bodyless,
+			UnfollowedRedirect: page.UnfollowedRedirect,
+			UnfollowedReason:   page.UnfollowedReason,
+		})
+	})
+	return summaries, err
+}
+
+// pageSource returns the stored pages, spilled ones included, for saving.
+func (c *Crawler) pageSource() pageSource {
+	return func(fn func(pages []PageData) error) error {
+		return c.eachPageBatch(false, fn)
+	}
+}
+
+// closeSpill removes the spill file.
+func (c *Crawler) closeSpill() {
+	if c.spill == nil || c.spill.file == nil {
+		return
+	}
+	c.spill.file.Close()
+	os.Remove(c.spill.file.Name())
+	c.spill = nil
+}
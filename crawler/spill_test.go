@@ -0,0 +1,116 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fullDisk passes the first writes calls on to w, then writes half of each
+// buffer and fails, like a disk running full.
+type fullDisk struct {
+	w      io.Writer
+	writes int
+	failed int
+}
+
+func (f *fullDisk) Write(p []byte) (int, error) {
+	if f.writes > 0 {
+		f.writes--
+		return f.w.Write(p)
+	}
+	f.failed++
+	n, _ := f.w.Write(p[:len(p)/2])
+	return n, errors.New("no space left on device")
+}
+
+// TestSpillWriteFailure spills pages to a file that fails after two
+// spills, and checks that no page is lost.
+func TestSpillWriteFailure(t *testing.T) {
+	site := budgetSite(t, 30)
+	for _, saved := range []bool{false, true} {
+		var log strings.Builder
+		filename := filepath.Join(t.TempDir(), "results.json")
+		opts := []Option{WithLogOutput(&log), WithResultLimit(4, 0)}
+		if saved {
+			opts = append(opts, WithOutputPath(filename))
+		}
+		c, err := NewCrawler(site.URL, 1, 1000, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.CreateTemp(t.TempDir(), "pages-*.jsonl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer := &fullDisk{w: file, writes: 2}
+		c.spill = &pageSpill{file: file, w: bufio.NewWriter(writer)}
+
+		result, err := c.Start(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if writer.failed != 1 {
+			t.Fatalf("the spill file failed %d times, want once and no spilling after", writer.failed)
+		}
+		if !strings.Contains(log.String(), "error spilling pages: no space left on device, keeping the pages in memory") {
+			t.Errorf("the failure is not logged: %q", log.String())
+		}
+		if saved {
+			if result, err = LoadResults(filename); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var urls []string
+		for _, page := range result.Pages {
+			urls = append(urls, page.URL)
+		}
+		slices.Sort(urls)
+		if len(urls) != 31 || len(slices.Compact(urls)) != 31 || result.TotalPages != 31 {
+			t.Errorf("saved %t: %d pages (total %d), want the 31 pages of the site once each", saved, len(result.Pages), result.TotalPages)
+		}
+	}
+}
+
+// TestSpillFailureBeforeStart checks that a spill file that cannot be
+// created keeps every page in memory.
+func TestSpillFailureBeforeStart(t *testing.T) {
+	site := budgetSite(t, 30)
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+	var log strings.Builder
+	c, err := NewCrawler(site.URL, 1, 1000, WithLogOutput(&log), WithResultLimit(4, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pages) != 31 || !strings.Contains(log.String(), "cannot spill pages to disk") {
+		t.Errorf("%d pages, log %q; want 31 pages and the failure logged", len(result.Pages), log.String())
+	}
+}
+
+// TestSpillDefault checks that only WithResultLimit spills pages.
+func TestSpillDefault(t *testing.T) {
+	c, err := NewCrawler("http://example.com", 1, 1000, WithLogOutput(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.retain != (retainLimits{}) {
+		t.Fatalf("default limits %+v, want none", c.retain)
+	}
+	for range DefaultRetainPages + 1 {
+		c.result.Pages = append(c.result.Pages, PageData{URL: "http://example.com/"})
+		c.retainPage(&c.result.Pages[len(c.result.Pages)-1])
+	}
+	if c.spill != nil || len(c.result.Pages) != DefaultRetainPages+1 {
+		t.Errorf("%d pages in memory and spill %+v, want every page in memory", len(c.result.Pages), c.spill)
+	}
+}
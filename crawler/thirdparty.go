@@ -0,0 +1,235 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// ThirdPartyLink is the kind of a third-party origin reached by an anchor
+// link rather than loaded as an asset.
+const ThirdPartyLink = "link"
+
+// maxThirdPartyExamples is the number of pages listed per third party.
+const maxThirdPartyExamples = 5
+
+// ThirdParty is a registrable domain outside the site, such as
+// gstatic.com, that the stored pages load assets from or link to. Pages
+// counts the pages referencing any of its origins, with the first of them
+// in crawl order as Examples.
+type ThirdParty struct {
+	Domain   string             `json:"domain"`
+	Pages    int                `json:"pages"`
+	Origins  []ThirdPartyOrigin `json:"origins"`
+	Examples []string           `json:"examples"`
+}
+
+// ThirdPartyOrigin is a scheme and host of a third party, with the kinds
+// of reference made to it: asset types, such as "script", and
+// ThirdPartyLink. Example is the first page referencing it.
+type ThirdPartyOrigin struct {
+	Origin  string   `json:"origin"`
+	Kinds   []string `json:"kinds"`
+	Pages   int      `json:"pages"`
+	Example string   `json:"example"`
+}
+
+// ThirdPartyBaseline is the set of third-party origins a site is reviewed
+// for, as saved by WriteThirdPartyBaseline.
+type ThirdPartyBaseline struct {
+	Origins []string `json:"origins"`
+}
+
+// registrableDomain returns the domain host belongs to under the public
+// suffix list, such as example.co.uk for www.example.co.uk. IP addresses
+// and names without a public suffix stand for themselves.
+func registrableDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// thirdPartyOrigin returns the origin of ref and its registrable domain,
+// or "" when ref is not an http or https URL outside the site. Hosts under
+// the registrable domain of the base URL, such as a CDN subdomain, belong
+// to the site.
+func (c *Crawler) thirdPartyOrigin(ref string) (origin, domain string) {
+	u, err := url.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || c.isSameDomain(u) {
+		return "", ""
+	}
+	domain = registrableDomain(u.Hostname())
+	if domain == registrableDomain(c.baseURL.Hostname()) {
+		return "", ""
+	}
+	return u.Scheme + "://" + normalizeHost(u.Scheme, u.Host), domain
+}
+
+// thirdParties aggregates the third-party origins of the assets and
+// external links of the stored pages, the domains referenced by the most
+// pages first. It must be called with resultLock held.
+func (c *Crawler) thirdParties() ([]ThirdParty, error) {
+	type originRefs struct {
+		domain  string
+		kinds   map[string]bool
+		pages   int
+		example string
+	}
+	type domainRefs struct {
+		pages    int
+		examples []string
+	}
+	origins := make(map[string]*originRefs)
+	domains := make(map[string]*domainRefs)
+	err := c.eachPage(false, func(page *PageData) {
+		refs := make(map[string]string)
+		kinds := make(map[[2]string]bool)
+		note := func(ref, kind string) {
+			origin, domain := c.thirdPartyOrigin(ref)
+			if origin == "" {
+				return
+			}
+			refs[origin] = domain
+			kinds[[2]string{origin, kind}] = true
+		}
+		for _, asset := range page.Assets {
+			note(asset.URL, asset.Type)
+		}
+		for _, link := range page.ExternalLinks {
+			note(link, ThirdPartyLink)
+		}
+		pageDomains := make(map[string]bool)
+		for origin, domain := range refs {
+			o := origins[origin]
+			if o == nil {
+				o = &originRefs{domain: domain, kinds: make(map[string]bool), example: page.URL}
+				origins[origin] = o
+			}
+			o.pages++
+			pageDomains[domain] = true
+		}
+		for key := range kinds {
+			origins[key[0]].kinds[key[1]] = true
+		}
+		for domain := range pageDomains {
+			d := domains[domain]
+			if d == nil {
+				d = &domainRefs{}
+				domains[domain] = d
+			}
+			d.pages++
+			if len(d.examples) < maxThirdPartyExamples {
+				d.examples = append(d.examples, page.URL)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byDomain := make(map[string]*ThirdParty, len(domains))
+	parties := make([]ThirdParty, 0, len(domains))
+	for domain, d := range domains {
+		parties = append(parties, ThirdParty{Domain: domain, Pages: d.pages, Examples: d.examples})
+	}
+	for i := range parties {
+		byDomain[parties[i].Domain] = &parties[i]
+	}
+	for origin, o := range origins {
+		kinds := make([]string, 0, len(o.kinds))
+		for kind := range o.kinds {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		party := byDomain[o.domain]
+		party.Origins = append(party.Origins, ThirdPartyOrigin{Origin: origin, Kinds: kinds, Pages: o.pages, Example: o.example})
+	}
+	for i := range parties {
+		sort.Slice(parties[i].Origins, func(a, b int) bool {
+			oa, ob := parties[i].Origins[a], parties[i].Origins[b]
+			if oa.Pages != ob.Pages {
+				return oa.Pages > ob.Pages
+			}
+			return oa.Origin < ob.Origin
+		})
+	}
+	sort.Slice(parties, func(i, j int) bool {
+		if parties[i].Pages != parties[j].Pages {
+			return parties[i].Pages > parties[j].Pages
+		}
+		return parties[i].Domain < parties[j].Domain
+	})
+	return parties, nil
+}
+
+// LoadThirdPartyBaseline reads a baseline saved by WriteThirdPartyBaseline.
+func LoadThirdPartyBaseline(path string) (*ThirdPartyBaseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading third-party baseline: %v", err)
+	}
+	var baseline ThirdPartyBaseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("error parsing third-party baseline %s: %v", path, err)
+	}
+	return &baseline, nil
+}
+
+// WriteThirdPartyBaseline saves the origins of parties to path as a
+// baseline, sorted so that reviewed changes diff cleanly.
+func WriteThirdPartyBaseline(path string, parties []ThirdParty) error {
+	baseline := ThirdPartyBaseline{Origins: []string{}}
+	for _, party := range parties {
+		for _, origin := range party.Origins {
+			baseline.Origins = append(baseline.Origins, origin.Origin)
+		}
+	}
+	sort.Strings(baseline.Origins)
+	file, err := createOutputFile(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(baseline); err != nil {
+		return fmt.Errorf("error writing third-party baseline: %v", err)
+	}
+	return file.Close()
+}
+
+// NewThirdParties returns the parts of parties whose origins are not in
+// baseline: each third party with a new origin, holding only the new
+// origins.
+func NewThirdParties(parties []ThirdParty, baseline *ThirdPartyBaseline) []ThirdParty {
+	known := make(map[string]bool, len(baseline.Origins))
+	for _, origin := range baseline.Origins {
+		known[strings.TrimSuffix(strings.ToLower(origin), "/")] = true
+	}
+	var found []ThirdParty
+	for _, party := range parties {
+		var origins []ThirdPartyOrigin
+		for _, origin := range party.Origins {
+			if !known[origin.Origin] {
+				origins = append(origins, origin)
+			}
+		}
+		if len(origins) > 0 {
+			party.Origins = origins
+			found = append(found, party)
+		}
+	}
+	return found
+}
@@ -0,0 +1,190 @@
+package crawler
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := map[string]string{
+		"www.example.co.uk":      "example.co.uk",
+		"static.cdn.example.com": "example.com",
+		"Fonts.GStatic.com.":     "gstatic.com",
+		// A private suffix of the list groups nothing.
+		"fonts.googleapis.com": "fonts.googleapis.com",
+		"example.com":          "example.com",
+		"co.uk":                "co.uk",
+		"127.0.0.1":            "127.0.0.1",
+		"::1":                  "::1",
+		"localhost":            "localhost",
+	}
+	for host, want := range tests {
+		if got := registrableDomain(host); got != want {
+			t.Errorf("registrableDomain(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestThirdPartyOrigin(t *testing.T) {
+	c, err := NewCrawler("https://www.example.co.uk/", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ref, origin, domain string
+	}{
+		{"https://fonts.gstatic.com/css?family=x", "https://fonts.gstatic.com", "gstatic.com"},
+		{"HTTP://Partner.co.uk:80/", "http://partner.co.uk", "partner.co.uk"},
+		{"https://partner.co.uk:8443/a", "https://partner.co.uk:8443", "partner.co.uk"},
+		// Another site under the same public suffix is a third party.
+		{"https://other.co.uk/", "https://other.co.uk", "other.co.uk"},
+		// Subdomains of the site, such as its CDN, are not.
+		{"https://static.example.co.uk/app.js", "", ""},
+		{"https://example.co.uk/", "", ""},
+		{"https://www.example.co.uk/page", "", ""},
+		{"data:image/png;base64,iVBORw0KGgo=", "", ""},
+		{"blob:https://fonts.gstatic.com/0b7c", "", ""},
+		{"mailto:someone@other.co.uk", "", ""},
+		{"/relative", "", ""},
+	}
+	for _, tt := range tests {
+		origin, domain := c.thirdPartyOrigin(tt.ref)
+		if origin != tt.origin || domain != tt.domain {
+			t.Errorf("thirdPartyOrigin(%q) = %q, %q; want %q, %q", tt.ref, origin, domain, tt.origin, tt.domain)
+		}
+	}
+}
+
+// TestThirdParties checks that the origins of the stored pages are grouped
+// by registrable domain, with the pages counted once per domain.
+func TestThirdParties(t *testing.T) {
+	c, err := NewCrawler("https://www.example.co.uk/", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.result.Pages = []PageData{
+		{
+			URL: "https://www.example.co.uk/",
+			Assets: []Asset{
+				{URL: "https://fonts.gstatic.com/css", Type: AssetStylesheet},
+				{URL: "https://ssl.gstatic.com/ui.js", Type: AssetScript},
+				{URL: "https://static.example.co.uk/app.js", Type: AssetScript},
+				{URL: "data:image/png;base64,iVBORw0KGgo=", Type: AssetImage},
+			},
+			ExternalLinks: []string{"https://fonts.gstatic.com/", "https://shop.other.co.uk/"},
+		},
+		{
+			URL:    "https://www.example.co.uk/a",
+			Assets: []Asset{{URL: "https://fonts.gstatic.com/css", Type: AssetStylesheet}, {URL: "blob:https://www.example.co.uk/1", Type: AssetMedia}},
+		},
+		{URL: "https://www.example.co.uk/b", ExternalLinks: []string{"https://other.co.uk/"}},
+		{URL: "https://www.example.co.uk/c", Assets: []Asset{{URL: "https://static.example.co.uk/app.js", Type: AssetScript}}},
+	}
+	parties, err := c.thirdParties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ThirdParty{
+		{
+			Domain: "gstatic.com", Pages: 2,
+			Origins: []ThirdPartyOrigin{
+				{Origin: "https://fonts.gstatic.com", Kinds: []string{ThirdPartyLink, AssetStylesheet}, Pages: 2, Example: "https://www.example.co.uk/"},
+				{Origin: "https://ssl.gstatic.com", Kinds: []string{AssetScript}, Pages: 1, Example: "https://www.example.co.uk/"},
+			},
+			Examples: []string{"https://www.example.co.uk/", "https://www.example.co.uk/a"},
+		},
+		{
+			Domain: "other.co.uk", Pages: 2,
+			Origins: []ThirdPartyOrigin{
+				{Origin: "https://other.co.uk", Kinds: []string{ThirdPartyLink}, Pages: 1, Example: "https://www.example.co.uk/b"},
+				{Origin: "https://shop.other.co.uk", Kinds: []string{ThirdPartyLink}, Pages: 1, Example: "https://www.example.co.uk/"},
+			},
+			Examples: []string{"https://www.example.co.uk/", "https://www.example.co.uk/b"},
+		},
+	}
+	slices.Sort(want[0].Origins[0].Kinds)
+	if !reflect.DeepEqual(parties, want) {
+		t.Errorf("third parties %+v, want %+v", parties, want)
+	}
+
+	c.result.Pages = c.result.Pages[3:]
+	if parties, err := c.thirdParties(); err != nil || len(parties) != 0 {
+		t.Errorf("third parties %+v, %v of a page loading only from the site's CDN", parties, err)
+	}
+}
+
+// TestThirdPartyBaseline saves a baseline, reads it back and diffs a later
+// crawl against it.
+func TestThirdPartyBaseline(t *testing.T) {
+	parties := []ThirdParty{
+		{Domain: "gstatic.com", Origins: []ThirdPartyOrigin{{Origin: "https://fonts.gstatic.com"}, {Origin: "https://ssl.gstatic.com"}}},
+		{Domain: "other.co.uk", Origins: []ThirdPartyOrigin{{Origin: "https://other.co.uk"}}},
+	}
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := WriteThirdPartyBaseline(path, parties); err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := LoadThirdPartyBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://fonts.gstatic.com", "https://other.co.uk", "https://ssl.gstatic.com"}; !slices.Equal(baseline.Origins, want) {
+		t.Errorf("baseline %q, want the sorted origins %q", baseline.Origins, want)
+	}
+	if found := NewThirdParties(parties, baseline); len(found) != 0 {
+		t.Errorf("new third parties %+v against a baseline of the same crawl", found)
+	}
+
+	// Origins in a baseline edited by hand compare normalized.
+	baseline.Origins = []string{"HTTPS://Fonts.GStatic.com/", "https://other.co.uk"}
+	later := append(slices.Clone(parties), ThirdParty{Domain: "tracker.example", Pages: 3, Origins: []ThirdPartyOrigin{{Origin: "https://cdn.tracker.example"}}})
+	want := []ThirdParty{
+		{Domain: "gstatic.com", Origins: []ThirdPartyOrigin{{Origin: "https://ssl.gstatic.com"}}},
+		{Domain: "tracker.example", Pages: 3, Origins: []ThirdPartyOrigin{{Origin: "https://cdn.tracker.example"}}},
+	}
+	if found := NewThirdParties(later, baseline); !reflect.DeepEqual(found, want) {
+		t.Errorf("new third parties %+v, want %+v", found, want)
+	}
+
+	// An empty crawl saves an empty list, not null.
+	if err := WriteThirdPartyBaseline(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), `"origins": []`) {
+		t.Errorf("empty baseline %s, %v", data, err)
+	}
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadThirdPartyBaseline(path); err == nil || !strings.Contains(err.Error(), "error parsing third-party baseline") {
+		t.Errorf("a truncated baseline: %v", err)
+	}
+}
+
+// TestCrawlThirdParties checks that a crawl reports the third parties its
+// pages reference, without inline data: and blob: URLs.
+func TestCrawlThirdParties(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/": htmlPage(`<link rel="stylesheet" href="https://fonts.gstatic.com/css">
+			<img src="data:image/png;base64,iVBORw0KGgo="> <video src="blob:https://fonts.gstatic.com/1"></video>
+			<script src="/app.js"></script> <a href="https://other.co.uk/">partner</a> <a href="/a">a</a>`),
+		"/a": htmlPage(`<img src="https://fonts.gstatic.com/logo.png">`),
+	})
+	result := crawlTestSite(t, site.URL, 1)
+	var domains []string
+	for _, party := range result.ThirdParties {
+		domains = append(domains, party.Domain)
+	}
+	if want := []string{"gstatic.com", "other.co.uk"}; !slices.Equal(domains, want) {
+		t.Fatalf("third parties %+v, want %q", result.ThirdParties, want)
+	}
+	fonts := result.ThirdParties[0]
+	if fonts.Pages != 2 || len(fonts.Origins) != 1 || !slices.Equal(fonts.Origins[0].Kinds, []string{AssetImage, AssetStylesheet}) {
+		t.Errorf("gstatic.com %+v, want fonts.gstatic.com on 2 pages as an image and a stylesheet", fonts)
+	}
+}
@@ -0,0 +1,276 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+)
+
+const (
+	DefaultThrottleRetries = 3
+
+	// maxThrottleInterval caps how far throttling slows the crawl down.
+	maxThrottleInterval = time.Minute
+
+	// Interstitials are short: phrases are matched against the body text
+	// only for pages with little text, so articles that merely mention rate
+	// limiting are not mistaken for one.
+	throttleMaxHTML = 256 << 10
+	throttleMaxText = 2000
+)
+
+// ErrThrottled reports a page with status 200 whose content is a rate
+// limiting interstitial.
+var ErrThrottled = errors.New("rate limiting page")
+
+// defaultThrottlePhrases cover the interstitials served by common CDNs and
+// WAFs. They are matched case-insensitively.
+var defaultThrottlePhrases = []string{
+	"you are being rate limited",
+	"rate limit exceeded",
+	"too many requests",
+	"please slow down",
+	"request rate too high",
+}
+
+// defaultThrottleSelectors match elements found only on interstitials.
+var defaultThrottleSelectors = []string{
+	"#cf-error-details .cf-error-code", // Cloudflare error 1015
+}
+
+type throttleOptions struct {
+	detect    bool
+	phrases   []string
+	selectors []string
+	matchers  []cascadia.Selector
+	retries   int
+}
+
+// WithThrottleDetection controls content-based detection of rate limiting
+// pages served with status 200. phrases and selectors are added to the
+// defaults. Detection is enabled unless enabled is false.
+func WithThrottleDetection(enabled bool, phrases, selectors []string) Option {
+	return func(c *Crawler) {
+		c.throttle.detect = enabled
+		c.throttle.phrases = append(c.throttle.phrases, phrases...)
+		c.throttle.selectors = append(c.throttle.selectors, selectors...)
+	}
+}
+
+// WithThrottleRetries sets how many times a throttled URL, one answered with
+// status 429 or a detected rate limiting page, is retried.
+func WithThrottleRetries(n int) Option {
+	return func(c *Crawler) {
+		c.throttle.retries = n
+	}
+}
+
+func defaultThrottleOptions() throttleOptions {
+	return throttleOptions{
+		detect:    true,
+		phrases:   append([]string(nil), defaultThrottlePhrases...),
+		selectors: append([]string(nil), defaultThrottleSelectors...),
+		retries:   DefaultThrottleRetries,
+	}
+}
+
+// ValidThrottleSelectors reports the first of selectors that is not a valid
+// CSS selector.
+func ValidThrottleSelectors(selectors []string) error {
+	throttle := throttleOptions{selectors: selectors}
+	return throttle.compile()
+}
+
+// compile parses the selectors and lowercases the phrases.
+func (t *throttleOptions) compile() error {
+	for i, phrase := range t.phrases {
+		t.phrases[i] = strings.ToLower(phrase)
+	}
+	t.matchers = t.matchers[:0]
+	for _, selector := range t.selectors {
+		sel, err := cascadia.Compile(selector)
+		if err != nil {
+			return fmt.Errorf("invalid selector %q: %v", selector, err)
+		}
+		t.matchers = append(t.matchers, sel)
+	}
+	return nil
+}
+
+// detectThrottle returns the phrase or selector identifying page as a rate
+// limiting interstitial, or "" for ordinary content.
+func (c *Crawler) detectThrottle(page *fetchedPage, size int) string {
+	if !c.throttle.detect {
+		return ""
+	}
+	texts := []string{strings.ToLower(page.title)}
+	if page.doc != nil {
+		for i, sel := range c.throttle.matchers {
+			if page.doc.FindMatcher(sel).Length() > 0 {
+				return c.throttle.selectors[i]
+			}
+		}
+		if size <= throttleMaxHTML {
+			if text := strings.Join(strings.Fields(page.doc.Find("body").Text()), " "); len(text) <= throttleMaxText {
+				texts = append(texts, strings.ToLower(text))
+			}
+		}
+	}
+	for _, phrase := range c.throttle.phrases {
+		for _, text := range texts {
+			if strings.Contains(text, phrase) {
+				return phrase
+			}
+		}
+	}
+	return ""
+}
+
+// isThrottled reports whether err means the server asked the crawler to
+// slow down.
+func isThrottled(err error) bool {
+	var statusErr *StatusError
+	return errors.Is(err, ErrThrottled) ||
+		errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests
+}
+
+// onThrottled halves the crawl rate and counts the event.
+func (c *Crawler) onThrottled(pageURL string, err error) {
+	interval := c.rateLimiter.slowDown()
+	if c.hostLimit != nil {
+		// Other crawls of the host are asking too much of it as well.
+		c.hostLimit.limiter.slowDown()
+	}
+	c.counters.throttleEvents.Add(1)
+	c.logf("Throttled: %s (%v), one request per %s from now on\n", pageURL, errors.Unwrap(err), interval)
+}
+
+// releaseRedirectTargets undoes the visited claims a throttled page request
+// made on its redirect targets, so retrying it fetches them again instead
+// of storing an alias.
+func (c *Crawler) releaseRedirectTargets(pageURL string, chain []RedirectHop, finalURL string) {
+	if len(chain) == 0 {
+		return
+	}
+	c.visitedLock.Lock()
+	defer c.visitedLock.Unlock()
+	for _, hop := range chain[1:] {
+		c.unvisit(c.visitKey(hop.URL))
+	}
+	if finalURL != pageURL {
+		c.unvisit(c.visitKey(finalURL))
+	}
+}
+
+// rateLimiter spaces requests by an interval that throttling can widen. A
+// zero interval lets every request through at once.
+//
+// Each waiting request books the slot after the last one booked. When the
+// interval changes, the slots not yet reached are given up and booked
+// again from the last slot reached, so requests queued during the warmup
+// do not keep its spacing once the ramp speeds up. changed is closed and
+// replaced on every change.
+type rateLimiter struct {
+	lock     sync.Mutex
+	interval time.Duration
+	next     time.Time
+	last     time.Time
+	changed  chan struct{}
+}
+
+func newRateLimiter(requestsPerSecond float64) *rateLimiter {
+	if isUnlimitedRate(requestsPerSecond) {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / requestsPerSecond)}
+}
+
+// wait blocks until the caller may send its request or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context) {
+	for {
+		l.lock.Lock()
+		if l.interval == 0 {
+			l.lock.Unlock()
+			return
+		}
+		now := time.Now()
+		if l.next.Before(now) {
+			l.next = now
+		}
+		slot := l.next
+		l.next = l.next.Add(l.interval)
+		if l.changed == nil {
+			l.changed = make(chan struct{})
+		}
+		changed := l.changed
+		l.lock.Unlock()
+
+		timer := time.NewTimer(slot.Sub(now))
+		select {
+		case <-timer.C:
+			l.lock.Lock()
+			if slot.After(l.last) {
+				l.last = slot
+			}
+			l.lock.Unlock()
+			return
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// setInterval spaces the following requests by interval.
+func (l *rateLimiter) setInterval(interval time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.interval = interval
+	l.rebook()
+}
+
+// rebook gives up the slots booked under the old interval, waking their
+// requests to book them again one interval after the last slot reached.
+// It must be called with lock held.
+func (l *rateLimiter) rebook() {
+	l.next = l.last.Add(l.interval)
+	if l.changed != nil {
+		close(l.changed)
+	}
+	l.changed = make(chan struct{})
+}
+
+// speedUp halves the interval, down to floor, and returns it. Without a
+// floor, an interval below minRampInterval turns rate limiting off.
+func (l *rateLimiter) speedUp(floor time.Duration) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.interval /= 2
+	if l.interval < floor || floor == 0 && l.interval < minRampInterval {
+		l.interval = floor
+	}
+	l.rebook()
+	return l.interval
+}
+
+// slowDown doubles the interval, up to maxThrottleInterval, and returns it.
+// Without a rate limit it starts from unlimitedThrottleInterval.
+func (l *rateLimiter) slowDown() time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.interval == 0 {
+		l.interval = unlimitedThrottleInterval
+	} else {
+		l.interval = min(2*l.interval, maxThrottleInterval)
+	}
+	l.rebook()
+	return l.interval
+}
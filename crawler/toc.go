@@ -0,0 +1,213 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// WithTOC records the table of contents of every page: its headings with
+// an id, every other fragment target, and the links it has to fragments of
+// same-domain pages. FindAnchorReferences joins them across the crawl.
+func WithTOC() Option {
+	return func(c *Crawler) {
+		c.toc = true
+	}
+}
+
+// PageTOC is the in-page anchor structure of a page.
+type PageTOC struct {
+	Headings []TOCEntry `json:"headings,omitempty"`
+	// IDs lists the fragment targets of the page that are not headings:
+	// element ids and <a name> anchors.
+	IDs []string `json:"ids,omitempty"`
+	// Links are the links of the page that carry a fragment, in-page ones
+	// included.
+	Links []FragmentLink `json:"links,omitempty"`
+}
+
+// TOCEntry is a heading that can be linked to.
+type TOCEntry struct {
+	ID    string `json:"id"`
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+// FragmentLink is a link to a fragment of the normalized URL.
+type FragmentLink struct {
+	URL      string `json:"url"`
+	Fragment string `json:"fragment"`
+}
+
+// extractTOC reads the headings, fragment targets and fragment links of
+// doc, served at pageURL.
+func extractTOC(doc *goquery.Document, pageURL *url.URL, anchors []anchor) *PageTOC {
+	toc := &PageTOC{}
+	headingIDs := make(map[string]bool)
+	doc.Find("h1, h2, h3, h4, h5, h6").Each(func(_ int, s *goquery.Selection) {
+		id := s.AttrOr("id", "")
+		// Many generators put the id on an anchor inside the heading.
+		if id == "" {
+			inner := s.Find("[id], a[name]").First()
+			id = inner.AttrOr("id", inner.AttrOr("name", ""))
+		}
+		if id == "" || headingIDs[id] {
+			return
+		}
+		headingIDs[id] = true
+		toc.Headings = append(toc.Headings, TOCEntry{
+			ID:    id,
+			Level: int(goquery.NodeName(s)[1] - '0'),
+			Text:  strings.Join(strings.Fields(s.Text()), " "),
+		})
+	})
+	for id := range elementIDs(doc) {
+		if id != "" && !headingIDs[id] {
+			toc.IDs = append(toc.IDs, id)
+		}
+	}
+	sort.Strings(toc.IDs)
+
+	seen := make(map[FragmentLink]bool)
+	for _, a := range anchors {
+		href := strings.TrimSpace(a.href)
+		if !strings.Contains(href, "#") || href == "#" {
+			continue
+		}
+		target, err := pageURL.Parse(href)
+		if err != nil || target.Fragment == "" || (target.Scheme != "http" && target.Scheme != "https") {
+			continue
+		}
+		link := FragmentLink{URL: NormalizeURL(target), Fragment: target.Fragment}
+		if !seen[link] {
+			seen[link] = true
+			toc.Links = append(toc.Links, link)
+		}
+	}
+	return toc
+}
+
+// UnreferencedAnchor is a heading no crawled page links to.
+type UnreferencedAnchor struct {
+	URL  string
+	ID   string
+	Text string
+}
+
+// DanglingFragment is a link to a fragment the crawled target page lacks.
+type DanglingFragment struct {
+	SourcePage string
+	URL        string
+	Fragment   string
+}
+
+// AnchorReport is the cross-reference of headings and fragment links.
+type AnchorReport struct {
+	Pages        int
+	Headings     int
+	Unreferenced []UnreferencedAnchor
+	Dangling     []DanglingFragment
+}
+
+// FindAnchorReferences joins the fragment links of every page against the
+// table of contents of the page they point at. Links to a redirecting URL
+// count for the page it redirects to; links to pages that were not crawled
+// with a table of contents are ignored. Language passes are joined
+// separately.
+func FindAnchorReferences(pages []PageData) AnchorReport {
+	var report AnchorReport
+	// Pages are keyed by language and every URL that leads to them.
+	targets := make(map[string]*PageData)
+	for i := range pages {
+		page := &pages[i]
+		if page.Alias || page.TOC == nil {
+			continue
+		}
+		targets[languageKey(page.Language, page.URL)] = page
+		if page.FinalURL != "" {
+			targets[languageKey(page.Language, page.FinalURL)] = page
+		}
+		for _, hop := range page.RedirectChain {
+			targets[languageKey(page.Language, hop.URL)] = page
+		}
+	}
+	for _, page := range pages {
+		if page.Alias && page.FinalURL != "" {
+			if target, ok := targets[languageKey(page.Language, page.FinalURL)]; ok {
+				targets[languageKey(page.Language, page.URL)] = target
+			}
+		}
+	}
+
+	referenced := make(map[*PageData]map[string]bool)
+	for _, page := range pages {
+		if page.Alias || page.TOC == nil {
+			continue
+		}
+		for _, link := range page.TOC.Links {
+			target, ok := targets[languageKey(page.Language, link.URL)]
+			if !ok {
+				continue
+			}
+			fragment, err := url.PathUnescape(link.Fragment)
+			if err != nil {
+				fragment = link.Fragment
+			}
+			if referenced[target] == nil {
+				referenced[target] = make(map[string]bool)
+			}
+			referenced[target][fragment] = true
+			// Browsers scroll to the top for #top without a matching id.
+			if !target.TOC.hasTarget(fragment) && !strings.EqualFold(fragment, "top") {
+				report.Dangling = append(report.Dangling, DanglingFragment{SourcePage: page.URL, URL: link.URL, Fragment: link.Fragment})
+			}
+		}
+	}
+
+	for i := range pages {
+		page := &pages[i]
+		if page.Alias || page.TOC == nil {
+			continue
+		}
+		if len(page.TOC.Headings) > 0 {
+			report.Pages++
+		}
+		for _, heading := range page.TOC.Headings {
+			report.Headings++
+			if !referenced[page][heading.ID] {
+				report.Unreferenced = append(report.Unreferenced, UnreferencedAnchor{URL: page.URL, ID: heading.ID, Text: heading.Text})
+			}
+		}
+	}
+	sort.Slice(report.Unreferenced, func(i, j int) bool {
+		a, b := report.Unreferenced[i], report.Unreferenced[j]
+		if a.URL != b.URL {
+			return a.URL < b.URL
+		}
+		return a.ID < b.ID
+	})
+	sort.Slice(report.Dangling, func(i, j int) bool {
+		a, b := report.Dangling[i], report.Dangling[j]
+		if a.URL != b.URL {
+			return a.URL < b.URL
+		}
+		if a.Fragment != b.Fragment {
+			return a.Fragment < b.Fragment
+		}
+		return a.SourcePage < b.SourcePage
+	})
+	return report
+}
+
+// hasTarget reports whether id is a heading or another fragment target.
+func (toc *PageTOC) hasTarget(id string) bool {
+	for _, heading := range toc.Headings {
+		if heading.ID == id {
+			return true
+		}
+	}
+	i := sort.SearchStrings(toc.IDs, id)
+	return i < len(toc.IDs) && toc.IDs[i] == id
+}
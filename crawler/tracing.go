@@ -0,0 +1,169 @@
+package crawler
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "webcrawler"
+
+// WithTracerProvider emits an OpenTelemetry trace for each crawl: a root
+// span for Start, a child span per page with its retries and rate limit
+// waits as events, and a span per HTTP exchange. Without this option no
+// tracing code runs.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *Crawler) {
+		c.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithTraceSampling traces only a fraction of the pages of a crawl, chosen
+// by a hash of their URL, to bound span volume on large crawls. The root
+// span is always recorded.
+func WithTraceSampling(ratio float64) Option {
+	return func(c *Crawler) {
+		c.traceSampleRatio = ratio
+	}
+}
+
+// startCrawlSpan starts the root span of a crawl.
+func (c *Crawler) startCrawlSpan() trace.Span {
+	if c.tracer == nil {
+		return nil
+	}
+	ctx, span := c.tracer.Start(c.traceCtx, "crawl", trace.WithAttributes(
+		attribute.String("crawl.base_url", NormalizeURL(c.baseURL)),
+		attribute.Int("crawl.max_depth", c.maxDepth),
+	))
+	c.traceCtx = ctx
+	return span
+}
+
+// endCrawlSpan records the crawl counters on span and ends it.
+func (c *Crawler) endCrawlSpan(span trace.Span) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("crawl.discovered_urls", c.result.DiscoveredURLs),
+		attribute.Int("crawl.fetched_urls", c.result.FetchedURLs),
+		attribute.Int("crawl.pages", c.result.TotalPages),
+		attribute.Int("crawl.errors", len(c.result.Errors)),
+		attribute.Int64("crawl.bytes_fetched", c.result.BytesFetched),
+	)
+	if c.result.StopReason != "" {
+		span.SetAttributes(attribute.String("crawl.stop_reason", c.result.StopReason))
+	}
+	span.End()
+}
+
+// pageSpan traces the crawl of one page. A nil *pageSpan, used when tracing
+// is off, ignores every call.
+type pageSpan struct {
+	ctx  context.Context
+	span trace.Span
+}
+
+func (c *Crawler) startPageSpan(pageURL string, depth int) *pageSpan {
+	if c.tracer == nil || !sampledURL(pageURL, c.traceSampleRatio) {
+		return nil
+	}
+	ctx, span := c.tracer.Start(c.traceCtx, "page", trace.WithAttributes(
+		attribute.String("url.full", pageURL),
+		attribute.Int("crawl.depth", depth),
+	))
+	return &pageSpan{ctx: ctx, span: span}
+}
+
+// context returns the context carrying the span, for the page request, or
+// parent when the page is not traced.
+func (p *pageSpan) context(parent context.Context) context.Context {
+	if p == nil {
+		return parent
+	}
+	return p.ctx
+}
+
+func (p *pageSpan) rateLimitWait(waited time.Duration) {
+	if p == nil {
+		return
+	}
+	p.span.AddEvent("rate_limit.wait", trace.WithAttributes(attribute.Int64("wait_ms", waited.Milliseconds())))
+}
+
+func (p *pageSpan) retry(attempt int, err error) {
+	if p == nil {
+		return
+	}
+	p.span.AddEvent("retry", trace.WithAttributes(
+		attribute.Int("retry.attempt", attempt),
+		attribute.String("retry.reason", ErrorCategory(err)),
+	))
+}
+
+// end records the outcome of the page and ends the span.
+func (p *pageSpan) end(page *fetchedPage, err error) {
+	if p == nil {
+		return
+	}
+	if page != nil {
+		p.span.SetAttributes(
+			attribute.Int("http.response.status_code", page.statusCode),
+			attribute.Int64("http.response.body.size", page.bytes),
+		)
+	}
+	if err != nil {
+		if fetchErr, ok := err.(*FetchError); ok && fetchErr.StatusCode != 0 {
+			p.span.SetAttributes(attribute.Int("http.response.status_code", fetchErr.StatusCode))
+		}
+		p.span.SetAttributes(attribute.String("error.type", ErrorCategory(err)))
+		p.span.SetStatus(codes.Error, err.Error())
+	}
+	p.span.End()
+}
+
+// sampledURL reports whether pageURL falls in the sampled fraction ratio.
+func sampledURL(pageURL string, ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(pageURL))
+	return float64(h.Sum64()) < ratio*math.MaxUint64
+}
+
+// tracingMiddleware adds a client span around every HTTP exchange whose
+// request context carries a span.
+func (c *Crawler) tracingMiddleware(next Fetcher) Fetcher {
+	return fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		if !trace.SpanFromContext(req.Context()).SpanContext().IsValid() {
+			return next.RoundTrip(req)
+		}
+		ctx, span := c.tracer.Start(req.Context(), "HTTP "+req.Method, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("http.request.method", req.Method),
+				attribute.String("url.full", req.URL.String()),
+			))
+		defer span.End()
+		resp, err := next.RoundTrip(req.WithContext(ctx))
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		return resp, nil
+	})
+}
+
+type fetcherFunc func(req *http.Request) (*http.Response, error)
+
+func (f fetcherFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,266 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DefaultMobileUserAgent is the User-Agent of the second fetch of
+// WithUACompare: that of a phone browser, which sites serving mobile pages
+// recognize, followed by the crawler's own.
+const DefaultMobileUserAgent = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36"
+
+// Defaults of the sample of WithUACompare in the command: a tenth of the
+// pages, at most 100.
+const (
+	DefaultUACompareFraction = 0.1
+	DefaultUACompareMax      = 100
+)
+
+// Fields compared by WithUACompare, as listed in UADivergence.Fields.
+const (
+	UAFieldStatus    = "status"
+	UAFieldFinalURL  = "final_url"
+	UAFieldCanonical = "canonical"
+	UAFieldTitle     = "title"
+	UAFieldContent   = "content"
+)
+
+// uaCompareOptions configures WithUACompare.
+type uaCompareOptions struct {
+	enabled   bool
+	fraction  float64
+	max       int
+	userAgent string
+}
+
+// WithUACompare fetches a sample of the stored pages a second time once the
+// crawl is done, with a mobile User-Agent, and records in UAComparison the
+// pages whose status, final URL, canonical, title or content differ from
+// those of the crawl. fraction is the share of the pages sampled, all of
+// them when zero, and max caps the sample, zero being no cap. The sample is
+// chosen by a hash of the URLs, so repeated crawls of a site compare the
+// same pages. userAgent is the mobile User-Agent, DefaultMobileUserAgent
+// when empty; the contact of WithContact is appended to it.
+//
+// The second fetches wait for the rate limit and count towards the page,
+// duration and byte budgets, and FetchedURLs counts them, though Coverage
+// does not; the comparison stops when a budget is exhausted.
+func WithUACompare(fraction float64, max int, userAgent string) Option {
+	return func(c *Crawler) {
+		c.uaCompare = uaCompareOptions{enabled: true, fraction: fraction, max: max, userAgent: userAgent}
+	}
+}
+
+// UAView is what a page answered to one User-Agent.
+type UAView struct {
+	StatusCode  int    `json:"status_code,omitempty"`
+	FinalURL    string `json:"final_url,omitempty"`
+	Canonical   string `json:"canonical,omitempty"`
+	Title       string `json:"title,omitempty"`
+	ContentHash string `json:"content_hash,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// UADivergence is a page that answered the mobile User-Agent differently:
+// Fields names what differs, and Desktop and Mobile hold both answers. The
+// desktop answer is the one the crawl stored.
+type UADivergence struct {
+	URL      string   `json:"url"`
+	Language string   `json:"language,omitempty"`
+	Fields   []string `json:"fields"`
+	Desktop  UAView   `json:"desktop"`
+	Mobile   UAView   `json:"mobile"`
+}
+
+// UAComparison is the outcome of WithUACompare. Sampled counts the pages
+// chosen and Compared those fetched again before a budget ran out.
+type UAComparison struct {
+	UserAgent string         `json:"user_agent"`
+	Sampled   int            `json:"sampled"`
+	Compared  int            `json:"compared"`
+	Divergent []UADivergence `json:"divergent,omitempty"`
+}
+
+// uaSample is a stored page chosen for the comparison.
+type uaSample struct {
+	url      string
+	language string
+	desktop  UAView
+}
+
+// mobileUserAgent returns the User-Agent of the second fetches.
+func (c *Crawler) mobileUserAgent() string {
+	ua := c.uaCompare.userAgent
+	if ua == "" {
+		ua = DefaultMobileUserAgent
+	}
+	if c.contact != "" {
+		return fmt.Sprintf("%s %s (+%s)", ua, defaultUserAgent, c.contact)
+	}
+	return ua + " " + defaultUserAgent
+}
+
+// uaSamples chooses the stored pages to fetch again: of those answering 200
+// with a parsed body, the fraction whose hash falls below it, then the max
+// of them with the lowest hashes.
+func (c *Crawler) uaSamples() ([]uaSample, error) {
+	const buckets = 1 << 20
+	samples := make(map[string]uaSample)
+	c.resultLock.Lock()
+	err := c.eachPage(false, func(page *PageData) {
+		if page.StatusCode != http.StatusOK || page.Alias || page.Bodyless || page.MalformedHTML || page.SlowBodyAborted ||
+			page.UnfollowedRedirect != "" || page.Change == ChangeUnchanged {
+			return
+		}
+		key := languageKey(page.Language, page.URL)
+		if c.uaCompare.fraction > 0 && float64(uaHash(key)%buckets) >= c.uaCompare.fraction*buckets {
+			return
+		}
+		final := page.FinalURL
+		if final == "" {
+			final = page.URL
+		}
+		samples[key] = uaSample{url: page.URL, language: page.Language, desktop: UAView{
+			StatusCode:  page.StatusCode,
+			FinalURL:    final,
+			Canonical:   page.Canonical,
+			Title:       strings.TrimSpace(page.Title),
+			ContentHash: page.ContentHash,
+		}}
+	})
+	c.resultLock.Unlock()
+
+	keys := make([]string, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if c.uaCompare.max > 0 && len(keys) > c.uaCompare.max {
+		keys = sampleURLs(keys, c.uaCompare.max)
+	}
+	chosen := make([]uaSample, len(keys))
+	for i, key := range keys {
+		chosen[i] = samples[key]
+	}
+	return chosen, err
+}
+
+// uaHash is the hash the samples of WithUACompare are chosen by.
+func uaHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// compareUserAgents fetches the samples of WithUACompare with the mobile
+// User-Agent and compares the answers with the stored pages.
+func (c *Crawler) compareUserAgents() *UAComparison {
+	samples, err := c.uaSamples()
+	if err != nil {
+		c.logf("Warning: %v, comparing the pages in memory only\n", err)
+	}
+	comparison := &UAComparison{UserAgent: c.mobileUserAgent(), Sampled: len(samples)}
+	c.logf("Comparing %d pages with a mobile User-Agent...\n", len(samples))
+	for _, sample := range samples {
+		c.waitRate()
+		if !c.reserveFetch() {
+			break
+		}
+		comparison.Compared++
+		mobile := c.fetchMobile(sample, comparison.UserAgent)
+		if fields := divergentFields(sample.desktop, mobile); len(fields) > 0 {
+			comparison.Divergent = append(comparison.Divergent, UADivergence{
+				URL:      sample.url,
+				Language: sample.language,
+				Fields:   fields,
+				Desktop:  sample.desktop,
+				Mobile:   mobile,
+			})
+		}
+	}
+	return comparison
+}
+
+// fetchMobile fetches the page of sample with the mobile userAgent.
+func (c *Crawler) fetchMobile(sample uaSample, userAgent string) UAView {
+	var view UAView
+	req, err := c.newRequest(sample.url)
+	if err != nil {
+		view.Error = err.Error()
+		return view
+	}
+	req = req.WithContext(c.ctx)
+	req.Header.Set("User-Agent", userAgent)
+	if sample.language != "" {
+		req.Header.Set("Accept-Language", sample.language)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		view.Error = err.Error()
+		return view
+	}
+	defer resp.Body.Close()
+	view.StatusCode = resp.StatusCode
+	view.FinalURL = NormalizeURL(resp.Request.URL)
+	if resp.StatusCode != http.StatusOK || !isHTMLContentType(resp.Header.Get("Content-Type")) {
+		return view
+	}
+
+	body := &countingReader{r: resp.Body}
+	var reader io.Reader = body
+	if c.maxBodySize > 0 {
+		reader = io.LimitReader(reader, c.maxBodySize)
+	}
+	content, err := io.ReadAll(reader)
+	c.addBytesFetched(body.n)
+	if err != nil {
+		view.Error = err.Error()
+		return view
+	}
+	content, _, _ = decodeBody(content, resp.Header.Get("Content-Type"))
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+	if err != nil {
+		view.Error = err.Error()
+		return view
+	}
+	view.Canonical, _ = extractDeclaredURLs(doc)
+	view.Title = strings.TrimSpace(doc.Find("title").Text())
+	view.ContentHash = contentHash(doc, content)
+	return view
+}
+
+// divergentFields lists what differs between the desktop and the mobile
+// answer of a page. A failed mobile fetch only differs in status.
+func divergentFields(desktop, mobile UAView) []string {
+	var fields []string
+	if desktop.StatusCode != mobile.StatusCode || mobile.Error != "" {
+		fields = append(fields, UAFieldStatus)
+	}
+	if mobile.Error != "" || mobile.StatusCode == 0 {
+		return fields
+	}
+	if desktop.FinalURL != mobile.FinalURL {
+		fields = append(fields, UAFieldFinalURL)
+	}
+	if mobile.StatusCode != http.StatusOK {
+		return fields
+	}
+	if desktop.Canonical != mobile.Canonical {
+		fields = append(fields, UAFieldCanonical)
+	}
+	if desktop.Title != mobile.Title {
+		fields = append(fields, UAFieldTitle)
+	}
+	if desktop.ContentHash != mobile.ContentHash {
+		fields = append(fields, UAFieldContent)
+	}
+	return fields
+}
@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// AnchorCounts classifies the anchors of a page that are not crawled.
+type AnchorCounts struct {
+	// Empty counts href="".
+	Empty int `json:"empty,omitempty"`
+	// Placeholder counts href="#".
+	Placeholder int `json:"placeholder,omitempty"`
+	// JavaScript counts javascript: hrefs, such as javascript:void(0).
+	JavaScript int `json:"javascript,omitempty"`
+	// Fragment counts in-page links to an element that exists.
+	Fragment int `json:"fragment,omitempty"`
+	// MissingFragment counts in-page links to an id the page lacks.
+	MissingFragment int `json:"missing_fragment,omitempty"`
+}
+
+// Placeholders is the number of anchors that go nowhere.
+func (a AnchorCounts) Placeholders() int {
+	return a.Empty + a.Placeholder + a.JavaScript + a.MissingFragment
+}
+
+// elementIDs returns the fragment targets of doc: element ids and the
+// names of <a name> anchors.
+func elementIDs(doc *goquery.Document) map[string]bool {
+	ids := make(map[string]bool)
+	doc.Find("[id]").Each(func(_ int, s *goquery.Selection) {
+		ids[s.AttrOr("id", "")] = true
+	})
+	doc.Find("a[name]").Each(func(_ int, s *goquery.Selection) {
+		ids[s.AttrOr("name", "")] = true
+	})
+	return ids
+}
+
+// countAnchors classifies the empty, fragment-only and javascript: anchors
+// of doc. It returns nil when the page has none.
+func countAnchors(doc *goquery.Document, anchors []anchor) *AnchorCounts {
+	var counts AnchorCounts
+	var ids map[string]bool
+	for _, a := range anchors {
+		href := strings.TrimSpace(a.href)
+		switch {
+		case href == "":
+			counts.Empty++
+		case href == "#":
+			counts.Placeholder++
+		case strings.HasPrefix(href, "#"):
+			if ids == nil {
+				ids = elementIDs(doc)
+			}
+			fragment, err := url.PathUnescape(href[1:])
+			if err != nil {
+				fragment = href[1:]
+			}
+			// Browsers scroll to the top for #top without a matching id.
+			if ids[fragment] || strings.EqualFold(fragment, "top") {
+				counts.Fragment++
+			} else {
+				counts.MissingFragment++
+			}
+		case strings.HasPrefix(strings.ToLower(href), "javascript:"):
+			counts.JavaScript++
+		}
+	}
+	if counts == (AnchorCounts{}) {
+		return nil
+	}
+	return &counts
+}
+
+// UXIssue is a page with many anchors that go nowhere.
+type UXIssue struct {
+	URL     string
+	Anchors AnchorCounts
+}
+
+// FindUXIssues returns the pages with at least min placeholder anchors,
+// most placeholders first.
+func FindUXIssues(pages []PageData, min int) []UXIssue {
+	var issues []UXIssue
+	for _, page := range pages {
+		if page.Anchors != nil && page.Anchors.Placeholders() >= min {
+			issues = append(issues, UXIssue{URL: page.URL, Anchors: *page.Anchors})
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if pi, pj := issues[i].Anchors.Placeholders(), issues[j].Anchors.Placeholders(); pi != pj {
+			return pi > pj
+		}
+		return issues[i].URL < issues[j].URL
+	})
+	return issues
+}
@@ -0,0 +1,202 @@
+package crawler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// Validation conditions. A count condition is written "count==N".
+const (
+	ValidationExists = "exists"
+	ValidationAbsent = "absent"
+)
+
+// maxValidationExamples is the number of failing pages listed per rule.
+const maxValidationExamples = 10
+
+// ValidationRule is an assertion checked on every parsed page whose URL
+// matches URLPattern, or on every parsed page without one: the elements
+// matching Selector must exist, be absent, or number exactly N with the
+// condition "count==N".
+type ValidationRule struct {
+	Name       string `yaml:"name" json:"name"`
+	Selector   string `yaml:"selector" json:"selector"`
+	Condition  string `yaml:"condition" json:"condition"`
+	URLPattern string `yaml:"url_pattern,omitempty" json:"url_pattern,omitempty"`
+}
+
+// ValidationFailure is a rule a page failed, with the number of elements
+// matching its selector.
+type ValidationFailure struct {
+	Rule  string `json:"rule"`
+	Count int    `json:"count"`
+}
+
+// ValidationSummary counts the pages a rule was checked on and the pages
+// failing it, with the first failing URLs in crawl order.
+type ValidationSummary struct {
+	Name      string   `json:"name"`
+	Selector  string   `json:"selector"`
+	Condition string   `json:"condition"`
+	Checked   int      `json:"checked"`
+	Failed    int      `json:"failed"`
+	Examples  []string `json:"examples,omitempty"`
+}
+
+// WithValidations sets the rules checked on every parsed page. Failures
+// are stored on the page under ValidationFailures and counted per rule in
+// the Validations of the result. The rules are checked when the crawl
+// starts.
+func WithValidations(rules []ValidationRule) Option {
+	return func(c *Crawler) {
+		c.validations.rules = rules
+	}
+}
+
+// ValidValidationRules reports the first problem of rules.
+func ValidValidationRules(rules []ValidationRule) error {
+	_, err := compileValidationRules(rules)
+	return err
+}
+
+type validationOptions struct {
+	rules    []ValidationRule
+	compiled []validationRule
+}
+
+// validationRule is a ValidationRule ready to be evaluated. checked counts
+// the pages it was evaluated on, those of a resumed crawl included.
+type validationRule struct {
+	name     string
+	url      *regexp.Regexp
+	selector cascadia.Selector
+	// want is the number of elements required, or -1 for at least one.
+	want    int
+	checked atomic.Int64
+}
+
+var countCondition = regexp.MustCompile(`^count\s*==\s*(\d+)$`)
+
+func compileValidationRules(rules []ValidationRule) ([]validationRule, error) {
+	compiled := make([]validationRule, len(rules))
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if strings.TrimSpace(rule.Name) == "" {
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %d: the name %q is used twice", i+1, rule.Name)
+		}
+		names[rule.Name] = true
+		r := &compiled[i]
+		r.name = rule.Name
+		if rule.Selector == "" {
+			return nil, fmt.Errorf("rule %q has no selector", rule.Name)
+		}
+		sel, err := cascadia.Compile(rule.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid selector %q: %v", rule.Name, rule.Selector, err)
+		}
+		r.selector = sel
+		switch condition := strings.TrimSpace(rule.Condition); condition {
+		case ValidationExists:
+			r.want = -1
+		case ValidationAbsent:
+			r.want = 0
+		default:
+			m := countCondition.FindStringSubmatch(condition)
+			if m == nil {
+				return nil, fmt.Errorf("rule %q: condition must be exists, absent or count==N, not %q", rule.Name, rule.Condition)
+			}
+			if r.want, err = strconv.Atoi(m[1]); err != nil {
+				return nil, fmt.Errorf("rule %q: invalid count in %q", rule.Name, rule.Condition)
+			}
+		}
+		if rule.URLPattern != "" {
+			re, err := regexp.Compile(rule.URLPattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: invalid url_pattern %q: %v", rule.Name, rule.URLPattern, err)
+			}
+			r.url = re
+		}
+	}
+	return compiled, nil
+}
+
+// validatePage returns the rules the parsed page at pageURL fails. The
+// rules run on the document already parsed for the links.
+func (c *Crawler) validatePage(pageURL string, doc *goquery.Document) []ValidationFailure {
+	var failures []ValidationFailure
+	for i := range c.validations.compiled {
+		r := &c.validations.compiled[i]
+		if r.url != nil && !r.url.MatchString(pageURL) {
+			continue
+		}
+		r.checked.Add(1)
+		n := doc.FindMatcher(r.selector).Length()
+		if r.want < 0 && n > 0 || r.want >= 0 && n == r.want {
+			continue
+		}
+		failures = append(failures, ValidationFailure{Rule: r.name, Count: n})
+	}
+	return failures
+}
+
+// restore adds the pages the rules were checked on before a resume.
+func (o *validationOptions) restore(previous []ValidationSummary) {
+	for _, summary := range previous {
+		for i := range o.compiled {
+			if o.compiled[i].name == summary.Name {
+				o.compiled[i].checked.Add(int64(summary.Checked))
+			}
+		}
+	}
+}
+
+// summarize counts the failures of every rule in pages, the stored pages
+// in crawl order.
+func (o *validationOptions) summarize(pages []PageData) []ValidationSummary {
+	if len(o.compiled) == 0 {
+		return nil
+	}
+	summaries := make([]ValidationSummary, len(o.compiled))
+	index := make(map[string]int, len(o.compiled))
+	for i, rule := range o.rules {
+		summaries[i] = ValidationSummary{
+			Name:      rule.Name,
+			Selector:  rule.Selector,
+			Condition: rule.Condition,
+			Checked:   int(o.compiled[i].checked.Load()),
+		}
+		index[rule.Name] = i
+	}
+	for _, page := range pages {
+		for _, failure := range page.ValidationFailures {
+			i, ok := index[failure.Rule]
+			if !ok {
+				continue
+			}
+			s := &summaries[i]
+			s.Failed++
+			if len(s.Examples) < maxValidationExamples {
+				s.Examples = append(s.Examples, page.URL)
+			}
+		}
+	}
+	return summaries
+}
+
+// failedValidations is the number of failed page checks in summaries.
+func failedValidations(summaries []ValidationSummary) int {
+	n := 0
+	for _, s := range summaries {
+		n += s.Failed
+	}
+	return n
+}
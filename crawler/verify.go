@@ -0,0 +1,266 @@
+package crawler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Expectation is a row of a URL inventory to verify: the status URL must
+// answer, such as "301", "3xx" for any redirect or "" for any status, and
+// Target, when set, the URL its redirects must end at. Line is the line of
+// the row in the inventory file.
+type Expectation struct {
+	URL    string `json:"url"`
+	Status string `json:"expected_status,omitempty"`
+	Target string `json:"expected_target,omitempty"`
+	Line   int    `json:"line"`
+}
+
+// Verification is the outcome of an Expectation: the status URL answered
+// and the URL its redirects ended at, as far as they were followed. Pass
+// is set when both match; otherwise Problems says what differs.
+type Verification struct {
+	Expectation
+	StatusCode int      `json:"status_code,omitempty"`
+	FinalURL   string   `json:"final_url,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	Pass       bool     `json:"pass"`
+	Problems   []string `json:"problems,omitempty"`
+}
+
+// LoadExpectations reads a URL inventory: CSV rows of a URL, an optional
+// expected status and an optional expected redirect target, which may be
+// relative to the URL. A first row starting with "url" is a header. URLs
+// and targets are normalized like crawled URLs.
+func LoadExpectations(path string) ([]Expectation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening expectations: %v", err)
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+	var expectations []Expectation
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading expectations %s: %v", path, err)
+		}
+		line, _ := r.FieldPos(0)
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "url") {
+			continue
+		}
+		if len(record) > 3 {
+			return nil, fmt.Errorf("%s:%d: %d fields, want url, expected status and expected target", path, line, len(record))
+		}
+		exp, err := parseExpectation(record, line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		expectations = append(expectations, exp)
+	}
+	if len(expectations) == 0 {
+		return nil, fmt.Errorf("%s lists no URLs", path)
+	}
+	return expectations, nil
+}
+
+func parseExpectation(record []string, line int) (Expectation, error) {
+	field := func(i int) string {
+		if i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	u, err := url.Parse(field(0))
+	if err != nil || !u.IsAbs() || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return Expectation{}, fmt.Errorf("%q is not an absolute http or https URL", field(0))
+	}
+	exp := Expectation{URL: NormalizeURL(u), Status: strings.ToLower(field(1)), Line: line}
+	if !validExpectedStatus(exp.Status) {
+		return Expectation{}, fmt.Errorf("expected status %q is not a status such as 301 or a class such as 3xx", field(1))
+	}
+	if target := field(2); target != "" {
+		t, err := u.Parse(target)
+		if err != nil || (t.Scheme != "http" && t.Scheme != "https") {
+			return Expectation{}, fmt.Errorf("expected target %q is not an http or https URL", target)
+		}
+		exp.Target = NormalizeURL(t)
+	}
+	return exp, nil
+}
+
+// validExpectedStatus reports whether status is empty, a status code or a
+// class of them such as 3xx.
+func validExpectedStatus(status string) bool {
+	if status == "" {
+		return true
+	}
+	if len(status) == 3 && status[1:] == "xx" {
+		return status[0] >= '1' && status[0] <= '5'
+	}
+	code, err := strconv.Atoi(status)
+	return err == nil && code >= 100 && code <= 599
+}
+
+// statusMatches reports whether code answers the expected status.
+func statusMatches(expected string, code int) bool {
+	switch {
+	case expected == "":
+		return true
+	case strings.HasSuffix(expected, "xx"):
+		return code/100 == int(expected[0]-'0')
+	default:
+		return strconv.Itoa(code) == expected
+	}
+}
+
+// ExpectationURLs returns the URLs a crawl verifying expectations fetches:
+// the URLs of the inventory and the expected targets, so that redirects to
+// them are followed, each once. A target that is not itself in the
+// inventory costs a request of its own, made whether or not a redirect
+// reaches it; ExpectationTargets counts them.
+func ExpectationURLs(expectations []Expectation) []string {
+	seen := make(map[string]bool)
+	var urls []string
+	for _, exp := range expectations {
+		for _, u := range []string{exp.URL, exp.Target} {
+			if u != "" && !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls
+}
+
+// ExpectationTargets returns how many of the URLs of ExpectationURLs are
+// only there as expected targets.
+func ExpectationTargets(expectations []Expectation) int {
+	listed := make(map[string]bool)
+	for _, exp := range expectations {
+		listed[exp.URL] = true
+	}
+	return len(ExpectationURLs(expectations)) - len(listed)
+}
+
+// urlOutcome is what a URL answered during a crawl.
+type urlOutcome struct {
+	status int
+	final  string
+	err    string
+}
+
+// urlOutcomes indexes the stored pages and errors of result by every URL
+// they answer for, redirect hops included. The final URL of a redirect is
+// the end of its chain: the last URL fetched, or the unlisted URL a
+// redirect of a crawl with WithOnlyListed was not followed to.
+func urlOutcomes(result *CrawlResult) map[string]urlOutcome {
+	outcomes := make(map[string]urlOutcome)
+	for _, page := range result.Pages {
+		end := page.FinalURL
+		if end == "" {
+			end = page.URL
+		}
+		final := end
+		if page.UnfollowedRedirect != "" {
+			final = page.UnfollowedRedirect
+		}
+		for _, hop := range page.RedirectChain {
+			if _, ok := outcomes[hop.URL]; !ok {
+				outcomes[hop.URL] = urlOutcome{status: hop.StatusCode, final: final}
+			}
+		}
+		if _, ok := outcomes[end]; !ok && !page.Alias {
+			outcome := urlOutcome{status: page.StatusCode}
+			if page.UnfollowedRedirect != "" {
+				outcome.final = page.UnfollowedRedirect
+			}
+			outcomes[end] = outcome
+		}
+	}
+	for _, e := range result.Errors {
+		if _, ok := outcomes[e.URL]; !ok {
+			outcomes[e.URL] = urlOutcome{status: e.StatusCode, err: e.Error}
+		}
+	}
+	return outcomes
+}
+
+// VerifyExpectations compares every expectation with what its URL answered
+// in result, the crawl of ExpectationURLs: the first status of the URL,
+// before any redirect, and the URL its redirects ended at.
+func VerifyExpectations(result *CrawlResult, expectations []Expectation) []Verification {
+	outcomes := urlOutcomes(result)
+	verifications := make([]Verification, len(expectations))
+	for i, exp := range expectations {
+		v := Verification{Expectation: exp}
+		outcome, ok := outcomes[exp.URL]
+		switch {
+		case !ok:
+			v.Problems = append(v.Problems, "not fetched")
+		case outcome.status == 0:
+			v.Error = outcome.err
+			v.Problems = append(v.Problems, "no response: "+outcome.err)
+		default:
+			v.StatusCode, v.FinalURL, v.Error = outcome.status, outcome.final, outcome.err
+			if !statusMatches(exp.Status, outcome.status) {
+				v.Problems = append(v.Problems, fmt.Sprintf("status %d, expected %s", outcome.status, exp.Status))
+			}
+			switch {
+			case exp.Target == "":
+			case outcome.final == "":
+				v.Problems = append(v.Problems, fmt.Sprintf("no redirect, expected one to %s", exp.Target))
+			case outcome.final != exp.Target:
+				v.Problems = append(v.Problems, fmt.Sprintf("redirects to %s, expected %s", outcome.final, exp.Target))
+			}
+		}
+		v.Pass = len(v.Problems) == 0
+		verifications[i] = v
+	}
+	return verifications
+}
+
+// verifyHeader is the header of WriteVerificationsCSV.
+var verifyHeader = []string{"line", "url", "expected_status", "expected_target", "status_code", "final_url", "result", "problems"}
+
+// WriteVerificationsCSV writes one row per verification to filename, with
+// "pass" or "fail" and the problems found.
+func WriteVerificationsCSV(filename string, verifications []Verification) error {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write(verifyHeader)
+	for _, v := range verifications {
+		result := "fail"
+		if v.Pass {
+			result = "pass"
+		}
+		status := ""
+		if v.StatusCode != 0 {
+			status = strconv.Itoa(v.StatusCode)
+		}
+		w.Write([]string{strconv.Itoa(v.Line), v.URL, v.Status, v.Target, status, v.FinalURL, result, strings.Join(v.Problems, "; ")})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,229 @@
+package crawler
+
+import (
+	"encoding/csv"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeInventory writes content to an inventory file and returns its path.
+func writeInventory(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "inventory.csv")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadExpectations(t *testing.T) {
+	path := writeInventory(t, `URL, expected_status, expected_target
+# migrated in 2026
+HTTP://Example.COM:80/old,301,/new/../pricing
+https://example.com/blog/2019, 3XX ,https://Blog.example.com/archive
+https://example.com/pricing?b=1,200,
+https://example.com/beta
+`)
+	expectations, err := LoadExpectations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Expectation{
+		{URL: "http://example.com/old", Status: "301", Target: "http://example.com/pricing", Line: 3},
+		{URL: "https://example.com/blog/2019", Status: "3xx", Target: "https://blog.example.com/archive", Line: 4},
+		{URL: "https://example.com/pricing?b=1", Status: "200", Line: 5},
+		{URL: "https://example.com/beta", Line: 6},
+	}
+	if !slices.Equal(expectations, want) {
+		t.Errorf("expectations %+v, want %+v", expectations, want)
+	}
+
+	// Only the first row can be the header.
+	if _, err := LoadExpectations(writeInventory(t, "https://example.com/\nurl,200\n")); err == nil || !strings.Contains(err.Error(), `:2: "url" is not an absolute http or https URL`) {
+		t.Errorf("a header in the second row: %v", err)
+	}
+
+	tests := []struct {
+		name, content, error string
+	}{
+		{"too many fields", "https://example.com/,301,/new,extra\n", ":1: 4 fields, want url, expected status and expected target"},
+		{"relative URL", "/old,301\n", `:1: "/old" is not an absolute http or https URL`},
+		{"other scheme", "ftp://example.com/,200\n", `:1: "ftp://example.com/" is not an absolute`},
+		{"invalid status", "url\nhttps://example.com/,moved\n", `:2: expected status "moved" is not a status`},
+		{"status out of range", "https://example.com/,600\n", `expected status "600"`},
+		{"invalid class", "https://example.com/,6xx\n", `expected status "6xx"`},
+		{"target of another scheme", "https://example.com/,301,mailto:me@example.com\n", `:1: expected target "mailto:me@example.com" is not an http or https URL`},
+		{"header only", "url,expected_status\n# nothing yet\n", "lists no URLs"},
+		{"unterminated quote", "\"https://example.com/,200\n", "error reading expectations"},
+	}
+	for _, tt := range tests {
+		if _, err := LoadExpectations(writeInventory(t, tt.content)); err == nil || !strings.Contains(err.Error(), tt.error) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.error)
+		}
+	}
+	if _, err := LoadExpectations(filepath.Join(t.TempDir(), "missing.csv")); err == nil || !strings.Contains(err.Error(), "error opening expectations") {
+		t.Errorf("a missing inventory: %v", err)
+	}
+}
+
+func TestStatusMatches(t *testing.T) {
+	tests := []struct {
+		expected string
+		code     int
+		want     bool
+	}{
+		{"", 200, true},
+		{"", 503, true},
+		{"301", 301, true},
+		{"301", 302, false},
+		{"3xx", 301, true},
+		{"3xx", 308, true},
+		{"3xx", 200, false},
+		{"3xx", 404, false},
+		{"4xx", 410, true},
+		{"5xx", 499, false},
+	}
+	for _, tt := range tests {
+		if got := statusMatches(tt.expected, tt.code); got != tt.want {
+			t.Errorf("statusMatches(%q, %d) = %t, want %t", tt.expected, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestExpectationURLs(t *testing.T) {
+	expectations := []Expectation{
+		{URL: "http://example.com/a", Target: "http://example.com/b"},
+		{URL: "http://example.com/b"},
+		{URL: "http://example.com/c", Target: "http://example.com/b"},
+		{URL: "http://example.com/a", Status: "200"},
+	}
+	urls := ExpectationURLs(expectations)
+	if want := []string{"http://example.com/a", "http://example.com/b", "http://example.com/c"}; !slices.Equal(urls, want) {
+		t.Errorf("URLs %q, want %q", urls, want)
+	}
+	if n := ExpectationTargets(expectations); n != 0 {
+		t.Errorf("%d extra targets, want none with every target in the inventory", n)
+	}
+	expectations = append(expectations, Expectation{URL: "http://example.com/d", Target: "http://example.com/e"}, Expectation{URL: "http://example.com/f", Target: "http://example.com/e"})
+	if n := ExpectationTargets(expectations); n != 1 {
+		t.Errorf("%d extra targets, want /e", n)
+	}
+}
+
+func TestVerifyExpectations(t *testing.T) {
+	result := &CrawlResult{
+		Pages: []PageData{
+			{URL: "http://example.com/pricing", StatusCode: 200},
+			{
+				URL: "http://example.com/old", FinalURL: "http://example.com/pricing", StatusCode: 200,
+				RedirectChain: []RedirectHop{{URL: "http://example.com/old", StatusCode: 301}},
+			},
+			{URL: "http://example.com/hop", StatusCode: 302, UnfollowedRedirect: "http://example.com/middle"},
+			{URL: "http://example.com/gone", StatusCode: 404},
+		},
+		Errors: []CrawlError{
+			{URL: "http://example.com/down", Error: "connection refused"},
+			{URL: "http://example.com/broken", StatusCode: 500, Error: "500 Internal Server Error"},
+		},
+	}
+	tests := []struct {
+		exp      Expectation
+		status   int
+		final    string
+		problems []string
+	}{
+		{Expectation{URL: "http://example.com/old", Status: "301", Target: "http://example.com/pricing"}, 301, "http://example.com/pricing", nil},
+		{Expectation{URL: "http://example.com/old", Status: "3xx", Target: "http://example.com/pricing"}, 301, "http://example.com/pricing", nil},
+		{Expectation{URL: "http://example.com/old", Status: "302"}, 301, "http://example.com/pricing", []string{"status 301, expected 302"}},
+		{Expectation{URL: "http://example.com/old", Target: "http://example.com/other"}, 301, "http://example.com/pricing", []string{"redirects to http://example.com/pricing, expected http://example.com/other"}},
+		{Expectation{URL: "http://example.com/pricing", Status: "2xx"}, 200, "", nil},
+		{Expectation{URL: "http://example.com/pricing", Status: "3xx", Target: "http://example.com/new"}, 200, "", []string{"status 200, expected 3xx", "no redirect, expected one to http://example.com/new"}},
+		// A redirect to an unlisted URL ends the chain there.
+		{Expectation{URL: "http://example.com/hop", Target: "http://example.com/pricing"}, 302, "http://example.com/middle", []string{"redirects to http://example.com/middle, expected http://example.com/pricing"}},
+		{Expectation{URL: "http://example.com/gone", Status: "410"}, 404, "", []string{"status 404, expected 410"}},
+		{Expectation{URL: "http://example.com/broken", Status: "200"}, 500, "", []string{"status 500, expected 200"}},
+		{Expectation{URL: "http://example.com/down", Status: "200"}, 0, "", []string{"no response: connection refused"}},
+		{Expectation{URL: "http://example.com/missing"}, 0, "", []string{"not fetched"}},
+	}
+	var expectations []Expectation
+	for _, tt := range tests {
+		expectations = append(expectations, tt.exp)
+	}
+	verifications := VerifyExpectations(result, expectations)
+	for i, tt := range tests {
+		v := verifications[i]
+		if v.Expectation != tt.exp || v.StatusCode != tt.status || v.FinalURL != tt.final || !slices.Equal(v.Problems, tt.problems) || v.Pass != (tt.problems == nil) {
+			t.Errorf("%s expecting %q to %q: %+v, want status %d, final URL %q and problems %q", tt.exp.URL, tt.exp.Status, tt.exp.Target, v, tt.status, tt.final, tt.problems)
+		}
+	}
+	if v := verifications[9]; v.Error != "connection refused" {
+		t.Errorf("no response: error %q, want the one of the crawl", v.Error)
+	}
+}
+
+// TestCrawlVerify verifies an inventory against a site, crawled the way
+// the verify command does.
+func TestCrawlVerify(t *testing.T) {
+	site := newTestSite(t, map[string]http.HandlerFunc{
+		"/":         htmlPage(`<a href="/unlisted">not fetched</a>`),
+		"/old":      http.RedirectHandler("/New/", http.StatusMovedPermanently).ServeHTTP,
+		"/New/":     htmlPage("new"),
+		"/hop":      redirect("/middle"),
+		"/middle":   redirect("/New/"),
+		"/unlisted": htmlPage("unlisted"),
+	})
+	path := writeInventory(t, "url,expected_status,expected_target\n"+
+		site.URL+"/old,3xx,sub/../New/\n"+
+		site.URL+"/hop,302,/New/\n"+
+		site.URL+"/gone,410\n")
+	expectations, err := LoadExpectations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := ExpectationURLs(expectations)
+	if want := []string{site.URL + "/old", site.URL + "/New/", site.URL + "/hop", site.URL + "/gone"}; !slices.Equal(urls, want) {
+		t.Fatalf("URLs %q, want %q", urls, want)
+	}
+	result := crawlTestSite(t, site.URL+"/old", 0, WithOnlyListed(urls))
+
+	var passed []bool
+	for _, v := range VerifyExpectations(result, expectations) {
+		passed = append(passed, v.Pass)
+	}
+	if want := []bool{true, false, false}; !slices.Equal(passed, want) {
+		t.Errorf("passed %v, want %v", passed, want)
+	}
+	if site.requested("/middle") != 0 || site.requested("/unlisted") != 0 || site.requested("/") != 0 {
+		t.Errorf("requests %v, want only the inventory URLs and targets", site.requests)
+	}
+
+	out := filepath.Join(t.TempDir(), "verify.csv")
+	if err := WriteVerificationsCSV(out, VerifyExpectations(result, expectations)); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || !reflect.DeepEqual(rows[0], verifyHeader) {
+		t.Fatalf("rows %q, want the header and 3 rows", rows)
+	}
+	want := [][]string{
+		{"2", site.URL + "/old", "3xx", site.URL + "/New/", "301", site.URL + "/New/", "pass", ""},
+		{"3", site.URL + "/hop", "302", site.URL + "/New/", "302", site.URL + "/middle", "fail", "redirects to " + site.URL + "/middle, expected " + site.URL + "/New/"},
+		{"4", site.URL + "/gone", "410", "", "404", "", "fail", "status 404, expected 410"},
+	}
+	if !reflect.DeepEqual(rows[1:], want) {
+		t.Errorf("rows %q, want %q", rows[1:], want)
+	}
+}
@@ -0,0 +1,115 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StopVisitedCap starts the stop reason of a crawl whose visited set
+// reached the cap of WithMaxVisited.
+const StopVisitedCap = "max visited"
+
+// visitedEntryOverhead approximates the bytes a key of the visited or the
+// discovered URLs takes besides the URL itself: the string header, the
+// value and the share of the map's buckets.
+const visitedEntryOverhead = 64
+
+// VisitedStats is the size of the visited set of a crawl. Entries counts
+// the distinct URLs it discovered or requested, redirect targets included,
+// once per pass of a multi-language crawl. ApproxBytes estimates the
+// memory they take from the length of their URLs. Max is the cap of
+// WithMaxVisited, zero when unlimited.
+type VisitedStats struct {
+	Entries     int   `json:"entries"`
+	ApproxBytes int64 `json:"approx_bytes"`
+	Max         int   `json:"max,omitempty"`
+}
+
+// WithMaxVisited caps the entries of the visited set at n, as a bound on
+// the memory a crawl of an unexpectedly large site takes. A crawl reaching
+// it stops discovering URLs, with a stop reason starting with
+// StopVisitedCap, and finishes fetching those it already found. Zero is
+// unlimited.
+func WithMaxVisited(n int) Option {
+	return func(c *Crawler) {
+		c.maxVisited = n
+	}
+}
+
+// addVisitedKey counts a key added to the visited or the discovered URLs,
+// as a new entry unless the other already has it. It must be called with
+// visitedLock held for writing.
+func (c *Crawler) addVisitedKey(key string, known bool) {
+	c.counters.visitedBytes.Add(visitedEntryOverhead)
+	if !known {
+		c.counters.visitedEntries.Add(1)
+		c.counters.visitedBytes.Add(int64(len(key)))
+	}
+}
+
+// unvisit removes key from the visited URLs. It must be called with
+// visitedLock held for writing.
+func (c *Crawler) unvisit(key string) {
+	if !c.visited[key] {
+		return
+	}
+	delete(c.visited, key)
+	c.counters.visitedBytes.Add(-visitedEntryOverhead)
+	if _, ok := c.discovered[key]; !ok {
+		c.counters.visitedEntries.Add(-1)
+		c.counters.visitedBytes.Add(-int64(len(key)))
+	}
+}
+
+// visitedFull reports whether the visited set reached the cap of
+// WithMaxVisited. It only reads an atomic counter.
+func (c *Crawler) visitedFull() bool {
+	return c.maxVisited > 0 && c.counters.visitedEntries.Load() >= int64(c.maxVisited)
+}
+
+// isDiscovered reports whether url is in the discovered URLs of the pass.
+func (c *Crawler) isDiscovered(url string) bool {
+	c.visitedLock.RLock()
+	defer c.visitedLock.RUnlock()
+	_, ok := c.discovered[c.visitKey(url)]
+	return ok
+}
+
+// stopVisitedCap records that the visited set is full.
+func (c *Crawler) stopVisitedCap() {
+	c.stop(fmt.Sprintf("%s (%d entries) reached", StopVisitedCap, c.maxVisited))
+}
+
+// visitedStats returns the current size of the visited set.
+func (c *Crawler) visitedStats() VisitedStats {
+	return VisitedStats{
+		Entries:     int(c.counters.visitedEntries.Load()),
+		ApproxBytes: c.counters.visitedBytes.Load(),
+		Max:         c.maxVisited,
+	}
+}
+
+// formatBytes formats n as a number of bytes with a binary unit, such as
+// 12.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// String formats the stats as in the progress output.
+func (s VisitedStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d entries, ~%s", s.Entries, formatBytes(s.ApproxBytes))
+	if s.Max > 0 {
+		fmt.Fprintf(&b, " (%.0f%% of the cap)", float64(s.Entries)/float64(s.Max)*100)
+	}
+	return b.String()
+}
@@ -0,0 +1,442 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWarmupDuration and DefaultWarmupRequests bound the warmup of
+	// WithWarmup: it ends after the first of them.
+	DefaultWarmupDuration = 30 * time.Second
+	DefaultWarmupRequests = 10
+
+	// warmupRPS is the rate of the warmup, unless the crawl is slower.
+	warmupRPS = 1.0
+	// maxWarmupRPS caps the rate the warmup chooses, so a fast site is
+	// still reached gradually by the ramp.
+	maxWarmupRPS = 10.0
+	// warmupRampInterval is how long each step of the ramp from the chosen
+	// settings to the configured ones lasts, unless a test shortens it.
+	warmupRampInterval = 10 * time.Second
+	// minRampInterval is the interval below which the ramp of a crawl
+	// without rate limiting turns it off.
+	minRampInterval = 10 * time.Millisecond
+)
+
+// WithWarmup starts the crawl with a probing phase of at most d, or
+// DefaultWarmupDuration, and at most requests requests, or
+// DefaultWarmupRequests: robots.txt, the seed and the first URLs found are
+// fetched one at a time at one request per second, or the crawl rate if it
+// is lower, while their response times and errors are measured.
+//
+// The measurements pick the rate and the requests in flight the crawl
+// continues with: below the probing rate when the site throttled or
+// failed, and otherwise about two requests per median response time, at
+// most 10 per second. From there the rate doubles every 10 seconds
+// without throttling until it reaches the crawl rate, when the bound on
+// requests in flight is lifted as well. The Warmup of the result records
+// the measurements and the choice. A throttled request stops the ramp, so
+// the slow-down of throttling sticks, and throttling during the warmup
+// keeps the crawl at the chosen settings.
+//
+// The chosen settings apply to the whole crawl, like the crawl rate: with
+// WithHosts the hosts share them, so the host that answered the probes
+// worst decides them for all.
+//
+// Deterministic crawls and playback skip the warmup, which would make the
+// results depend on response times.
+func WithWarmup(d time.Duration, requests int) Option {
+	return func(c *Crawler) {
+		if d <= 0 {
+			d = DefaultWarmupDuration
+		}
+		if requests <= 0 {
+			requests = DefaultWarmupRequests
+		}
+		c.warmup.enabled = true
+		c.warmup.duration = d
+		c.warmup.requests = requests
+		c.warmup.rampInterval = warmupRampInterval
+	}
+}
+
+// WarmupReport is what the warmup measured and the settings it chose.
+type WarmupReport struct {
+	DurationMs       int64        `json:"duration_ms"`
+	Requests         int          `json:"requests"`
+	Errors           int          `json:"errors,omitempty"`
+	Throttled        int          `json:"throttled,omitempty"`
+	MedianResponseMs int64        `json:"median_response_ms"`
+	P90ResponseMs    int64        `json:"p90_response_ms"`
+	Hosts            []WarmupHost `json:"hosts"`
+
+	// ChosenRPS and ChosenMaxInFlight are the settings the crawl continued
+	// with, and Reason why. FullRateAfterMs is how long after the start of
+	// the warmup the ramp reached the crawl rate, 0 if it did not.
+	ChosenRPS         float64 `json:"chosen_rps"`
+	ChosenMaxInFlight int     `json:"chosen_max_in_flight"`
+	Reason            string  `json:"reason"`
+	FullRateAfterMs   int64   `json:"full_rate_after_ms,omitempty"`
+}
+
+// WarmupHost is what the warmup measured on one host. Errors counts
+// network errors and 5xx statuses, Throttled 429 and 503 statuses.
+type WarmupHost struct {
+	Host             string `json:"host"`
+	Requests         int    `json:"requests"`
+	Errors           int    `json:"errors,omitempty"`
+	Throttled        int    `json:"throttled,omitempty"`
+	MedianResponseMs int64  `json:"median_response_ms"`
+}
+
+type warmupOptions struct {
+	enabled      bool
+	duration     time.Duration
+	requests     int
+	rampInterval time.Duration
+
+	lock    sync.Mutex
+	active  bool
+	start   time.Time
+	samples []warmupSample
+	end     sync.Once
+	// stop is closed when the crawl ends, which ends the ramp.
+	stop chan struct{}
+	// limit bounds the requests in flight, 0 for no bound. changed is
+	// closed whenever a slot frees up or limit changes.
+	limit    int
+	inFlight int
+	changed  chan struct{}
+}
+
+// warmupSample is one response, or error, of the warmup.
+type warmupSample struct {
+	host    string
+	elapsed time.Duration
+	status  int
+	err     bool
+}
+
+// throttled reports whether the sample asked the crawler to slow down.
+func (s warmupSample) throttled() bool {
+	return s.status == http.StatusTooManyRequests || s.status == http.StatusServiceUnavailable
+}
+
+// failed reports whether the sample is an error other than throttling.
+func (s warmupSample) failed() bool {
+	return s.err || s.status >= 500 && !s.throttled()
+}
+
+// warmupSlots bounds the requests in flight during the warmup and the ramp
+// after it and measures the responses of the warmup. A request holds its
+// slot until its response body is read to the end or closed, so following
+// a meta refresh after reading a page does not wait on its own slot.
+func (c *Crawler) warmupSlots(next Fetcher) Fetcher {
+	return fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		if err := c.warmup.acquire(req.Context()); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		sample := warmupSample{host: normalizeHost(req.URL.Scheme, req.URL.Host), elapsed: time.Since(start), err: err != nil}
+		if resp != nil {
+			sample.status = resp.StatusCode
+		}
+		if c.warmup.record(sample) {
+			go c.endWarmup()
+		}
+		if err != nil {
+			c.warmup.release()
+			return nil, err
+		}
+		resp.Body = &readReleasingBody{releasingBody{ReadCloser: resp.Body, done: c.warmup.release}}
+		return resp, nil
+	})
+}
+
+// readReleasingBody is a releasingBody that also calls done once reading
+// it fails or reaches the end.
+type readReleasingBody struct {
+	releasingBody
+}
+
+func (b *readReleasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+// acquire blocks until a request may be sent or ctx is done.
+func (w *warmupOptions) acquire(ctx context.Context) error {
+	for {
+		w.lock.Lock()
+		if w.limit == 0 || w.inFlight < w.limit {
+			w.inFlight++
+			w.lock.Unlock()
+			return nil
+		}
+		changed := w.changed
+		w.lock.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (w *warmupOptions) release() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.inFlight--
+	w.notify()
+}
+
+// setLimit bounds the requests in flight to limit, 0 for no bound.
+func (w *warmupOptions) setLimit(limit int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.limit = limit
+	w.notify()
+}
+
+// notify wakes the requests waiting for a slot. It must be called with
+// lock held.
+func (w *warmupOptions) notify() {
+	if w.changed != nil {
+		close(w.changed)
+	}
+	w.changed = make(chan struct{})
+}
+
+// record adds sample while the warmup is active and reports whether it
+// was the last one the warmup needed.
+func (w *warmupOptions) record(sample warmupSample) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.active {
+		return false
+	}
+	w.samples = append(w.samples, sample)
+	return len(w.samples) == w.requests
+}
+
+// startWarmup slows the crawl down to the probing settings and ends the
+// warmup once its duration is over. It returns the function ending the
+// warmup and the ramp, to be called once when the crawl is done.
+func (c *Crawler) startWarmup() func() {
+	if !c.warmup.enabled {
+		return func() {}
+	}
+	if c.deterministic || c.playback {
+		c.logf("Warmup skipped: the crawl is deterministic or replays recordings\n")
+		c.warmup.enabled = false
+		return func() {}
+	}
+	c.warmup.lock.Lock()
+	c.warmup.active = true
+	c.warmup.start = time.Now()
+	c.warmup.lock.Unlock()
+	c.warmup.setLimit(1)
+	c.rateLimiter.setInterval(max(c.configuredInterval(), rpsInterval(warmupRPS)))
+	c.logf("Warmup: probing %s one request at a time for up to %s or %d requests\n",
+		c.baseURL.Host, c.warmup.duration, c.warmup.requests)
+
+	c.warmup.stop = make(chan struct{})
+	go func() {
+		timer := time.NewTimer(c.warmup.duration)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			c.endWarmup()
+		case <-c.warmup.stop:
+		}
+	}()
+	return func() {
+		close(c.warmup.stop)
+		// A crawl shorter than the warmup still reports its measurements.
+		c.endWarmup()
+	}
+}
+
+// configuredInterval is the interval between requests of the crawl rate,
+// 0 without rate limiting.
+func (c *Crawler) configuredInterval() time.Duration {
+	if c.requestsPerSecond == UnlimitedRPS {
+		return 0
+	}
+	return rpsInterval(c.requestsPerSecond)
+}
+
+func rpsInterval(requestsPerSecond float64) time.Duration {
+	return time.Duration(float64(time.Second) / requestsPerSecond)
+}
+
+// endWarmup applies the settings the warmup measurements call for to the
+// crawl rate limiter and the requests in flight, which all hosts share,
+// records them in the result and starts the ramp to the configured
+// settings. Only the first call has an effect.
+func (c *Crawler) endWarmup() {
+	c.warmup.end.Do(func() {
+		c.warmup.lock.Lock()
+		c.warmup.active = false
+		samples := c.warmup.samples
+		elapsed := time.Since(c.warmup.start)
+		c.warmup.lock.Unlock()
+
+		report := chooseWarmupSettings(samples, c.requestsPerSecond)
+		report.DurationMs = elapsed.Milliseconds()
+		c.resultLock.Lock()
+		c.result.Warmup = report
+		c.resultLock.Unlock()
+		select {
+		case <-c.warmup.stop:
+			c.logf("Warmup: the crawl ended during the warmup, after %d requests\n", report.Requests)
+			return
+		default:
+		}
+		c.warmup.setLimit(report.ChosenMaxInFlight)
+		c.rateLimiter.setInterval(rpsInterval(report.ChosenRPS))
+		c.logf("Warmup: %d requests in %s, median response %dms, p90 %dms; continuing at %s requests per second, %d in flight (%s)\n",
+			report.Requests, elapsed.Round(time.Millisecond), report.MedianResponseMs, report.P90ResponseMs,
+			formatRPS(report.ChosenRPS), report.ChosenMaxInFlight, report.Reason)
+		if report.Throttled > 0 {
+			c.logf("Warmup: the site throttled the probes, not ramping up to the crawl rate\n")
+			return
+		}
+		go c.rampUp(report)
+	})
+}
+
+// rampUp doubles the rate and the requests in flight every rampInterval
+// until the configured settings are reached, the site throttles the crawl
+// or the crawl ends.
+func (c *Crawler) rampUp(report *WarmupReport) {
+	target := c.configuredInterval()
+	limit := report.ChosenMaxInFlight
+	throttled := c.counters.throttleEvents.Load()
+	ticker := time.NewTicker(c.warmup.rampInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.warmup.stop:
+			return
+		}
+		if c.counters.throttleEvents.Load() != throttled {
+			c.logf("Warmup: the site throttled the crawl, staying at the current rate\n")
+			return
+		}
+		interval := c.rateLimiter.speedUp(target)
+		limit *= 2
+		if interval > target || target == 0 && limit < UnlimitedMaxInFlight {
+			c.debugf("Warmup: ramping up to one request per %s, %d in flight\n", interval, limit)
+			c.warmup.setLimit(limit)
+			continue
+		}
+		c.warmup.setLimit(0)
+		c.warmup.lock.Lock()
+		after := time.Since(c.warmup.start)
+		c.warmup.lock.Unlock()
+		c.resultLock.Lock()
+		report.FullRateAfterMs = after.Milliseconds()
+		c.resultLock.Unlock()
+		c.logf("Warmup: reached the crawl rate after %s\n", after.Round(time.Second))
+		return
+	}
+}
+
+// chooseWarmupSettings measures samples and picks the rate and requests in
+// flight to continue with, at most requestsPerSecond unless it is
+// UnlimitedRPS. The rate is decided by the host that answered worst, as
+// the hosts share it.
+func chooseWarmupSettings(samples []warmupSample, requestsPerSecond float64) *WarmupReport {
+	report := &WarmupReport{Requests: len(samples), Hosts: []WarmupHost{}}
+	byHost := make(map[string][]warmupSample)
+	var elapsed []time.Duration
+	for _, s := range samples {
+		byHost[s.host] = append(byHost[s.host], s)
+		if s.throttled() {
+			report.Throttled++
+		} else if s.failed() {
+			report.Errors++
+		}
+		if !s.err {
+			elapsed = append(elapsed, s.elapsed)
+		}
+	}
+	median, p90 := percentile(elapsed, 0.5), percentile(elapsed, 0.9)
+	report.MedianResponseMs, report.P90ResponseMs = median.Milliseconds(), p90.Milliseconds()
+
+	var slowest WarmupHost
+	for host, hostSamples := range byHost {
+		h := WarmupHost{Host: host, Requests: len(hostSamples)}
+		var hostElapsed []time.Duration
+		for _, s := range hostSamples {
+			if s.throttled() {
+				h.Throttled++
+			} else if s.failed() {
+				h.Errors++
+			}
+			if !s.err {
+				hostElapsed = append(hostElapsed, s.elapsed)
+			}
+		}
+		h.MedianResponseMs = percentile(hostElapsed, 0.5).Milliseconds()
+		report.Hosts = append(report.Hosts, h)
+		if h.MedianResponseMs >= slowest.MedianResponseMs {
+			slowest = h
+		}
+	}
+	sort.Slice(report.Hosts, func(i, j int) bool { return report.Hosts[i].Host < report.Hosts[j].Host })
+
+	rps, inFlight := warmupRPS, 1
+	switch {
+	case report.Throttled > 0:
+		rps = warmupRPS / 2
+		report.Reason = fmt.Sprintf("throttled %d times", report.Throttled)
+	case report.Errors*5 >= len(samples) && report.Errors > 0:
+		report.Reason = fmt.Sprintf("%d of %d requests failed", report.Errors, len(samples))
+	case len(elapsed) == 0:
+		report.Reason = "no responses"
+	default:
+		slowMedian := time.Duration(slowest.MedianResponseMs) * time.Millisecond
+		rps = maxWarmupRPS
+		if slowMedian > 0 {
+			rps = math.Min(maxWarmupRPS, math.Max(warmupRPS, 2/slowMedian.Seconds()))
+		}
+		inFlight = min(UnlimitedMaxInFlight, int(math.Ceil(rps*p90.Seconds()))+1)
+		report.Reason = fmt.Sprintf("median response %dms on %s", slowest.MedianResponseMs, slowest.Host)
+	}
+	if requestsPerSecond != UnlimitedRPS && rps > requestsPerSecond {
+		rps = requestsPerSecond
+		report.Reason += ", capped by the crawl rate"
+	}
+	report.ChosenRPS, report.ChosenMaxInFlight = rps, inFlight
+	return report
+}
+
+// percentile returns the p-th percentile of durations, 0 < p <= 1, by
+// the nearest rank; 0 for none.
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+}
+
+// formatRPS formats a rate of requests per second without trailing zeros.
+func formatRPS(rps float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", rps), "0"), ".")
+}
@@ -0,0 +1,293 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	ms := func(values ...int) []time.Duration {
+		var durations []time.Duration
+		for _, v := range values {
+			durations = append(durations, time.Duration(v)*time.Millisecond)
+		}
+		return durations
+	}
+	tests := []struct {
+		durations []time.Duration
+		p         float64
+		want      time.Duration
+	}{
+		{nil, 0.5, 0},
+		{ms(7), 0.5, 7 * time.Millisecond},
+		{ms(7), 0.9, 7 * time.Millisecond},
+		{ms(10, 1, 9, 2, 8, 3, 7, 4, 6, 5), 0.5, 5 * time.Millisecond},
+		{ms(10, 1, 9, 2, 8, 3, 7, 4, 6, 5), 0.9, 9 * time.Millisecond},
+		{ms(10, 1, 9, 2, 8, 3, 7, 4, 6, 5), 1, 10 * time.Millisecond},
+		{ms(3, 1, 2), 0.5, 2 * time.Millisecond},
+		{ms(4, 1, 3, 2), 0.5, 2 * time.Millisecond},
+		{ms(4, 1, 3, 2), 0.9, 4 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		before := slices.Clone(tt.durations)
+		if got := percentile(tt.durations, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.durations, tt.p, got, tt.want)
+		}
+		if !slices.Equal(tt.durations, before) {
+			t.Errorf("percentile sorted its input %v", before)
+		}
+	}
+}
+
+func TestChooseWarmupSettings(t *testing.T) {
+	// samples returns n responses of host taking ms milliseconds with the
+	// status, or a network error for status 0.
+	samples := func(host string, n, ms, status int) []warmupSample {
+		var s []warmupSample
+		for range n {
+			s = append(s, warmupSample{host: host, elapsed: time.Duration(ms) * time.Millisecond, status: status, err: status == 0})
+		}
+		return s
+	}
+	join := func(groups ...[]warmupSample) []warmupSample { return slices.Concat(groups...) }
+
+	tests := []struct {
+		name    string
+		samples []warmupSample
+		rps     float64
+		want    WarmupReport
+	}{
+		{
+			name:    "fast site",
+			samples: samples("a", 10, 100, 200),
+			rps:     50,
+			want:    WarmupReport{Requests: 10, MedianResponseMs: 100, P90ResponseMs: 100, ChosenRPS: maxWarmupRPS, ChosenMaxInFlight: 2, Reason: "median response 100ms on a"},
+		},
+		{
+			name:    "slow site",
+			samples: join(samples("a", 8, 1000, 200), samples("a", 2, 3000, 200)),
+			rps:     50,
+			want:    WarmupReport{Requests: 10, MedianResponseMs: 1000, P90ResponseMs: 3000, ChosenRPS: 2, ChosenMaxInFlight: 7, Reason: "median response 1000ms on a"},
+		},
+		{
+			name:    "very slow site",
+			samples: samples("a", 3, 4000, 200),
+			rps:     50,
+			want:    WarmupReport{Requests: 3, MedianResponseMs: 4000, P90ResponseMs: 4000, ChosenRPS: warmupRPS, ChosenMaxInFlight: 5, Reason: "median response 4000ms on a"},
+		},
+		{
+			name:    "throttled",
+			samples: join(samples("a", 9, 100, 200), samples("a", 1, 100, http.StatusTooManyRequests)),
+			rps:     50,
+			want:    WarmupReport{Requests: 10, Throttled: 1, MedianResponseMs: 100, P90ResponseMs: 100, ChosenRPS: warmupRPS / 2, ChosenMaxInFlight: 1, Reason: "throttled 1 times"},
+		},
+		{
+			name:    "503 is throttling",
+			samples: join(samples("a", 4, 100, 200), samples("a", 2, 100, http.StatusServiceUnavailable)),
+			rps:     50,
+			want:    WarmupReport{Requests: 6, Throttled: 2, MedianResponseMs: 100, P90ResponseMs: 100, ChosenRPS: warmupRPS / 2, ChosenMaxInFlight: 1, Reason: "throttled 2 times"},
+		},
+		{
+			name:    "failing",
+			samples: join(samples("a", 8, 100, 200), samples("a", 1, 100, 500), samples("a", 1, 0, 0)),
+			rps:     50,
+			want:    WarmupReport{Requests: 10, Errors: 2, MedianResponseMs: 100, P90ResponseMs: 100, ChosenRPS: warmupRPS, ChosenMaxInFlight: 1, Reason: "2 of 10 requests failed"},
+		},
+		{
+			name:    "one failure of ten",
+			samples: join(samples("a", 9, 100, 200), samples("a", 1, 100, 502)),
+			rps:     50,
+			want:    WarmupReport{Requests: 10, Errors: 1, MedianResponseMs: 100, P90ResponseMs: 100, ChosenRPS: maxWarmupRPS, ChosenMaxInFlight: 2, Reason: "median response 100ms on a"},
+		},
+		{
+			name:    "only network errors",
+			samples: samples("a", 3, 0, 0),
+			rps:     50,
+			want:    WarmupReport{Requests: 3, Errors: 3, ChosenRPS: warmupRPS, ChosenMaxInFlight: 1, Reason: "3 of 3 requests failed"},
+		},
+		{
+			name:    "no responses",
+			samples: nil,
+			rps:     50,
+			want:    WarmupReport{ChosenRPS: warmupRPS, ChosenMaxInFlight: 1, Reason: "no responses"},
+		},
+		{
+			name:    "capped by rps",
+			samples: samples("a", 10, 100, 200),
+			rps:     2,
+			want:    WarmupReport{Requests: 10, MedianResponseMs: 100, P90ResponseMs: 100, ChosenRPS: 2, ChosenMaxInFlight: 2, Reason: "median response 100ms on a, capped by the crawl rate"},
+		},
+		{
+			name:    "throttled and capped by rps",
+			samples: samples("a", 2, 100, http.StatusTooManyRequests),
+			rps:     0.2,
+			want:    WarmupReport{Requests: 2, Throttled: 2, MedianResponseMs: 100, P90ResponseMs: 100, ChosenRPS: 0.2, ChosenMaxInFlight: 1, Reason: "throttled 2 times, capped by the crawl rate"},
+		},
+		{
+			name:    "unlimited rps",
+			samples: samples("a", 10, 10, 200),
+			rps:     UnlimitedRPS,
+			want:    WarmupReport{Requests: 10, MedianResponseMs: 10, P90ResponseMs: 10, ChosenRPS: maxWarmupRPS, ChosenMaxInFlight: 2, Reason: "median response 10ms on a"},
+		},
+		{
+			name:    "slowest host decides",
+			samples: join(samples("fast", 6, 50, 200), samples("slow", 4, 500, 200)),
+			rps:     50,
+			want:    WarmupReport{Requests: 10, MedianResponseMs: 50, P90ResponseMs: 500, ChosenRPS: 4, ChosenMaxInFlight: 3, Reason: "median response 500ms on slow"},
+		},
+	}
+	for _, tt := range tests {
+		got := chooseWarmupSettings(tt.samples, tt.rps)
+		if got.Hosts == nil {
+			t.Errorf("%s: nil hosts, want a list", tt.name)
+		}
+		got.Hosts = nil
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+
+	report := chooseWarmupSettings(join(samples("b", 2, 300, 200), samples("a", 3, 100, 200), samples("b", 1, 0, 0), samples("a", 1, 100, 429)), 50)
+	want := []WarmupHost{
+		{Host: "a", Requests: 4, Throttled: 1, MedianResponseMs: 100},
+		{Host: "b", Requests: 3, Errors: 1, MedianResponseMs: 300},
+	}
+	if !slices.Equal(report.Hosts, want) {
+		t.Errorf("hosts %+v, want %+v", report.Hosts, want)
+	}
+}
+
+// warmupLog collects the log of a crawl whose ramp logs from a goroutine
+// of its own.
+type warmupLog struct {
+	lock sync.Mutex
+	log  strings.Builder
+}
+
+func (l *warmupLog) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.log.Write(p)
+}
+
+func (l *warmupLog) String() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.log.String()
+}
+
+// warmupCrawler returns a crawler of site at rps with a warmup of d and a
+// ramp whose steps last rampInterval.
+func warmupCrawler(t *testing.T, site *testSite, rps float64, d, rampInterval time.Duration, log io.Writer, opts ...Option) *Crawler {
+	t.Helper()
+	c, err := NewCrawler(site.URL, 1, rps, append([]Option{WithLogOutput(log), WithWarmup(d, 100)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.warmup.rampInterval = rampInterval
+	return c
+}
+
+// TestWarmupRamp crawls a site with a short warmup and ramp, and checks
+// that the crawl starts at the chosen settings and reaches the crawl rate.
+func TestWarmupRamp(t *testing.T) {
+	site := budgetSite(t, 60)
+	log := &warmupLog{}
+	result, err := warmupCrawler(t, site, 500, 20*time.Millisecond, 10*time.Millisecond, log).Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := result.Warmup
+	if report == nil || report.Requests < 1 || report.ChosenRPS > maxWarmupRPS || report.ChosenMaxInFlight < 1 {
+		t.Fatalf("warmup %+v, want the probes and settings of at most %v requests per second", report, maxWarmupRPS)
+	}
+	if report.FullRateAfterMs == 0 || report.FullRateAfterMs < report.DurationMs {
+		t.Errorf("full rate after %dms, warmup of %dms; want the ramp to reach the crawl rate after the warmup", report.FullRateAfterMs, report.DurationMs)
+	}
+	for _, want := range []string{"Warmup: probing", "continuing at", "Warmup: reached the crawl rate"} {
+		if !strings.Contains(log.String(), want) {
+			t.Errorf("the log has no %q: %s", want, log.String())
+		}
+	}
+	if len(result.Pages) != 61 {
+		t.Errorf("%d pages crawled, want 61", len(result.Pages))
+	}
+	// At the rate the warmup chose, at most 10 a second, the 61 pages would
+	// take 6 seconds or more.
+	if took := result.EndTime.Sub(result.StartTime); took > 3*time.Second {
+		t.Errorf("the crawl took %s, want the ramp to speed up the queued requests", took)
+	}
+}
+
+// TestWarmupRampThrottled checks that throttling during the ramp stops it.
+func TestWarmupRampThrottled(t *testing.T) {
+	site := budgetSite(t, 1)
+	log := &warmupLog{}
+	c := warmupCrawler(t, site, 1000, time.Minute, 50*time.Millisecond, log)
+	c.warmup.stop = make(chan struct{})
+	c.warmup.start = time.Now()
+	c.rateLimiter.setInterval(rpsInterval(warmupRPS))
+	c.warmup.setLimit(1)
+	report := &WarmupReport{ChosenRPS: warmupRPS, ChosenMaxInFlight: 1}
+	done := make(chan struct{})
+	go func() {
+		c.rampUp(report)
+		close(done)
+	}()
+	// Throttled before the first step, once the ramp noted the count.
+	time.Sleep(10 * time.Millisecond)
+	c.counters.throttleEvents.Add(1)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the ramp went on after throttling")
+	}
+	if report.FullRateAfterMs != 0 || !strings.Contains(log.String(), "the site throttled the crawl, staying at the current rate") {
+		t.Errorf("full rate after %dms, log %q; want the ramp stopped", report.FullRateAfterMs, log.String())
+	}
+	if c.warmup.limit == 0 {
+		t.Error("the throttled ramp lifted the bound on requests in flight")
+	}
+}
+
+// TestWarmupSkipped checks that deterministic crawls skip the warmup, and
+// that there is none without WithWarmup.
+func TestWarmupSkipped(t *testing.T) {
+	site := budgetSite(t, 2)
+	log := &warmupLog{}
+	result, err := warmupCrawler(t, site, 1000, time.Minute, time.Millisecond, log, WithDeterministic(1)).Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Warmup != nil || !strings.Contains(log.String(), "Warmup skipped") {
+		t.Errorf("deterministic crawl: warmup %+v, log %q", result.Warmup, log.String())
+	}
+	if result := crawlTestSite(t, site.URL, 1); result.Warmup != nil {
+		t.Errorf("warmup %+v without WithWarmup", result.Warmup)
+	}
+}
+
+// TestWarmupShortCrawl checks that a crawl over before the warmup ends
+// still reports its probes, and does not ramp.
+func TestWarmupShortCrawl(t *testing.T) {
+	site := budgetSite(t, 1)
+	log := &warmupLog{}
+	result, err := warmupCrawler(t, site, 1000, time.Minute, time.Millisecond, log).Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Warmup == nil || result.Warmup.Requests < 2 || result.Warmup.FullRateAfterMs != 0 || math.IsNaN(result.Warmup.ChosenRPS) {
+		t.Errorf("warmup %+v, want the probes of the 2 pages", result.Warmup)
+	}
+	if !strings.Contains(log.String(), "the crawl ended during the warmup") {
+		t.Errorf("log %q", log.String())
+	}
+}
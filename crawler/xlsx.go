@@ -0,0 +1,244 @@
+package crawler
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxXLSXHyperlinks is the number of hyperlinks Excel accepts per sheet.
+// Cells beyond it are written as plain text.
+const maxXLSXHyperlinks = 65530
+
+// xlsxCell is one cell of a row written by xlsxWriter.
+type xlsxCell struct {
+	value  string
+	number bool
+	link   bool
+}
+
+func textCell(value string) xlsxCell {
+	return xlsxCell{value: value}
+}
+
+func intCell(value int64) xlsxCell {
+	return xlsxCell{value: strconv.FormatInt(value, 10), number: true}
+}
+
+// linkCell renders value as a clickable hyperlink to itself.
+func linkCell(value string) xlsxCell {
+	return xlsxCell{value: value, link: value != ""}
+}
+
+// xlsxWriter streams a minimal Office Open XML workbook. Sheets are written
+// one at a time, rows are encoded as they are added, and only the hyperlink
+// targets of the current sheet are kept in memory.
+type xlsxWriter struct {
+	zw     *zip.Writer
+	sheets []string
+
+	sheet      *bufio.Writer
+	row        int
+	hyperlinks []xlsxHyperlink
+}
+
+type xlsxHyperlink struct {
+	ref    string
+	target string
+}
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	return &xlsxWriter{zw: zip.NewWriter(w)}
+}
+
+// addSheet finishes the current sheet and starts a new one whose first row
+// is header. The header row is bold and frozen.
+func (x *xlsxWriter) addSheet(name string, header []string) error {
+	if err := x.finishSheet(); err != nil {
+		return err
+	}
+
+	x.sheets = append(x.sheets, name)
+	f, err := x.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.sheets)))
+	if err != nil {
+		return err
+	}
+	x.sheet = bufio.NewWriter(f)
+	x.row = 0
+	x.hyperlinks = nil
+
+	x.sheet.WriteString(xml.Header)
+	x.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`)
+	x.sheet.WriteString(`<sheetViews><sheetView workbookViewId="0">` +
+		`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>` +
+		`</sheetView></sheetViews><sheetData>`)
+
+	cells := make([]xlsxCell, len(header))
+	for i, h := range header {
+		cells[i] = textCell(h)
+	}
+	return x.writeRow(cells, 1)
+}
+
+// addRow appends a data row to the current sheet.
+func (x *xlsxWriter) addRow(cells ...xlsxCell) error {
+	return x.writeRow(cells, 0)
+}
+
+func (x *xlsxWriter) writeRow(cells []xlsxCell, style int) error {
+	x.row++
+	fmt.Fprintf(x.sheet, `<row r="%d">`, x.row)
+	for i, cell := range cells {
+		ref := columnName(i) + strconv.Itoa(x.row)
+		cellStyle := style
+		if cell.link && len(x.hyperlinks) < maxXLSXHyperlinks {
+			x.hyperlinks = append(x.hyperlinks, xlsxHyperlink{ref: ref, target: cell.value})
+			cellStyle = 2
+		}
+
+		styleAttr := ""
+		if cellStyle != 0 {
+			styleAttr = fmt.Sprintf(` s="%d"`, cellStyle)
+		}
+		if cell.number {
+			fmt.Fprintf(x.sheet, `<c r="%s"%s><v>%s</v></c>`, ref, styleAttr, cell.value)
+			continue
+		}
+		fmt.Fprintf(x.sheet, `<c r="%s"%s t="inlineStr"><is><t>`, ref, styleAttr)
+		xml.EscapeText(x.sheet, []byte(sanitizeXMLText(cell.value)))
+		x.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := x.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (x *xlsxWriter) finishSheet() error {
+	if x.sheet == nil {
+		return nil
+	}
+
+	x.sheet.WriteString(`</sheetData>`)
+	if len(x.hyperlinks) > 0 {
+		x.sheet.WriteString(`<hyperlinks>`)
+		for i, link := range x.hyperlinks {
+			fmt.Fprintf(x.sheet, `<hyperlink ref="%s" r:id="rId%d"/>`, link.ref, i+1)
+		}
+		x.sheet.WriteString(`</hyperlinks>`)
+	}
+	x.sheet.WriteString(`</worksheet>`)
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	x.sheet = nil
+
+	if len(x.hyperlinks) == 0 {
+		return nil
+	}
+	f, err := x.zw.Create(fmt.Sprintf("xl/worksheets/_rels/sheet%d.xml.rels", len(x.sheets)))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString(xml.Header)
+	w.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, link := range x.hyperlinks {
+		fmt.Fprintf(w, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="`, i+1)
+		xml.EscapeText(w, []byte(link.target))
+		w.WriteString(`" TargetMode="External"/>`)
+	}
+	w.WriteString(`</Relationships>`)
+	return w.Flush()
+}
+
+// Close writes the workbook parts that reference the sheets and finishes
+// the zip archive.
+func (x *xlsxWriter) Close() error {
+	if err := x.finishSheet(); err != nil {
+		return err
+	}
+
+	var contentTypes, workbook, workbookRels strings.Builder
+	contentTypes.WriteString(xml.Header)
+	contentTypes.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(xml.Header)
+	workbook.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRels.WriteString(xml.Header)
+	workbookRels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	for i, name := range x.sheets {
+		n := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbook, `<sheet name="`)
+		xml.EscapeText(&workbook, []byte(name))
+		fmt.Fprintf(&workbook, `" sheetId="%d" r:id="rId%d"/>`, n, n)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(x.sheets)+1)
+	workbookRels.WriteString(`</Relationships>`)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		f, err := x.zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+	return x.zw.Close()
+}
+
+// xlsxStyles defines cell style 1 (bold header) and 2 (hyperlink).
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="3"><font><sz val="11"/><name val="Calibri"/></font>` +
+	`<font><b/><sz val="11"/><name val="Calibri"/></font>` +
+	`<font><u/><sz val="11"/><color rgb="FF0563C1"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="0" fontId="2" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`</styleSheet>`
+
+// columnName converts a zero-based column index to its spreadsheet letters.
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// sanitizeXMLText drops characters that are not allowed in XML 1.0, which
+// would otherwise make the workbook unreadable.
+func sanitizeXMLText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r <= 0xD7FF) || (r >= 0xE000 && r <= 0xFFFD) || r >= 0x10000 {
+			return r
+		}
+		return -1
+	}, s)
+}
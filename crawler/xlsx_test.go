@@ -0,0 +1,143 @@
+package crawler
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readXLSX opens the workbook at filename and returns the names of its
+// sheets and the number of rows of each, checking that every part is
+// well-formed XML.
+func readXLSX(t *testing.T, filename string) ([]string, map[string]int) {
+	t.Helper()
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = string(data)
+		d := xml.NewDecoder(strings.NewReader(parts[f.Name]))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not well-formed: %v", f.Name, err)
+			}
+		}
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("workbook has no %s", name)
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal([]byte(parts["xl/workbook.xml"]), &workbook); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	rows := make(map[string]int)
+	for i, sheet := range workbook.Sheets {
+		var data struct {
+			Rows []struct{} `xml:"sheetData>row"`
+		}
+		part := fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		if err := xml.Unmarshal([]byte(parts[part]), &data); err != nil {
+			t.Fatalf("%s: %v", part, err)
+		}
+		names = append(names, sheet.Name)
+		rows[sheet.Name] = len(data.Rows)
+	}
+	return names, rows
+}
+
+func TestWriteXLSXReport(t *testing.T) {
+	result := &CrawlResult{
+		Pages: []PageData{
+			{URL: "http://example.com/", Title: "Home", StatusCode: 200, Links: []string{"http://example.com/gone", "http://example.com/old"}},
+			{URL: "http://example.com/old", FinalURL: "http://example.com/new", Title: "Home", StatusCode: 200,
+				RedirectChain: []RedirectHop{{URL: "http://example.com/old", StatusCode: 301}}},
+			{URL: "http://example.com/ctl", Title: "Bell\a and <tags> & ampersands", StatusCode: 200},
+		},
+		Errors: []CrawlError{{URL: "http://example.com/gone", StatusCode: 404, Category: CategoryHTTPStatus, Error: "not found"}},
+	}
+	filename := filepath.Join(t.TempDir(), "report.xlsx")
+	if err := writeXLSXReport(filename, result, slicePages(result.Pages)); err != nil {
+		t.Fatal(err)
+	}
+	names, rows := readXLSX(t, filename)
+	if want := []string{"Pages", "Broken Links", "Redirects", "Duplicate Titles"}; strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("sheets are %q, want %q", names, want)
+	}
+	// Every sheet has its header row.
+	for sheet, want := range map[string]int{"Pages": 4, "Broken Links": 2, "Redirects": 2, "Duplicate Titles": 3} {
+		if rows[sheet] != want {
+			t.Errorf("sheet %s has %d rows, want %d", sheet, rows[sheet], want)
+		}
+	}
+}
+
+func TestWriteXLSXReportPageError(t *testing.T) {
+	failing := errors.New("spill file is gone")
+	pages := func(fn func([]PageData) error) error { return failing }
+	err := writeXLSXReport(filepath.Join(t.TempDir(), "report.xlsx"), &CrawlResult{}, pages)
+	if err == nil || !strings.Contains(err.Error(), failing.Error()) {
+		t.Errorf("writeXLSXReport = %v, want the error of the pages", err)
+	}
+}
+
+// failingWriter accepts n bytes and fails the writes after them.
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errors.New("disk full")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestXLSXWriterReportsWriteErrors(t *testing.T) {
+	x := newXLSXWriter(&failingWriter{n: 1024})
+	err := x.addSheet("Pages", csvPageHeader)
+	for i := 0; err == nil && i < 10000; i++ {
+		err = x.addRow(pageRow(PageData{URL: fmt.Sprintf("http://example.com/%d", i), Title: strings.Repeat("title ", 20)})...)
+	}
+	if err == nil {
+		err = x.Close()
+	}
+	if err == nil {
+		t.Error("writing to a failing writer reported no error")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for index, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(index); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", index, got, want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"webcrawler/crawler"
+)
+
+// runFingerprint implements the "fingerprint" subcommand, which prints the
+// fingerprint of saved crawl results and, with -compare-fingerprint, the
+// sections that changed since earlier ones. It reports whether they
+// changed.
+func runFingerprint(args []string) (bool, error) {
+	fs := flag.NewFlagSet("fingerprint", flag.ExitOnError)
+	previous := fs.String("compare-fingerprint", "", "earlier crawl results to compare the fingerprint with")
+	asJSON := fs.Bool("json", false, "print the fingerprint as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: webcrawler fingerprint [-compare-fingerprint previous.json] [-json] results.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return false, fmt.Errorf("give one results file")
+	}
+
+	fp, err := crawler.LoadFingerprint(fs.Arg(0))
+	if err != nil {
+		return false, err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(fp); err != nil {
+			return false, err
+		}
+	} else {
+		fmt.Printf("Fingerprint %s (%d URLs)\n", fp.Hash, fp.URLs)
+		for _, s := range fp.Sections {
+			fmt.Printf("  %s %6d  %s\n", s.Hash, s.URLs, s.Section)
+		}
+	}
+	if *previous == "" {
+		return false, nil
+	}
+	before, err := crawler.LoadFingerprint(*previous)
+	if err != nil {
+		return false, err
+	}
+	changes := crawler.CompareFingerprints(before, fp)
+	printFingerprintChanges(changes, *previous)
+	return len(changes) > 0, nil
+}
+
+// printFingerprintChanges lists the sections whose fingerprint differs from
+// that of the results in path.
+func printFingerprintChanges(changes []crawler.SectionChange, path string) {
+	if len(changes) == 0 {
+		fmt.Printf("\nFingerprint unchanged since %s\n", path)
+		return
+	}
+	fmt.Printf("\nSections changed since %s: %d\n", path, len(changes))
+	for _, c := range changes {
+		fmt.Printf("  %-8s %s (%d URLs, %d before)\n", c.Change, c.Section, c.URLs, c.PreviousURLs)
+	}
+}
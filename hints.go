@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"webcrawler/crawler"
+)
+
+// minHintURLs is the number of URLs a pattern needs before the hints
+// mention it; a handful of odd URLs is not worth a change of settings.
+const minHintURLs = 5
+
+// hint is a finding of the crawl and the setting that addresses it.
+type hint struct {
+	Finding    string
+	Suggestion string
+}
+
+// hintRule looks for one pattern in the results of a crawl.
+type hintRule func(result *crawler.CrawlResult) (hint, bool)
+
+// hintRules are checked in order, the most consequential first.
+var hintRules = []hintRule{
+	seedRedirectHint,
+	circuitHint,
+	visitedCapHint,
+	budgetHint,
+	depthLimitHint,
+	trackingParamsHint,
+	nonHTMLHint,
+	throttleHint,
+	timeoutHint,
+	tooLargeHint,
+	slowBodyHint,
+	malformedHint,
+}
+
+// findHints runs every rule over result. Rules looking at pages only see
+// result.Pages, which lacks the pages spilled to disk in a saved crawl.
+func findHints(result *crawler.CrawlResult) []hint {
+	var hints []hint
+	for _, rule := range hintRules {
+		if h, ok := rule(result); ok {
+			hints = append(hints, h)
+		}
+	}
+	return hints
+}
+
+// printHints prints the findings of the crawl, if there are any.
+func printHints(result *crawler.CrawlResult) {
+	hints := findHints(result)
+	if len(hints) == 0 {
+		return
+	}
+	fmt.Printf("\nFindings:\n")
+	for _, h := range hints {
+		fmt.Printf("  - %s: %s\n", h.Finding, h.Suggestion)
+	}
+}
+
+// countErrors counts the errors of result in category.
+func countErrors(result *crawler.CrawlResult, category string) int {
+	n := 0
+	for _, e := range result.Errors {
+		if e.Category == category {
+			n++
+		}
+	}
+	return n
+}
+
+// seedRedirectHint notices a seed that redirects to another host, whose
+// links are then all off-domain.
+func seedRedirectHint(result *crawler.CrawlResult) (hint, bool) {
+	base, err := url.Parse(result.BaseURL)
+	if err != nil {
+		return hint{}, false
+	}
+	seed := crawler.NormalizeURL(base)
+	for _, page := range result.Pages {
+		if page.URL != seed || page.FinalURL == "" {
+			continue
+		}
+		final, err := url.Parse(page.FinalURL)
+		if err != nil || strings.EqualFold(final.Host, base.Host) {
+			return hint{}, false
+		}
+		return hint{
+			Finding:    fmt.Sprintf("the seed redirected to %s, another host, so its links were not followed", final.Host),
+			Suggestion: fmt.Sprintf("start from that host with -url %s", page.FinalURL),
+		}, true
+	}
+	return hint{}, false
+}
+
+// budgetHint notices a crawl that a budget stopped early.
+func budgetHint(result *crawler.CrawlResult) (hint, bool) {
+	reason := result.StopReason
+	if reason == "" || reason == crawler.StopCancelled || strings.HasPrefix(reason, crawler.StopCircuitOpen) ||
+		strings.HasPrefix(reason, crawler.StopVisitedCap) {
+		return hint{}, false
+	}
+	flag := "the budget"
+	switch {
+	case strings.HasPrefix(reason, "max pages"):
+		flag = "-max-pages"
+	case strings.HasPrefix(reason, "max duration"):
+		flag = "-max-duration"
+	case strings.HasPrefix(reason, "max bytes"):
+		flag = "-max-bytes"
+	}
+	return hint{
+		Finding:    fmt.Sprintf("the crawl stopped early (%s) after fetching %.0f%% of the URLs found", reason, result.Coverage*100),
+		Suggestion: fmt.Sprintf("raise %s, or narrow the crawl with -include and -exclude", flag),
+	}, true
+}
+
+// visitedCapHint notices a crawl that stopped discovering URLs at the cap
+// of -max-visited.
+func visitedCapHint(result *crawler.CrawlResult) (hint, bool) {
+	if !strings.HasPrefix(result.StopReason, crawler.StopVisitedCap) {
+		return hint{}, false
+	}
+	size := ""
+	if result.Visited != nil {
+		size = fmt.Sprintf(", holding %s", result.Visited)
+	}
+	return hint{
+		Finding:    fmt.Sprintf("the visited set reached its cap%s, and URLs found after that were not crawled", size),
+		Suggestion: "split the crawl with -shard so each process keeps a smaller set, narrow it with -include and -exclude, or raise -max-visited if the machine has memory to spare",
+	}, true
+}
+
+// circuitHint notices hosts the circuit breaker gave up on.
+func circuitHint(result *crawler.CrawlResult) (hint, bool) {
+	if result.Circuit == nil || !result.Circuit.GaveUp {
+		return hint{}, false
+	}
+	hosts := "the site"
+	if len(result.Circuit.GaveUpHosts) > 0 {
+		hosts = strings.Join(result.Circuit.GaveUpHosts, ", ")
+	}
+	return hint{
+		Finding:    fmt.Sprintf("%s kept failing and the crawl gave up on it, skipping %d URLs", hosts, result.Circuit.Skipped),
+		Suggestion: "resume the crawl with -resume once the site recovers, or lower -rps if it blocks the crawler",
+	}, true
+}
+
+// depthLimitHint notices links on the pages at the depth limit that lead
+// to pages crawled nowhere else. A crawl a budget stopped is left to
+// budgetHint.
+func depthLimitHint(result *crawler.CrawlResult) (hint, bool) {
+	if result.MaxDepth == crawler.UnlimitedDepth || result.StopReason != "" || result.ListAudit != nil || result.Shard != nil {
+		return hint{}, false
+	}
+	var include, exclude []*regexp.Regexp
+	maxPathDepth := 0
+	if result.Config != nil {
+		include, _ = crawler.CompilePatterns(result.Config.Include)
+		exclude, _ = crawler.CompilePatterns(result.Config.Exclude)
+		maxPathDepth = result.Config.MaxPathDepth
+	}
+	known := make(map[string]bool)
+	for _, page := range result.Pages {
+		known[page.URL] = true
+	}
+	for _, e := range result.Errors {
+		known[e.URL] = true
+	}
+	for _, u := range result.DangerousURLs {
+		known[u.URL] = true
+	}
+	beyond := make(map[string]bool)
+	for _, page := range result.Pages {
+		if page.Depth != result.MaxDepth {
+			continue
+		}
+		for _, link := range page.Links {
+			if !known[link] && matchesFilters(link, include, exclude) && (maxPathDepth == 0 || crawler.PathDepth(link) <= maxPathDepth) {
+				beyond[link] = true
+			}
+		}
+	}
+	if len(beyond) < minHintURLs {
+		return hint{}, false
+	}
+	return hint{
+		Finding:    fmt.Sprintf("%d URLs linked from pages at the depth limit (%d) were not crawled", len(beyond), result.MaxDepth),
+		Suggestion: "raise -depth to reach them",
+	}, true
+}
+
+// matchesFilters reports whether the include and exclude patterns of a
+// crawl let link through.
+func matchesFilters(link string, include, exclude []*regexp.Regexp) bool {
+	for _, re := range exclude {
+		if re.MatchString(link) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, re := range include {
+		if re.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackingExclude is the -exclude pattern trackingParamsHint suggests.
+const trackingExclude = `[?&](utm_[a-z]+|gclid|fbclid|msclkid)=`
+
+// isTrackingParam reports whether a query parameter only tracks where a
+// visitor came from.
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || name == "gclid" || name == "fbclid" || name == "msclkid"
+}
+
+// trackingParamsHint notices crawled URLs that only differ from others by
+// tracking parameters.
+func trackingParamsHint(result *crawler.CrawlResult) (hint, bool) {
+	groups := make(map[string][]bool)
+	for _, page := range result.Pages {
+		if page.Alias {
+			continue
+		}
+		u, err := url.Parse(page.URL)
+		if err != nil {
+			continue
+		}
+		query := u.Query()
+		tracked := false
+		for name := range query {
+			if isTrackingParam(name) {
+				query.Del(name)
+				tracked = true
+			}
+		}
+		u.RawQuery = query.Encode()
+		key := crawler.NormalizeURL(u)
+		groups[key] = append(groups[key], tracked)
+	}
+	n := 0
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		for _, tracked := range group {
+			if tracked {
+				n++
+			}
+		}
+	}
+	if n < minHintURLs {
+		return hint{}, false
+	}
+	return hint{
+		Finding:    fmt.Sprintf("%d URLs differ from other crawled URLs only by utm_* or click ID parameters", n),
+		Suggestion: fmt.Sprintf("skip them with -exclude '%s'", trackingExclude),
+	}, true
+}
+
+// plainExtension matches the file extensions nonHTMLHint puts in a
+// pattern.
+var plainExtension = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// nonHTMLHint notices crawls spending a large share of their requests on
+// files that are not HTML.
+func nonHTMLHint(result *crawler.CrawlResult) (hint, bool) {
+	n := countErrors(result, crawler.CategoryNonHTML)
+	if n < minHintURLs || result.FetchedURLs == 0 || float64(n) < 0.2*float64(result.FetchedURLs) {
+		return hint{}, false
+	}
+	counts := make(map[string]int)
+	for _, e := range result.Errors {
+		if e.Category != crawler.CategoryNonHTML {
+			continue
+		}
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			continue
+		}
+		if ext := strings.ToLower(strings.TrimPrefix(path.Ext(u.Path), ".")); plainExtension.MatchString(ext) {
+			counts[ext]++
+		}
+	}
+	var exts []string
+	for ext := range counts {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		if counts[exts[i]] != counts[exts[j]] {
+			return counts[exts[i]] > counts[exts[j]]
+		}
+		return exts[i] < exts[j]
+	})
+	suggestion := "skip the links to them with -exclude"
+	if len(exts) > 0 {
+		suggestion = fmt.Sprintf(`skip them with -exclude '\.(%s)($|\?)'`, strings.Join(exts[:min(len(exts), 5)], "|"))
+	}
+	return hint{
+		Finding:    fmt.Sprintf("%.0f%% of the requests (%d) were for files that are not HTML", float64(n)*100/float64(result.FetchedURLs), n),
+		Suggestion: suggestion,
+	}, true
+}
+
+// throttleHint notices a server that asked the crawler to slow down.
+func throttleHint(result *crawler.CrawlResult) (hint, bool) {
+	if result.ThrottleEvents == 0 {
+		return hint{}, false
+	}
+	suggestion := "lower -rps"
+	if result.Config != nil {
+		suggestion = fmt.Sprintf("lower -rps, now %g", result.Config.RPS)
+	}
+	return hint{
+		Finding:    fmt.Sprintf("the server rate limited the crawler %d times", result.ThrottleEvents),
+		Suggestion: suggestion,
+	}, true
+}
+
+// timeoutHint notices requests that ran out of time.
+func timeoutHint(result *crawler.CrawlResult) (hint, bool) {
+	n := countErrors(result, crawler.CategoryTimeout)
+	if n < minHintURLs {
+		return hint{}, false
+	}
+	suggestion := "raise -timeout or lower -rps"
+	if result.Config != nil && result.Config.Timeout > 0 {
+		suggestion = fmt.Sprintf("raise -timeout, now %s, or lower -rps", result.Config.Timeout)
+	}
+	return hint{
+		Finding:    fmt.Sprintf("%d requests timed out", n),
+		Suggestion: suggestion,
+	}, true
+}
+
+// tooLargeHint notices pages that were not crawled for their size.
+func tooLargeHint(result *crawler.CrawlResult) (hint, bool) {
+	n := countErrors(result, crawler.CategoryTooLarge)
+	if n == 0 {
+		return hint{}, false
+	}
+	limit := ""
+	if result.Config != nil {
+		limit = fmt.Sprintf(" (%d bytes)", result.Config.MaxBodySize)
+	}
+	return hint{
+		Finding:    fmt.Sprintf("%d pages are larger than -max-body-size%s and were not crawled", n, limit),
+		Suggestion: "raise -max-body-size if they matter",
+	}, true
+}
+
+// slowBodyHint notices page bodies abandoned for arriving too slowly.
+func slowBodyHint(result *crawler.CrawlResult) (hint, bool) {
+	n := countErrors(result, crawler.CategorySlowBody)
+	for _, page := range result.Pages {
+		if page.SlowBodyAborted {
+			n++
+		}
+	}
+	if n == 0 {
+		return hint{}, false
+	}
+	return hint{
+		Finding:    fmt.Sprintf("%d page bodies arrived too slowly and were cut short", n),
+		Suggestion: "lower -body-progress-bytes or raise -body-progress-window if the server is just slow",
+	}, true
+}
+
+// malformedHint notices pages of which only the links were extracted.
+func malformedHint(result *crawler.CrawlResult) (hint, bool) {
+	n := 0
+	for _, page := range result.Pages {
+		if page.MalformedHTML {
+			n++
+		}
+	}
+	if n == 0 {
+		return hint{}, false
+	}
+	return hint{
+		Finding:    fmt.Sprintf("%d pages exceeded the HTML limits and only their links were extracted", n),
+		Suggestion: "raise -html-max-tags or -html-max-nesting if they are ordinary pages",
+	}, true
+}
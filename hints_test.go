@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"webcrawler/crawler"
+)
+
+// categoryErrors returns n errors of category, for URLs ending in ext.
+func categoryErrors(category string, n int, ext string) []crawler.CrawlError {
+	var errs []crawler.CrawlError
+	for i := range n {
+		errs = append(errs, crawler.CrawlError{URL: fmt.Sprintf("https://example.com/f%d%s", i, ext), Category: category})
+	}
+	return errs
+}
+
+// trackedPages returns n pages and, for each, a copy with tracking
+// parameters.
+func trackedPages(n int) []crawler.PageData {
+	var pages []crawler.PageData
+	for i := range n {
+		u := fmt.Sprintf("https://example.com/p%d", i)
+		pages = append(pages, crawler.PageData{URL: u}, crawler.PageData{URL: u + "?utm_source=mail&GCLID=1"})
+	}
+	return pages
+}
+
+// onlyTracked returns the pages of pages with tracking parameters.
+func onlyTracked(pages []crawler.PageData) []crawler.PageData {
+	var tracked []crawler.PageData
+	for _, page := range pages {
+		if strings.Contains(page.URL, "utm_") {
+			tracked = append(tracked, page)
+		}
+	}
+	return tracked
+}
+
+// aliasTracked marks the pages of pages with tracking parameters as
+// redirect aliases.
+func aliasTracked(pages []crawler.PageData) []crawler.PageData {
+	for i := range pages {
+		pages[i].Alias = strings.Contains(pages[i].URL, "utm_")
+	}
+	return pages
+}
+
+// depthPages returns a page at depth 1 linking to n pages not crawled.
+func depthPages(n int) []crawler.PageData {
+	page := crawler.PageData{URL: "https://example.com/a", Depth: 1}
+	for i := range n {
+		page.Links = append(page.Links, fmt.Sprintf("https://example.com/a/%d", i))
+	}
+	return []crawler.PageData{{URL: "https://example.com/"}, page}
+}
+
+func TestHintRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   hintRule
+		result crawler.CrawlResult
+		// finding and suggestion are parts of the hint, empty for none.
+		finding, suggestion string
+	}{
+		{
+			"seed redirected to another host", seedRedirectHint,
+			crawler.CrawlResult{BaseURL: "https://example.com", Pages: []crawler.PageData{{URL: "https://example.com/", FinalURL: "https://www.example.com/"}}},
+			"the seed redirected to www.example.com", "-url https://www.example.com/",
+		},
+		{
+			"seed redirected on its host", seedRedirectHint,
+			crawler.CrawlResult{BaseURL: "https://example.com", Pages: []crawler.PageData{{URL: "https://example.com/", FinalURL: "https://EXAMPLE.com/home"}}},
+			"", "",
+		},
+		{
+			"another page redirected", seedRedirectHint,
+			crawler.CrawlResult{BaseURL: "https://example.com", Pages: []crawler.PageData{{URL: "https://example.com/a", FinalURL: "https://other.example/"}}},
+			"", "",
+		},
+		{
+			"circuit gave up on hosts", circuitHint,
+			crawler.CrawlResult{Circuit: &crawler.CircuitStats{GaveUp: true, GaveUpHosts: []string{"a.example", "b.example"}, Skipped: 12}},
+			"a.example, b.example kept failing and the crawl gave up on it, skipping 12 URLs", "-resume",
+		},
+		{
+			"circuit gave up", circuitHint,
+			crawler.CrawlResult{Circuit: &crawler.CircuitStats{GaveUp: true, Skipped: 3}},
+			"the site kept failing", "lower -rps",
+		},
+		{"circuit recovered", circuitHint, crawler.CrawlResult{Circuit: &crawler.CircuitStats{Opened: 2, Closed: 2}}, "", ""},
+		{
+			"visited cap", visitedCapHint,
+			crawler.CrawlResult{StopReason: crawler.StopVisitedCap + " (10 entries) reached", Visited: &crawler.VisitedStats{Entries: 10, ApproxBytes: 2048, Max: 10}},
+			"reached its cap, holding 10 entries, ~2.0 KiB (100% of the cap)", "-shard",
+		},
+		{"visited cap without stats", visitedCapHint, crawler.CrawlResult{StopReason: crawler.StopVisitedCap}, "the visited set reached its cap, and", "-max-visited"},
+		{"no visited cap", visitedCapHint, crawler.CrawlResult{StopReason: "max pages (5) reached"}, "", ""},
+		{"max pages", budgetHint, crawler.CrawlResult{StopReason: "max pages (5) reached", Coverage: 0.25}, "stopped early (max pages (5) reached) after fetching 25%", "raise -max-pages"},
+		{"max duration", budgetHint, crawler.CrawlResult{StopReason: "max duration (1m0s) reached"}, "max duration", "raise -max-duration"},
+		{"max bytes", budgetHint, crawler.CrawlResult{StopReason: "max bytes (100) reached"}, "max bytes", "raise -max-bytes"},
+		{"another budget", budgetHint, crawler.CrawlResult{StopReason: "deadline"}, "deadline", "raise the budget"},
+		{"budget not reached", budgetHint, crawler.CrawlResult{}, "", ""},
+		{"cancelled", budgetHint, crawler.CrawlResult{StopReason: crawler.StopCancelled}, "", ""},
+		{"circuit stop", budgetHint, crawler.CrawlResult{StopReason: crawler.StopCircuitOpen + " on example.com"}, "", ""},
+		{"visited cap stop", budgetHint, crawler.CrawlResult{StopReason: crawler.StopVisitedCap + " (10 entries) reached"}, "", ""},
+		{"links beyond the depth limit", depthLimitHint, crawler.CrawlResult{MaxDepth: 1, Pages: depthPages(5)}, "5 URLs linked from pages at the depth limit (1)", "raise -depth"},
+		{"few links beyond the depth limit", depthLimitHint, crawler.CrawlResult{MaxDepth: 1, Pages: depthPages(4)}, "", ""},
+		{"unlimited depth", depthLimitHint, crawler.CrawlResult{MaxDepth: crawler.UnlimitedDepth, Pages: depthPages(5)}, "", ""},
+		{"depth limit of a stopped crawl", depthLimitHint, crawler.CrawlResult{MaxDepth: 1, StopReason: "max pages (2) reached", Pages: depthPages(5)}, "", ""},
+		{"depth limit of a shard", depthLimitHint, crawler.CrawlResult{MaxDepth: 1, Shard: &crawler.ShardInfo{}, Pages: depthPages(5)}, "", ""},
+		{
+			"links beyond the depth limit excluded", depthLimitHint,
+			crawler.CrawlResult{MaxDepth: 1, Pages: depthPages(6), Config: &crawler.RunConfig{Exclude: []string{`/a/[0-1]$`}}},
+			"", "",
+		},
+		{
+			"links beyond the depth limit crawled or failed", depthLimitHint,
+			crawler.CrawlResult{MaxDepth: 1, Pages: append(depthPages(5), crawler.PageData{URL: "https://example.com/a/0"}), Errors: []crawler.CrawlError{{URL: "https://example.com/a/1"}}},
+			"", "",
+		},
+		{"tracking parameters", trackingParamsHint, crawler.CrawlResult{Pages: trackedPages(5)}, "5 URLs differ", "-exclude '" + trackingExclude + "'"},
+		{"few tracking parameters", trackingParamsHint, crawler.CrawlResult{Pages: trackedPages(4)}, "", ""},
+		{
+			"tracking parameters on unique pages", trackingParamsHint,
+			crawler.CrawlResult{Pages: onlyTracked(trackedPages(5))}, "", "",
+		},
+		{"tracking parameters on aliases", trackingParamsHint, crawler.CrawlResult{Pages: aliasTracked(trackedPages(5))}, "", ""},
+		{
+			"non-HTML files", nonHTMLHint,
+			crawler.CrawlResult{FetchedURLs: 20, Errors: append(categoryErrors(crawler.CategoryNonHTML, 3, ".PDF"), categoryErrors(crawler.CategoryNonHTML, 2, ".zip?v=1")...)},
+			"25% of the requests (5)", `-exclude '\.(pdf|zip)($|\?)'`,
+		},
+		{"few non-HTML files", nonHTMLHint, crawler.CrawlResult{FetchedURLs: 26, Errors: categoryErrors(crawler.CategoryNonHTML, 5, ".pdf")}, "", ""},
+		{"non-HTML files without extensions", nonHTMLHint, crawler.CrawlResult{FetchedURLs: 5, Errors: categoryErrors(crawler.CategoryNonHTML, 5, "")}, "100%", "with -exclude"},
+		{"throttled", throttleHint, crawler.CrawlResult{ThrottleEvents: 3, Config: &crawler.RunConfig{RPS: 2.5}}, "rate limited the crawler 3 times", "lower -rps, now 2.5"},
+		{"throttled without config", throttleHint, crawler.CrawlResult{ThrottleEvents: 1}, "1 times", "lower -rps"},
+		{"not throttled", throttleHint, crawler.CrawlResult{}, "", ""},
+		{"timeouts", timeoutHint, crawler.CrawlResult{Errors: categoryErrors(crawler.CategoryTimeout, 5, ""), Config: &crawler.RunConfig{Timeout: 10 * time.Second}}, "5 requests timed out", "raise -timeout, now 10s"},
+		{"few timeouts", timeoutHint, crawler.CrawlResult{Errors: categoryErrors(crawler.CategoryTimeout, 4, "")}, "", ""},
+		{"too large", tooLargeHint, crawler.CrawlResult{Errors: categoryErrors(crawler.CategoryTooLarge, 1, ""), Config: &crawler.RunConfig{MaxBodySize: 1024}}, "1 pages are larger than -max-body-size (1024 bytes)", "raise -max-body-size"},
+		{"not too large", tooLargeHint, crawler.CrawlResult{Errors: categoryErrors(crawler.CategoryTimeout, 1, "")}, "", ""},
+		{
+			"slow bodies", slowBodyHint,
+			crawler.CrawlResult{Errors: categoryErrors(crawler.CategorySlowBody, 1, ""), Pages: []crawler.PageData{{SlowBodyAborted: true}, {}}},
+			"2 page bodies arrived too slowly", "-body-progress-bytes",
+		},
+		{"no slow bodies", slowBodyHint, crawler.CrawlResult{Pages: []crawler.PageData{{}}}, "", ""},
+		{"malformed", malformedHint, crawler.CrawlResult{Pages: []crawler.PageData{{MalformedHTML: true}, {MalformedHTML: true}, {}}}, "2 pages exceeded the HTML limits", "-html-max-tags"},
+		{"not malformed", malformedHint, crawler.CrawlResult{Pages: []crawler.PageData{{}}}, "", ""},
+	}
+	for _, tt := range tests {
+		h, ok := tt.rule(&tt.result)
+		switch {
+		case tt.finding == "" && ok:
+			t.Errorf("%s: hint %+v, want none", tt.name, h)
+		case tt.finding != "" && !ok:
+			t.Errorf("%s: no hint, want %q", tt.name, tt.finding)
+		case ok && (!strings.Contains(h.Finding, tt.finding) || !strings.Contains(h.Suggestion, tt.suggestion)):
+			t.Errorf("%s: hint %+v, want %q and %q", tt.name, h, tt.finding, tt.suggestion)
+		}
+	}
+}
+
+func TestFindHints(t *testing.T) {
+	result := &crawler.CrawlResult{
+		BaseURL:        "https://example.com",
+		StopReason:     "max pages (5) reached",
+		ThrottleEvents: 2,
+		Pages:          []crawler.PageData{{URL: "https://example.com/", MalformedHTML: true}},
+	}
+	var findings []string
+	for _, h := range findHints(result) {
+		findings = append(findings, h.Finding)
+	}
+	if len(findings) != 3 || !strings.HasPrefix(findings[0], "the crawl stopped early") ||
+		!strings.HasPrefix(findings[1], "the server rate limited") || !strings.HasPrefix(findings[2], "1 pages exceeded") {
+		t.Errorf("findings %q, want the budget, throttling and malformed pages in rule order", findings)
+	}
+	if hints := findHints(&crawler.CrawlResult{BaseURL: "https://example.com", MaxDepth: 2}); hints != nil {
+		t.Errorf("hints %+v of an uneventful crawl", hints)
+	}
+}
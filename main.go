@@ -1,232 +1,185 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"net/http"
-	"net/url"
 	"os"
 	"strings"
-	"sync"
-	"time"
 
-	"github.com/PuerkitoBio/goquery"
+	"webcrawler/crawler"
 )
 
-type PageData struct {
-	URL          string    `json:"url"`
-	Title        string    `json:"title"`
-	Links        []string  `json:"links"`
-	Depth        int       `json:"depth"`
-	CrawledAt    time.Time `json:"crawled_at"`
-	ResponseTime int64     `json:"response_time_ms"`
-	StatusCode   int       `json:"status_code"`
-}
-
-type CrawlResult struct {
-	BaseURL     string     `json:"base_url"`
-	MaxDepth    int        `json:"max_depth"`
-	StartTime   time.Time  `json:"start_time"`
-	EndTime     time.Time  `json:"end_time"`
-	TotalPages  int        `json:"total_pages"`
-	Pages       []PageData `json:"pages"`
-}
-
-type Crawler struct {
-	visited      map[string]bool
-	visitedLock  sync.RWMutex
-	baseURL      *url.URL
-	maxDepth     int
-	rateLimiter  <-chan time.Time
-	result       CrawlResult
-	resultLock   sync.Mutex
-}
-
-func NewCrawler(baseURL string, maxDepth int, requestsPerSecond float64) (*Crawler, error) {
-	parsedURL, err := url.Parse(baseURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid base URL: %v", err)
-	}
-
-	return &Crawler{
-		visited:     make(map[string]bool),
-		baseURL:    parsedURL,
-		maxDepth:   maxDepth,
-		rateLimiter: time.Tick(time.Duration(1000/requestsPerSecond) * time.Millisecond),
-		result: CrawlResult{
-			BaseURL:   baseURL,
-			MaxDepth:  maxDepth,
-			StartTime: time.Now(),
-			Pages:     make([]PageData, 0),
-		},
-	}, nil
-}
-
-func (c *Crawler) isVisited(url string) bool {
-	c.visitedLock.RLock()
-	defer c.visitedLock.RUnlock()
-	return c.visited[url]
-}
-
-func (c *Crawler) markVisited(url string) {
-	c.visitedLock.Lock()
-	defer c.visitedLock.Unlock()
-	c.visited[url] = true
-}
-
-func (c *Crawler) isSameDomain(pageURL *url.URL) bool {
-	return pageURL.Host == c.baseURL.Host
-}
-
-func (c *Crawler) addPageData(data PageData) {
-	c.resultLock.Lock()
-	defer c.resultLock.Unlock()
-	c.result.Pages = append(c.result.Pages, data)
-}
-
-func (c *Crawler) crawl(pageURL string, depth int, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	if depth > c.maxDepth {
-		return
-	}
-
-	if c.isVisited(pageURL) {
-		return
-	}
-
-	<-c.rateLimiter // Rate limiting
-
-	c.markVisited(pageURL)
-	fmt.Printf("Crawling: %s (depth: %d)\n", pageURL, depth)
-
-	parsedURL, err := url.Parse(pageURL)
-	if err != nil {
-		fmt.Printf("Error parsing URL %s: %v\n", pageURL, err)
-		return
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "report":
+			if err := runReport(os.Args[2:]); err != nil {
+				fmt.Printf("Error generating report: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "results":
+			if err := runResults(os.Args[2:]); err != nil {
+				fmt.Printf("Error querying results: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "fingerprint":
+			changed, err := runFingerprint(os.Args[2:])
+			if err != nil {
+				fmt.Printf("Error computing the fingerprint: %v\n", err)
+				os.Exit(1)
+			}
+			if changed {
+				os.Exit(2)
+			}
+			return
+		case "merge":
+			if err := runMerge(os.Args[2:]); err != nil {
+				fmt.Printf("Error merging shards: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "verify":
+			failed, err := runVerify(os.Args[2:])
+			if err != nil {
+				fmt.Printf("Error verifying URLs: %v\n", err)
+				os.Exit(1)
+			}
+			if failed > 0 {
+				os.Exit(2)
+			}
+			return
+		case "validate":
+			if !runValidate(os.Args[2:]) {
+				os.Exit(1)
+			}
+			return
+		}
 	}
 
-	startTime := time.Now()
-	resp, err := http.Get(pageURL)
+	cfg, err := parseConfig(flag.CommandLine, os.Args[1:])
 	if err != nil {
-		fmt.Printf("Error fetching %s: %v\n", pageURL, err)
-		return
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-	defer resp.Body.Close()
 
-	responseTime := time.Since(startTime).Milliseconds()
-
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("Error: status code %d for %s\n", resp.StatusCode, pageURL)
-		return
+	if cfg.URL == "" {
+		fmt.Println("Starting crawler... \n Enter the base URL: ")
+		fmt.Scanln(&cfg.URL)
 	}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	opts, err := cfg.crawlOptions()
 	if err != nil {
-		fmt.Printf("Error parsing page %s: %v\n", pageURL, err)
-		return
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-
-	// Collect links
-	links := make([]string, 0)
-	doc.Find("a").Each(func(_ int, link *goquery.Selection) {
-		href, exists := link.Attr("href")
-		if !exists {
-			return
+	if cfg.Resume != "" {
+		previous, err := crawler.LoadResults(cfg.Resume)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
-
-		href = strings.TrimSpace(href)
-		if href == "" || strings.HasPrefix(href, "#") {
-			return
+		opts = append(opts, crawler.WithResume(previous, cfg.Force))
+	}
+	if cfg.OnlyListed != "" {
+		urls, err := crawler.LoadURLList(cfg.OnlyListed)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
-
-		absoluteURL, err := parsedURL.Parse(href)
+		opts = append(opts, crawler.WithOnlyListed(urls))
+	}
+	var thirdPartyBaseline *crawler.ThirdPartyBaseline
+	if cfg.FailOnNewThirdParty != "" {
+		thirdPartyBaseline, err = crawler.LoadThirdPartyBaseline(cfg.FailOnNewThirdParty)
 		if err != nil {
-			return
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
-
-		if !c.isSameDomain(absoluteURL) {
-			return
+	}
+	var previousFingerprint *crawler.Fingerprint
+	if cfg.CompareFingerprint != "" {
+		previousFingerprint, err = crawler.LoadFingerprint(cfg.CompareFingerprint)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
-
-		nextURL := absoluteURL.String()
-		links = append(links, nextURL)
-
-		if !c.isVisited(nextURL) {
-			wg.Add(1)
-			go c.crawl(nextURL, depth+1, wg)
+	}
+	shutdownTracing := func() {}
+	defer func() { shutdownTracing() }()
+	if cfg.OTelEndpoint != "" {
+		tp, err := newTracerProvider(cfg.OTelEndpoint)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
-	})
-
-	// Create and store page data
-	pageData := PageData{
-		URL:          pageURL,
-		Title:        doc.Find("title").Text(),
-		Links:        links,
-		Depth:        depth,
-		CrawledAt:    time.Now(),
-		ResponseTime: responseTime,
-		StatusCode:   resp.StatusCode,
+		shutdownTracing = func() {
+			if err := tp.Shutdown(context.Background()); err != nil {
+				fmt.Printf("Error exporting traces: %v\n", err)
+			}
+		}
+		opts = append(opts, crawler.WithTracerProvider(tp), crawler.WithTraceSampling(cfg.OTelSample))
 	}
 
-	c.addPageData(pageData)
-}
-
-func (c *Crawler) saveResults(filename string) error {
-	c.result.EndTime = time.Now()
-	c.result.TotalPages = len(c.result.Pages)
-
-	file, err := os.Create(filename)
+	c, err := crawler.NewCrawler(cfg.URL, cfg.Depth, cfg.RPS, opts...)
 	if err != nil {
-		return fmt.Errorf("error creating file: %v", err)
+		fmt.Printf("Error creating crawler: %v\n", err)
+		os.Exit(1)
 	}
-	defer file.Close()
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(c.result); err != nil {
-		return fmt.Errorf("error encoding JSON: %v", err)
+	result, crawlErr := c.Start(context.Background())
+	var newThirdParties []crawler.ThirdParty
+	var fingerprintChanges []crawler.SectionChange
+	if result != nil {
+		if previousFingerprint != nil && result.Fingerprint != nil {
+			fingerprintChanges = crawler.CompareFingerprints(previousFingerprint, result.Fingerprint)
+			printFingerprintChanges(fingerprintChanges, cfg.CompareFingerprint)
+		}
+		if thirdPartyBaseline != nil {
+			newThirdParties = crawler.NewThirdParties(result.ThirdParties, thirdPartyBaseline)
+			printNewThirdParties(newThirdParties, cfg.FailOnNewThirdParty)
+		}
+		if cfg.SaveThirdPartyBaseline != "" {
+			if err := crawler.WriteThirdPartyBaseline(cfg.SaveThirdPartyBaseline, result.ThirdParties); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			} else {
+				fmt.Printf("Third-party baseline saved to %s\n", cfg.SaveThirdPartyBaseline)
+			}
+		}
 	}
-
-	return nil
-}
-
-func (c *Crawler) Start() error {
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go c.crawl(c.baseURL.String(), 0, &wg)
-	wg.Wait()
-
-	fmt.Printf("\nCrawling completed. Total pages visited: %d\n", len(c.visited))
-	
-	// Save results to JSON file
-	err := c.saveResults("crawl_results.json")
-	if err != nil {
-		return fmt.Errorf("error saving results: %v", err)
+	exitCode := 0
+	switch {
+	case crawlErr != nil:
+		fmt.Printf("Error during crawling: %v\n", crawlErr)
+		exitCode = 1
+	case c.Stats().BrokenAssets > 0:
+		exitCode = 2
+	case cfg.FailOnValidations && c.Stats().FailedValidations > 0:
+		exitCode = 2
+	case len(newThirdParties) > 0:
+		exitCode = 2
+	case len(fingerprintChanges) > 0:
+		exitCode = 2
+	case result != nil && len(result.InvariantViolations) > 0:
+		exitCode = 2
+	case result != nil && strings.HasPrefix(result.StopReason, crawler.StopVisitedCap):
+		// The results are cut short to protect memory, unlike those of a
+		// budget the user chose to spend.
+		exitCode = 3
 	}
-
-	fmt.Println("Results saved to crawl_results.json")
-	return nil
-}
-
-func main() {
-
-	fmt.Println("Starting crawler... \n Enter the base URL: ")
-	
-	var baseURL string
-	fmt.Scanln(&baseURL)
-	
-	maxDepth := 3
-	requestsPerSecond := 2.0
-
-	crawler, err := NewCrawler(baseURL, maxDepth, requestsPerSecond)
-	if err != nil {
-		fmt.Printf("Error creating crawler: %v\n", err)
-		return
+	if result != nil && !cfg.NoHints {
+		printHints(result)
+	}
+	// The manifest comes last, so it is the last line with -print-manifest.
+	if err := writeManifest(cfg, c, result, crawlErr, exitCode); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exitCode = 1
 	}
 
-	if err := crawler.Start(); err != nil {
-		fmt.Printf("Error during crawling: %v\n", err)
-		return
+	if exitCode != 0 {
+		shutdownTracing()
+		os.Exit(exitCode)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"webcrawler/crawler"
+)
+
+// manifestName is the file name of the manifest written next to the
+// results file.
+const manifestName = "manifest.json"
+
+// manifestPath returns where the manifest of a crawl that wrote artifacts
+// goes: cfg.Manifest, or manifest.json in the directory of the results
+// file, or in the working directory when there is none. The results files
+// of a crawl split by host share one manifest, in the deepest directory
+// holding them all.
+func manifestPath(cfg *Config, artifacts []crawler.Artifact) string {
+	if cfg.Manifest != "" {
+		return cfg.Manifest
+	}
+	var dir []string
+	found := false
+	for _, artifact := range artifacts {
+		if artifact.Kind != crawler.ArtifactResults {
+			continue
+		}
+		parts := strings.Split(filepath.Dir(filepath.Clean(artifact.Path)), string(filepath.Separator))
+		if !found {
+			dir, found = parts, true
+			continue
+		}
+		n := 0
+		for n < len(dir) && n < len(parts) && dir[n] == parts[n] {
+			n++
+		}
+		dir = dir[:n]
+	}
+	if !found {
+		return manifestName
+	}
+	path := filepath.Join(append(dir, manifestName)...)
+	if len(dir) > 0 && dir[0] == "" {
+		// An absolute path, which Join made relative.
+		path = string(filepath.Separator) + path
+	}
+	return path
+}
+
+// writeManifest writes the manifest of the crawl c ran, once every output
+// is closed, and prints where it went. result is nil when the crawl failed
+// with crawlErr; exitCode is the status the process exits with.
+func writeManifest(cfg *Config, c *crawler.Crawler, result *crawler.CrawlResult, crawlErr error, exitCode int) error {
+	if cfg.NoManifest {
+		return nil
+	}
+	artifacts := c.Artifacts()
+	path := manifestPath(cfg, artifacts)
+	if err := crawler.WriteManifest(path, crawler.NewManifest(result, artifacts, crawlErr, exitCode)); err != nil {
+		return err
+	}
+	if cfg.PrintManifest {
+		fmt.Println(path)
+	} else {
+		fmt.Printf("Manifest saved to %s\n", path)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"webcrawler/crawler"
+)
+
+func TestManifestPath(t *testing.T) {
+	results := func(paths ...string) []crawler.Artifact {
+		var artifacts []crawler.Artifact
+		for _, path := range paths {
+			artifacts = append(artifacts, crawler.Artifact{Kind: crawler.ArtifactResults, Path: filepath.FromSlash(path)})
+		}
+		return artifacts
+	}
+	edges := crawler.Artifact{Kind: crawler.ArtifactEdges, Path: filepath.FromSlash("/elsewhere/edges.csv")}
+
+	tests := []struct {
+		name      string
+		manifest  string
+		artifacts []crawler.Artifact
+		want      string
+	}{
+		{"configured", "ci/run.json", results("out/results.json"), "ci/run.json"},
+		{"no results", "", nil, "manifest.json"},
+		{"only other artifacts", "", []crawler.Artifact{edges}, "manifest.json"},
+		{"working directory", "", results("crawl_results.json"), "manifest.json"},
+		{"results directory", "", append(results("out/run/results.json"), edges), "out/run/manifest.json"},
+		{"unclean path", "", results("./out//run/../run/results.json"), "out/run/manifest.json"},
+		{"split by host", "", results("out/hosts/blog.json", "out/hosts/docs.json", "out/results.json"), "out/manifest.json"},
+		{"common prefix is not a directory", "", results("out/ab/results.json", "out/ac/results.json"), "out/manifest.json"},
+		{"nothing in common", "", results("a/results.json", "b/results.json"), "manifest.json"},
+		{"absolute", "", results("/data/crawl/results.json"), "/data/crawl/manifest.json"},
+		{"absolute split by host", "", results("/data/crawl/hosts/blog.json", "/data/crawl/hosts/docs.json"), "/data/crawl/hosts/manifest.json"},
+		{"absolute without common directory", "", results("/a/results.json", "/b/results.json"), "/manifest.json"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Manifest: tt.manifest}
+		if got := manifestPath(cfg, tt.artifacts); got != filepath.FromSlash(tt.want) {
+			t.Errorf("%s: %q, want %q", tt.name, got, filepath.FromSlash(tt.want))
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"webcrawler/crawler"
+)
+
+// runMerge implements the "merge" subcommand, which combines the result
+// files of the shards of a crawl into one.
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	output := fs.String("output", "merged_results.json", "file the merged results are written to")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: webcrawler merge [-output file] shard-results.json...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no shard results given")
+	}
+
+	var shards []*crawler.CrawlResult
+	for _, path := range fs.Args() {
+		result, err := crawler.LoadResults(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		shards = append(shards, result)
+	}
+	merged, err := crawler.MergeShards(shards)
+	if err != nil {
+		return err
+	}
+	if err := crawler.SaveResults(*output, merged); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %d shards: URLs discovered: %d, fetched: %d, pages stored: %d (coverage %.1f%%)\n",
+		len(shards), merged.DiscoveredURLs, merged.FetchedURLs, merged.TotalPages, merged.Coverage*100)
+	fmt.Printf("Results saved to %s\n", *output)
+	return nil
+}
@@ -0,0 +1,920 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"webcrawler/crawler"
+)
+
+const defaultUXMinPlaceholders = 5
+
+// runReport implements the "report" subcommand, which derives reports from a
+// saved crawl result without crawling again.
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	input := fs.String("input", "crawl_results.json", "crawl results file to read")
+	redirectedLinks := fs.String("redirected-links", "", "write internal links that point at redirects to this CSV file")
+	mobileReport := fs.Bool("mobile-report", false, "summarize pages that are not mobile-ready")
+	var sections []string
+	fs.Var(stringList{&sections}, "report", "extra report section to print: ux, mobile, links, duplicates, toc, cookies, sections, quality, feeds, chains, perf, dates, bad-links, legacy or ua (repeatable)")
+	uxMin := fs.Int("ux-min", defaultUXMinPlaceholders, "placeholder anchors a page needs to appear in the ux report")
+	top := fs.Int("top", 10, "pages listed in the links, chains, perf, legacy and ua reports")
+	dupMinCases := fs.Int("dup-min-cases", crawler.DefaultDuplicateMinCases, "URL groups a parameter or path segment needs to appear in the duplicates report")
+	sectionDepth := fs.Int("section-depth", crawler.DefaultSectionDepth, "path segments naming a section in the sections report")
+	sectionMinPages := fs.Int("section-min-pages", crawler.DefaultSectionMinPages, "pages a section needs in the sections report; smaller ones are folded into \"other\"")
+	badLinkShare := fs.Float64("bad-link-share", crawler.DefaultBadLinkShare, "share of a page's resolved internal links that must be broken or redirected for the bad-links report")
+	badLinkMinLinks := fs.Int("bad-link-min-links", crawler.DefaultBadLinkMinLinks, "resolved internal links a page needs to appear in the bad-links report")
+	sectionBy := fs.String("section-by", "path", "group the sections report by \"path\" or by page \"type\"")
+	sectionsJSON := fs.String("sections-json", "", "write the sections report to this JSON file")
+	qualityBottom := fs.Int("quality-bottom", 10, "lowest scoring pages listed in the quality report")
+	thirdPartyBaseline := fs.String("third-party-baseline", "", "list the third-party origins not in this baseline file")
+	dateThreshold := fs.Duration("date-threshold", crawler.DefaultDateThreshold, "how far a page's own date may be from its Last-Modified header in the dates report")
+	fs.Parse(args)
+
+	var uxReport, linksReport, duplicatesReport, tocReport, cookiesReport, sectionsReport, qualityReport, feedsReport, chainsReport, perfReport, datesReport, badLinksReport, legacyReport, uaReport bool
+	for _, section := range sections {
+		for _, name := range strings.Split(section, ",") {
+			switch strings.TrimSpace(name) {
+			case "ux":
+				uxReport = true
+			case "mobile":
+				*mobileReport = true
+			case "links":
+				linksReport = true
+			case "duplicates":
+				duplicatesReport = true
+			case "toc":
+				tocReport = true
+			case "cookies":
+				cookiesReport = true
+			case "sections":
+				sectionsReport = true
+			case "quality":
+				qualityReport = true
+			case "feeds":
+				feedsReport = true
+			case "chains":
+				chainsReport = true
+			case "perf":
+				perfReport = true
+			case "dates":
+				datesReport = true
+			case "bad-links":
+				badLinksReport = true
+			case "legacy":
+				legacyReport = true
+			case "ua":
+				uaReport = true
+			default:
+				return fmt.Errorf("unknown report section %q", name)
+			}
+		}
+	}
+
+	result, err := crawler.LoadResults(*input)
+	if err != nil {
+		return err
+	}
+	base, err := url.Parse(result.BaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base URL in results: %v", err)
+	}
+
+	groups := crawler.FindRedirectedLinks(result.Pages, base.Host)
+	links := 0
+	for _, group := range groups {
+		links += group.LinkCount
+	}
+	fmt.Printf("Redirected internal links: %d links to %d redirecting URLs\n", links, len(groups))
+	for i, group := range groups {
+		if i == 10 {
+			fmt.Printf("  ... and %d more\n", len(groups)-i)
+			break
+		}
+		fmt.Printf("  %5d  %s -> %s\n", group.LinkCount, group.TargetURL, group.FinalURL)
+	}
+
+	if check := result.AssetCheck; check != nil {
+		fmt.Printf("\nBroken assets: %d of %d checked (%d unique)\n", len(check.Broken), check.Checked, check.UniqueAssets)
+		for i, asset := range check.Broken {
+			if i == 10 {
+				fmt.Printf("  ... and %d more\n", len(check.Broken)-i)
+				break
+			}
+			fmt.Printf("  %-10s %s (%s), used on %d pages\n", asset.Type, asset.URL, asset.Error, len(asset.Pages))
+		}
+	}
+
+	if changes := result.ModifiedSince; changes != nil {
+		printModifiedSinceReport(changes)
+	}
+	if len(result.Misconfigurations) > 0 {
+		printMisconfigurationReport(result.Misconfigurations)
+	}
+	if len(result.DangerousURLs) > 0 {
+		printDangerousReport(result.DangerousURLs)
+	}
+	if len(result.PrunedPatterns) > 0 {
+		printPrunedReport(result.PrunedPatterns)
+	}
+	if result.SiteHygiene != nil {
+		printSiteHygieneReport(result.SiteHygiene)
+	}
+	if len(result.Robots) > 0 {
+		printRobotsReport(result)
+	}
+	if len(result.Validations) > 0 {
+		printValidationReport(result.Validations)
+	}
+	if len(result.ThirdParties) > 0 {
+		printThirdPartyReport(result.ThirdParties)
+	}
+	if *thirdPartyBaseline != "" {
+		baseline, err := crawler.LoadThirdPartyBaseline(*thirdPartyBaseline)
+		if err != nil {
+			return err
+		}
+		printNewThirdParties(crawler.NewThirdParties(result.ThirdParties, baseline), *thirdPartyBaseline)
+	}
+
+	if *mobileReport {
+		printMobileReport(result.Pages)
+	}
+	if uxReport {
+		printUXReport(result.Pages, *uxMin)
+	}
+	if linksReport {
+		printLinkScoreReport(result.Pages, *top)
+	}
+	if duplicatesReport {
+		printDuplicatePatternReport(result.Pages, *dupMinCases)
+	}
+	if tocReport {
+		printAnchorReport(result.Pages)
+	}
+	if cookiesReport {
+		printCookieReport(result.Pages)
+	}
+	if sectionsReport || *sectionsJSON != "" {
+		var found []crawler.PathSection
+		switch *sectionBy {
+		case "path":
+			if *sectionDepth < 1 {
+				return fmt.Errorf("-section-depth must be at least 1")
+			}
+			found = crawler.FindPathSections(result.Pages, result.Errors, *sectionDepth, *sectionMinPages)
+		case "type":
+			found = crawler.FindTypeSections(result.Pages, *sectionMinPages)
+		default:
+			return fmt.Errorf("-section-by must be path or type, not %q", *sectionBy)
+		}
+		if sectionsReport {
+			printSectionReport(found)
+		}
+		if *sectionsJSON != "" {
+			if err := writeSectionsJSON(*sectionsJSON, found); err != nil {
+				return err
+			}
+			fmt.Printf("Sections saved to %s\n", *sectionsJSON)
+		}
+	}
+
+	if qualityReport {
+		weights := crawler.DefaultQualityWeights
+		if result.Config != nil && result.Config.QualityWeights != (crawler.QualityWeights{}) {
+			weights = result.Config.QualityWeights
+		}
+		printQualityReport(crawler.SummarizeQuality(result.Pages, weights, *qualityBottom))
+	}
+
+	if feedsReport {
+		printFeedReport(result)
+	}
+
+	if chainsReport {
+		printRedirectChainReport(result, *top)
+	}
+	if perfReport {
+		printPerfReport(result.Pages, *top)
+	}
+	if datesReport {
+		printDateReport(result.Pages, *top, *dateThreshold)
+	}
+	if legacyReport {
+		printLegacyMarkupReport(crawler.SummarizeLegacyMarkup(result.Pages, *top))
+	}
+	if uaReport {
+		printUAComparisonReport(result.UAComparison, *top)
+	}
+	if badLinksReport {
+		if *sectionDepth < 1 {
+			return fmt.Errorf("-section-depth must be at least 1")
+		}
+		printBadLinkReport(crawler.FindBadLinkPages(result, *badLinkShare, *badLinkMinLinks, *sectionDepth), *top, *badLinkShare, *badLinkMinLinks)
+	}
+
+	if *redirectedLinks != "" {
+		if err := writeRedirectedLinksCSV(*redirectedLinks, groups); err != nil {
+			return err
+		}
+		fmt.Printf("Redirected links saved to %s\n", *redirectedLinks)
+	}
+	return nil
+}
+
+func writeRedirectedLinksCSV(filename string, groups []crawler.RedirectedLinkGroup) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"target_url", "final_url", "status_code", "links_to_target", "source_page"})
+	for _, group := range groups {
+		for _, source := range group.SourcePages {
+			w.Write([]string{
+				group.TargetURL,
+				group.FinalURL,
+				strconv.Itoa(group.StatusCode),
+				strconv.Itoa(group.LinkCount),
+				source,
+			})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing CSV: %v", err)
+	}
+	return nil
+}
+
+// printMobileReport summarizes the mobile-readiness checks of a crawl.
+func printMobileReport(pages []crawler.PageData) {
+	issues := crawler.FindMobileIssues(pages)
+	fmt.Printf("\nMobile readiness: %d pages checked, %d with an AMP alternate\n", issues.Checked, issues.AMP)
+	for _, check := range []struct {
+		label string
+		urls  []string
+	}{
+		{"missing viewport meta tag", issues.MissingViewport},
+		{"fixed-width viewport", issues.FixedWidth},
+		{"user-scalable=no", issues.UserScalableNo},
+	} {
+		fmt.Printf("  %s: %d\n", check.label, len(check.urls))
+		for i, pageURL := range check.urls {
+			if i == 10 {
+				fmt.Printf("    ... and %d more\n", len(check.urls)-i)
+				break
+			}
+			fmt.Printf("    %s\n", pageURL)
+		}
+	}
+}
+
+// printUXReport lists the pages with placeholder anchors.
+func printUXReport(pages []crawler.PageData, min int) {
+	issues := crawler.FindUXIssues(pages, min)
+	fmt.Printf("\nPlaceholder anchors: %d pages with %d or more\n", len(issues), min)
+	for i, issue := range issues {
+		if i == 10 {
+			fmt.Printf("  ... and %d more\n", len(issues)-i)
+			break
+		}
+		a := issue.Anchors
+		fmt.Printf("  %5d  %s (empty %d, # %d, javascript %d, missing fragment %d)\n",
+			a.Placeholders(), issue.URL, a.Empty, a.Placeholder, a.JavaScript, a.MissingFragment)
+	}
+}
+
+// printLinkScoreReport lists the pages with the highest link scores.
+func printLinkScoreReport(pages []crawler.PageData, n int) {
+	top := crawler.TopLinkScores(pages, n)
+	fmt.Printf("\nTop pages by link score:\n")
+	for _, page := range top {
+		fmt.Printf("  %8.3f  %s\n", page.LinkScore, page.URL)
+	}
+}
+
+// printPrunedReport lists the URL patterns adaptive pruning stopped
+// expanding, with the yield that decided it.
+func printPrunedReport(pruned []crawler.PrunedPattern) {
+	fmt.Printf("\nPruned URL patterns: %d\n", len(pruned))
+	for _, p := range pruned {
+		fmt.Printf("  %s\n", p.Pattern)
+		fmt.Printf("      %d pages crawled, %d of the last %d productive (minimum %.0f%%), %d URLs skipped, e.g. %s\n",
+			p.Pages, p.Productive, p.Window, p.MinYield*100, p.Skipped, p.Example)
+	}
+}
+
+// printRobotsReport lists the robots.txt files the crawl applied and the
+// rules that disallowed the most URLs.
+func printRobotsReport(result *crawler.CrawlResult) {
+	fmt.Printf("\nRobots.txt files applied: %d\n", len(result.Robots))
+	for _, file := range result.Robots {
+		switch {
+		case file.Error != "":
+			fmt.Printf("  %s: %s, every URL disallowed\n", file.URL, file.Error)
+		case file.SHA256 == "":
+			fmt.Printf("  %s: HTTP %d, every URL allowed\n", file.URL, file.StatusCode)
+		default:
+			fmt.Printf("  %s: sha256 %s, fetched %s\n", file.URL, file.SHA256, file.FetchedAt.Format(time.RFC3339))
+		}
+	}
+	counts := crawler.CountRobotsRules(result.Errors)
+	if len(counts) == 0 {
+		return
+	}
+	fmt.Println("  Disallowed URLs by rule:")
+	for i, count := range counts {
+		if i == 10 {
+			fmt.Printf("  ... and %d more\n", len(counts)-i)
+			break
+		}
+		fmt.Printf("  %5d  %s in %s\n", count.URLs, count.Rule, count.File)
+	}
+}
+
+// printValidationReport prints the checked and failed pages of every
+// validation rule, with the first failing pages.
+func printValidationReport(validations []crawler.ValidationSummary) {
+	fmt.Printf("\nValidations: %d rules\n", len(validations))
+	for _, v := range validations {
+		fmt.Printf("  %s (%s %s): %d of %d pages failed\n", v.Name, v.Selector, v.Condition, v.Failed, v.Checked)
+		for _, example := range v.Examples {
+			fmt.Printf("      %s\n", example)
+		}
+		if more := v.Failed - len(v.Examples); more > 0 {
+			fmt.Printf("      ... and %d more\n", more)
+		}
+	}
+}
+
+// printThirdPartyReport lists the third-party domains the pages reference,
+// with their origins and the first pages referencing them.
+func printThirdPartyReport(parties []crawler.ThirdParty) {
+	fmt.Printf("\nThird parties: %d domains\n", len(parties))
+	for i, party := range parties {
+		if i == 20 {
+			fmt.Printf("  ... and %d more\n", len(parties)-i)
+			break
+		}
+		fmt.Printf("  %5d pages  %s\n", party.Pages, party.Domain)
+		for _, origin := range party.Origins {
+			fmt.Printf("      %s (%s), %d pages\n", origin.Origin, strings.Join(origin.Kinds, ", "), origin.Pages)
+		}
+		fmt.Printf("      e.g. %s\n", party.Examples[0])
+	}
+}
+
+// printNewThirdParties lists the third-party origins not in the baseline
+// file path.
+func printNewThirdParties(parties []crawler.ThirdParty, path string) {
+	origins := 0
+	for _, party := range parties {
+		origins += len(party.Origins)
+	}
+	fmt.Printf("\nThird-party origins not in %s: %d\n", path, origins)
+	for _, party := range parties {
+		for _, origin := range party.Origins {
+			fmt.Printf("  %s (%s), %d pages, e.g. %s\n", origin.Origin, strings.Join(origin.Kinds, ", "), origin.Pages, origin.Example)
+		}
+	}
+}
+
+// printBadLinkReport lists, per section, the pages whose internal links are
+// mostly broken or redirected, the n worst of each.
+func printBadLinkReport(sections []crawler.BadLinkSection, n int, share float64, minLinks int) {
+	pages := 0
+	for _, section := range sections {
+		pages += len(section.Pages)
+	}
+	fmt.Printf("\nPages with at least %.0f%% of %d or more internal links broken or redirected: %d in %d sections\n",
+		share*100, minLinks, pages, len(sections))
+	for _, section := range sections {
+		fmt.Printf("  %s: %d pages, %d broken and %d redirected links\n", section.Section, len(section.Pages), section.Broken, section.Redirected)
+		for i, page := range section.Pages {
+			if i == n {
+				fmt.Printf("      ... and %d more\n", len(section.Pages)-i)
+				break
+			}
+			fmt.Printf("      %3.0f%%  %s: %d broken, %d redirected of %d links, %d unknown\n",
+				page.BadShare*100, page.URL, page.Broken, page.Redirected, page.Links, page.Unknown)
+		}
+	}
+}
+
+// printRedirectChainReport lists the pages with the longest redirect
+// chains, HTTP redirects and meta refreshes alike, and the pages whose chain
+// looped or went over the limit.
+func printRedirectChainReport(result *crawler.CrawlResult, n int) {
+	chains := crawler.LongestRedirectChains(result.Pages, n)
+	fmt.Printf("\nLongest redirect chains:\n")
+	for _, page := range chains {
+		fmt.Printf("  %2d hops  %s\n", len(page.RedirectChain), page.URL)
+		for _, hop := range page.RedirectChain {
+			kind := hop.Type
+			if kind == "" {
+				kind = fmt.Sprintf("http-%d", hop.StatusCode)
+			}
+			fmt.Printf("      %-12s %s\n", kind, hop.URL)
+		}
+		fmt.Printf("      %-12s %s\n", "final", page.FinalURL)
+	}
+
+	var failed []crawler.CrawlError
+	for _, e := range result.Errors {
+		if e.Category == crawler.CategoryRedirectLoop || e.Category == crawler.CategoryRedirectLimit {
+			failed = append(failed, e)
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+	fmt.Printf("\nRedirect loops and chains over the limit: %d\n", len(failed))
+	for i, e := range failed {
+		if i == n {
+			fmt.Printf("  ... and %d more\n", len(failed)-i)
+			break
+		}
+		fmt.Printf("  %-14s %s: %s\n", e.Category, e.URL, e.Error)
+	}
+}
+
+// printPerfReport lists the pages with the heaviest heads and their
+// render-blocking resources.
+func printPerfReport(pages []crawler.PageData, n int) {
+	heavy := crawler.HeaviestHeads(pages, n)
+	if len(heavy) == 0 {
+		fmt.Println("\nHeaviest heads: no render-blocking signals recorded; crawl with -perf-signals")
+		return
+	}
+	fmt.Printf("\nHeaviest heads:\n")
+	fmt.Printf("  %10s %8s %8s %10s %10s %9s  %s\n", "head", "scripts", "styles", "inline js", "inline css", "oversized", "URL")
+	for _, page := range heavy {
+		p := page.Perf
+		fmt.Printf("  %10d %8d %8d %10d %10d %9d  %s\n",
+			p.HeadBytes, p.BlockingScripts, p.Stylesheets, p.LargestInlineScript, p.LargestInlineStyle, p.OversizedInline, page.URL)
+	}
+}
+
+// printLegacyMarkupReport prints the site-wide counts of legacy markup and
+// the pages with the most of it.
+func printLegacyMarkupReport(summary crawler.LegacyMarkupSummary) {
+	if summary.Audited == 0 {
+		fmt.Println("\nLegacy markup: none recorded; crawl with -legacy-markup")
+		return
+	}
+	fmt.Printf("\nLegacy markup: %d occurrences on %d of %d pages\n", summary.Total, summary.Affected, summary.Audited)
+	if summary.Affected == 0 {
+		return
+	}
+	fmt.Printf("  %8s %6s  %s\n", "count", "pages", "markup")
+	if s := summary.InlineStyles; s.Count > 0 {
+		fmt.Printf("  %8d %6d  style=\"...\"\n", s.Count, s.Pages)
+	}
+	for _, e := range summary.Elements {
+		fmt.Printf("  %8d %6d  <%s>\n", e.Count, e.Pages, e.Name)
+	}
+	for _, a := range summary.Attributes {
+		fmt.Printf("  %8d %6d  %s=\n", a.Count, a.Pages, a.Name)
+	}
+	fmt.Printf("\nMost legacy markup:\n")
+	for _, page := range summary.Worst {
+		legacy := page.LegacyMarkup
+		fmt.Printf("  %6d  %s (%d inline styles, %d elements, %d attributes)\n",
+			legacy.Total, page.URL, legacy.InlineStyles, sumCounts(legacy.Elements), sumCounts(legacy.Attributes))
+	}
+}
+
+// printUAComparisonReport lists the n first pages that answered the mobile
+// User-Agent of -ua-compare differently, with both answers of every field
+// that differs.
+func printUAComparisonReport(comparison *crawler.UAComparison, n int) {
+	if comparison == nil {
+		fmt.Println("\nMobile User-Agent: no comparison recorded; crawl with -ua-compare")
+		return
+	}
+	fmt.Printf("\nMobile User-Agent: %d of %d pages compared answer differently", len(comparison.Divergent), comparison.Compared)
+	if comparison.Compared < comparison.Sampled {
+		fmt.Printf(" (%d sampled; a budget ran out)", comparison.Sampled)
+	}
+	fmt.Printf("\n  %s\n", comparison.UserAgent)
+	for i, d := range comparison.Divergent {
+		if i == n {
+			fmt.Printf("  ... and %d more\n", len(comparison.Divergent)-i)
+			break
+		}
+		fmt.Printf("  %s\n", d.URL)
+		for _, field := range d.Fields {
+			desktop, mobile := uaFieldValue(d.Desktop, field), uaFieldValue(d.Mobile, field)
+			fmt.Printf("      %-10s desktop %s\n      %-10s mobile  %s\n", field, desktop, "", mobile)
+		}
+	}
+}
+
+// uaFieldValue formats field of view for printUAComparisonReport.
+func uaFieldValue(view crawler.UAView, field string) string {
+	var value string
+	switch field {
+	case crawler.UAFieldStatus:
+		if view.Error != "" {
+			return "error: " + view.Error
+		}
+		return strconv.Itoa(view.StatusCode)
+	case crawler.UAFieldFinalURL:
+		value = view.FinalURL
+	case crawler.UAFieldCanonical:
+		value = view.Canonical
+	case crawler.UAFieldTitle:
+		value = view.Title
+	case crawler.UAFieldContent:
+		value = view.ContentHash
+	}
+	if value == "" {
+		return "(none)"
+	}
+	return strconv.Quote(value)
+}
+
+// sumCounts adds up the values of counts.
+func sumCounts(counts map[string]int) int {
+	n := 0
+	for _, count := range counts {
+		n += count
+	}
+	return n
+}
+
+// printDateReport lists the oldest content by the dates pages state, and
+// the pages whose date disagrees with their Last-Modified header.
+func printDateReport(pages []crawler.PageData, n int, threshold time.Duration) {
+	var published, modified int
+	for _, page := range pages {
+		if page.PublishedAt != "" {
+			published++
+		}
+		if page.ModifiedAt != "" {
+			modified++
+		}
+	}
+	fmt.Printf("\nContent dates: %d pages state a publication date, %d a modification date\n", published, modified)
+	oldest := crawler.OldestContent(pages, n)
+	if len(oldest) == 0 {
+		return
+	}
+	fmt.Printf("\nOldest content:\n")
+	for _, page := range oldest {
+		at, source := page.ModifiedAt, "modified, "+page.ModifiedSource
+		if at == "" {
+			at, source = page.PublishedAt, "published, "+page.PublishedSource
+		}
+		fmt.Printf("  %-25s %-20s %s\n", at, source, page.URL)
+	}
+
+	mismatches := crawler.FindDateMismatches(pages, threshold)
+	fmt.Printf("\nOn-page dates more than %s from Last-Modified: %d\n", formatAge(threshold), len(mismatches))
+	for i, m := range mismatches {
+		if i == n {
+			fmt.Printf("  ... and %d more\n", len(mismatches)-i)
+			break
+		}
+		direction := "later"
+		if m.Difference < 0 {
+			direction = "earlier"
+		}
+		fmt.Printf("  %s: %s (%s), Last-Modified %s is %s %s\n",
+			m.URL, m.OnPage, m.Source, m.LastModified, formatAge(m.Difference.Abs()), direction)
+	}
+}
+
+// printDuplicatePatternReport lists the URL patterns that most often lead
+// to duplicate content, with the change each one suggests.
+func printDuplicatePatternReport(pages []crawler.PageData, minCases int) {
+	patterns := crawler.FindDuplicatePatterns(pages, minCases)
+	fmt.Printf("\nDuplicate content patterns: %d\n", len(patterns))
+	for i, p := range patterns {
+		if i == 10 {
+			fmt.Printf("  ... and %d more\n", len(patterns)-i)
+			break
+		}
+		fmt.Printf("  %s %q produces duplicates in %.0f%% of %d cases: %s\n",
+			p.Kind, p.Name, p.Ratio*100, p.Cases, p.Suggestion())
+		for _, example := range p.Examples {
+			fmt.Printf("      %s\n", example)
+		}
+	}
+}
+
+func printModifiedSinceReport(changes *crawler.ModifiedSinceSummary) {
+	fmt.Printf("\nChanged since %s: %d modified, %d unchanged\n",
+		changes.Since.Format(time.DateOnly), changes.Modified, changes.Unchanged)
+	if changes.IgnoredConditional > 0 {
+		fmt.Printf("  Note: %d modified pages have a Last-Modified that is not after the date; the server ignores\n"+
+			"  If-Modified-Since, so the modified count overstates changes. For example:\n", changes.IgnoredConditional)
+		for _, example := range changes.IgnoredExamples {
+			fmt.Printf("      %s\n", example)
+		}
+	}
+	if changes.NoLastModified > 0 {
+		fmt.Printf("  Note: %d modified pages have no Last-Modified header and may be unchanged\n", changes.NoLastModified)
+	}
+}
+
+func printMisconfigurationReport(found []crawler.URLMisconfiguration) {
+	fmt.Printf("\nMisconfigured canonical, hreflang and sitemap URLs: %d\n", len(found))
+	for i, m := range found {
+		if i == 20 {
+			fmt.Printf("  ... and %d more\n", len(found)-i)
+			break
+		}
+		kind := m.Kind
+		if m.Language != "" {
+			kind += " " + m.Language
+		}
+		fmt.Printf("  %-16s %-20s %s (declared on %s)\n", kind, strings.Join(m.Problems, ", "), m.URL, m.DeclaredOn)
+	}
+}
+
+// printSiteHygieneReport lists the robots.txt and sitemap files checked
+// and the problems found in them, with their line or entry, then the URLs
+// that only differ in case.
+func printSiteHygieneReport(h *crawler.SiteHygiene) {
+	fmt.Printf("\nSite hygiene: %d problems in %d files\n", len(h.Findings), len(h.Files))
+	for _, file := range h.Files {
+		status := fmt.Sprintf("HTTP %d", file.StatusCode)
+		if file.Error != "" {
+			status = file.Error
+		}
+		scope := ""
+		if file.InScope > 0 || file.OutOfScope > 0 {
+			scope = fmt.Sprintf(", %d in scope, %d out of scope", file.InScope, file.OutOfScope)
+		}
+		fmt.Printf("  %-10s %s (%s, %d entries%s)\n", file.Kind, file.URL, status, file.Entries, scope)
+	}
+	for i, f := range h.Findings {
+		if i == 50 {
+			fmt.Printf("  ... and %d more\n", len(h.Findings)-i)
+			break
+		}
+		where := f.File
+		switch {
+		case f.Line > 0 && f.Entry > 0:
+			where += fmt.Sprintf(":%d (entry %d)", f.Line, f.Entry)
+		case f.Line > 0:
+			where += fmt.Sprintf(":%d", f.Line)
+		case f.Entry > 0:
+			where += fmt.Sprintf(" (entry %d)", f.Entry)
+		}
+		fmt.Printf("  %-17s %s: %s\n", f.Problem, where, f.Detail)
+	}
+	if len(h.CaseCollisions) == 0 {
+		return
+	}
+	fmt.Printf("\nURLs differing only in case: %d\n", len(h.CaseCollisions))
+	for i, collision := range h.CaseCollisions {
+		if i == 50 {
+			fmt.Printf("  ... and %d more\n", len(h.CaseCollisions)-i)
+			break
+		}
+		fmt.Printf("  %-9s %s\n", collision.Verdict, collision.Detail)
+		for _, v := range collision.URLs {
+			status := fmt.Sprintf("HTTP %d", v.StatusCode)
+			switch {
+			case v.Error != "" && v.StatusCode == 0:
+				status = v.Error
+			case v.FinalURL != "":
+				status += " -> " + v.FinalURL
+			}
+			fmt.Printf("            %s (%s)\n", v.URL, status)
+		}
+	}
+}
+
+func printDangerousReport(found []crawler.DangerousURL) {
+	fmt.Printf("\nDangerous URLs linked with plain links, not crawled: %d\n", len(found))
+	for i, u := range found {
+		if i == 20 {
+			fmt.Printf("  ... and %d more\n", len(found)-i)
+			break
+		}
+		fmt.Printf("  %5d  %s (linked from %s)\n", u.Links, u.URL, strings.Join(u.LinkedFrom, ", "))
+	}
+}
+
+// printSectionReport prints one row per path section.
+func printSectionReport(found []crawler.PathSection) {
+	fmt.Printf("\nSections: %d\n", len(found))
+	fmt.Printf("  %-30s %7s %7s %7s %10s %10s %10s\n", "section", "pages", "errors", "error %", "avg ms", "avg KB", "dup titles")
+	for _, s := range found {
+		fmt.Printf("  %-30s %7d %7d %6.1f%% %10.0f %10.1f %10d\n",
+			s.Section, s.Pages, s.Errors, s.ErrorRate*100, s.AvgResponseTime, s.AvgSize/1024, s.DuplicateTitles)
+	}
+}
+
+// printQualityReport prints the distribution of the quality scores and the
+// lowest scoring pages with their problems.
+func printQualityReport(summary crawler.QualitySummary) {
+	fmt.Printf("\nQuality scores: %d pages, average %.1f, median %d\n", summary.Pages, summary.Average, summary.Median)
+	if summary.Pages == 0 {
+		return
+	}
+	for i := len(summary.Buckets) - 1; i >= 0; i-- {
+		high := i*10 + 9
+		if i == len(summary.Buckets)-1 {
+			high = 100
+		}
+		fmt.Printf("  %3d-%-3d %6d\n", i*10, high, summary.Buckets[i])
+	}
+	fmt.Printf("\nLowest scoring pages:\n")
+	for _, page := range summary.Bottom {
+		var problems []string
+		for _, p := range page.Problems {
+			problems = append(problems, fmt.Sprintf("%s -%d", p.Name, p.Weight))
+		}
+		fmt.Printf("  %3d  %s (%s)\n", page.Score, page.URL, strings.Join(problems, ", "))
+	}
+}
+
+// feedAgeBuckets are the columns of the feed report: the time from the
+// publication of an item to the start of the crawl.
+var feedAgeBuckets = []struct {
+	name string
+	max  time.Duration
+}{
+	{"<1h", time.Hour},
+	{"<1d", 24 * time.Hour},
+	{"<7d", 7 * 24 * time.Hour},
+	{"<30d", 30 * 24 * time.Hour},
+	{"older", 0},
+}
+
+// printFeedReport prints the crawl status of the feed items by the time
+// since their publication, then the items that were not crawled.
+func printFeedReport(result *crawler.CrawlResult) {
+	fmt.Printf("\nFeed items: %d in %d feeds\n", len(result.FeedItems), len(result.Feeds))
+	for _, feed := range result.Feeds {
+		if feed.Error != "" {
+			fmt.Printf("  unreadable: %s (%s)\n", feed.URL, feed.Error)
+		}
+	}
+	if len(result.FeedItems) == 0 {
+		return
+	}
+
+	bucketOf := func(item crawler.FeedItem) int {
+		if item.Published == nil {
+			return len(feedAgeBuckets)
+		}
+		age := result.StartTime.Sub(*item.Published)
+		for i, b := range feedAgeBuckets {
+			if b.max == 0 || age < b.max {
+				return i
+			}
+		}
+		return len(feedAgeBuckets) - 1
+	}
+	counts := make(map[string][]int)
+	var statuses []string
+	for _, item := range result.FeedItems {
+		if counts[item.Status] == nil {
+			counts[item.Status] = make([]int, len(feedAgeBuckets)+1)
+			statuses = append(statuses, item.Status)
+		}
+		counts[item.Status][bucketOf(item)]++
+	}
+	sort.Strings(statuses)
+	fmt.Printf("  %-20s", "status")
+	for _, b := range feedAgeBuckets {
+		fmt.Printf(" %7s", b.name)
+	}
+	fmt.Printf(" %7s\n", "undated")
+	for _, status := range statuses {
+		fmt.Printf("  %-20s", status)
+		for _, n := range counts[status] {
+			fmt.Printf(" %7d", n)
+		}
+		fmt.Println()
+	}
+
+	var missed []crawler.FeedItem
+	for _, item := range result.FeedItems {
+		if item.Status != crawler.EdgeCrawled {
+			missed = append(missed, item)
+		}
+	}
+	if len(missed) == 0 {
+		return
+	}
+	// Newest first, undated last.
+	sort.SliceStable(missed, func(i, j int) bool {
+		a, b := missed[i].Published, missed[j].Published
+		return a != nil && (b == nil || a.After(*b))
+	})
+	fmt.Printf("\nFeed items not crawled: %d\n", len(missed))
+	for i, item := range missed {
+		if i == 20 {
+			fmt.Printf("  ... and %d more\n", len(missed)-i)
+			break
+		}
+		age := "undated"
+		if item.Published != nil {
+			age = formatAge(result.StartTime.Sub(*item.Published))
+		}
+		status := item.Status
+		if item.Category != "" {
+			status += " " + item.Category
+		}
+		fmt.Printf("  %-12s %-24s %s\n", age, status, item.URL)
+	}
+}
+
+// formatAge formats d in minutes, hours or days, whichever reads best.
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+func writeSectionsJSON(filename string, found []crawler.PathSection) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(struct {
+		Sections []crawler.PathSection `json:"sections"`
+	}{found}); err != nil {
+		return fmt.Errorf("error encoding JSON: %v", err)
+	}
+	return file.Close()
+}
+
+func printAnchorReport(pages []crawler.PageData) {
+	report := crawler.FindAnchorReferences(pages)
+	if report.Pages == 0 && len(report.Dangling) == 0 {
+		fmt.Println("\nTable of contents: no headings with ids recorded; crawl with -toc")
+		return
+	}
+	fmt.Printf("\nTable of contents: %d linkable headings on %d pages, %d not linked from any crawled page\n",
+		report.Headings, report.Pages, len(report.Unreferenced))
+	for i, anchor := range report.Unreferenced {
+		if i == 20 {
+			fmt.Printf("  ... and %d more\n", len(report.Unreferenced)-i)
+			break
+		}
+		fmt.Printf("  %s#%s  %s\n", anchor.URL, anchor.ID, anchor.Text)
+	}
+	fmt.Printf("\nDangling fragment links: %d\n", len(report.Dangling))
+	for i, link := range report.Dangling {
+		if i == 20 {
+			fmt.Printf("  ... and %d more\n", len(report.Dangling)-i)
+			break
+		}
+		fmt.Printf("  %s#%s (linked from %s)\n", link.URL, link.Fragment, link.SourcePage)
+	}
+}
+
+func printCookieReport(pages []crawler.PageData) {
+	report := crawler.SummarizeCookies(pages)
+	fmt.Printf("\nCookies: %d names set by %d of %d pages\n", len(report.Cookies), report.PagesWithCookies, len(pages))
+	for _, usage := range report.Cookies {
+		var flags []string
+		if usage.Secure {
+			flags = append(flags, "secure")
+		}
+		if usage.HTTPOnly {
+			flags = append(flags, "httponly")
+		}
+		if len(usage.SameSite) > 0 {
+			flags = append(flags, "samesite="+strings.Join(usage.SameSite, "/"))
+		}
+		if usage.ThirdParty {
+			flags = append(flags, "third-party")
+		}
+		domain := usage.Domain
+		if domain == "" {
+			domain = "(host only)"
+		}
+		fmt.Printf("  %5d  %-30s %-25s %s\n", usage.Pages, usage.Name, domain, strings.Join(flags, " "))
+	}
+	if len(report.ThirdPartyDomains) > 0 {
+		fmt.Printf("Third-party cookie domains: %s\n", strings.Join(report.ThirdPartyDomains, ", "))
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"webcrawler/crawler"
+)
+
+// runResults implements the "results" subcommand, which prints a page of
+// the URLs of a saved crawl result selected by filters, so that large
+// crawls can be browsed without loading the whole file, here or elsewhere.
+func runResults(args []string) error {
+	fs := flag.NewFlagSet("results", flag.ExitOnError)
+	input := fs.String("input", "crawl_results.json", "crawl results file to read")
+	var where []string
+	fs.Var(stringList{&where}, "where", "filter such as status>=400, depth<=2, path^=/blog or title~=sale (repeatable, all must match)")
+	orderBy := fs.String("order", "url", "field to order by: url, path, status, depth, size, time, title or category")
+	desc := fs.Bool("desc", false, "order descending")
+	offset := fs.Int("offset", 0, "rows to skip")
+	limit := fs.Int("limit", 50, "rows to print (0 = all)")
+	format := fs.String("format", "table", "output format: table or json")
+	fs.Parse(args)
+
+	query := crawler.ResultQuery{OrderBy: *orderBy, Desc: *desc, Offset: *offset, Limit: *limit}
+	for _, expr := range where {
+		filter, err := crawler.ParseResultFilter(expr)
+		if err != nil {
+			return err
+		}
+		query.Filters = append(query.Filters, filter)
+	}
+	if err := crawler.ValidateResultOrder(*orderBy); err != nil {
+		return err
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	set, err := crawler.QueryResultsFile(*input, query)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(set)
+	}
+
+	fmt.Printf("%6s %5s %9s %7s  %s\n", "status", "depth", "size", "time", "URL")
+	for _, row := range set.Rows {
+		fmt.Printf("%6d %5d %9d %6dms  %s\n", row.StatusCode, row.Depth, row.Size, row.ResponseTime, row.URL)
+		switch {
+		case row.Error != "":
+			fmt.Printf("%30s %s: %s\n", "", row.Category, row.Error)
+		case row.Title != "":
+			fmt.Printf("%30s %s\n", "", row.Title)
+		}
+	}
+	fmt.Printf("\nRows %d-%d of %d", min(set.Offset+1, set.Offset+len(set.Rows)), set.Offset+len(set.Rows), set.Total)
+	if set.NextOffset > 0 {
+		fmt.Printf("; next page with -offset %d", set.NextOffset)
+	}
+	fmt.Println()
+	return nil
+}
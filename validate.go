@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"webcrawler/crawler"
+)
+
+// runValidate implements the "validate" subcommand: it checks a
+// configuration and prints the effective settings without crawling. It
+// returns false when the configuration has errors.
+func runValidate(args []string) bool {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	probe := fs.Bool("probe", false, "also send a HEAD request to the seed URL and its robots.txt")
+	cfg, err := parseConfig(fs, args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return false
+	}
+
+	issues := cfg.check()
+	if *probe && len(issues.Errors) == 0 {
+		probeSeed(cfg, &issues)
+	}
+
+	effective, err := cfg.maskedYAML()
+	if err != nil {
+		issues.errorf("cannot render configuration: %v", err)
+	}
+	fmt.Println("Effective configuration:")
+	fmt.Println(effective)
+
+	for _, warning := range issues.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+	for _, e := range issues.Errors {
+		fmt.Printf("Error: %s\n", e)
+	}
+	if len(issues.Errors) > 0 {
+		fmt.Printf("Configuration is invalid: %d errors, %d warnings\n", len(issues.Errors), len(issues.Warnings))
+		return false
+	}
+	fmt.Printf("Configuration is valid (%d warnings)\n", len(issues.Warnings))
+	return true
+}
+
+// probeSeed sends a HEAD request to the seed URL and its robots.txt.
+func probeSeed(cfg *Config, issues *configIssues) {
+	opts, err := cfg.options()
+	if err != nil {
+		issues.errorf("%v", err)
+		return
+	}
+	c, err := crawler.NewCrawler(cfg.URL, cfg.Depth, cfg.RPS, opts...)
+	if err != nil {
+		issues.errorf("url: %v", err)
+		return
+	}
+
+	seed := c.BaseURL()
+	robots := *seed
+	robots.Path, robots.RawPath, robots.RawQuery = "/robots.txt", "", ""
+	for _, target := range []string{crawler.NormalizeURL(seed), robots.String()} {
+		status, err := c.Head(target)
+		switch {
+		case err != nil:
+			issues.errorf("probe %s: %v", target, err)
+		case status >= 400 && target == robots.String():
+			issues.warnf("probe %s: status %d", target, status)
+		case status >= 400:
+			issues.errorf("probe %s: status %d", target, status)
+		default:
+			fmt.Printf("Probe %s: status %d\n", target, status)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"webcrawler/crawler"
+)
+
+// runVerify implements the "verify" subcommand, which fetches the URLs of
+// an inventory without discovering others and compares their statuses and
+// redirect targets with the expected ones. It returns the number of rows
+// that failed.
+func runVerify(args []string) (int, error) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	output := fs.String("out", "verify_results.csv", "file the pass or fail of every row is written to")
+	results := fs.String("results", "", "also save the crawl results to this JSON file")
+	rps := 2.0
+	fs.Var(rpsFlag{&rps}, "rps", "maximum requests per second (0 or unlimited = no rate limiting)")
+	timeout := fs.Duration("timeout", crawler.DefaultTimeout, "time limit for a single request (0 = unlimited)")
+	contact := fs.String("contact", "", "contact URL or email address sent with every request")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: webcrawler verify [-out file] [-rps n] expectations.csv")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 0, fmt.Errorf("give one expectations file")
+	}
+
+	expectations, err := crawler.LoadExpectations(fs.Arg(0))
+	if err != nil {
+		return 0, err
+	}
+	urls := crawler.ExpectationURLs(expectations)
+	if targets := crawler.ExpectationTargets(expectations); targets > 0 {
+		fmt.Printf("Fetching %d URLs: %d from the inventory and %d expected targets not in it\n", len(urls), len(urls)-targets, targets)
+	}
+	base, err := url.Parse(urls[0])
+	if err != nil {
+		return 0, err
+	}
+	// The inventory may span hosts, such as the old and the new domain of a
+	// migration; every host it names is crawled.
+	var hosts []crawler.HostWeight
+	seen := map[string]bool{}
+	for _, raw := range urls {
+		if u, err := url.Parse(raw); err == nil && !seen[u.Host] {
+			seen[u.Host] = true
+			hosts = append(hosts, crawler.HostWeight{Host: u.Host})
+		}
+	}
+	opts := []crawler.Option{
+		crawler.WithOnlyListed(urls),
+		crawler.WithTimeout(*timeout),
+		crawler.WithContact(*contact),
+	}
+	if len(hosts) > 1 {
+		opts = append(opts, crawler.WithHosts(hosts))
+	}
+	if *results != "" {
+		opts = append(opts, crawler.WithOutputPath(*results))
+	}
+	c, err := crawler.NewCrawler(base.String(), 0, rps, opts...)
+	if err != nil {
+		return 0, fmt.Errorf("error creating crawler: %v", err)
+	}
+	result, err := c.Start(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("error during verification: %v", err)
+	}
+
+	verifications := crawler.VerifyExpectations(result, expectations)
+	if err := crawler.WriteVerificationsCSV(*output, verifications); err != nil {
+		return 0, err
+	}
+	failed := 0
+	for _, v := range verifications {
+		if !v.Pass {
+			failed++
+		}
+	}
+	fmt.Printf("\nVerified %d URLs: %d passed, %d failed\n", len(verifications), len(verifications)-failed, failed)
+	shown := 0
+	for _, v := range verifications {
+		if v.Pass {
+			continue
+		}
+		if shown == 20 {
+			fmt.Printf("  ... and %d more\n", failed-shown)
+			break
+		}
+		fmt.Printf("  line %d  %s: %s\n", v.Line, v.URL, strings.Join(v.Problems, "; "))
+		shown++
+	}
+	fmt.Printf("Verification saved to %s\n", *output)
+	return failed, nil
+}